@@ -1,14 +1,25 @@
 package main
 
 import (
+	"errors"
 	"log"
 	"os"
 
 	"github.com/photodialectic/claudex/internal/cli"
+	"github.com/photodialectic/claudex/internal/output"
 )
 
 func main() {
 	if err := cli.Execute(os.Args[1:]); err != nil {
-		log.Fatalf("error: %v", err)
+		var reported cli.ReportedError
+		code := 1
+		var exit interface{ ExitCode() int }
+		if errors.As(err, &exit) && exit.ExitCode() > 0 {
+			code = exit.ExitCode()
+		}
+		if !errors.As(err, &reported) {
+			log.Printf("%s %v", output.Paint(os.Stderr, output.Red, output.T(output.MsgError)), err)
+		}
+		os.Exit(code)
 	}
 }
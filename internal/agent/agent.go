@@ -0,0 +1,162 @@
+// Package agent talks to claudex-agent, the supervisor the image runs as each
+// container's command. It serves a small HTTP API on a unix socket inside the
+// container; the host reaches it through `docker exec claudex-agent request`,
+// one exec per call instead of ad-hoc command chains.
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/index"
+)
+
+// Socket is the supervisor's control socket inside the container.
+const Socket = "/tmp/claudex/agent.sock"
+
+// HeartbeatInterval is how often the supervisor refreshes its heartbeat.
+const HeartbeatInterval = 10 * time.Second
+
+// ErrNoAgent means the container has no running supervisor, usually because
+// its image predates claudex-agent.
+var ErrNoAgent = errors.New("no claudex-agent running")
+
+// Server is an MCP server the supervisor keeps running.
+type Server struct {
+	Name     string `json:"name"`
+	PID      int    `json:"pid"`
+	Running  bool   `json:"running"`
+	Restarts int    `json:"restarts"`
+}
+
+// Agent is a running agent CLI.
+type Agent struct {
+	PID  int    `json:"pid"`
+	Name string `json:"name"`
+}
+
+// Firewall reports whether the firewall was applied since the container
+// started, and the domains it allows.
+type Firewall struct {
+	Active bool     `json:"active"`
+	Allow  []string `json:"allow"`
+}
+
+// Repo summarizes a git repository under /workspace.
+type Repo struct {
+	Path    string `json:"path"`
+	Branch  string `json:"branch"`
+	Head    string `json:"head"`
+	Changed int    `json:"changed"`
+}
+
+// Port is a TCP port something in the container listens on (GET /ports).
+// Loopback means it is bound to 127.0.0.1 or ::1 only. PID and Process are
+// zero when the owning process is not visible to the supervisor.
+type Port struct {
+	Port     int    `json:"port"`
+	Loopback bool   `json:"loopback"`
+	PID      int    `json:"pid"`
+	Process  string `json:"process"`
+}
+
+// Status is the supervisor's report (GET /status).
+type Status struct {
+	PID int `json:"pid"`
+	// Started and Heartbeat are Unix times.
+	Started   int64    `json:"started"`
+	Heartbeat int64    `json:"heartbeat"`
+	Uptime    int64    `json:"uptime"`
+	MCP       []Server `json:"mcp"`
+	Agents    []Agent  `json:"agents"`
+	Firewall  Firewall `json:"firewall"`
+	Git       []Repo   `json:"git"`
+	// Index is the workspace file index, nil when none was built (or the
+	// supervisor predates it).
+	Index *index.Info `json:"index"`
+}
+
+// HeartbeatAge is how long ago the supervisor last checked in.
+func (s Status) HeartbeatAge(now time.Time) time.Duration {
+	if s.Heartbeat == 0 {
+		return 0
+	}
+	return now.Sub(time.Unix(s.Heartbeat, 0))
+}
+
+// Stalled reports a heartbeat missed for several intervals, which means the
+// supervisor is wedged even though its socket answered.
+func (s Status) Stalled(now time.Time) bool {
+	return s.HeartbeatAge(now) > 3*HeartbeatInterval
+}
+
+// APIError is a non-2xx answer from the supervisor.
+type APIError struct {
+	Status int
+	Body   string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("claudex-agent: %d %s", e.Status, e.Body)
+}
+
+// Do sends METHOD PATH to the supervisor in container name and returns the
+// response body.
+func Do(dx dockerx.Docker, name, method, path string) ([]byte, error) {
+	out, err := dx.ExecOutput(name, []string{"claudex-agent", "request", method, path})
+	if err != nil {
+		msg := strings.TrimSpace(string(out))
+		if msg == "" || strings.Contains(msg, "not running") || strings.Contains(msg, "not found") || strings.Contains(msg, "usage:") {
+			return nil, fmt.Errorf("%s: %w (recreate it from an image built by this claudex)", name, ErrNoAgent)
+		}
+		return nil, fmt.Errorf("%s: claudex-agent request: %v: %s", name, err, msg)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), nil)
+	if err != nil {
+		// An older supervisor that does not speak HTTP.
+		return nil, fmt.Errorf("%s: %w (unreadable response: %v)", name, ErrNoAgent, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return body, &APIError{Status: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+	return body, nil
+}
+
+// Get is Do with GET, decoding a JSON body into v unless v is nil.
+func Get(dx dockerx.Docker, name, path string, v any) ([]byte, error) {
+	body, err := Do(dx, name, "GET", path)
+	if err != nil || v == nil {
+		return body, err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return body, fmt.Errorf("%s: unreadable claudex-agent %s: %w", name, path, err)
+	}
+	return body, nil
+}
+
+// Query asks the supervisor in container name for its status.
+func Query(dx dockerx.Docker, name string) (Status, error) {
+	var s Status
+	_, err := Get(dx, name, "/status", &s)
+	return s, err
+}
+
+// Ports lists the ports listened on in container name.
+func Ports(dx dockerx.Docker, name string) ([]Port, error) {
+	var ports []Port
+	_, err := Get(dx, name, "/ports", &ports)
+	return ports, err
+}
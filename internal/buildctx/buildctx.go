@@ -1,24 +1,151 @@
 package buildctx
 
 import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
 	"embed"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/config"
 )
 
-//go:embed Dockerfile init-firewall.sh CLAUDEX.md .tmux.conf .vimrc google-docs-mcp/**
+//go:embed Dockerfile init-firewall.sh claudex-audit.sh claudex-agent.sh git-credential-claudex.sh CLAUDEX.md .tmux.conf .vimrc google-docs-mcp/**
 var dockerContextFS embed.FS
 
+// OverrideDir returns the directory whose files replace or augment the embedded
+// build context (~/.config/claudex/context).
+func OverrideDir() (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "context"), nil
+}
+
+// OverlayFile, in OverrideDir, holds Dockerfile instructions appended to the
+// Dockerfile (embedded or overridden) instead of replacing it, so user
+// additions such as `claudex pkg add --persist` survive claudex upgrades.
+const OverlayFile = "Dockerfile.overlay"
+
+// OverlayPath returns the path of OverlayFile.
+func OverlayPath() (string, error) {
+	dir, err := OverrideDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, OverlayFile), nil
+}
+
+// withOverlay returns dockerfile with overlay appended.
+func withOverlay(dockerfile, overlay []byte) []byte {
+	if len(overlay) == 0 {
+		return dockerfile
+	}
+	res := append([]byte(nil), dockerfile...)
+	if len(res) > 0 && res[len(res)-1] != '\n' {
+		res = append(res, '\n')
+	}
+	res = append(res, "\n# "+OverlayFile+"\n"...)
+	return append(res, overlay...)
+}
+
+// Overrides lists files under OverrideDir, relative to it. A missing directory yields none.
+func Overrides() ([]string, error) {
+	dir, err := OverrideDir()
+	if err != nil {
+		return nil, err
+	}
+	return listFiles(dir)
+}
+
+func listFiles(root string) ([]string, error) {
+	if fi, err := os.Stat(root); err != nil || !fi.IsDir() {
+		return nil, nil
+	}
+	var res []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		res = append(res, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot read build context overrides in %s: %w", root, err)
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// applyOverrides copies every file under overrideDir into ctxDir, keeping modes.
+func applyOverrides(ctxDir, overrideDir string) error {
+	files, err := listFiles(overrideDir)
+	if err != nil {
+		return err
+	}
+	for _, rel := range files {
+		src := filepath.Join(overrideDir, rel)
+		fi, err := os.Stat(src)
+		if err != nil {
+			return fmt.Errorf("cannot stat override %s: %w", src, err)
+		}
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return fmt.Errorf("cannot read override %s: %w", src, err)
+		}
+		target := filepath.Join(ctxDir, rel)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("cannot create %s in temp dir: %w", filepath.Dir(rel), err)
+		}
+		if err := os.WriteFile(target, data, fi.Mode().Perm()); err != nil {
+			return fmt.Errorf("cannot write override %s to temp dir: %w", rel, err)
+		}
+	}
+	return nil
+}
+
+// applyOverlay appends the copied OverlayFile in ctxDir to its Dockerfile.
+func applyOverlay(ctxDir string) error {
+	overlay, err := os.ReadFile(filepath.Join(ctxDir, OverlayFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	df := filepath.Join(ctxDir, "Dockerfile")
+	data, err := os.ReadFile(df)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(df, withOverlay(data, overlay), 0644)
+}
+
 // PrepareBuildContext writes embedded files to a temp directory and returns its path
-// together with a cleanup function that removes the directory.
+// together with a cleanup function that removes the directory. Files under
+// OverrideDir replace or augment the embedded copies.
 func PrepareBuildContext() (string, func() error, error) {
 	tmpDir, err := os.MkdirTemp("", "claudex-build-")
 	if err != nil {
 		return "", nil, fmt.Errorf("cannot create temp build dir: %w", err)
 	}
-	files := []string{"Dockerfile", "init-firewall.sh", "CLAUDEX.md", ".tmux.conf", ".vimrc"}
+	files := []string{"Dockerfile", "init-firewall.sh", "claudex-audit.sh", "claudex-agent.sh", "git-credential-claudex.sh", "CLAUDEX.md", ".tmux.conf", ".vimrc"}
 	for _, name := range files {
 		data, err := dockerContextFS.ReadFile(name)
 		if err != nil {
@@ -55,6 +182,197 @@ func PrepareBuildContext() (string, func() error, error) {
 		return "", nil, err
 	}
 
+	if err := Verify(tmpDir); err != nil {
+		os.RemoveAll(tmpDir)
+		return "", nil, err
+	}
+
+	if overrideDir, err := OverrideDir(); err == nil {
+		if err := applyOverrides(tmpDir, overrideDir); err != nil {
+			os.RemoveAll(tmpDir)
+			return "", nil, err
+		}
+		if err := applyOverlay(tmpDir); err != nil {
+			os.RemoveAll(tmpDir)
+			return "", nil, err
+		}
+	}
+
 	cleanup := func() error { return os.RemoveAll(tmpDir) }
 	return tmpDir, cleanup, nil
 }
+
+// FromDir validates a working-tree build context (e.g. internal/buildctx in a
+// checkout) so it can be passed to docker build in place of the embedded files.
+// The returned cleanup is a no-op because the directory is not ours to remove.
+func FromDir(dir string) (string, func() error, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid build context dir %s: %w", dir, err)
+	}
+	if fi, err := os.Stat(filepath.Join(abs, "Dockerfile")); err != nil || fi.IsDir() {
+		return "", nil, fmt.Errorf("build context dir %s has no Dockerfile", abs)
+	}
+	return abs, func() error { return nil }, nil
+}
+
+// File describes one entry of a build context.
+type File struct {
+	Path   string
+	Size   int64
+	SHA256 string
+}
+
+// Describe lists every file under dir with its size and SHA-256, sorted by path.
+func Describe(dir string) ([]File, error) {
+	paths, err := listFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	var res []File
+	for _, rel := range paths {
+		data, err := os.ReadFile(filepath.Join(dir, rel))
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s: %w", rel, err)
+		}
+		res = append(res, File{Path: rel, Size: int64(len(data)), SHA256: hashOf(data)})
+	}
+	return res, nil
+}
+
+// Verify checks that every embedded file was extracted into dir byte-for-byte,
+// catching embed patterns or extraction lists that drift out of sync.
+func Verify(dir string) error {
+	return fs.WalkDir(dockerContextFS, ".", func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if d.IsDir() {
+			return nil
+		}
+		want, err := dockerContextFS.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("cannot read embedded %s: %w", path, err)
+		}
+		got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(path)))
+		if err != nil {
+			return fmt.Errorf("build context verification failed: embedded %s was not extracted", path)
+		}
+		if !bytes.Equal(got, want) {
+			return fmt.Errorf("build context verification failed: %s hash %s, embedded %s", path, hashOf(got)[:12], hashOf(want)[:12])
+		}
+		return nil
+	})
+}
+
+func hashOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+type tarEntry struct {
+	data []byte
+	mode int64
+}
+
+// WriteTar writes the embedded build context, with OverrideDir applied, to w as
+// a tar stream suitable for `docker build -`. Nothing touches the filesystem.
+func WriteTar(w io.Writer) error {
+	entries := map[string]tarEntry{}
+	err := fs.WalkDir(dockerContextFS, ".", func(p string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if d.IsDir() {
+			return nil
+		}
+		data, err := dockerContextFS.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("cannot read embedded %s: %w", p, err)
+		}
+		entries[p] = tarEntry{data: data, mode: 0644}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if overrideDir, err := OverrideDir(); err == nil {
+		files, err := listFiles(overrideDir)
+		if err != nil {
+			return err
+		}
+		for _, rel := range files {
+			src := filepath.Join(overrideDir, rel)
+			fi, err := os.Stat(src)
+			if err != nil {
+				return fmt.Errorf("cannot stat override %s: %w", src, err)
+			}
+			data, err := os.ReadFile(src)
+			if err != nil {
+				return fmt.Errorf("cannot read override %s: %w", src, err)
+			}
+			entries[filepath.ToSlash(rel)] = tarEntry{data: data, mode: int64(fi.Mode().Perm())}
+		}
+		if o, ok := entries[OverlayFile]; ok {
+			df := entries["Dockerfile"]
+			df.data = withOverlay(df.data, o.data)
+			entries["Dockerfile"] = df
+		}
+	}
+
+	names := make([]string, 0, len(entries))
+	for n := range entries {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	// Fixed timestamps keep the stream deterministic between runs.
+	mtime := time.Unix(0, 0)
+	tw := tar.NewWriter(w)
+	dirs := map[string]bool{}
+	for _, n := range names {
+		for dir := path.Dir(n); dir != "."; dir = path.Dir(dir) {
+			if dirs[dir] {
+				break
+			}
+			dirs[dir] = true
+		}
+	}
+	var dirNames []string
+	for d := range dirs {
+		dirNames = append(dirNames, d)
+	}
+	sort.Strings(dirNames)
+	for _, d := range dirNames {
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: d + "/", Mode: 0755, ModTime: mtime}); err != nil {
+			return err
+		}
+	}
+	for _, n := range names {
+		e := entries[n]
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: n, Mode: e.mode, Size: int64(len(e.data)), ModTime: mtime}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(e.data); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// Stream returns a reader producing WriteTar output; errors surface on Read.
+func Stream() io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() { pw.CloseWithError(WriteTar(pw)) }()
+	return pr
+}
+
+// Context resolves the docker build context argument: a working-tree dir when
+// dir is set, otherwise "-" together with the embedded tar stream for stdin.
+// A non-nil reader must be closed by the caller.
+func Context(dir string) (string, io.ReadCloser, error) {
+	if dir != "" {
+		abs, _, err := FromDir(dir)
+		return abs, nil, err
+	}
+	return "-", Stream(), nil
+}
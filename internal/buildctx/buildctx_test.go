@@ -0,0 +1,163 @@
+package buildctx
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrepareBuildContextAppliesOverrides(t *testing.T) {
+	cfg := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", cfg)
+	over := filepath.Join(cfg, "claudex", "context")
+	if err := os.MkdirAll(filepath.Join(over, "my-mcp"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(over, "CLAUDEX.md"), []byte("custom"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(over, "my-mcp", "server.py"), []byte("print()"), 0755); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	dir, cleanup, err := PrepareBuildContext()
+	if err != nil {
+		t.Fatalf("PrepareBuildContext: %v", err)
+	}
+	defer cleanup()
+
+	got, err := os.ReadFile(filepath.Join(dir, "CLAUDEX.md"))
+	if err != nil || string(got) != "custom" {
+		t.Fatalf("expected overridden CLAUDEX.md, got %q err=%v", got, err)
+	}
+	fi, err := os.Stat(filepath.Join(dir, "my-mcp", "server.py"))
+	if err != nil || fi.Mode().Perm()&0100 == 0 {
+		t.Fatalf("expected executable augmented file, fi=%v err=%v", fi, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Dockerfile")); err != nil {
+		t.Fatalf("embedded Dockerfile missing: %v", err)
+	}
+
+	files, err := Overrides()
+	if err != nil || len(files) != 2 || files[0] != "CLAUDEX.md" {
+		t.Fatalf("Overrides = %v err=%v", files, err)
+	}
+}
+
+func TestFromDirRequiresDockerfile(t *testing.T) {
+	dir := t.TempDir()
+	if _, _, err := FromDir(dir); err == nil {
+		t.Fatalf("expected error without Dockerfile")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	got, cleanup, err := FromDir(dir)
+	if err != nil || got != dir {
+		t.Fatalf("FromDir = %q err=%v", got, err)
+	}
+	if err := cleanup(); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Fatalf("cleanup must not remove a caller-owned dir: %v", err)
+	}
+}
+
+func TestVerifyDetectsMissingAndModifiedFiles(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir, cleanup, err := PrepareBuildContext()
+	if err != nil {
+		t.Fatalf("PrepareBuildContext: %v", err)
+	}
+	defer cleanup()
+	if err := Verify(dir); err != nil {
+		t.Fatalf("fresh context should verify: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".vimrc"), []byte("tampered"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := Verify(dir); err == nil {
+		t.Fatalf("expected hash mismatch")
+	}
+	if err := os.Remove(filepath.Join(dir, ".vimrc")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if err := Verify(dir); err == nil {
+		t.Fatalf("expected missing file error")
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a"), []byte("abc"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	files, err := Describe(dir)
+	if err != nil {
+		t.Fatalf("Describe: %v", err)
+	}
+	if len(files) != 1 || files[0].Path != "a" || files[0].Size != 3 || files[0].SHA256 != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Fatalf("unexpected describe output: %+v", files)
+	}
+}
+
+func TestWriteTarIncludesEmbeddedAndOverrides(t *testing.T) {
+	cfg := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", cfg)
+	over := filepath.Join(cfg, "claudex", "context")
+	if err := os.MkdirAll(over, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(over, "CLAUDEX.md"), []byte("custom"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	overlay := "RUN npm install -g typescript\n"
+	if err := os.WriteFile(filepath.Join(over, OverlayFile), []byte(overlay), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteTar(&buf); err != nil {
+		t.Fatalf("WriteTar: %v", err)
+	}
+	tr := tar.NewReader(&buf)
+	seen := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("tar read: %v", err)
+		}
+		data, _ := io.ReadAll(tr)
+		seen[hdr.Name] = string(data)
+	}
+	if _, ok := seen["Dockerfile"]; !ok {
+		t.Fatalf("Dockerfile missing from tar: %v", seen)
+	}
+	if _, ok := seen["google-docs-mcp/"]; !ok {
+		t.Fatalf("expected directory entry for google-docs-mcp")
+	}
+	if seen["CLAUDEX.md"] != "custom" {
+		t.Fatalf("override not applied, CLAUDEX.md = %q", seen["CLAUDEX.md"])
+	}
+	embedded, _ := dockerContextFS.ReadFile("Dockerfile")
+	if df := seen["Dockerfile"]; !strings.HasPrefix(df, string(embedded)) || !strings.HasSuffix(df, "\n# "+OverlayFile+"\n"+overlay) {
+		t.Fatalf("overlay not appended to the Dockerfile:\n%s", df[len(df)-200:])
+	}
+
+	dir, cleanup, err := PrepareBuildContext()
+	if err != nil {
+		t.Fatalf("PrepareBuildContext: %v", err)
+	}
+	defer cleanup()
+	if df, _ := os.ReadFile(filepath.Join(dir, "Dockerfile")); string(df) != seen["Dockerfile"] {
+		t.Fatalf("prepared Dockerfile differs from the streamed one")
+	}
+}
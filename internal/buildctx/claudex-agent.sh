@@ -0,0 +1,258 @@
+#!/bin/bash
+# claudex-agent supervises a claudex container. It is the container command,
+# running under tini (the image entrypoint), which reaps zombies as PID 1 and
+# forwards stop signals to the whole process group, servers included.
+# It serves a small HTTP API on a unix socket (see handle), keeps the servers in ~/.claudex/mcp
+# running, refreshes a heartbeat and then writes the readiness marker
+# claudex waits for. Under --ttl it stops the container at the deadline.
+#
+#   claudex-agent                        supervise (the container command)
+#   claudex-agent status                 print the supervisor's status as JSON
+#   claudex-agent request METHOD PATH    send an API request, print the raw response
+#   claudex-agent handle                 answer one request read from stdin (the socket)
+#
+# Each executable in ~/.claudex/mcp is a long-running (HTTP/SSE) MCP server,
+# restarted with backoff when it exits; its output goes to
+# /tmp/claudex/mcp/<name>.log.
+set -u
+
+STATE=/tmp/claudex
+SOCK=$STATE/agent.sock
+READY=/tmp/claudex-ready
+MCP_DIR=${CLAUDEX_MCP_DIR:-$HOME/.claudex/mcp}
+INTERVAL=${CLAUDEX_HEARTBEAT_INTERVAL:-10}
+INDEX=/home/node/.cache/claudex/index
+
+mcp_json() {
+  local f name pid running
+  for f in "$STATE"/mcp/*.pid; do
+    [ -e "$f" ] || continue
+    name=$(basename "$f" .pid)
+    pid=$(cat "$f")
+    running=false
+    kill -0 "$pid" 2>/dev/null && running=true
+    jq -nc --arg name "$name" --argjson pid "$pid" --argjson running $running \
+      --argjson restarts "$(cat "$STATE/mcp/$name.restarts" 2>/dev/null || echo 0)" \
+      '{name: $name, pid: $pid, running: $running, restarts: $restarts}'
+  done | jq -sc .
+}
+
+# agents_json lists the agent CLIs running, which often show as node scripts.
+agents_json() {
+  ps -eo pid=,args= | while read -r pid prog arg1 _; do
+    p=${prog##*/}
+    [ "$p" = node ] && p=${arg1##*/}
+    case $p in
+      claude | codex | gemini | copilot | opencode) jq -nc --argjson pid "$pid" --arg name "$p" '{pid: $pid, name: $name}' ;;
+    esac
+  done | jq -sc .
+}
+
+# firewall_json reports whether init-firewall.sh ran since the container
+# started (see firewallCurrentScript in claudex) and the allowed domains.
+firewall_json() {
+  local active=false
+  [ "$(cut -d' ' -f1 /run/claudex-firewall 2>/dev/null)" = "$(cut -d' ' -f22 /proc/1/stat)" ] && active=true
+  /usr/local/bin/init-firewall.sh --list 2>/dev/null | jq -Rsc --argjson active $active \
+    '{active: $active, allow: (split("\n") | map(select(length > 0)))}'
+}
+
+git_json() {
+  local r
+  {
+    [ -d /workspace/.git ] && echo /workspace
+    for r in /workspace/*/; do [ -e "$r.git" ] && echo "${r%/}"; done
+  } | while read -r r; do
+    jq -nc --arg path "$r" --arg branch "$(git -C "$r" rev-parse --abbrev-ref HEAD 2>/dev/null)" \
+      --arg head "$(git -C "$r" rev-parse --short HEAD 2>/dev/null)" \
+      --argjson changed "$(git -C "$r" status --porcelain 2>/dev/null | wc -l)" \
+      '{path: $path, branch: $branch, head: $head, changed: $changed}'
+  done | jq -sc .
+}
+
+# index_json reports the last `claudex index` build (null when there is
+# none), stale when anything under /workspace changed after it started.
+index_json() {
+  local meta=$INDEX/meta.json stale=false
+  if [ ! -f "$meta" ]; then
+    echo null
+    return
+  fi
+  [ -n "$(find /workspace -name .git -prune -o -newer "$meta" -print -quit 2>/dev/null)" ] && stale=true
+  jq -c --argjson stale $stale '. + {stale: $stale}' "$meta"
+}
+
+# ports_json lists the TCP ports listened on in the container, read from
+# /proc/net (ss is not in the image), with the owning process where its fds
+# are visible to us. loopback is true when only 127.0.0.1/::1 is bound.
+ports_json() {
+  local f link socks addr st inode ip port pid loopback
+  socks=$(for f in /proc/[0-9]*/fd/*; do
+    link=$(readlink "$f" 2>/dev/null) || continue
+    case $link in socket:*) f=${f#/proc/} && echo "${link#socket:[} ${f%%/*}" ;; esac
+  done | tr -d ']')
+  cat /proc/net/tcp /proc/net/tcp6 2>/dev/null | while read -r _ addr _ st _ _ _ _ _ inode _; do
+    [ "$st" = 0A ] || continue
+    ip=${addr%:*}
+    port=$((16#${addr##*:}))
+    case $ip in
+      *7F | 00000000000000000000000001000000) loopback=true ;;
+      *) loopback=false ;;
+    esac
+    pid=$(awk -v i="$inode" '$1 == i { print $2; exit }' <<<"$socks")
+    jq -nc --argjson port "$port" --argjson loopback $loopback --argjson pid "${pid:-0}" \
+      --arg process "$([ -n "$pid" ] && cat "/proc/$pid/comm" 2>/dev/null)" \
+      '{port: $port, loopback: $loopback, pid: $pid, process: $process}'
+  done | jq -sc 'group_by(.port) | map(.[0] + {loopback: all(.[]; .loopback), pid: (map(.pid) | max), process: (map(.process) | max)})'
+}
+
+status_json() {
+  local now started
+  now=$(date +%s)
+  started=$(cat "$STATE/started" 2>/dev/null || echo "$now")
+  jq -nc --argjson pid "$(cat "$STATE/pid" 2>/dev/null || echo 0)" --argjson started "$started" \
+    --argjson heartbeat "$(cat "$STATE/heartbeat" 2>/dev/null || echo 0)" --argjson uptime $((now - started)) \
+    --argjson mcp "$(mcp_json)" --argjson agents "$(agents_json)" \
+    --argjson firewall "$(firewall_json)" --argjson git "$(git_json)" --argjson index "$(index_json)" \
+    '{pid: $pid, started: $started, heartbeat: $heartbeat, uptime: $uptime, mcp: $mcp, agents: $agents, firewall: $firewall, git: $git, index: $index}'
+}
+
+# respond STATUS CONTENT-TYPE writes an HTTP/1.0 response with stdin as the
+# body; the connection closing ends it.
+respond() {
+  printf 'HTTP/1.0 %s\r\nContent-Type: %s\r\n\r\n' "$1" "$2"
+  cat
+}
+
+# local_http METHOD PORT /PATH forwards a request to a server in the
+# container, such as an MCP server's auth endpoints.
+local_http() {
+  local body code
+  body=$(mktemp)
+  code=$(curl -s -o "$body" -w '%{http_code}' -X "$1" "http://127.0.0.1:$2$3")
+  case $code in
+    000) echo "nothing listening on port $2" | respond "502 Bad Gateway" text/plain ;;
+    *) respond "$code Forwarded" application/octet-stream <"$body" ;;
+  esac
+  rm -f "$body"
+}
+
+# handle answers one HTTP request read from stdin:
+#   GET /status /mcp /agents /firewall /git /index /ports /audit
+#   POST /mcp/<name>/restart
+#   GET|POST /local/<port>/<path>
+handle() {
+  local method path _ line
+  read -r method path _ || return
+  while IFS= read -r line && [ -n "${line%$'\r'}" ]; do :; done
+  case "$method $path" in
+    "GET /status") status_json | respond "200 OK" application/json ;;
+    "GET /mcp") mcp_json | respond "200 OK" application/json ;;
+    "GET /agents") agents_json | respond "200 OK" application/json ;;
+    "GET /firewall") firewall_json | respond "200 OK" application/json ;;
+    "GET /git") git_json | respond "200 OK" application/json ;;
+    "GET /index") index_json | respond "200 OK" application/json ;;
+    "GET /ports") ports_json | respond "200 OK" application/json ;;
+    "GET /audit") cat /var/log/claudex/commands.log 2>/dev/null | respond "200 OK" text/plain ;;
+    "POST /mcp/"*/restart)
+      local name=${path#/mcp/}
+      name=${name%/restart}
+      if [ -f "$STATE/mcp/$name.pid" ] && kill "$(cat "$STATE/mcp/$name.pid")" 2>/dev/null; then
+        echo '{"restarting":true}' | respond "200 OK" application/json
+      else
+        echo "no running MCP server $name" | respond "404 Not Found" text/plain
+      fi
+      ;;
+    "GET /local/"* | "POST /local/"*)
+      local rest=${path#/local/}
+      local port=${rest%%/*}
+      case $port in
+        *[!0-9]* | "") echo "bad port" | respond "400 Bad Request" text/plain ;;
+        *) local_http "$method" "$port" "${rest#"$port"}" ;;
+      esac
+      ;;
+    *) echo "unknown request $method $path" | respond "404 Not Found" text/plain ;;
+  esac
+}
+
+# tell_shells prints a notice on every terminal in the container.
+tell_shells() {
+  local t
+  for t in /dev/pts/[0-9]*; do
+    [ -w "$t" ] && printf '\r\n*** %s\r\n' "$1" >"$t" 2>/dev/null
+  done
+}
+
+# check_ttl enforces claudex --ttl: CLAUDEX_EXPIRES is when the container
+# stops. The shells are warned CLAUDEX_EXPIRES_WARN seconds ahead; at the
+# deadline the supervisor exits, which stops the container.
+check_ttl() {
+  [ -n "${CLAUDEX_EXPIRES:-}" ] || return 0
+  local left=$((CLAUDEX_EXPIRES - $(date +%s)))
+  if [ "$left" -le 0 ]; then
+    tell_shells "claudex: this container's time limit (--ttl) is up; stopping it now."
+    exit 0
+  fi
+  if [ "$left" -le "${CLAUDEX_EXPIRES_WARN:-600}" ] && [ ! -e "$STATE/ttl-warned" ]; then
+    touch "$STATE/ttl-warned"
+    tell_shells "claudex: this container stops in $(((left + 59) / 60)) minutes (--ttl); save your work."
+  fi
+}
+
+# supervise NAME CMD keeps CMD running, backing off up to 30s between restarts.
+supervise() {
+  local name=$1 cmd=$2 n=0
+  while :; do
+    "$cmd" >>"$STATE/mcp/$name.log" 2>&1 &
+    echo $! >"$STATE/mcp/$name.pid"
+    wait $!
+    n=$((n + 1))
+    echo $n >"$STATE/mcp/$name.restarts"
+    sleep $((n < 6 ? n * n : 30))
+  done
+}
+
+main() {
+  mkdir -p "$STATE/mcp"
+  echo $$ >"$STATE/pid"
+  date +%s >"$STATE/started"
+  rm -f "$SOCK"
+  socat UNIX-LISTEN:"$SOCK",fork,mode=600 EXEC:"$0 handle" 2>>"$STATE/agent.log" &
+  local f name
+  for f in "$MCP_DIR"/*; do
+    [ -f "$f" ] && [ -x "$f" ] || continue
+    name=$(basename "$f")
+    case $name in *[!A-Za-z0-9._-]*) continue ;; esac
+    supervise "$name" "$f" &
+  done
+  trap 'exit 0' TERM INT
+  check_ttl
+  date +%s >"$STATE/heartbeat"
+  cut -d' ' -f22 /proc/1/stat >"$READY"
+  while :; do
+    sleep "$INTERVAL" &
+    wait $!
+    date +%s >"$STATE/heartbeat"
+    check_ttl
+  done
+}
+
+case "${1:-}" in
+  "") main ;;
+  status | request)
+    if [ ! -S "$SOCK" ]; then
+      echo "claudex-agent is not running" >&2
+      exit 1
+    fi
+    if [ "$1" = status ]; then
+      printf 'GET /status HTTP/1.0\r\n\r\n' | socat -t30 - UNIX-CONNECT:"$SOCK" | sed '1,/^\r$/d'
+    else
+      printf '%s %s HTTP/1.0\r\n\r\n' "${2:-GET}" "${3:-/status}" | socat -t30 - UNIX-CONNECT:"$SOCK"
+    fi
+    ;;
+  handle) handle ;;
+  *)
+    echo "usage: claudex-agent [status | request METHOD PATH]" >&2
+    exit 2
+    ;;
+esac
@@ -0,0 +1,23 @@
+# claudex audit hook. Sourced through BASH_ENV by non-interactive bash and from
+# /etc/bash.bashrc by interactive shells when the container runs with
+# CLAUDEX_AUDIT=1 (claudex --audit). Every simple command bash is about to run
+# is appended to /var/log/claudex/commands.log as:
+#   <time with UTC offset>\t<pid>\t<cwd>\t<command>
+# This is a best-effort record, not a tamper-proof one: the agent can write the log.
+
+[ -n "${BASH_VERSION:-}" ] || return 0
+[ "${CLAUDEX_AUDIT:-}" = "1" ] || return 0
+# Guard with a non-exported variable so child shells install the trap too.
+[ -n "${__claudex_audit_loaded:-}" ] && return 0
+__claudex_audit_loaded=1
+
+__claudex_audit() {
+  [ -n "${COMP_LINE:-}" ] && return
+  case "$BASH_COMMAND" in
+    __claudex_audit*) return ;;
+  esac
+  local cmd=${BASH_COMMAND//$'\n'/ }
+  printf '%(%Y-%m-%dT%H:%M:%S%z)T\t%s\t%s\t%s\n' -1 "$$" "$PWD" "${cmd//$'\t'/ }" \
+    >> /var/log/claudex/commands.log 2>/dev/null
+}
+trap '__claudex_audit' DEBUG
@@ -0,0 +1,26 @@
+#!/bin/bash
+# git-credential-claudex is git's credential helper in claudex containers.
+# While `claudex git-credentials` runs on the host, it relays each request
+# over docker exec to a socat listening on $SOCK; the host asks for approval
+# and answers from its own credential store. Only "get" is forwarded: the
+# container never stores or erases host credentials. Without a broker it
+# answers nothing, so git falls back to its other helpers.
+
+SOCK=/tmp/claudex/git-credential.sock
+PID=/tmp/claudex/git-credential.pid
+
+if [ "${1:-}" != get ]; then
+  cat >/dev/null
+  exit 0
+fi
+# The broker relays one request at a time; between two the socket is
+# briefly gone, but the pid file stays while the broker runs.
+for _ in $(seq 50); do
+  [ -S "$SOCK" ] && break
+  [ -e "$PID" ] || exit 0
+  sleep 0.1
+done
+[ -S "$SOCK" ] || exit 0
+# The request ends at a blank line; the host may take a while to approve.
+{ cat; echo; } | socat -t 300 - "UNIX-CONNECT:$SOCK" 2>/dev/null
+exit 0
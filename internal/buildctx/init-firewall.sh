@@ -2,6 +2,11 @@
 set -euo pipefail  # Exit on error, undefined vars, and pipeline failures
 IFS=$'\n\t'       # Stricter word splitting
 
+# Fingerprint of this invocation (arguments and script), recorded once the
+# rules are in place so claudex can tell whether a re-run would change them.
+MARKER=/run/claudex-firewall
+FINGERPRINT=$({ printf '%s ' "$@"; cat "$0"; } | sha256sum | cut -c1-16)
+
 clear_rules() {
   iptables -P INPUT ACCEPT
   iptables -P OUTPUT ACCEPT
@@ -58,10 +63,136 @@ resolve_ipv4() {
   fi
 }
 
-if [[ "${1:-}" == "--clear" ]]; then
-  clear_rules
-  echo "Firewall rules cleared"
-  exit 0
+# Rules added by claudex (lockfile registries, `claudex firewall allow`) persist
+# here so re-initializing after a restart keeps them. "*.example.com" entries
+# are wildcards: dnsmasq adds every address it resolves under example.com to
+# the ipset, so new subdomains and rotating IPs work without a restart.
+STATE_DIR=/etc/claudex
+ALLOW_FILE="$STATE_DIR/firewall-allow"
+UPSTREAM_FILE="$STATE_DIR/resolv.upstream"
+DNSMASQ_CONF="$STATE_DIR/dnsmasq.conf"
+
+valid_pattern() {
+  [[ "$1" =~ ^(\*\.)?[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?)+$ ]]
+}
+
+remember() {
+  mkdir -p "$STATE_DIR"
+  touch "$ALLOW_FILE"
+  local d
+  for d in "$@"; do
+    grep -qxF "$d" "$ALLOW_FILE" || echo "$d" >> "$ALLOW_FILE"
+  done
+}
+
+saved_rules() {
+  [[ -f "$ALLOW_FILE" ]] && grep -v '^[[:space:]]*$' "$ALLOW_FILE" || true
+}
+
+# start_dns (re)starts dnsmasq on 127.0.0.1 with an ipset rule per wildcard.
+start_dns() {
+  if ! command -v dnsmasq >/dev/null 2>&1; then
+    echo "WARNING: dnsmasq not installed; wildcard rules need an image built by a newer claudex" >&2
+    return 0
+  fi
+  mkdir -p "$STATE_DIR"
+  if [[ ! -f "$UPSTREAM_FILE" ]]; then
+    # Skip our own dnsmasq, but keep Docker's embedded resolver (127.0.0.11).
+    grep '^nameserver' /etc/resolv.conf | grep -vx 'nameserver[[:space:]]*127\.0\.0\.1[[:space:]]*' > "$UPSTREAM_FILE" || true
+  fi
+  {
+    echo "listen-address=127.0.0.1"
+    echo "bind-interfaces"
+    echo "no-resolv"
+    awk '{print "server=" $2}' "$UPSTREAM_FILE"
+    local d
+    while read -r d; do
+      [[ "$d" == \*.* ]] && echo "ipset=/${d#\*.}/allowed-domains"
+    done < <(saved_rules)
+  } > "$DNSMASQ_CONF"
+  pkill -x dnsmasq 2>/dev/null || true
+  dnsmasq --conf-file="$DNSMASQ_CONF" --pid-file="$STATE_DIR/dnsmasq.pid"
+  echo "nameserver 127.0.0.1" > /etc/resolv.conf
+}
+
+# allow_soft adds a claudex-managed rule; unresolvable exact domains only warn.
+allow_soft() {
+  local domain="$1"
+  if [[ "$domain" == \*.* ]]; then
+    # Wildcards are handled by dnsmasq; seed the ipset with the apex as well.
+    domain="${domain#\*.}"
+  fi
+  echo "Resolving $domain..."
+  if ! mapfile -t domain_ips < <(resolve_ipv4 "$domain") || [ "${#domain_ips[@]}" -eq 0 ]; then
+    echo "WARNING: Skipping $domain (no IPv4 addresses)"
+    return 0
+  fi
+  local ip
+  for ip in "${domain_ips[@]}"; do
+    echo "Adding $ip for $domain"
+    ipset add allowed-domains "$ip" -exist
+  done
+}
+
+mode=init
+extra_allow=()
+while [[ $# -gt 0 ]]; do
+  case "$1" in
+    --clear)
+      clear_rules
+      rm -f "$MARKER"
+      echo "Firewall rules cleared"
+      exit 0
+      ;;
+    --allow|--add|--remove)
+      if [[ -z "${2:-}" ]] || ! valid_pattern "$2"; then
+        echo "ERROR: $1 requires a domain or *.domain" >&2
+        exit 1
+      fi
+      [[ "$1" != "--allow" ]] && mode="${1#--}"
+      extra_allow+=("$2")
+      shift 2
+      ;;
+    --list)
+      saved_rules
+      exit 0
+      ;;
+    *)
+      echo "ERROR: unknown option $1" >&2
+      exit 1
+      ;;
+  esac
+done
+
+case "$mode" in
+  add)
+    # Live update: no flush, existing connections keep working.
+    if ! ipset list allowed-domains >/dev/null 2>&1; then
+      echo "ERROR: firewall is not initialized in this container (start it with --firewall)" >&2
+      exit 1
+    fi
+    remember "${extra_allow[@]}"
+    for domain in "${extra_allow[@]}"; do
+      allow_soft "$domain"
+    done
+    start_dns
+    echo "Firewall rules updated"
+    exit 0
+    ;;
+  remove)
+    if [[ -f "$ALLOW_FILE" ]]; then
+      for domain in "${extra_allow[@]}"; do
+        grep -vxF "$domain" "$ALLOW_FILE" > "$ALLOW_FILE.tmp" || true
+        mv "$ALLOW_FILE.tmp" "$ALLOW_FILE"
+      done
+    fi
+    # IPs cannot be attributed to a single domain, so rebuild from scratch.
+    extra_allow=()
+    ;;
+esac
+
+if [[ ${#extra_allow[@]} -gt 0 ]]; then
+  remember "${extra_allow[@]}"
 fi
 
 # Flush existing rules and delete existing ipsets
@@ -128,6 +259,12 @@ for domain in "${allowed_domains[@]}"; do
     done
 done
 
+while read -r domain; do
+    allow_soft "$domain"
+done < <(saved_rules)
+
+start_dns
+
 # Get host IP from default route
 HOST_IP=$(ip route | grep default | cut -d" " -f3)
 if [ -z "$HOST_IP" ]; then
@@ -213,3 +350,10 @@ if ! curl --connect-timeout 5 https://api.anthropic.com >/dev/null 2>&1; then
 else
     echo "Firewall verification passed - able to reach https://api.anthropic.com as expected"
 fi
+
+# Record which container start (PID 1's start time) and configuration these
+# rules belong to; claudex skips re-running this script on attach until the
+# container restarts or the allowlist or script changes.
+if [[ "$mode" == init ]]; then
+  echo "$(cut -d' ' -f22 /proc/1/stat) $FINGERPRINT" > "$MARKER"
+fi
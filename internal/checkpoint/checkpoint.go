@@ -0,0 +1,109 @@
+// Package checkpoint holds the in-container scripts behind `claudex
+// checkpoint`, `claudex rollback`, and --auto-commit. Checkpoints are commits
+// tagged under RefPrefix in /workspace and in each mounted repository; they
+// never move a branch or touch the index.
+package checkpoint
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// TagPrefix keeps checkpoint tags (claudex/<name>) apart from the project's
+// own tags.
+const TagPrefix = "claudex/"
+
+// RefPrefix is where checkpoint tags live.
+const RefPrefix = "refs/tags/" + TagPrefix
+
+// AutoPrefix names checkpoints taken by --auto-commit.
+const AutoPrefix = "auto-"
+
+// AutoKeep is how many automatic checkpoints each repository keeps.
+const AutoKeep = "100"
+
+// prelude defines repos (the repositories to snapshot) and snapshot R MSG,
+// which writes the working tree of R to a commit via a scratch index and
+// prints its id.
+const prelude = `repos() {
+  [ -d /workspace/.git ] && echo /workspace
+  for d in /workspace/*/; do [ -e "$d.git" ] && echo "${d%/}"; done
+}
+export GIT_AUTHOR_NAME=claudex GIT_AUTHOR_EMAIL=claudex@localhost
+export GIT_COMMITTER_NAME=claudex GIT_COMMITTER_EMAIL=claudex@localhost
+tree_of() {
+  idx=$(mktemp -u); export GIT_INDEX_FILE=$idx
+  git -C "$1" read-tree HEAD 2>/dev/null
+  git -C "$1" add -A && git -C "$1" write-tree
+  st=$?; rm -f "$idx"; unset GIT_INDEX_FILE; return $st
+}
+commit_tree() {
+  parent=$(git -C "$1" rev-parse -q --verify HEAD)
+  git -C "$1" commit-tree "$2" ${parent:+-p "$parent"} -m "$3"
+}
+`
+
+// Script commits the working tree of every repo with message $2 and tags
+// the commit TagPrefix$1.
+const Script = prelude + `n=0
+for r in $(repos); do
+  tree=$(tree_of "$r") || exit 1
+  c=$(commit_tree "$r" "$tree" "$2") || exit 1
+  git -C "$r" tag -f -a -m "$2" "` + TagPrefix + `$1" "$c" >/dev/null || exit 1
+  echo "$r"; n=$((n+1))
+done
+[ "$n" -gt 0 ] || { echo "no git repositories under /workspace" >&2; exit 1; }`
+
+// RollbackScript restores each repo's working tree to checkpoint $1 and
+// deletes files created since; branches and the index are left alone.
+const RollbackScript = prelude + `n=0
+for r in $(repos); do
+  ref=` + RefPrefix + `$1
+  git -C "$r" rev-parse -q --verify "$ref" >/dev/null || continue
+  idx=$(mktemp -u); export GIT_INDEX_FILE=$idx
+  git -C "$r" read-tree HEAD 2>/dev/null
+  git -C "$r" add -A
+  git -C "$r" diff --cached --name-only --diff-filter=A -z "$ref" | (cd "$r" && xargs -0 -r rm -f --)
+  rm -f "$idx"; unset GIT_INDEX_FILE
+  git -C "$r" restore --source="$ref" --worktree -- . || exit 1
+  echo "$r"; n=$((n+1))
+done
+[ "$n" -gt 0 ] || { echo "no checkpoint named $1" >&2; exit 1; }`
+
+// ListScript prints name<TAB>date<TAB>message for every checkpoint.
+const ListScript = prelude + `for r in $(repos); do
+  git -C "$r" for-each-ref --sort=creatordate --format='%(refname:strip=3)%09%(creatordate:iso)%09%(subject)' ` + RefPrefix + `
+done`
+
+// AutoPIDFile guards against starting a second --auto-commit loop.
+const AutoPIDFile = "/tmp/claudex-auto-commit.pid"
+
+// autoScript loops forever: every $1 seconds it checkpoints each repo whose
+// tree changed since its last automatic checkpoint (or HEAD), with a message
+// listing the changed files, and prunes old automatic checkpoints.
+const autoScript = prelude + `[ -f ` + AutoPIDFile + ` ] && kill -0 "$(cat ` + AutoPIDFile + `)" 2>/dev/null && exit 0
+echo $$ > ` + AutoPIDFile + `
+while sleep "$1"; do
+  name=` + AutoPrefix + `$(date +%Y%m%d-%H%M%S)
+  for r in $(repos); do
+    tree=$(tree_of "$r") || continue
+    base=$(git -C "$r" rev-parse -q --verify refs/claudex/auto) || base=$(git -C "$r" rev-parse -q --verify HEAD)
+    [ -n "$base" ] && [ "$(git -C "$r" rev-parse "$base^{tree}")" = "$tree" ] && continue
+    files=$(git -C "$r" diff-tree -r --name-only ${base:-4b825dc642cb6eb9a060e54bf8d69288fbee4904} "$tree" | head -n 5 | paste -sd, -)
+    count=$(git -C "$r" diff-tree -r --name-only ${base:-4b825dc642cb6eb9a060e54bf8d69288fbee4904} "$tree" | wc -l)
+    c=$(commit_tree "$r" "$tree" "claudex auto-commit: $count files changed ($files)") || continue
+    git -C "$r" update-ref "` + RefPrefix + `$name" "$c"
+    git -C "$r" update-ref refs/claudex/auto "$c"
+    git -C "$r" for-each-ref --sort=-creatordate --format='%(refname)' '` + RefPrefix + AutoPrefix + `*' |
+      tail -n +$((` + AutoKeep + `+1)) | while read -r old; do git -C "$r" update-ref -d "$old"; done
+  done
+done`
+
+// NameRe matches valid checkpoint names.
+var NameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// AutoCommand returns the command that runs the --auto-commit loop.
+func AutoCommand(every time.Duration) []string {
+	return []string{"bash", "-c", autoScript, "claudex-auto-commit", fmt.Sprint(int(every.Seconds()))}
+}
@@ -1,13 +1,25 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/photodialectic/claudex/internal/commands"
+	"github.com/photodialectic/claudex/internal/config"
 	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/jsonlog"
+	"github.com/photodialectic/claudex/internal/output"
 	"github.com/photodialectic/claudex/internal/run"
+	"github.com/photodialectic/claudex/internal/telemetry"
+	"github.com/photodialectic/claudex/internal/ui"
+	"github.com/photodialectic/claudex/internal/update"
 	"github.com/photodialectic/claudex/internal/version"
 )
 
@@ -16,14 +28,111 @@ import (
 // subcommands and falls back to the default run workflow when no
 // subcommand (or an unknown token) is provided.
 func Execute(args []string) error {
+	args, logJSON := stripFlag(args, "--log-json")
+	args, color, err := stripValueFlag(args, "--color")
+	if err != nil {
+		return err
+	}
+	if color == "" {
+		color = os.Getenv("CLAUDEX_COLOR")
+	}
+	if color == "" {
+		color = output.Auto
+	}
+	if err := output.SetColor(color); err != nil {
+		return err
+	}
+	args, yes := stripFlag(args, "--yes")
+	args, noInput := stripFlag(args, "--no-input")
+	ui.SetAnswers(yes, noInput || os.Getenv("CLAUDEX_NO_INPUT") != "")
+	if logJSON || os.Getenv("CLAUDEX_LOG_JSON") != "" {
+		// Events carry plain English text, which is what tools match on.
+		_ = output.SetColor(output.Never)
+		output.SetLocale("en")
+		capture, err := jsonlog.Start(os.Stdout)
+		if err != nil {
+			return err
+		}
+		start := time.Now()
+		err = dispatch(args)
+		recordUsage(args, start, err)
+		capture.Finish(err)
+		if err != nil {
+			return ReportedError{err}
+		}
+		return nil
+	}
+	start := time.Now()
+	err = dispatch(args)
+	recordUsage(args, start, err)
+	return err
+}
+
+// ReportedError is returned when the error was already emitted as a
+// --log-json event; callers should exit non-zero without printing it again.
+type ReportedError struct{ Err error }
+
+func (e ReportedError) Error() string { return e.Err.Error() }
+func (e ReportedError) Unwrap() error { return e.Err }
+
+// stripFlag removes every occurrence of flag before a "--" separator.
+func stripFlag(args []string, flag string) ([]string, bool) {
+	var res []string
+	found := false
+	for i, a := range args {
+		if a == "--" {
+			res = append(res, args[i:]...)
+			break
+		}
+		if a == flag {
+			found = true
+			continue
+		}
+		res = append(res, a)
+	}
+	return res, found
+}
+
+// stripValueFlag removes every `flag VALUE` and `flag=VALUE` before a "--"
+// separator, returning the last value given.
+func stripValueFlag(args []string, flag string) ([]string, string, error) {
+	var res []string
+	value := ""
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "--":
+			return append(res, args[i:]...), value, nil
+		case a == flag:
+			if i+1 >= len(args) {
+				return nil, "", fmt.Errorf("%s requires a value", flag)
+			}
+			value = args[i+1]
+			i++
+		case strings.HasPrefix(a, flag+"="):
+			value = strings.TrimPrefix(a, flag+"=")
+		default:
+			res = append(res, a)
+		}
+	}
+	return res, value, nil
+}
+
+func dispatch(args []string) error {
+	maybeNag(args)
+	if err := selectEngine(); err != nil && (len(args) == 0 || !engineless[args[0]]) {
+		return err
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+	dockerx.SetContext(ctx)
 	if len(args) == 0 {
 		// Default behavior: start/run container with current directory mounts
-		return run.Run(args, os.Stdin, os.Stdout, os.Stderr, &dockerx.CLI{})
+		return run.Run(args, os.Stdin, os.Stdout, os.Stderr, dockerx.New())
 	}
 	switch args[0] {
 	case "--version", "version":
-		fmt.Println(version.Version)
-		return nil
+		return commands.Version(args[1:])
 	case "build":
 		return commands.Build(args[1:])
 	case "update":
@@ -36,31 +145,298 @@ func Execute(args []string) error {
 		return commands.List(args[1:])
 	case "destroy":
 		return commands.Destroy(args[1:])
+	case "stop":
+		return commands.Stop(args[1:])
+	case "start":
+		return commands.Start(args[1:])
 	case "auth":
 		return commands.Auth(args[1:])
+	case "dev":
+		// Run workflow with the host claudex binary and build context mounted
+		return run.Run(append([]string{"--dev"}, args[1:]...), os.Stdin, os.Stdout, os.Stderr, dockerx.New())
+	case "recent":
+		return commands.Recent(args[1:])
+	case "attach", "shell":
+		return commands.Attach(args[1:])
+	case "clone":
+		return commands.Clone(args[1:])
+	case "export-session":
+		return commands.ExportSession(args[1:])
+	case "import-session":
+		return commands.ImportSession(args[1:])
+	case "engines":
+		return commands.Engines(args[1:])
+	case "firewall":
+		return commands.Firewall(args[1:])
+	case "audit":
+		return commands.Audit(args[1:])
+	case "policy":
+		return commands.Policy(args[1:])
+	case "events":
+		return commands.Events(args[1:])
+	case "metrics":
+		return commands.Metrics(args[1:])
+	case "usage":
+		return commands.Usage(args[1:])
+	case "telemetry":
+		return commands.Telemetry(args[1:])
+	case "task":
+		return commands.Task(args[1:])
+	case "pkg":
+		return commands.Pkg(args[1:])
+	case "batch":
+		return commands.Batch(args[1:])
+	case "queue":
+		return commands.Queue(args[1:])
+	case "history":
+		return commands.History(args[1:])
+	case "status":
+		return commands.Status(args[1:])
+	case "index":
+		return commands.Index(args[1:])
+	case "mcp":
+		return commands.MCP(args[1:])
+	case "ports":
+		return commands.Ports(args[1:])
+	case "forward":
+		return commands.Forward(args[1:])
+	case "git-credentials":
+		return commands.GitCredentials(args[1:])
+	case "signing-key":
+		return commands.SigningKey(args[1:])
+	case "open":
+		return commands.Open(args[1:])
+	case "mcp-server":
+		return commands.MCPServer(args[1:])
+	case "inspect":
+		return commands.Inspect(args[1:])
+	case "protect":
+		return commands.Protect(args[1:])
+	case "top":
+		return commands.Top(args[1:])
+	case "wait":
+		return commands.Wait(args[1:])
+	case "workspace":
+		return commands.Workspace(args[1:])
+	case "export":
+		return commands.Export(args[1:])
+	case "sync":
+		return commands.Sync(args[1:])
+	case "image":
+		return commands.Image(args[1:])
+	case "images":
+		return commands.Images(args[1:])
+	case "up":
+		return commands.Up(args[1:])
+	case "export-compose":
+		return commands.ExportCompose(args[1:])
+	case "adopt":
+		return commands.Adopt(args[1:])
+	case "migrate":
+		return commands.Migrate(args[1:])
+	case "checkpoint":
+		return commands.Checkpoint(args[1:])
+	case "rollback":
+		return commands.Rollback(args[1:])
 	case "-h", "--help", "help":
 		return usage()
 	default:
 		// Default: run the container workflow using remaining args
-		return run.Run(args, os.Stdin, os.Stdout, os.Stderr, &dockerx.CLI{})
+		return run.Run(args, os.Stdin, os.Stdout, os.Stderr, dockerx.New())
+	}
+}
+
+// subcommands are the command names telemetry may record; anything else is
+// the run workflow, whose arguments are directories and never recorded.
+var subcommands = map[string]bool{
+	"version": true, "build": true, "update": true, "push": true, "pull": true,
+	"list": true, "destroy": true, "stop": true, "start": true, "auth": true,
+	"dev": true, "recent": true, "attach": true, "shell": true, "clone": true,
+	"export-session": true, "import-session": true, "engines": true,
+	"firewall": true, "audit": true, "policy": true, "events": true,
+	"metrics": true, "usage": true, "telemetry": true, "task": true, "pkg": true, "batch": true, "queue": true,
+	"checkpoint": true, "rollback": true, "history": true, "top": true, "wait": true, "workspace": true, "export": true, "sync": true, "image": true, "images": true, "up": true, "export-compose": true, "adopt": true, "migrate": true, "status": true, "index": true, "mcp": true, "ports": true, "forward": true, "git-credentials": true, "signing-key": true, "open": true, "mcp-server": true, "inspect": true, "protect": true, "help": true,
+}
+
+// recordUsage appends an anonymous telemetry record when opted in.
+func recordUsage(args []string, start time.Time, err error) {
+	if len(args) > 0 && args[0] == "telemetry" {
+		return
+	}
+	cfg, cerr := config.Load()
+	if cerr != nil || !telemetry.Enabled(cfg.Telemetry.Enabled) {
+		return
+	}
+	cmd := "run"
+	if len(args) > 0 {
+		switch {
+		case subcommands[args[0]]:
+			cmd = args[0]
+		case args[0] == "--version":
+			cmd = "version"
+		case args[0] == "-h" || args[0] == "--help":
+			cmd = "help"
+		}
+	}
+	path, perr := telemetry.Path()
+	if perr != nil {
+		return
+	}
+	_ = telemetry.Append(path, telemetry.Record{
+		Time:       start.UTC(),
+		Command:    cmd,
+		DurationMS: time.Since(start).Milliseconds(),
+		OK:         err == nil,
+		Version:    version.Version,
+		OS:         runtime.GOOS,
+	})
+}
+
+// maybeNag prints a once-per-day upgrade hint for interactive sessions unless
+// disabled via CLAUDEX_NO_UPDATE_CHECK or `disableUpdateCheck: true` in config.
+func maybeNag(args []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "--version", "version", "-h", "--help", "help":
+			return
+		}
+	}
+	if os.Getenv("CLAUDEX_NO_UPDATE_CHECK") != "" || !ui.StdinIsTTY() {
+		return
+	}
+	if cfg, err := config.Load(); err != nil || cfg.DisableUpdateCheck {
+		return
+	}
+	update.MaybeNag(os.Stderr, version.Version)
+}
+
+// engineless commands never reach the container engine, so a bad engine or
+// timeout setting does not keep them (or `claudex engines`, which helps fix
+// it) from running.
+var engineless = map[string]bool{"--version": true, "version": true, "-h": true, "--help": true, "help": true, "engines": true}
+
+// selectEngine applies CLAUDEX_ENGINE, falling back to `engine:` in config,
+// and the engine call timeouts from CLAUDEX_DOCKER_TIMEOUT and
+// `dockerTimeouts:`.
+func selectEngine() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	name := os.Getenv("CLAUDEX_ENGINE")
+	if name == "" {
+		name = cfg.Engine
+	}
+	if err := dockerx.SetDefault(name); err != nil {
+		return err
+	}
+	t := dockerx.DefaultTimeouts
+	query := cfg.DockerTimeouts.Query
+	if env := os.Getenv("CLAUDEX_DOCKER_TIMEOUT"); env != "" {
+		query = env
+	}
+	for _, f := range []struct {
+		val string
+		dst *time.Duration
+	}{{query, &t.Query}, {cfg.DockerTimeouts.Change, &t.Change}} {
+		if f.val == "" {
+			continue
+		}
+		d, err := dockerx.ParseTimeout(f.val)
+		if err != nil {
+			return fmt.Errorf("dockerTimeouts: %w", err)
+		}
+		*f.dst = d
 	}
+	dockerx.SetTimeouts(t)
+	return nil
+}
+
+// interruptContext is canceled by the first Ctrl-C (or SIGTERM) so in-flight
+// engine calls are killed and the command unwinds; default handling is then
+// restored, so a second Ctrl-C exits at once.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-ch:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(ch)
+	}()
+	return ctx, cancel
 }
 
 func usage() error {
 	prog := filepath.Base(os.Args[0])
-	fmt.Printf(`Usage: %s [--host-network] [--name <NAME>] [--parallel] [--replace] [--strict-mounts] [DIR1 DIR2 ...]
+	fmt.Printf(`Usage: %s [--host-network] [--name <NAME>] [--parallel] [--pick] [--replace] [--strict-mounts] [DIR1 DIR2 ...]
 
 Mounts each DIRi at /workspace/<basename(DIRi)> in the claudex container.
 If no DIR is provided, mounts each file and directory in the current directory at /workspace/<name>.
 
 Options:
-  --host-network    Use host networking (allows OAuth callbacks)
+  --host-network    Use host networking (allows OAuth callbacks); under Docker Desktop
+                    publishes the callback ports (config: hostNetworkPorts) instead
   --name <NAME>     Override derived container name
+  --slug <SLUG>     Override the slug in the derived name (see naming.* in config)
   --parallel        Always create a new container (suffix with timestamp)
+  --pick            Choose among the containers for this workspace (also offered when
+                    --parallel runs left several), and remove stopped extras
+  --detach, -d      Create or start the container without attaching a shell
   --replace         Replace the target container if it exists
   --strict-mounts   Error if existing container mounts differ
+  --cow             Copy the dirs into the container instead of mounting them (see: export)
+  --workspace-volume
+                    Keep /workspace in a named volume rsynced from the dirs (see: sync)
+  --migrate         On a mount mismatch, move the container's state into a new one
+  --firewall        Restrict egress to an allowlist of AI/GitHub endpoints
+  --firewall-deps   Firewall plus package registries detected in the mounted projects
+  --docker-socket   Mount the host docker socket (root-equivalent host access)
+  --nested-docker <dind|sysbox|socket|none>
+                    Docker inside the container; dind/sysbox run an isolated daemon
+  --audit           Log every command run in the container (see: audit)
+  --index           Build a file list and ctags index after creation (see: index)
+  --ttl <DURATION>  Stop the container after DURATION (e.g. 4h), warning shells 10m ahead
+  --ttl-destroy     With --ttl, also remove it (on the next run, or destroy --expired)
+  --sign            Sign commits with a per-workspace SSH key (see: signing-key)
+  --no-sudo         Run with no-new-privileges, so sudo cannot gain root
+  --workspace <NAME>
+                    Use the dirs of a named workspace (see: workspace)
+  --shell <bash|zsh|fish>
+                    Interactive shell to attach (default: config shell, else bash)
+  --attach-env <KEY=VALUE>
+                    Set a variable in the attached shell only (repeatable; KEY alone
+                    passes the host's value)
+  --auto-commit <DURATION>
+                    Checkpoint /workspace on a schedule, e.g. 10m (see: checkpoint)
+  --host-git <keep|empty|copy>
+                    For mounted git repos: share .git, hide it, or use a private copy
+  --exclude <GLOB>  Hide matching paths of the dirs from the container, e.g. secrets or
+                    data/* (repeatable; relative to each dir; part of the signature)
+  --mount-consistency <consistent|cached|delegated>
+                    Docker Desktop bind-mount consistency for the dirs (macOS)
   --no-git          Skip initializing an empty Git repository in /workspace
-  --version         Print the Claudex CLI version and exit
+  --signature-mode <v1|v2>
+                    v2 names containers by git remote identity instead of path
+  --root-mode <cwd|git>
+                    With no DIRs, mount the current dir (cwd) or its git root (git)
+  --keep-on-failure Keep a container whose creation failed or was interrupted (Ctrl-C)
+  --no-preflight    Skip the checks made before creating a container (Docker Desktop file
+                    sharing, nested-docker runtime and privileges, free disk) and the
+                    warning about very large mounts
+  --verbose         Print how long each step of startup takes
+  --log-json        Emit all output as line-delimited JSON events (any subcommand)
+  --color <auto|always|never>
+                    Color tables, statuses, warnings and prompts (any subcommand;
+                    default auto: only on a terminal and without NO_COLOR)
+  --yes             Answer yes to confirmations and take the defaults of selections
+                    (any subcommand)
+  --no-input        Never read answers from stdin; fail where a question would be asked
+                    (any subcommand; also CLAUDEX_NO_INPUT=1)
+  --version         Print the Claudex CLI version and exit (see also: version --check-latest)
 
 Examples:
   %s
@@ -69,24 +445,156 @@ Examples:
   %s --parallel app/ api/
   %s --replace app/ api/
 
-Build the Docker image:
-  %s build [--no-cache]
+Bring containers up without attaching (prints the names; --separate creates one
+container per DIR concurrently and prints a table):
+  %s up [--separate] [--max-parallel <N>] [run options] DIR ...
+
+Build the Docker image (optionally from a working tree instead of the embedded context):
+  %s build [--no-cache] [--slim] [--with go=1.23,python=3.12,node=22] [--user <NAME>] [--uid <UID|host>] [--no-sudo] [--build-context-dir <DIR>] [--show-context]
+  %s image report [--image <REF>] [--top <N>]   (largest layers first)
+  %s image push [--image <REF>] <REGISTRY/REPO:TAG>   (adds provenance labels)
+  %s image pull [--as <TAG>] <REGISTRY/REPO:TAG>      (tags it as claudex)
 
 Refresh CLI tools without rebuilding base layers:
-  %s update [--no-cache]
+  %s update [--no-cache] [--slim] [--with <TOOLCHAINS>] [--user <NAME>] [--uid <UID|host>] [--no-sudo] [--prune-old] [--build-context-dir <DIR>]
+  %s images list                          (claudex builds, including superseded ones)
+
+Dogfood a local build (mounts the binary at /usr/local/bin/claudex and the
+build context at /opt/claudex/buildctx, read-only):
+  %s dev [--dev-binary <PATH>] [--build-context-dir <DIR>] [run options] [DIR ...]
+
+<TARGET> picks one container wherever it appears below: --name <NAME> (or a bare
+NAME where nothing else is positional), --signature <HASH>, or --last (most recently attached). Names may be abbreviated: a unique prefix of the name or
+slug, or its letters in order. Without one, the only candidate is used or you pick one.
 
 Push/pull files with a container:
-  %s push [--name <NAME>] <file_or_dir> [...]
-  %s pull [--name <NAME>] <container_path> [dest_dir (default /tmp)]
+  %s push [<TARGET>] [--to <DIR>] <file_or_dir|dir/.> [...]
+  %s pull [<TARGET>] [--force] [--stage <DIR>] [--json] <container_path> [dest_dir (default /tmp)]
+  %s export [<TARGET>] [--force] [--stage <DIR>] [--with-git] [DIR ...]   (--cow containers)
+  %s sync [<TARGET>] [--pull] [--delete] [DIR ...]   (--workspace-volume containers)
+
+Jump back into a session regardless of the current directory:
+  %s recent [-n N]
+  %s attach [--shell bash|zsh|fish] [--env KEY=VALUE]... [--workdir DIR] [<TARGET>]   (alias: shell)
+
+Branch a new container off an in-progress session (same mounts, copied state):
+  %s clone <SRC_NAME> [--as <NEW_NAME>] [--nested-docker MODE]
+
+Hand a session to a teammate (image, /workspace git history, labels, transcripts):
+  %s export-session [<TARGET>] <session.tar.zst|.tar.gz|.tar>
+  %s import-session <FILE> [--as <NAME>] [--nested-docker MODE] [DIR ...]
+
+Render a container's configuration as a docker-compose service:
+  %s export-compose [<TARGET>] > compose.yaml
+
+Bring a container started by hand under claudex management (commits and recreates it):
+  %s adopt <CONTAINER> [--as <NAME>] [--yes] [DIR ...]
+
+Upgrade containers created with an older label schema (commits and recreates them):
+  %s migrate [--dry-run] [--yes] [NAME ...]
 
 List claudex containers:
-  %s list [--all|--running|--stopped] [--format table|json|names] [--filter key=value]
+  %s list [--all|--running|--stopped] [--history] [--all-users] [--format table|json|names|<TEMPLATE>] [--sort created|name|status|size]
+           [--columns name,status,created,signature,mounts,slug,image,owner,attached,size,volumes] [--size] [--filter key=value] [--selector key=value,...]
 
 Destroy claudex containers:
-  %s destroy [--name <NAME> | --signature <HASH> | --all] [--running|--stopped] [--force|--prune-stopped]
+  %s destroy [--name <NAME> | --signature <HASH> | --selector key=value,... | --all] [--running|--stopped] [--force|--prune-stopped|--expired] [--volumes] [--snapshots] [--force-protected] [--all-users] [--json]
+
+Keep a container from being destroyed (commits and recreates it to set the label):
+  %s protect [<TARGET>] [--off] [--yes]
+
+Stop or start claudex containers (selectors match com.claudex.* labels):
+  %s stop [--name <NAME> | --selector key=value,... | --all] [--all-users]
+  %s start [--name <NAME> | --selector key=value,... | --all] [--all-users]
 
 Guided Google Docs OAuth:
-  %s auth google-docs-mcp [--container <NAME>]
-`, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog)
+  %s auth google-docs-mcp [<TARGET>] [--keep-server]
+
+Change a running container's egress allowlist without restarting it:
+  %s firewall allow|deny [<TARGET>] <DOMAIN|*.DOMAIN> [...]
+  %s firewall list [<TARGET>]
+
+Run a task from the tasks: section of .claudex.yaml (no TASK lists them):
+  %s task [<TASK>] [<TARGET>]
+
+Install apt packages (or npm:PKG globally) in a running container; --persist also adds
+them to ~/.config/claudex/context/Dockerfile.overlay for future builds:
+  %s pkg add <PKG|npm:PKG>... [<TARGET>] [--persist]
+
+Run an agent headlessly over each "## " task in a prompt file, collecting results:
+  %s batch [--agent claude|codex|gemini|copilot|opencode] --prompt-file <FILE> --out <DIR> [--parallel] [--keep] [DIR...]
+
+Queue headless agent runs over many workspaces and process them with bounded concurrency:
+  %s queue add [--agent <AGENT>] (--prompt <TEXT> | --prompt-file <FILE>) [DIR...]
+  %s queue run [--max-parallel N]
+  %s queue list | retry <ID> | clear
+
+Name a set of directories and start it from anywhere with --workspace:
+  %s workspace create [--force] <NAME> DIR... | list | rm <NAME>
+
+Show processes in a container grouped as agents, MCP servers, shells:
+  %s top [<TARGET>]
+
+Show the container supervisor's status: agents, firewall, git, file index and MCP servers:
+  %s status [<TARGET>] [--json] [--size]
+  %s mcp [list] | restart <SERVER> [<TARGET>]
+
+List ports listening in a container, forward one to localhost until Ctrl-C, or
+open a web app in the host browser (APP names an entry under apps: in config):
+  %s ports [<TARGET>] [--json]
+  %s forward <PORT> [--local <PORT>] [<TARGET>]
+  %s open [<PORT|URL|APP>] [--local <PORT>] [<TARGET>]
+
+Lend the container your host git credentials, approving each request here, until Ctrl-C:
+  %s git-credentials [<TARGET>] [--allow <HOST>]...
+
+Print the public key a --sign container signs commits with, to register as a signing key:
+  %s signing-key [<TARGET>]
+
+Rebuild a container's file index (file list and ctags) for fast agent search:
+  %s index [<TARGET>] [--json]
+
+Print a container's docker inspect data, parsed labels, image lineage and session record as JSON:
+  %s inspect [<TARGET>]
+
+Wait for the agent (or a pid / matching command) to exit, then notify:
+  %s wait [<TARGET>] [--pid <PID> | --match <TEXT>] [--notify desktop|<URL>|<COMMAND>] [--interval 5s]
+
+Search shell history kept per workspace (current dir's workspace without --name):
+  %s history [--name <NAME>] [<REGEXP>]
+
+Save and restore workspace checkpoints (git tags; branches and index untouched):
+  %s checkpoint [<TARGET>] [-m <MSG>] [--tag <CHECKPOINT>] [--list]
+  %s rollback [<TARGET>] [--to <CHECKPOINT>]
+
+Show commands recorded in a container created with --audit:
+  %s audit [<TARGET>] [--since <DURATION|Nd|RFC3339>]
+
+Show container lifecycle events (last 24h by default), optionally streaming new ones:
+  %s events [--follow] [--since <DURATION|Nd|RFC3339>] [--name <NAME>]
+
+Attach time, CPU time and agent tokens per session, for attributing costs:
+  %s usage [--since <DURATION|Nd|RFC3339>] [--by name|signature|slug|workspace] [--json]
+
+Serve claudex to a host agent as MCP tools over stdio (list_containers, push_files,
+pull_files, run_task, read_logs):
+  %s mcp-server
+
+Export Prometheus metrics (containers, CPU/memory, image age, session durations):
+  %s metrics [--textfile <PATH>]
+  %s metrics serve [--addr :9309]
+
+Opt-in usage telemetry (telemetry.enabled in config; stored locally):
+  %s telemetry show|export|off|on
+
+Verify a running container complies with the configured policy:
+  %s policy check [<TARGET>]
+
+List container engines (select with CLAUDEX_ENGINE or "engine:" in config):
+  %s engines
+
+Check for a newer release (the interactive CLI also nags at most once a day):
+  %s version --check-latest
+`, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog, prog)
 	return nil
 }
@@ -0,0 +1,134 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/output"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite testdata/*.golden")
+
+var ageColumn = regexp.MustCompile(`\b\d+[smhd] {2,}`)
+
+// TestGolden runs whole CLI flows against fixture-driven fake engines
+// (CLAUDEX_FAKE_DOCKER) and compares stdout and the engine calls with
+// testdata/<name>.golden. Run with -update after intended output changes.
+func TestGolden(t *testing.T) {
+	// list prints local times.
+	defer func(loc *time.Location) { time.Local = loc }(time.Local)
+	time.Local = time.UTC
+	defer output.SetLocale(output.Locale())
+	output.SetLocale("en")
+	testdata, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name  string
+		args  []string
+		stdin string
+	}{
+		{name: "list", args: []string{"list", "--all"}},
+		{name: "list-json", args: []string{"list", "--all", "--format", "json"}},
+		{name: "list-color", args: []string{"list", "--color", "always", "--all"}},
+		{name: "destroy-prompt", args: []string{"destroy"}, stdin: "2\ny\n"},
+		{name: "run-reuse", args: []string{"--name", "claudex-api-1a2b3c4d", "--detach", "--firewall", testdata}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+			t.Setenv("XDG_DATA_HOME", t.TempDir())
+			t.Setenv("CLAUDEX_NO_UPDATE_CHECK", "1")
+			t.Setenv(dockerx.FakeEnv, filepath.Join(testdata, "containers.json"))
+			dockerx.ResetFixtures()
+
+			stdout, err := capture(t, tc.stdin, func() error { return Execute(tc.args) })
+			got := stdout
+			if err != nil {
+				got += "--- error\n" + err.Error() + "\n"
+			}
+			f, ferr := dockerx.FixtureFake(os.Getenv(dockerx.FakeEnv))
+			if ferr != nil {
+				t.Fatal(ferr)
+			}
+			got += "--- calls\n"
+			for _, c := range f.Calls {
+				if c.Method == "Inspect" || c.Method == "PS" {
+					continue
+				}
+				got += c.Method + " " + strings.Join(c.Args, " ") + "\n"
+			}
+			got = strings.ReplaceAll(got, testdata, "$TESTDATA")
+			// destroy prints ages relative to now.
+			got = ageColumn.ReplaceAllStringFunc(got, func(m string) string { return fmt.Sprintf("%-*s", len(m), "<age>") })
+
+			golden := filepath.Join("testdata", tc.name+".golden")
+			if *updateGolden {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run go test ./internal/cli -update)", err)
+			}
+			if got != string(want) {
+				t.Fatalf("output differs from %s:\n--- got\n%s--- want\n%s", golden, got, want)
+			}
+		})
+	}
+}
+
+// capture runs fn with stdin fed from in and returns what it wrote to stdout.
+func capture(t *testing.T, in string, fn func() error) (string, error) {
+	t.Helper()
+	inFile := filepath.Join(t.TempDir(), "stdin")
+	if err := os.WriteFile(inFile, []byte(in), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stdin, err := os.Open(inFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldIn, oldOut := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = stdin, w
+	defer func() { os.Stdin, os.Stdout = oldIn, oldOut }()
+	done := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		done <- string(b)
+	}()
+	runErr := fn()
+	w.Close()
+	return <-done, runErr
+}
+
+func TestBadEngineOnlyFailsCommandsThatNeedOne(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("CLAUDEX_NO_UPDATE_CHECK", "1")
+	t.Setenv("CLAUDEX_ENGINE", "bogus")
+	defer dockerx.SetDefault("")
+	if _, err := capture(t, "", func() error { return dispatch([]string{"help"}) }); err != nil {
+		t.Fatalf("help: %v", err)
+	}
+	if err := dispatch([]string{"list"}); err == nil || !strings.Contains(err.Error(), "unknown container engine") {
+		t.Fatalf("list: expected the engine error, got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/output"
+	"github.com/photodialectic/claudex/internal/run"
+	"github.com/photodialectic/claudex/internal/ui"
+)
+
+// Adopt implements `claudex adopt <container> [--as NAME] [--yes] [DIR...]`.
+func Adopt(args []string) error {
+	return adoptWithDocker(dockerx.New(), args, stdStreams())
+}
+
+func adoptWithDocker(dx dockerx.Docker, args []string, s Streams) error {
+	out, errOut := s.Out, s.Err
+	var src, as string
+	var dirs []string
+	yes := false
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch a {
+		case "--as":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--as requires a value")
+			}
+			as = args[i+1]
+			i++
+		case "--yes", "-y":
+			yes = true
+		default:
+			if strings.HasPrefix(a, "-") {
+				return fmt.Errorf("unknown arg: %s", a)
+			}
+			if src == "" {
+				src = a
+			} else {
+				dirs = append(dirs, a)
+			}
+		}
+	}
+	if src == "" {
+		return fmt.Errorf("usage: claudex adopt <container> [--as NAME] [--yes] [DIR ...]")
+	}
+	info, err := dx.Inspect(src)
+	if err != nil {
+		return fmt.Errorf("container %s does not exist", src)
+	}
+	if len(dirs) == 0 {
+		if dirs, err = pickAdoptDirs(info, s.Prompt); err != nil {
+			return err
+		}
+		if len(dirs) == 0 {
+			fmt.Fprintln(out, "No selection; aborted.")
+			return nil
+		}
+	}
+	if !yes {
+		fmt.Fprintf(out, "%s will be committed and recreated with workspace %v.\n", src, dirs)
+		ok, err := s.Prompt.Confirm(output.T(output.MsgProceed))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Fprintln(out, output.T(output.MsgAborted))
+			return nil
+		}
+	}
+	return run.Adopt(src, dirs, as, out, errOut, dx)
+}
+
+// pickAdoptDirs asks which of info's bind-mounted host directories make up
+// the workspace. Mounts under /workspace are preselected.
+func pickAdoptDirs(info dockerx.Container, p ui.Prompter) ([]string, error) {
+	var binds []dockerx.Mount
+	menu := ui.Menu{Title: fmt.Sprintf("Bind mounts of %s:", info.Name)}
+	var preselected []string
+	for _, m := range info.Mounts {
+		if m.Type != "" && m.Type != "bind" {
+			continue
+		}
+		if m.Destination == "/workspace" || strings.HasPrefix(m.Destination, "/workspace/") {
+			menu.Default = append(menu.Default, len(binds))
+			preselected = append(preselected, strconv.Itoa(len(binds)+1))
+		}
+		binds = append(binds, m)
+		menu.Options = append(menu.Options, m.Source+" -> "+m.Destination)
+	}
+	if len(binds) == 0 {
+		return nil, fmt.Errorf("%s has no bind mounts; pass the project directories to mount", info.Name)
+	}
+	menu.Question = fmt.Sprintf("Workspace directories (comma-separated numbers) [%s]: ", strings.Join(preselected, ","))
+	picks, err := p.SelectMany(menu)
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, idx := range picks {
+		res = append(res, binds[idx].Source)
+	}
+	return res, nil
+}
@@ -0,0 +1,114 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/agent"
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/run"
+)
+
+// auditEntry is one line of the in-container command log.
+type auditEntry struct {
+	Time    time.Time
+	PID     string
+	Dir     string
+	Command string
+}
+
+// Audit implements `claudex audit [<TARGET>] [--since <DURATION|RFC3339>]`.
+func Audit(args []string) error {
+	return auditWithDocker(dockerx.New(), args, time.Now(), stdStreams())
+}
+
+func auditWithDocker(dx dockerx.Docker, args []string, now time.Time, s Streams) error {
+	t := targetSpec{prompt: s.Prompt}
+	var since time.Time
+	for i := 0; i < len(args); i++ {
+		if ok, err := t.flag(args, &i); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		a := args[i]
+		switch a {
+		case "--since":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--since requires a duration (1h) or RFC3339 time")
+			}
+			v, err := parseSince(args[i+1], now)
+			if err != nil {
+				return err
+			}
+			since = v
+			i++
+		default:
+			if err := t.positional(a); err != nil {
+				return err
+			}
+		}
+	}
+	target, err := t.resolve(dx, true)
+	if err != nil {
+		return err
+	}
+	info, err := dx.Inspect(target)
+	if err == nil && info.Labels["com.claudex.audit"] != "true" {
+		return fmt.Errorf("container %s was not created with --audit", target)
+	}
+	out, err := agent.Get(dx, target, "/audit", nil)
+	if errors.Is(err, agent.ErrNoAgent) {
+		out, err = dx.ExecOutput(target, []string{"cat", run.AuditLog})
+	}
+	if err != nil {
+		return fmt.Errorf("no audit log in %s yet: %w", target, err)
+	}
+	for _, e := range parseAuditLog(out, since) {
+		fmt.Fprintf(s.Out, "%s  %-24s %s\n", e.Time.Local().Format("2006-01-02 15:04:05"), e.Dir, e.Command)
+	}
+	return nil
+}
+
+// parseSince accepts a Go duration ("90m") or a number of days ("7d")
+// relative to now, or an RFC3339 time.
+func parseSince(v string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(v); err == nil {
+		return now.Add(-d), nil
+	}
+	if n, err := strconv.Atoi(strings.TrimSuffix(v, "d")); err == nil && strings.HasSuffix(v, "d") && n >= 0 {
+		return now.AddDate(0, 0, -n), nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q (want a duration like 1h or 7d, or an RFC3339 time)", v)
+}
+
+// auditTimeLayout matches the hook's printf '%(%Y-%m-%dT%H:%M:%S%z)T'.
+const auditTimeLayout = "2006-01-02T15:04:05-0700"
+
+// parseAuditLog parses tab-separated log lines, skipping malformed ones and
+// those before since.
+func parseAuditLog(data []byte, since time.Time) []auditEntry {
+	var res []auditEntry
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		parts := strings.SplitN(sc.Text(), "\t", 4)
+		if len(parts) != 4 {
+			continue
+		}
+		t, err := time.Parse(auditTimeLayout, parts[0])
+		if err != nil || t.Before(since) {
+			continue
+		}
+		res = append(res, auditEntry{Time: t, PID: parts[1], Dir: parts[2], Command: parts[3]})
+	}
+	return res
+}
@@ -1,18 +1,13 @@
 package commands
 
 import (
-	"bufio"
 	"encoding/json"
 	"errors"
-	"flag"
 	"fmt"
 	"net/url"
-	"os"
-	"strconv"
-	"strings"
 	"time"
 
-	"github.com/photodialectic/claudex/internal/containers"
+	"github.com/photodialectic/claudex/internal/agent"
 	"github.com/photodialectic/claudex/internal/dockerx"
 )
 
@@ -32,8 +27,12 @@ type authStatusResponse struct {
 
 // Auth runs `claudex auth <service>` workflows.
 func Auth(args []string) error {
+	return authWithDocker(dockerx.New(), args, stdStreams())
+}
+
+func authWithDocker(dx dockerx.Docker, args []string, s Streams) error {
 	if len(args) == 0 {
-		return errors.New("usage: claudex auth <service> [--container <name>]")
+		return errors.New("usage: claudex auth <service> [NAME | --name NAME | --signature HASH | --last] [--keep-server]")
 	}
 
 	service := args[0]
@@ -41,33 +40,36 @@ func Auth(args []string) error {
 		return fmt.Errorf("unknown auth target %q", service)
 	}
 
-	fs := flag.NewFlagSet("auth", flag.ContinueOnError)
-	fs.SetOutput(ioDiscard{})
-	container := fs.String("container", "", "Name of an existing Claudex container (omit to pick interactively)")
-	keep := fs.Bool("keep-server", false, "Leave the MCP server running after auth")
-	if err := fs.Parse(args[1:]); err != nil {
-		return err
-	}
-
-	dx := &dockerx.CLI{}
-	targetContainer := *container
-	if targetContainer == "" {
-		name, err := promptForContainer(dx)
-		if err != nil {
+	var t targetSpec
+	keep := false
+	rest := args[1:]
+	for i := 0; i < len(rest); i++ {
+		if ok, err := t.flag(rest, &i); err != nil {
 			return err
+		} else if ok {
+			continue
+		}
+		switch rest[i] {
+		case "--keep-server":
+			keep = true
+		default:
+			if err := t.positional(rest[i]); err != nil {
+				return err
+			}
 		}
-		targetContainer = name
-	}
-	if _, err := dx.Inspect(targetContainer); err != nil {
-		return fmt.Errorf("container %q not found: %w", targetContainer, err)
 	}
 
-	fmt.Printf("Starting google-docs-mcp inside container %s...\n", targetContainer)
+	t.prompt = s.Prompt
+	targetContainer, err := t.resolve(dx, false)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.Out, "Starting google-docs-mcp inside container %s...\n", targetContainer)
 	if err := restartServer(dx, targetContainer); err != nil {
 		return err
 	}
 	defer func() {
-		if !*keep {
+		if !keep {
 			_ = stopServer(dx, targetContainer)
 		}
 	}()
@@ -81,21 +83,18 @@ func Auth(args []string) error {
 		return err
 	}
 
-	fmt.Println("✅ Authorization link generated.")
-	fmt.Println()
-	fmt.Println("1. Open the URL below in your browser and complete the Google consent:")
-	fmt.Println(startResp.AuthorizationURL)
-	fmt.Println()
-	fmt.Println("2. After Google redirects you back to http://localhost:8810/... you'll see an error.")
-	fmt.Println("   Copy the entire redirected URL (including ?state=...&code=...) and paste it here.")
-	fmt.Print("Paste redirected URL: ")
+	fmt.Fprintln(s.Out, "✅ Authorization link generated.")
+	fmt.Fprintln(s.Out)
+	fmt.Fprintln(s.Out, "1. Open the URL below in your browser and complete the Google consent:")
+	fmt.Fprintln(s.Out, startResp.AuthorizationURL)
+	fmt.Fprintln(s.Out)
+	fmt.Fprintln(s.Out, "2. After Google redirects you back to http://localhost:8810/... you'll see an error.")
+	fmt.Fprintln(s.Out, "   Copy the entire redirected URL (including ?state=...&code=...) and paste it here.")
 
-	reader := bufio.NewReader(os.Stdin)
-	callbackURL, err := reader.ReadString('\n')
+	callbackURL, err := s.Prompt.Input("Paste redirected URL: ")
 	if err != nil {
 		return fmt.Errorf("failed to read callback URL: %w", err)
 	}
-	callbackURL = strings.TrimSpace(callbackURL)
 	if callbackURL == "" {
 		return errors.New("no callback URL provided")
 	}
@@ -115,11 +114,11 @@ func Auth(args []string) error {
 		return errors.New("callback completed but credentials were not persisted; check logs")
 	}
 
-	fmt.Println("🎉 Google Docs credentials stored at", status.TokenFile)
-	if *keep {
-		fmt.Println("The google-docs-mcp server is still running inside the container.")
+	fmt.Fprintln(s.Out, "🎉 Google Docs credentials stored at", status.TokenFile)
+	if keep {
+		fmt.Fprintln(s.Out, "The google-docs-mcp server is still running inside the container.")
 	} else {
-		fmt.Println("Stopped the temporary google-docs-mcp server.")
+		fmt.Fprintln(s.Out, "Stopped the temporary google-docs-mcp server.")
 	}
 	return nil
 }
@@ -134,9 +133,19 @@ func stopServer(dx dockerx.Docker, container string) error {
 	return dx.Exec(container, "pkill", "-f", "google-docs-mcp")
 }
 
+// googleDocsHTTP calls the google-docs-mcp server in container through the
+// supervisor's API, or with curl in containers whose image predates it.
+func googleDocsHTTP(dx dockerx.Docker, container, method, requestURI string) ([]byte, error) {
+	out, err := agent.Do(dx, container, method, "/local/"+googleDocsAuthPort+requestURI)
+	if !errors.Is(err, agent.ErrNoAgent) {
+		return out, err
+	}
+	return dx.ExecOutput(container, []string{"curl", "-s", "-X", method, "http://localhost:" + googleDocsAuthPort + requestURI})
+}
+
 func waitForServer(dx dockerx.Docker, container string) error {
 	for i := 0; i < 30; i++ {
-		if _, err := dx.ExecOutput(container, []string{"curl", "-s", fmt.Sprintf("http://localhost:%s/health", googleDocsAuthPort)}); err == nil {
+		if _, err := googleDocsHTTP(dx, container, "GET", "/health"); err == nil {
 			return nil
 		}
 		time.Sleep(time.Second)
@@ -145,7 +154,7 @@ func waitForServer(dx dockerx.Docker, container string) error {
 }
 
 func requestAuthStart(dx dockerx.Docker, container string) (*authStartResponse, error) {
-	out, err := dx.ExecOutput(container, []string{"curl", "-s", "-X", "POST", fmt.Sprintf("http://localhost:%s/auth/start", googleDocsAuthPort)})
+	out, err := googleDocsHTTP(dx, container, "POST", "/auth/start")
 	if err != nil {
 		return nil, fmt.Errorf("failed to call /auth/start: %w", err)
 	}
@@ -160,15 +169,20 @@ func requestAuthStart(dx dockerx.Docker, container string) (*authStartResponse,
 }
 
 func replayCallback(dx dockerx.Docker, container, callback string) error {
-	_, err := dx.ExecOutput(container, []string{"curl", "-s", callback})
+	u, err := url.Parse(callback)
 	if err != nil {
+		return fmt.Errorf("invalid callback URL: %w", err)
+	}
+	// The server's answer does not matter; /auth/status tells whether it worked.
+	var apiErr *agent.APIError
+	if _, err := googleDocsHTTP(dx, container, "GET", u.RequestURI()); err != nil && !errors.As(err, &apiErr) {
 		return fmt.Errorf("failed to replay callback: %w", err)
 	}
 	return nil
 }
 
 func requestAuthStatus(dx dockerx.Docker, container string) (*authStatusResponse, error) {
-	out, err := dx.ExecOutput(container, []string{"curl", "-s", fmt.Sprintf("http://localhost:%s/auth/status", googleDocsAuthPort)})
+	out, err := googleDocsHTTP(dx, container, "GET", "/auth/status")
 	if err != nil {
 		return nil, fmt.Errorf("failed to call /auth/status: %w", err)
 	}
@@ -178,33 +192,3 @@ func requestAuthStatus(dx dockerx.Docker, container string) (*authStatusResponse
 	}
 	return &resp, nil
 }
-
-type ioDiscard struct{}
-
-func (ioDiscard) Write(p []byte) (int, error) { return len(p), nil }
-
-func promptForContainer(dx dockerx.Docker) (string, error) {
-	cons, err := containers.List(dx, true)
-	if err != nil {
-		return "", fmt.Errorf("failed to list Claudex containers: %w", err)
-	}
-	if len(cons) == 0 {
-		return "", errors.New("no Claudex containers found; start one first")
-	}
-	fmt.Println("Select a Claudex container:")
-	for idx, c := range cons {
-		fmt.Printf("  %d) %s [%s]\n", idx+1, c.Name, c.Status)
-	}
-	fmt.Print("Container number (default 1): ")
-	reader := bufio.NewReader(os.Stdin)
-	input, _ := reader.ReadString('\n')
-	input = strings.TrimSpace(input)
-	if input == "" {
-		return cons[0].Name, nil
-	}
-	choice, err := strconv.Atoi(input)
-	if err != nil || choice < 1 || choice > len(cons) {
-		return "", fmt.Errorf("invalid selection %q", input)
-	}
-	return cons[choice-1].Name, nil
-}
@@ -0,0 +1,348 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/config"
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/notify"
+	"github.com/photodialectic/claudex/internal/run"
+	"github.com/photodialectic/claudex/internal/workspace"
+)
+
+// batchAgents maps --agent to a headless invocation; the prompt is read from
+// $PROMPT_FILE so it never needs shell quoting.
+var batchAgents = map[string]string{
+	"claude":   `claude -p --dangerously-skip-permissions "$(cat "$PROMPT_FILE")"`,
+	"codex":    `codex exec --full-auto --skip-git-repo-check "$(cat "$PROMPT_FILE")"`,
+	"gemini":   `gemini --yolo -p "$(cat "$PROMPT_FILE")"`,
+	"copilot":  `copilot --allow-all-tools -p "$(cat "$PROMPT_FILE")"`,
+	"opencode": `opencode run "$(cat "$PROMPT_FILE")"`,
+}
+
+// batchSnapshotScript records the working tree of every git repository
+// mounted under /workspace as a tree object, using a scratch index so the
+// real one is untouched. A task's diff is taken against it, so it leaves out
+// what earlier tasks in the same container changed. The .start marker dates
+// the task for batchTranscriptScript.
+const batchSnapshotScript = `rm -rf /tmp/claudex-batch-base && mkdir /tmp/claudex-batch-base || exit 1
+touch /tmp/claudex-batch-base/.start
+cd /workspace || exit 0
+for d in */; do
+  d=${d%/}
+  git -C "$d" rev-parse --is-inside-work-tree >/dev/null 2>&1 || continue
+  GIT_INDEX_FILE=$(mktemp); export GIT_INDEX_FILE
+  git -C "$d" read-tree HEAD 2>/dev/null
+  git -C "$d" add -A
+  git -C "$d" write-tree >"/tmp/claudex-batch-base/$d" || exit 1
+  rm -f "$GIT_INDEX_FILE"; unset GIT_INDEX_FILE
+done`
+
+// batchDiffScript prints the working-tree changes of every git repository
+// mounted under /workspace since batchSnapshotScript (or HEAD).
+const batchDiffScript = `cd /workspace || exit 0
+for d in */; do
+  d=${d%/}
+  git -C "$d" rev-parse --is-inside-work-tree >/dev/null 2>&1 || continue
+  set --
+  [ -s "/tmp/claudex-batch-base/$d" ] && set -- "$(cat "/tmp/claudex-batch-base/$d")"
+  GIT_INDEX_FILE=$(mktemp); export GIT_INDEX_FILE
+  git -C "$d" read-tree HEAD 2>/dev/null
+  git -C "$d" add -A
+  git -C "$d" diff --cached --binary --src-prefix="a/$d/" --dst-prefix="b/$d/" "$@"
+  rm -f "$GIT_INDEX_FILE"; unset GIT_INDEX_FILE
+done`
+
+// batchTranscriptScript copies the transcripts under $1 written since
+// batchSnapshotScript to $2, so a task in a reused container gets its own
+// and not those of the tasks before it.
+const batchTranscriptScript = `rm -rf "$2" && mkdir -p "$2" || exit 1
+cd "$1" 2>/dev/null || exit 0
+find . -type f -newer /tmp/claudex-batch-base/.start -exec cp --parents {} "$2" \;`
+
+// batchTranscriptDirs are copied from the container into each task's output.
+var batchTranscriptDirs = map[string]string{
+	"claude": path.Join(run.Home, ".claude/projects"),
+	"codex":  path.Join(run.Home, ".codex/sessions"),
+	"gemini": path.Join(run.Home, ".gemini/tmp"),
+}
+
+type batchTask struct {
+	Title  string
+	Prompt string
+}
+
+// batchResult is one entry of summary.json.
+type batchResult struct {
+	Task      string  `json:"task"`
+	Dir       string  `json:"dir"`
+	Container string  `json:"container"`
+	ExitCode  int     `json:"exit_code"`
+	Seconds   float64 `json:"seconds"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Batch implements `claudex batch --agent A --prompt-file F --out DIR
+// [--parallel] [--keep] [DIR...]`.
+func Batch(args []string) error {
+	return batchWithDocker(dockerx.New(), args, os.Stdout, os.Stderr)
+}
+
+func batchWithDocker(dx dockerx.Docker, args []string, out, errOut io.Writer) error {
+	var agent, promptFile, outDir string
+	var parallel, keep bool
+	var dirs []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch a {
+		case "--agent", "--prompt-file", "--out":
+			if i+1 >= len(args) {
+				return fmt.Errorf("%s requires a value", a)
+			}
+			switch a {
+			case "--agent":
+				agent = args[i+1]
+			case "--prompt-file":
+				promptFile = args[i+1]
+			case "--out":
+				outDir = args[i+1]
+			}
+			i++
+		case "--parallel":
+			parallel = true
+		case "--keep":
+			keep = true
+		default:
+			if strings.HasPrefix(a, "-") {
+				return fmt.Errorf("unknown arg: %s", a)
+			}
+			dirs = append(dirs, a)
+		}
+	}
+	if agent == "" {
+		agent = "claude"
+	}
+	if _, ok := batchAgents[agent]; !ok {
+		return fmt.Errorf("unknown --agent %q (want claude, codex, gemini, copilot or opencode)", agent)
+	}
+	if promptFile == "" || outDir == "" {
+		return fmt.Errorf("batch requires --prompt-file and --out")
+	}
+	data, err := os.ReadFile(promptFile)
+	if err != nil {
+		return err
+	}
+	tasks := parseBatchTasks(string(data))
+	if len(tasks) == 0 {
+		return fmt.Errorf("no tasks in %s", promptFile)
+	}
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return err
+	}
+
+	// Batch containers get their own names so teardown never touches an
+	// interactive session on the same dirs.
+	base := run.Options{Workdirs: dirs}
+	if err := base.Derive(); err != nil {
+		return err
+	}
+	prefix := fmt.Sprintf("%s-batch-%d", base.Name, time.Now().Unix())
+	up := func(name string) error {
+		args := append(append([]string(nil), dirs...), "--name", name)
+		if parallel {
+			// Parallel tasks must not edit the same files; each works on
+			// its own copy of the dirs.
+			args = append(args, "--cow")
+		}
+		_, err := run.Up(args, out, errOut, dx)
+		return err
+	}
+	teardown := func(name string) {
+		if keep {
+			fmt.Fprintf(out, "Keeping container %s\n", name)
+			return
+		}
+		_ = dx.Remove(name, true)
+	}
+
+	results := make([]batchResult, len(tasks))
+	taskDir := func(i int) string {
+		slug := workspace.ToKebab(tasks[i].Title)
+		if slug == "" {
+			slug = "task"
+		}
+		return filepath.Join(outDir, fmt.Sprintf("%02d-%s", i+1, slug))
+	}
+	if parallel {
+		var wg sync.WaitGroup
+		for i := range tasks {
+			name := fmt.Sprintf("%s-%d", prefix, i+1)
+			if err := up(name); err != nil {
+				teardown(name)
+				results[i] = batchResult{Task: tasks[i].Title, Dir: taskDir(i), Container: name, ExitCode: -1, Error: err.Error()}
+				continue
+			}
+			wg.Add(1)
+			go func(i int, name string) {
+				defer wg.Done()
+				defer teardown(name)
+				results[i] = runBatchTask(dx, name, agent, tasks[i], taskDir(i), i+1, errOut)
+			}(i, name)
+		}
+		wg.Wait()
+	} else {
+		if err := up(prefix); err != nil {
+			teardown(prefix)
+			return err
+		}
+		for i := range tasks {
+			fmt.Fprintf(out, "[%d/%d] %s\n", i+1, len(tasks), tasks[i].Title)
+			results[i] = runBatchTask(dx, prefix, agent, tasks[i], taskDir(i), i+1, errOut)
+		}
+		teardown(prefix)
+	}
+
+	failed := 0
+	for _, r := range results {
+		status := "ok"
+		if r.ExitCode != 0 {
+			status = fmt.Sprintf("failed (exit %d)", r.ExitCode)
+			failed++
+		}
+		fmt.Fprintf(out, "%-40s %s\n", r.Task, status)
+	}
+	summary, _ := json.MarshalIndent(results, "", "  ")
+	if err := os.WriteFile(filepath.Join(outDir, "summary.json"), append(summary, '\n'), 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Results in %s\n", outDir)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tasks failed", failed, len(tasks))
+	}
+	return nil
+}
+
+// runBatchTask runs one task headlessly in container and writes prompt.md,
+// output.log, diff.patch, and transcripts/ to dir.
+func runBatchTask(dx dockerx.Docker, container, agent string, t batchTask, dir string, n int, errOut io.Writer) batchResult {
+	res := batchResult{Task: t.Title, Dir: dir, Container: container}
+	fail := func(err error) batchResult {
+		res.ExitCode = -1
+		res.Error = err.Error()
+		return res
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fail(err)
+	}
+	promptPath := filepath.Join(dir, "prompt.md")
+	if err := os.WriteFile(promptPath, []byte(t.Prompt), 0644); err != nil {
+		return fail(err)
+	}
+	if err := dx.Exec(container, "bash", "-c", batchSnapshotScript); err != nil {
+		return fail(fmt.Errorf("snapshot workspace: %w", err))
+	}
+	inContainer := fmt.Sprintf("/tmp/claudex-batch-%d.md", n)
+	if err := dx.CP(promptPath, container+":"+inContainer); err != nil {
+		return fail(fmt.Errorf("copy prompt: %w", err))
+	}
+	logFile, err := os.Create(filepath.Join(dir, "output.log"))
+	if err != nil {
+		return fail(err)
+	}
+	start := time.Now()
+	err = dx.ExecStream([]string{"-w", "/workspace", "-e", "PROMPT_FILE=" + inContainer, container, "bash", "-lc", batchAgents[agent]}, logFile, logFile)
+	logFile.Close()
+	res.Seconds = time.Since(start).Round(time.Second).Seconds()
+	if err != nil {
+		res.ExitCode = -1
+		var exit interface{ ExitCode() int }
+		if errors.As(err, &exit) {
+			res.ExitCode = exit.ExitCode()
+		}
+		res.Error = err.Error()
+	}
+	if diff, err := dx.ExecOutput(container, []string{"bash", "-c", batchDiffScript}); err == nil {
+		_ = os.WriteFile(filepath.Join(dir, "diff.patch"), diff, 0644)
+	}
+	if src, ok := batchTranscriptDirs[agent]; ok {
+		stage := fmt.Sprintf("/tmp/claudex-batch-transcripts-%d", n)
+		if err := dx.Exec(container, "bash", "-c", batchTranscriptScript, "transcripts", src, stage); err == nil {
+			_ = dx.CP(container+":"+stage, filepath.Join(dir, "transcripts"))
+		}
+	}
+	notifyBatchTask(res, errOut)
+	return res
+}
+
+// notifyBatchTask reports a finished batch or queue task.
+func notifyBatchTask(res batchResult, errOut io.Writer) {
+	cfg, err := config.Load()
+	if err != nil {
+		return
+	}
+	status := "succeeded"
+	if res.ExitCode != 0 {
+		status = fmt.Sprintf("failed (exit %d)", res.ExitCode)
+	}
+	notify.Emit(cfg.Notifications, notify.Event{
+		Kind:      notify.Batch,
+		Container: res.Container,
+		Message:   fmt.Sprintf("task %q %s after %.0fs", res.Task, status, res.Seconds),
+		Fields:    map[string]string{"task": res.Task, "exit_code": fmt.Sprint(res.ExitCode)},
+	}, errOut)
+}
+
+// parseBatchTasks splits a prompt file into tasks at each "## " heading. A
+// file without such headings is a single task.
+func parseBatchTasks(s string) []batchTask {
+	var tasks []batchTask
+	var cur *batchTask
+	var preamble []string
+	for _, line := range strings.Split(s, "\n") {
+		if strings.HasPrefix(line, "## ") {
+			if cur != nil {
+				tasks = append(tasks, *cur)
+			}
+			cur = &batchTask{Title: strings.TrimSpace(strings.TrimPrefix(line, "## "))}
+			continue
+		}
+		if cur == nil {
+			preamble = append(preamble, line)
+			continue
+		}
+		cur.Prompt += line + "\n"
+	}
+	if cur != nil {
+		tasks = append(tasks, *cur)
+	}
+	if len(tasks) == 0 {
+		if p := strings.TrimSpace(strings.Join(preamble, "\n")); p != "" {
+			return []batchTask{{Title: "task", Prompt: p + "\n"}}
+		}
+		return nil
+	}
+	// Text before the first heading is shared context for every task.
+	shared := strings.TrimSpace(strings.Join(preamble, "\n"))
+	res := tasks[:0]
+	for _, t := range tasks {
+		t.Prompt = strings.TrimSpace(t.Prompt)
+		if t.Prompt == "" {
+			continue
+		}
+		if shared != "" {
+			t.Prompt = shared + "\n\n" + t.Prompt
+		}
+		t.Prompt += "\n"
+		res = append(res, t)
+	}
+	return res
+}
@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/photodialectic/claudex/internal/containers"
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/run"
+)
+
+// Stop implements `claudex stop`, stopping running claudex containers.
+func Stop(args []string) error {
+	return bulkWithDocker(dockerx.New(), "stop", args, stdStreams())
+}
+
+// Start implements `claudex start`, starting stopped claudex containers.
+func Start(args []string) error {
+	return bulkWithDocker(dockerx.New(), "start", args, stdStreams())
+}
+
+// bulkWithDocker applies verb ("stop" or "start") to every container chosen
+// by --name, --selector, or --all among the current user's, or everyone's
+// with --all-users.
+func bulkWithDocker(dx dockerx.Docker, verb string, args []string, s Streams) error {
+	var byName string
+	var all bool
+	owner := run.CurrentOwner()
+	selector := map[string]string{}
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch a {
+		case "--name":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--name requires a value")
+			}
+			byName = args[i+1]
+			i++
+		case "--selector":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--selector requires key=value[,key=value...]")
+			}
+			if err := addSelector(selector, args[i+1]); err != nil {
+				return err
+			}
+			i++
+		case "--all":
+			all = true
+		case "--all-users":
+			owner = ""
+		default:
+			return fmt.Errorf("unknown arg: %s", a)
+		}
+	}
+	if byName == "" && len(selector) == 0 && !all {
+		return fmt.Errorf("%s requires --name, --selector, or --all", verb)
+	}
+
+	cons, err := containers.List(dx, true)
+	if err != nil {
+		return err
+	}
+	var targets []dockerx.Container
+	for _, c := range cons {
+		// stop only touches running containers, start only stopped ones.
+		if (verb == "stop") != (c.Status == "running") {
+			continue
+		}
+		if byName != "" && c.Name != byName {
+			continue
+		}
+		if !run.OwnedBy(&c, owner) {
+			if c.Name == byName {
+				fmt.Fprintf(s.Out, "%s belongs to %s; pass --all-users to %s it.\n", c.Name, c.Labels[run.OwnerLabel], verb)
+				return nil
+			}
+			continue
+		}
+		if !containers.MatchSelector(c, selector) {
+			continue
+		}
+		targets = append(targets, c)
+	}
+	if len(targets) == 0 {
+		fmt.Fprintln(s.Out, "No matching containers.")
+		return nil
+	}
+
+	failed := 0
+	for _, c := range targets {
+		var err error
+		if verb == "stop" {
+			fmt.Fprintf(s.Out, "Stopping %s...\n", c.Name)
+			run.RecordUsage(dx, c.Name, 0, s.Err)
+			err = dx.Stop(c.Name)
+		} else {
+			fmt.Fprintf(s.Out, "Starting %s...\n", c.Name)
+			err = dx.Start(c.Name)
+		}
+		if err != nil {
+			fmt.Fprintf(s.Err, "Failed to %s %s: %v\n", verb, c.Name, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d container(s) failed to %s", failed, len(targets), verb)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/checkpoint"
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/run"
+)
+
+// Checkpoint implements `claudex checkpoint [--name N] [-m MSG] [--tag T] [--list]`.
+func Checkpoint(args []string) error {
+	return checkpointWithDocker(dockerx.New(), args, time.Now(), stdStreams())
+}
+
+func checkpointWithDocker(dx dockerx.Docker, args []string, now time.Time, s Streams) error {
+	t := targetSpec{prompt: s.Prompt}
+	var msg, tag string
+	list := false
+	for i := 0; i < len(args); i++ {
+		if ok, err := t.flag(args, &i); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		a := args[i]
+		switch a {
+		case "-m", "--tag":
+			if i+1 >= len(args) {
+				return fmt.Errorf("%s requires a value", a)
+			}
+			switch a {
+			case "-m":
+				msg = args[i+1]
+			case "--tag":
+				tag = args[i+1]
+			}
+			i++
+		case "--list":
+			list = true
+		default:
+			if err := t.positional(a); err != nil {
+				return err
+			}
+		}
+	}
+	target, err := t.resolve(dx, true)
+	if err != nil {
+		return err
+	}
+	if list {
+		out, err := dx.ExecOutput(target, []string{"bash", "-c", checkpoint.ListScript})
+		if err != nil {
+			return fmt.Errorf("list checkpoints: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+		cps := parseCheckpoints(out)
+		if len(cps) == 0 {
+			fmt.Fprintln(s.Out, "No checkpoints.")
+			return nil
+		}
+		for _, cp := range cps {
+			fmt.Fprintln(s.Out, cp)
+		}
+		return nil
+	}
+	if tag == "" {
+		tag = "cp-" + now.Format("20060102-150405")
+	}
+	if !checkpoint.NameRe.MatchString(tag) {
+		return fmt.Errorf("invalid checkpoint name %q", tag)
+	}
+	if msg == "" {
+		msg = "claudex checkpoint " + tag
+	}
+	out, err := dx.ExecOutput(target, []string{"bash", "-c", checkpoint.Script, "checkpoint", tag, msg})
+	if err != nil {
+		return fmt.Errorf("checkpoint failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	fmt.Fprintf(s.Out, "Checkpoint %s saved in %s: %s\n", tag, target, strings.Join(strings.Fields(string(out)), ", "))
+	return nil
+}
+
+// rollbackPrefix names the checkpoint rollback saves before it runs.
+const rollbackPrefix = "pre-rollback-"
+
+// Rollback implements `claudex rollback [--name N] [--to CHECKPOINT]`,
+// defaulting to the most recent checkpoint other than the pre-rollback-*
+// ones, and the auto-* ones of an --auto-commit container. The current state
+// is saved as a pre-rollback-* checkpoint first, so a rollback can itself be
+// undone.
+func Rollback(args []string) error {
+	return rollbackWithDocker(dockerx.New(), args, time.Now(), stdStreams())
+}
+
+func rollbackWithDocker(dx dockerx.Docker, args []string, now time.Time, s Streams) error {
+	t := targetSpec{prompt: s.Prompt}
+	var to string
+	for i := 0; i < len(args); i++ {
+		if ok, err := t.flag(args, &i); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		a := args[i]
+		switch a {
+		case "--to":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--to requires a value")
+			}
+			to = args[i+1]
+			i++
+		default:
+			if err := t.positional(a); err != nil {
+				return err
+			}
+		}
+	}
+	target, err := t.resolve(dx, true)
+	if err != nil {
+		return err
+	}
+	if to == "" {
+		out, err := dx.ExecOutput(target, []string{"bash", "-c", checkpoint.ListScript})
+		if err != nil {
+			return fmt.Errorf("list checkpoints: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+		cps := parseCheckpoints(out)
+		if len(cps) == 0 {
+			return fmt.Errorf("no checkpoints in %s; create one with claudex checkpoint", target)
+		}
+		info, err := dx.Inspect(target)
+		if err != nil {
+			return err
+		}
+		if to = latestCheckpoint(cps, info.Labels[run.AutoCommitLabel] != ""); to == "" {
+			return fmt.Errorf("%s only has automatic checkpoints; pick one with --to (see claudex checkpoint --list)", target)
+		}
+	}
+	if !checkpoint.NameRe.MatchString(to) {
+		return fmt.Errorf("invalid checkpoint name %q", to)
+	}
+	safety := rollbackPrefix + now.Format("20060102-150405")
+	if out, err := dx.ExecOutput(target, []string{"bash", "-c", checkpoint.Script, "checkpoint", safety, "claudex checkpoint before rollback to " + to}); err != nil {
+		return fmt.Errorf("saving the current state failed, not rolling back: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	fmt.Fprintf(s.Out, "Saved the current state of %s as checkpoint %s\n", target, safety)
+	out, err := dx.ExecOutput(target, []string{"bash", "-c", checkpoint.RollbackScript, "rollback", to})
+	if err != nil {
+		return fmt.Errorf("rollback failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	fmt.Fprintf(s.Out, "Rolled back %s to %s: %s\n", target, to, strings.Join(strings.Fields(string(out)), ", "))
+	return nil
+}
+
+// checkpointTimeLayout matches ListScript's %(creatordate:iso).
+const checkpointTimeLayout = "2006-01-02 15:04:05 -0700"
+
+// parseCheckpoints dedupes the per-repo listing and orders it by creation
+// time across repos.
+func parseCheckpoints(out []byte) []string {
+	seen := map[string]bool{}
+	var res []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		name := strings.SplitN(line, "\t", 2)[0]
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		res = append(res, line)
+	}
+	created := func(line string) time.Time {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) < 2 {
+			return time.Time{}
+		}
+		t, _ := time.Parse(checkpointTimeLayout, fields[1])
+		return t
+	}
+	sort.SliceStable(res, func(i, j int) bool { return created(res[i]).Before(created(res[j])) })
+	return res
+}
+
+// latestCheckpoint is the newest of cps that rollback would pick by itself:
+// never a pre-rollback-* safety checkpoint, and no auto-* one when skipAuto
+// is set, since --auto-commit keeps taking them of the current state.
+func latestCheckpoint(cps []string, skipAuto bool) string {
+	for i := len(cps) - 1; i >= 0; i-- {
+		name := strings.SplitN(cps[i], "\t", 2)[0]
+		if strings.HasPrefix(name, rollbackPrefix) || skipAuto && strings.HasPrefix(name, checkpoint.AutoPrefix) {
+			continue
+		}
+		return name
+	}
+	return ""
+}
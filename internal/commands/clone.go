@@ -0,0 +1,43 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/run"
+)
+
+// Clone implements `claudex clone <src-name> [--as <new-name>] [--nested-docker MODE]`.
+func Clone(args []string) error {
+	return cloneWithDocker(dockerx.New(), args, stdStreams())
+}
+
+func cloneWithDocker(dx dockerx.Docker, args []string, s Streams) error {
+	var src, as, nested string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch a {
+		case "--as":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--as requires a value")
+			}
+			as = args[i+1]
+			i++
+		case "--nested-docker":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--nested-docker requires a value")
+			}
+			nested = args[i+1]
+			i++
+		default:
+			if src != "" {
+				return fmt.Errorf("unexpected arg: %s", a)
+			}
+			src = a
+		}
+	}
+	if src == "" {
+		return fmt.Errorf("usage: claudex clone <src-name> [--as <new-name>] [--nested-docker MODE]")
+	}
+	return run.Clone(src, as, nested, s.Out, s.Err, dx)
+}
@@ -1,110 +1,373 @@
 package commands
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
-	"strconv"
+	"sort"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/photodialectic/claudex/internal/buildctx"
+	"github.com/photodialectic/claudex/internal/config"
 	"github.com/photodialectic/claudex/internal/containers"
 	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/notify"
+	"github.com/photodialectic/claudex/internal/output"
+	"github.com/photodialectic/claudex/internal/run"
+	"github.com/photodialectic/claudex/internal/state"
 	"github.com/photodialectic/claudex/internal/ui"
 )
 
 const cliRefreshArg = "CLAUDEX_REFRESH_TOKEN"
 
+// slimBuildArgs select the slim flavor of the Dockerfile: a node:22-slim
+// base without the Docker engine, the Google Docs MCP server, or the agent
+// CLIs other than Claude Code.
+var slimBuildArgs = map[string]string{"BASE_IMAGE": "node:22-slim", "CLAUDEX_SLIM": "1"}
+
+// SlimLabel is "1" on slim images, so `claudex update` keeps the flavor.
+const SlimLabel = "com.claudex.slim"
+
+// userFlags are the build and update flags choosing the container user.
+type userFlags struct {
+	name, uid string
+	noSudo    bool
+	set       bool
+}
+
+// flag consumes --user NAME, --uid UID|host or --no-sudo at args[*i],
+// advancing *i past its value. It reports false for other args.
+func (u *userFlags) flag(args []string, i *int) (bool, error) {
+	a := args[*i]
+	switch a {
+	case "--no-sudo":
+		u.noSudo = true
+	case "--user", "--uid":
+		if *i+1 >= len(args) {
+			return true, fmt.Errorf("%s requires a value", a)
+		}
+		*i++
+		if a == "--user" {
+			u.name = args[*i]
+		} else {
+			u.uid = args[*i]
+		}
+	default:
+		return false, nil
+	}
+	u.set = true
+	return true, nil
+}
+
+// resolve returns the chosen user; without flags it is current, the user
+// of the image being replaced.
+func (u userFlags) resolve(current run.ImageUser) (run.ImageUser, error) {
+	if !u.set {
+		return current, nil
+	}
+	return run.ParseImageUser(u.name, u.uid, u.noSudo)
+}
+
+// applyImageUser adds the build args for u to opts; the Dockerfile's
+// defaults are the node user.
+func applyImageUser(opts *dockerx.BuildOptions, u run.ImageUser) {
+	if u == run.DefaultImageUser {
+		return
+	}
+	if opts.BuildArgs == nil {
+		opts.BuildArgs = map[string]string{}
+	}
+	for k, v := range u.BuildArgs() {
+		opts.BuildArgs[k] = v
+	}
+}
+
 func Build(args []string) error {
-	fmt.Println("Preparing build context...")
-	ctxDir, cleanup, err := buildctx.PrepareBuildContext()
+	return buildWithDocker(dockerx.New(), args, stdStreams())
+}
+
+func buildWithDocker(dx dockerx.Docker, args []string, s Streams) error {
+	noCache := false
+	showContext := false
+	slim := false
+	contextDir := ""
+	var with []string
+	var uf userFlags
+	for i := 0; i < len(args); i++ {
+		if ok, err := uf.flag(args, &i); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		a := args[i]
+		switch a {
+		case "--no-cache":
+			noCache = true
+		case "--slim":
+			slim = true
+		case "--with":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--with requires TOOLCHAIN=VERSION[,...], e.g. go=1.23,python=3.12")
+			}
+			with = append(with, args[i+1])
+			i++
+		case "--show-context":
+			showContext = true
+		case "--build-context-dir":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--build-context-dir requires a value")
+			}
+			contextDir = args[i+1]
+			i++
+		default:
+			return fmt.Errorf("unknown arg: %s", a)
+		}
+	}
+	if showContext {
+		return printContext(contextDir, s.Out)
+	}
+	tc, err := parseToolchains(with)
 	if err != nil {
 		return err
 	}
-	defer cleanup()
-	dx := &dockerx.CLI{}
-	// Optional --no-cache flag
-	noCache := false
-	for _, a := range args {
-		if a == "--no-cache" {
-			noCache = true
+	user, err := uf.resolve(run.DefaultImageUser)
+	if err != nil {
+		return err
+	}
+	options := dockerx.BuildOptions{NoCache: noCache, BuildArgs: map[string]string{}}
+	if slim {
+		for k, v := range slimBuildArgs {
+			options.BuildArgs[k] = v
 		}
 	}
+	applyToolchains(&options, tc, slim)
+	applyImageUser(&options, user)
+	ctxArg, stream, err := prepareContext(contextDir, s.Out)
+	if err != nil {
+		return err
+	}
+	if stream != nil {
+		defer stream.Close()
+		options.Context = stream
+	}
+	what := "image 'claudex'"
+	if slim {
+		what = "slim " + what
+	}
+	if len(tc) > 0 {
+		what += " (" + formatToolchains(tc) + ")"
+	}
+	if user != run.DefaultImageUser {
+		what += " for " + user.String()
+	}
 	if noCache {
-		fmt.Println("Building image 'claudex' with --no-cache...")
+		fmt.Fprintf(s.Out, "Building %s with --no-cache...\n", what)
+	} else {
+		fmt.Fprintf(s.Out, "Building %s...\n", what)
+	}
+	if err := dx.Build("claudex", ctxArg, options); err != nil {
+		return err
+	}
+	fmt.Fprintln(s.Out, "✅ Build complete: claudex")
+	return nil
+}
+
+// prepareContext uses dir as the build context when set, otherwise streams the embedded one.
+func prepareContext(dir string, out io.Writer) (string, io.ReadCloser, error) {
+	if dir != "" {
+		fmt.Fprintf(out, "Using build context from %s...\n", dir)
 	} else {
-		fmt.Println("Building image 'claudex'...")
+		fmt.Fprintln(out, "Streaming embedded build context...")
+		if files, err := buildctx.Overrides(); err == nil && len(files) > 0 {
+			overrideDir, _ := buildctx.OverrideDir()
+			fmt.Fprintf(out, "Applying %d override(s) from %s: %s\n", len(files), overrideDir, strings.Join(files, ", "))
+		}
 	}
-	options := dockerx.BuildOptions{NoCache: noCache}
-	if err := dx.Build("claudex", ctxDir, options); err != nil {
+	return buildctx.Context(dir)
+}
+
+// printContext lists the files docker build would receive, marking user overrides.
+func printContext(dir string, out io.Writer) error {
+	embedded := dir == ""
+	prepare := buildctx.PrepareBuildContext
+	if !embedded {
+		prepare = func() (string, func() error, error) { return buildctx.FromDir(dir) }
+	}
+	ctxDir, cleanup, err := prepare()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	files, err := buildctx.Describe(ctxDir)
+	if err != nil {
 		return err
 	}
-	fmt.Println("✅ Build complete: claudex")
+	overridden := map[string]bool{}
+	if embedded {
+		if list, err := buildctx.Overrides(); err == nil {
+			for _, f := range list {
+				overridden[f] = true
+			}
+		}
+	}
+	var total int64
+	fmt.Fprintf(out, "%-56s %10s  %-12s %s\n", "PATH", "SIZE", "SHA256", "SOURCE")
+	for _, f := range files {
+		source := "dir"
+		if embedded {
+			source = "embedded"
+			if overridden[f.Path] {
+				source = "override"
+			}
+		}
+		total += f.Size
+		fmt.Fprintf(out, "%-56s %10d  %-12s %s\n", f.Path, f.Size, f.SHA256[:12], source)
+	}
+	fmt.Fprintf(out, "%d file(s), %d bytes\n", len(files), total)
 	return nil
 }
 
 // Update reinstalls CLI tool layers without invalidating the entire Docker cache unless requested.
 func Update(args []string) error {
-	return updateWithDocker(&dockerx.CLI{}, args)
+	return updateWithDocker(dockerx.New(), args, stdStreams())
 }
 
-func updateWithDocker(dx dockerx.Docker, args []string) error {
-	var noCache bool
-	for _, a := range args {
+func updateWithDocker(dx dockerx.Docker, args []string, s Streams) error {
+	var noCache, slim, pruneOld bool
+	var contextDir string
+	var with []string
+	var uf userFlags
+	for i := 0; i < len(args); i++ {
+		if ok, err := uf.flag(args, &i); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		a := args[i]
 		switch a {
 		case "--no-cache":
 			noCache = true
+		case "--slim":
+			slim = true
+		case "--with":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--with requires TOOLCHAIN=VERSION[,...], e.g. go=1.23,python=3.12")
+			}
+			with = append(with, args[i+1])
+			i++
+		case "--prune-old":
+			pruneOld = true
+		case "--build-context-dir":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--build-context-dir requires a value")
+			}
+			contextDir = args[i+1]
+			i++
 		default:
 			return fmt.Errorf("unknown arg: %s", a)
 		}
 	}
+	// Keep the flavor, toolchains and user the current image was built with.
+	labels, _ := dx.ImageLabels("claudex")
+	if labels[SlimLabel] == "1" {
+		slim = true
+	}
+	if with == nil && labels[ToolchainsLabel] != "" {
+		with = []string{labels[ToolchainsLabel]}
+	}
+	tc, err := parseToolchains(with)
+	if err != nil {
+		return err
+	}
+	user, err := uf.resolve(run.ImageUserOf(labels))
+	if err != nil {
+		return err
+	}
 
-	fmt.Println("Preparing build context...")
-	ctxDir, cleanup, err := buildctx.PrepareBuildContext()
+	ctxArg, stream, err := prepareContext(contextDir, s.Out)
 	if err != nil {
 		return err
 	}
-	defer cleanup()
+	if stream != nil {
+		defer stream.Close()
+	}
 
 	if noCache {
-		fmt.Println("Updating CLI tools with --no-cache...")
+		fmt.Fprintln(s.Out, "Updating CLI tools with --no-cache...")
 	} else {
-		fmt.Println("Refreshing CLI tool layers in image 'claudex'...")
+		fmt.Fprintln(s.Out, "Refreshing CLI tool layers in image 'claudex'...")
 	}
 	refreshToken := fmt.Sprintf("%d", time.Now().Unix())
 	options := dockerx.BuildOptions{
 		NoCache:   noCache,
 		BuildArgs: map[string]string{cliRefreshArg: refreshToken},
 	}
-	if err := dx.Build("claudex", ctxDir, options); err != nil {
+	if slim {
+		for k, v := range slimBuildArgs {
+			options.BuildArgs[k] = v
+		}
+	}
+	applyToolchains(&options, tc, slim)
+	applyImageUser(&options, user)
+	if stream != nil {
+		options.Context = stream
+	}
+	if err := dx.Build("claudex", ctxArg, options); err != nil {
 		return err
 	}
-	fmt.Println("✅ Update complete: CLI tools refreshed")
+	fmt.Fprintln(s.Out, "✅ Update complete: CLI tools refreshed")
+	if pruneOld {
+		return pruneOldImages(dx, s.Out)
+	}
 	return nil
 }
 
 // List implements `claudex list` with filters and formats.
 func List(args []string) error {
+	return listWithDocker(dockerx.New(), args, os.Stdout)
+}
+
+func listWithDocker(dx dockerx.Docker, args []string, out io.Writer) error {
 	show := "running"
 	format := "table"
+	sortBy := "created"
+	columns := defaultListColumns
+	history, withSize, customColumns, allUsers := false, false, false, false
 	filters := map[string]string{}
+	selector := map[string]string{}
 	for i := 0; i < len(args); i++ {
 		a := args[i]
 		switch a {
 		case "--all":
 			show = "all"
+		case "--history":
+			history = true
+		case "--all-users":
+			allUsers = true
 		case "--running":
 			show = "running"
 		case "--stopped":
 			show = "stopped"
-		case "--format":
+		case "--size":
+			withSize = true
+		case "--format", "--sort", "--columns":
 			if i+1 >= len(args) {
-				return fmt.Errorf("--format requires a value")
+				return fmt.Errorf("%s requires a value", a)
+			}
+			switch a {
+			case "--format":
+				format = args[i+1]
+			case "--sort":
+				sortBy = args[i+1]
+			default:
+				columns = strings.Split(args[i+1], ",")
+				customColumns = true
 			}
-			format = args[i+1]
 			i++
 		case "--filter":
 			if i+1 >= len(args) {
@@ -117,12 +380,53 @@ func List(args []string) error {
 				return fmt.Errorf("invalid --filter %q", kv)
 			}
 			filters[parts[0]] = parts[1]
+		case "--selector":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--selector requires key=value[,key=value...]")
+			}
+			if err := addSelector(selector, args[i+1]); err != nil {
+				return err
+			}
+			i++
 		default:
 			return fmt.Errorf("unknown arg: %s", a)
 		}
 	}
+	less, ok := listSorts[sortBy]
+	if !ok {
+		return fmt.Errorf("invalid --sort %q (want created, name, status or size)", sortBy)
+	}
+	if sortBy == "size" {
+		withSize = true
+	}
+	for _, col := range columns {
+		if _, ok := listColumns[col]; !ok {
+			return fmt.Errorf("invalid --columns entry %q (want %s)", col, strings.Join(listColumnNames(), ", "))
+		}
+		if col == "size" || col == "volumes" {
+			withSize = true
+		}
+	}
+	if withSize && !customColumns {
+		columns = append(append([]string(nil), columns...), "size", "volumes")
+	}
+	if allUsers && !customColumns {
+		columns = append(append([]string(nil), columns...), "owner")
+	}
+	var tmpl *template.Template
+	switch format {
+	case "table", "json", "names":
+	default:
+		if !strings.Contains(format, "{{") {
+			return fmt.Errorf("invalid --format %q (want table, json, names or a Go template)", format)
+		}
+		t, err := template.New("list").Parse(format + "\n")
+		if err != nil {
+			return fmt.Errorf("invalid --format template: %w", err)
+		}
+		tmpl = t
+	}
 
-	dx := &dockerx.CLI{}
 	includeStopped := show != "running"
 	cons, err := containers.List(dx, includeStopped)
 	if err != nil {
@@ -138,81 +442,171 @@ func List(args []string) error {
 		cons = tmp
 	}
 
+	owner := ""
+	if !allUsers {
+		owner = run.CurrentOwner()
+	}
 	var outList []dockerx.Container
 	for _, c := range cons {
-		if v, ok := filters["name"]; ok {
-			if v == "" {
-				continue
-			}
-			okm, err := filepath.Match(v, c.Name)
-			if err != nil {
-				return fmt.Errorf("invalid --filter name pattern %q: %v", v, err)
-			}
-			if !okm {
-				continue
-			}
-		}
-		if v, ok := filters["signature"]; ok && c.Labels["com.claudex.signature"] != v {
+		if !run.OwnedBy(&c, owner) {
 			continue
 		}
-		if v, ok := filters["slug"]; ok {
-			if v == "" {
+		ok, err := matchFilters(c, filters)
+		if err != nil {
+			return err
+		}
+		if ok && containers.MatchSelector(c, selector) {
+			outList = append(outList, c)
+		}
+	}
+
+	// Merge the state store: last-attached times for live containers and,
+	// with --history, sessions whose containers have been removed.
+	sessions := map[string]state.Session{}
+	if st, err := state.Load(); err == nil {
+		for _, sess := range st.All() {
+			sessions[sess.Name] = sess
+		}
+	}
+	if history {
+		live := map[string]bool{}
+		for _, c := range cons {
+			live[c.Name] = true
+		}
+		for _, sess := range sessions {
+			if live[sess.Name] || !sess.Removed() {
 				continue
 			}
-			okm, err := filepath.Match(v, c.Labels["com.claudex.slug"])
-			if err != nil {
-				return fmt.Errorf("invalid --filter slug pattern %q: %v", v, err)
+			c := dockerx.Container{Name: sess.Name, Status: "removed", CreatedAt: sess.CreatedAt, Labels: map[string]string{"com.claudex.signature": sess.Signature, "com.claudex.slug": sess.Slug}}
+			if b, err := json.Marshal(sess.Mounts); err == nil {
+				c.Labels["com.claudex.mounts"] = string(b)
 			}
-			if !okm {
+			if ok, err := matchFilters(c, filters); err != nil || !ok || !containers.MatchSelector(c, selector) {
 				continue
 			}
+			outList = append(outList, c)
 		}
-		outList = append(outList, c)
 	}
 
-	switch format {
-	case "json":
-		type outItem struct {
-			Name      string            `json:"name"`
-			Status    string            `json:"status"`
-			Created   time.Time         `json:"created"`
-			Image     string            `json:"image"`
-			Labels    map[string]string `json:"labels"`
-			Mounts    []string          `json:"mounts"`
-			Signature string            `json:"signature"`
-			Slug      string            `json:"slug"`
-		}
-		var items []outItem
-		for _, c := range outList {
-			m, _ := containers.MountsFromLabel(&c)
-			items = append(items, outItem{Name: c.Name, Status: c.Status, Created: c.CreatedAt, Image: c.Image, Labels: c.Labels, Mounts: m, Signature: c.Labels["com.claudex.signature"], Slug: c.Labels["com.claudex.slug"]})
-		}
-		enc := json.NewEncoder(os.Stdout)
+	var du dockerx.DiskUsage
+	if withSize {
+		if du, err = dx.DiskUsage(); err != nil {
+			return err
+		}
+	}
+	items := make([]listItem, 0, len(outList))
+	for _, c := range outList {
+		m, _ := containers.MountsFromLabel(&c)
+		item := listItem{Name: c.Name, Status: c.Status, Created: c.CreatedAt, Image: c.Image, Labels: c.Labels, Mounts: m, Signature: c.Labels["com.claudex.signature"], Slug: c.Labels["com.claudex.slug"], Owner: c.Labels[run.OwnerLabel]}
+		if sess, ok := sessions[c.Name]; ok && !sess.LastAttached.IsZero() {
+			t := sess.LastAttached
+			item.LastAttached = &t
+		}
+		if withSize && c.Status != "removed" {
+			item.Disk = diskFor(du, c)
+		}
+		items = append(items, item)
+	}
+	sort.SliceStable(items, func(i, j int) bool { return less(items[i], items[j]) })
+
+	switch {
+	case tmpl != nil:
+		for _, item := range items {
+			if err := tmpl.Execute(out, item); err != nil {
+				return fmt.Errorf("--format template: %w", err)
+			}
+		}
+		return nil
+	case format == "json":
+		enc := json.NewEncoder(out)
 		enc.SetIndent("", "  ")
 		return enc.Encode(items)
-	case "names":
-		for _, c := range outList {
-			fmt.Println(c.Name)
+	case format == "names":
+		for _, item := range items {
+			fmt.Fprintln(out, item.Name)
 		}
 		return nil
 	default:
-		fmt.Printf("%-32s %-10s %-20s %-10s %-8s %-16s %-10s\n", "NAME", "STATUS", "CREATED", "SIGNATURE", "MOUNTS", "SLUG", "IMAGE")
-		for _, c := range outList {
-			m, _ := containers.MountsFromLabel(&c)
-			created := c.CreatedAt.Format("2006-01-02 15:04:05")
-			fmt.Printf("%-32s %-10s %-20s %-10s %-8d %-16s %-10s\n", c.Name, c.Status, created, c.Labels["com.claudex.signature"], len(m), c.Labels["com.claudex.slug"], c.Image)
+		return printListTable(out, items, columns)
+	}
+}
+
+// matchFilters applies `list --filter` name/signature/slug selectors to c.
+func matchFilters(c dockerx.Container, filters map[string]string) (bool, error) {
+	if v, ok := filters["name"]; ok {
+		if v == "" {
+			return false, nil
+		}
+		okm, err := filepath.Match(v, c.Name)
+		if err != nil {
+			return false, fmt.Errorf("invalid --filter name pattern %q: %v", v, err)
+		}
+		if !okm {
+			return false, nil
+		}
+	}
+	if v, ok := filters["signature"]; ok && c.Labels["com.claudex.signature"] != v {
+		return false, nil
+	}
+	if v, ok := filters["slug"]; ok {
+		if v == "" {
+			return false, nil
+		}
+		okm, err := filepath.Match(v, c.Labels["com.claudex.slug"])
+		if err != nil {
+			return false, fmt.Errorf("invalid --filter slug pattern %q: %v", v, err)
+		}
+		if !okm {
+			return false, nil
 		}
-		return nil
 	}
+	return true, nil
+}
+
+// addSelector merges a --selector value into dst; repeated flags AND together.
+func addSelector(dst map[string]string, arg string) error {
+	sel, err := containers.ParseSelector(arg)
+	if err != nil {
+		return fmt.Errorf("invalid --selector: %w", err)
+	}
+	for k, v := range sel {
+		dst[k] = v
+	}
+	return nil
 }
 
 // Destroy removes claudex containers with safety prompt.
 func Destroy(args []string) error {
-	var byName, bySig string
-	var all bool
-	var runningOnly, stoppedOnly bool
-	var force bool
-	var pruneStopped bool
+	return destroyWithDocker(dockerx.New(), args, stdStreams())
+}
+
+// DestroyResult is what destroy did, as printed by --json.
+type DestroyResult struct {
+	Removed []string `json:"removed"`
+	// Failed lists containers the engine would not remove.
+	Failed []string `json:"failed,omitempty"`
+	// Protected lists containers skipped for lack of --force-protected.
+	Protected []string `json:"protected,omitempty"`
+	Volumes   []string `json:"volumes,omitempty"`
+	Images    []string `json:"images,omitempty"`
+	// Aborted is set when the user declined or picked nothing.
+	Aborted bool `json:"aborted,omitempty"`
+}
+
+// destroyOptions are destroy's flags.
+type destroyOptions struct {
+	byName, bySig                              string
+	all, runningOnly, stoppedOnly              bool
+	force, pruneStopped, expired               bool
+	withVolumes, withSnapshots, forceProtected bool
+	asJSON                                     bool
+	// owner limits destroy to one user's containers; --all-users clears it.
+	owner    string
+	selector map[string]string
+}
+
+func destroyWithDocker(dx dockerx.Docker, args []string, s Streams) error {
+	o := destroyOptions{selector: map[string]string{}, owner: run.CurrentOwner()}
 	for i := 0; i < len(args); i++ {
 		a := args[i]
 		switch a {
@@ -220,46 +614,99 @@ func Destroy(args []string) error {
 			if i+1 >= len(args) {
 				return fmt.Errorf("--name requires a value")
 			}
-			byName = args[i+1]
+			o.byName = args[i+1]
 			i++
 		case "--signature":
 			if i+1 >= len(args) {
 				return fmt.Errorf("--signature requires a value")
 			}
-			bySig = args[i+1]
+			o.bySig = args[i+1]
 			i++
 		case "--all":
-			all = true
+			o.all = true
 		case "--running":
-			runningOnly = true
+			o.runningOnly = true
 		case "--stopped":
-			stoppedOnly = true
+			o.stoppedOnly = true
 		case "--force":
-			force = true
+			o.force = true
 		case "--prune-stopped":
-			pruneStopped = true
+			o.pruneStopped = true
+		case "--expired":
+			o.expired = true
+		case "--all-users":
+			o.owner = ""
+		case "--volumes":
+			o.withVolumes = true
+		case "--snapshots":
+			o.withSnapshots = true
+		case "--force-protected":
+			o.forceProtected = true
+		case "--json":
+			o.asJSON = true
+		case "--selector":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--selector requires key=value[,key=value...]")
+			}
+			if err := addSelector(o.selector, args[i+1]); err != nil {
+				return err
+			}
+			i++
 		default:
 			return fmt.Errorf("unknown arg: %s", a)
 		}
 	}
-	if pruneStopped {
-		all = true
-		runningOnly = false
-		stoppedOnly = true
+	if o.pruneStopped {
+		o.all = true
+		o.runningOnly = false
+		o.stoppedOnly = true
+	}
+	if o.expired {
+		o.all = true
+	}
+	if !o.asJSON {
+		_, err := destroyContainers(dx, o, s)
+		return err
+	}
+	if !o.force || (!o.all && o.byName == "" && o.bySig == "" && len(o.selector) == 0) {
+		return fmt.Errorf("--json cannot prompt; pick containers with --name, --signature, --selector or --all and pass --force")
 	}
+	res, err := destroyContainers(dx, o, s.quiet())
+	if err != nil {
+		return err
+	}
+	return writeJSON(s.Out, res)
+}
 
-	dx := &dockerx.CLI{}
+// destroyContainers picks the victims (asking through s.Prompt unless the
+// flags name them), confirms unless forced, and removes them.
+func destroyContainers(dx dockerx.Docker, o destroyOptions, s Streams) (DestroyResult, error) {
+	res := DestroyResult{Removed: []string{}}
 	cons, err := containers.List(dx, true)
 	if err != nil {
-		return err
+		return res, err
 	}
 	// Build candidate pool by status
 	var pool []dockerx.Container
+	now := time.Now()
 	for _, c := range cons {
-		if runningOnly && c.Status != "running" {
+		if !run.OwnedBy(&c, o.owner) {
+			if c.Name == o.byName {
+				fmt.Fprintf(s.Out, "%s belongs to %s; pass --all-users to destroy it.\n", c.Name, c.Labels[run.OwnerLabel])
+				return res, nil
+			}
+			continue
+		}
+		if o.expired && (!run.Expired(&c, now) || c.Labels[run.TTLActionLabel] != run.TTLDestroy) {
+			continue
+		}
+		if o.runningOnly && c.Status != "running" {
+			continue
+		}
+		if o.stoppedOnly && c.Status == "running" {
 			continue
 		}
-		if stoppedOnly && c.Status == "running" {
+		if !containers.MatchSelector(c, o.selector) {
 			continue
 		}
 		pool = append(pool, c)
@@ -267,193 +714,374 @@ func Destroy(args []string) error {
 
 	// Resolve victims from selectors or interactive choice
 	var victims []dockerx.Container
-	if all {
+	if o.all {
 		victims = append(victims, pool...)
 	}
-	if len(victims) == 0 && (byName != "" || bySig != "") {
+	if len(victims) == 0 && (o.byName != "" || o.bySig != "" || len(o.selector) > 0) {
 		for _, c := range pool {
-			if byName != "" && c.Name != byName {
+			if o.byName != "" && c.Name != o.byName {
 				continue
 			}
-			if bySig != "" && c.Labels["com.claudex.signature"] != bySig {
+			if o.bySig != "" && c.Labels["com.claudex.signature"] != o.bySig {
 				continue
 			}
 			victims = append(victims, c)
 		}
 		if len(victims) == 0 {
-			fmt.Println("No matching containers.")
-			return nil
+			fmt.Fprintln(s.Out, "No matching containers.")
+			return res, nil
 		}
 	}
 	if len(victims) == 0 {
+		if len(pool) == 0 && o.expired {
+			fmt.Fprintln(s.Out, "No expired containers.")
+			return res, nil
+		}
 		if len(pool) == 0 {
-			fmt.Println("No claudex containers match the status filter.")
-			return nil
+			fmt.Fprintln(s.Out, "No claudex containers match the status filter.")
+			return res, nil
 		}
-		fmt.Println("Select containers to destroy (comma-separated numbers):")
-		for i, c := range pool {
+		menu := ui.Menu{Title: output.T(output.MsgSelectDestroy), Question: output.T(output.MsgSelection)}
+		for _, c := range pool {
 			sig := c.Labels["com.claudex.signature"]
 			slug := c.Labels["com.claudex.slug"]
-			fmt.Printf("  [%d] %-32s %-10s %-8s %-16s\n", i+1, c.Name, c.Status, sig, slug)
-		}
-		fmt.Print("Enter selection (blank to abort): ")
-		reader := bufio.NewReader(os.Stdin)
-		line, _ := reader.ReadString('\n')
-		line = strings.TrimSpace(line)
-		if line == "" {
-			fmt.Println("Aborted.")
-			return nil
+			menu.Options = append(menu.Options, fmt.Sprintf("%-32s %-10s %-8s %-16s", c.Name, c.Status, sig, slug))
 		}
-		parts := strings.Split(line, ",")
-		seen := map[int]bool{}
-		for _, p := range parts {
-			p = strings.TrimSpace(p)
-			if p == "" {
-				continue
+		picks, err := s.Prompt.SelectMany(menu)
+		if err != nil {
+			return res, err
+		}
+		if len(picks) == 0 {
+			fmt.Fprintln(s.Out, output.T(output.MsgAborted))
+			res.Aborted = true
+			return res, nil
+		}
+		for _, idx := range picks {
+			victims = append(victims, pool[idx])
+		}
+	}
+
+	if !o.forceProtected {
+		for _, v := range victims {
+			if run.Protected(&v) {
+				res.Protected = append(res.Protected, v.Name)
 			}
-			idx, err := strconv.Atoi(p)
-			if err != nil || idx < 1 || idx > len(pool) {
-				return fmt.Errorf("invalid selection '%s'", p)
+		}
+		victims = skipProtected(victims, s.Out)
+		if len(victims) == 0 {
+			fmt.Fprintln(s.Out, "Nothing to remove.")
+			return res, nil
+		}
+	}
+
+	if !o.force {
+		printDestroySummary(s.Out, victims, time.Now())
+		if o.withVolumes || o.withSnapshots {
+			vols, images := linkedResources(dx, victims, survivorsOf(cons, victims), o.withVolumes, o.withSnapshots)
+			if len(vols) > 0 {
+				fmt.Fprintf(s.Out, "and volume(s): %s\n", strings.Join(vols, ", "))
 			}
-			if seen[idx] {
-				continue
+			if len(images) > 0 {
+				fmt.Fprintf(s.Out, "and snapshot image(s): %s\n", strings.Join(images, ", "))
 			}
-			seen[idx] = true
-			victims = append(victims, pool[idx-1])
 		}
-		if len(victims) == 0 {
-			fmt.Println("No selection; aborted.")
-			return nil
+		ok, err := s.Prompt.Confirm(output.T(output.MsgProceed))
+		if err != nil {
+			return res, err
+		}
+		if !ok {
+			fmt.Fprintln(s.Out, output.T(output.MsgAborted))
+			res.Aborted = true
+			return res, nil
 		}
 	}
 
-	if !force {
-		fmt.Printf("About to remove %d container(s):\n", len(victims))
-		fmt.Printf("%-32s %-10s %-10s %-16s\n", "NAME", "STATUS", "SIGNATURE", "SLUG")
+	for _, v := range victims {
+		if v.Status == "running" {
+			run.RecordUsage(dx, v.Name, 0, s.Err)
+		}
+		fmt.Fprintf(s.Out, "Removing %s...\n", v.Name)
+		if err := dx.Remove(v.Name, true); err != nil {
+			fmt.Fprintf(s.Err, "Failed to remove %s: %v\n", v.Name, err)
+			res.Failed = append(res.Failed, v.Name)
+			continue
+		}
+		res.Removed = append(res.Removed, v.Name)
+	}
+	if (o.withVolumes || o.withSnapshots) && len(res.Removed) > 0 {
+		// Only what belonged to containers that are actually gone.
+		var gone []dockerx.Container
 		for _, v := range victims {
-			fmt.Printf("%-32s %-10s %-10s %-16s\n", v.Name, v.Status, v.Labels["com.claudex.signature"], v.Labels["com.claudex.slug"])
-		}
-		fmt.Print("Proceed? [y/N] ")
-		reader := bufio.NewReader(os.Stdin)
-		ans, _ := reader.ReadString('\n')
-		ans = strings.TrimSpace(ans)
-		if !strings.EqualFold(ans, "y") && !strings.EqualFold(ans, "yes") {
-			fmt.Println("Aborted.")
-			return nil
+			for _, n := range res.Removed {
+				if v.Name == n {
+					gone = append(gone, v)
+				}
+			}
 		}
+		vols, images := linkedResources(dx, gone, survivorsOf(cons, gone), o.withVolumes, o.withSnapshots)
+		res.Volumes, res.Images = removeLinked(dx, vols, images, s.Out, s.Err)
 	}
+	markRemoved(res.Removed, s.Err)
+	notifyRemoved(res.Removed, o.pruneStopped, s.Err)
+	return res, nil
+}
 
+// printDestroySummary lists victims for the destroy confirmation with their
+// age and host mounts, which tell workspaces apart when slugs collide.
+func printDestroySummary(out io.Writer, victims []dockerx.Container, now time.Time) {
+	fmt.Fprintln(out, output.T(output.MsgAboutToRemove, len(victims)))
+	fmt.Fprintln(out, output.Paint(out, output.Bold, fmt.Sprintf("%-32s %-10s %-8s %-10s %-16s", "NAME", "STATUS", "AGE", "SIGNATURE", "SLUG")))
 	for _, v := range victims {
-		fmt.Printf("Removing %s...\n", v.Name)
-		if err := dx.Remove(v.Name, true); err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to remove %s: %v\n", v.Name, err)
+		fmt.Fprintf(out, "%-32s %s %-8s %-10s %-16s\n", v.Name, output.Status(out, v.Status, 10), age(now, v.CreatedAt), v.Labels["com.claudex.signature"], v.Labels["com.claudex.slug"])
+		mounts, err := containers.MountsFromLabel(&v)
+		if err != nil {
+			fmt.Fprintf(out, "    mounts: unknown (%v)\n", err)
+			continue
+		}
+		for _, m := range mounts {
+			fmt.Fprintf(out, "    mounts: %s\n", m)
 		}
 	}
-	return nil
 }
 
-// Push copies local files/dirs into /workspace of a running container.
+// age is a compact "how long ago" for tables: 45s, 12m, 5h, 3d.
+func age(now, t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	d := now.Sub(t)
+	switch {
+	case d < 0:
+		return "0s"
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
+
+// skipProtected drops protected containers from victims, saying so.
+func skipProtected(victims []dockerx.Container, out io.Writer) []dockerx.Container {
+	var keep []dockerx.Container
+	for _, v := range victims {
+		if run.Protected(&v) {
+			fmt.Fprintf(out, "Skipping protected container %s (pass --force-protected, or lift it with claudex protect --off)\n", v.Name)
+			continue
+		}
+		keep = append(keep, v)
+	}
+	return keep
+}
+
+// survivorsOf returns the containers in all that are not in victims.
+func survivorsOf(all, victims []dockerx.Container) []dockerx.Container {
+	gone := map[string]bool{}
+	for _, v := range victims {
+		gone[v.Name] = true
+	}
+	var res []dockerx.Container
+	for _, c := range all {
+		if !gone[c.Name] {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// notifyRemoved sends one destroy notification per container, or a single
+// gc notification for --prune-stopped.
+func notifyRemoved(names []string, gc bool, errOut io.Writer) {
+	if len(names) == 0 {
+		return
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return
+	}
+	if gc {
+		notify.Emit(cfg.Notifications, notify.Event{
+			Kind:    notify.GC,
+			Message: fmt.Sprintf("pruned %d stopped container(s): %s", len(names), strings.Join(names, ", ")),
+		}, errOut)
+		return
+	}
+	for _, n := range names {
+		notify.Emit(cfg.Notifications, notify.Event{Kind: notify.Destroy, Container: n, Message: "destroyed " + n}, errOut)
+	}
+}
+
+// markRemoved records destroyed containers in the state store so their history survives.
+func markRemoved(names []string, errOut io.Writer) {
+	if len(names) == 0 {
+		return
+	}
+	now := time.Now()
+	err := state.Update(func(s *state.Store) error {
+		for _, n := range names {
+			s.MarkRemoved(n, now)
+			_ = run.RemoveHostGitCopies(n)
+		}
+		return nil
+	})
+	if err != nil {
+		output.Warnf(errOut, "unable to update session state: %v\n", err)
+	}
+}
+
+// Push copies local files/dirs into /workspace (or --to) of a running container.
 func Push(args []string) error {
-	var nameFlag string
+	return pushWithDocker(dockerx.New(), args, os.Stdout)
+}
+
+func pushWithDocker(dx dockerx.Docker, args []string, out io.Writer) error {
+	var t targetSpec
+	var to string
 	var paths []string
 	for i := 0; i < len(args); i++ {
 		a := args[i]
+		if ok, err := t.flag(args, &i); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
 		switch a {
-		case "--name":
+		case "--to":
 			if i+1 >= len(args) {
-				return fmt.Errorf("--name requires a value")
+				return fmt.Errorf("--to requires a container directory")
 			}
-			nameFlag = args[i+1]
+			to = args[i+1]
 			i++
 		default:
 			paths = append(paths, a)
 		}
 	}
 	if len(paths) == 0 {
-		return fmt.Errorf("usage: claudex push [--name <NAME>] <file_or_dir> [...]")
+		return fmt.Errorf("usage: claudex push [--name <NAME> | --signature <HASH> | --last] [--to <DIR>] <file_or_dir> [...]")
 	}
 
-	dx := &dockerx.CLI{}
-	target, err := pickRunning(dx, nameFlag)
+	target, err := t.resolve(dx, true)
 	if err != nil {
 		return err
 	}
+	destDir := pushDest(to)
+	if destDir != "/workspace/" {
+		if err := dx.Exec(target, "mkdir", "-p", destDir); err != nil {
+			return fmt.Errorf("cannot create %s in %s: %w", destDir, target, err)
+		}
+	}
 
 	for _, p := range paths {
-		abs, err := filepath.Abs(p)
+		src, err := pushSource(p)
 		if err != nil {
-			return fmt.Errorf("invalid path: %s", p)
-		}
-		if _, err := os.Stat(abs); err != nil {
-			return fmt.Errorf("'%s' does not exist", abs)
+			return err
 		}
-		dest := fmt.Sprintf("%s:/workspace/", target)
-		fmt.Printf("Pushing %s -> %s\n", abs, dest)
-		if err := dx.CP(abs, dest); err != nil {
-			return fmt.Errorf("docker cp failed for %s: %w", abs, err)
+		dest := fmt.Sprintf("%s:%s", target, destDir)
+		fmt.Fprintf(out, "Pushing %s -> %s\n", src, dest)
+		if err := dx.CP(src, dest); err != nil {
+			return fmt.Errorf("docker cp failed for %s: %w", src, err)
 		}
 	}
 	return nil
 }
 
+// pushDest resolves --to against /workspace and returns it with a trailing slash.
+func pushDest(to string) string {
+	if to == "" {
+		return "/workspace/"
+	}
+	if !path.IsAbs(to) {
+		to = path.Join("/workspace", to)
+	}
+	return strings.TrimSuffix(path.Clean(to), "/") + "/"
+}
+
+// pushSource resolves a host path to copy. A trailing "/." is kept so docker
+// cp copies the directory's contents rather than the directory itself.
+func pushSource(p string) (string, error) {
+	contents := strings.HasSuffix(filepath.ToSlash(p), "/.")
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", fmt.Errorf("invalid path: %s", p)
+	}
+	fi, err := os.Stat(abs)
+	if err != nil {
+		return "", fmt.Errorf("'%s' does not exist", abs)
+	}
+	if contents {
+		if !fi.IsDir() {
+			return "", fmt.Errorf("'%s' is not a directory", abs)
+		}
+		return abs + string(filepath.Separator) + ".", nil
+	}
+	return abs, nil
+}
+
 // Pull copies from container to local destination. If no path provided, runs interactive selection.
-// Usage: claudex pull [--name <NAME>] <container_path> [dest_dir (default /tmp)]
+// Usage: claudex pull [--name <NAME> | --signature <HASH> | --last] [--force] [--stage <DIR>] [--json] <container_path> [dest_dir (default /tmp)]
 func Pull(args []string) error {
-	var nameFlag string
+	return pullWithDocker(dockerx.New(), args, stdStreams())
+}
+
+func pullWithDocker(dx dockerx.Docker, args []string, s Streams) error {
+	var t targetSpec
+	var stageDir string
+	var force, asJSON bool
 	var rest []string
 	for i := 0; i < len(args); i++ {
 		a := args[i]
+		if ok, err := t.flag(args, &i); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
 		switch a {
-		case "--name":
+		case "--force":
+			force = true
+		case "--json":
+			asJSON = true
+		case "--stage":
 			if i+1 >= len(args) {
-				return fmt.Errorf("--name requires a value")
+				return fmt.Errorf("--stage requires a directory")
 			}
-			nameFlag = args[i+1]
+			stageDir = args[i+1]
 			i++
 		default:
 			rest = append(rest, a)
 		}
 	}
+	if asJSON && len(rest) == 0 {
+		return fmt.Errorf("--json cannot browse the workspace; name the container path to pull")
+	}
 
-	dx := &dockerx.CLI{}
-	target, err := pickRunning(dx, nameFlag)
+	t.prompt = s.Prompt
+	target, err := t.resolve(dx, true)
 	if err != nil {
 		return err
 	}
 
 	if len(rest) == 0 {
-		// interactive
-		entries, err := ui.ListWorkspaceEntries(dx, target)
-		if err != nil {
-			return err
-		}
-		if len(entries) == 0 {
-			return fmt.Errorf("no files available under /workspace in container %s", target)
-		}
-		reader := bufio.NewReader(os.Stdin)
-		selections, err := ui.PromptForWorkspaceSelection(reader, entries)
+		// interactive: browse /workspace recursively
+		selections, err := ui.BrowseWorkspace(s.Prompt, s.Out, dx, target)
 		if err != nil {
 			return err
 		}
 		if len(selections) == 0 {
-			fmt.Println("No selections made; aborting pull.")
+			fmt.Fprintln(s.Out, "No selections made; aborting pull.")
 			return nil
 		}
-		destDir, err := ui.PromptForDestination(reader)
+		destDir, err := ui.PromptForDestination(s.Prompt)
 		if err != nil {
 			return err
 		}
-		if err := os.MkdirAll(destDir, 0755); err != nil {
-			return fmt.Errorf("cannot ensure destination %s: %v", destDir, err)
-		}
+		var srcs []string
 		for _, entry := range selections {
-			src := fmt.Sprintf("%s:/workspace/%s", target, entry)
-			fmt.Printf("Pulling %s -> %s\n", src, destDir)
-			if err := dx.CP(src, destDir); err != nil {
-				return fmt.Errorf("docker cp failed for %s: %w", entry, err)
-			}
+			srcs = append(srcs, fmt.Sprintf("%s:%s", target, entry))
 		}
-		return nil
+		_, err = pullInto(dx, srcs, ui.WorkspaceRoot, destDir, stageDir, force, s.Out)
+		return err
 	}
 
 	// direct mode
@@ -462,66 +1090,14 @@ func Pull(args []string) error {
 	if len(rest) >= 2 {
 		destDir = rest[1]
 	}
-	if err := os.MkdirAll(destDir, 0755); err != nil {
-		return fmt.Errorf("cannot ensure destination %s: %v", destDir, err)
-	}
-	src := fmt.Sprintf("%s:%s", target, containerPath)
-	fmt.Printf("Pulling %s -> %s\n", src, destDir)
-	if err := dx.CP(src, destDir); err != nil {
-		return fmt.Errorf("docker cp failed: %w", err)
-	}
-	return nil
-}
-
-// pickRunning returns a running container name by explicit value or unique running instance.
-func pickRunning(dx dockerx.Docker, name string) (string, error) {
-	if name != "" {
-		ok, running, _, err := containers.Exists(dx, name)
-		if err != nil {
-			return "", err
-		}
-		if !ok || !running {
-			return "", fmt.Errorf("container %s is not running", name)
-		}
-		return name, nil
+	srcs := []string{fmt.Sprintf("%s:%s", target, containerPath)}
+	if !asJSON {
+		_, err = pullInto(dx, srcs, "", destDir, stageDir, force, s.Out)
+		return err
 	}
-	cons, err := containers.List(dx, false)
+	res, err := pullInto(dx, srcs, "", destDir, stageDir, force, s.Err)
 	if err != nil {
-		return "", err
-	}
-	if len(cons) == 0 {
-		return "", fmt.Errorf("no running claudex containers. Start one first.")
-	}
-	if len(cons) == 1 {
-		return cons[0].Name, nil
-	}
-	// Interactive selection when TTY is available; otherwise, return error with choices
-	if ui.StdinIsTTY() {
-		fmt.Println("Select a target container:")
-		for i, c := range cons {
-			sig := c.Labels["com.claudex.signature"]
-			slug := c.Labels["com.claudex.slug"]
-			created := c.CreatedAt.Format("2006-01-02 15:04:05")
-			fmt.Printf("  [%d] %s  (%s  %s  %s)\n", i+1, c.Name, c.Status, created, slug+":"+sig)
-		}
-		fmt.Print("Enter number: ")
-		reader := bufio.NewReader(os.Stdin)
-		line, _ := reader.ReadString('\n')
-		line = strings.TrimSpace(line)
-		idx, err := strconv.Atoi(line)
-		if line == "" || err != nil || idx < 1 || idx > len(cons) {
-			// Fall back to non-interactive error message with choices
-			var names []string
-			for _, c := range cons {
-				names = append(names, c.Name)
-			}
-			return "", fmt.Errorf("multiple running claudex containers. Specify --name. Choices: %s", strings.Join(names, ", "))
-		}
-		return cons[idx-1].Name, nil
-	}
-	var names []string
-	for _, c := range cons {
-		names = append(names, c.Name)
+		return err
 	}
-	return "", fmt.Errorf("multiple running claudex containers. Specify --name. Choices: %s", strings.Join(names, ", "))
+	return writeJSON(s.Out, res)
 }
@@ -1,45 +1,69 @@
 package commands
 
 import (
+	"bufio"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
-	"claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/agent"
+	"github.com/photodialectic/claudex/internal/config"
+	"github.com/photodialectic/claudex/internal/containers"
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/output"
+	"github.com/photodialectic/claudex/internal/policy"
+	"github.com/photodialectic/claudex/internal/queue"
+	"github.com/photodialectic/claudex/internal/run"
+	"github.com/photodialectic/claudex/internal/state"
+	"github.com/photodialectic/claudex/internal/ui"
 )
 
-func TestPickRunning_ByNameAndStatus(t *testing.T) {
+// scripted is Streams whose prompts read answers, one per line.
+func scripted(answers string, out, errOut io.Writer) Streams {
+	return Streams{Out: out, Err: errOut, Prompt: ui.NewPrompter(strings.NewReader(answers), out, false)}
+}
+
+func TestResolveRunning_ByNameAndStatus(t *testing.T) {
 	f := &dockerx.Fake{Containers: map[string]dockerx.Container{}}
 	// running container
 	f.Containers["r1"] = dockerx.Container{Name: "r1", Status: "running", Labels: map[string]string{"com.claudex.signature": "x"}}
 	// stopped container
 	f.Containers["s1"] = dockerx.Container{Name: "s1", Status: "exited", Labels: map[string]string{"com.claudex.signature": "x"}}
 
-	if name, err := pickRunning(f, "r1"); err != nil || name != "r1" {
+	if name, err := (targetSpec{Name: "r1"}).resolve(f, true); err != nil || name != "r1" {
 		t.Fatalf("expected r1, got %q err=%v", name, err)
 	}
-	if _, err := pickRunning(f, "s1"); err == nil || !strings.Contains(err.Error(), "not running") {
+	if _, err := (targetSpec{Name: "s1"}).resolve(f, true); err == nil || !strings.Contains(err.Error(), "not running") {
 		t.Fatalf("expected not running error, got %v", err)
 	}
 }
 
-func TestPickRunning_AutoSelectionCases(t *testing.T) {
+func TestResolveRunning_AutoSelectionCases(t *testing.T) {
 	f := &dockerx.Fake{Containers: map[string]dockerx.Container{}}
 
 	// No running containers
-	if _, err := pickRunning(f, ""); err == nil || !strings.Contains(err.Error(), "no running claudex containers") {
+	if _, err := (targetSpec{Name: ""}).resolve(f, true); err == nil || !strings.Contains(err.Error(), "no running claudex containers") {
 		t.Fatalf("expected no running error, got %v", err)
 	}
 
 	// One running container
 	f.Containers["only"] = dockerx.Container{Name: "only", Status: "running", Labels: map[string]string{"com.claudex.signature": "x"}}
-	if name, err := pickRunning(f, ""); err != nil || name != "only" {
+	if name, err := (targetSpec{Name: ""}).resolve(f, true); err != nil || name != "only" {
 		t.Fatalf("expected auto-pick 'only', got %q err=%v", name, err)
 	}
 
 	// Multiple running containers
 	f.Containers["another"] = dockerx.Container{Name: "another", Status: "running", Labels: map[string]string{"com.claudex.signature": "x"}}
-	if _, err := pickRunning(f, ""); err == nil || !strings.Contains(err.Error(), "multiple running claudex containers") {
+	if _, err := (targetSpec{Name: ""}).resolve(f, true); err == nil || !strings.Contains(err.Error(), "multiple running claudex containers") {
 		t.Fatalf("expected multiple running error, got %v", err)
 	}
 
@@ -48,7 +72,7 @@ func TestPickRunning_AutoSelectionCases(t *testing.T) {
 
 func TestUpdateWithDockerSetsRefreshToken(t *testing.T) {
 	f := &dockerx.Fake{}
-	if err := updateWithDocker(f, nil); err != nil {
+	if err := updateWithDocker(f, nil, scripted("", io.Discard, io.Discard)); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	if f.BuildTag != "claudex" {
@@ -61,11 +85,14 @@ func TestUpdateWithDockerSetsRefreshToken(t *testing.T) {
 	if f.BuildOpts.NoCache {
 		t.Fatalf("expected NoCache to be false")
 	}
+	if f.BuildContext != "-" || len(f.BuildContextData) == 0 {
+		t.Fatalf("expected embedded context streamed on stdin, got dir %q with %d bytes", f.BuildContext, len(f.BuildContextData))
+	}
 }
 
 func TestUpdateWithDockerNoCacheFlag(t *testing.T) {
 	f := &dockerx.Fake{}
-	if err := updateWithDocker(f, []string{"--no-cache"}); err != nil {
+	if err := updateWithDocker(f, []string{"--no-cache"}, scripted("", io.Discard, io.Discard)); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	if !f.BuildOpts.NoCache {
@@ -73,9 +100,1859 @@ func TestUpdateWithDockerNoCacheFlag(t *testing.T) {
 	}
 }
 
+func TestUpdateWithDockerKeepsSlim(t *testing.T) {
+	f := &dockerx.Fake{ImageLabelsOut: map[string]map[string]string{"claudex": {SlimLabel: "1"}}}
+	if err := updateWithDocker(f, nil, scripted("", io.Discard, io.Discard)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.BuildOpts.BuildArgs["CLAUDEX_SLIM"] != "1" || f.BuildOpts.BuildArgs["BASE_IMAGE"] != "node:22-slim" {
+		t.Fatalf("update should keep the slim flavor: %+v", f.BuildOpts.BuildArgs)
+	}
+}
+
 func TestUpdateWithDockerUnknownFlag(t *testing.T) {
 	f := &dockerx.Fake{}
-	if err := updateWithDocker(f, []string{"--bogus"}); err == nil || !strings.Contains(err.Error(), "unknown arg") {
+	if err := updateWithDocker(f, []string{"--bogus"}, scripted("", io.Discard, io.Discard)); err == nil || !strings.Contains(err.Error(), "unknown arg") {
 		t.Fatalf("expected unknown arg error, got %v", err)
 	}
 }
+
+func TestMatchFilters(t *testing.T) {
+	c := dockerx.Container{Name: "claudex-app-abcd", Labels: map[string]string{"com.claudex.signature": "abcd", "com.claudex.slug": "app"}}
+	cases := []struct {
+		filters map[string]string
+		want    bool
+	}{
+		{map[string]string{}, true},
+		{map[string]string{"name": "claudex-*"}, true},
+		{map[string]string{"name": "other-*"}, false},
+		{map[string]string{"signature": "abcd", "slug": "a*"}, true},
+		{map[string]string{"signature": "nope"}, false},
+		{map[string]string{"slug": ""}, false},
+	}
+	for _, tc := range cases {
+		got, err := matchFilters(c, tc.filters)
+		if err != nil || got != tc.want {
+			t.Errorf("matchFilters(%v) = %v, %v; want %v", tc.filters, got, err, tc.want)
+		}
+	}
+	if _, err := matchFilters(c, map[string]string{"name": "["}); err == nil {
+		t.Errorf("expected invalid pattern error")
+	}
+}
+
+func TestLastAttachedSkipsMissingContainers(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	now := time.Now()
+	err := state.Update(func(s *state.Store) error {
+		s.Upsert(state.Session{Name: "gone", LastAttached: now})
+		s.Upsert(state.Session{Name: "alive", LastAttached: now.Add(-time.Hour)})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed state: %v", err)
+	}
+	f := &dockerx.Fake{Containers: map[string]dockerx.Container{"alive": {Name: "alive", Status: "exited"}}}
+	name, err := lastAttached(f, false)
+	if err != nil || name != "alive" {
+		t.Fatalf("lastAttached = %q, %v", name, err)
+	}
+}
+
+func TestBulkStopBySelector(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	f := &dockerx.Fake{Containers: map[string]dockerx.Container{
+		"claudex-a": {Name: "claudex-a", Status: "running", Labels: map[string]string{"com.claudex.slug": "team-a", "com.claudex.signature": "s1"}},
+		"claudex-b": {Name: "claudex-b", Status: "running", Labels: map[string]string{"com.claudex.slug": "team-b", "com.claudex.signature": "s2"}},
+		"claudex-c": {Name: "claudex-c", Status: "exited", Labels: map[string]string{"com.claudex.slug": "team-a", "com.claudex.signature": "s3"}},
+	}}
+	if err := bulkWithDocker(f, "stop", []string{"--selector", "slug=team-a"}, scripted("", io.Discard, io.Discard)); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if len(f.StopCalls) != 1 || f.StopCalls[0] != "claudex-a" {
+		t.Fatalf("StopCalls = %v", f.StopCalls)
+	}
+	if err := bulkWithDocker(f, "start", []string{"--selector", "slug=team-*"}, scripted("", io.Discard, io.Discard)); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if len(f.StartCalls) != 1 || f.StartCalls[0] != "claudex-c" {
+		t.Fatalf("StartCalls = %v", f.StartCalls)
+	}
+	if err := bulkWithDocker(f, "stop", nil, scripted("", io.Discard, io.Discard)); err == nil {
+		t.Fatalf("expected error without a target")
+	}
+}
+
+func TestBulkSkipsOtherUsersContainers(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("USER", "alice")
+	f := &dockerx.Fake{Containers: map[string]dockerx.Container{
+		"mine":   {Name: "mine", Status: "running", Labels: map[string]string{"com.claudex.signature": "s1", run.OwnerLabel: "alice"}},
+		"theirs": {Name: "theirs", Status: "running", Labels: map[string]string{"com.claudex.signature": "s2", run.OwnerLabel: "bob"}},
+	}}
+	if err := bulkWithDocker(f, "stop", []string{"--all"}, scripted("", io.Discard, io.Discard)); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if len(f.StopCalls) != 1 || f.StopCalls[0] != "mine" {
+		t.Fatalf("StopCalls = %v", f.StopCalls)
+	}
+	var out strings.Builder
+	if err := bulkWithDocker(f, "stop", []string{"--name", "theirs"}, scripted("", &out, &out)); err != nil || len(f.StopCalls) != 1 || !strings.Contains(out.String(), "belongs to bob") {
+		t.Fatalf("stopped another user's container by name: %v %v\n%s", err, f.StopCalls, out.String())
+	}
+	if err := bulkWithDocker(f, "stop", []string{"--all", "--all-users"}, scripted("", io.Discard, io.Discard)); err != nil || len(f.StopCalls) != 3 {
+		t.Fatalf("--all-users: %v %v", err, f.StopCalls)
+	}
+}
+
+func TestDiffTreesAndApplyPull(t *testing.T) {
+	staged, dest := t.TempDir(), t.TempDir()
+	write := func(root, rel, body string) {
+		p := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(staged, "out/new.txt", "new")
+	write(staged, "out/same.txt", "same")
+	write(staged, "out/changed.txt", "container")
+	write(dest, "out/same.txt", "same")
+	write(dest, "out/changed.txt", "local")
+	write(dest, "out/local-only.txt", "mine")
+	write(dest, "unrelated.txt", "x")
+	if err := os.MkdirAll(filepath.Join(staged, "out", "logs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := diffTrees(staged, dest)
+	if err != nil {
+		t.Fatalf("diffTrees: %v", err)
+	}
+	if len(d.Added) != 2 || d.Added[0] != filepath.Join("out", "logs")+dirSuffix || d.Added[1] != filepath.Join("out", "new.txt") ||
+		len(d.Modified) != 1 || d.Modified[0] != filepath.Join("out", "changed.txt") ||
+		len(d.Deleted) != 1 || d.Deleted[0] != filepath.Join("out", "local-only.txt") || d.Unchanged != 1 {
+		t.Fatalf("unexpected diff: %+v", d)
+	}
+	if err := applyPull(staged, dest, d); err != nil {
+		t.Fatalf("applyPull: %v", err)
+	}
+	for rel, want := range map[string]string{"out/new.txt": "new", "out/changed.txt": "container", "out/local-only.txt": "mine"} {
+		if b, _ := os.ReadFile(filepath.Join(dest, rel)); string(b) != want {
+			t.Errorf("%s = %q, want %q", rel, b, want)
+		}
+	}
+	if fi, err := os.Stat(filepath.Join(dest, "out", "logs")); err != nil || !fi.IsDir() {
+		t.Errorf("empty dir not pulled: %v", err)
+	}
+}
+
+func TestPullKeepsNestedPaths(t *testing.T) {
+	stage := filepath.Join(t.TempDir(), "stage")
+	f := &dockerx.Fake{}
+	srcs := []string{"c:/workspace/app/build/app.bin", "c:/workspace/README.md"}
+	if _, err := pullInto(f, srcs, "/workspace", t.TempDir(), stage, false, io.Discard); err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+	want := [][2]string{{srcs[0], filepath.Join(stage, "app", "build")}, {srcs[1], stage}}
+	if !reflect.DeepEqual(f.CPCalls, want) {
+		t.Fatalf("CPCalls = %v, want %v", f.CPCalls, want)
+	}
+}
+
+func TestPullNeverReplacesDirs(t *testing.T) {
+	staged, dest := t.TempDir(), t.TempDir()
+	os.WriteFile(filepath.Join(staged, "build"), []byte("file"), 0644)
+	os.MkdirAll(filepath.Join(dest, "build", "keep"), 0755)
+	os.WriteFile(filepath.Join(dest, "build", "keep", "x"), []byte("mine"), 0644)
+	if _, err := finishPull(staged, dest, "", true, io.Discard); err == nil || !strings.Contains(err.Error(), "is a directory") {
+		t.Fatalf("expected --force to refuse replacing a dir, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "build", "keep", "x")); err != nil {
+		t.Fatalf("local dir was touched: %v", err)
+	}
+}
+
+func TestFreshStageDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "stage")
+	if err := freshStageDir(dir); err != nil {
+		t.Fatalf("new dir: %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "old.txt"), []byte("x"), 0644)
+	if err := freshStageDir(dir); err == nil || !strings.Contains(err.Error(), "not empty") {
+		t.Fatalf("expected a reused stage dir to be refused, got %v", err)
+	}
+}
+
+func TestPushToSubdirAndContents(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f := &dockerx.Fake{Containers: map[string]dockerx.Container{"c": {Name: "c", Status: "running", Labels: map[string]string{"com.claudex.signature": "s"}}}}
+	if err := pushWithDocker(f, []string{"--name", "c", "--to", "service/app/config", file, dir + "/."}, io.Discard); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if len(f.ExecCalls) != 1 || strings.Join(f.ExecCalls[0], " ") != "c mkdir -p /workspace/service/app/config/" {
+		t.Fatalf("ExecCalls = %v", f.ExecCalls)
+	}
+	want := [][2]string{
+		{file, "c:/workspace/service/app/config/"},
+		{dir + string(filepath.Separator) + ".", "c:/workspace/service/app/config/"},
+	}
+	if len(f.CPCalls) != 2 || f.CPCalls[0] != want[0] || f.CPCalls[1] != want[1] {
+		t.Fatalf("CPCalls = %v, want %v", f.CPCalls, want)
+	}
+	if got := pushDest("/opt/x/"); got != "/opt/x/" {
+		t.Fatalf("pushDest absolute = %q", got)
+	}
+	if _, err := pushSource(file + "/."); err == nil {
+		t.Fatalf("expected error for file/.")
+	}
+}
+
+func TestFirewallAllowAndDeny(t *testing.T) {
+	f := &dockerx.Fake{Containers: map[string]dockerx.Container{"c": {Name: "c", Status: "running", Labels: map[string]string{"com.claudex.signature": "s"}}}}
+	if err := firewallWithDocker(f, []string{"allow", "--name", "c", "*.githubusercontent.com", "pypi.org"}, scripted("", io.Discard, io.Discard)); err != nil {
+		t.Fatalf("allow: %v", err)
+	}
+	if got := strings.Join(f.ExecCalls[0], " "); got != "-u root c /usr/local/bin/init-firewall.sh --add *.githubusercontent.com --add pypi.org" {
+		t.Fatalf("allow exec = %q", got)
+	}
+	if err := firewallWithDocker(f, []string{"deny", "--name", "c", "pypi.org"}, scripted("", io.Discard, io.Discard)); err != nil {
+		t.Fatalf("deny: %v", err)
+	}
+	if got := strings.Join(f.ExecCalls[1], " "); got != "-u root c /usr/local/bin/init-firewall.sh --remove pypi.org" {
+		t.Fatalf("deny exec = %q", got)
+	}
+	for _, bad := range [][]string{{"allow", "--name", "c"}, {"allow", "--name", "c", "x;rm -rf"}, {"block", "x.com"}} {
+		if err := firewallWithDocker(f, bad, scripted("", io.Discard, io.Discard)); err == nil {
+			t.Errorf("expected error for %v", bad)
+		}
+	}
+}
+
+func TestParseAuditLogSince(t *testing.T) {
+	log := "2024-05-01T10:00:00+0000\t12\t/workspace\tgit status\n" +
+		"garbage line\n" +
+		"2024-05-01T13:30:00+0200\t13\t/workspace/app\tnpm test\n"
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	since, err := parseSince("1h", now)
+	if err != nil {
+		t.Fatalf("parseSince: %v", err)
+	}
+	got := parseAuditLog([]byte(log), since)
+	if len(got) != 1 || got[0].Command != "npm test" || got[0].Dir != "/workspace/app" {
+		t.Fatalf("parseAuditLog = %+v", got)
+	}
+	if all := parseAuditLog([]byte(log), time.Time{}); len(all) != 2 {
+		t.Fatalf("expected 2 entries without --since, got %d", len(all))
+	}
+	if week, err := parseSince("7d", now); err != nil || !week.Equal(now.AddDate(0, 0, -7)) {
+		t.Fatalf("parseSince 7d: %v %v", week, err)
+	}
+	if _, err := parseSince("yesterday", now); err == nil {
+		t.Fatalf("expected error for bad --since")
+	}
+}
+
+func TestPolicyCheckEgressProbe(t *testing.T) {
+	f := &dockerx.Fake{Containers: map[string]dockerx.Container{"c": {Name: "c", Status: "running", Labels: map[string]string{"com.claudex.signature": "s"}}}}
+	p := policy.Policy{RestrictEgress: true}
+	f.ExecOutputOut = []byte("0\n")
+	if err := policyCheck(f, p, []string{"--name", "c"}, scripted("", io.Discard, io.Discard)); err == nil {
+		t.Fatalf("expected violation when example.com is reachable")
+	}
+	f.ExecOutputOut = []byte("7\n")
+	var out strings.Builder
+	if err := policyCheck(f, p, []string{"--name", "c"}, scripted("", &out, &out)); err != nil || out.String() != "c complies with policy.\n" {
+		t.Fatalf("expected compliance, got %v %q", err, out.String())
+	}
+	// A probe that cannot tell fails closed.
+	for _, res := range []string{"missing\n", "60\n"} {
+		f.ExecOutputOut = []byte(res)
+		if err := policyCheck(f, p, []string{"--name", "c"}, scripted("", io.Discard, io.Discard)); err == nil {
+			t.Fatalf("probe result %q passed", res)
+		}
+	}
+	f.ExecOutputErr = errors.New("exec failed")
+	if err := policyCheck(f, p, []string{"--name", "c"}, scripted("", io.Discard, io.Discard)); err == nil {
+		t.Fatalf("failed probe passed")
+	}
+}
+
+func TestEventsMergesEngineAndState(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	fx := &dockerx.Fake{EventsOut: []dockerx.Event{
+		{Time: now.Add(-time.Hour), Action: "create", Name: "a"},
+		{Time: now.Add(-time.Hour + time.Second), Action: "start", Name: "a"},
+		{Time: now.Add(-30 * time.Minute), Action: "exec_start: bash", Name: "a"},
+		{Time: now.Add(-10 * time.Minute), Action: "die", Name: "b"},
+	}}
+	sessions := []state.Session{
+		{Name: "a", CreatedAt: now.Add(-time.Hour + 2*time.Second), LastAttached: now.Add(-20 * time.Minute)},
+		{Name: "old", CreatedAt: now.Add(-48 * time.Hour), RemovedAt: now.Add(-5 * time.Minute)},
+	}
+	var buf strings.Builder
+	if err := eventsWithDocker(fx, sessions, []string{"--since", "2h"}, &buf, now); err != nil {
+		t.Fatalf("events: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	var got []string
+	for _, l := range lines[1:] {
+		f := strings.Fields(l)
+		got = append(got, f[2]+"/"+f[3]+"/"+f[4])
+	}
+	want := "docker/create/a docker/start/a claudex/attach/a docker/die/b claudex/destroy/old"
+	if strings.Join(got, " ") != want {
+		t.Fatalf("events = %v, want %s", got, want)
+	}
+	if len(fx.EventsOpts) != 1 || !fx.EventsOpts[0].Until.Equal(now) || !fx.EventsOpts[0].Since.Equal(now.Add(-2*time.Hour)) {
+		t.Fatalf("unexpected engine query: %+v", fx.EventsOpts)
+	}
+}
+
+func TestRenderMetrics(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	fx := &dockerx.Fake{
+		StatsOut:       []dockerx.Stats{{Name: "a", CPUPercent: 12.5, MemoryBytes: 1 << 20}},
+		ImageCreatedAt: map[string]time.Time{"claudex": now.Add(-time.Hour)},
+	}
+	cons := []dockerx.Container{{Name: "a", Status: "running", Image: "claudex"}, {Name: "b", Status: "exited", Image: "claudex"}}
+	sessions := []state.Session{
+		{Name: "a", CreatedAt: now.Add(-2 * time.Hour), LastAttached: now.Add(-time.Minute)},
+		{Name: "gone", CreatedAt: now.Add(-3 * time.Hour), RemovedAt: now.Add(-2 * time.Hour)},
+	}
+	out := string(renderMetrics(fx, cons, sessions, now))
+	for _, want := range []string{
+		`claudex_containers{state="running"} 1`,
+		`claudex_containers{state="stopped"} 1`,
+		`claudex_container_cpu_percent{name="a"} 12.5`,
+		`claudex_container_memory_bytes{name="a"} 1048576`,
+		`claudex_image_age_seconds{image="claudex"} 3600`,
+		`claudex_session_age_seconds{name="a"} 7200`,
+		`claudex_session_idle_seconds{name="a"} 60`,
+		`claudex_session_lifetime_seconds{name="gone"} 3600`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestTaskRunsInContainer(t *testing.T) {
+	fx := &dockerx.Fake{Containers: map[string]dockerx.Container{
+		"c": {Name: "c", Status: "running", Labels: map[string]string{"com.claudex.signature": "s"}},
+	}}
+	fx.ExecStreamErr = errors.New("exit status 2")
+	tasks := map[string]config.Task{"lint": {Command: "npm run lint", Dir: "app", Env: map[string]string{"CI": "1"}}}
+	var out, errOut strings.Builder
+	if err := taskWithDocker(fx, tasks, []string{"lint"}, &out, &errOut); err == nil {
+		t.Fatalf("expected task failure to propagate")
+	}
+	want := "-w /workspace/app -e CI=1 c bash -lc npm run lint"
+	if len(fx.ExecStreamCalls) != 1 || strings.Join(fx.ExecStreamCalls[0], " ") != want {
+		t.Fatalf("exec = %v, want %s", fx.ExecStreamCalls, want)
+	}
+	if err := taskWithDocker(fx, tasks, []string{"nope"}, &out, &errOut); err == nil || !strings.Contains(err.Error(), "no task") {
+		t.Fatalf("expected unknown task error, got %v", err)
+	}
+	fx.Containers["d"] = dockerx.Container{Name: "d", Status: "running", Labels: map[string]string{"com.claudex.signature": "t"}}
+	fx.ExecStreamCalls = nil
+	if err := taskWithDocker(fx, tasks, []string{"lint", "--signature", "t"}, &out, &errOut); err == nil {
+		t.Fatalf("expected task failure to propagate")
+	}
+	if len(fx.ExecStreamCalls) != 1 || !strings.Contains(strings.Join(fx.ExecStreamCalls[0], " "), " d bash") {
+		t.Fatalf("--signature should pick d: %v", fx.ExecStreamCalls)
+	}
+}
+
+func TestParseBatchTasks(t *testing.T) {
+	tasks := parseBatchTasks("Repo uses Go.\n\n## Fix lint\nRun the linter.\n\n## Empty\n\n## Add tests\nCover parser.\n")
+	if len(tasks) != 2 || tasks[0].Title != "Fix lint" || tasks[1].Title != "Add tests" {
+		t.Fatalf("tasks = %+v", tasks)
+	}
+	if tasks[0].Prompt != "Repo uses Go.\n\nRun the linter.\n" {
+		t.Fatalf("prompt = %q", tasks[0].Prompt)
+	}
+	single := parseBatchTasks("Just do it.\n")
+	if len(single) != 1 || single[0].Prompt != "Just do it.\n" {
+		t.Fatalf("single = %+v", single)
+	}
+}
+
+func TestRunBatchTaskCollectsArtifacts(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "01-fix")
+	fx := &dockerx.Fake{ExecStreamOut: "agent output\n", ExecOutputOut: []byte("diff --git a/x b/x\n")}
+	res := runBatchTask(fx, "c", "codex", batchTask{Title: "fix", Prompt: "Fix it.\n"}, dir, 1, io.Discard)
+	if res.ExitCode != 0 || res.Container != "c" {
+		t.Fatalf("result = %+v", res)
+	}
+	for file, want := range map[string]string{"prompt.md": "Fix it.\n", "output.log": "agent output\n", "diff.patch": "diff --git a/x b/x\n"} {
+		got, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil || string(got) != want {
+			t.Fatalf("%s = %q, %v", file, got, err)
+		}
+	}
+	if len(fx.ExecCalls) != 2 || fx.ExecCalls[0][3] != batchSnapshotScript {
+		t.Fatalf("expected a workspace snapshot before the task, got %v", fx.ExecCalls)
+	}
+	// Only transcripts written since the snapshot are collected.
+	if got := fx.ExecCalls[1]; got[3] != batchTranscriptScript || got[5] != "/home/node/.codex/sessions" || got[6] != "/tmp/claudex-batch-transcripts-1" {
+		t.Fatalf("transcript staging = %v", got)
+	}
+	call := strings.Join(fx.ExecStreamCalls[0], " ")
+	if !strings.Contains(call, "PROMPT_FILE=/tmp/claudex-batch-1.md c bash -lc codex exec") {
+		t.Fatalf("exec = %s", call)
+	}
+	if len(fx.CPCalls) != 2 || fx.CPCalls[1][0] != "c:/tmp/claudex-batch-transcripts-1" || fx.CPCalls[1][1] != filepath.Join(dir, "transcripts") {
+		t.Fatalf("cp = %v", fx.CPCalls)
+	}
+}
+
+func TestBatchTearsDownContainersThatFailToComeUp(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	prompt := filepath.Join(t.TempDir(), "prompt.md")
+	if err := os.WriteFile(prompt, []byte("## One\nDo one.\n\n## Two\nDo two.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ws := t.TempDir()
+	for _, mode := range []string{"--parallel", "--keep"} {
+		fx := &dockerx.Fake{ImageExistsVal: true, Simulate: true}
+		fx.ErrFunc = func(c dockerx.Call) error {
+			if c.Method == "Run" {
+				return errors.New("no space left on device")
+			}
+			return nil
+		}
+		var out strings.Builder
+		err := batchWithDocker(fx, []string{"--agent", "codex", "--prompt-file", prompt, "--out", t.TempDir(), "--keep", mode, ws}, &out, &out)
+		if err == nil {
+			t.Fatalf("%s: expected failure", mode)
+		}
+		want := 1
+		if mode == "--parallel" {
+			want = 2
+		}
+		if got := strings.Count(out.String(), "Keeping container "); got != want {
+			t.Fatalf("%s: teardown ran %d times, want %d:\n%s", mode, got, want, out.String())
+		}
+	}
+}
+
+func TestQueueAddAndList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.json")
+	dir := t.TempDir()
+	var out strings.Builder
+	if err := queueWithDocker(&dockerx.Fake{}, path, []string{"add", dir, "--agent", "codex", "--prompt", "Fix it"}, &out, &out); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if err := queueWithDocker(&dockerx.Fake{}, path, []string{"add", "--prompt", ""}, &out, &out); err == nil {
+		t.Fatalf("expected missing prompt error")
+	}
+	out.Reset()
+	if err := queueWithDocker(&dockerx.Fake{}, path, []string{"list"}, &out, &out); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if !strings.Contains(out.String(), "pending") || !strings.Contains(out.String(), dir) || !strings.Contains(out.String(), "codex") {
+		t.Fatalf("list = %s", out.String())
+	}
+}
+
+func TestQueueRunRequeuesItemsOfAnExitedRunner(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "queue.json")
+	dir := t.TempDir()
+	err := queue.Update(path, func(s *queue.Store) error {
+		s.Add(queue.Item{Dirs: []string{dir}, Prompt: "p", Agent: "claude"})
+		s.Items[0].Status = queue.Running
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &dockerx.Fake{ImageExistsVal: true, Simulate: true}
+	var out strings.Builder
+	if err := queueWithDocker(f, path, []string{"run"}, &out, &out); err != nil {
+		t.Fatalf("run: %v\n%s", err, out.String())
+	}
+	s, _ := queue.LoadFrom(path)
+	if !strings.Contains(out.String(), "[queue 1] requeued") || s.Items[0].Status != queue.Done {
+		t.Fatalf("status %s after:\n%s", s.Items[0].Status, out.String())
+	}
+}
+
+func TestQueueSharesDir(t *testing.T) {
+	busy := map[string]bool{"/src/app": true}
+	for dir, want := range map[string]bool{"/src/app": true, "/src/app/web": true, "/src": true, "/src/api": false, "/src/application": false} {
+		if got := sharesDir([]string{dir}, busy); got != want {
+			t.Errorf("sharesDir(%s) = %v, want %v", dir, got, want)
+		}
+	}
+}
+
+func TestRollbackDefaultsToLatestCheckpoint(t *testing.T) {
+	fx := &dockerx.Fake{Containers: map[string]dockerx.Container{
+		"c": {Name: "c", Status: "running", Labels: map[string]string{"com.claudex.signature": "s"}},
+	}}
+	fx.ExecOutputFunc = func(name string, cmd []string) ([]byte, error) {
+		if len(cmd) > 3 && cmd[3] == "rollback" {
+			return []byte("/workspace/app\n"), nil
+		}
+		return []byte("cp-1\t2024-05-01 10:00:00 +0000\tfirst\ncp-2\t2024-05-01 11:00:00 +0000\tsecond\ncp-1\t2024-05-01 10:00:00 +0000\tfirst\n"), nil
+	}
+	now := time.Date(2024, 5, 2, 9, 0, 0, 0, time.UTC)
+	var out strings.Builder
+	if err := rollbackWithDocker(fx, nil, now, scripted("", &out, &out)); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	if !strings.Contains(out.String(), "Rolled back c to cp-2: /workspace/app") {
+		t.Fatalf("output:\n%s", out.String())
+	}
+	n := len(fx.ExecOutputCalls)
+	safety, last := fx.ExecOutputCalls[n-2], fx.ExecOutputCalls[n-1]
+	if safety[4] != "checkpoint" || safety[5] != "pre-rollback-20240502-090000" {
+		t.Fatalf("expected a safety checkpoint before rolling back, got %v", safety)
+	}
+	if last[len(last)-1] != "cp-2" {
+		t.Fatalf("rolled back to %v, want cp-2", last)
+	}
+	if err := checkpointWithDocker(fx, []string{"--tag", "bad name"}, time.Now(), scripted("", io.Discard, io.Discard)); err == nil {
+		t.Fatalf("expected invalid name error")
+	}
+}
+
+func TestRollbackDefaultSkipsSafetyAndAutoCheckpoints(t *testing.T) {
+	fx := &dockerx.Fake{Containers: map[string]dockerx.Container{
+		"c": {Name: "c", Status: "running", Labels: map[string]string{"com.claudex.signature": "s", run.AutoCommitLabel: "10m"}},
+	}}
+	// Two repos list their checkpoints one after the other; the newest
+	// manual one is last in the first repo's listing.
+	listing := "cp-2\t2024-05-01 11:00:00 +0000\tsecond\n" +
+		"pre-rollback-20240501-120000\t2024-05-01 12:00:00 +0000\tbefore rollback\n" +
+		"cp-1\t2024-05-01 10:00:00 +0000\tfirst\n" +
+		"auto-20240501-113000\t2024-05-01 13:30:00 +0200\tauto\n" +
+		"auto-20240501-123000\t2024-05-01 12:30:00 +0000\tauto\n"
+	cps := parseCheckpoints([]byte(listing))
+	var names []string
+	for _, cp := range cps {
+		names = append(names, strings.SplitN(cp, "\t", 2)[0])
+	}
+	if got := strings.Join(names, ","); got != "cp-1,cp-2,auto-20240501-113000,pre-rollback-20240501-120000,auto-20240501-123000" {
+		t.Fatalf("order = %s", got)
+	}
+	if got := latestCheckpoint(cps, false); got != "auto-20240501-123000" {
+		t.Fatalf("without --auto-commit: %s", got)
+	}
+	if got := latestCheckpoint(cps[:4], false); got != "auto-20240501-113000" {
+		t.Fatalf("pre-rollback picked: %s", got)
+	}
+
+	fx.ExecOutputFunc = func(name string, cmd []string) ([]byte, error) {
+		if len(cmd) > 3 && cmd[3] == "rollback" {
+			return []byte("/workspace/app\n"), nil
+		}
+		return []byte(listing), nil
+	}
+	if err := rollbackWithDocker(fx, nil, time.Now(), scripted("", io.Discard, io.Discard)); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	if last := fx.ExecOutputCalls[len(fx.ExecOutputCalls)-1]; last[len(last)-1] != "cp-2" {
+		t.Fatalf("rolled back to %v, want cp-2", last)
+	}
+	fx.ExecOutputFunc = func(name string, cmd []string) ([]byte, error) {
+		return []byte("auto-20240501-123000\t2024-05-01 12:30:00 +0000\tauto\n"), nil
+	}
+	if err := rollbackWithDocker(fx, nil, time.Now(), scripted("", io.Discard, io.Discard)); err == nil || !strings.Contains(err.Error(), "--to") {
+		t.Fatalf("expected a --to hint, got %v", err)
+	}
+}
+
+func TestHistoryBySignature(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	dir, _ := run.HistoryDir("sig1")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "bash_history"), []byte("#1700000000\nnpm test\nls -la\n"), 0600)
+	os.WriteFile(filepath.Join(dir, "zsh_history"), []byte(": 1700000000:0;npm run build\n"), 0600)
+	fx := &dockerx.Fake{Containers: map[string]dockerx.Container{"c": {Name: "c", Labels: map[string]string{"com.claudex.signature": "sig1"}}}}
+	var out strings.Builder
+	if err := historyWithDocker(fx, []string{"--name", "c", "^npm"}, &out); err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	if out.String() != "npm test\nnpm run build\n" {
+		t.Fatalf("history = %q", out.String())
+	}
+}
+
+func TestTopGroupsAgentChildren(t *testing.T) {
+	fx := &dockerx.Fake{
+		Containers: map[string]dockerx.Container{"c": {Name: "c", Status: "running"}},
+		TopOut: []dockerx.Process{
+			{PID: 1, PPID: 0, Command: "tail -f /dev/null"},
+			{PID: 10, PPID: 5, Command: "/bin/zsh -l"},
+			{PID: 11, PPID: 10, Command: "node /usr/local/share/npm-global/bin/codex"},
+			{PID: 12, PPID: 11, Command: "bash -c npm test"},
+			{PID: 13, PPID: 11, Command: "npx -y @modelcontextprotocol/server-github"},
+			{PID: 14, PPID: 10, Command: "vim README.md"},
+		},
+	}
+	var out strings.Builder
+	if err := topWithDocker(fx, []string{"--name", "c"}, &out); err != nil {
+		t.Fatalf("top: %v", err)
+	}
+	got := out.String()
+	order := []string{"AGENTS", "codex", "    bash -c npm test", "MCP SERVERS", "server-github", "SHELLS", "/bin/zsh -l", "  vim README.md", "CLAUDEX", "tail -f /dev/null"}
+	pos := 0
+	for _, want := range order {
+		i := strings.Index(got[pos:], want)
+		if i < 0 {
+			t.Fatalf("missing %q after offset %d in:\n%s", want, pos, got)
+		}
+		pos += i
+	}
+}
+
+func TestWaitRunsHookAfterAgentExits(t *testing.T) {
+	polls := 0
+	fx := &dockerx.Fake{
+		Containers: map[string]dockerx.Container{"c": {Name: "c", Status: "running"}},
+		TopFunc: func(string) ([]dockerx.Process, error) {
+			polls++
+			procs := []dockerx.Process{{PID: 1, Command: "tail -f /dev/null"}}
+			if polls < 3 {
+				procs = append(procs, dockerx.Process{PID: 7, PPID: 1, Command: "claude -p fix"})
+			}
+			return procs, nil
+		},
+	}
+	var got waitNotification
+	var out strings.Builder
+	err := waitWithDocker(fx, []string{"--name", "c", "--notify", "desktop"}, &out, func(time.Duration) {}, func(hook string, n waitNotification) error {
+		if hook != "desktop" {
+			t.Errorf("hook = %q", hook)
+		}
+		got = n
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+	if polls != 3 || got.Container != "c" || got.Waited != "agent" {
+		t.Fatalf("polls=%d notification=%+v", polls, got)
+	}
+	if err := waitWithDocker(fx, []string{"--name", "c", "--pid", "99"}, &out, func(time.Duration) {}, nil); err == nil {
+		t.Fatalf("expected an error when nothing matches")
+	}
+}
+
+func TestExportRequiresCow(t *testing.T) {
+	labels := map[string]string{"com.claudex.signature": "s", "com.claudex.mounts": `["/src/api"]`}
+	fx := &dockerx.Fake{Containers: map[string]dockerx.Container{"c": {Name: "c", Status: "running", Labels: labels}}}
+	if err := exportWithDocker(fx, []string{"--name", "c"}, scripted("", io.Discard, io.Discard)); err == nil || !strings.Contains(err.Error(), "--cow") {
+		t.Fatalf("expected bind-mounted container to be rejected, got %v", err)
+	}
+	labels[run.CowLabel] = "true"
+	stage := t.TempDir()
+	if err := exportWithDocker(fx, []string{"--name", "c", "--stage", stage, "api"}, scripted("", io.Discard, io.Discard)); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if len(fx.CPCalls) != 1 || fx.CPCalls[0] != [2]string{"c:/workspace/api/.", filepath.Join(stage, "api")} {
+		t.Fatalf("cp calls = %v", fx.CPCalls)
+	}
+}
+
+func TestSyncRequiresWorkspaceVolume(t *testing.T) {
+	dir := t.TempDir()
+	labels := map[string]string{"com.claudex.signature": "s", "com.claudex.mounts": `["` + dir + `"]`}
+	fx := &dockerx.Fake{Containers: map[string]dockerx.Container{"c": {Name: "c", Image: "claudex", Status: "running", Labels: labels}}}
+	if err := syncWithDocker(fx, []string{"--name", "c"}, scripted("", io.Discard, io.Discard)); err == nil || !strings.Contains(err.Error(), "--workspace-volume") {
+		t.Fatalf("expected bind-mounted container to be rejected, got %v", err)
+	}
+	labels[run.VolumeLabel] = "claudex-ws-s"
+	if err := syncWithDocker(fx, []string{"--name", "c", "--pull"}, scripted("", io.Discard, io.Discard)); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	got := strings.Join(fx.RunCalls[0], " ")
+	if !strings.Contains(got, "-v "+dir+":/host ") || !strings.HasSuffix(got, "/workspace/"+filepath.Base(dir)+"/ /host/") {
+		t.Fatalf("sync run = %q", got)
+	}
+}
+
+func TestUpdateSlimKeepsFlavor(t *testing.T) {
+	f := &dockerx.Fake{}
+	if err := updateWithDocker(f, []string{"--slim"}, scripted("", io.Discard, io.Discard)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.BuildOpts.BuildArgs["BASE_IMAGE"] != "node:22-slim" || f.BuildOpts.BuildArgs["CLAUDEX_SLIM"] != "1" || f.BuildOpts.BuildArgs[cliRefreshArg] == "" {
+		t.Fatalf("build args = %+v", f.BuildOpts.BuildArgs)
+	}
+	if slimBuildArgs[cliRefreshArg] != "" {
+		t.Fatalf("slim build args were modified: %+v", slimBuildArgs)
+	}
+}
+
+func TestUpdateKeepsToolchains(t *testing.T) {
+	f := &dockerx.Fake{ImageLabelsOut: map[string]map[string]string{"claudex": {ToolchainsLabel: "go=1.23,node=20"}}}
+	if err := updateWithDocker(f, []string{"--slim"}, scripted("", io.Discard, io.Discard)); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	args := f.BuildOpts.BuildArgs
+	if args["CLAUDEX_GO"] != "1.23" || args["BASE_IMAGE"] != "node:20-slim" || args["CLAUDEX_PYTHON"] != "" || f.BuildOpts.Labels[ToolchainsLabel] != "go=1.23,node=20" {
+		t.Fatalf("build opts = %+v", f.BuildOpts)
+	}
+	if err := updateWithDocker(f, []string{"--with", "python=3.12", "--with", "go=1.22"}, scripted("", io.Discard, io.Discard)); err != nil {
+		t.Fatalf("update --with: %v", err)
+	}
+	args = f.BuildOpts.BuildArgs
+	if args["CLAUDEX_PYTHON"] != "3.12" || args["CLAUDEX_GO"] != "1.22" || args["BASE_IMAGE"] != "" {
+		t.Fatalf("--with should replace the image's toolchains: %+v", args)
+	}
+	for _, bad := range []string{"rust=1.80", "go", "go=latest", "python=3.12;rm"} {
+		if _, err := parseToolchains([]string{bad}); err == nil {
+			t.Errorf("parseToolchains(%q) accepted", bad)
+		}
+	}
+}
+
+func TestUpdateKeepsImageUser(t *testing.T) {
+	f := &dockerx.Fake{ImageLabelsOut: map[string]map[string]string{"claudex": {run.UserLabel: "dev", run.UIDLabel: "1234", run.SudoLabel: "0"}}}
+	if err := updateWithDocker(f, nil, scripted("", io.Discard, io.Discard)); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	args := f.BuildOpts.BuildArgs
+	if args["CLAUDEX_USER"] != "dev" || args["CLAUDEX_UID"] != "1234" || args["CLAUDEX_SUDO"] != "0" {
+		t.Fatalf("build args = %+v", args)
+	}
+	if err := updateWithDocker(f, []string{"--uid", "2000"}, scripted("", io.Discard, io.Discard)); err != nil {
+		t.Fatalf("update --uid: %v", err)
+	}
+	args = f.BuildOpts.BuildArgs
+	if args["CLAUDEX_USER"] != "node" || args["CLAUDEX_UID"] != "2000" || args["CLAUDEX_SUDO"] != "1" {
+		t.Fatalf("flags should replace the image's user: %+v", args)
+	}
+	f = &dockerx.Fake{}
+	if err := updateWithDocker(f, nil, scripted("", io.Discard, io.Discard)); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if _, ok := f.BuildOpts.BuildArgs["CLAUDEX_USER"]; ok {
+		t.Fatalf("default user should use the Dockerfile defaults: %+v", f.BuildOpts.BuildArgs)
+	}
+	for _, bad := range [][]string{{"--user", "root"}, {"--user", "Dev"}, {"--user", "a;b"}, {"--uid", "0"}, {"--uid", "x"}, {"--uid"}} {
+		if err := updateWithDocker(f, bad, scripted("", io.Discard, io.Discard)); err == nil {
+			t.Errorf("update %q accepted", bad)
+		}
+	}
+}
+
+func TestImageReportLargestLayersFirst(t *testing.T) {
+	f := &dockerx.Fake{HistoryOut: map[string][]dockerx.Layer{"claudex": {
+		{ID: "a", Size: 1 << 20, CreatedBy: "/bin/sh -c #(nop) COPY file:abc in /workspace"},
+		{ID: "b", Size: 3 << 30, CreatedBy: "RUN /bin/sh -c apt-get update &&   apt-get install -y docker-ce"},
+		{ID: "c", Size: 0, CreatedBy: "ENV TZ="},
+	}}}
+	var out strings.Builder
+	if err := imageWithDocker(f, []string{"report"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	got := out.String()
+	if !strings.Contains(got, "3.0GiB in 3 layers") || strings.Index(got, "docker-ce") > strings.Index(got, "COPY file:abc") || strings.Contains(got, "ENV TZ") {
+		t.Fatalf("report:\n%s", got)
+	}
+}
+
+func TestUpdatePruneOldRemovesSupersededImages(t *testing.T) {
+	f := &dockerx.Fake{ImagesOut: []dockerx.Image{
+		{ID: "sha256:aaaaaaaaaaaaaaaa", Repository: "claudex", Tag: "latest", Size: 3e9},
+		{ID: "sha256:bbbbbbbbbbbbbbbb", Repository: "<none>", Tag: "<none>", Size: 2e9},
+	}}
+	if err := updateWithDocker(f, []string{"--prune-old"}, scripted("", io.Discard, io.Discard)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(f.RunCalls) != 1 || strings.Join(f.RunCalls[0], " ") != "rmi sha256:bbbbbbbbbbbbbbbb" {
+		t.Fatalf("run calls = %v", f.RunCalls)
+	}
+	var out strings.Builder
+	if err := imagesWithDocker(f, []string{"list"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "claudex:latest") || !strings.Contains(out.String(), "<superseded>") {
+		t.Fatalf("list:\n%s", out.String())
+	}
+}
+
+func TestImagePushRecordsProvenance(t *testing.T) {
+	f := &dockerx.Fake{ImagesOut: []dockerx.Image{{ID: "sha256:abc", Repository: "claudex", Tag: "latest"}}}
+	var out strings.Builder
+	if err := imagePush(f, []string{"ghcr.io/acme/claudex:v1"}, &out, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	if f.BuildTag != "ghcr.io/acme/claudex:v1" || string(f.BuildContextData) != "FROM claudex\n" {
+		t.Fatalf("build %q from %q", f.BuildTag, f.BuildContextData)
+	}
+	l := f.BuildOpts.Labels
+	if l[SourceImageLabel] != "sha256:abc" || l[PublishedAtLabel] != "2026-10-01T00:00:00Z" || l[PublishedByLabel] == "" {
+		t.Fatalf("labels = %v", l)
+	}
+	if len(f.StreamCalls) != 1 || strings.Join(f.StreamCalls[0], " ") != "push ghcr.io/acme/claudex:v1" {
+		t.Fatalf("stream calls = %v", f.StreamCalls)
+	}
+}
+
+func TestImagePullTagsLocally(t *testing.T) {
+	ref := "ghcr.io/acme/claudex:v1"
+	f := &dockerx.Fake{ImageLabelsOut: map[string]map[string]string{ref: {PublishedByLabel: "ana@laptop", PublisherCLILabel: "0.0.1"}}}
+	var out strings.Builder
+	if err := imagePull(f, []string{ref}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.RunCalls) != 1 || strings.Join(f.RunCalls[0], " ") != "tag "+ref+" claudex" {
+		t.Fatalf("run calls = %v", f.RunCalls)
+	}
+	if !strings.Contains(out.String(), "Published by ana@laptop") || !strings.Contains(out.String(), "published with claudex 0.0.1") {
+		t.Fatalf("output:\n%s", out.String())
+	}
+}
+
+func TestUpSeparateBringsUpOneContainerPerDir(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	root := t.TempDir()
+	f := &dockerx.Fake{ImageExistsVal: true, Simulate: true}
+	var dirs []string
+	for _, d := range []string{"api", "web", "worker"} {
+		p := filepath.Join(root, d)
+		if err := os.Mkdir(p, 0755); err != nil {
+			t.Fatal(err)
+		}
+		dirs = append(dirs, p)
+	}
+	var out, errOut strings.Builder
+	args := append([]string{"--separate", "--no-git"}, dirs...)
+	if err := upWithDocker(f, args, &out, &errOut); err != nil {
+		t.Fatalf("up: %v\n%s", err, errOut.String())
+	}
+	if len(f.Containers) != 3 {
+		t.Fatalf("containers = %v", f.Containers)
+	}
+	for name := range f.Containers {
+		if !strings.Contains(out.String(), name) {
+			t.Fatalf("%s missing from table:\n%s", name, out.String())
+		}
+	}
+	if strings.Count(out.String(), " ok") != 3 {
+		t.Fatalf("table:\n%s", out.String())
+	}
+	if err := upWithDocker(f, []string{"--separate", "--name", "x", dirs[0]}, &out, &errOut); err == nil || !strings.Contains(err.Error(), "--separate") {
+		t.Fatalf("expected --name to be rejected with --separate, got %v", err)
+	}
+}
+
+func TestExportComposeHidesSecrets(t *testing.T) {
+	fx := &dockerx.Fake{Containers: map[string]dockerx.Container{"c": {
+		Name: "c", Image: "claudex", Status: "running", NetworkMode: "host", CapAdd: []string{"NET_ADMIN"},
+		Labels: map[string]string{"com.claudex.signature": "s"},
+		Env:    []string{"OPENAI_API_KEY=sk-secret", "PATH=/usr/bin", "HISTFILE=/home/node/.bash_history"},
+		Mounts: []dockerx.Mount{
+			{Type: "bind", Source: "/src/app", Destination: "/workspace/app", RW: true},
+			{Type: "volume", Name: "claudex-ws-s", Destination: "/workspace"},
+		},
+	}}}
+	var out strings.Builder
+	if err := exportComposeWithDocker(fx, []string{"--name", "c"}, &out); err != nil {
+		t.Fatalf("export-compose: %v", err)
+	}
+	got := out.String()
+	if strings.Contains(got, "sk-secret") || strings.Contains(got, "PATH=") {
+		t.Fatalf("unexpected env in compose:\n%s", got)
+	}
+	for _, want := range []string{"- OPENAI_API_KEY\n", "HISTFILE=/home/node/.bash_history", "network_mode: host", "- NET_ADMIN", "source: /src/app", "claudex-ws-s:\n    external: true"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("compose missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestAdoptRecreatesWithClaudexLabels(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("USER", "ana")
+	proj, other := t.TempDir(), t.TempDir()
+	fx := &dockerx.Fake{Containers: map[string]dockerx.Container{"manual": {
+		Name: "manual", Image: "node:22", Status: "running", CapAdd: []string{"NET_ADMIN"},
+		Mounts: []dockerx.Mount{
+			{Type: "bind", Source: other, Destination: "/data", RW: true},
+			{Type: "bind", Source: proj, Destination: "/workspace/app", RW: true},
+		},
+	}}}
+	var out strings.Builder
+	// Accept the preselected /workspace mount, then confirm.
+	if err := adoptWithDocker(fx, []string{"manual"}, scripted("\ny\n", &out, &strings.Builder{})); err != nil {
+		t.Fatalf("adopt: %v", err)
+	}
+	if len(fx.RunCalls) != 3 || fx.RunCalls[0][0] != "commit" || fx.RunCalls[1][0] != "rename" {
+		t.Fatalf("run calls = %v", fx.RunCalls)
+	}
+	got := strings.Join(fx.RunCalls[2], " ")
+	for _, want := range []string{"run -d --name manual ", "-v " + other + ":/data ", "--cap-add NET_ADMIN", `com.claudex.mounts=["` + proj + `"]`, run.AdoptedLabel + "=manual", run.OwnerLabel + "=ana", "claudex-adopted:manual"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("recreate args missing %q: %s", want, got)
+		}
+	}
+	if len(fx.RemoveCalls) != 1 || !strings.HasPrefix(fx.RemoveCalls[0], "manual-recreating-") {
+		t.Fatalf("remove calls = %v", fx.RemoveCalls)
+	}
+}
+
+func TestMigrateRecreatesStaleContainers(t *testing.T) {
+	current := map[string]string{"com.claudex.signature": "a", "com.claudex.mounts": `["/src/a"]`, "com.claudex.slug": "a", containers.SchemaLabel: "1"}
+	stale := map[string]string{"com.claudex.signature": "b", "com.claudex.mounts": `["/src/b"]`}
+	fx := &dockerx.Fake{Containers: map[string]dockerx.Container{
+		"cur": {Name: "cur", Status: "running", Labels: current},
+		"old": {Name: "old", Status: "exited", Labels: stale},
+	}}
+	var out strings.Builder
+	if err := migrateWithDocker(fx, []string{"--yes"}, scripted("", &out, &strings.Builder{})); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if len(fx.RunCalls) != 3 || strings.Join(fx.RunCalls[0], " ") != "commit old claudex-migrated:old" {
+		t.Fatalf("run calls = %v", fx.RunCalls)
+	}
+	got := strings.Join(fx.RunCalls[2], " ")
+	if !strings.HasPrefix(got, "create --name old ") || !strings.Contains(got, "--label com.claudex.slug=b") || !strings.Contains(got, "--label com.claudex.schema=1") {
+		t.Fatalf("recreate args = %s", got)
+	}
+	if !strings.Contains(out.String(), "Migrated old") || strings.Contains(out.String(), "cur") {
+		t.Fatalf("output = %q", out.String())
+	}
+}
+
+func TestPkgAddInstallsAndPersists(t *testing.T) {
+	cfg := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", cfg)
+	fx := &dockerx.Fake{Containers: map[string]dockerx.Container{"c": {Name: "c", Status: "running"}}}
+	var out strings.Builder
+	if err := pkgWithDocker(fx, []string{"add", "jq", "npm:@types/node@20", "--name", "c", "--persist"}, scripted("", &out, io.Discard)); err != nil {
+		t.Fatalf("pkg add: %v", err)
+	}
+	if len(fx.ExecStreamCalls) != 2 {
+		t.Fatalf("exec calls = %v", fx.ExecStreamCalls)
+	}
+	if apt := strings.Join(fx.ExecStreamCalls[0], " "); !strings.HasPrefix(apt, "-u root c bash -c apt-get update") || !strings.HasSuffix(apt, "claudex-pkg jq") {
+		t.Fatalf("apt exec = %q", apt)
+	}
+	if npm := strings.Join(fx.ExecStreamCalls[1], " "); npm != "c npm install -g @types/node@20" {
+		t.Fatalf("npm exec = %q", npm)
+	}
+	if err := pkgWithDocker(fx, []string{"add", "apt:jq", "ripgrep", "--name", "c", "--persist"}, scripted("", &out, io.Discard)); err != nil {
+		t.Fatalf("second pkg add: %v", err)
+	}
+	overlay, err := os.ReadFile(filepath.Join(cfg, "claudex", "context", "Dockerfile.overlay"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# claudex pkg add apt:jq npm:@types/node@20\n" +
+		"USER root\nRUN apt-get update && DEBIAN_FRONTEND=noninteractive apt-get install -y --no-install-recommends jq && rm -rf /var/lib/apt/lists/*\nUSER ${CLAUDEX_USER:-node}\n" +
+		"RUN npm install -g @types/node@20\n" +
+		"# claudex pkg add apt:ripgrep\n" +
+		"USER root\nRUN apt-get update && DEBIAN_FRONTEND=noninteractive apt-get install -y --no-install-recommends ripgrep && rm -rf /var/lib/apt/lists/*\nUSER ${CLAUDEX_USER:-node}\n"
+	if string(overlay) != want {
+		t.Fatalf("overlay:\n%s", overlay)
+	}
+	for _, bad := range []string{"jq;rm", "npm:Foo Bar", "$(id)"} {
+		if err := pkgWithDocker(fx, []string{"add", bad, "--name", "c"}, scripted("", io.Discard, io.Discard)); err == nil {
+			t.Errorf("pkg add %q accepted", bad)
+		}
+	}
+}
+
+func TestIndexRebuildsAndReports(t *testing.T) {
+	fx := &dockerx.Fake{
+		Containers: map[string]dockerx.Container{"c": {Name: "c", Status: "running"}},
+		ExecOutputFunc: func(name string, cmd []string) ([]byte, error) {
+			if len(cmd) < 4 || cmd[3] != "claudex-index" {
+				return nil, fmt.Errorf("unexpected exec %v", cmd)
+			}
+			return []byte(`{"built":1700000000,"seconds":2,"files":1200,"tags":false}` + "\n"), nil
+		},
+	}
+	var out strings.Builder
+	if err := indexWithDocker(fx, []string{"c"}, &out); err != nil {
+		t.Fatalf("index: %v", err)
+	}
+	if !strings.Contains(out.String(), "Indexed 1200 files in 2s") || !strings.Contains(out.String(), "no tags") {
+		t.Fatalf("output:\n%s", out.String())
+	}
+	out.Reset()
+	if err := indexWithDocker(fx, []string{"--json", "--name", "c"}, &out); err != nil || !strings.Contains(out.String(), `"files": 1200`) {
+		t.Fatalf("--json: %v\n%s", err, out.String())
+	}
+	fx.ExecOutputFunc = func(string, []string) ([]byte, error) {
+		return []byte("an index build is already running\n"), errors.New("exit status 1")
+	}
+	if err := indexWithDocker(fx, []string{"c"}, io.Discard); err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Fatalf("concurrent build: %v", err)
+	}
+}
+
+func TestStatusAndMCPTalkToSupervisor(t *testing.T) {
+	now := time.Unix(1700000100, 0)
+	fx := &dockerx.Fake{
+		Containers: map[string]dockerx.Container{"c": {Name: "c", Status: "running"}},
+		ExecOutputFunc: func(name string, cmd []string) ([]byte, error) {
+			switch strings.Join(cmd, " ") {
+			case "claudex-agent request GET /status":
+				return []byte("HTTP/1.0 200 OK\r\nContent-Type: application/json\r\n\r\n" +
+					`{"pid":7,"started":1700000000,"heartbeat":1700000095,"uptime":100,"mcp":[{"name":"docs","pid":42,"running":false,"restarts":3}],` +
+					`"agents":[{"pid":9,"name":"codex"}],"firewall":{"active":true,"allow":["pypi.org"]},"git":[{"path":"/workspace/app","branch":"main","head":"abc1234","changed":2}],` +
+					`"index":{"built":1700000040,"seconds":3,"files":1200,"tags":true,"stale":true}}`), nil
+			case "claudex-agent request POST /mcp/docs/restart":
+				return []byte("HTTP/1.0 200 OK\r\n\r\n{\"restarting\":true}"), nil
+			case "claudex-agent request POST /mcp/nope/restart":
+				return []byte("HTTP/1.0 404 Not Found\r\n\r\nno running MCP server nope"), nil
+			}
+			return nil, fmt.Errorf("unexpected exec %v", cmd)
+		},
+	}
+	var out strings.Builder
+	if err := statusWithDocker(fx, []string{"--name", "c"}, &out, now); err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	for _, want := range []string{"supervisor pid 7, up 1m40s, heartbeat 5s ago", "Agents: codex (pid 9)", "Firewall: active, 1 allowed", "/workspace/app: main@abc1234, 2 changed", "Index: 1200 files and tags, built 1m0s ago, stale", "docs", "down", "3"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("missing %q in:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	if err := mcpWithDocker(fx, []string{"restart", "docs", "--name", "c"}, &out); err != nil || !strings.Contains(out.String(), "Restarting docs") {
+		t.Fatalf("mcp restart: %v\n%s", err, out.String())
+	}
+	var apiErr *agent.APIError
+	if err := mcpWithDocker(fx, []string{"restart", "nope", "--name", "c"}, &out); !errors.As(err, &apiErr) || apiErr.Status != 404 {
+		t.Fatalf("mcp restart of an unknown server: %v", err)
+	}
+
+	fx.ExecOutputFunc = nil
+	fx.ExecOutputErr = errors.New("exit status 1")
+	if err := statusWithDocker(fx, []string{"--name", "c"}, &out, now); !errors.Is(err, agent.ErrNoAgent) {
+		t.Fatalf("old image: %v", err)
+	}
+}
+
+func TestPortsAndForward(t *testing.T) {
+	fx := &dockerx.Fake{
+		Containers: map[string]dockerx.Container{"c": {Name: "c", Status: "running"}},
+		ExecOutputFunc: func(name string, cmd []string) ([]byte, error) {
+			return []byte("HTTP/1.0 200 OK\r\nContent-Type: application/json\r\n\r\n" +
+				`[{"port":3000,"loopback":true,"pid":42,"process":"node"},{"port":8080,"loopback":false,"pid":0,"process":""}]`), nil
+		},
+		ExecInteractiveFunc: func(name string, cmd []string, in io.Reader, out io.Writer) error {
+			line, err := bufio.NewReader(in).ReadString('\n')
+			fmt.Fprintf(out, "%s %s", strings.Join(cmd, " "), strings.ToUpper(line))
+			return err
+		},
+	}
+	var out strings.Builder
+	if err := portsWithDocker(fx, []string{"c"}, &out); err != nil {
+		t.Fatalf("ports: %v", err)
+	}
+	for _, want := range []string{"3000    loopback   42       node", "8080    all        -        -"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("missing %q in:\n%s", want, out.String())
+		}
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("cannot listen on loopback:", err)
+	}
+	local := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	done := make(chan os.Signal)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- forwardWithDocker(fx, []string{"3000", "--local", strconv.Itoa(local), "--name", "c"}, io.Discard, io.Discard, done)
+	}()
+	var conn net.Conn
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if conn, err = net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(local))); err == nil || time.Now().After(deadline) {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("dial forwarded port: %v", err)
+	}
+	fmt.Fprintln(conn, "ping")
+	reply, _ := io.ReadAll(conn)
+	conn.Close()
+	if string(reply) != "socat STDIO TCP:127.0.0.1:3000 PING\n" {
+		t.Fatalf("relayed %q", reply)
+	}
+	close(done)
+	if err := <-errc; err != nil {
+		t.Fatalf("forward: %v", err)
+	}
+	if err := forwardWithDocker(fx, []string{"--name", "c"}, io.Discard, io.Discard, done); err == nil {
+		t.Fatalf("expected forward without a port to fail")
+	}
+}
+
+func TestOpenResolvesAppsAndForwards(t *testing.T) {
+	apps := map[string]config.App{"web": {Port: 3000}, "docs": {Port: 6006, Path: "/guide?x=1"}}
+	for what, want := range map[string]string{
+		"8080":                     "http://localhost:8080/",
+		"docs":                     "http://localhost:6006/guide?x=1",
+		"http://0.0.0.0:5173/app":  "http://localhost:5173/app",
+		"https://127.0.0.1/secure": "https://localhost:443/secure",
+	} {
+		if u, err := appURL(what, apps); err != nil || u.String() != want {
+			t.Errorf("appURL(%q) = %v, %v; want %s", what, u, err, want)
+		}
+	}
+	if _, err := appURL("nope", apps); err == nil || !strings.Contains(err.Error(), "apps:") {
+		t.Fatalf("unknown app: %v", err)
+	}
+
+	fx := &dockerx.Fake{Containers: map[string]dockerx.Container{
+		"pub": {Name: "pub", Status: "running", Labels: map[string]string{run.PublishedPortsLabel: "3000"}},
+		"c":   {Name: "c", Status: "running"},
+	}}
+	var opened []string
+	browse := func(u string) error { opened = append(opened, u); return nil }
+	var out strings.Builder
+	if err := openWithDocker(fx, apps, []string{"web", "pub"}, &out, io.Discard, nil, browse); err != nil {
+		t.Fatalf("open published: %v", err)
+	}
+	if len(opened) != 1 || opened[0] != "http://localhost:3000/" || len(fx.ExecCalls) != 0 {
+		t.Fatalf("opened %v, want the published port directly", opened)
+	}
+
+	done := make(chan os.Signal)
+	close(done)
+	if err := openWithDocker(fx, apps, []string{"docs", "--name", "c", "--local", "0"}, &out, io.Discard, done, browse); err == nil {
+		t.Fatalf("expected --local 0 to be rejected")
+	}
+	if err := openWithDocker(fx, apps, []string{"docs", "--name", "c"}, &out, io.Discard, done, browse); err != nil {
+		t.Fatalf("open forwarded: %v", err)
+	}
+	if len(opened) != 2 || !strings.HasPrefix(opened[1], "http://localhost:") || !strings.HasSuffix(opened[1], "/guide?x=1") || !strings.Contains(out.String(), "to port 6006 in c") {
+		t.Fatalf("opened %v\n%s", opened, out.String())
+	}
+}
+
+func TestMCPServerTools(t *testing.T) {
+	fx := &dockerx.Fake{
+		Containers: map[string]dockerx.Container{
+			"claudex-app-1": {Name: "claudex-app-1", Status: "running", Labels: map[string]string{"com.claudex.signature": "s"}},
+		},
+		LogsOut:       []byte("claudex-agent: ready\n"),
+		ExecStreamOut: "ok 3 tests\n",
+		ExecStreamErr: errors.New("exit status 1"),
+	}
+	srv := mcpTools(fx, map[string]config.Task{"test": {Command: "npm test"}})
+	in := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"read_logs","arguments":{"tail":5}}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"run_task","arguments":{"task":"test","container":"app"}}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"list_containers"}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"pull_files","arguments":{}}}`,
+	}, "\n")
+	var out strings.Builder
+	if err := srv.Serve(strings.NewReader(in), &out); err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+	type result struct {
+		Result struct {
+			Content []struct{ Text string }
+			IsError bool
+		}
+	}
+	var results []result
+	dec := json.NewDecoder(strings.NewReader(out.String()))
+	for dec.More() {
+		var r result
+		if err := dec.Decode(&r); err != nil {
+			t.Fatalf("decode: %v\n%s", err, out.String())
+		}
+		results = append(results, r)
+	}
+	if len(results) != 4 {
+		t.Fatalf("got %d results:\n%s", len(results), out.String())
+	}
+	text := func(i int) string { return results[i].Result.Content[0].Text }
+	if text(0) != "claudex-agent: ready" || results[0].Result.IsError {
+		t.Fatalf("read_logs = %+v", results[0])
+	}
+	if !results[1].Result.IsError || !strings.Contains(text(1), "ok 3 tests") || !strings.Contains(text(1), "exit status 1") {
+		t.Fatalf("run_task = %+v", results[1])
+	}
+	if !strings.Contains(text(2), `"claudex-app-1"`) {
+		t.Fatalf("list_containers = %s", text(2))
+	}
+	if !results[3].Result.IsError || text(3) != "path is required" {
+		t.Fatalf("pull_files without a path = %+v", results[3])
+	}
+	if calls := fx.ExecStreamCalls; len(calls) != 1 || !strings.Contains(strings.Join(calls[0], " "), "npm test") {
+		t.Fatalf("exec calls = %v", calls)
+	}
+}
+
+func TestInspectMergesLabelsLineageAndSession(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	if err := state.Update(func(s *state.Store) error {
+		s.Upsert(state.Session{Name: "c", Signature: "sig", Snapshots: []string{"snap1"}})
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	fx := &dockerx.Fake{
+		Containers: map[string]dockerx.Container{"c": {Name: "c", Status: "exited", Image: "team/claudex:1", Labels: map[string]string{
+			"com.claudex.signature": "sig", "com.claudex.slug": "app", "com.claudex.mounts": `["/src/app"]`, run.AdoptedLabel: "old",
+		}}},
+		ImageLabelsOut: map[string]map[string]string{
+			"team/claudex:1": {PublishedByLabel: "ana@laptop", SourceImageLabel: "sha256:abc"},
+		},
+	}
+	var out strings.Builder
+	if err := inspectWithDocker(fx, []string{"--name", "c"}, &out); err != nil {
+		t.Fatalf("inspect: %v", err)
+	}
+	var r InspectReport
+	if err := json.Unmarshal([]byte(out.String()), &r); err != nil {
+		t.Fatalf("not JSON: %v\n%s", err, out.String())
+	}
+	c := r.Claudex
+	if r.Container.Status != "exited" || c.Slug != "app" || c.Schema != 0 || c.Current || len(c.Mounts) != 1 || c.AdoptedFrom != "old" {
+		t.Fatalf("claudex fields: %+v", c)
+	}
+	if len(c.Lineage) != 2 || c.Lineage[0].PublishedBy != "ana@laptop" || c.Lineage[1].Ref != "sha256:abc" || !c.Lineage[1].Missing {
+		t.Fatalf("lineage: %+v", c.Lineage)
+	}
+	if c.Session == nil || len(c.Session.Snapshots) != 1 {
+		t.Fatalf("session: %+v", c.Session)
+	}
+	if err := inspectWithDocker(fx, []string{"--name", "nope"}, &out); err == nil {
+		t.Fatal("inspect of a missing container succeeded")
+	}
+}
+
+func TestListSortColumnsAndTemplate(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	long := "a-container-name-well-past-thirty-two-characters"
+	fx := &dockerx.Fake{Containers: map[string]dockerx.Container{
+		"zeta": {Name: "zeta", Status: "running", CreatedAt: time.Unix(100, 0), Image: "claudex", Labels: map[string]string{"com.claudex.signature": "s1"}},
+		long:   {Name: long, Status: "exited", CreatedAt: time.Unix(200, 0), Image: "claudex", Labels: map[string]string{"com.claudex.signature": "s2"}},
+	}}
+	var out strings.Builder
+	if err := listWithDocker(fx, []string{"--all", "--sort", "name", "--columns", "name,status"}, &out); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || strings.Fields(lines[0])[1] != "STATUS" || !strings.HasPrefix(lines[1], long+" exited") || !strings.HasPrefix(lines[2], "zeta ") {
+		t.Fatalf("table:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := listWithDocker(fx, []string{"--all", "--sort", "status", "--format", "{{.Name}} {{.Signature}}"}, &out); err != nil {
+		t.Fatalf("list template: %v", err)
+	}
+	if out.String() != "zeta s1\n"+long+" s2\n" {
+		t.Fatalf("template output: %q", out.String())
+	}
+
+	for _, args := range [][]string{{"--sort", "cpu"}, {"--columns", "name,cpu"}, {"--format", "yaml"}, {"--format", "{{.Name"}} {
+		if err := listWithDocker(fx, args, &out); err == nil {
+			t.Fatalf("%v: expected an error", args)
+		}
+	}
+}
+
+func TestListAndStatusSize(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	sig := map[string]string{"com.claudex.signature": "s"}
+	fx := &dockerx.Fake{
+		Containers: map[string]dockerx.Container{
+			"small": {Name: "small", Status: "running", CreatedAt: time.Unix(100, 0), Labels: sig},
+			"big":   {Name: "big", Status: "running", CreatedAt: time.Unix(200, 0), Labels: sig, Mounts: []dockerx.Mount{{Type: "volume", Name: "ws-big"}, {Type: "bind", Source: "/src"}}},
+		},
+		DiskUsageOut: dockerx.DiskUsage{
+			Containers: map[string]int64{"small": 1 << 20, "big": 2 << 20},
+			Volumes:    map[string]int64{"ws-big": 3 << 30, "unrelated": 9 << 30},
+		},
+		ExecOutputFunc: func(name string, cmd []string) ([]byte, error) {
+			return []byte("HTTP/1.0 200 OK\r\n\r\n{\"pid\":7}"), nil
+		},
+	}
+	var out strings.Builder
+	if err := listWithDocker(fx, []string{"--size", "--sort", "size", "--format", "{{.Name}} {{.Disk.Writable}} {{.Disk.VolumeTotal}}"}, &out); err != nil {
+		t.Fatalf("list --size: %v", err)
+	}
+	if out.String() != fmt.Sprintf("big %d %d\nsmall %d 0\n", 2<<20, int64(3<<30), 1<<20) {
+		t.Fatalf("list --size output: %q", out.String())
+	}
+
+	out.Reset()
+	if err := listWithDocker(fx, []string{"--size"}, &out); err != nil || !strings.Contains(out.String(), "3.0GiB") || !strings.Contains(strings.SplitN(out.String(), "\n", 2)[0], "VOLUMES") {
+		t.Fatalf("list --size table: %v\n%s", err, out.String())
+	}
+
+	out.Reset()
+	if err := statusWithDocker(fx, []string{"--name", "big", "--size"}, &out, time.Unix(0, 0)); err != nil || !strings.Contains(out.String(), "Disk: 2.0MiB writable layer, 3.0GiB volume ws-big") {
+		t.Fatalf("status --size: %v\n%s", err, out.String())
+	}
+}
+
+func TestDestroyLinkedResourcesSkipsSurvivors(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	victim := dockerx.Container{Name: "a", Image: "claudex-migrated:a", Labels: map[string]string{run.VolumeLabel: "claudex-ws-s1"},
+		Mounts: []dockerx.Mount{{Type: "volume", Name: "claudex-ws-s1"}, {Type: "volume", Name: "claudex-cache-a"}, {Type: "volume", Name: "mine"}}}
+	clone := dockerx.Container{Name: "b", Image: "claudex", Labels: map[string]string{run.VolumeLabel: "claudex-ws-s1"}}
+	fx := &dockerx.Fake{ImageExistsVal: true}
+	vols, images := linkedResources(fx, []dockerx.Container{victim}, []dockerx.Container{clone}, true, true)
+	if strings.Join(vols, ",") != "claudex-cache-a" {
+		t.Fatalf("volumes: %v", vols)
+	}
+	if strings.Join(images, ",") != "claudex-adopted:a,claudex-migrated:a,claudex-relabeled:a" {
+		t.Fatalf("images: %v", images)
+	}
+	var out, errOut strings.Builder
+	removeLinked(fx, vols, images, &out, &errOut)
+	if len(fx.RunCalls) != 4 || strings.Join(fx.RunCalls[0], " ") != "volume rm claudex-cache-a" || strings.Join(fx.RunCalls[2], " ") != "rmi claudex-migrated:a" {
+		t.Fatalf("calls: %v", fx.RunCalls)
+	}
+
+	if vols, images := linkedResources(fx, []dockerx.Container{victim}, nil, true, false); len(vols) != 2 || images != nil {
+		t.Fatalf("volumes only: %v %v", vols, images)
+	}
+}
+
+func TestDestroySummaryShowsAgeAndMounts(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	victims := []dockerx.Container{
+		{Name: "claudex-app-1", Status: "running", CreatedAt: now.Add(-3 * 24 * time.Hour), Labels: map[string]string{"com.claudex.slug": "app", "com.claudex.mounts": `["/home/me/work/app","/home/me/lib"]`}},
+		{Name: "claudex-app-2", Status: "exited", CreatedAt: now.Add(-90 * time.Minute), Labels: map[string]string{"com.claudex.slug": "app"}},
+	}
+	var out strings.Builder
+	printDestroySummary(&out, victims, now)
+	for _, want := range []string{"AGE", " 3d ", "mounts: /home/me/work/app\n", "mounts: /home/me/lib\n", " 1h ", "mounts: unknown (mount label missing)"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("missing %q in:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestProtectRecreatesWithLabelAndDestroySkipsIt(t *testing.T) {
+	fx := &dockerx.Fake{Containers: map[string]dockerx.Container{
+		"c": {Name: "c", Status: "exited", Labels: map[string]string{"com.claudex.signature": "s"}},
+	}}
+	var out, errOut strings.Builder
+	if err := protectWithDocker(fx, []string{"--name", "c"}, scripted("n\n", &out, &errOut)); err != nil || len(fx.RunCalls) != 0 || !strings.Contains(out.String(), "Aborted") {
+		t.Fatalf("declined protect: %v %v\n%s", err, fx.RunCalls, out.String())
+	}
+	if err := protectWithDocker(fx, []string{"--name", "c", "--yes"}, scripted("", &out, &errOut)); err != nil {
+		t.Fatalf("protect: %v", err)
+	}
+	var created string
+	for _, c := range fx.RunCalls {
+		if c[0] == "create" {
+			created = strings.Join(c, " ")
+		}
+	}
+	if strings.Join(fx.RunCalls[0], " ") != "commit c claudex-relabeled:c" || !strings.Contains(created, "--label "+run.ProtectedLabel+"=true") {
+		t.Fatalf("protect calls: %v", fx.RunCalls)
+	}
+
+	protected := dockerx.Container{Name: "p", Labels: map[string]string{run.ProtectedLabel: "true"}}
+	out.Reset()
+	if left := skipProtected([]dockerx.Container{protected, {Name: "q"}}, &out); len(left) != 1 || left[0].Name != "q" || !strings.Contains(out.String(), "Skipping protected container p") {
+		t.Fatalf("skipProtected: %v\n%s", left, out.String())
+	}
+}
+
+func TestTargetSpecForms(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	if err := state.Update(func(s *state.Store) error {
+		s.Upsert(state.Session{Name: "b", LastAttached: time.Unix(200, 0)})
+		s.Upsert(state.Session{Name: "a", LastAttached: time.Unix(100, 0)})
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	f := &dockerx.Fake{Simulate: true, Containers: map[string]dockerx.Container{
+		"a": {Name: "a", Status: "running", Labels: map[string]string{"com.claudex.signature": "s1"}},
+		"b": {Name: "b", Status: "exited", Labels: map[string]string{"com.claudex.signature": "s2"}},
+	}}
+	parse := func(args ...string) targetSpec {
+		var ts targetSpec
+		for i := 0; i < len(args); i++ {
+			if ok, err := ts.flag(args, &i); err != nil {
+				t.Fatal(err)
+			} else if !ok {
+				if err := ts.positional(args[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		return ts
+	}
+	cases := []struct {
+		args    []string
+		running bool
+		want    string
+	}{
+		{[]string{"b"}, false, "b"},
+		{[]string{"--container", "a"}, true, "a"},
+		{[]string{"--signature", "s2"}, false, "b"},
+		{[]string{"--last"}, false, "b"},
+		{[]string{"--last"}, true, "a"},
+		{nil, true, "a"},
+	}
+	for _, c := range cases {
+		if got, err := parse(c.args...).resolve(f, c.running); err != nil || got != c.want {
+			t.Fatalf("%v (running=%v) = %q, %v; want %q", c.args, c.running, got, err, c.want)
+		}
+	}
+	if _, err := parse("--signature", "s2").resolve(f, true); err == nil {
+		t.Fatal("stopped container matched a running-only signature lookup")
+	}
+	if _, err := parse("a", "--last").resolve(f, false); err == nil {
+		t.Fatal("NAME and --last together should be rejected")
+	}
+	var ts targetSpec
+	if err := ts.positional("--bogus"); err == nil {
+		t.Fatal("flags are not names")
+	}
+}
+
+func TestFuzzyTargetNames(t *testing.T) {
+	sig := func(slug string) map[string]string {
+		return map[string]string{"com.claudex.signature": "s", "com.claudex.slug": slug}
+	}
+	f := &dockerx.Fake{Simulate: true, Containers: map[string]dockerx.Container{
+		"claudex-app-api-a1b2c3d4": {Name: "claudex-app-api-a1b2c3d4", Status: "running", Labels: sig("app-api")},
+		"claudex-app-web-e5f6a7b8": {Name: "claudex-app-web-e5f6a7b8", Status: "exited", Labels: sig("app-web")},
+		"claudex-docs-0a0b0c0d":    {Name: "claudex-docs-0a0b0c0d", Status: "running", Labels: sig("docs")},
+	}}
+	for query, want := range map[string]string{
+		"claudex-app-api-a1b2c3d4": "claudex-app-api-a1b2c3d4",
+		"app-a":                    "claudex-app-api-a1b2c3d4",
+		"DOCS":                     "claudex-docs-0a0b0c0d",
+		"awe":                      "claudex-app-web-e5f6a7b8",
+	} {
+		if got, err := (targetSpec{Name: query}).resolve(f, false); err != nil || got != want {
+			t.Fatalf("%q = %q, %v; want %q", query, got, err, want)
+		}
+	}
+	if _, err := (targetSpec{Name: "app"}).resolve(f, false); err == nil || !strings.Contains(err.Error(), "claudex-app-api-a1b2c3d4, claudex-app-web-e5f6a7b8") && !strings.Contains(err.Error(), "claudex-app-web-e5f6a7b8, claudex-app-api-a1b2c3d4") {
+		t.Fatalf("ambiguous prefix: %v", err)
+	}
+	if _, err := (targetSpec{Name: "app-web"}).resolve(f, true); err == nil || !strings.Contains(err.Error(), "claudex-app-web-e5f6a7b8 is not running") {
+		t.Fatalf("stopped fuzzy match: %v", err)
+	}
+	if _, err := (targetSpec{Name: "zzz"}).resolve(f, false); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Fatalf("no match: %v", err)
+	}
+}
+
+func TestDestroyAndPullWithScriptedPrompts(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	fx := &dockerx.Fake{Simulate: true, Containers: map[string]dockerx.Container{
+		"a": {Name: "a", Status: "exited", CreatedAt: time.Unix(100, 0), Labels: map[string]string{"com.claudex.signature": "s1"}},
+		"b": {Name: "b", Status: "running", CreatedAt: time.Unix(200, 0), Labels: map[string]string{"com.claudex.signature": "s2"}},
+	}}
+
+	var out strings.Builder
+	if err := destroyWithDocker(fx, nil, scripted("1\nn\n", &out, &out)); err != nil || len(fx.RemoveCalls) != 0 || !strings.Contains(out.String(), output.T(output.MsgAborted)) {
+		t.Fatalf("declined destroy: %v %v\n%s", err, fx.RemoveCalls, out.String())
+	}
+	out.Reset()
+	if err := destroyWithDocker(fx, nil, scripted("1\ny\n", &out, &out)); err != nil || strings.Join(fx.RemoveCalls, ",") != "a" {
+		t.Fatalf("destroy: %v %v\n%s", err, fx.RemoveCalls, out.String())
+	}
+	if err := destroyWithDocker(fx, []string{"--json", "--name", "b"}, scripted("", &out, &out)); err == nil {
+		t.Fatal("destroy --json without --force should refuse to prompt")
+	}
+
+	// Pull picks b.txt in the browser, then takes the default destination
+	// from a blank answer; --json reports the copy.
+	fx.ExecOutputOut = []byte("b.txt\n")
+	out.Reset()
+	if err := pullWithDocker(fx, nil, scripted("1\ndone\n\n", &out, &out)); err != nil || len(fx.CPCalls) != 1 || fx.CPCalls[0][0] != "b:/workspace/b.txt" {
+		t.Fatalf("interactive pull: %v %v\n%s", err, fx.CPCalls, out.String())
+	}
+	dest := t.TempDir()
+	var res, progress strings.Builder
+	if err := pullWithDocker(fx, []string{"--json", "/workspace/b.txt", dest}, Streams{Out: &res, Err: &progress}); err != nil {
+		t.Fatalf("pull --json: %v", err)
+	}
+	var pulled PullResult
+	if err := json.Unmarshal([]byte(res.String()), &pulled); err != nil || pulled.Dest != dest || strings.Join(pulled.Sources, ",") != "b:/workspace/b.txt" {
+		t.Fatalf("pull --json result: %v %+v\n%s", err, pulled, res.String())
+	}
+
+	res.Reset()
+	if err := destroyWithDocker(fx, []string{"--json", "--force", "--all"}, Streams{Out: &res, Err: &progress}); err != nil {
+		t.Fatalf("destroy --json: %v", err)
+	}
+	var destroyed DestroyResult
+	if err := json.Unmarshal([]byte(res.String()), &destroyed); err != nil || strings.Join(destroyed.Removed, ",") != "b" {
+		t.Fatalf("destroy --json result: %v %+v\n%s", err, destroyed, res.String())
+	}
+}
+
+func TestAuthPastesCallbackThroughPrompt(t *testing.T) {
+	fx := &dockerx.Fake{Containers: map[string]dockerx.Container{
+		"c": {Name: "c", Status: "running", Labels: map[string]string{"com.claudex.signature": "s"}},
+	}}
+	var replayed string
+	fx.ExecOutputFunc = func(name string, cmd []string) ([]byte, error) {
+		body := ""
+		switch path := cmd[len(cmd)-1]; {
+		case strings.HasSuffix(path, "/auth/start"):
+			body = `{"authorization_url":"https://accounts.example/consent"}`
+		case strings.HasSuffix(path, "/auth/status"):
+			body = `{"authenticated":true,"token_file":"/home/node/.config/google-docs-mcp/token.json"}`
+		case strings.Contains(path, "/auth/callback"):
+			replayed = path
+		}
+		return []byte("HTTP/1.0 200 OK\r\n\r\n" + body), nil
+	}
+	var out strings.Builder
+	err := authWithDocker(fx, []string{"google-docs-mcp", "c"}, scripted("http://localhost:8810/auth/callback?state=x&code=y\n", &out, &out))
+	if err != nil {
+		t.Fatalf("auth: %v\n%s", err, out.String())
+	}
+	if replayed != "/local/8810/auth/callback?state=x&code=y" {
+		t.Fatalf("replayed %q", replayed)
+	}
+	for _, want := range []string{"https://accounts.example/consent", "Paste redirected URL", "credentials stored at /home/node/.config/google-docs-mcp/token.json", "Stopped the temporary"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("output missing %q:\n%s", want, out.String())
+		}
+	}
+	if err := authWithDocker(fx, []string{"google-docs-mcp", "c"}, scripted("\n", &out, &out)); err == nil || !strings.Contains(err.Error(), "no callback URL") {
+		t.Fatalf("blank answer: %v", err)
+	}
+}
+
+func TestTelemetryShowOffOn(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("CLAUDEX_NO_TELEMETRY", "")
+	var out strings.Builder
+	if err := telemetryWith(config.Telemetry{Enabled: true}, "show", scripted("", &out, &out)); err != nil {
+		t.Fatalf("show: %v", err)
+	}
+	if !strings.Contains(out.String(), "Telemetry: on") || !strings.Contains(out.String(), "No usage recorded.") {
+		t.Fatalf("show:\n%s", out.String())
+	}
+	out.Reset()
+	if err := telemetryWith(config.Telemetry{Enabled: true}, "off", scripted("", &out, &out)); err != nil {
+		t.Fatalf("off: %v", err)
+	}
+	if err := telemetryWith(config.Telemetry{Enabled: true}, "show", scripted("", &out, &out)); err != nil || !strings.Contains(out.String(), "Telemetry: off (claudex telemetry off") {
+		t.Fatalf("show after off: %v\n%s", err, out.String())
+	}
+	out.Reset()
+	if err := telemetryWith(config.Telemetry{}, "on", scripted("", &out, &out)); err != nil || !strings.Contains(out.String(), "Cleared the off switch") {
+		t.Fatalf("on: %v\n%s", err, out.String())
+	}
+	if err := telemetryWith(config.Telemetry{}, "export", scripted("", &out, &out)); err == nil {
+		t.Fatal("export without an endpoint should fail")
+	}
+}
+
+func TestDestroyExpiredRemovesOnlyTTLDestroy(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	past := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	future := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	fx := &dockerx.Fake{Simulate: true, Containers: map[string]dockerx.Container{
+		"gone":  {Name: "gone", Status: "exited", Labels: map[string]string{"com.claudex.signature": "s1", run.ExpiresLabel: past, run.TTLActionLabel: run.TTLDestroy}},
+		"kept":  {Name: "kept", Status: "exited", Labels: map[string]string{"com.claudex.signature": "s2", run.ExpiresLabel: past}},
+		"later": {Name: "later", Status: "running", Labels: map[string]string{"com.claudex.signature": "s3", run.ExpiresLabel: future, run.TTLActionLabel: run.TTLDestroy}},
+		"plain": {Name: "plain", Status: "running", Labels: map[string]string{"com.claudex.signature": "s4"}},
+	}}
+	var out strings.Builder
+	if err := destroyWithDocker(fx, []string{"--expired", "--force"}, scripted("", &out, &out)); err != nil || strings.Join(fx.RemoveCalls, ",") != "gone" {
+		t.Fatalf("destroy --expired: %v %v\n%s", err, fx.RemoveCalls, out.String())
+	}
+	out.Reset()
+	if err := destroyWithDocker(fx, []string{"--expired", "--force"}, scripted("", &out, &out)); err != nil || !strings.Contains(out.String(), "No expired containers") {
+		t.Fatalf("second destroy --expired: %v\n%s", err, out.String())
+	}
+}
+
+func TestUsageTotalsBySignature(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	now := time.Now()
+	if err := state.Update(func(s *state.Store) error {
+		s.Upsert(state.Session{Name: "a", Signature: "s1", CreatedAt: now.Add(-30 * 24 * time.Hour), Usage: []state.Usage{
+			{To: now.Add(-20 * 24 * time.Hour), AttachSeconds: 9000, CPUSeconds: 9000},
+			{To: now.Add(-time.Hour), AttachSeconds: 3600, CPUSeconds: 1800, InputTokens: 1000, OutputTokens: 100},
+		}})
+		s.Upsert(state.Session{Name: "b", Signature: "s1", CreatedAt: now.Add(-2 * time.Hour), Usage: []state.Usage{{To: now.Add(-time.Hour), AttachSeconds: 1800}}})
+		s.Upsert(state.Session{Name: "c", Signature: "s2", CreatedAt: now.Add(-2 * time.Hour)})
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// c is running: it is sampled before the report.
+	fx := &dockerx.Fake{Containers: map[string]dockerx.Container{
+		"c": {ID: "id-c", Name: "c", Status: "running", Labels: map[string]string{"com.claudex.signature": "s2"}},
+	}, ExecOutputOut: []byte(`{"cpu_seconds":7200,"input_tokens":50,"output_tokens":5}`)}
+
+	var out, errOut strings.Builder
+	if err := usageWithDocker(fx, []string{"--since", "7d", "--by", "signature"}, &out, &errOut, now); err != nil {
+		t.Fatalf("usage: %v\n%s", err, errOut.String())
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[1], "s2 ") || !strings.Contains(lines[1], "2.00h") ||
+		!strings.HasPrefix(lines[2], "s1 ") || !strings.Contains(lines[2], " 2 ") || !strings.Contains(lines[2], "1.50h") || !strings.Contains(lines[2], "1000") ||
+		!strings.HasPrefix(lines[3], "TOTAL") {
+		t.Fatalf("usage table:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := usageWithDocker(fx, []string{"--json"}, &out, &errOut, now); err != nil {
+		t.Fatal(err)
+	}
+	var rows []UsageRow
+	if err := json.Unmarshal([]byte(out.String()), &rows); err != nil || len(rows) != 3 || rows[0].Key != "a" || rows[0].CPUSeconds != 10800 {
+		t.Fatalf("usage --json: %v %+v", err, rows)
+	}
+	if err := usageWithDocker(fx, []string{"--by", "team"}, &out, &errOut, now); err == nil {
+		t.Fatal("--by team should be refused")
+	}
+}
+
+func TestListAndDestroyShowOnlyOwnContainers(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("USER", "alice")
+	fx := &dockerx.Fake{Simulate: true, Containers: map[string]dockerx.Container{
+		"mine":   {Name: "mine", Status: "running", Labels: map[string]string{"com.claudex.signature": "s1", run.OwnerLabel: "alice"}},
+		"theirs": {Name: "theirs", Status: "running", Labels: map[string]string{"com.claudex.signature": "s2", run.OwnerLabel: "bob"}},
+		"legacy": {Name: "legacy", Status: "running", Labels: map[string]string{"com.claudex.signature": "s3"}},
+	}}
+	var out strings.Builder
+	if err := listWithDocker(fx, []string{"--format", "names"}, &out); err != nil || out.String() != "legacy\nmine\n" && out.String() != "mine\nlegacy\n" {
+		t.Fatalf("list: %v %q", err, out.String())
+	}
+	out.Reset()
+	if err := listWithDocker(fx, []string{"--all-users", "--sort", "name"}, &out); err != nil || !strings.Contains(out.String(), "OWNER") || !strings.Contains(out.String(), " bob") {
+		t.Fatalf("list --all-users: %v\n%s", err, out.String())
+	}
+
+	out.Reset()
+	if err := destroyWithDocker(fx, []string{"--name", "theirs", "--force"}, scripted("", &out, &out)); err != nil || len(fx.RemoveCalls) != 0 || !strings.Contains(out.String(), "belongs to bob") {
+		t.Fatalf("destroy another user's container: %v %v\n%s", err, fx.RemoveCalls, out.String())
+	}
+	if err := destroyWithDocker(fx, []string{"--all", "--force"}, scripted("", &out, &out)); err != nil || strings.Contains(strings.Join(fx.RemoveCalls, ","), "theirs") || len(fx.RemoveCalls) != 2 {
+		t.Fatalf("destroy --all: %v %v", err, fx.RemoveCalls)
+	}
+	if err := destroyWithDocker(fx, []string{"--name", "theirs", "--force", "--all-users"}, scripted("", &out, &out)); err != nil || fx.RemoveCalls[len(fx.RemoveCalls)-1] != "theirs" {
+		t.Fatalf("destroy --all-users: %v %v", err, fx.RemoveCalls)
+	}
+}
+
+func TestGitCredentialsAsksAndRelays(t *testing.T) {
+	fill := gitCredentialFill
+	defer func() { gitCredentialFill = fill }()
+	var filled string
+	gitCredentialFill = func(req []byte) ([]byte, error) {
+		filled = string(req)
+		return []byte("protocol=https\nhost=github.com\nusername=me\npassword=s3cret\n"), nil
+	}
+	fx := &dockerx.Fake{Containers: map[string]dockerx.Container{
+		"c": {Name: "c", Status: "running", Labels: map[string]string{"com.claudex.signature": "s"}},
+	}}
+	done := make(chan os.Signal, 1)
+	var replies []string
+	fx.ExecInteractiveFunc = func(name string, cmd []string, in io.Reader, out io.Writer) error {
+		if len(replies) == 3 {
+			done <- os.Interrupt
+			_, err := io.ReadAll(in)
+			return err
+		}
+		host := "github.com"
+		if len(replies) == 2 {
+			host = "gitlab.com"
+		}
+		fmt.Fprintf(out, "protocol=https\nhost=%s\nwwwauth[]=Basic\n\n", host)
+		reply, err := io.ReadAll(in)
+		replies = append(replies, string(reply))
+		return err
+	}
+	var out strings.Builder
+	// Denied once, approved once, then gitlab.com is pre-approved.
+	err := gitCredentialsWithDocker(fx, []string{"--name", "c", "--allow", "gitlab.com"}, scripted("n\ny\n", &out, &out), done)
+	if err != nil {
+		t.Fatalf("git-credentials: %v\n%s", err, out.String())
+	}
+	if len(replies) != 3 || replies[0] != "quit=1\n" || !strings.Contains(replies[1], "password=s3cret") || !strings.Contains(replies[2], "password=s3cret") {
+		t.Fatalf("replies: %q\n%s", replies, out.String())
+	}
+	if strings.Contains(filled, "wwwauth") || !strings.HasPrefix(filled, "protocol=https\nhost=") {
+		t.Fatalf("request passed to the host's git: %q", filled)
+	}
+	if n := len(fx.ExecCalls); n == 0 || !strings.Contains(strings.Join(fx.ExecCalls[n-1], " "), gitCredPID) {
+		t.Fatalf("relay not stopped: %v", fx.ExecCalls)
+	}
+}
+
+func TestCloneCarriesLabelsAndSecurityOptions(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("USER", "alice")
+	ws := t.TempDir()
+	fx := &dockerx.Fake{Simulate: true, Containers: map[string]dockerx.Container{
+		"src": {Name: "src", Status: "running", SecurityOpt: []string{policy.NoNewPrivileges}, Labels: map[string]string{
+			"com.claudex.signature": "s1", "com.claudex.slug": "app", "com.claudex.mounts": `["` + ws + `"]`,
+			"com.claudex.audit": "true", run.OwnerLabel: "bob",
+		}},
+	}}
+	var out strings.Builder
+	if err := cloneWithDocker(fx, []string{"src", "--as", "dst"}, scripted("", &out, &out)); err != nil {
+		t.Fatalf("clone: %v\n%s", err, out.String())
+	}
+	dst, ok := fx.Containers["dst"]
+	if !ok {
+		t.Fatalf("no clone created: %v", fx.RunCalls)
+	}
+	for k, want := range map[string]string{"com.claudex.signature": "s1", "com.claudex.slug": "app", "com.claudex.audit": "true", run.OwnerLabel: "alice"} {
+		if dst.Labels[k] != want {
+			t.Errorf("clone label %s = %q, want %q", k, dst.Labels[k], want)
+		}
+	}
+	if !reflect.DeepEqual(dst.SecurityOpt, []string{policy.NoNewPrivileges}) {
+		t.Errorf("clone security options = %v, want no-sudo kept", dst.SecurityOpt)
+	}
+	if !strings.Contains(out.String(), "Cloned src -> dst") {
+		t.Errorf("output:\n%s", out.String())
+	}
+	if err := cloneWithDocker(fx, []string{"src", "--as", "dst"}, scripted("", &out, &out)); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("clone onto an existing name: %v", err)
+	}
+	if err := cloneWithDocker(fx, nil, scripted("", &out, &out)); err == nil || !strings.Contains(err.Error(), "usage") {
+		t.Fatalf("clone without a source: %v", err)
+	}
+}
+
+func TestImportSessionRecreatesLabelsAndSecurityOptions(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("USER", "alice")
+	ws := t.TempDir()
+	fx := &dockerx.Fake{Simulate: true, Containers: map[string]dockerx.Container{
+		"src": {Name: "src", Status: "exited", SecurityOpt: []string{policy.NoNewPrivileges}, Labels: map[string]string{
+			"com.claudex.signature": "s1", "com.claudex.slug": "app", "com.claudex.mounts": `["` + ws + `"]`,
+			"com.claudex.audit": "true", run.OwnerLabel: "bob",
+		}},
+	}}
+	// docker save writes the image where the archive picks it up.
+	fx.ErrFunc = func(c dockerx.Call) error {
+		if c.Method == "Run" && c.Args[0] == "save" {
+			return os.WriteFile(c.Args[2], []byte("layers"), 0644)
+		}
+		return nil
+	}
+	archive := filepath.Join(t.TempDir(), "session.tar")
+	var out strings.Builder
+	if err := exportSessionWithDocker(fx, []string{"--name", "src", archive}, scripted("", &out, &out)); err != nil {
+		t.Fatalf("export-session: %v\n%s", err, out.String())
+	}
+	if err := importSessionWithDocker(fx, []string{archive, "--as", "imported"}, scripted("", &out, &out)); err != nil {
+		t.Fatalf("import-session: %v\n%s", err, out.String())
+	}
+	got, ok := fx.Containers["imported"]
+	if !ok {
+		t.Fatalf("nothing imported: %v", fx.RunCalls)
+	}
+	if got.Image != "claudex-session-src:latest" {
+		t.Errorf("imported image = %q", got.Image)
+	}
+	for k, want := range map[string]string{"com.claudex.signature": "s1", "com.claudex.slug": "app", "com.claudex.audit": "true", run.OwnerLabel: "alice"} {
+		if got.Labels[k] != want {
+			t.Errorf("imported label %s = %q, want %q", k, got.Labels[k], want)
+		}
+	}
+	if !reflect.DeepEqual(got.SecurityOpt, []string{policy.NoNewPrivileges}) {
+		t.Errorf("imported security options = %v, want no-sudo kept", got.SecurityOpt)
+	}
+	if err := importSessionWithDocker(fx, []string{archive, "--as", "imported"}, scripted("", &out, &out)); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("import onto an existing name: %v", err)
+	}
+}
+
+func TestGitCredentialsWithoutHostCredential(t *testing.T) {
+	fill := gitCredentialFill
+	defer func() { gitCredentialFill = fill }()
+	gitCredentialFill = func(req []byte) ([]byte, error) { return nil, errors.New("exit status 128") }
+	var out, errOut strings.Builder
+	s := scripted("", &out, &errOut)
+	// An approved request the host cannot fill gets an empty answer, so git
+	// moves on to its other helpers instead of failing.
+	if got := answerGitCredential("c", map[string]string{"protocol": "https", "host": "github.com"}, map[string]bool{"github.com": true}, s); got != nil {
+		t.Fatalf("answer = %q", got)
+	}
+	if !strings.Contains(errOut.String(), "no git credentials for https://github.com") {
+		t.Fatalf("warning:\n%s", errOut.String())
+	}
+	if got := answerGitCredential("c", map[string]string{"host": "github.com"}, nil, s); got != nil {
+		t.Fatalf("incomplete request answered: %q", got)
+	}
+
+	fx := &dockerx.Fake{Containers: map[string]dockerx.Container{
+		"c": {Name: "c", Status: "exited", Labels: map[string]string{"com.claudex.signature": "s"}},
+	}}
+	if err := gitCredentialsWithDocker(fx, []string{"c"}, s, make(chan os.Signal)); err == nil || !strings.Contains(err.Error(), "not running") {
+		t.Fatalf("stopped target: %v", err)
+	}
+	if calls := fx.CallsTo("ExecInteractive"); len(calls) != 0 {
+		t.Fatalf("relay started in a stopped container: %v", calls)
+	}
+}
+
+func TestSigningKeyPrintsPublicKeyOfSignedSessions(t *testing.T) {
+	fx := &dockerx.Fake{
+		Containers: map[string]dockerx.Container{
+			"signed":   {Name: "signed", Status: "running", Labels: map[string]string{"com.claudex.signature": "s", run.SigningLabel: "ssh"}},
+			"unsigned": {Name: "unsigned", Status: "running", Labels: map[string]string{"com.claudex.signature": "u"}},
+		},
+		ExecOutputFunc: func(name string, cmd []string) ([]byte, error) {
+			if name != "signed" || !reflect.DeepEqual(cmd, []string{"cat", run.SigningKey + ".pub"}) {
+				return nil, fmt.Errorf("unexpected exec in %s: %v", name, cmd)
+			}
+			return []byte("ssh-ed25519 AAAA claudex\n"), nil
+		},
+	}
+	var out strings.Builder
+	if err := signingKeyWithDocker(fx, []string{"signed"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "ssh-ed25519 AAAA claudex\n" {
+		t.Fatalf("out = %q", out.String())
+	}
+	out.Reset()
+	if err := signingKeyWithDocker(fx, []string{"unsigned"}, &out); err == nil || !strings.Contains(err.Error(), "not created with --sign") {
+		t.Fatalf("unsigned target: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Fatalf("printed for an unsigned target: %q", out.String())
+	}
+}
@@ -0,0 +1,182 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/run"
+	"gopkg.in/yaml.v3"
+)
+
+// composeEnv are variables claudex sets with fixed values; they are exported
+// with their values. Passthrough secrets (run.PassthroughEnv) are exported by
+// name only so compose reads them from the host, and image defaults are left
+// to the image.
+var composeEnv = map[string]bool{"HISTFILE": true, "PROMPT_COMMAND": true, "CLAUDEX_AUDIT": true, "BASH_ENV": true}
+
+type composeFile struct {
+	Services map[string]composeService `yaml:"services"`
+	Volumes  map[string]composeVolume  `yaml:"volumes,omitempty"`
+}
+
+type composeService struct {
+	Image         string            `yaml:"image"`
+	ContainerName string            `yaml:"container_name"`
+	Command       []string          `yaml:"command,omitempty"`
+	WorkingDir    string            `yaml:"working_dir,omitempty"`
+	Environment   []string          `yaml:"environment,omitempty"`
+	Volumes       []composeMount    `yaml:"volumes,omitempty"`
+	Tmpfs         []string          `yaml:"tmpfs,omitempty"`
+	NetworkMode   string            `yaml:"network_mode,omitempty"`
+	CapAdd        []string          `yaml:"cap_add,omitempty"`
+	Privileged    bool              `yaml:"privileged,omitempty"`
+	Runtime       string            `yaml:"runtime,omitempty"`
+	MemLimit      int64             `yaml:"mem_limit,omitempty"`
+	Healthcheck   *composeHealth    `yaml:"healthcheck,omitempty"`
+	Labels        map[string]string `yaml:"labels,omitempty"`
+}
+
+type composeMount struct {
+	Type     string `yaml:"type"`
+	Source   string `yaml:"source"`
+	Target   string `yaml:"target"`
+	ReadOnly bool   `yaml:"read_only,omitempty"`
+}
+
+type composeHealth struct {
+	Test     []string `yaml:"test"`
+	Interval string   `yaml:"interval,omitempty"`
+	Timeout  string   `yaml:"timeout,omitempty"`
+	Retries  int      `yaml:"retries,omitempty"`
+}
+
+type composeVolume struct {
+	External bool `yaml:"external"`
+}
+
+// ExportCompose implements `claudex export-compose [--name NAME]`, printing
+// the container's configuration as a docker compose file.
+func ExportCompose(args []string) error {
+	return exportComposeWithDocker(dockerx.New(), args, os.Stdout)
+}
+
+func exportComposeWithDocker(dx dockerx.Docker, args []string, out io.Writer) error {
+	var t targetSpec
+	for i := 0; i < len(args); i++ {
+		if ok, err := t.flag(args, &i); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		switch args[i] {
+		default:
+			if err := t.positional(args[i]); err != nil {
+				return err
+			}
+		}
+	}
+	target, err := t.resolve(dx, true)
+	if err != nil {
+		return err
+	}
+	info, err := dx.Inspect(target)
+	if err != nil {
+		return err
+	}
+	f := composeFromContainer(info)
+	fmt.Fprintf(out, "# Generated by claudex export-compose from container %s.\n", info.Name)
+	fmt.Fprintf(out, "# Remove that container (claudex destroy --name %s) before docker compose up.\n", info.Name)
+	enc := yaml.NewEncoder(out)
+	enc.SetIndent(2)
+	if err := enc.Encode(f); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// composeFromContainer renders info as a single-service compose file named
+// after the container. Named volumes are declared external since claudex
+// owns them.
+func composeFromContainer(info dockerx.Container) composeFile {
+	svc := composeService{
+		Image:         info.Image,
+		ContainerName: info.Name,
+		Command:       escapeCompose(info.Cmd),
+		WorkingDir:    info.WorkingDir,
+		CapAdd:        info.CapAdd,
+		Privileged:    info.Privileged,
+		MemLimit:      info.Memory,
+	}
+	passthrough := map[string]bool{}
+	for _, e := range run.PassthroughEnv {
+		passthrough[e] = true
+	}
+	for _, kv := range info.Env {
+		k, _, _ := strings.Cut(kv, "=")
+		switch {
+		case passthrough[k]:
+			svc.Environment = append(svc.Environment, k)
+		case composeEnv[k]:
+			svc.Environment = append(svc.Environment, escapeCompose([]string{kv})[0])
+		}
+	}
+	f := composeFile{Services: map[string]composeService{}}
+	for _, m := range info.Mounts {
+		if m.Type == "tmpfs" {
+			continue
+		}
+		cm := composeMount{Type: "bind", Source: m.Source, Target: m.Destination, ReadOnly: !m.RW}
+		if m.Type == "volume" {
+			cm.Type, cm.Source = "volume", m.Name
+			if f.Volumes == nil {
+				f.Volumes = map[string]composeVolume{}
+			}
+			f.Volumes[m.Name] = composeVolume{External: true}
+		}
+		svc.Volumes = append(svc.Volumes, cm)
+	}
+	for p, opts := range info.Tmpfs {
+		if opts != "" {
+			p += ":" + opts
+		}
+		svc.Tmpfs = append(svc.Tmpfs, p)
+	}
+	sort.Strings(svc.Tmpfs)
+	if info.NetworkMode != "" && info.NetworkMode != "default" && info.NetworkMode != "bridge" {
+		svc.NetworkMode = info.NetworkMode
+	}
+	if info.Runtime != "" && info.Runtime != "runc" {
+		svc.Runtime = info.Runtime
+	}
+	if h := info.Healthcheck; h != nil && len(h.Test) > 0 {
+		ch := &composeHealth{Test: escapeCompose(h.Test), Retries: h.Retries}
+		if h.Interval > 0 {
+			ch.Interval = h.Interval.String()
+		}
+		if h.Timeout > 0 {
+			ch.Timeout = h.Timeout.String()
+		}
+		svc.Healthcheck = ch
+	}
+	if len(info.Labels) > 0 {
+		svc.Labels = map[string]string{}
+		for k, v := range info.Labels {
+			svc.Labels[k] = strings.ReplaceAll(v, "$", "$$")
+		}
+	}
+	f.Services[info.Name] = svc
+	return f
+}
+
+// escapeCompose doubles $ so compose does not interpolate it.
+func escapeCompose(in []string) []string {
+	var res []string
+	for _, s := range in {
+		res = append(res, strings.ReplaceAll(s, "$", "$$"))
+	}
+	return res
+}
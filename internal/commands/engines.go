@@ -0,0 +1,32 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+)
+
+// Engines implements `claudex engines`, listing known container backends.
+func Engines(args []string) error {
+	return enginesWith(args, stdStreams())
+}
+
+func enginesWith(args []string, s Streams) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unknown arg: %s", args[0])
+	}
+	current := dockerx.DefaultName()
+	fmt.Fprintf(s.Out, "%-3s %-12s %-10s %s\n", "", "ENGINE", "AVAILABLE", "DESCRIPTION")
+	for _, e := range dockerx.Engines() {
+		mark := ""
+		if e.Name == current {
+			mark = "*"
+		}
+		avail := "no"
+		if e.Available() {
+			avail = "yes"
+		}
+		fmt.Fprintf(s.Out, "%-3s %-12s %-10s %s\n", mark, e.Name, avail, e.Description)
+	}
+	return nil
+}
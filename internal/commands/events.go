@@ -0,0 +1,144 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/state"
+)
+
+// lifecycleActions are the engine events worth showing; exec and health
+// chatter is dropped.
+var lifecycleActions = map[string]bool{
+	"create": true, "start": true, "restart": true, "stop": true,
+	"kill": true, "die": true, "oom": true, "destroy": true,
+}
+
+// event is one line of `claudex events`. Source is "docker" for engine
+// events and "claudex" for ones recorded by the CLI in the state store.
+type event struct {
+	Time   time.Time
+	Source string
+	Action string
+	Name   string
+}
+
+// Events implements `claudex events [--follow] [--since D] [--name NAME]`.
+func Events(args []string) error {
+	st, err := state.Load()
+	if err != nil {
+		return err
+	}
+	return eventsWithDocker(dockerx.New(), st.All(), args, os.Stdout, time.Now())
+}
+
+func eventsWithDocker(dx dockerx.Docker, sessions []state.Session, args []string, out io.Writer, now time.Time) error {
+	follow := false
+	since := now.Add(-24 * time.Hour)
+	var name string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch a {
+		case "--follow", "-f":
+			follow = true
+		case "--since":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--since requires a duration (1h) or RFC3339 time")
+			}
+			t, err := parseSince(args[i+1], now)
+			if err != nil {
+				return err
+			}
+			since = t
+			i++
+		case "--name":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--name requires a value")
+			}
+			name = args[i+1]
+			i++
+		default:
+			return fmt.Errorf("unknown arg: %s", a)
+		}
+	}
+	keep := func(ev dockerx.Event) bool {
+		return lifecycleActions[ev.Action] && (name == "" || ev.Name == name)
+	}
+
+	var engine []event
+	opts := dockerx.EventOptions{Since: since, Until: now, Labels: []string{"com.claudex.signature"}}
+	err := dx.Events(opts, func(ev dockerx.Event) error {
+		if keep(ev) {
+			engine = append(engine, event{Time: ev.Time, Source: "docker", Action: ev.Action, Name: ev.Name})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%-19s  %-7s  %-8s %s\n", "TIME", "SOURCE", "EVENT", "NAME")
+	for _, ev := range mergeEvents(engine, sessionEvents(sessions, since, name)) {
+		printEvent(out, ev)
+	}
+	if !follow {
+		return nil
+	}
+	opts = dockerx.EventOptions{Since: now, Labels: opts.Labels}
+	return dx.Events(opts, func(ev dockerx.Event) error {
+		if keep(ev) {
+			printEvent(out, event{Time: ev.Time, Source: "docker", Action: ev.Action, Name: ev.Name})
+		}
+		return nil
+	})
+}
+
+// sessionEvents turns state-store timestamps into create/attach/destroy
+// events at or after since.
+func sessionEvents(sessions []state.Session, since time.Time, name string) []event {
+	var res []event
+	add := func(t time.Time, action, n string) {
+		if !t.IsZero() && !t.Before(since) {
+			res = append(res, event{Time: t, Source: "claudex", Action: action, Name: n})
+		}
+	}
+	for _, s := range sessions {
+		if name != "" && s.Name != name {
+			continue
+		}
+		add(s.CreatedAt, "create", s.Name)
+		add(s.LastAttached, "attach", s.Name)
+		add(s.RemovedAt, "destroy", s.Name)
+	}
+	return res
+}
+
+// mergeEvents sorts engine and CLI events by time, dropping CLI create and
+// destroy records the engine already reported within a few seconds.
+func mergeEvents(engine, cli []event) []event {
+	const window = 5 * time.Second
+	res := append([]event(nil), engine...)
+	for _, c := range cli {
+		dup := false
+		for _, e := range engine {
+			if e.Name == c.Name && e.Action == c.Action {
+				if d := e.Time.Sub(c.Time); d < window && d > -window {
+					dup = true
+					break
+				}
+			}
+		}
+		if !dup {
+			res = append(res, c)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Time.Before(res[j].Time) })
+	return res
+}
+
+func printEvent(out io.Writer, ev event) {
+	fmt.Fprintf(out, "%-19s  %-7s  %-8s %s\n", ev.Time.Local().Format("2006-01-02 15:04:05"), ev.Source, ev.Action, ev.Name)
+}
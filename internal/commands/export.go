@@ -0,0 +1,117 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/photodialectic/claudex/internal/containers"
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/run"
+)
+
+// Export implements `claudex export [--name NAME] [--stage DIR] [--force]
+// [--with-git] [DIR...]`, bringing a --cow container's workspace copies back
+// to the host dirs they were copied from.
+func Export(args []string) error {
+	return exportWithDocker(dockerx.New(), args, stdStreams())
+}
+
+func exportWithDocker(dx dockerx.Docker, args []string, s Streams) error {
+	t := targetSpec{prompt: s.Prompt}
+	var stageDir string
+	var force, withGit bool
+	var only []string
+	for i := 0; i < len(args); i++ {
+		if ok, err := t.flag(args, &i); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		a := args[i]
+		switch a {
+		case "--stage":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--stage requires a value")
+			}
+			stageDir = args[i+1]
+			i++
+		case "--force":
+			force = true
+		case "--with-git":
+			withGit = true
+		default:
+			if strings.HasPrefix(a, "-") {
+				return fmt.Errorf("unknown arg: %s", a)
+			}
+			only = append(only, filepath.Base(filepath.Clean(a)))
+		}
+	}
+	target, err := t.resolve(dx, true)
+	if err != nil {
+		return err
+	}
+	info, err := dx.Inspect(target)
+	if err != nil {
+		return err
+	}
+	if info.Labels[run.CowLabel] != "true" {
+		return fmt.Errorf("%s bind-mounts its workspace, so changes are already on the host; export is for --cow containers", target)
+	}
+	mounts, err := containers.MountsFromLabel(&info)
+	if err != nil {
+		return fmt.Errorf("container %s missing mount label: %v", target, err)
+	}
+	exported := 0
+	for _, host := range mounts {
+		base := filepath.Base(host)
+		if len(only) > 0 && !contains(only, base) {
+			continue
+		}
+		exported++
+		staged, stageOnly := "", ""
+		if stageDir != "" {
+			staged = filepath.Join(stageDir, base)
+			stageOnly = staged
+			if err := freshStageDir(staged); err != nil {
+				return err
+			}
+		} else {
+			tmp, err := os.MkdirTemp("", "claudex-export-")
+			if err != nil {
+				return err
+			}
+			defer os.RemoveAll(tmp)
+			staged = tmp
+		}
+		src := fmt.Sprintf("%s:/workspace/%s/.", target, base)
+		fmt.Fprintf(s.Out, "Exporting %s -> %s\n", src, host)
+		if err := dx.CP(src, staged); err != nil {
+			return fmt.Errorf("docker cp failed for %s: %w", src, err)
+		}
+		// The host repo's .git is left alone unless asked: commits made in
+		// the container are easier to bring back with a bundle or patch.
+		if !withGit {
+			if err := os.RemoveAll(filepath.Join(staged, ".git")); err != nil {
+				return err
+			}
+		}
+		if _, err := finishPull(staged, host, stageOnly, force, s.Out); err != nil {
+			return fmt.Errorf("%s: %w", base, err)
+		}
+	}
+	if exported == 0 {
+		return fmt.Errorf("no workspace dirs match %v; choose from %v", only, mounts)
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
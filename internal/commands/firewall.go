@@ -0,0 +1,94 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/photodialectic/claudex/internal/agent"
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/firewall"
+)
+
+const firewallScript = "/usr/local/bin/init-firewall.sh"
+
+// Firewall implements `claudex firewall allow|deny|list [<TARGET>] [DOMAIN ...]`.
+// Rules apply to the running container immediately and persist in
+// /etc/claudex/firewall-allow inside it.
+func Firewall(args []string) error {
+	return firewallWithDocker(dockerx.New(), args, stdStreams())
+}
+
+func firewallWithDocker(dx dockerx.Docker, args []string, s Streams) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: claudex firewall allow|deny|list [--name <NAME>] [DOMAIN|*.DOMAIN ...]")
+	}
+	sub := args[0]
+	t := targetSpec{prompt: s.Prompt}
+	var domains []string
+	for i := 1; i < len(args); i++ {
+		if ok, err := t.flag(args, &i); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		a := args[i]
+		switch a {
+		default:
+			if !firewall.ValidPattern(a) {
+				return fmt.Errorf("invalid domain %q (want host.example.com or *.example.com)", a)
+			}
+			domains = append(domains, a)
+		}
+	}
+	var flag string
+	switch sub {
+	case "allow":
+		flag = "--add"
+	case "deny":
+		flag = "--remove"
+	case "list":
+		if len(domains) > 0 {
+			return fmt.Errorf("firewall list takes no domains")
+		}
+	default:
+		return fmt.Errorf("unknown firewall command: %s", sub)
+	}
+	if flag != "" && len(domains) == 0 {
+		return fmt.Errorf("firewall %s requires at least one domain", sub)
+	}
+
+	target, err := t.resolve(dx, true)
+	if err != nil {
+		return err
+	}
+	if sub == "list" {
+		var fw agent.Firewall
+		_, err := agent.Get(dx, target, "/firewall", &fw)
+		if err == nil {
+			if !fw.Active {
+				fmt.Fprintf(s.Err, "Note: the firewall is not active in %s; these rules apply once it is.\n", target)
+			}
+			for _, d := range fw.Allow {
+				fmt.Fprintln(s.Out, d)
+			}
+			return nil
+		}
+		if !errors.Is(err, agent.ErrNoAgent) {
+			return fmt.Errorf("cannot read firewall rules in %s: %w", target, err)
+		}
+		out, err := dx.ExecOutput(target, []string{firewallScript, "--list"})
+		if err != nil {
+			return fmt.Errorf("cannot read firewall rules in %s: %w", target, err)
+		}
+		s.Out.Write(out)
+		return nil
+	}
+	cmd := []string{"-u", "root", target, firewallScript}
+	for _, d := range domains {
+		cmd = append(cmd, flag, d)
+	}
+	if err := dx.Exec(cmd...); err != nil {
+		return fmt.Errorf("firewall %s failed in %s: %w", sub, target, err)
+	}
+	return nil
+}
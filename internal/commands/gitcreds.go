@@ -0,0 +1,186 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/output"
+)
+
+// The in-container end of the credential broker: git-credential-claudex
+// connects to gitCredSock, and waits for a broker while gitCredPID exists.
+const (
+	gitCredSock = "/tmp/claudex/git-credential.sock"
+	gitCredPID  = "/tmp/claudex/git-credential.pid"
+)
+
+// gitCredRelay accepts one helper connection and relays it over the exec's
+// stdio; -t leaves time for the approval on the host. A relay left behind
+// by a broker that was killed is stopped first.
+var gitCredRelay = []string{"bash", "-c", `mkdir -p /tmp/claudex
+[ -e "$2" ] && kill "$(cat "$2")" 2>/dev/null
+echo $$ >"$2"
+exec socat -t 300 UNIX-LISTEN:"$1",unlink-early,mode=600 STDIO`, "claudex-git-credentials", gitCredSock, gitCredPID}
+
+// gitCredStop removes the relay, so helpers stop waiting for the broker.
+const gitCredStop = `[ -e "$2" ] && kill "$(cat "$2")" 2>/dev/null; rm -f "$1" "$2"`
+
+// gitCredKeys are the request attributes passed on to the host's git.
+var gitCredKeys = []string{"protocol", "host", "path", "username"}
+
+// gitCredentialFill asks the host's git for the credential matching req,
+// without falling back to a terminal prompt.
+var gitCredentialFill = func(req []byte) ([]byte, error) {
+	cmd := exec.Command("git", "credential", "fill")
+	cmd.Stdin = bytes.NewReader(req)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	return cmd.Output()
+}
+
+// GitCredentials implements `claudex git-credentials [<TARGET>] [--allow
+// HOST]...`: until interrupted, git in the container may ask for the host's
+// credentials, and each request is approved here (or automatically for an
+// --allow host).
+func GitCredentials(args []string) error {
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(done)
+	return gitCredentialsWithDocker(dockerx.New(), args, stdStreams(), done)
+}
+
+func gitCredentialsWithDocker(dx dockerx.Docker, args []string, s Streams, done <-chan os.Signal) error {
+	t := targetSpec{prompt: s.Prompt}
+	allow := map[string]bool{}
+	for i := 0; i < len(args); i++ {
+		if ok, err := t.flag(args, &i); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		switch a := args[i]; a {
+		case "--allow":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--allow requires a host, e.g. github.com")
+			}
+			allow[args[i+1]] = true
+			i++
+		default:
+			if err := t.positional(a); err != nil {
+				return err
+			}
+		}
+	}
+	target, err := t.resolve(dx, true)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.Out, "Serving git credentials to %s; each request asks here first. Press Ctrl-C to stop.\n", target)
+	defer dx.Exec(target, "bash", "-c", gitCredStop, "claudex-git-credentials", gitCredSock, gitCredPID)
+	for {
+		req := &gitCredRequest{ready: make(chan struct{})}
+		in, reply := io.Pipe()
+		relayed := make(chan error, 1)
+		go func() {
+			relayed <- dx.ExecInteractive(target, gitCredRelay, dockerx.ExecOptions{}, in, req, s.Err)
+		}()
+		select {
+		case <-done:
+			reply.Close()
+			return nil
+		case err := <-relayed:
+			reply.Close()
+			if err != nil {
+				return fmt.Errorf("credential relay in %s failed: %w", target, err)
+			}
+			// The helper hung up without asking; wait for the next one.
+			continue
+		case <-req.ready:
+		}
+		reply.Write(answerGitCredential(target, req.attrs(), allow, s))
+		reply.Close()
+		if err := <-relayed; err != nil {
+			output.Warnf(s.Err, "credential relay in %s: %v\n", target, err)
+		}
+	}
+}
+
+// gitCredRequest collects what the helper sends, up to the blank line
+// ending git's request.
+type gitCredRequest struct {
+	mu    sync.Mutex
+	buf   bytes.Buffer
+	ready chan struct{}
+	once  sync.Once
+}
+
+func (r *gitCredRequest) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf.Write(p)
+	if b := r.buf.Bytes(); bytes.HasPrefix(b, []byte("\n")) || bytes.Contains(b, []byte("\n\n")) {
+		r.once.Do(func() { close(r.ready) })
+	}
+	return len(p), nil
+}
+
+// attrs parses the request's key=value lines.
+func (r *gitCredRequest) attrs() map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := map[string]string{}
+	sc := bufio.NewScanner(bytes.NewReader(r.buf.Bytes()))
+	for sc.Scan() {
+		if sc.Text() == "" {
+			break
+		}
+		if k, v, ok := strings.Cut(sc.Text(), "="); ok {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// answerGitCredential asks whether target may have the credential for req
+// and returns the helper's answer: the host's credential, nothing when the
+// host has none (git then tries its other helpers), or quit=1 when denied.
+func answerGitCredential(target string, req map[string]string, allow map[string]bool, s Streams) []byte {
+	if req["protocol"] == "" || req["host"] == "" {
+		return nil
+	}
+	what := req["protocol"] + "://" + req["host"]
+	if req["path"] != "" {
+		what += "/" + req["path"]
+	}
+	if req["username"] != "" {
+		what += " (user " + req["username"] + ")"
+	}
+	if !allow[req["host"]] {
+		ok, err := s.Prompt.Confirm(fmt.Sprintf("git in %s asks for your credentials for %s. Allow?", target, what))
+		if err != nil || !ok {
+			fmt.Fprintf(s.Out, "Denied git credentials for %s.\n", what)
+			return []byte("quit=1\n")
+		}
+	}
+	var in bytes.Buffer
+	for _, k := range gitCredKeys {
+		if v, ok := req[k]; ok {
+			fmt.Fprintf(&in, "%s=%s\n", k, v)
+		}
+	}
+	cred, err := gitCredentialFill(in.Bytes())
+	if err != nil {
+		output.Warnf(s.Err, "the host has no git credentials for %s: %v\n", what, err)
+		return nil
+	}
+	fmt.Fprintf(s.Out, "Sent git credentials for %s to %s.\n", what, target)
+	return cred
+}
@@ -0,0 +1,130 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/run"
+)
+
+// History implements `claudex history [--name NAME] [PATTERN]`, printing the
+// shell history kept for a workspace signature. Without --name it uses the
+// signature of the current directory, so history is readable even after the
+// container is gone.
+func History(args []string) error {
+	return historyWithDocker(dockerx.New(), args, os.Stdout)
+}
+
+func historyWithDocker(dx dockerx.Docker, args []string, out io.Writer) error {
+	var nameFlag, pattern string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch a {
+		case "--name":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--name requires a value")
+			}
+			nameFlag = args[i+1]
+			i++
+		default:
+			if pattern != "" || strings.HasPrefix(a, "-") {
+				return fmt.Errorf("unknown arg: %s", a)
+			}
+			pattern = a
+		}
+	}
+	var re *regexp.Regexp
+	if pattern != "" {
+		var err error
+		if re, err = regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+	}
+
+	var sig string
+	if nameFlag != "" {
+		info, err := dx.Inspect(nameFlag)
+		if err != nil {
+			return err
+		}
+		sig = info.Labels["com.claudex.signature"]
+		if sig == "" {
+			return fmt.Errorf("%s is not a claudex container", nameFlag)
+		}
+	} else {
+		o := run.Options{}
+		if err := o.Derive(); err != nil {
+			return err
+		}
+		sig = o.Signature
+	}
+	dir, err := run.HistoryDir(sig)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, f := range run.HistoryFiles {
+		data, err := os.ReadFile(filepath.Join(dir, f))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		found = true
+		for _, cmd := range historyCommands(data) {
+			if re == nil || re.MatchString(cmd) {
+				fmt.Fprintln(out, cmd)
+			}
+		}
+	}
+	if !found {
+		fmt.Fprintf(out, "No shell history recorded for signature %s yet.\n", sig)
+	}
+	return nil
+}
+
+// historyCommands extracts commands from bash (optionally timestamped), zsh
+// extended (": 1700000000:0;cmd"), and fish ("- cmd: ...") history files.
+func historyCommands(data []byte) []string {
+	var res []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#") && isDigits(line[1:]):
+			continue // bash HISTTIMEFORMAT stamp
+		case strings.HasPrefix(line, ": ") && strings.Contains(line, ";"):
+			line = line[strings.Index(line, ";")+1:]
+		case strings.HasPrefix(line, "- cmd: "):
+			line = strings.TrimPrefix(line, "- cmd: ")
+		case strings.HasPrefix(line, "  when: "), strings.HasPrefix(line, "  paths:"), strings.HasPrefix(line, "    - "):
+			continue // fish metadata
+		}
+		res = append(res, line)
+	}
+	return res
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,295 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/output"
+	"github.com/photodialectic/claudex/internal/version"
+)
+
+// Provenance labels recorded by `claudex image push`.
+const (
+	PublishedByLabel  = "com.claudex.published-by"
+	PublishedAtLabel  = "com.claudex.published-at"
+	SourceImageLabel  = "com.claudex.source-image"
+	PublisherCLILabel = "com.claudex.cli-version"
+)
+
+// Image implements `claudex image report|push|pull`.
+func Image(args []string) error {
+	return imageWithDocker(dockerx.New(), args, os.Stdout)
+}
+
+func imageWithDocker(dx dockerx.Docker, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: claudex image report|push|pull")
+	}
+	switch args[0] {
+	case "report":
+		return imageReport(dx, args[1:], out)
+	case "push":
+		return imagePush(dx, args[1:], out, time.Now())
+	case "pull":
+		return imagePull(dx, args[1:], out)
+	default:
+		return fmt.Errorf("unknown image command: %s", args[0])
+	}
+}
+
+// imageReport handles `image report [--image REF] [--top N]`, listing the
+// largest layers first so it is clear what makes the image heavy.
+func imageReport(dx dockerx.Docker, args []string, out io.Writer) error {
+	ref := "claudex"
+	top := 15
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch a {
+		case "--image", "--top":
+			if i+1 >= len(args) {
+				return fmt.Errorf("%s requires a value", a)
+			}
+			if a == "--image" {
+				ref = args[i+1]
+			} else {
+				n, err := strconv.Atoi(args[i+1])
+				if err != nil || n < 1 {
+					return fmt.Errorf("invalid --top %q", args[i+1])
+				}
+				top = n
+			}
+			i++
+		default:
+			return fmt.Errorf("unknown arg: %s", a)
+		}
+	}
+	layers, err := dx.History(ref)
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, l := range layers {
+		total += l.Size
+	}
+	sort.SliceStable(layers, func(i, j int) bool { return layers[i].Size > layers[j].Size })
+	fmt.Fprintf(out, "Image %s: %s in %d layers\n\n", ref, humanBytes(total), len(layers))
+	fmt.Fprintf(out, "%9s %6s  %s\n", "SIZE", "SHARE", "INSTRUCTION")
+	for i, l := range layers {
+		if i == top || l.Size == 0 {
+			break
+		}
+		share := 0.0
+		if total > 0 {
+			share = 100 * float64(l.Size) / float64(total)
+		}
+		fmt.Fprintf(out, "%9s %5.1f%%  %s\n", humanBytes(l.Size), share, layerInstruction(l.CreatedBy, 90))
+	}
+	return nil
+}
+
+// imagePush handles `image push [--image REF] <registry/repo:tag>`. The
+// pushed image is a thin layer over the local build carrying provenance
+// labels, so whoever pulls it can see who published which build.
+func imagePush(dx dockerx.Docker, args []string, out io.Writer, now time.Time) error {
+	src := "claudex"
+	var ref string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "--image":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--image requires a value")
+			}
+			src = args[i+1]
+			i++
+		case strings.HasPrefix(a, "-"):
+			return fmt.Errorf("unknown arg: %s", a)
+		case ref == "":
+			ref = a
+		default:
+			return fmt.Errorf("unexpected arg: %s", a)
+		}
+	}
+	if ref == "" {
+		return fmt.Errorf("usage: claudex image push [--image REF] <registry/repo:tag>")
+	}
+	srcID := src
+	if imgs, err := dx.Images(dockerx.BuiltLabel); err == nil {
+		for _, img := range imgs {
+			if img.Repository+":"+img.Tag == src || img.Repository == src && img.Tag == "latest" {
+				srcID = img.ID
+			}
+		}
+	}
+	labels := map[string]string{
+		PublishedByLabel:  publisher(),
+		PublishedAtLabel:  now.UTC().Format(time.RFC3339),
+		SourceImageLabel:  srcID,
+		PublisherCLILabel: version.Version,
+	}
+	fmt.Fprintf(out, "Tagging %s as %s...\n", src, ref)
+	opts := dockerx.BuildOptions{Labels: labels, Context: strings.NewReader("FROM " + src + "\n")}
+	if err := dx.Build(ref, "-", opts); err != nil {
+		return fmt.Errorf("tag %s: %w", ref, err)
+	}
+	fmt.Fprintf(out, "Pushing %s...\n", ref)
+	if err := dx.Stream("push", ref); err != nil {
+		return fmt.Errorf("docker push %s failed: %w", ref, err)
+	}
+	fmt.Fprintf(out, "Published %s. Teammates can run: claudex image pull %s\n", ref, ref)
+	return nil
+}
+
+// imagePull handles `image pull [--as TAG] <registry/repo:tag>`, tagging the
+// pulled image as the local claudex image.
+func imagePull(dx dockerx.Docker, args []string, out io.Writer) error {
+	as := "claudex"
+	var ref string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "--as":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--as requires a value")
+			}
+			as = args[i+1]
+			i++
+		case strings.HasPrefix(a, "-"):
+			return fmt.Errorf("unknown arg: %s", a)
+		case ref == "":
+			ref = a
+		default:
+			return fmt.Errorf("unexpected arg: %s", a)
+		}
+	}
+	if ref == "" {
+		return fmt.Errorf("usage: claudex image pull [--as TAG] <registry/repo:tag>")
+	}
+	fmt.Fprintf(out, "Pulling %s...\n", ref)
+	if err := dx.Stream("pull", ref); err != nil {
+		return fmt.Errorf("docker pull %s failed: %w", ref, err)
+	}
+	if err := dx.Run("tag", ref, as); err != nil {
+		return fmt.Errorf("docker tag %s %s failed: %w", ref, as, err)
+	}
+	labels, err := dx.ImageLabels(ref)
+	if err != nil {
+		return err
+	}
+	if by := labels[PublishedByLabel]; by != "" {
+		fmt.Fprintf(out, "Published by %s at %s (claudex %s)\n", by, labels[PublishedAtLabel], labels[PublisherCLILabel])
+	} else {
+		output.Warnf(out, "%s has no claudex provenance labels; it was not published with claudex image push\n", ref)
+	}
+	if v := labels[PublisherCLILabel]; v != "" && v != version.Version {
+		output.Warnf(out, "published with claudex %s; this is %s\n", v, version.Version)
+	}
+	fmt.Fprintf(out, "Tagged %s as %s\n", ref, as)
+	return nil
+}
+
+// publisher identifies who pushed an image, as user@host.
+func publisher() string {
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, _ := os.Hostname()
+	return name + "@" + host
+}
+
+// layerInstruction shortens a docker history CREATED BY to one line of at
+// most max runes, dropping the shell and #(nop) prefixes.
+func layerInstruction(s string, max int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	s = strings.TrimPrefix(s, "/bin/sh -c ")
+	s = strings.TrimPrefix(s, "#(nop) ")
+	if r := []rune(s); len(r) > max {
+		s = string(r[:max-3]) + "..."
+	}
+	return s
+}
+
+// humanBytes formats a byte count with binary units.
+func humanBytes(n int64) string {
+	return humanKiB(n >> 10)
+}
+
+// Images implements `claudex images list`, showing every image claudex has
+// built, including superseded ones whose tag moved to a newer build.
+func Images(args []string) error {
+	return imagesWithDocker(dockerx.New(), args, os.Stdout)
+}
+
+func imagesWithDocker(dx dockerx.Docker, args []string, out io.Writer) error {
+	if len(args) != 1 || args[0] != "list" {
+		return fmt.Errorf("usage: claudex images list")
+	}
+	imgs, err := dx.Images(dockerx.BuiltLabel)
+	if err != nil {
+		return err
+	}
+	if len(imgs) == 0 {
+		fmt.Fprintln(out, "No claudex-built images.")
+		return nil
+	}
+	sort.SliceStable(imgs, func(i, j int) bool { return imgs[i].CreatedAt.After(imgs[j].CreatedAt) })
+	var total, stale int64
+	fmt.Fprintf(out, "%-12s  %-30s %-16s %9s\n", "IMAGE ID", "TAG", "BUILT", "SIZE")
+	for _, img := range imgs {
+		tag := img.Repository + ":" + img.Tag
+		if untagged(img) {
+			tag = "<superseded>"
+			stale += img.Size
+		}
+		fmt.Fprintf(out, "%-12s  %-30s %-16s %9s\n", shortImageID(img.ID), tag, img.CreatedAt.Local().Format("2006-01-02 15:04"), humanBytes(img.Size))
+		total += img.Size
+	}
+	fmt.Fprintf(out, "\n%d images, %s (%s superseded; reclaim with claudex update --prune-old)\n", len(imgs), humanBytes(total), humanBytes(stale))
+	return nil
+}
+
+// pruneOldImages removes superseded claudex builds. Images still used by a
+// container are refused by docker and kept.
+func pruneOldImages(dx dockerx.Docker, out io.Writer) error {
+	imgs, err := dx.Images(dockerx.BuiltLabel)
+	if err != nil {
+		return err
+	}
+	var removed int
+	var freed int64
+	for _, img := range imgs {
+		if !untagged(img) {
+			continue
+		}
+		if err := dx.Run("rmi", img.ID); err != nil {
+			fmt.Fprintf(out, "Keeping %s (in use by a container?)\n", shortImageID(img.ID))
+			continue
+		}
+		removed++
+		freed += img.Size
+	}
+	fmt.Fprintf(out, "Removed %d old images, %s reclaimed\n", removed, humanBytes(freed))
+	return nil
+}
+
+// untagged reports whether a build has been superseded by a newer one.
+func untagged(img dockerx.Image) bool {
+	return img.Repository == "<none>" && img.Tag == "<none>"
+}
+
+// shortImageID trims "sha256:" and the digest to docker's 12 characters.
+func shortImageID(id string) string {
+	id = strings.TrimPrefix(id, "sha256:")
+	if len(id) > 12 {
+		id = id[:12]
+	}
+	return id
+}
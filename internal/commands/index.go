@@ -0,0 +1,63 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/index"
+)
+
+// Index implements `claudex index [<TARGET>] [--json]`: it rebuilds the
+// container's file index (see package index) and reports what it holds.
+func Index(args []string) error {
+	return indexWithDocker(dockerx.New(), args, os.Stdout)
+}
+
+func indexWithDocker(dx dockerx.Docker, args []string, out io.Writer) error {
+	var t targetSpec
+	asJSON := false
+	for i := 0; i < len(args); i++ {
+		if ok, err := t.flag(args, &i); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		switch args[i] {
+		case "--json":
+			asJSON = true
+		default:
+			if err := t.positional(args[i]); err != nil {
+				return err
+			}
+		}
+	}
+	target, err := t.resolve(dx, true)
+	if err != nil {
+		return err
+	}
+	if !asJSON {
+		fmt.Fprintf(out, "Indexing /workspace in %s...\n", target)
+	}
+	res, err := dx.ExecOutput(target, index.Command())
+	if err != nil {
+		return fmt.Errorf("index failed: %v: %s", err, strings.TrimSpace(string(res)))
+	}
+	var info index.Info
+	if err := json.Unmarshal(res, &info); err != nil {
+		return fmt.Errorf("index built but its summary is unreadable: %v", err)
+	}
+	if asJSON {
+		return writeJSON(out, info)
+	}
+	tags := "no tags (universal-ctags is not installed)"
+	if info.Tags {
+		tags = "tags in " + index.Tags
+	}
+	fmt.Fprintf(out, "Indexed %d files in %s: file list in %s, %s\n", info.Files, time.Duration(info.Seconds)*time.Second, index.Files, tags)
+	return nil
+}
@@ -0,0 +1,139 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/photodialectic/claudex/internal/containers"
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/run"
+	"github.com/photodialectic/claudex/internal/state"
+)
+
+// lineageDepth bounds the source-image chain inspect follows.
+const lineageDepth = 8
+
+// InspectReport is what `claudex inspect` prints: the container as docker
+// reports it and what claudex derives from its labels and state store.
+type InspectReport struct {
+	Container dockerx.Container `json:"container"`
+	Claudex   InspectClaudex    `json:"claudex"`
+}
+
+// InspectClaudex is the claudex-specific part of an InspectReport.
+type InspectClaudex struct {
+	Signature string `json:"signature"`
+	Slug      string `json:"slug"`
+	// Version is the claudex that created the container.
+	Version string `json:"version,omitempty"`
+	// Schema is the container's label schema; Current is false when
+	// `claudex migrate` would rewrite it.
+	Schema  int  `json:"schema"`
+	Current bool `json:"current"`
+	// Mounts is the parsed mounts label; MountsError explains a label that
+	// does not parse.
+	Mounts      []string `json:"mounts"`
+	MountsError string   `json:"mounts_error,omitempty"`
+	Workspace   string   `json:"workspace,omitempty"`
+	Volume      string   `json:"volume,omitempty"`
+	AdoptedFrom string   `json:"adopted_from,omitempty"`
+	// Lineage follows the container's image through its source-image
+	// labels, the container's own image first.
+	Lineage []InspectImage `json:"lineage"`
+	// Session is the state store's record, nil for containers it never saw.
+	Session *state.Session `json:"session"`
+}
+
+// InspectImage is one image in a container's lineage.
+type InspectImage struct {
+	Ref         string `json:"ref"`
+	Built       string `json:"built,omitempty"`
+	PublishedBy string `json:"published_by,omitempty"`
+	PublishedAt string `json:"published_at,omitempty"`
+	Missing     bool   `json:"missing,omitempty"`
+}
+
+// Inspect implements `claudex inspect [NAME | --name NAME | --signature
+// HASH | --last]`, printing one JSON document for tooling.
+func Inspect(args []string) error {
+	return inspectWithDocker(dockerx.New(), args, os.Stdout)
+}
+
+func inspectWithDocker(dx dockerx.Docker, args []string, out io.Writer) error {
+	var t targetSpec
+	for i := 0; i < len(args); i++ {
+		if ok, err := t.flag(args, &i); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		if err := t.positional(args[i]); err != nil {
+			return err
+		}
+	}
+	// Stopped containers are worth inspecting too.
+	target, err := t.resolve(dx, false)
+	if err != nil {
+		return err
+	}
+	c, err := dx.Inspect(target)
+	if err != nil {
+		return err
+	}
+	info := &c
+	if !containers.IsClaudex(info) {
+		return fmt.Errorf("%s is not a claudex container", info.Name)
+	}
+
+	l := info.Labels
+	r := InspectReport{Container: *info, Claudex: InspectClaudex{
+		Signature:   l["com.claudex.signature"],
+		Slug:        l["com.claudex.slug"],
+		Version:     l["com.claudex.version"],
+		Schema:      containers.LabelSchema(info),
+		Workspace:   l[run.WorkspaceLabel],
+		Volume:      l[run.VolumeLabel],
+		AdoptedFrom: l[run.AdoptedLabel],
+		Mounts:      []string{},
+	}}
+	r.Claudex.Current = r.Claudex.Schema == containers.Schema
+	if mounts, err := containers.MountsFromLabel(info); err != nil {
+		r.Claudex.MountsError = err.Error()
+	} else if mounts != nil {
+		r.Claudex.Mounts = mounts
+	}
+	r.Claudex.Lineage = imageLineage(dx, info.Image)
+	if st, err := state.Load(); err == nil {
+		if sess, ok := st.Get(info.Name); ok {
+			r.Claudex.Session = sess
+		}
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// imageLineage walks ref and the images its source-image labels name. An
+// image no longer present ends the chain as Missing.
+func imageLineage(dx dockerx.Docker, ref string) []InspectImage {
+	lineage := []InspectImage{}
+	seen := map[string]bool{}
+	for ref != "" && !seen[ref] && len(lineage) < lineageDepth {
+		seen[ref] = true
+		img := InspectImage{Ref: ref}
+		labels, err := dx.ImageLabels(ref)
+		if err != nil {
+			img.Missing = true
+			lineage = append(lineage, img)
+			break
+		}
+		img.Built = labels[dockerx.BuiltLabel]
+		img.PublishedBy = labels[PublishedByLabel]
+		img.PublishedAt = labels[PublishedAtLabel]
+		lineage = append(lineage, img)
+		ref = labels[SourceImageLabel]
+	}
+	return lineage
+}
@@ -0,0 +1,100 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/run"
+	"github.com/photodialectic/claudex/internal/state"
+)
+
+// linkedResources lists what `destroy --volumes` and `--snapshots` remove
+// along with victims: claudex volumes they mount (the per-signature
+// workspace volume included) and images claudex committed for them.
+// Anything a survivor still uses is kept.
+func linkedResources(dx dockerx.Docker, victims, survivors []dockerx.Container, volumes, snapshots bool) (vols, images []string) {
+	usedVols := map[string]bool{}
+	usedImages := map[string]bool{}
+	for _, c := range survivors {
+		for _, v := range claudexVolumes(c) {
+			usedVols[v] = true
+		}
+		usedImages[c.Image] = true
+	}
+	var sessions *state.Store
+	if snapshots {
+		sessions, _ = state.Load()
+	}
+	seen := map[string]bool{}
+	for _, c := range victims {
+		if volumes {
+			for _, v := range claudexVolumes(c) {
+				if !usedVols[v] && !seen["v:"+v] {
+					seen["v:"+v] = true
+					vols = append(vols, v)
+				}
+			}
+		}
+		if !snapshots {
+			continue
+		}
+		refs := run.SnapshotImages(c.Name, c.Image)
+		if sessions != nil {
+			if sess, ok := sessions.Get(c.Name); ok {
+				refs = append(refs, sess.Snapshots...)
+			}
+		}
+		for _, ref := range refs {
+			if usedImages[ref] || seen["i:"+ref] {
+				continue
+			}
+			seen["i:"+ref] = true
+			if ok, err := dx.ImageExists(ref); err == nil && ok {
+				images = append(images, ref)
+			}
+		}
+	}
+	sort.Strings(vols)
+	sort.Strings(images)
+	return vols, images
+}
+
+// claudexVolumes returns the volumes claudex created for c: its workspace
+// volume and any mounted volume named claudex-*.
+func claudexVolumes(c dockerx.Container) []string {
+	var vols []string
+	if v := c.Labels[run.VolumeLabel]; v != "" {
+		vols = append(vols, v)
+	}
+	for _, m := range c.Mounts {
+		if m.Type == "volume" && strings.HasPrefix(m.Name, "claudex-") && m.Name != c.Labels[run.VolumeLabel] {
+			vols = append(vols, m.Name)
+		}
+	}
+	return vols
+}
+
+// removeLinked deletes the volumes and images found by linkedResources,
+// warning about each one that cannot be removed, and returns those it did.
+func removeLinked(dx dockerx.Docker, vols, images []string, out, errOut io.Writer) (removedVols, removedImages []string) {
+	for _, v := range vols {
+		fmt.Fprintf(out, "Removing volume %s...\n", v)
+		if err := dx.Run("volume", "rm", v); err != nil {
+			fmt.Fprintf(errOut, "Failed to remove volume %s: %v\n", v, err)
+			continue
+		}
+		removedVols = append(removedVols, v)
+	}
+	for _, img := range images {
+		fmt.Fprintf(out, "Removing image %s...\n", img)
+		if err := dx.Run("rmi", img); err != nil {
+			fmt.Fprintf(errOut, "Failed to remove image %s: %v\n", img, err)
+			continue
+		}
+		removedImages = append(removedImages, img)
+	}
+	return removedVols, removedImages
+}
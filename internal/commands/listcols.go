@@ -0,0 +1,180 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/output"
+)
+
+// listItem is one row of `claudex list`: the JSON output and the value
+// --format templates see ({{.Name}}, {{.Signature}}, {{index .Labels "k"}}).
+type listItem struct {
+	Name         string            `json:"name"`
+	Status       string            `json:"status"`
+	Created      time.Time         `json:"created"`
+	Image        string            `json:"image"`
+	Labels       map[string]string `json:"labels"`
+	Mounts       []string          `json:"mounts"`
+	Signature    string            `json:"signature"`
+	Slug         string            `json:"slug"`
+	Owner        string            `json:"owner,omitempty"`
+	LastAttached *time.Time        `json:"last_attached,omitempty"`
+	// Disk is set with --size (or a size column).
+	Disk *containerDisk `json:"disk,omitempty"`
+}
+
+// containerDisk is a container's share of `docker system df`: its writable
+// layer and the volumes it mounts, in bytes.
+type containerDisk struct {
+	Writable int64            `json:"writable"`
+	Volumes  map[string]int64 `json:"volumes,omitempty"`
+}
+
+// VolumeTotal sums the container's volumes.
+func (d containerDisk) VolumeTotal() int64 {
+	var n int64
+	for _, v := range d.Volumes {
+		n += v
+	}
+	return n
+}
+
+func (d *containerDisk) total() int64 {
+	if d == nil {
+		return 0
+	}
+	return d.Writable + d.VolumeTotal()
+}
+
+func diskFor(du dockerx.DiskUsage, c dockerx.Container) *containerDisk {
+	d := &containerDisk{Writable: du.Containers[c.Name]}
+	for _, m := range c.Mounts {
+		if m.Type != "volume" || m.Name == "" {
+			continue
+		}
+		if d.Volumes == nil {
+			d.Volumes = map[string]int64{}
+		}
+		d.Volumes[m.Name] = du.Volumes[m.Name]
+	}
+	return d
+}
+
+// listColumn is a column `list --columns` can show.
+type listColumn struct {
+	header string
+	// width is the column's minimum; longer cells widen it.
+	width int
+	value func(listItem) string
+}
+
+var listColumns = map[string]listColumn{
+	"name":      {"NAME", 32, func(i listItem) string { return i.Name }},
+	"status":    {"STATUS", 10, func(i listItem) string { return i.Status }},
+	"created":   {"CREATED", 20, func(i listItem) string { return i.Created.Format("2006-01-02 15:04:05") }},
+	"signature": {"SIGNATURE", 10, func(i listItem) string { return i.Signature }},
+	"mounts":    {"MOUNTS", 8, func(i listItem) string { return strconv.Itoa(len(i.Mounts)) }},
+	"slug":      {"SLUG", 16, func(i listItem) string { return i.Slug }},
+	"image":     {"IMAGE", 10, func(i listItem) string { return i.Image }},
+	"owner": {"OWNER", 10, func(i listItem) string {
+		if i.Owner == "" {
+			return "-"
+		}
+		return i.Owner
+	}},
+	"size": {"SIZE", 10, func(i listItem) string {
+		if i.Disk == nil {
+			return "-"
+		}
+		return humanBytes(i.Disk.Writable)
+	}},
+	"volumes": {"VOLUMES", 10, func(i listItem) string {
+		if i.Disk == nil || len(i.Disk.Volumes) == 0 {
+			return "-"
+		}
+		return humanBytes(i.Disk.VolumeTotal())
+	}},
+	"attached": {"LAST ATTACHED", 20, func(i listItem) string {
+		if i.LastAttached == nil {
+			return "-"
+		}
+		return i.LastAttached.Format("2006-01-02 15:04:05")
+	}},
+}
+
+var defaultListColumns = []string{"name", "status", "created", "signature", "mounts", "slug", "image"}
+
+// listSorts order rows for `list --sort`; ties keep creation order.
+var listSorts = map[string]func(a, b listItem) bool{
+	"created": func(a, b listItem) bool { return a.Created.Before(b.Created) },
+	"name":    func(a, b listItem) bool { return a.Name < b.Name },
+	// Running containers first, then the rest grouped by status.
+	"status": func(a, b listItem) bool {
+		if (a.Status == "running") != (b.Status == "running") {
+			return a.Status == "running"
+		}
+		return a.Status < b.Status
+	},
+	// Largest first, writable layer and volumes together; implies --size.
+	"size": func(a, b listItem) bool { return a.Disk.total() > b.Disk.total() },
+}
+
+func listColumnNames() []string {
+	names := make([]string, 0, len(listColumns))
+	for n := range listColumns {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// printListTable pads each column to its minimum width, widened to its
+// longest cell, so long names and images are never cut off or pushed out
+// of line.
+func printListTable(out io.Writer, items []listItem, columns []string) error {
+	rows := [][]string{make([]string, len(columns))}
+	widths := make([]int, len(columns))
+	for i, col := range columns {
+		rows[0][i] = listColumns[col].header
+		widths[i] = listColumns[col].width
+	}
+	for _, item := range items {
+		row := make([]string, len(columns))
+		for i, col := range columns {
+			row[i] = listColumns[col].value(item)
+		}
+		rows = append(rows, row)
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			if n := utf8.RuneCountInString(cell); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	for r, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			if r > 0 && columns[i] == "status" {
+				cells[i] = output.Status(out, cell, widths[i])
+			} else {
+				cells[i] = fmt.Sprintf("%-*s", widths[i], cell)
+			}
+		}
+		line := strings.Join(cells, " ")
+		if r == 0 {
+			line = output.Paint(out, output.Bold, line)
+		}
+		if _, err := fmt.Fprintln(out, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
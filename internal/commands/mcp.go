@@ -0,0 +1,72 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/photodialectic/claudex/internal/agent"
+	"github.com/photodialectic/claudex/internal/dockerx"
+)
+
+// MCP implements `claudex mcp [list] | restart <SERVER> [--name NAME]` for
+// the MCP servers the container's supervisor keeps running.
+func MCP(args []string) error {
+	return mcpWithDocker(dockerx.New(), args, os.Stdout)
+}
+
+func mcpWithDocker(dx dockerx.Docker, args []string, out io.Writer) error {
+	sub := "list"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		sub, args = args[0], args[1:]
+	}
+	var t targetSpec
+	var servers []string
+	for i := 0; i < len(args); i++ {
+		if ok, err := t.flag(args, &i); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		switch a := args[i]; a {
+		default:
+			if strings.HasPrefix(a, "-") {
+				return fmt.Errorf("unknown arg: %s", a)
+			}
+			servers = append(servers, a)
+		}
+	}
+	switch {
+	case sub == "list" && len(servers) > 0:
+		return fmt.Errorf("mcp list takes no server names")
+	case sub == "restart" && len(servers) == 0:
+		return fmt.Errorf("mcp restart requires a server name")
+	case sub != "list" && sub != "restart":
+		return fmt.Errorf("unknown mcp command: %s", sub)
+	}
+	target, err := t.resolve(dx, true)
+	if err != nil {
+		return err
+	}
+	if sub == "list" {
+		var list []agent.Server
+		if _, err := agent.Get(dx, target, "/mcp", &list); err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			fmt.Fprintf(out, "No MCP servers supervised in %s (add executables to ~/.claudex/mcp in the container).\n", target)
+			return nil
+		}
+		printServers(out, list)
+		return nil
+	}
+	for _, s := range servers {
+		if _, err := agent.Do(dx, target, "POST", "/mcp/"+url.PathEscape(s)+"/restart"); err != nil {
+			return fmt.Errorf("restart %s: %w", s, err)
+		}
+		fmt.Fprintf(out, "Restarting %s in %s\n", s, target)
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/photodialectic/claudex/internal/config"
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/mcpserver"
+	"github.com/photodialectic/claudex/internal/version"
+)
+
+// MCPServer implements `claudex mcp-server`: it serves claudex operations as
+// MCP tools over stdio, so an agent on the host can orchestrate containers.
+// Stdout carries the protocol; everything else goes to stderr.
+func MCPServer(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unknown arg: %s", args[0])
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	return mcpTools(dockerx.New(), cfg.Tasks).Serve(os.Stdin, os.Stdout)
+}
+
+// containerArg is the optional container every tool accepts; without it the
+// only running container is used.
+var containerArg = map[string]any{"type": "string", "description": "Container name, or an unambiguous abbreviation. Optional when exactly one is running."}
+
+func mcpTools(dx dockerx.Docker, tasks map[string]config.Task) *mcpserver.Server {
+	return &mcpserver.Server{
+		Name:    "claudex",
+		Version: version.Version,
+		Tools: []mcpserver.Tool{
+			{
+				Name:        "list_containers",
+				Description: "List claudex containers as JSON: name, status, workspace mounts, labels.",
+				InputSchema: schema(map[string]any{
+					"all": map[string]any{"type": "boolean", "description": "Include stopped containers."},
+				}),
+				Call: func(raw json.RawMessage) (string, error) {
+					var a struct {
+						All bool `json:"all"`
+					}
+					if err := json.Unmarshal(raw, &a); err != nil {
+						return "", err
+					}
+					args := []string{"--format", "json"}
+					if a.All {
+						args = append(args, "--all")
+					}
+					var out bytes.Buffer
+					err := listWithDocker(dx, args, &out)
+					return out.String(), err
+				},
+			},
+			{
+				Name:        "push_files",
+				Description: "Copy host files or directories into a running container, under /workspace or a directory relative to it. A trailing /. copies a directory's contents.",
+				InputSchema: schema(map[string]any{
+					"container": containerArg,
+					"paths":     map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Host paths to copy."},
+					"to":        map[string]any{"type": "string", "description": "Destination directory in the container (default /workspace)."},
+				}, "paths"),
+				Call: func(raw json.RawMessage) (string, error) {
+					var a struct {
+						Container string   `json:"container"`
+						Paths     []string `json:"paths"`
+						To        string   `json:"to"`
+					}
+					if err := json.Unmarshal(raw, &a); err != nil {
+						return "", err
+					}
+					var args []string
+					if a.Container != "" {
+						args = append(args, "--name", a.Container)
+					}
+					if a.To != "" {
+						args = append(args, "--to", a.To)
+					}
+					var out bytes.Buffer
+					err := pushWithDocker(dx, append(args, a.Paths...), &out)
+					return out.String(), err
+				},
+			},
+			{
+				Name:        "pull_files",
+				Description: "Copy a file or directory out of a running container into a host directory, reporting what was added or changed. Refuses to overwrite modified host files unless force is set.",
+				InputSchema: schema(map[string]any{
+					"container": containerArg,
+					"path":      map[string]any{"type": "string", "description": "Path in the container, e.g. /workspace/app/dist."},
+					"dest":      map[string]any{"type": "string", "description": "Host directory (default /tmp)."},
+					"force":     map[string]any{"type": "boolean", "description": "Overwrite host files that differ."},
+					"stage":     map[string]any{"type": "string", "description": "Only copy into this host directory for review."},
+				}, "path"),
+				Call: func(raw json.RawMessage) (string, error) {
+					var a struct {
+						Container string `json:"container"`
+						Path      string `json:"path"`
+						Dest      string `json:"dest"`
+						Force     bool   `json:"force"`
+						Stage     string `json:"stage"`
+					}
+					if err := json.Unmarshal(raw, &a); err != nil {
+						return "", err
+					}
+					if a.Path == "" {
+						return "", fmt.Errorf("path is required")
+					}
+					if a.Dest == "" {
+						a.Dest = "/tmp"
+					}
+					target, err := targetSpec{Name: a.Container}.resolve(dx, true)
+					if err != nil {
+						return "", err
+					}
+					var out bytes.Buffer
+					_, err = pullInto(dx, []string{target + ":" + a.Path}, "", a.Dest, a.Stage, a.Force, &out)
+					return out.String(), err
+				},
+			},
+			{
+				Name:        "run_task",
+				Description: "Run a task defined under tasks: in the claudex config inside a running container and return its output. Call without a task to list them.",
+				InputSchema: schema(map[string]any{
+					"container": containerArg,
+					"task":      map[string]any{"type": "string", "description": "Task name."},
+				}),
+				Call: func(raw json.RawMessage) (string, error) {
+					var a struct {
+						Container string `json:"container"`
+						Task      string `json:"task"`
+					}
+					if err := json.Unmarshal(raw, &a); err != nil {
+						return "", err
+					}
+					var args []string
+					if a.Task != "" {
+						args = append(args, a.Task)
+					}
+					if a.Container != "" {
+						args = append(args, "--name", a.Container)
+					}
+					var out bytes.Buffer
+					err := taskWithDocker(dx, tasks, args, &out, &out)
+					return out.String(), err
+				},
+			},
+			{
+				Name:        "read_logs",
+				Description: "Read the last lines of a container's log (its supervisor's output).",
+				InputSchema: schema(map[string]any{
+					"container": containerArg,
+					"tail":      map[string]any{"type": "integer", "description": "Number of lines (default 200)."},
+				}),
+				Call: func(raw json.RawMessage) (string, error) {
+					var a struct {
+						Container string `json:"container"`
+						Tail      int    `json:"tail"`
+					}
+					if err := json.Unmarshal(raw, &a); err != nil {
+						return "", err
+					}
+					if a.Tail <= 0 {
+						a.Tail = 200
+					}
+					target, err := targetSpec{Name: a.Container}.resolve(dx, false)
+					if err != nil {
+						return "", err
+					}
+					logs, err := dx.Logs(target, a.Tail)
+					return strings.TrimRight(string(logs), "\n"), err
+				},
+			},
+		},
+	}
+}
+
+// schema is the JSON Schema of an object with properties, of which required
+// must be given.
+func schema(properties map[string]any, required ...string) map[string]any {
+	s := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
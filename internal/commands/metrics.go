@@ -0,0 +1,178 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/containers"
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/state"
+)
+
+// DefaultMetricsAddr is where `claudex metrics serve` listens by default.
+const DefaultMetricsAddr = ":9309"
+
+// Metrics implements `claudex metrics [--textfile PATH]` and
+// `claudex metrics serve [--addr ADDR]`.
+func Metrics(args []string) error {
+	return metricsWithDocker(dockerx.New(), args, stdStreams())
+}
+
+func metricsWithDocker(dx dockerx.Docker, args []string, s Streams) error {
+	if len(args) > 0 && args[0] == "serve" {
+		addr := DefaultMetricsAddr
+		rest := args[1:]
+		for i := 0; i < len(rest); i++ {
+			switch rest[i] {
+			case "--addr":
+				if i+1 >= len(rest) {
+					return fmt.Errorf("--addr requires a value like :9309")
+				}
+				addr = rest[i+1]
+				i++
+			default:
+				return fmt.Errorf("unknown arg: %s", rest[i])
+			}
+		}
+		http.Handle("/metrics", metricsHandler(dx))
+		fmt.Fprintf(s.Out, "Serving claudex metrics on %s/metrics\n", addr)
+		return http.ListenAndServe(addr, nil)
+	}
+	var textfile string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--textfile":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--textfile requires a path")
+			}
+			textfile = args[i+1]
+			i++
+		default:
+			return fmt.Errorf("unknown arg: %s", args[i])
+		}
+	}
+	body, err := gatherMetrics(dx, time.Now())
+	if err != nil {
+		return err
+	}
+	if textfile == "" {
+		_, err = s.Out.Write(body)
+		return err
+	}
+	return writeFileAtomic(textfile, body)
+}
+
+func metricsHandler(dx dockerx.Docker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := gatherMetrics(dx, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write(body)
+	})
+}
+
+func gatherMetrics(dx dockerx.Docker, now time.Time) ([]byte, error) {
+	cons, err := containers.List(dx, true)
+	if err != nil {
+		return nil, err
+	}
+	st, err := state.Load()
+	if err != nil {
+		return nil, err
+	}
+	return renderMetrics(dx, cons, st.All(), now), nil
+}
+
+// renderMetrics writes the Prometheus text exposition format. Stats and image
+// lookups that fail are skipped so one bad container doesn't blank the page.
+func renderMetrics(dx dockerx.Docker, cons []dockerx.Container, sessions []state.Session, now time.Time) []byte {
+	var b bytes.Buffer
+	var running []string
+	images := map[string]bool{}
+	for _, c := range cons {
+		if c.Status == "running" {
+			running = append(running, c.Name)
+		}
+		if c.Image != "" {
+			images[c.Image] = true
+		}
+	}
+
+	b.WriteString("# HELP claudex_containers Number of claudex containers by state.\n# TYPE claudex_containers gauge\n")
+	fmt.Fprintf(&b, "claudex_containers{state=\"running\"} %d\n", len(running))
+	fmt.Fprintf(&b, "claudex_containers{state=\"stopped\"} %d\n", len(cons)-len(running))
+
+	stats, _ := dx.Stats(running...)
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	b.WriteString("# HELP claudex_container_cpu_percent CPU usage of a running container (100 = one core).\n# TYPE claudex_container_cpu_percent gauge\n")
+	for _, s := range stats {
+		fmt.Fprintf(&b, "claudex_container_cpu_percent{name=%q} %g\n", s.Name, s.CPUPercent)
+	}
+	b.WriteString("# HELP claudex_container_memory_bytes Memory used by a running container.\n# TYPE claudex_container_memory_bytes gauge\n")
+	for _, s := range stats {
+		fmt.Fprintf(&b, "claudex_container_memory_bytes{name=%q} %d\n", s.Name, s.MemoryBytes)
+	}
+
+	refs := make([]string, 0, len(images))
+	for ref := range images {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	b.WriteString("# HELP claudex_image_age_seconds Time since the image used by claudex containers was built.\n# TYPE claudex_image_age_seconds gauge\n")
+	for _, ref := range refs {
+		if t, err := dx.ImageCreated(ref); err == nil {
+			fmt.Fprintf(&b, "claudex_image_age_seconds{image=%q} %.0f\n", ref, now.Sub(t).Seconds())
+		}
+	}
+
+	b.WriteString("# HELP claudex_session_age_seconds Time since a live session's container was created.\n# TYPE claudex_session_age_seconds gauge\n")
+	for _, s := range sessions {
+		if !s.Removed() && !s.CreatedAt.IsZero() {
+			fmt.Fprintf(&b, "claudex_session_age_seconds{name=%q} %.0f\n", s.Name, now.Sub(s.CreatedAt).Seconds())
+		}
+	}
+	b.WriteString("# HELP claudex_session_idle_seconds Time since a live session was last attached.\n# TYPE claudex_session_idle_seconds gauge\n")
+	for _, s := range sessions {
+		if !s.Removed() && !s.LastAttached.IsZero() {
+			fmt.Fprintf(&b, "claudex_session_idle_seconds{name=%q} %.0f\n", s.Name, now.Sub(s.LastAttached).Seconds())
+		}
+	}
+	b.WriteString("# HELP claudex_session_lifetime_seconds Lifetime of destroyed sessions.\n# TYPE claudex_session_lifetime_seconds gauge\n")
+	for _, s := range sessions {
+		if s.Removed() && !s.CreatedAt.IsZero() {
+			fmt.Fprintf(&b, "claudex_session_lifetime_seconds{name=%q} %.0f\n", s.Name, s.RemovedAt.Sub(s.CreatedAt).Seconds())
+		}
+	}
+	return b.Bytes()
+}
+
+// writeFileAtomic replaces path via a temp file in the same directory, as
+// node_exporter's textfile collector expects.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".claudex-metrics-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,96 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/photodialectic/claudex/internal/containers"
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/output"
+	"github.com/photodialectic/claudex/internal/run"
+)
+
+// Migrate implements `claudex migrate [--dry-run] [--yes] [NAME...]`,
+// upgrading containers whose labels predate the current schema.
+func Migrate(args []string) error {
+	return migrateWithDocker(dockerx.New(), args, stdStreams())
+}
+
+func migrateWithDocker(dx dockerx.Docker, args []string, s Streams) error {
+	out, errOut := s.Out, s.Err
+	var names []string
+	dryRun, yes := false, false
+	for _, a := range args {
+		switch a {
+		case "--dry-run":
+			dryRun = true
+		case "--yes", "-y":
+			yes = true
+		default:
+			if strings.HasPrefix(a, "-") {
+				return fmt.Errorf("unknown arg: %s", a)
+			}
+			names = append(names, a)
+		}
+	}
+	cons, err := containers.List(dx, true)
+	if err != nil {
+		return err
+	}
+	want := map[string]bool{}
+	for _, n := range names {
+		want[n] = true
+	}
+	var stale []dockerx.Container
+	for _, c := range cons {
+		if len(want) > 0 && !want[c.Name] {
+			continue
+		}
+		delete(want, c.Name)
+		switch n := containers.LabelSchema(&c); {
+		case n > containers.Schema:
+			fmt.Fprintf(errOut, "Skipping %s: label schema %d is newer than this claudex (%d)\n", c.Name, n, containers.Schema)
+		case n < containers.Schema:
+			stale = append(stale, c)
+		}
+	}
+	for _, n := range names {
+		if want[n] {
+			return fmt.Errorf("%s is not a claudex container", n)
+		}
+	}
+	if len(stale) == 0 {
+		fmt.Fprintf(out, "All containers use label schema %d.\n", containers.Schema)
+		return nil
+	}
+	fmt.Fprintf(out, "%-32s %-10s %s\n", "NAME", "STATUS", "SCHEMA")
+	for _, c := range stale {
+		fmt.Fprintf(out, "%-32s %-10s %d -> %d\n", c.Name, c.Status, containers.LabelSchema(&c), containers.Schema)
+	}
+	if dryRun {
+		return nil
+	}
+	if !yes {
+		ok, err := s.Prompt.Confirm(output.T(output.MsgMigrateProceed))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Fprintln(out, output.T(output.MsgAborted))
+			return nil
+		}
+	}
+	failed := 0
+	for _, c := range stale {
+		if err := run.UpgradeLabels(c.Name, out, errOut, dx); err != nil {
+			fmt.Fprintf(errOut, "Failed to migrate %s: %v\n", c.Name, err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(out, "Migrated %s\n", c.Name)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d containers failed to migrate", failed, len(stale))
+	}
+	return nil
+}
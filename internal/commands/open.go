@@ -0,0 +1,175 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"sort"
+	"strconv"
+	"syscall"
+
+	"github.com/photodialectic/claudex/internal/config"
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/output"
+	"github.com/photodialectic/claudex/internal/run"
+)
+
+// Open implements `claudex open [<PORT|URL|APP>] [--local PORT] [<TARGET>]`:
+// it opens the host browser at a web app served in the container, forwarding
+// the port first (until Ctrl-C) unless the host already reaches it. APP
+// names an entry under `apps:` in config; without an argument the apps are
+// listed.
+func Open(args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(done)
+	return openWithDocker(dockerx.New(), cfg.Apps, args, os.Stdout, os.Stderr, done, openBrowser)
+}
+
+func openWithDocker(dx dockerx.Docker, apps map[string]config.App, args []string, out, errOut io.Writer, done <-chan os.Signal, browse func(string) error) error {
+	var t targetSpec
+	var what string
+	local := 0
+	for i := 0; i < len(args); i++ {
+		if ok, err := t.flag(args, &i); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		switch a := args[i]; {
+		case a == "--local":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--local requires a value")
+			}
+			i++
+			p, err := parsePort(args[i])
+			if err != nil {
+				return fmt.Errorf("--local: %w", err)
+			}
+			local = p
+		case what == "" && a != "" && a[0] != '-':
+			what = a
+		default:
+			if err := t.positional(a); err != nil {
+				return err
+			}
+		}
+	}
+	if what == "" {
+		if len(apps) == 0 {
+			fmt.Fprintf(out, "No apps defined. Add an apps: section to %s, or pass a port or URL.\n", config.ProjectFile)
+			return nil
+		}
+		names := make([]string, 0, len(apps))
+		for n := range apps {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		for _, n := range names {
+			fmt.Fprintf(out, "%-20s %-6d %s\n", n, apps[n].Port, apps[n].Path)
+		}
+		return nil
+	}
+	dest, err := appURL(what, apps)
+	if err != nil {
+		return err
+	}
+	port, _ := strconv.Atoi(dest.Port())
+	target, err := t.resolve(dx, true)
+	if err != nil {
+		return err
+	}
+	c, err := dx.Inspect(target)
+	if err != nil {
+		return err
+	}
+	if run.HostReachable(dx, c, port) && (local == 0 || local == port) {
+		fmt.Fprintf(out, "Opening %s\n", dest)
+		return browse(dest.String())
+	}
+	ln, err := listenLocal(local, port)
+	if err != nil {
+		return err
+	}
+	dest.Host = net.JoinHostPort("localhost", strconv.Itoa(ln.Addr().(*net.TCPAddr).Port))
+	fmt.Fprintf(out, "Forwarding %s to port %d in %s. Press Ctrl-C to stop.\n", dest.Host, port, target)
+	fmt.Fprintf(out, "Opening %s\n", dest)
+	if err := browse(dest.String()); err != nil {
+		output.Warnf(errOut, "cannot open a browser (%v); visit the URL yourself\n", err)
+	}
+	return serveForward(dx, target, port, ln, errOut, done)
+}
+
+// appURL turns a port, an app name or a URL printed inside the container
+// (http://0.0.0.0:5173/, http://localhost:8000/docs) into the URL to open on
+// the host, with localhost and the container port.
+func appURL(what string, apps map[string]config.App) (*url.URL, error) {
+	if _, err := strconv.Atoi(what); err == nil {
+		p, err := parsePort(what)
+		if err != nil {
+			return nil, err
+		}
+		return &url.URL{Scheme: "http", Host: net.JoinHostPort("localhost", strconv.Itoa(p)), Path: "/"}, nil
+	}
+	if app, ok := apps[what]; ok {
+		if _, err := parsePort(strconv.Itoa(app.Port)); err != nil {
+			return nil, fmt.Errorf("app %q: %w", what, err)
+		}
+		u := &url.URL{Scheme: "http", Host: net.JoinHostPort("localhost", strconv.Itoa(app.Port)), Path: "/"}
+		if app.Path != "" {
+			ref, err := url.Parse(app.Path)
+			if err != nil {
+				return nil, fmt.Errorf("app %q: invalid path: %w", what, err)
+			}
+			u = u.ResolveReference(ref)
+		}
+		return u, nil
+	}
+	u, err := url.Parse(what)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("unknown app %q: pass a port, an http(s) URL, or a name under apps: in %s", what, config.ProjectFile)
+	}
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+	}
+	u.Host = net.JoinHostPort("localhost", port)
+	return u, nil
+}
+
+// listenLocal listens on the host's loopback at local, or at the container
+// port when local is 0, falling back to any free port if that one is taken.
+func listenLocal(local, port int) (net.Listener, error) {
+	want := local
+	if want == 0 {
+		want = port
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(want)))
+	if err != nil && local == 0 {
+		ln, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen on localhost:%d: %w (pick another with --local)", want, err)
+	}
+	return ln, nil
+}
+
+// openBrowser opens url in the host's default browser.
+func openBrowser(url string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", url).Run()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Run()
+	}
+	return exec.Command("xdg-open", url).Run()
+}
@@ -0,0 +1,181 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/photodialectic/claudex/internal/buildctx"
+	"github.com/photodialectic/claudex/internal/dockerx"
+)
+
+// Package managers `claudex pkg add` installs with. A bare name is an apt
+// package; npm:NAME is a global npm package.
+const (
+	pkgApt = "apt"
+	pkgNpm = "npm"
+)
+
+var (
+	aptPkgRe = regexp.MustCompile(`^[a-z0-9][a-z0-9+.-]*(=[A-Za-z0-9.+~:-]+)?$`)
+	npmPkgRe = regexp.MustCompile(`^(@[a-z0-9][a-z0-9._-]*/)?[a-z0-9][a-z0-9._-]*(@[A-Za-z0-9.^~*-]+)?$`)
+)
+
+// aptInstallScript installs its arguments as root in a running container.
+const aptInstallScript = `apt-get update -qq && DEBIAN_FRONTEND=noninteractive apt-get install -y --no-install-recommends "$@" && rm -rf /var/lib/apt/lists/*`
+
+// pkgOverlayMarker starts each block `pkg add --persist` appends to the
+// overlay Dockerfile; the specs after it are what the block installs.
+const pkgOverlayMarker = "# claudex pkg add "
+
+// Pkg implements `claudex pkg add <PKG>... [<TARGET flags>] [--persist]`.
+func Pkg(args []string) error {
+	return pkgWithDocker(dockerx.New(), args, stdStreams())
+}
+
+func pkgWithDocker(dx dockerx.Docker, args []string, s Streams) error {
+	if len(args) == 0 || args[0] != "add" {
+		return fmt.Errorf("usage: claudex pkg add <PKG|npm:PKG>... [--name <NAME>] [--persist]")
+	}
+	t := targetSpec{prompt: s.Prompt}
+	var specs []string
+	persist := false
+	for i := 1; i < len(args); i++ {
+		if ok, err := t.flag(args, &i); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		switch a := args[i]; {
+		case a == "--persist":
+			persist = true
+		case strings.HasPrefix(a, "-"):
+			return fmt.Errorf("unknown arg: %s", a)
+		default:
+			specs = append(specs, a)
+		}
+	}
+	if len(specs) == 0 {
+		return fmt.Errorf("pkg add needs at least one package, e.g. jq or npm:typescript")
+	}
+	byManager, err := parsePkgs(specs)
+	if err != nil {
+		return err
+	}
+	target, err := t.resolve(dx, true)
+	if err != nil {
+		return err
+	}
+	if pkgs := byManager[pkgApt]; len(pkgs) > 0 {
+		fmt.Fprintf(s.Out, "Installing %s in %s with apt...\n", strings.Join(pkgs, " "), target)
+		cmd := append([]string{"-u", "root", target, "bash", "-c", aptInstallScript, "claudex-pkg"}, pkgs...)
+		if err := dx.ExecStream(cmd, s.Out, s.Err); err != nil {
+			return fmt.Errorf("apt-get install failed: %w", err)
+		}
+	}
+	if pkgs := byManager[pkgNpm]; len(pkgs) > 0 {
+		fmt.Fprintf(s.Out, "Installing %s in %s with npm...\n", strings.Join(pkgs, " "), target)
+		if err := dx.ExecStream(append([]string{target, "npm", "install", "-g"}, pkgs...), s.Out, s.Err); err != nil {
+			return fmt.Errorf("npm install failed: %w", err)
+		}
+	}
+	if !persist {
+		fmt.Fprintln(s.Out, "Installed. They last as long as the container; add --persist to include them in future builds.")
+		return nil
+	}
+	path, err := buildctx.OverlayPath()
+	if err != nil {
+		return err
+	}
+	added, err := persistPkgs(path, specs)
+	if err != nil {
+		return err
+	}
+	if len(added) == 0 {
+		fmt.Fprintf(s.Out, "Installed; %s already lists them.\n", path)
+		return nil
+	}
+	fmt.Fprintf(s.Out, "Installed, and added %s to %s; claudex build or update bakes them into the image.\n", strings.Join(added, " "), path)
+	return nil
+}
+
+// parsePkgs validates specs and groups the package names by manager, so
+// nothing that could break out of a shell word reaches a Dockerfile.
+func parsePkgs(specs []string) (map[string][]string, error) {
+	res := map[string][]string{}
+	for _, spec := range specs {
+		manager, name := pkgApt, spec
+		if m, n, ok := strings.Cut(spec, ":"); ok && (m == pkgApt || m == pkgNpm) {
+			manager, name = m, n
+		}
+		re := aptPkgRe
+		if manager == pkgNpm {
+			re = npmPkgRe
+		}
+		if !re.MatchString(name) {
+			return nil, fmt.Errorf("invalid %s package %q", manager, name)
+		}
+		res[manager] = append(res[manager], name)
+	}
+	return res, nil
+}
+
+// persistPkgs appends a block installing specs to the overlay Dockerfile at
+// path, skipping specs an earlier block already installs. It returns the
+// specs added.
+func persistPkgs(path string, specs []string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	have := map[string]bool{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if rest, ok := strings.CutPrefix(line, pkgOverlayMarker); ok {
+			for _, spec := range strings.Fields(rest) {
+				have[spec] = true
+			}
+		}
+	}
+	var added []string
+	for _, spec := range specs {
+		if !strings.HasPrefix(spec, pkgApt+":") && !strings.HasPrefix(spec, pkgNpm+":") {
+			spec = pkgApt + ":" + spec
+		}
+		if !have[spec] {
+			have[spec] = true
+			added = append(added, spec)
+		}
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+	byManager, err := parsePkgs(added)
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	if len(data) > 0 && !strings.HasSuffix(string(data), "\n") {
+		b.WriteString("\n")
+	}
+	b.WriteString(pkgOverlayMarker + strings.Join(added, " ") + "\n")
+	if pkgs := byManager[pkgApt]; len(pkgs) > 0 {
+		fmt.Fprintf(&b, "USER root\nRUN apt-get update && DEBIAN_FRONTEND=noninteractive apt-get install -y --no-install-recommends %s && rm -rf /var/lib/apt/lists/*\nUSER ${CLAUDEX_USER:-node}\n", strings.Join(pkgs, " "))
+	}
+	if pkgs := byManager[pkgNpm]; len(pkgs) > 0 {
+		fmt.Fprintf(&b, "RUN npm install -g %s\n", strings.Join(pkgs, " "))
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.WriteString(b.String()); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return added, f.Close()
+}
@@ -0,0 +1,94 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/photodialectic/claudex/internal/config"
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/policy"
+)
+
+// Policy implements `claudex policy check [<TARGET>]`.
+func Policy(args []string) error {
+	if len(args) == 0 || args[0] != "check" {
+		return fmt.Errorf("usage: claudex policy check [--name <NAME>]")
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	return policyCheck(dockerx.New(), cfg.Policy, args[1:], stdStreams())
+}
+
+func policyCheck(dx dockerx.Docker, p policy.Policy, args []string, s Streams) error {
+	t := targetSpec{prompt: s.Prompt}
+	for i := 0; i < len(args); i++ {
+		if ok, err := t.flag(args, &i); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		a := args[i]
+		switch a {
+		default:
+			if err := t.positional(a); err != nil {
+				return err
+			}
+		}
+	}
+	if !p.Enabled() {
+		fmt.Fprintln(s.Out, "No policy configured (add a policy: section to config).")
+		return nil
+	}
+	target, err := t.resolve(dx, true)
+	if err != nil {
+		return err
+	}
+	info, err := dx.Inspect(target)
+	if err != nil {
+		return err
+	}
+	violations := p.Check(info)
+	if p.RestrictEgress {
+		if v := egressViolation(dx, target); v != "" {
+			violations = append(violations, v)
+		}
+	}
+	if len(violations) == 0 {
+		fmt.Fprintf(s.Out, "%s complies with policy.\n", target)
+		return nil
+	}
+	fmt.Fprintf(s.Out, "%s violates policy:\n", target)
+	for _, v := range violations {
+		fmt.Fprintf(s.Out, "  - %s\n", v)
+	}
+	return fmt.Errorf("%d policy violation(s)", len(violations))
+}
+
+// egressProbe prints curl's exit code for a host outside any allowlist.
+const egressProbe = `command -v curl >/dev/null || { echo missing; exit 0; }
+curl -s -o /dev/null --connect-timeout 5 https://example.com; echo $?`
+
+// egressBlocked are the curl exit codes of a blocked request: the name did
+// not resolve, the connection was refused, or it timed out.
+var egressBlocked = map[string]bool{"6": true, "7": true, "28": true}
+
+// egressViolation checks that target cannot reach outside its allowlist.
+// Anything but a blocked request, including a probe that cannot run, is a
+// violation.
+func egressViolation(dx dockerx.Docker, target string) string {
+	out, err := dx.ExecOutput(target, []string{"sh", "-c", egressProbe})
+	if err != nil {
+		return fmt.Sprintf("cannot verify that outbound traffic is restricted: %v", err)
+	}
+	switch res := strings.TrimSpace(string(out)); {
+	case res == "0":
+		return "outbound traffic is not restricted (reached https://example.com)"
+	case res == "missing":
+		return "cannot verify that outbound traffic is restricted: curl is missing"
+	case !egressBlocked[res]:
+		return fmt.Sprintf("cannot verify that outbound traffic is restricted: curl exited %s", res)
+	}
+	return ""
+}
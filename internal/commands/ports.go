@@ -0,0 +1,174 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/photodialectic/claudex/internal/agent"
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/output"
+)
+
+// Ports implements `claudex ports [NAME | --name NAME | --signature HASH |
+// --last] [--json]`, listing the TCP ports processes in the container are
+// listening on, as its supervisor reads them from /proc.
+func Ports(args []string) error {
+	return portsWithDocker(dockerx.New(), args, os.Stdout)
+}
+
+func portsWithDocker(dx dockerx.Docker, args []string, out io.Writer) error {
+	var t targetSpec
+	asJSON := false
+	for i := 0; i < len(args); i++ {
+		if ok, err := t.flag(args, &i); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		switch args[i] {
+		case "--json":
+			asJSON = true
+		default:
+			if err := t.positional(args[i]); err != nil {
+				return err
+			}
+		}
+	}
+	target, err := t.resolve(dx, true)
+	if err != nil {
+		return err
+	}
+	ports, err := agent.Ports(dx, target)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		if ports == nil {
+			ports = []agent.Port{}
+		}
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(ports)
+	}
+	if len(ports) == 0 {
+		fmt.Fprintf(out, "Nothing is listening in %s.\n", target)
+		return nil
+	}
+	fmt.Fprintln(out, output.Paint(out, output.Bold, fmt.Sprintf("%-7s %-10s %-8s %s", "PORT", "ADDRESS", "PID", "PROCESS")))
+	for _, p := range ports {
+		addr, pid, proc := "all", "-", p.Process
+		if p.Loopback {
+			addr = "loopback"
+		}
+		if p.PID > 0 {
+			pid = strconv.Itoa(p.PID)
+		}
+		if proc == "" {
+			proc = "-"
+		}
+		fmt.Fprintf(out, "%-7d %-10s %-8s %s\n", p.Port, addr, pid, proc)
+	}
+	return nil
+}
+
+// Forward implements `claudex forward PORT [--local PORT] [NAME | --name NAME
+// | --signature HASH | --last]`, making a port inside the container
+// reachable on the host's localhost until interrupted. Each connection is
+// relayed by socat in its own docker exec, so it works for ports bound to
+// the container's loopback and needs nothing published at create time.
+func Forward(args []string) error {
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(done)
+	return forwardWithDocker(dockerx.New(), args, os.Stdout, os.Stderr, done)
+}
+
+func forwardWithDocker(dx dockerx.Docker, args []string, out, errOut io.Writer, done <-chan os.Signal) error {
+	var t targetSpec
+	port, local := 0, 0
+	for i := 0; i < len(args); i++ {
+		if ok, err := t.flag(args, &i); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		switch a := args[i]; {
+		case a == "--local":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--local requires a value")
+			}
+			i++
+			p, err := parsePort(args[i])
+			if err != nil {
+				return fmt.Errorf("--local: %w", err)
+			}
+			local = p
+		case port == 0 && a != "" && a[0] != '-':
+			p, err := parsePort(a)
+			if err != nil {
+				return err
+			}
+			port = p
+		default:
+			if err := t.positional(a); err != nil {
+				return err
+			}
+		}
+	}
+	if port == 0 {
+		return fmt.Errorf("forward requires a port (see claudex ports)")
+	}
+	if local == 0 {
+		local = port
+	}
+	target, err := t.resolve(dx, true)
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(local)))
+	if err != nil {
+		return fmt.Errorf("cannot listen on localhost:%d: %w (pick another with --local)", local, err)
+	}
+	fmt.Fprintf(out, "Forwarding localhost:%d to port %d in %s. Press Ctrl-C to stop.\n", local, port, target)
+	return serveForward(dx, target, port, ln, errOut, done)
+}
+
+// serveForward relays connections accepted on ln to port in target until
+// done fires.
+func serveForward(dx dockerx.Docker, target string, port int, ln net.Listener, errOut io.Writer, done <-chan os.Signal) error {
+	go func() {
+		<-done
+		ln.Close()
+	}()
+	relay := []string{"socat", "STDIO", "TCP:127.0.0.1:" + strconv.Itoa(port)}
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			if err := dx.ExecInteractive(target, relay, dockerx.ExecOptions{}, conn, conn, errOut); err != nil {
+				output.Warnf(errOut, "connection to port %d in %s: %v\n", port, target, err)
+			}
+		}()
+	}
+}
+
+func parsePort(s string) (int, error) {
+	p, err := strconv.Atoi(s)
+	if err != nil || p < 1 || p > 65535 {
+		return 0, fmt.Errorf("invalid port: %s", s)
+	}
+	return p, nil
+}
@@ -0,0 +1,84 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/photodialectic/claudex/internal/containers"
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/output"
+	"github.com/photodialectic/claudex/internal/run"
+)
+
+// Protect implements `claudex protect [NAME | --name NAME | --signature
+// HASH | --last] [--off] [--yes]`,
+// marking a container so destroy skips it without --force-protected.
+func Protect(args []string) error {
+	return protectWithDocker(dockerx.New(), args, stdStreams())
+}
+
+func protectWithDocker(dx dockerx.Docker, args []string, s Streams) error {
+	out, errOut := s.Out, s.Err
+	t := targetSpec{prompt: s.Prompt}
+	on, yes := true, false
+	for i := 0; i < len(args); i++ {
+		if ok, err := t.flag(args, &i); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		switch args[i] {
+		case "--off":
+			on = false
+		case "--yes", "-y":
+			yes = true
+		default:
+			if err := t.positional(args[i]); err != nil {
+				return err
+			}
+		}
+	}
+	target, err := t.resolve(dx, false)
+	if err != nil {
+		return err
+	}
+	_, running, info, err := containers.Exists(dx, target)
+	if err != nil {
+		return err
+	}
+	if run.Protected(info) == on {
+		if on {
+			fmt.Fprintf(out, "%s is already protected.\n", target)
+		} else {
+			fmt.Fprintf(out, "%s is not protected.\n", target)
+		}
+		return nil
+	}
+	if !yes {
+		what := "Protecting"
+		if !on {
+			what = "Unprotecting"
+		}
+		fmt.Fprintf(out, "%s %s commits and recreates it", what, target)
+		if running {
+			fmt.Fprint(out, ", restarting its processes")
+		}
+		fmt.Fprint(out, ". ")
+		ok, err := s.Prompt.Confirm(output.T(output.MsgProceed))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Fprintln(out, output.T(output.MsgAborted))
+			return nil
+		}
+	}
+	if _, err := run.SetProtected(target, on, out, errOut, dx); err != nil {
+		return err
+	}
+	if on {
+		fmt.Fprintf(out, "%s is protected; destroy skips it without --force-protected.\n", target)
+	} else {
+		fmt.Fprintf(out, "%s is no longer protected.\n", target)
+	}
+	return nil
+}
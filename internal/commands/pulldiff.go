@@ -0,0 +1,292 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+)
+
+// pullDiff summarizes how a staged pull differs from the destination.
+type pullDiff struct {
+	Added    []string `json:"added"`
+	Modified []string `json:"modified"`
+	// Deleted lists files present locally under a pulled root but missing in
+	// the container. Pull reports them but never deletes host files.
+	Deleted   []string `json:"deleted"`
+	Unchanged int      `json:"unchanged"`
+}
+
+// PullResult is what pull copied, as printed by --json. The diff's paths
+// are relative to Dest.
+type PullResult struct {
+	Sources []string `json:"sources"`
+	Dest    string   `json:"dest"`
+	// Staged is the --stage dir the files were left in; Dest is untouched
+	// then.
+	Staged string `json:"staged,omitempty"`
+	pullDiff
+}
+
+// dirSuffix marks empty directories in a pullDiff; they are pulled too.
+const dirSuffix = string(filepath.Separator)
+
+// diffTrees compares every file and empty directory under staged against the
+// same relative path under dest. Only top-level entries present in staged are
+// inspected in dest.
+func diffTrees(staged, dest string) (pullDiff, error) {
+	var d pullDiff
+	seen := map[string]bool{}
+	err := filepath.WalkDir(staged, func(p string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(staged, p)
+		if e.IsDir() {
+			if entries, err := os.ReadDir(p); err != nil || len(entries) > 0 || p == staged {
+				return err
+			}
+			switch fi, err := os.Lstat(filepath.Join(dest, rel)); {
+			case err != nil:
+				d.Added = append(d.Added, rel+dirSuffix)
+			case fi.IsDir():
+				d.Unchanged++
+			default:
+				d.Modified = append(d.Modified, rel+dirSuffix)
+			}
+			return nil
+		}
+		seen[rel] = true
+		local := filepath.Join(dest, rel)
+		fi, err := os.Lstat(local)
+		if err != nil {
+			d.Added = append(d.Added, rel)
+			return nil
+		}
+		if fi.IsDir() {
+			d.Modified = append(d.Modified, rel)
+			return nil
+		}
+		if e.Type()&fs.ModeSymlink != 0 || fi.Mode()&os.ModeSymlink != 0 {
+			a, _ := os.Readlink(p)
+			b, _ := os.Readlink(local)
+			if a == b && e.Type() == fi.Mode().Type() {
+				d.Unchanged++
+			} else {
+				d.Modified = append(d.Modified, rel)
+			}
+			return nil
+		}
+		same, err := sameContent(p, local)
+		if err != nil {
+			return err
+		}
+		if same {
+			d.Unchanged++
+		} else {
+			d.Modified = append(d.Modified, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return d, err
+	}
+	tops, err := os.ReadDir(staged)
+	if err != nil {
+		return d, err
+	}
+	for _, top := range tops {
+		root := filepath.Join(dest, top.Name())
+		if fi, err := os.Stat(root); err != nil || !fi.IsDir() {
+			continue
+		}
+		_ = filepath.WalkDir(root, func(p string, e fs.DirEntry, err error) error {
+			if err != nil || e.IsDir() {
+				return nil
+			}
+			rel, _ := filepath.Rel(dest, p)
+			if !seen[rel] {
+				d.Deleted = append(d.Deleted, rel)
+			}
+			return nil
+		})
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Modified)
+	sort.Strings(d.Deleted)
+	return d, nil
+}
+
+func sameContent(a, b string) (bool, error) {
+	ab, err := os.ReadFile(a)
+	if err != nil {
+		return false, err
+	}
+	bb, err := os.ReadFile(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(ab, bb), nil
+}
+
+// print writes the added/modified/deleted summary.
+func (d pullDiff) print(w io.Writer) {
+	fmt.Fprintf(w, "%d added, %d modified, %d deleted in container, %d unchanged\n", len(d.Added), len(d.Modified), len(d.Deleted), d.Unchanged)
+	for _, f := range d.Added {
+		fmt.Fprintf(w, "  A %s\n", f)
+	}
+	for _, f := range d.Modified {
+		fmt.Fprintf(w, "  M %s\n", f)
+	}
+	for _, f := range d.Deleted {
+		fmt.Fprintf(w, "  D %s (kept locally)\n", f)
+	}
+}
+
+// pullInto copies srcs (container:path) into a staging dir, prints the diff
+// against destDir and applies it. Files that differ locally are only
+// overwritten with force. When stageDir is set the pull stops after staging.
+// With under set, each source keeps its path below that container dir
+// (under/a/b/f lands in destDir/a/b/f); otherwise it lands in destDir itself.
+func pullInto(dx dockerx.Docker, srcs []string, under, destDir, stageDir string, force bool, out io.Writer) (PullResult, error) {
+	res := PullResult{Sources: srcs, Dest: destDir}
+	staged := stageDir
+	if staged == "" {
+		tmp, err := os.MkdirTemp("", "claudex-pull-")
+		if err != nil {
+			return res, err
+		}
+		defer os.RemoveAll(tmp)
+		staged = tmp
+	} else if err := freshStageDir(staged); err != nil {
+		return res, err
+	}
+	for _, src := range srcs {
+		sub := ""
+		if under != "" {
+			p := src[strings.Index(src, ":")+1:]
+			if rel := strings.TrimPrefix(p, strings.TrimSuffix(under, "/")+"/"); rel != p {
+				sub = filepath.FromSlash(path.Dir(rel))
+			}
+		}
+		fmt.Fprintf(out, "Pulling %s -> %s\n", src, filepath.Join(destDir, sub))
+		dir := filepath.Join(staged, sub)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return res, err
+		}
+		if err := dx.CP(src, dir); err != nil {
+			return res, fmt.Errorf("docker cp failed for %s: %w", src, err)
+		}
+	}
+	d, err := finishPull(staged, destDir, stageDir, force, out)
+	res.Staged, res.pullDiff = stageDir, d
+	return res, err
+}
+
+// freshStageDir creates dir, or accepts it when empty: staging into a dir
+// left from an earlier pull would mix its files into this one.
+func freshStageDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("cannot ensure staging dir %s: %v", dir, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("staging dir %s is not empty; empty it or pick a new one", dir)
+	}
+	return nil
+}
+
+// finishPull reports how staged differs from destDir and, unless the user
+// asked to stage only, copies it over (refusing to overwrite modified files
+// without force).
+func finishPull(staged, destDir, stageDir string, force bool, out io.Writer) (pullDiff, error) {
+	d, err := diffTrees(staged, destDir)
+	if err != nil {
+		return d, err
+	}
+	d.print(out)
+	if stageDir != "" {
+		fmt.Fprintf(out, "Staged in %s; review and copy into %s when ready.\n", stageDir, destDir)
+		return d, nil
+	}
+	for _, rel := range d.Modified {
+		if fi, err := os.Lstat(filepath.Join(destDir, rel)); err == nil && fi.IsDir() && !strings.HasSuffix(rel, dirSuffix) {
+			return d, fmt.Errorf("%s is a directory locally; pull never replaces directories, even with --force", filepath.Join(destDir, rel))
+		}
+	}
+	if len(d.Modified) > 0 && !force {
+		return d, fmt.Errorf("%d local file(s) differ from the container; re-run with --force to overwrite or --stage <DIR> to review", len(d.Modified))
+	}
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return d, fmt.Errorf("cannot ensure destination %s: %v", destDir, err)
+	}
+	return d, applyPull(staged, destDir, d)
+}
+
+// applyPull copies added and modified files and empty directories from
+// staged into dest, keeping modes. It replaces local files and symlinks but
+// never a local directory.
+func applyPull(staged, dest string, d pullDiff) error {
+	files := append(append([]string(nil), d.Added...), d.Modified...)
+	for _, rel := range files {
+		src := filepath.Join(staged, rel)
+		dst := filepath.Join(dest, rel)
+		fi, err := os.Lstat(src)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if info, err := os.Lstat(dst); err == nil {
+			if info.IsDir() {
+				if fi.IsDir() {
+					continue
+				}
+				return fmt.Errorf("%s is a directory; not replacing it", dst)
+			}
+			// Replace the file or symlink itself rather than writing
+			// through a symlink to wherever it points.
+			if err := os.Remove(dst); err != nil {
+				return err
+			}
+		}
+		if fi.IsDir() {
+			if err := os.Mkdir(dst, fi.Mode().Perm()); err != nil {
+				return err
+			}
+			continue
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(src)
+			if err != nil {
+				return err
+			}
+			if err := os.Symlink(target, dst); err != nil {
+				return err
+			}
+			continue
+		}
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(dst, data, fi.Mode().Perm()); err != nil {
+			return err
+		}
+		if err := os.Chmod(dst, fi.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
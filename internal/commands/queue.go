@@ -0,0 +1,309 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/queue"
+	"github.com/photodialectic/claudex/internal/run"
+	"github.com/photodialectic/claudex/internal/state"
+	"github.com/photodialectic/claudex/internal/workspace"
+)
+
+// Queue implements `claudex queue add|list|run|retry|clear`.
+func Queue(args []string) error {
+	path, err := queue.Path()
+	if err != nil {
+		return err
+	}
+	return queueWithDocker(dockerx.New(), path, args, os.Stdout, os.Stderr)
+}
+
+func queueWithDocker(dx dockerx.Docker, path string, args []string, out, errOut io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: claudex queue add|list|run|retry|clear")
+	}
+	rest := args[1:]
+	switch args[0] {
+	case "add":
+		return queueAdd(path, rest, out)
+	case "list":
+		return queueList(path, out)
+	case "run":
+		maxParallel := 1
+		for i := 0; i < len(rest); i++ {
+			switch rest[i] {
+			case "--max-parallel":
+				if i+1 >= len(rest) {
+					return fmt.Errorf("--max-parallel requires a number")
+				}
+				n, err := strconv.Atoi(rest[i+1])
+				if err != nil || n < 1 {
+					return fmt.Errorf("invalid --max-parallel %q", rest[i+1])
+				}
+				maxParallel = n
+				i++
+			default:
+				return fmt.Errorf("unknown arg: %s", rest[i])
+			}
+		}
+		return queueRun(dx, path, maxParallel, out, errOut)
+	case "retry":
+		if len(rest) != 1 {
+			return fmt.Errorf("usage: claudex queue retry <ID>")
+		}
+		id, err := strconv.Atoi(rest[0])
+		if err != nil {
+			return fmt.Errorf("invalid queue ID %q", rest[0])
+		}
+		return queue.Update(path, func(s *queue.Store) error {
+			it, ok := s.Get(id)
+			if !ok {
+				return fmt.Errorf("no queue item %d", id)
+			}
+			it.Status = queue.Pending
+			fmt.Fprintf(out, "Requeued %d\n", id)
+			return nil
+		})
+	case "clear":
+		return queue.Update(path, func(s *queue.Store) error {
+			fmt.Fprintf(out, "Removed %d finished items\n", s.Prune())
+			return nil
+		})
+	default:
+		return fmt.Errorf("unknown queue command: %s", args[0])
+	}
+}
+
+// queueAdd handles `queue add [--agent A] (--prompt TEXT | --prompt-file F) DIR...`.
+func queueAdd(path string, args []string, out io.Writer) error {
+	it := queue.Item{Agent: "claude"}
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch a {
+		case "--prompt", "--prompt-file", "--agent":
+			if i+1 >= len(args) {
+				return fmt.Errorf("%s requires a value", a)
+			}
+			v := args[i+1]
+			i++
+			switch a {
+			case "--prompt":
+				it.Prompt = v
+			case "--prompt-file":
+				data, err := os.ReadFile(v)
+				if err != nil {
+					return err
+				}
+				it.Prompt = string(data)
+			case "--agent":
+				if _, ok := batchAgents[v]; !ok {
+					return fmt.Errorf("unknown --agent %q (want claude, codex, gemini, copilot or opencode)", v)
+				}
+				it.Agent = v
+			}
+		default:
+			it.Dirs = append(it.Dirs, a)
+		}
+	}
+	if it.Prompt == "" {
+		return fmt.Errorf("queue add requires --prompt or --prompt-file")
+	}
+	// Store absolute paths: the runner may start from another directory.
+	norm, err := workspace.NormalizeDirs(workspace.DefaultDirs(it.Dirs))
+	if err != nil {
+		return err
+	}
+	it.Dirs = norm
+	it.AddedAt = time.Now()
+	return queue.Update(path, func(s *queue.Store) error {
+		added := s.Add(it)
+		fmt.Fprintf(out, "Queued %d (%d dirs, agent %s)\n", added.ID, len(added.Dirs), added.Agent)
+		return nil
+	})
+}
+
+func queueList(path string, out io.Writer) error {
+	s, err := queue.LoadFrom(path)
+	if err != nil {
+		return err
+	}
+	if len(s.Items) == 0 {
+		fmt.Fprintln(out, "Queue is empty.")
+		return nil
+	}
+	fmt.Fprintf(out, "%-4s %-8s %-8s %-20s %s\n", "ID", "STATUS", "AGENT", "ADDED", "DIRS")
+	for _, it := range s.Items {
+		status := it.Status
+		if status == queue.Failed {
+			status = fmt.Sprintf("failed(%d)", it.ExitCode)
+		}
+		fmt.Fprintf(out, "%-4d %-8s %-8s %-20s %v\n", it.ID, status, it.Agent, it.AddedAt.Format("2006-01-02 15:04:05"), it.Dirs)
+	}
+	return nil
+}
+
+// queueRun processes pending items with at most maxParallel containers at a
+// time, and keeps going until nothing is pending (including items added
+// while it runs). Items that share a dir wait for each other, since their
+// containers would edit the same bind-mounted files.
+func queueRun(dx dockerx.Docker, path string, maxParallel int, out, errOut io.Writer) error {
+	dataDir, err := state.Dir()
+	if err != nil {
+		return err
+	}
+	release, err := queue.LockRunner(path)
+	if err != nil {
+		return err
+	}
+	defer release()
+	err = queue.Update(path, func(s *queue.Store) error {
+		for _, it := range s.Requeue() {
+			fmt.Fprintf(out, "[queue %d] requeued; the run that started it exited\n", it.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex // serializes queue file updates and container creation
+		sem      = make(chan struct{}, maxParallel)
+		finished = make(chan struct{}, 1)
+		busy     = map[string]bool{} // dirs of the running items
+		failed   int
+		handled  int
+	)
+	for {
+		// Wait for a free slot, then claim the next pending item whose
+		// dirs are free.
+		sem <- struct{}{}
+		var next *queue.Item
+		blocked := false
+		mu.Lock()
+		err := queue.Update(path, func(s *queue.Store) error {
+			for _, p := range s.Pending() {
+				if sharesDir(p.Dirs, busy) {
+					blocked = true
+					continue
+				}
+				it, _ := s.Get(p.ID)
+				it.Status = queue.Running
+				it.StartedAt = time.Now()
+				it.OutDir = filepath.Join(dataDir, "queue", strconv.Itoa(it.ID))
+				cp := *it
+				next = &cp
+				return nil
+			}
+			return nil
+		})
+		if next != nil {
+			for _, d := range next.Dirs {
+				busy[d] = true
+			}
+		}
+		mu.Unlock()
+		if err != nil {
+			<-sem
+			wg.Wait()
+			return err
+		}
+		if next == nil {
+			<-sem
+			if blocked {
+				// Retry once a running item frees its dirs.
+				<-finished
+				continue
+			}
+			wg.Wait()
+			// Items may have been added while the last ones ran.
+			if s, err := queue.LoadFrom(path); err == nil && len(s.Pending()) > 0 {
+				continue
+			}
+			break
+		}
+		wg.Add(1)
+		go func(it queue.Item) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fmt.Fprintf(out, "[queue %d] starting (%v)\n", it.ID, it.Dirs)
+			res := runQueueItem(dx, &mu, it, out, errOut)
+			mu.Lock()
+			handled++
+			if res.ExitCode != 0 {
+				failed++
+			}
+			_ = queue.Update(path, func(s *queue.Store) error {
+				if cur, ok := s.Get(it.ID); ok {
+					cur.FinishedAt = time.Now()
+					cur.Container = res.Container
+					cur.ExitCode = res.ExitCode
+					cur.Error = res.Error
+					cur.Status = queue.Done
+					if res.ExitCode != 0 {
+						cur.Status = queue.Failed
+					}
+				}
+				return nil
+			})
+			for _, d := range it.Dirs {
+				delete(busy, d)
+			}
+			mu.Unlock()
+			select {
+			case finished <- struct{}{}:
+			default:
+			}
+			fmt.Fprintf(out, "[queue %d] finished with exit %d; results in %s\n", it.ID, res.ExitCode, it.OutDir)
+		}(*next)
+	}
+	if handled == 0 {
+		fmt.Fprintln(out, "Nothing queued.")
+		return nil
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d queued runs failed", failed, handled)
+	}
+	return nil
+}
+
+// sharesDir reports whether any of dirs is, contains or is inside a busy
+// dir.
+func sharesDir(dirs []string, busy map[string]bool) bool {
+	for _, d := range dirs {
+		for b := range busy {
+			if d == b || strings.HasPrefix(d, b+string(filepath.Separator)) || strings.HasPrefix(b, d+string(filepath.Separator)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// runQueueItem creates a dedicated container for it, runs the agent, and
+// removes the container.
+func runQueueItem(dx dockerx.Docker, mu *sync.Mutex, it queue.Item, out, errOut io.Writer) batchResult {
+	base := run.Options{Workdirs: it.Dirs}
+	if err := base.Derive(); err != nil {
+		return batchResult{ExitCode: -1, Error: err.Error()}
+	}
+	name := fmt.Sprintf("%s-q%d", base.Name, it.ID)
+	mu.Lock()
+	// --replace clears a container left by a runner that exited mid-item.
+	_, err := run.Up(append(append([]string(nil), it.Dirs...), "--name", name, "--replace"), out, errOut, dx)
+	mu.Unlock()
+	if err != nil {
+		_ = dx.Remove(name, true)
+		return batchResult{Container: name, ExitCode: -1, Error: err.Error()}
+	}
+	defer dx.Remove(name, true)
+	return runBatchTask(dx, name, it.Agent, batchTask{Title: fmt.Sprintf("queue %d", it.ID), Prompt: it.Prompt}, it.OutDir, it.ID, errOut)
+}
@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/run"
+	"github.com/photodialectic/claudex/internal/state"
+)
+
+// Recent implements `claudex recent [-n N]`, listing sessions by last attach.
+func Recent(args []string) error {
+	return recentWith(args, stdStreams())
+}
+
+func recentWith(args []string, s Streams) error {
+	limit := 10
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch a {
+		case "-n":
+			if i+1 >= len(args) {
+				return fmt.Errorf("-n requires a value")
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid -n %q", args[i+1])
+			}
+			limit = n
+			i++
+		default:
+			return fmt.Errorf("unknown arg: %s", a)
+		}
+	}
+	st, err := state.Load()
+	if err != nil {
+		return err
+	}
+	sessions := st.Recent()
+	if len(sessions) == 0 {
+		fmt.Fprintln(s.Out, "No recently attached claudex sessions.")
+		return nil
+	}
+	if len(sessions) > limit {
+		sessions = sessions[:limit]
+	}
+	fmt.Fprintf(s.Out, "%-32s %-20s %-10s %s\n", "NAME", "LAST ATTACHED", "SIGNATURE", "MOUNTS")
+	for _, sess := range sessions {
+		fmt.Fprintf(s.Out, "%-32s %-20s %-10s %d\n", sess.Name, sess.LastAttached.Format("2006-01-02 15:04:05"), sess.Signature, len(sess.Mounts))
+	}
+	return nil
+}
+
+// Attach implements `claudex attach` (and its alias `claudex shell`):
+// [--shell SHELL] [--env KEY=VALUE]... [--workdir DIR] [NAME | --name NAME |
+// --signature HASH | --last].
+func Attach(args []string) error {
+	var t targetSpec
+	var ao run.AttachOptions
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if ok, err := t.flag(args, &i); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		switch a {
+		case "--shell":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--shell requires bash, zsh or fish")
+			}
+			ao.Shell = args[i+1]
+			i++
+		case "--env", "-e":
+			if i+1 >= len(args) {
+				return fmt.Errorf("%s requires KEY=VALUE or KEY", a)
+			}
+			ao.Env = append(ao.Env, args[i+1])
+			i++
+		case "--workdir", "-w":
+			if i+1 >= len(args) {
+				return fmt.Errorf("%s requires a directory", a)
+			}
+			ao.Workdir = args[i+1]
+			i++
+		default:
+			if err := t.positional(a); err != nil {
+				return err
+			}
+		}
+	}
+	if err := run.ValidateEnv(ao.Env); err != nil {
+		return err
+	}
+	dx := dockerx.New()
+	name, err := t.resolve(dx, false)
+	if err != nil {
+		return err
+	}
+	return run.Attach(name, ao, os.Stdin, os.Stdout, os.Stderr, dx)
+}
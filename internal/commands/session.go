@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/run"
+)
+
+// ExportSession implements `claudex export-session [<TARGET>] <FILE>`.
+func ExportSession(args []string) error {
+	return exportSessionWithDocker(dockerx.New(), args, stdStreams())
+}
+
+func exportSessionWithDocker(dx dockerx.Docker, args []string, s Streams) error {
+	t := targetSpec{prompt: s.Prompt}
+	var file string
+	for i := 0; i < len(args); i++ {
+		if ok, err := t.flag(args, &i); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		if file != "" {
+			return fmt.Errorf("unexpected arg: %s", args[i])
+		}
+		file = args[i]
+	}
+	if file == "" {
+		return fmt.Errorf("usage: claudex export-session [--name <NAME>] <session.tar.zst>")
+	}
+	// Stopped containers can be exported when named; otherwise pick a running one.
+	name, err := t.resolve(dx, t.Name == "" && t.Signature == "" && !t.Last)
+	if err != nil {
+		return err
+	}
+	return run.ExportSession(name, file, s.Out, s.Err, dx)
+}
+
+// ImportSession implements `claudex import-session <FILE> [--as <NAME>] [--nested-docker MODE] [DIR ...]`.
+func ImportSession(args []string) error {
+	return importSessionWithDocker(dockerx.New(), args, stdStreams())
+}
+
+func importSessionWithDocker(dx dockerx.Docker, args []string, s Streams) error {
+	var file, as, nested string
+	var dirs []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch a {
+		case "--as":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--as requires a value")
+			}
+			as = args[i+1]
+			i++
+		case "--nested-docker":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--nested-docker requires a value")
+			}
+			nested = args[i+1]
+			i++
+		default:
+			if file == "" {
+				file = a
+				continue
+			}
+			dirs = append(dirs, a)
+		}
+	}
+	if file == "" {
+		return fmt.Errorf("usage: claudex import-session <session.tar.zst> [--as <NAME>] [--nested-docker MODE] [DIR ...]")
+	}
+	return run.ImportSession(file, as, nested, dirs, s.Out, s.Err, dx)
+}
@@ -0,0 +1,41 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/run"
+)
+
+// SigningKey implements `claudex signing-key [<TARGET>]`, printing the
+// public key a --sign container signs commits with, to register it where
+// signed commits are required.
+func SigningKey(args []string) error {
+	return signingKeyWithDocker(dockerx.New(), args, os.Stdout)
+}
+
+func signingKeyWithDocker(dx dockerx.Docker, args []string, out io.Writer) error {
+	var t targetSpec
+	for i := 0; i < len(args); i++ {
+		if ok, err := t.flag(args, &i); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		if err := t.positional(args[i]); err != nil {
+			return err
+		}
+	}
+	target, err := t.resolve(dx, true)
+	if err != nil {
+		return err
+	}
+	pub, err := run.SigningPublicKey(dx, target)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, pub)
+	return nil
+}
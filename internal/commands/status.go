@@ -0,0 +1,137 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/agent"
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/output"
+)
+
+// Status implements `claudex status [NAME | --name NAME | --signature HASH |
+// --last] [--json] [--size]`,
+// reporting what the container's supervisor sees: agents, firewall, git,
+// the file index and MCP servers. --size adds the container's disk usage.
+func Status(args []string) error {
+	return statusWithDocker(dockerx.New(), args, os.Stdout, time.Now())
+}
+
+func statusWithDocker(dx dockerx.Docker, args []string, out io.Writer, now time.Time) error {
+	var t targetSpec
+	asJSON, withSize := false, false
+	for i := 0; i < len(args); i++ {
+		if ok, err := t.flag(args, &i); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		switch args[i] {
+		case "--json":
+			asJSON = true
+		case "--size":
+			withSize = true
+		default:
+			if err := t.positional(args[i]); err != nil {
+				return err
+			}
+		}
+	}
+	target, err := t.resolve(dx, true)
+	if err != nil {
+		return err
+	}
+	st, err := agent.Query(dx, target)
+	if err != nil {
+		return err
+	}
+	var disk *containerDisk
+	if withSize {
+		info, err := dx.Inspect(target)
+		if err != nil {
+			return err
+		}
+		du, err := dx.DiskUsage()
+		if err != nil {
+			return err
+		}
+		disk = diskFor(du, info)
+	}
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			agent.Status
+			Disk *containerDisk `json:"disk,omitempty"`
+		}{st, disk})
+	}
+	fmt.Fprintf(out, "%s: supervisor pid %d, up %s, heartbeat %s ago\n", target, st.PID,
+		time.Duration(st.Uptime)*time.Second, st.HeartbeatAge(now).Round(time.Second))
+	if st.Stalled(now) {
+		output.Warnf(out, "the supervisor has missed its heartbeat; restart the container with claudex stop and claudex start\n")
+	}
+	agents := "none"
+	if len(st.Agents) > 0 {
+		var names []string
+		for _, a := range st.Agents {
+			names = append(names, fmt.Sprintf("%s (pid %d)", a.Name, a.PID))
+		}
+		agents = strings.Join(names, ", ")
+	}
+	fmt.Fprintf(out, "Agents: %s\n", agents)
+	switch {
+	case st.Firewall.Active:
+		fmt.Fprintf(out, "Firewall: %s, %d allowed domains\n", output.Paint(out, output.Green, "active"), len(st.Firewall.Allow))
+	default:
+		fmt.Fprintf(out, "Firewall: %s\n", output.Paint(out, output.Dim, "off"))
+	}
+	for _, r := range st.Git {
+		fmt.Fprintf(out, "Git %s: %s@%s, %d changed files\n", r.Path, r.Branch, r.Head, r.Changed)
+	}
+	if ix := st.Index; ix != nil {
+		fresh := output.Paint(out, output.Green, "current")
+		if ix.Stale {
+			fresh = output.Paint(out, output.Yellow, "stale") + " (files changed since; rebuild with claudex index)"
+		}
+		tags := ""
+		if ix.Tags {
+			tags = " and tags"
+		}
+		fmt.Fprintf(out, "Index: %d files%s, built %s ago, %s\n", ix.Files, tags, ix.Age(now).Round(time.Second), fresh)
+	}
+	if disk != nil {
+		fmt.Fprintf(out, "Disk: %s writable layer", humanBytes(disk.Writable))
+		var names []string
+		for n := range disk.Volumes {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		for _, n := range names {
+			fmt.Fprintf(out, ", %s volume %s", humanBytes(disk.Volumes[n]), n)
+		}
+		fmt.Fprintln(out)
+	}
+	if len(st.MCP) == 0 {
+		fmt.Fprintln(out, "No MCP servers supervised (add executables to ~/.claudex/mcp in the container).")
+		return nil
+	}
+	fmt.Fprintln(out)
+	printServers(out, st.MCP)
+	return nil
+}
+
+func printServers(out io.Writer, servers []agent.Server) {
+	fmt.Fprintln(out, output.Paint(out, output.Bold, fmt.Sprintf("%-24s %-8s %-8s %s", "MCP SERVER", "PID", "STATE", "RESTARTS")))
+	for _, s := range servers {
+		state := "running"
+		if !s.Running {
+			state = "down"
+		}
+		fmt.Fprintf(out, "%-24s %-8d %s %d\n", s.Name, s.PID, output.Status(out, state, 8), s.Restarts)
+	}
+}
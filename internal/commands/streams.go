@@ -0,0 +1,38 @@
+package commands
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/photodialectic/claudex/internal/ui"
+)
+
+// Streams are what a command reads and writes in place of os.Stdin,
+// os.Stdout and os.Stderr: questions go through Prompt, results and
+// progress to Out, warnings and failures to Err. The exported commands use
+// stdStreams; tests and other callers inject their own.
+type Streams struct {
+	Out    io.Writer
+	Err    io.Writer
+	Prompt ui.Prompter
+}
+
+func stdStreams() Streams {
+	return Streams{Out: os.Stdout, Err: os.Stderr, Prompt: ui.StdPrompter()}
+}
+
+// quiet sends s's progress to Err, leaving Out for a machine-readable
+// result.
+func (s Streams) quiet() Streams {
+	s.Out = s.Err
+	return s
+}
+
+// writeJSON prints v as indented JSON, the --json format of commands that
+// return a typed result.
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
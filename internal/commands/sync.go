@@ -0,0 +1,78 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/photodialectic/claudex/internal/containers"
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/run"
+)
+
+// Sync implements `claudex sync [--name NAME] [--pull] [--delete] [DIR...]`,
+// refreshing a --workspace-volume container's volume from the host dirs, or
+// copying the volume back with --pull.
+func Sync(args []string) error {
+	return syncWithDocker(dockerx.New(), args, stdStreams())
+}
+
+func syncWithDocker(dx dockerx.Docker, args []string, s Streams) error {
+	t := targetSpec{prompt: s.Prompt}
+	var opts run.SyncOptions
+	var only []string
+	for i := 0; i < len(args); i++ {
+		if ok, err := t.flag(args, &i); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		a := args[i]
+		switch a {
+		case "--pull":
+			opts.Pull = true
+		case "--delete":
+			opts.Delete = true
+		default:
+			if strings.HasPrefix(a, "-") {
+				return fmt.Errorf("unknown arg: %s", a)
+			}
+			only = append(only, filepath.Base(filepath.Clean(a)))
+		}
+	}
+	target, err := t.resolve(dx, true)
+	if err != nil {
+		return err
+	}
+	info, err := dx.Inspect(target)
+	if err != nil {
+		return err
+	}
+	volume := info.Labels[run.VolumeLabel]
+	if volume == "" {
+		return fmt.Errorf("%s bind-mounts its workspace, so there is nothing to sync; sync is for --workspace-volume containers", target)
+	}
+	mounts, err := containers.MountsFromLabel(&info)
+	if err != nil {
+		return fmt.Errorf("container %s missing mount label: %v", target, err)
+	}
+	var dirs []string
+	for _, host := range mounts {
+		if len(only) > 0 && !contains(only, filepath.Base(host)) {
+			continue
+		}
+		if fi, err := os.Stat(host); err != nil || !fi.IsDir() {
+			return fmt.Errorf("workspace dir %s does not exist on this host", host)
+		}
+		dirs = append(dirs, host)
+	}
+	if len(dirs) == 0 {
+		return fmt.Errorf("no workspace dirs of %s match %v", target, only)
+	}
+	if err := run.SyncVolume(dx, info.Image, volume, dirs, opts, s.Out); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.Out, "Synced %d dirs for %s\n", len(dirs), target)
+	return nil
+}
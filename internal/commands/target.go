@@ -0,0 +1,221 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/photodialectic/claudex/internal/containers"
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/state"
+	"github.com/photodialectic/claudex/internal/ui"
+)
+
+// targetSpec is how a command names its container. Container-targeting
+// commands accept the same forms: --name NAME (or --container NAME),
+// --signature HASH, --last, and, where they take no other positional
+// arguments, a bare NAME. NAME may abbreviate the name or slug. With none
+// of them the only candidate is used, or the user picks one on a TTY.
+type targetSpec struct {
+	Name      string
+	Signature string
+	Last      bool
+	// prompt picks among several candidates; nil means the terminal.
+	prompt ui.Prompter
+}
+
+// flag consumes the target flag at args[*i], advancing *i past its value.
+// It reports false when args[*i] is not a target flag.
+func (t *targetSpec) flag(args []string, i *int) (bool, error) {
+	a := args[*i]
+	switch a {
+	case "--last":
+		t.Last = true
+		return true, nil
+	case "--name", "--container", "--signature":
+		if *i+1 >= len(args) {
+			return true, fmt.Errorf("%s requires a value", a)
+		}
+		*i++
+		if a == "--signature" {
+			t.Signature = args[*i]
+		} else {
+			t.Name = args[*i]
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// positional takes a bare NAME; a second one is an error.
+func (t *targetSpec) positional(a string) error {
+	if strings.HasPrefix(a, "-") {
+		return fmt.Errorf("unknown arg: %s", a)
+	}
+	if t.Name != "" {
+		return fmt.Errorf("unexpected arg: %s", a)
+	}
+	t.Name = a
+	return nil
+}
+
+// resolve returns the container t names. With running, stopped containers
+// are neither candidates nor accepted by name.
+func (t targetSpec) resolve(dx dockerx.Docker, running bool) (string, error) {
+	n := 0
+	for _, set := range []bool{t.Name != "", t.Signature != "", t.Last} {
+		if set {
+			n++
+		}
+	}
+	if n > 1 {
+		return "", fmt.Errorf("name a container one way: NAME/--name, --signature or --last")
+	}
+	switch {
+	case t.Name != "":
+		ok, isRunning, _, err := containers.Exists(dx, t.Name)
+		if err != nil {
+			return "", err
+		}
+		name := t.Name
+		if !ok {
+			c, err := fuzzyContainer(dx, t.Name)
+			if err != nil {
+				return "", err
+			}
+			name, isRunning = c.Name, c.Status == "running"
+		}
+		if running && !isRunning {
+			return "", fmt.Errorf("container %s is not running", name)
+		}
+		return name, nil
+	case t.Last:
+		return lastAttached(dx, running)
+	}
+	cons, err := containers.List(dx, !running)
+	if err != nil {
+		return "", err
+	}
+	if t.Signature != "" {
+		var match []dockerx.Container
+		for _, c := range cons {
+			if c.Labels["com.claudex.signature"] == t.Signature {
+				match = append(match, c)
+			}
+		}
+		if len(match) == 0 {
+			return "", fmt.Errorf("no claudex container with signature %s", t.Signature)
+		}
+		cons = match
+	}
+	p := t.prompt
+	if p == nil {
+		p = ui.StdPrompter()
+	}
+	return chooseContainer(cons, running, p)
+}
+
+// fuzzyContainer finds the claudex container query abbreviates: a prefix of
+// its name (with or without "claudex-") or slug, failing that the letters
+// of query in order within its name. Ambiguity is an error listing the
+// candidates.
+func fuzzyContainer(dx dockerx.Docker, query string) (dockerx.Container, error) {
+	cons, err := containers.List(dx, true)
+	if err != nil {
+		return dockerx.Container{}, err
+	}
+	q := strings.ToLower(query)
+	prefix := func(c dockerx.Container) bool {
+		name := strings.ToLower(c.Name)
+		return strings.HasPrefix(name, q) || strings.HasPrefix(strings.TrimPrefix(name, "claudex-"), q) ||
+			strings.HasPrefix(strings.ToLower(c.Labels["com.claudex.slug"]), q)
+	}
+	fuzzy := func(c dockerx.Container) bool { return subsequence(q, strings.ToLower(c.Name)) }
+	for _, match := range []func(dockerx.Container) bool{prefix, fuzzy} {
+		var found []dockerx.Container
+		for _, c := range cons {
+			if match(c) {
+				found = append(found, c)
+			}
+		}
+		switch len(found) {
+		case 0:
+			continue
+		case 1:
+			return found[0], nil
+		}
+		var names []string
+		for _, c := range found {
+			names = append(names, c.Name)
+		}
+		return dockerx.Container{}, fmt.Errorf("%q matches several containers: %s", query, strings.Join(names, ", "))
+	}
+	return dockerx.Container{}, fmt.Errorf("container %s does not exist", query)
+}
+
+// subsequence reports whether the letters of q appear in s in order.
+func subsequence(q, s string) bool {
+	for _, r := range q {
+		i := strings.IndexRune(s, r)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(string(r)):]
+	}
+	return true
+}
+
+// chooseContainer returns the only candidate, asks on a TTY when there are
+// several, and otherwise lists them in the error.
+func chooseContainer(cons []dockerx.Container, running bool, p ui.Prompter) (string, error) {
+	which := "running claudex containers"
+	if !running {
+		which = "claudex containers"
+	}
+	if len(cons) == 0 {
+		return "", fmt.Errorf("no %s. Start one first.", which)
+	}
+	if len(cons) == 1 {
+		return cons[0].Name, nil
+	}
+	var names []string
+	for _, c := range cons {
+		names = append(names, c.Name)
+	}
+	tooMany := fmt.Errorf("multiple %s. Specify --name, --signature or --last. Choices: %s", which, strings.Join(names, ", "))
+	if !p.Interactive() {
+		return "", tooMany
+	}
+	menu := ui.Menu{Title: "Select a target container:"}
+	for _, c := range cons {
+		sig := c.Labels["com.claudex.signature"]
+		slug := c.Labels["com.claudex.slug"]
+		created := c.CreatedAt.Format("2006-01-02 15:04:05")
+		menu.Options = append(menu.Options, fmt.Sprintf("%s  (%s  %s  %s)", c.Name, c.Status, created, slug+":"+sig))
+	}
+	idx, err := p.SelectOne(menu)
+	if err != nil {
+		return "", err
+	}
+	if idx < 0 {
+		return "", tooMany
+	}
+	return cons[idx].Name, nil
+}
+
+// lastAttached returns the most recently attached session whose container
+// still exists (and runs, with running).
+func lastAttached(dx dockerx.Docker, running bool) (string, error) {
+	st, err := state.Load()
+	if err != nil {
+		return "", err
+	}
+	for _, s := range st.Recent() {
+		if ok, isRunning, _, _ := containers.Exists(dx, s.Name); ok && (isRunning || !running) {
+			return s.Name, nil
+		}
+	}
+	if running {
+		return "", fmt.Errorf("no recently attached claudex container is running")
+	}
+	return "", fmt.Errorf("no recently attached claudex container exists")
+}
@@ -0,0 +1,91 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/photodialectic/claudex/internal/config"
+	"github.com/photodialectic/claudex/internal/dockerx"
+)
+
+// Task implements `claudex task [<TASK>] [<TARGET>]`. Without a task
+// name it lists the tasks defined under `tasks:` in config.
+func Task(args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	return taskWithDocker(dockerx.New(), cfg.Tasks, args, os.Stdout, os.Stderr)
+}
+
+func taskWithDocker(dx dockerx.Docker, tasks map[string]config.Task, args []string, out, errOut io.Writer) error {
+	var t targetSpec
+	var taskName string
+	for i := 0; i < len(args); i++ {
+		if ok, err := t.flag(args, &i); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		a := args[i]
+		switch a {
+		default:
+			if taskName != "" {
+				return fmt.Errorf("unknown arg: %s", a)
+			}
+			taskName = a
+		}
+	}
+	if taskName == "" {
+		if len(tasks) == 0 {
+			fmt.Fprintf(out, "No tasks defined. Add a tasks: section to %s.\n", config.ProjectFile)
+			return nil
+		}
+		names := make([]string, 0, len(tasks))
+		for n := range tasks {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		for _, n := range names {
+			fmt.Fprintf(out, "%-20s %s\n", n, tasks[n].Command)
+		}
+		return nil
+	}
+	task, ok := tasks[taskName]
+	if !ok {
+		return fmt.Errorf("no task %q (run `claudex task` to list tasks)", taskName)
+	}
+	if task.Command == "" {
+		return fmt.Errorf("task %q has no command", taskName)
+	}
+	target, err := t.resolve(dx, true)
+	if err != nil {
+		return err
+	}
+	return dx.ExecStream(taskExecArgs(target, task), out, errOut)
+}
+
+// taskExecArgs builds the `docker exec` arguments for t in container.
+func taskExecArgs(container string, t config.Task) []string {
+	dir := "/workspace"
+	if t.Dir != "" {
+		if path.IsAbs(t.Dir) {
+			dir = t.Dir
+		} else {
+			dir = path.Join("/workspace", t.Dir)
+		}
+	}
+	args := []string{"-w", dir}
+	keys := make([]string, 0, len(t.Env))
+	for k := range t.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "-e", k+"="+t.Env[k])
+	}
+	return append(args, container, "bash", "-lc", t.Command)
+}
@@ -0,0 +1,91 @@
+package commands
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/config"
+	"github.com/photodialectic/claudex/internal/telemetry"
+)
+
+// Telemetry implements `claudex telemetry show|export|off|on`.
+func Telemetry(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: claudex telemetry show|export|off|on")
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	return telemetryWith(cfg.Telemetry, args[0], stdStreams())
+}
+
+func telemetryWith(cfg config.Telemetry, sub string, s Streams) error {
+	path, err := telemetry.Path()
+	if err != nil {
+		return err
+	}
+	switch sub {
+	case "show":
+		status := "off (set telemetry.enabled: true in config to opt in)"
+		if telemetry.Enabled(cfg.Enabled) {
+			status = "on"
+		} else if cfg.Enabled {
+			status = "off (claudex telemetry off or CLAUDEX_NO_TELEMETRY)"
+		}
+		fmt.Fprintf(s.Out, "Telemetry: %s\nRecords:   %s\n", status, path)
+		if cfg.Endpoint != "" {
+			fmt.Fprintf(s.Out, "Endpoint:  %s\n", cfg.Endpoint)
+		}
+		recs, err := telemetry.Load(path)
+		if err != nil {
+			return err
+		}
+		if len(recs) == 0 {
+			fmt.Fprintln(s.Out, "No usage recorded.")
+			return nil
+		}
+		fmt.Fprintf(s.Out, "\n%-16s %6s %8s %10s\n", "COMMAND", "COUNT", "FAILED", "AVG")
+		for _, sum := range telemetry.Summarize(recs) {
+			avg := (sum.Total / time.Duration(sum.Count)).Round(time.Millisecond)
+			fmt.Fprintf(s.Out, "%-16s %6d %8d %10s\n", sum.Command, sum.Count, sum.Failures, avg)
+		}
+		return nil
+	case "export":
+		if cfg.Endpoint == "" {
+			return fmt.Errorf("no telemetry.endpoint configured")
+		}
+		recs, err := telemetry.Load(path)
+		if err != nil {
+			return err
+		}
+		if len(recs) == 0 {
+			fmt.Fprintln(s.Out, "Nothing to export.")
+			return nil
+		}
+		if err := telemetry.Export(&http.Client{Timeout: 10 * time.Second}, cfg.Endpoint, recs); err != nil {
+			return err
+		}
+		fmt.Fprintf(s.Out, "Exported %d records to %s\n", len(recs), cfg.Endpoint)
+		return telemetry.Clear()
+	case "off":
+		if err := telemetry.SetOff(true); err != nil {
+			return err
+		}
+		fmt.Fprintln(s.Out, "Telemetry off; local records deleted.")
+		return nil
+	case "on":
+		if err := telemetry.SetOff(false); err != nil {
+			return err
+		}
+		if !cfg.Enabled {
+			fmt.Fprintln(s.Out, "Cleared the off switch; set telemetry.enabled: true in config to record usage.")
+			return nil
+		}
+		fmt.Fprintln(s.Out, "Telemetry on.")
+		return nil
+	default:
+		return fmt.Errorf("unknown telemetry command: %s (want show, export, off or on)", sub)
+	}
+}
@@ -0,0 +1,94 @@
+package commands
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+)
+
+// ToolchainsLabel records the --with toolchains an image was built with, so
+// `claudex update` can rebuild it with the same ones.
+const ToolchainsLabel = "com.claudex.toolchains"
+
+// toolchains maps each `--with` toolchain to the build arg the embedded
+// Dockerfile reads, and an example version. Node is the base image itself,
+// so it picks the tag.
+var toolchains = map[string]struct{ arg, example string }{
+	"go":     {"CLAUDEX_GO", "1.23"},
+	"python": {"CLAUDEX_PYTHON", "3.12"},
+	"node":   {"BASE_IMAGE", "22"},
+}
+
+var toolchainVersionRe = regexp.MustCompile(`^[0-9]+(\.[0-9]+){0,2}$`)
+
+// parseToolchains reads `--with` values such as "go=1.23,python=3.12" (the
+// flag may repeat) into a toolchain-to-version map; a later value for the
+// same toolchain wins.
+func parseToolchains(specs []string) (map[string]string, error) {
+	res := map[string]string{}
+	for _, spec := range specs {
+		for _, item := range strings.Split(spec, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			name, version, ok := strings.Cut(item, "=")
+			tc, known := toolchains[name]
+			if !known {
+				return nil, fmt.Errorf("unknown toolchain %q in --with (want %s)", name, strings.Join(toolchainNames(), ", "))
+			}
+			if !ok || !toolchainVersionRe.MatchString(version) {
+				return nil, fmt.Errorf("--with %s needs a version such as %s=%s", name, name, tc.example)
+			}
+			res[name] = version
+		}
+	}
+	return res, nil
+}
+
+func toolchainNames() []string {
+	var names []string
+	for n := range toolchains {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// formatToolchains is the inverse of parseToolchains, in a stable order.
+func formatToolchains(tc map[string]string) string {
+	var items []string
+	for _, n := range toolchainNames() {
+		if v, ok := tc[n]; ok {
+			items = append(items, n+"="+v)
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+// applyToolchains adds the build args and image label for tc to opts. slim
+// selects the slim node base image.
+func applyToolchains(opts *dockerx.BuildOptions, tc map[string]string, slim bool) {
+	if len(tc) == 0 {
+		return
+	}
+	if opts.BuildArgs == nil {
+		opts.BuildArgs = map[string]string{}
+	}
+	for n, v := range tc {
+		if n == "node" {
+			v = "node:" + v
+			if slim {
+				v += "-slim"
+			}
+		}
+		opts.BuildArgs[toolchains[n].arg] = v
+	}
+	if opts.Labels == nil {
+		opts.Labels = map[string]string{}
+	}
+	opts.Labels[ToolchainsLabel] = formatToolchains(tc)
+}
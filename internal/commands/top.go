@@ -0,0 +1,155 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+)
+
+// Process groups shown by `claudex top`, in display order.
+const (
+	topAgents  = "AGENTS"
+	topMCP     = "MCP SERVERS"
+	topShells  = "SHELLS"
+	topSystem  = "CLAUDEX"
+	topOther   = "OTHER"
+	topIndent  = "  "
+	topHeading = "%-8s %-5s %6s %9s %11s  %s\n"
+)
+
+var topGroups = []string{topAgents, topMCP, topShells, topSystem, topOther}
+
+// topAgentNames are the agent CLIs; they often run as `node .../bin/<name>`.
+var topAgentNames = map[string]bool{"claude": true, "codex": true, "gemini": true, "copilot": true, "opencode": true}
+
+// Top implements `claudex top [--name NAME]`.
+func Top(args []string) error {
+	return topWithDocker(dockerx.New(), args, os.Stdout)
+}
+
+func topWithDocker(dx dockerx.Docker, args []string, out io.Writer) error {
+	var t targetSpec
+	for i := 0; i < len(args); i++ {
+		if ok, err := t.flag(args, &i); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		switch args[i] {
+		default:
+			if err := t.positional(args[i]); err != nil {
+				return err
+			}
+		}
+	}
+	target, err := t.resolve(dx, true)
+	if err != nil {
+		return err
+	}
+	procs, err := dx.Top(target)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s: %d processes\n", target, len(procs))
+	groups, depth := groupProcesses(procs)
+	for _, g := range topGroups {
+		if len(groups[g]) == 0 {
+			continue
+		}
+		fmt.Fprintf(out, "\n%s\n", g)
+		fmt.Fprintf(out, topHeading, "PID", "STAT", "%CPU", "RSS", "ELAPSED", "COMMAND")
+		for _, p := range groups[g] {
+			cmd := strings.Repeat(topIndent, depth[p.PID]) + p.Command
+			fmt.Fprintf(out, topHeading, fmt.Sprint(p.PID), p.Stat, fmt.Sprintf("%.1f", p.CPU), humanKiB(p.RSSKiB), p.Elapsed, cmd)
+		}
+	}
+	return nil
+}
+
+// groupProcesses classifies each process by its own command when it is an
+// agent or MCP server, and otherwise by its parent's group, so an agent's
+// `bash -c npm test` counts as agent activity and an agent started from a
+// shell still shows as an agent. Within a group processes are listed
+// parent-first with a depth for indentation.
+func groupProcesses(procs []dockerx.Process) (map[string][]dockerx.Process, map[int]int) {
+	byPID := map[int]dockerx.Process{}
+	children := map[int][]int{}
+	for _, p := range procs {
+		byPID[p.PID] = p
+	}
+	var roots []int
+	for _, p := range procs {
+		if _, ok := byPID[p.PPID]; ok && p.PPID != p.PID {
+			children[p.PPID] = append(children[p.PPID], p.PID)
+		} else {
+			roots = append(roots, p.PID)
+		}
+	}
+	groups := map[string][]dockerx.Process{}
+	depth := map[int]int{}
+	var walk func(pid int, parent string, d int)
+	walk = func(pid int, parent string, d int) {
+		p := byPID[pid]
+		g := classifyProcess(p.Command)
+		if parent != "" && g != topAgents && g != topMCP {
+			g = parent
+		}
+		if g != parent {
+			d = 0
+		}
+		groups[g] = append(groups[g], p)
+		depth[pid] = d
+		for _, c := range children[pid] {
+			walk(c, g, d+1)
+		}
+	}
+	for _, r := range roots {
+		walk(r, "", 0)
+	}
+	return groups, depth
+}
+
+// classifyProcess buckets a command line by the programs it runs.
+func classifyProcess(cmd string) string {
+	f := strings.Fields(cmd)
+	if len(f) == 0 {
+		return topOther
+	}
+	prog := strings.TrimPrefix(filepath.Base(f[0]), "-") // login shells show as -bash
+	if prog == "node" && len(f) > 1 {
+		prog = filepath.Base(f[1])
+	}
+	lower := strings.ToLower(cmd)
+	switch {
+	case topAgentNames[prog]:
+		return topAgents
+	case strings.Contains(lower, "mcp") || strings.Contains(lower, "modelcontextprotocol"):
+		return topMCP
+	case prog == "tini", strings.Contains(cmd, "claudex-agent"):
+		return topSystem
+	case prog == "bash" || prog == "zsh" || prog == "fish" || prog == "sh":
+		if strings.Contains(cmd, "claudex-auto-commit") || strings.Contains(cmd, "dockerd") {
+			return topSystem
+		}
+		return topShells
+	case prog == "tail" && strings.Contains(cmd, "/dev/null"),
+		prog == "dockerd", prog == "containerd", prog == "dnsmasq":
+		return topSystem
+	}
+	return topOther
+}
+
+// humanKiB formats a KiB count as KiB/MiB/GiB.
+func humanKiB(k int64) string {
+	switch {
+	case k >= 1<<20:
+		return fmt.Sprintf("%.1fGiB", float64(k)/(1<<20))
+	case k >= 1<<10:
+		return fmt.Sprintf("%.1fMiB", float64(k)/(1<<10))
+	}
+	return fmt.Sprintf("%dKiB", k)
+}
@@ -0,0 +1,125 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/run"
+)
+
+// defaultUpParallel bounds concurrent creation for `up --separate`.
+const defaultUpParallel = 4
+
+// upResult is one row of the `up --separate` table.
+type upResult struct {
+	Dir       string
+	Container string
+	Seconds   float64
+	Err       error
+	Log       []byte
+}
+
+// Up implements `claudex up [--separate] [--max-parallel N] [run options]
+// [DIR...]`: bring containers up detached. With --separate each DIR gets its
+// own container, created concurrently.
+func Up(args []string) error {
+	return upWithDocker(dockerx.New(), args, os.Stdout, os.Stderr)
+}
+
+func upWithDocker(dx dockerx.Docker, args []string, out, errOut io.Writer) error {
+	separate := false
+	maxParallel := defaultUpParallel
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch a {
+		case "--separate":
+			separate = true
+		case "--max-parallel":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--max-parallel requires a number")
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid --max-parallel %q", args[i+1])
+			}
+			maxParallel = n
+			i++
+		default:
+			rest = append(rest, a)
+		}
+	}
+	if !separate {
+		name, err := run.Up(rest, errOut, errOut, dx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, name)
+		return nil
+	}
+	base, err := run.ParseArgs(rest)
+	if err != nil {
+		return err
+	}
+	if len(base.Workdirs) == 0 {
+		return fmt.Errorf("up --separate requires the dirs to give a container each")
+	}
+	if base.NameOverride != "" || base.Workspace != "" {
+		return fmt.Errorf("--name and --workspace name a single container; they cannot be used with --separate")
+	}
+
+	results := make([]upResult, len(base.Workdirs))
+	up := func(i int) {
+		o := base
+		o.Workdirs = []string{base.Workdirs[i]}
+		var log bytes.Buffer
+		start := time.Now()
+		name, err := o.Up(&log, &log, dx)
+		results[i] = upResult{Dir: base.Workdirs[i], Container: name, Seconds: time.Since(start).Seconds(), Err: err, Log: log.Bytes()}
+	}
+	first := 0
+	if ok, err := dx.ImageExists("claudex"); err == nil && !ok {
+		// Build the image once, with the first container, before fanning out.
+		fmt.Fprintf(out, "Building image with the first container (%s)...\n", base.Workdirs[0])
+		up(0)
+		first = 1
+	}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxParallel)
+	for i := first; i < len(base.Workdirs); i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			up(i)
+		}(i)
+	}
+	wg.Wait()
+
+	failed := 0
+	fmt.Fprintf(out, "%-30s %-40s %7s  %s\n", "DIR", "CONTAINER", "SECONDS", "STATUS")
+	for _, r := range results {
+		status := "ok"
+		if r.Err != nil {
+			status = "failed: " + r.Err.Error()
+			failed++
+		}
+		fmt.Fprintf(out, "%-30s %-40s %7.1f  %s\n", r.Dir, r.Container, r.Seconds, status)
+	}
+	for _, r := range results {
+		if r.Err != nil && len(r.Log) > 0 {
+			fmt.Fprintf(errOut, "\n--- %s ---\n%s", r.Dir, r.Log)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d containers failed to start", failed, len(results))
+	}
+	return nil
+}
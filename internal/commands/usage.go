@@ -0,0 +1,151 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/containers"
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/run"
+	"github.com/photodialectic/claudex/internal/state"
+)
+
+// UsageRow is one line of `claudex usage`: the totals of the sessions
+// sharing Key.
+type UsageRow struct {
+	Key           string  `json:"key"`
+	Sessions      int     `json:"sessions"`
+	AttachSeconds float64 `json:"attach_seconds"`
+	CPUSeconds    float64 `json:"cpu_seconds"`
+	InputTokens   int64   `json:"input_tokens"`
+	OutputTokens  int64   `json:"output_tokens"`
+}
+
+// usageKeys are the --by groupings.
+var usageKeys = map[string]func(state.Session) string{
+	"name":      func(s state.Session) string { return s.Name },
+	"signature": func(s state.Session) string { return s.Signature },
+	"slug":      func(s state.Session) string { return s.Slug },
+	"workspace": func(s state.Session) string { return s.Workspace },
+}
+
+// Usage implements `claudex usage [--since <DURATION|Nd|RFC3339>] [--by
+// name|signature|slug|workspace] [--json]`: attach time, CPU time and agent
+// tokens per session from the state store. Running containers are sampled
+// first so the totals are current.
+func Usage(args []string) error {
+	return usageWithDocker(dockerx.New(), args, os.Stdout, os.Stderr, time.Now())
+}
+
+func usageWithDocker(dx dockerx.Docker, args []string, out, errOut io.Writer, now time.Time) error {
+	var since time.Time
+	by := "name"
+	asJSON := false
+	for i := 0; i < len(args); i++ {
+		switch a := args[i]; a {
+		case "--since":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--since requires a duration (7d) or RFC3339 time")
+			}
+			t, err := parseSince(args[i+1], now)
+			if err != nil {
+				return err
+			}
+			since = t
+			i++
+		case "--by":
+			if i+1 >= len(args) || usageKeys[args[i+1]] == nil {
+				return fmt.Errorf("--by requires name, signature, slug or workspace")
+			}
+			by = args[i+1]
+			i++
+		case "--json":
+			asJSON = true
+		default:
+			return fmt.Errorf("unknown arg: %s", a)
+		}
+	}
+	if running, err := containers.List(dx, false); err == nil {
+		for _, c := range running {
+			run.RecordUsage(dx, c.Name, 0, errOut)
+		}
+	}
+	st, err := state.Load()
+	if err != nil {
+		return err
+	}
+	rows := usageRows(st.All(), usageKeys[by], since)
+	if asJSON {
+		if rows == nil {
+			rows = []UsageRow{}
+		}
+		return writeJSON(out, rows)
+	}
+	if len(rows) == 0 {
+		fmt.Fprintln(out, "No usage recorded.")
+		return nil
+	}
+	const format = "%-32s %8s %10s %8s %14s %14s\n"
+	fmt.Fprintf(out, format, "KEY", "SESSIONS", "ATTACHED", "CPU", "INPUT TOKENS", "OUTPUT TOKENS")
+	var total UsageRow
+	for _, r := range rows {
+		fmt.Fprintf(out, format, r.Key, fmt.Sprint(r.Sessions), hours(r.AttachSeconds), hours(r.CPUSeconds), fmt.Sprint(r.InputTokens), fmt.Sprint(r.OutputTokens))
+		total.Sessions += r.Sessions
+		total.AttachSeconds += r.AttachSeconds
+		total.CPUSeconds += r.CPUSeconds
+		total.InputTokens += r.InputTokens
+		total.OutputTokens += r.OutputTokens
+	}
+	if len(rows) > 1 {
+		fmt.Fprintf(out, format, "TOTAL", fmt.Sprint(total.Sessions), hours(total.AttachSeconds), hours(total.CPUSeconds), fmt.Sprint(total.InputTokens), fmt.Sprint(total.OutputTokens))
+	}
+	return nil
+}
+
+// usageRows totals the usage recorded since since by key, skipping
+// sessions without any; the heaviest CPU users come first.
+func usageRows(sessions []state.Session, key func(state.Session) string, since time.Time) []UsageRow {
+	var rows []UsageRow
+	index := map[string]int{}
+	for _, s := range sessions {
+		var sum UsageRow
+		for _, u := range s.Usage {
+			if u.To.Before(since) {
+				continue
+			}
+			sum.AttachSeconds += u.AttachSeconds
+			sum.CPUSeconds += u.CPUSeconds
+			sum.InputTokens += u.InputTokens
+			sum.OutputTokens += u.OutputTokens
+		}
+		if sum == (UsageRow{}) {
+			continue
+		}
+		k := key(s)
+		if k == "" {
+			k = "-"
+		}
+		i, ok := index[k]
+		if !ok {
+			i = len(rows)
+			index[k] = i
+			rows = append(rows, UsageRow{Key: k})
+		}
+		r := &rows[i]
+		r.Sessions++
+		r.AttachSeconds += sum.AttachSeconds
+		r.CPUSeconds += sum.CPUSeconds
+		r.InputTokens += sum.InputTokens
+		r.OutputTokens += sum.OutputTokens
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].CPUSeconds > rows[j].CPUSeconds })
+	return rows
+}
+
+// hours formats seconds as hours for the usage table, e.g. 1.25h.
+func hours(sec float64) string {
+	return fmt.Sprintf("%.2fh", sec/3600)
+}
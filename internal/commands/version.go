@@ -0,0 +1,43 @@
+package commands
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/update"
+	"github.com/photodialectic/claudex/internal/version"
+)
+
+// Version implements `claudex version [--check-latest]`.
+func Version(args []string) error {
+	return versionWith(args, stdStreams())
+}
+
+func versionWith(args []string, s Streams) error {
+	checkLatest := false
+	for _, a := range args {
+		switch a {
+		case "--check-latest":
+			checkLatest = true
+		default:
+			return fmt.Errorf("unknown arg: %s", a)
+		}
+	}
+	fmt.Fprintln(s.Out, version.Version)
+	if !checkLatest {
+		return nil
+	}
+	latest, err := update.Latest(&http.Client{Timeout: 10 * time.Second})
+	if err != nil {
+		return err
+	}
+	exe, _ := os.Executable()
+	if hint := update.Hint(version.Version, latest, exe); hint != "" {
+		fmt.Fprintln(s.Out, hint)
+		return nil
+	}
+	fmt.Fprintf(s.Out, "claudex is up to date (latest release %s)\n", latest)
+	return nil
+}
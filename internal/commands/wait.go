@@ -0,0 +1,184 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/containers"
+	"github.com/photodialectic/claudex/internal/dockerx"
+)
+
+// DefaultWaitInterval is how often `claudex wait` polls docker top.
+const DefaultWaitInterval = 5 * time.Second
+
+// Wait implements `claudex wait [--name NAME] [--pid PID | --match TEXT]
+// [--notify desktop|URL|COMMAND] [--interval D]`.
+func Wait(args []string) error {
+	return waitWithDocker(dockerx.New(), args, os.Stdout, time.Sleep, runNotifyHook)
+}
+
+// waitNotification is what a --notify hook receives: as JSON for webhooks,
+// and as CLAUDEX_* environment variables for commands.
+type waitNotification struct {
+	Container string  `json:"container"`
+	Waited    string  `json:"waited"`
+	Seconds   float64 `json:"seconds"`
+	Message   string  `json:"message"`
+}
+
+func waitWithDocker(dx dockerx.Docker, args []string, out io.Writer, sleep func(time.Duration), notify func(string, waitNotification) error) error {
+	var t targetSpec
+	var match, hook string
+	pid := 0
+	interval := DefaultWaitInterval
+	for i := 0; i < len(args); i++ {
+		if ok, err := t.flag(args, &i); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		a := args[i]
+		switch a {
+		case "--pid", "--match", "--notify", "--interval":
+			if i+1 >= len(args) {
+				return fmt.Errorf("%s requires a value", a)
+			}
+			v := args[i+1]
+			i++
+			switch a {
+			case "--pid":
+				n, err := strconv.Atoi(v)
+				if err != nil || n <= 0 {
+					return fmt.Errorf("invalid --pid %q", v)
+				}
+				pid = n
+			case "--match":
+				match = v
+			case "--notify":
+				hook = v
+			case "--interval":
+				d, err := time.ParseDuration(v)
+				if err != nil || d <= 0 {
+					return fmt.Errorf("invalid --interval %q", v)
+				}
+				interval = d
+			}
+		default:
+			if err := t.positional(a); err != nil {
+				return err
+			}
+		}
+	}
+	if pid != 0 && match != "" {
+		return fmt.Errorf("use either --pid or --match, not both")
+	}
+	target, err := t.resolve(dx, true)
+	if err != nil {
+		return err
+	}
+
+	// waited selects the processes to wait for; by default every agent.
+	waited := func(p dockerx.Process) bool {
+		switch {
+		case pid != 0:
+			return p.PID == pid
+		case match != "":
+			return strings.Contains(p.Command, match)
+		}
+		return classifyProcess(p.Command) == topAgents
+	}
+	what := "agent"
+	switch {
+	case pid != 0:
+		what = fmt.Sprintf("pid %d", pid)
+	case match != "":
+		what = fmt.Sprintf("%q", match)
+	}
+
+	start := time.Now()
+	first := true
+	for {
+		procs, err := dx.Top(target)
+		if err != nil {
+			// A stopped container means everything in it has exited.
+			if ok, running, _, _ := containers.Exists(dx, target); ok && running {
+				return err
+			}
+			procs = nil
+		}
+		var alive []dockerx.Process
+		for _, p := range procs {
+			if waited(p) {
+				alive = append(alive, p)
+			}
+		}
+		if len(alive) == 0 {
+			if first {
+				return fmt.Errorf("no %s process running in %s", what, target)
+			}
+			break
+		}
+		if first {
+			fmt.Fprintf(out, "Waiting for %s in %s (pid %d: %s)...\n", what, target, alive[0].PID, alive[0].Command)
+			first = false
+		}
+		sleep(interval)
+	}
+
+	elapsed := time.Since(start).Round(time.Second)
+	n := waitNotification{Container: target, Waited: what, Seconds: elapsed.Seconds()}
+	n.Message = fmt.Sprintf("claudex: %s in %s finished after %s", what, target, elapsed)
+	fmt.Fprintln(out, n.Message+"\a")
+	if hook == "" {
+		return nil
+	}
+	if err := notify(hook, n); err != nil {
+		return fmt.Errorf("notify hook failed: %w", err)
+	}
+	return nil
+}
+
+// runNotifyHook delivers n: "desktop" raises a desktop notification, an
+// http(s) URL receives a JSON POST, and anything else runs as a host shell
+// command with CLAUDEX_CONTAINER, CLAUDEX_WAITED, CLAUDEX_SECONDS and
+// CLAUDEX_MESSAGE set.
+func runNotifyHook(hook string, n waitNotification) error {
+	switch {
+	case hook == "desktop":
+		if runtime.GOOS == "darwin" {
+			script := fmt.Sprintf("display notification %s with title \"claudex\"", strconv.Quote(n.Message))
+			return exec.Command("osascript", "-e", script).Run()
+		}
+		return exec.Command("notify-send", "claudex", n.Message).Run()
+	case strings.HasPrefix(hook, "http://") || strings.HasPrefix(hook, "https://"):
+		body, _ := json.Marshal(n)
+		client := http.Client{Timeout: 10 * time.Second}
+		resp, err := client.Post(hook, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("%s returned %s", hook, resp.Status)
+		}
+		return nil
+	}
+	cmd := exec.Command("sh", "-c", hook)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(),
+		"CLAUDEX_CONTAINER="+n.Container,
+		"CLAUDEX_WAITED="+n.Waited,
+		"CLAUDEX_SECONDS="+strconv.FormatFloat(n.Seconds, 'f', 0, 64),
+		"CLAUDEX_MESSAGE="+n.Message,
+	)
+	return cmd.Run()
+}
@@ -0,0 +1,95 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/state"
+	"github.com/photodialectic/claudex/internal/workspace"
+)
+
+// workspaceNameRe keeps workspace names usable in labels and container names.
+var workspaceNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// Workspace implements `claudex workspace create|list|rm`.
+func Workspace(args []string) error {
+	return workspaceCmd(args, os.Stdout)
+}
+
+func workspaceCmd(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: claudex workspace create <NAME> DIR... | list | rm <NAME>")
+	}
+	rest := args[1:]
+	switch args[0] {
+	case "create":
+		force := false
+		var name string
+		var dirs []string
+		for _, a := range rest {
+			switch {
+			case a == "--force":
+				force = true
+			case strings.HasPrefix(a, "-"):
+				return fmt.Errorf("unknown arg: %s", a)
+			case name == "":
+				name = a
+			default:
+				dirs = append(dirs, a)
+			}
+		}
+		if name == "" || len(dirs) == 0 {
+			return fmt.Errorf("usage: claudex workspace create [--force] <NAME> DIR...")
+		}
+		if !workspaceNameRe.MatchString(name) {
+			return fmt.Errorf("invalid workspace name %q (lowercase letters, digits, '.', '_' and '-')", name)
+		}
+		norm, err := workspace.NormalizeDirs(dirs)
+		if err != nil {
+			return err
+		}
+		return state.Update(func(s *state.Store) error {
+			if _, ok := s.Workspace(name); ok && !force {
+				return fmt.Errorf("workspace %s already exists; use --force to replace it", name)
+			}
+			s.SetWorkspace(state.Workspace{Name: name, Dirs: norm, CreatedAt: time.Now()})
+			fmt.Fprintf(out, "Workspace %s: %s\nStart it with: claudex --workspace %s\n", name, strings.Join(norm, ", "), name)
+			return nil
+		})
+	case "list", "ls":
+		if len(rest) > 0 {
+			return fmt.Errorf("unknown arg: %s", rest[0])
+		}
+		st, err := state.Load()
+		if err != nil {
+			return err
+		}
+		ws := st.AllWorkspaces()
+		if len(ws) == 0 {
+			fmt.Fprintln(out, "No workspaces. Create one with: claudex workspace create <NAME> DIR...")
+			return nil
+		}
+		fmt.Fprintf(out, "%-20s %s\n", "NAME", "DIRS")
+		for _, w := range ws {
+			fmt.Fprintf(out, "%-20s %s\n", w.Name, strings.Join(w.Dirs, ", "))
+		}
+		return nil
+	case "rm", "remove":
+		if len(rest) != 1 {
+			return fmt.Errorf("usage: claudex workspace rm <NAME>")
+		}
+		return state.Update(func(s *state.Store) error {
+			if !s.RemoveWorkspace(rest[0]) {
+				return fmt.Errorf("no workspace named %s", rest[0])
+			}
+			fmt.Fprintf(out, "Removed workspace %s (containers started from it are kept)\n", rest[0])
+			return nil
+		})
+	default:
+		return fmt.Errorf("unknown workspace command: %s", args[0])
+	}
+}
@@ -0,0 +1,279 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/photodialectic/claudex/internal/notify"
+	"github.com/photodialectic/claudex/internal/policy"
+	"github.com/photodialectic/claudex/internal/workspace"
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectFile is the per-project config file looked up in the current directory.
+const ProjectFile = ".claudex.yaml"
+
+// globalOnly are the keys only the global config may set. A project file
+// comes with whatever repository is checked out, so it must not loosen the
+// policy or expose more of the host.
+var globalOnly = []string{"policy", "homeMounts", "dotfiles", "notifications"}
+
+// Config holds user preferences loaded from the global config file and,
+// when present, the project-level .claudex.yaml which overrides it.
+type Config struct {
+	DisableUpdateCheck bool   `yaml:"disableUpdateCheck"`
+	Engine             string `yaml:"engine"`
+	// DockerTimeouts bounds engine calls so a hung daemon cannot freeze
+	// claudex, e.g. {query: 30s, change: 10m}; "off" disables one.
+	DockerTimeouts DockerTimeouts `yaml:"dockerTimeouts"`
+	// SignatureMode selects workspace signatures: "v1" (paths, default) or
+	// "v2" (git remote identity).
+	SignatureMode string `yaml:"signatureMode"`
+	// RootMode picks the mount when no dirs are given: "cwd" (default) or
+	// "git" (the root of the enclosing git checkout).
+	RootMode string `yaml:"rootMode"`
+	// PathAliases maps host checkout paths to logical paths (e.g.
+	// "~/src/acme": /workspace/acme) so a team shares signatures and
+	// session archives regardless of where each member cloned.
+	PathAliases map[string]string `yaml:"pathAliases"`
+	// Naming customizes container names (prefix, template, maxSlugLen, hashLen).
+	Naming workspace.Naming `yaml:"naming"`
+	// Owner labels new containers (com.claudex.owner) in place of $USER;
+	// list and destroy show only the current owner's containers.
+	Owner string `yaml:"owner"`
+	// Audit records every command run in new containers (same as --audit).
+	Audit bool `yaml:"audit"`
+	// Index builds a file index in new containers (same as --index).
+	Index bool `yaml:"index"`
+	// AutoCommit checkpoints /workspace on this interval, e.g. "10m" (same as --auto-commit).
+	AutoCommit string `yaml:"autoCommit"`
+	// Policy restricts container capabilities for every run.
+	Policy policy.Policy `yaml:"policy"`
+	// Firewall tunes the --firewall allowlist.
+	Firewall Firewall `yaml:"firewall"`
+	// Telemetry opts in to local usage records (see `claudex telemetry`).
+	Telemetry Telemetry `yaml:"telemetry"`
+	// HostGit controls how mounted repositories' .git dirs are exposed.
+	HostGit HostGit `yaml:"hostGit"`
+	// MountConsistency sets Docker Desktop bind-mount consistency
+	// (consistent, cached or delegated) for workspace mounts.
+	MountConsistency MountConsistency `yaml:"mountConsistency"`
+	// HomeMounts are extra host home-dir paths mounted at the same place
+	// under /home/node, e.g. ~/.aws read-only. Global config only.
+	HomeMounts []HomeMount `yaml:"homeMounts"`
+	// Shell is the default interactive shell: bash (default), zsh or fish.
+	Shell string `yaml:"shell"`
+	// Dotfiles is a host dir (e.g. ~/.config/claudex/dotfiles) copied into
+	// /home/node when a container is created. Global config only.
+	Dotfiles string `yaml:"dotfiles"`
+	// Sign makes every new container sign commits, as with --sign.
+	Sign bool `yaml:"sign"`
+	// Notifications posts lifecycle events to a webhook and/or Slack.
+	// Global config only.
+	Notifications notify.Config `yaml:"notifications"`
+	// Tasks are named commands run in the container by `claudex task`.
+	Tasks map[string]Task `yaml:"tasks"`
+	// HostNetworkPorts are published instead of --host-network where the
+	// engine runs in a VM (default 1455 and 8810, the OAuth callbacks).
+	HostNetworkPorts []int `yaml:"hostNetworkPorts"`
+	// Apps names web apps served from the container for `claudex open`,
+	// e.g. {web: 3000, docs: {port: 6006, path: /docs}}.
+	Apps map[string]App `yaml:"apps"`
+	// Ignored lists the global-only keys the project file set; they were
+	// dropped.
+	Ignored []string `yaml:"-"`
+}
+
+// DockerTimeouts holds durations such as "30s" for dockerx.Timeouts.
+type DockerTimeouts struct {
+	// Query bounds inspect, ps, images, logs and stats (default 30s).
+	Query string `yaml:"query"`
+	// Change bounds run, start, stop, rm, cp and exec (default 10m).
+	Change string `yaml:"change"`
+}
+
+// HostGit selects keep, empty (tmpfs), or copy (private snapshot) for the
+// .git of mounted repositories.
+type HostGit struct {
+	Default string `yaml:"default"`
+	// Mounts overrides Default per mount, keyed by basename or absolute path.
+	Mounts map[string]string `yaml:"mounts"`
+}
+
+// MountConsistency picks the consistency mode of workspace bind mounts.
+type MountConsistency struct {
+	Default string `yaml:"default"`
+	// Mounts overrides Default per mount, keyed by basename or absolute path.
+	Mounts map[string]string `yaml:"mounts"`
+}
+
+// HomeMount is one homeMounts entry. Path may start with ~ and contain glob
+// patterns; Mode is "ro" (default) or "rw". A string value in YAML is
+// shorthand for "PATH[:MODE]".
+type HomeMount struct {
+	Path string `yaml:"path"`
+	Mode string `yaml:"mode"`
+}
+
+// UnmarshalYAML accepts either a mapping or "PATH[:ro|:rw]".
+func (m *HomeMount) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		m.Path = n.Value
+		for _, mode := range []string{"ro", "rw"} {
+			if strings.HasSuffix(n.Value, ":"+mode) {
+				m.Path = strings.TrimSuffix(n.Value, ":"+mode)
+				m.Mode = mode
+			}
+		}
+		return nil
+	}
+	type plain HomeMount
+	return n.Decode((*plain)(m))
+}
+
+// Task is a command run inside the container. A string value in YAML is
+// shorthand for {command: ...}.
+type Task struct {
+	Command string `yaml:"command"`
+	// Dir is the working directory; relative paths are under /workspace.
+	Dir string            `yaml:"dir"`
+	Env map[string]string `yaml:"env"`
+}
+
+// UnmarshalYAML accepts either a mapping or a bare command string.
+func (t *Task) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		t.Command = n.Value
+		return nil
+	}
+	type plain Task
+	return n.Decode((*plain)(t))
+}
+
+// App is a web app served inside the container. A bare port number in YAML
+// is shorthand for {port: ...}.
+type App struct {
+	Port int `yaml:"port"`
+	// Path is appended to the URL opened, e.g. /admin.
+	Path string `yaml:"path"`
+}
+
+// UnmarshalYAML accepts either a mapping or a bare port.
+func (a *App) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		return n.Decode(&a.Port)
+	}
+	type plain App
+	return n.Decode((*plain)(a))
+}
+
+// Telemetry configures opt-in usage recording.
+type Telemetry struct {
+	Enabled bool `yaml:"enabled"`
+	// Endpoint receives records on `claudex telemetry export`.
+	Endpoint string `yaml:"endpoint"`
+}
+
+// Firewall configures the container egress allowlist.
+type Firewall struct {
+	// AllowDeps adds package registries found in mounted projects' lockfiles.
+	AllowDeps bool `yaml:"allowDeps"`
+}
+
+// Dir returns the claudex config directory ($XDG_CONFIG_HOME/claudex or ~/.config/claudex).
+func Dir() (string, error) {
+	if x := os.Getenv("XDG_CONFIG_HOME"); x != "" {
+		return filepath.Join(x, "claudex"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "claudex"), nil
+}
+
+// GlobalPath returns the location of the global config file.
+func GlobalPath() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.yaml"), nil
+}
+
+// Load reads the global config followed by ./.claudex.yaml, minus the
+// global-only keys of the latter. Missing files are ignored.
+func Load() (Config, error) {
+	var c Config
+	global, err := GlobalPath()
+	if err == nil {
+		if err := loadFile(global, &c); err != nil {
+			return c, err
+		}
+	}
+	if err := loadProject(ProjectFile, &c); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// loadProject overlays the project file at path on c, recording the
+// global-only keys it sets in c.Ignored instead of applying them.
+func loadProject(path string, c *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("cannot read config %s: %w", path, err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	m := doc.Content[0]
+	if m.Kind == yaml.MappingNode {
+		var kept []*yaml.Node
+		for i := 0; i+1 < len(m.Content); i += 2 {
+			if isGlobalOnly(m.Content[i].Value) {
+				c.Ignored = append(c.Ignored, m.Content[i].Value)
+				continue
+			}
+			kept = append(kept, m.Content[i], m.Content[i+1])
+		}
+		m.Content = kept
+	}
+	if err := m.Decode(c); err != nil {
+		return fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return nil
+}
+
+func isGlobalOnly(key string) bool {
+	for _, k := range globalOnly {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func loadFile(path string, c *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("cannot read config %s: %w", path, err)
+	}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return nil
+}
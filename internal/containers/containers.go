@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"path/filepath"
 	"sort"
+	"strings"
 
 	"github.com/photodialectic/claudex/internal/dockerx"
 )
@@ -85,3 +87,64 @@ func equalStrings(a, b []string) bool {
 	}
 	return true
 }
+
+// LabelPrefix namespaces every claudex label.
+const LabelPrefix = "com.claudex."
+
+// ParseSelector parses "key=value,key2=value2" into label matchers. Keys
+// without the com.claudex. prefix are expanded (slug=app -> com.claudex.slug=app).
+// Values may be glob patterns.
+func ParseSelector(s string) (map[string]string, error) {
+	sel := map[string]string{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("invalid selector %q (want key=value)", part)
+		}
+		key := strings.TrimSpace(kv[0])
+		if !strings.HasPrefix(key, LabelPrefix) {
+			key = LabelPrefix + key
+		}
+		if _, err := filepath.Match(kv[1], ""); err != nil {
+			return nil, fmt.Errorf("invalid selector pattern %q: %v", kv[1], err)
+		}
+		sel[key] = kv[1]
+	}
+	if len(sel) == 0 {
+		return nil, fmt.Errorf("empty selector")
+	}
+	return sel, nil
+}
+
+// MatchSelector reports whether every selector entry matches c's labels.
+func MatchSelector(c dockerx.Container, sel map[string]string) bool {
+	for k, pattern := range sel {
+		v, ok := c.Labels[k]
+		if !ok {
+			return false
+		}
+		if m, _ := filepath.Match(pattern, v); !m {
+			return false
+		}
+	}
+	return true
+}
+
+// IsClaudex reports whether c was created by claudex (carries a signature label).
+func IsClaudex(c *dockerx.Container) bool {
+	return c != nil && c.Labels[LabelPrefix+"signature"] != ""
+}
+
+// SuggestName returns the first of name-2, name-3, ... not taken by any container.
+func SuggestName(dx dockerx.Docker, name string) string {
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s-%d", name, i)
+		if _, err := dx.Inspect(candidate); err != nil {
+			return candidate
+		}
+	}
+}
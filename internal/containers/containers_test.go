@@ -5,7 +5,7 @@ import (
 	"testing"
 	"time"
 
-	"claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/dockerx"
 )
 
 func TestMountsFromLabel(t *testing.T) {
@@ -64,3 +64,54 @@ func TestWarnOrErrorOnMountMismatch(t *testing.T) {
 		t.Fatalf("strict mismatch should error")
 	}
 }
+
+func TestParseAndMatchSelector(t *testing.T) {
+	sel, err := ParseSelector("slug=app*, com.claudex.team=infra")
+	if err != nil {
+		t.Fatalf("ParseSelector: %v", err)
+	}
+	if sel["com.claudex.slug"] != "app*" || sel["com.claudex.team"] != "infra" {
+		t.Fatalf("unexpected selector: %v", sel)
+	}
+	c := dockerx.Container{Labels: map[string]string{"com.claudex.slug": "app-api", "com.claudex.team": "infra"}}
+	if !MatchSelector(c, sel) {
+		t.Fatalf("expected match")
+	}
+	c.Labels["com.claudex.team"] = "web"
+	if MatchSelector(c, sel) {
+		t.Fatalf("expected mismatch on team")
+	}
+	delete(c.Labels, "com.claudex.team")
+	if MatchSelector(c, sel) {
+		t.Fatalf("expected mismatch on missing label")
+	}
+	for _, bad := range []string{"", "novalue", "=x", "slug=["} {
+		if _, err := ParseSelector(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestUpgradeLabelsFromSchema0(t *testing.T) {
+	c := dockerx.Container{Name: "old", Labels: map[string]string{"com.claudex.signature": "abc"}, Mounts: []dockerx.Mount{
+		{Type: "bind", Source: "/src/My App", Destination: "/workspace/My App"},
+		{Type: "bind", Source: "/home/me/.claude", Destination: "/home/node/.claude"},
+	}}
+	if LabelSchema(&c) != 0 {
+		t.Fatalf("schema = %d, want 0", LabelSchema(&c))
+	}
+	labels, err := UpgradeLabels(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labels["com.claudex.mounts"] != `["/src/My App"]` || labels["com.claudex.slug"] != "my-app" || labels[SchemaLabel] != "1" {
+		t.Fatalf("labels = %v", labels)
+	}
+	if _, ok := c.Labels[SchemaLabel]; ok {
+		t.Fatal("UpgradeLabels modified the container")
+	}
+	c.Labels[SchemaLabel] = "99"
+	if _, err := UpgradeLabels(&c); err == nil {
+		t.Fatal("expected newer schema to be rejected")
+	}
+}
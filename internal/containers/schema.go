@@ -0,0 +1,75 @@
+package containers
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/workspace"
+)
+
+// SchemaLabel records the label layout a container was created with.
+const SchemaLabel = LabelPrefix + "schema"
+
+// Schema is the current label layout. Bump it whenever labels change meaning
+// and append the step to labelUpgrades so `claudex migrate` can follow.
+const Schema = 1
+
+// labelUpgrades[n] rewrites schema-n labels in place to schema n+1.
+var labelUpgrades = []func(c *dockerx.Container, labels map[string]string) error{
+	upgradeSchema0,
+}
+
+// LabelSchema returns c's schema; containers from before the label are 0.
+func LabelSchema(c *dockerx.Container) int {
+	n, err := strconv.Atoi(c.Labels[SchemaLabel])
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// UpgradeLabels returns c's labels rewritten to the current schema. c is
+// left untouched.
+func UpgradeLabels(c *dockerx.Container) (map[string]string, error) {
+	from := LabelSchema(c)
+	if from > Schema {
+		return nil, fmt.Errorf("%s uses label schema %d; this claudex only knows %d", c.Name, from, Schema)
+	}
+	labels := make(map[string]string, len(c.Labels)+1)
+	for k, v := range c.Labels {
+		labels[k] = v
+	}
+	for n := from; n < Schema; n++ {
+		if err := labelUpgrades[n](c, labels); err != nil {
+			return nil, fmt.Errorf("upgrade %s labels from schema %d: %w", c.Name, n, err)
+		}
+	}
+	labels[SchemaLabel] = strconv.Itoa(Schema)
+	return labels, nil
+}
+
+// upgradeSchema0 fills in the mounts and slug labels early containers could
+// lack, recovering the mounts from binds under /workspace.
+func upgradeSchema0(c *dockerx.Container, labels map[string]string) error {
+	var mounts []string
+	if err := json.Unmarshal([]byte(labels[LabelPrefix+"mounts"]), &mounts); err != nil {
+		for _, m := range c.Mounts {
+			if (m.Type == "" || m.Type == "bind") && path.Dir(m.Destination) == "/workspace" && m.Source != "" {
+				mounts = append(mounts, m.Source)
+			}
+		}
+		if len(mounts) == 0 {
+			return fmt.Errorf("no mounts label and no bind mounts under /workspace")
+		}
+		b, _ := json.Marshal(mounts)
+		labels[LabelPrefix+"mounts"] = string(b)
+	}
+	if strings.TrimSpace(labels[LabelPrefix+"slug"]) == "" {
+		labels[LabelPrefix+"slug"] = workspace.DeriveSlug(mounts)
+	}
+	return nil
+}
@@ -0,0 +1,538 @@
+package dockerx
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultAPIHost is the daemon address the docker-api engine uses when
+// DOCKER_HOST is unset.
+const DefaultAPIHost = "unix:///var/run/docker.sock"
+
+// API implements Docker by talking to the Docker Engine API at Host. Inspect,
+// ps, the lifecycle calls, exec output, logs, events, stats, top, images and
+// info go over HTTP. Calls the interface defines in terms of docker CLI
+// arguments (Run, Stream, Exec, CP, Build, ExecInteractive, ExecStream) are
+// passed to the embedded CLI, pointed at the same daemon with DOCKER_HOST.
+type API struct {
+	// Host is a unix:///path or tcp://host:port address; TLS is not supported.
+	Host string
+	CLI
+	client *http.Client
+}
+
+// NewAPI returns an API engine for host, in DOCKER_HOST form.
+func NewAPI(host string) *API {
+	tr := &http.Transport{}
+	if path, ok := strings.CutPrefix(host, "unix://"); ok {
+		tr.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		}
+	}
+	return &API{Host: host, CLI: CLI{Env: []string{"DOCKER_HOST=" + host}}, client: &http.Client{Transport: tr}}
+}
+
+// apiHost is DOCKER_HOST, or DefaultAPIHost when it is unset.
+func apiHost() string {
+	if h := os.Getenv("DOCKER_HOST"); h != "" {
+		return h
+	}
+	return DefaultAPIHost
+}
+
+// apiAvailable reports whether the API engine can reach a daemon without TLS
+// and find the docker CLI it hands run, exec and build to.
+func apiAvailable() bool {
+	host := apiHost()
+	if path, ok := strings.CutPrefix(host, "unix://"); ok {
+		if _, err := os.Stat(path); err != nil {
+			return false
+		}
+	} else if !strings.HasPrefix(host, "tcp://") || os.Getenv("DOCKER_TLS_VERIFY") != "" {
+		return false
+	}
+	return onPATH.has("docker")
+}
+
+// exitError reports a non-zero exit of a command run with ExecOutput.
+type exitError struct{ code int }
+
+func (e *exitError) Error() string { return fmt.Sprintf("exit status %d", e.code) }
+
+func (e *exitError) ExitCode() int { return e.code }
+
+func (a API) url(path string, q url.Values) string {
+	u := url.URL{Scheme: "http", Host: "docker", Path: path, RawQuery: q.Encode()}
+	if addr, ok := strings.CutPrefix(a.Host, "tcp://"); ok {
+		u.Host = addr
+	}
+	return u.String()
+}
+
+// send makes one request; error statuses are returned as errors carrying the
+// daemon's message, with the body already closed.
+func (a API) send(ctx context.Context, method, path string, q url.Values, body any) (*http.Response, error) {
+	var rd io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		rd = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, a.url(path, q), rd)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		var msg struct{ Message string }
+		data, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(data, &msg) != nil || msg.Message == "" {
+			msg.Message = strings.TrimSpace(string(data))
+		}
+		if msg.Message == "" {
+			msg.Message = resp.Status
+		}
+		return nil, errors.New(msg.Message)
+	}
+	return resp, nil
+}
+
+// request makes a bounded call and returns the response body, with the same
+// timeouts, cancellation and retries as the CLI engines.
+func (a API) request(kind opKind, method, path string, q url.Values, body any) ([]byte, error) {
+	var out []byte
+	tries, err := a.retry().Retry(a.context(), func() error {
+		var err error
+		out, err = a.try(kind, method, path, q, body)
+		return err
+	}, apiTransient)
+	return out, gaveUp(err, tries)
+}
+
+// try makes a single attempt of request.
+func (a API) try(kind opKind, method, path string, q url.Values, body any) ([]byte, error) {
+	ctx := a.context()
+	d := a.timeout(kind)
+	cancel := func() {}
+	if d > 0 {
+		ctx, cancel = context.WithTimeout(ctx, d)
+	}
+	defer cancel()
+	resp, err := a.send(ctx, method, path, q, body)
+	var out []byte
+	if err == nil {
+		out, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	switch {
+	case err == nil:
+		return out, nil
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		if d > 0 {
+			return nil, fmt.Errorf("%s %s %w after %s; is the daemon responding? (raise dockerTimeouts in config)", method, path, ErrTimeout, d)
+		}
+		return nil, fmt.Errorf("%s %s %w", method, path, ErrTimeout)
+	case errors.Is(ctx.Err(), context.Canceled):
+		return nil, fmt.Errorf("%s %s: %w", method, path, context.Canceled)
+	}
+	return nil, err
+}
+
+// apiTransient reports whether the daemon could not be reached at all, which
+// is what a restarting daemon looks like over the API.
+func apiTransient(err error) bool {
+	var op *net.OpError
+	return errors.As(err, &op) && op.Op == "dial"
+}
+
+func (a API) getJSON(path string, q url.Values, v any) error {
+	out, err := a.request(opQuery, http.MethodGet, path, q, nil)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(out, v)
+}
+
+// filters encodes the filters query parameter, e.g. {"label": ["a=b"]}.
+func filters(f map[string][]string) url.Values {
+	data, _ := json.Marshal(f)
+	return url.Values{"filters": {string(data)}}
+}
+
+// demux joins the stdout and stderr frames of a non-TTY attach stream in the
+// order they were written, as CombinedOutput would. Output that is not framed
+// (a TTY container) is returned as is.
+func demux(data []byte) []byte {
+	var out []byte
+	for rest := data; len(rest) > 0; {
+		if len(rest) < 8 || rest[0] > 2 || rest[1] != 0 || rest[2] != 0 || rest[3] != 0 {
+			return data
+		}
+		n := int(binary.BigEndian.Uint32(rest[4:8]))
+		if len(rest) < 8+n {
+			return data
+		}
+		out = append(out, rest[8:8+n]...)
+		rest = rest[8+n:]
+	}
+	return out
+}
+
+func containerPath(name, op string) string { return "/containers/" + name + op }
+
+func (a API) Inspect(name string) (Container, error) {
+	out, err := a.request(opQuery, http.MethodGet, containerPath(name, "/json"), nil, nil)
+	if err != nil {
+		return Container{}, fmt.Errorf("docker inspect %s failed: %w", name, err)
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(out, &raw); err != nil {
+		return Container{}, err
+	}
+	return parseInspect(name, raw), nil
+}
+
+func (a API) PS(includeStopped bool) ([]string, error) {
+	q := url.Values{}
+	if includeStopped {
+		q.Set("all", "1")
+	}
+	var list []struct{ Names []string }
+	if err := a.getJSON("/containers/json", q, &list); err != nil {
+		return nil, fmt.Errorf("docker ps failed: %w", err)
+	}
+	var res []string
+	for _, c := range list {
+		if len(c.Names) > 0 {
+			res = append(res, strings.TrimPrefix(c.Names[0], "/"))
+		}
+	}
+	return res, nil
+}
+
+func (a API) change(what, method, path string, q url.Values) error {
+	if _, err := a.request(opChange, method, path, q, nil); err != nil {
+		return fmt.Errorf("docker %s failed: %w", what, err)
+	}
+	return nil
+}
+
+func (a API) Start(name string) error {
+	return a.change("start "+name, http.MethodPost, containerPath(name, "/start"), nil)
+}
+
+func (a API) Restart(name string) error {
+	return a.change("restart "+name, http.MethodPost, containerPath(name, "/restart"), nil)
+}
+
+func (a API) Stop(name string) error {
+	return a.change("stop "+name, http.MethodPost, containerPath(name, "/stop"), nil)
+}
+
+func (a API) Remove(name string, force bool) error {
+	q := url.Values{}
+	if force {
+		q.Set("force", "1")
+	}
+	return a.change("rm "+name, http.MethodDelete, containerPath(name, ""), q)
+}
+
+// ImageExists matches tag the way `docker images TAG` does.
+func (a API) ImageExists(tag string) (bool, error) {
+	var list []struct{ Id string }
+	if err := a.getJSON("/images/json", filters(map[string][]string{"reference": {tag}}), &list); err != nil {
+		return false, fmt.Errorf("docker images check failed: %w", err)
+	}
+	return len(list) > 0, nil
+}
+
+func (a API) ExecOutput(name string, cmdArgs []string) ([]byte, error) {
+	var created struct{ Id string }
+	out, err := a.request(opChange, http.MethodPost, containerPath(name, "/exec"), nil,
+		map[string]any{"AttachStdout": true, "AttachStderr": true, "Cmd": cmdArgs})
+	if err == nil {
+		err = json.Unmarshal(out, &created)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("docker exec %s failed: %w", name, err)
+	}
+	out, err = a.request(opChange, http.MethodPost, "/exec/"+created.Id+"/start", nil, map[string]any{"Detach": false, "Tty": false})
+	if err != nil {
+		return nil, fmt.Errorf("docker exec %s failed: %w", name, err)
+	}
+	out = demux(out)
+	var state struct{ ExitCode int }
+	if err := a.getJSON("/exec/"+created.Id+"/json", nil, &state); err != nil {
+		return out, fmt.Errorf("docker exec %s failed: %w", name, err)
+	}
+	if state.ExitCode != 0 {
+		return out, &exitError{code: state.ExitCode}
+	}
+	return out, nil
+}
+
+func (a API) Logs(name string, tail int) ([]byte, error) {
+	var cfg struct{ Config struct{ Tty bool } }
+	if err := a.getJSON(containerPath(name, "/json"), nil, &cfg); err != nil {
+		return nil, fmt.Errorf("docker logs failed: %w", err)
+	}
+	q := url.Values{"stdout": {"1"}, "stderr": {"1"}, "tail": {"all"}}
+	if tail > 0 {
+		q.Set("tail", strconv.Itoa(tail))
+	}
+	out, err := a.request(opQuery, http.MethodGet, containerPath(name, "/logs"), q, nil)
+	if err != nil {
+		return nil, fmt.Errorf("docker logs failed: %w", err)
+	}
+	if cfg.Config.Tty {
+		return out, nil
+	}
+	return demux(out), nil
+}
+
+func (a API) Events(opts EventOptions, fn func(Event) error) error {
+	f := map[string][]string{"type": {"container"}}
+	if len(opts.Labels) > 0 {
+		f["label"] = opts.Labels
+	}
+	q := filters(f)
+	if !opts.Since.IsZero() {
+		q.Set("since", strconv.FormatInt(opts.Since.Unix(), 10))
+	}
+	if !opts.Until.IsZero() {
+		q.Set("until", strconv.FormatInt(opts.Until.Unix(), 10))
+	}
+	resp, err := a.send(a.context(), http.MethodGet, "/events", q, nil)
+	if err != nil {
+		return fmt.Errorf("docker events failed: %w", err)
+	}
+	defer resp.Body.Close()
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var line json.RawMessage
+		if err := dec.Decode(&line); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("docker events failed: %w", err)
+		}
+		ev, ok := parseEvent(line)
+		if !ok {
+			continue
+		}
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+}
+
+// apiCPU is the cpu_stats or precpu_stats of a stats sample.
+type apiCPU struct {
+	CPUUsage struct {
+		TotalUsage  uint64   `json:"total_usage"`
+		PercpuUsage []uint64 `json:"percpu_usage"`
+	} `json:"cpu_usage"`
+	SystemUsage uint64 `json:"system_cpu_usage"`
+	OnlineCPUs  uint32 `json:"online_cpus"`
+}
+
+// apiStats is one sample of GET /containers/NAME/stats.
+type apiStats struct {
+	CPU    apiCPU `json:"cpu_stats"`
+	PreCPU apiCPU `json:"precpu_stats"`
+	Memory struct {
+		Usage uint64            `json:"usage"`
+		Stats map[string]uint64 `json:"stats"`
+	} `json:"memory_stats"`
+}
+
+// stats computes CPU% and memory the way `docker stats` shows them: CPU
+// across all online CPUs, and memory without the inactive page cache.
+func (s apiStats) stats(name string) Stats {
+	st := Stats{Name: name}
+	cpu := float64(s.CPU.CPUUsage.TotalUsage) - float64(s.PreCPU.CPUUsage.TotalUsage)
+	sys := float64(s.CPU.SystemUsage) - float64(s.PreCPU.SystemUsage)
+	online := float64(s.CPU.OnlineCPUs)
+	if online == 0 {
+		online = float64(len(s.CPU.CPUUsage.PercpuUsage))
+	}
+	if cpu > 0 && sys > 0 {
+		st.CPUPercent = cpu / sys * online * 100
+	}
+	mem := s.Memory.Usage
+	for _, k := range []string{"total_inactive_file", "inactive_file"} {
+		if v, ok := s.Memory.Stats[k]; ok && v < mem {
+			mem -= v
+			break
+		}
+	}
+	st.MemoryBytes = int64(mem)
+	return st
+}
+
+// Stats samples the containers concurrently, since the daemon takes a
+// second per sample to measure CPU.
+func (a API) Stats(names ...string) ([]Stats, error) {
+	res := make([]Stats, len(names))
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i, n := range names {
+		wg.Add(1)
+		go func(i int, n string) {
+			defer wg.Done()
+			var s apiStats
+			if errs[i] = a.getJSON(containerPath(n, "/stats"), url.Values{"stream": {"false"}}, &s); errs[i] == nil {
+				res[i] = s.stats(n)
+			}
+		}(i, n)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("docker stats failed: %w", err)
+		}
+	}
+	return res, nil
+}
+
+func (a API) Top(name string) ([]Process, error) {
+	var doc struct{ Processes [][]string }
+	if err := a.getJSON(containerPath(name, "/top"), url.Values{"ps_args": {"-eo " + topFormat}}, &doc); err != nil {
+		return nil, fmt.Errorf("docker top failed: %w", err)
+	}
+	lines := make([]string, 0, len(doc.Processes))
+	for _, row := range doc.Processes {
+		lines = append(lines, strings.Join(row, " "))
+	}
+	return parseTop([]byte(strings.Join(lines, "\n"))), nil
+}
+
+func (a API) ImageCreated(ref string) (time.Time, error) {
+	var img struct{ Created string }
+	if err := a.getJSON("/images/"+ref+"/json", nil, &img); err != nil {
+		return time.Time{}, fmt.Errorf("docker image inspect %s failed: %w", ref, err)
+	}
+	return time.Parse(time.RFC3339Nano, img.Created)
+}
+
+func (a API) History(ref string) ([]Layer, error) {
+	var list []struct {
+		Id        string
+		Size      int64
+		CreatedBy string
+	}
+	if err := a.getJSON("/images/"+ref+"/history", nil, &list); err != nil {
+		return nil, fmt.Errorf("docker history %s failed: %w", ref, err)
+	}
+	res := make([]Layer, 0, len(list))
+	for _, l := range list {
+		res = append(res, Layer{ID: l.Id, Size: l.Size, CreatedBy: strings.TrimSpace(l.CreatedBy)})
+	}
+	return res, nil
+}
+
+// Images lists one row per tag, and untagged images as <none>, like
+// `docker images`.
+func (a API) Images(label string) ([]Image, error) {
+	var list []struct {
+		Id       string
+		RepoTags []string
+		Created  int64
+		Size     int64
+	}
+	if err := a.getJSON("/images/json", filters(map[string][]string{"label": {label}}), &list); err != nil {
+		return nil, fmt.Errorf("docker images failed: %w", err)
+	}
+	var res []Image
+	for _, img := range list {
+		tags := img.RepoTags
+		if len(tags) == 0 {
+			tags = []string{"<none>:<none>"}
+		}
+		for _, rt := range tags {
+			repo, tag := rt, "<none>"
+			if i := strings.LastIndex(rt, ":"); i > strings.LastIndex(rt, "/") {
+				repo, tag = rt[:i], rt[i+1:]
+			}
+			res = append(res, Image{ID: img.Id, Repository: repo, Tag: tag, CreatedAt: time.Unix(img.Created, 0), Size: img.Size})
+		}
+	}
+	return res, nil
+}
+
+func (a API) ImageLabels(ref string) (map[string]string, error) {
+	var img struct {
+		Config struct{ Labels map[string]string }
+	}
+	if err := a.getJSON("/images/"+ref+"/json", nil, &img); err != nil {
+		return nil, fmt.Errorf("docker image inspect %s failed: %w", ref, err)
+	}
+	if img.Config.Labels == nil {
+		return map[string]string{}, nil
+	}
+	return img.Config.Labels, nil
+}
+
+func (a API) DiskUsage() (DiskUsage, error) {
+	var doc struct {
+		Containers []struct {
+			Names  []string
+			SizeRw int64
+		}
+		Volumes []struct {
+			Name      string
+			UsageData struct{ Size int64 }
+		}
+	}
+	if err := a.getJSON("/system/df", nil, &doc); err != nil {
+		return DiskUsage{}, fmt.Errorf("docker system df failed: %w", err)
+	}
+	du := DiskUsage{Containers: map[string]int64{}, Volumes: map[string]int64{}}
+	for _, c := range doc.Containers {
+		for _, n := range c.Names {
+			du.Containers[strings.TrimPrefix(n, "/")] = c.SizeRw
+		}
+	}
+	for _, v := range doc.Volumes {
+		// -1 means the daemon has not measured the volume.
+		du.Volumes[v.Name] = max(v.UsageData.Size, 0)
+	}
+	return du, nil
+}
+
+func (a API) Info() (EngineInfo, error) {
+	out, err := a.request(opQuery, http.MethodGet, "/info", nil, nil)
+	if err != nil {
+		return EngineInfo{}, fmt.Errorf("docker info failed: %w", err)
+	}
+	return parseInfo(out)
+}
+
+// WithContext returns a copy of a whose calls, including those passed to
+// the CLI, are canceled with ctx.
+func (a API) WithContext(ctx context.Context) Docker {
+	a.Ctx = ctx
+	return &a
+}
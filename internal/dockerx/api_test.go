@@ -0,0 +1,210 @@
+package dockerx
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeDaemon serves h on a unix socket and returns an API engine for it.
+func fakeDaemon(t *testing.T, h http.HandlerFunc) *API {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake daemon listens on a unix socket")
+	}
+	sock := filepath.Join(t.TempDir(), "d.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := &http.Server{Handler: h}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+	return NewAPI("unix://" + sock)
+}
+
+// frame encodes one chunk of a non-TTY attach stream.
+func frame(stream byte, s string) []byte {
+	hdr := []byte{stream, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(hdr[4:], uint32(len(s)))
+	return append(hdr, s...)
+}
+
+func TestAPIQueriesTheDaemon(t *testing.T) {
+	var removed string
+	a := fakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /containers/c/json":
+			fmt.Fprint(w, `{"Id":"abc","State":{"Running":true,"ExitCode":0},"Config":{"Image":"claudex","Labels":{"com.claudex.slug":"x"}},"HostConfig":{"SecurityOpt":["no-new-privileges:true"]}}`)
+		case "GET /containers/missing/json":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message":"No such container: missing"}`)
+		case "GET /containers/json":
+			if r.URL.Query().Get("all") != "1" {
+				fmt.Fprint(w, `[{"Names":["/c"]}]`)
+				return
+			}
+			fmt.Fprint(w, `[{"Names":["/c"]},{"Names":["/stopped"]}]`)
+		case "DELETE /containers/c":
+			removed = r.URL.RawQuery
+			w.WriteHeader(http.StatusNoContent)
+		case "GET /images/json":
+			var f map[string][]string
+			_ = json.Unmarshal([]byte(r.URL.Query().Get("filters")), &f)
+			switch {
+			case reflect.DeepEqual(f, map[string][]string{"reference": {"claudex"}}):
+				fmt.Fprint(w, `[{"Id":"sha256:1"}]`)
+			case reflect.DeepEqual(f, map[string][]string{"label": {BuiltLabel}}):
+				fmt.Fprint(w, `[{"Id":"sha256:1","RepoTags":["claudex:latest","registry:5000/claudex:v2"],"Created":1700000000,"Size":42},{"Id":"sha256:0","RepoTags":null,"Created":1600000000,"Size":7}]`)
+			default:
+				fmt.Fprint(w, `[]`)
+			}
+		case "POST /containers/c/exec":
+			var body struct{ Cmd []string }
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			fmt.Fprintf(w, `{"Id":%q}`, strings.Join(body.Cmd, "-"))
+		case "POST /exec/cat-x/start":
+			w.Write(append(frame(1, "out\n"), frame(2, "err\n")...))
+		case "GET /exec/cat-x/json":
+			fmt.Fprint(w, `{"ExitCode":0}`)
+		case "POST /exec/false/start":
+		case "GET /exec/false/json":
+			fmt.Fprint(w, `{"ExitCode":3}`)
+		case "GET /containers/c/logs":
+			if r.URL.Query().Get("tail") != "5" {
+				t.Errorf("logs query = %s", r.URL.RawQuery)
+			}
+			w.Write(frame(1, "hello\n"))
+		case "GET /containers/c/stats":
+			fmt.Fprint(w, `{"cpu_stats":{"cpu_usage":{"total_usage":300},"system_cpu_usage":2000,"online_cpus":2},"precpu_stats":{"cpu_usage":{"total_usage":100},"system_cpu_usage":1000},"memory_stats":{"usage":3000,"stats":{"inactive_file":1000}}}`)
+		default:
+			t.Errorf("unexpected %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotImplemented)
+		}
+	})
+
+	c, err := a.Inspect("c")
+	if err != nil || c.ID != "abc" || c.Status != "running" || c.Labels["com.claudex.slug"] != "x" || !reflect.DeepEqual(c.SecurityOpt, []string{"no-new-privileges:true"}) {
+		t.Fatalf("inspect = %+v, %v", c, err)
+	}
+	if _, err := a.Inspect("missing"); err == nil || !strings.Contains(err.Error(), "No such container: missing") {
+		t.Fatalf("inspect missing = %v", err)
+	}
+	if names, err := a.PS(false); err != nil || !reflect.DeepEqual(names, []string{"c"}) {
+		t.Fatalf("ps = %v, %v", names, err)
+	}
+	if names, err := a.PS(true); err != nil || !reflect.DeepEqual(names, []string{"c", "stopped"}) {
+		t.Fatalf("ps -a = %v, %v", names, err)
+	}
+	if err := a.Remove("c", true); err != nil || removed != "force=1" {
+		t.Fatalf("remove = %v, query %q", err, removed)
+	}
+	if ok, err := a.ImageExists("claudex"); err != nil || !ok {
+		t.Fatalf("image exists = %v, %v", ok, err)
+	}
+	if ok, err := a.ImageExists("other"); err != nil || ok {
+		t.Fatalf("other image exists = %v, %v", ok, err)
+	}
+	imgs, err := a.Images(BuiltLabel)
+	want := []Image{
+		{ID: "sha256:1", Repository: "claudex", Tag: "latest", CreatedAt: time.Unix(1700000000, 0), Size: 42},
+		{ID: "sha256:1", Repository: "registry:5000/claudex", Tag: "v2", CreatedAt: time.Unix(1700000000, 0), Size: 42},
+		{ID: "sha256:0", Repository: "<none>", Tag: "<none>", CreatedAt: time.Unix(1600000000, 0), Size: 7},
+	}
+	if err != nil || !reflect.DeepEqual(imgs, want) {
+		t.Fatalf("images = %+v, %v", imgs, err)
+	}
+	if out, err := a.ExecOutput("c", []string{"cat", "x"}); err != nil || string(out) != "out\nerr\n" {
+		t.Fatalf("exec = %q, %v", out, err)
+	}
+	var exit interface{ ExitCode() int }
+	if _, err := a.ExecOutput("c", []string{"false"}); !errors.As(err, &exit) || exit.ExitCode() != 3 {
+		t.Fatalf("failed exec = %v", err)
+	}
+	if out, err := a.Logs("c", 5); err != nil || string(out) != "hello\n" {
+		t.Fatalf("logs = %q, %v", out, err)
+	}
+	st, err := a.Stats("c")
+	if err != nil || len(st) != 1 || st[0].Name != "c" || st[0].CPUPercent != 40 || st[0].MemoryBytes != 2000 {
+		t.Fatalf("stats = %+v, %v", st, err)
+	}
+}
+
+func TestAPIEventsFilterAndStop(t *testing.T) {
+	a := fakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		var f map[string][]string
+		_ = json.Unmarshal([]byte(r.URL.Query().Get("filters")), &f)
+		if !reflect.DeepEqual(f, map[string][]string{"type": {"container"}, "label": {"com.claudex.slug"}}) || r.URL.Query().Get("since") != "1700000000" {
+			t.Errorf("events query = %s", r.URL.RawQuery)
+		}
+		for _, action := range []string{"create", "start", "die"} {
+			fmt.Fprintf(w, `{"Type":"container","Action":%q,"Actor":{"ID":"abc","Attributes":{"name":"c"}},"time":1700000001}`+"\n", action)
+		}
+	})
+	var got []string
+	stop := errors.New("stop")
+	err := a.Events(EventOptions{Since: time.Unix(1700000000, 0), Labels: []string{"com.claudex.slug"}}, func(ev Event) error {
+		got = append(got, ev.Name+" "+ev.Action)
+		if ev.Action == "start" {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || !reflect.DeepEqual(got, []string{"c create", "c start"}) {
+		t.Fatalf("events = %v, %v", got, err)
+	}
+}
+
+func TestAPITimesOut(t *testing.T) {
+	a := fakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	a.Timeouts = Timeouts{Query: 100 * time.Millisecond}
+	if _, err := a.PS(false); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("ps err = %v, want ErrTimeout", err)
+	}
+}
+
+func TestAPIPassesCLICallsToTheSameDaemon(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as the engine")
+	}
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	bin := filepath.Join(dir, "docker")
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\necho \"$DOCKER_HOST $*\" >"+log+"\n"), 0755); err != nil {
+		t.Fatalf("write engine: %v", err)
+	}
+	a := NewAPI("unix:///run/other.sock")
+	a.Binary = bin
+	if err := a.WithContext(context.Background()).Run("run", "-d", "--name", "c", "img"); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	out, _ := os.ReadFile(log)
+	if got := strings.TrimSpace(string(out)); got != "unix:///run/other.sock run -d --name c img" {
+		t.Fatalf("cli saw %q", got)
+	}
+}
+
+func TestDemuxKeepsUnframedOutput(t *testing.T) {
+	if got := demux([]byte("plain tty output\n")); string(got) != "plain tty output\n" {
+		t.Fatalf("demux = %q", got)
+	}
+	if got := demux(nil); len(got) != 0 {
+		t.Fatalf("demux(nil) = %q", got)
+	}
+}
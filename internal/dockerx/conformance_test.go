@@ -0,0 +1,134 @@
+package dockerx
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// conformance checks the container lifecycle contract that run and the
+// commands rely on, so the Fake and the real CLI cannot drift apart.
+func conformance(t *testing.T, dx Docker, image string) {
+	t.Helper()
+	name := fmt.Sprintf("claudex-conformance-%d", time.Now().UnixNano())
+	if _, err := dx.Inspect(name); err == nil {
+		t.Fatalf("Inspect of a missing container should fail")
+	}
+	if err := dx.Run("run", "-d", "--name", name, "--label", "com.claudex.conformance=1", image, "sleep", "300"); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	defer dx.Remove(name, true)
+	status := func() string {
+		t.Helper()
+		c, err := dx.Inspect(name)
+		if err != nil {
+			t.Fatalf("inspect: %v", err)
+		}
+		return c.Status
+	}
+	listed := func(includeStopped bool) bool {
+		t.Helper()
+		names, err := dx.PS(includeStopped)
+		if err != nil {
+			t.Fatalf("ps: %v", err)
+		}
+		for _, n := range names {
+			if n == name {
+				return true
+			}
+		}
+		return false
+	}
+	c, err := dx.Inspect(name)
+	if err != nil || c.Status != "running" || c.Labels["com.claudex.conformance"] != "1" {
+		t.Fatalf("after run: %+v, %v", c, err)
+	}
+	if !listed(false) {
+		t.Fatalf("running container missing from PS")
+	}
+	if err := dx.Stop(name); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if s := status(); s != "exited" {
+		t.Fatalf("status after stop = %q", s)
+	}
+	if listed(false) || !listed(true) {
+		t.Fatalf("stopped container should only be listed with includeStopped")
+	}
+	if err := dx.Start(name); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if s := status(); s != "running" {
+		t.Fatalf("status after start = %q", s)
+	}
+	renamed := name + "-renamed"
+	if err := dx.Run("rename", name, renamed); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	defer dx.Remove(renamed, true)
+	if _, err := dx.Inspect(renamed); err != nil {
+		t.Fatalf("inspect after rename: %v", err)
+	}
+	if err := dx.Remove(renamed, true); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if _, err := dx.Inspect(renamed); err == nil {
+		t.Fatalf("removed container still inspectable")
+	}
+}
+
+func TestFakeConformance(t *testing.T) {
+	conformance(t, &Fake{Simulate: true}, "alpine")
+}
+
+// TestCLIConformance runs the suite against a real engine when
+// CLAUDEX_DOCKER_TESTS names an image to use (e.g. alpine).
+func TestCLIConformance(t *testing.T) {
+	image := os.Getenv("CLAUDEX_DOCKER_TESTS")
+	if image == "" {
+		t.Skip("set CLAUDEX_DOCKER_TESTS=<image> to test against a docker daemon")
+	}
+	conformance(t, New(), image)
+}
+
+func TestFakeRecordsCallsAndScriptsErrors(t *testing.T) {
+	boom := errors.New("boom")
+	f := &Fake{ErrFunc: func(c Call) error {
+		if c.Method == "CP" && c.Args[1] == "c:/busy" {
+			return boom
+		}
+		return nil
+	}}
+	_ = f.Start("c")
+	if err := f.CP("a", "c:/ok"); err != nil {
+		t.Fatalf("cp: %v", err)
+	}
+	if err := f.CP("a", "c:/busy"); !errors.Is(err, boom) {
+		t.Fatalf("scripted error = %v", err)
+	}
+	_, _ = f.ImageExists("claudex")
+	if len(f.Calls) != 4 || f.Calls[0].Method != "Start" || f.Calls[3].Method != "ImageExists" {
+		t.Fatalf("calls = %+v", f.Calls)
+	}
+	if cps := f.CallsTo("CP"); len(cps) != 2 || cps[1].Args[1] != "c:/busy" {
+		t.Fatalf("CP calls = %+v", cps)
+	}
+
+	// The Fake is shared by concurrent flows such as `up --separate`.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_ = f.Run("run", "-d", "--name", fmt.Sprint(i), "img")
+			_, _ = f.Inspect(fmt.Sprint(i))
+		}(i)
+	}
+	wg.Wait()
+	if len(f.RunCalls) != 8 {
+		t.Fatalf("run calls = %d", len(f.RunCalls))
+	}
+}
@@ -1,13 +1,17 @@
 package dockerx
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -17,21 +21,160 @@ type Docker interface {
 	Inspect(name string) (Container, error)
 	PS(includeStopped bool) ([]string, error)
 	Run(args ...string) error
+	// Stream runs `docker ARGS...` with output on the terminal, for long
+	// transfers such as push and pull where progress matters.
+	Stream(args ...string) error
 	Exec(args ...string) error
 	CP(src, dst string) error
 	Start(name string) error
+	Restart(name string) error
+	Stop(name string) error
 	Remove(name string, force bool) error
 	ImageExists(tag string) (bool, error)
 	Build(tag, contextDir string, opts BuildOptions) error
-	ExecInteractive(name string, cmd []string, in io.Reader, out, errOut io.Writer) error
+	ExecInteractive(name string, cmd []string, opts ExecOptions, in io.Reader, out, errOut io.Writer) error
 	ExecOutput(name string, cmd []string) ([]byte, error)
+	// ExecStream runs `docker exec ARGS...` without a TTY, streaming output.
+	// A non-zero exit surfaces as an error with an ExitCode() method.
+	ExecStream(args []string, out, errOut io.Writer) error
 	Logs(name string, tail int) ([]byte, error)
+	Events(opts EventOptions, fn func(Event) error) error
+	Stats(names ...string) ([]Stats, error)
+	Top(name string) ([]Process, error)
+	ImageCreated(ref string) (time.Time, error)
+	// History lists the layers of an image, newest first.
+	History(ref string) ([]Layer, error)
+	// Images lists local images carrying label, including untagged ones.
+	Images(label string) ([]Image, error)
+	ImageLabels(ref string) (map[string]string, error)
+	// DiskUsage reports container writable layers and volumes by size.
+	DiskUsage() (DiskUsage, error)
+	// Info describes the engine, for checks made before creating containers.
+	Info() (EngineInfo, error)
+	// WithContext returns a Docker whose calls are canceled with ctx.
+	WithContext(ctx context.Context) Docker
+}
+
+// BuiltLabel is set on every image claudex builds to its build time, so
+// superseded builds can be found after their tag moves on.
+const BuiltLabel = "com.claudex.built"
+
+// Image is one row of `docker images`. Repository and Tag are "<none>" for
+// images whose tag moved to a newer build.
+type Image struct {
+	ID         string
+	Repository string
+	Tag        string
+	CreatedAt  time.Time
+	Size       int64
+}
+
+// EngineInfo is the part of `docker info` claudex checks before creating a
+// container. Fields an engine does not report are left empty.
+type EngineInfo struct {
+	// OperatingSystem is e.g. "Docker Desktop" or "Ubuntu 24.04 LTS".
+	OperatingSystem string
+	DockerRootDir   string
+	// Runtimes are the OCI runtimes --runtime accepts.
+	Runtimes []string
+	// SecurityOptions are entries such as "name=userns" or "name=rootless".
+	SecurityOptions []string
+}
+
+// DockerDesktop reports whether the engine runs in Docker Desktop's VM.
+func (i EngineInfo) DockerDesktop() bool {
+	return strings.Contains(i.OperatingSystem, "Docker Desktop")
+}
+
+// SecurityOption reports whether the engine lists name=NAME.
+func (i EngineInfo) SecurityOption(name string) bool {
+	for _, o := range i.SecurityOptions {
+		if o == "name="+name || strings.HasPrefix(o, "name="+name+",") {
+			return true
+		}
+	}
+	return false
+}
+
+// DiskUsage is `docker system df -v` keyed by name: each container's
+// writable layer and each volume, in bytes.
+type DiskUsage struct {
+	Containers map[string]int64
+	Volumes    map[string]int64
+}
+
+// Stats is a point-in-time resource sample for one running container.
+type Stats struct {
+	Name        string
+	CPUPercent  float64
+	MemoryBytes int64
+}
+
+// Process is one row of `docker top`. PIDs are host PIDs.
+type Process struct {
+	PID     int
+	PPID    int
+	Stat    string
+	CPU     float64
+	RSSKiB  int64
+	Elapsed string
+	Command string
+}
+
+// Layer is one row of `docker history`. ID is "<missing>" for layers
+// pulled or built without a local intermediate image.
+type Layer struct {
+	ID        string
+	Size      int64
+	CreatedBy string
+}
+
+// EventOptions filters Events.
+type EventOptions struct {
+	Since time.Time
+	// Until stops the stream at that time; zero follows until fn returns an error.
+	Until time.Time
+	// Labels restricts events to containers carrying each label ("key" or "key=value").
+	Labels []string
+}
+
+// Event is a container lifecycle event reported by the engine.
+type Event struct {
+	Time   time.Time
+	Action string
+	ID     string
+	Name   string
+	Labels map[string]string
 }
 
 // BuildOptions configures docker build behaviour.
 type BuildOptions struct {
 	NoCache   bool
 	BuildArgs map[string]string
+	// Labels are added to the built image.
+	Labels map[string]string
+	// Context, when set, is a tar stream fed to stdin; pass "-" as the context dir.
+	Context io.Reader
+}
+
+// ExecOptions adjusts an interactive exec.
+type ExecOptions struct {
+	// Env adds KEY=VALUE entries, or KEY alone to pass the host's value.
+	Env []string
+	// Workdir is the directory the command starts in; empty keeps the
+	// image's WORKDIR.
+	Workdir string
+}
+
+func (o ExecOptions) args() []string {
+	var args []string
+	if o.Workdir != "" {
+		args = append(args, "-w", o.Workdir)
+	}
+	for _, e := range o.Env {
+		args = append(args, "-e", e)
+	}
+	return args
 }
 
 type Container struct {
@@ -41,46 +184,130 @@ type Container struct {
 	Status    string
 	CreatedAt time.Time
 	Labels    map[string]string
+	// Health is the HEALTHCHECK status (starting, healthy, unhealthy) or "" when none is defined.
+	Health string
+	// ExitCode is the last exit code of the container's command.
+	ExitCode int
+	// RestartCount counts restarts by the daemon's restart policy.
+	RestartCount int
+	// Mounts lists bind mounts and volumes.
+	Mounts []Mount
+	// Memory is the memory limit in bytes (0 when unlimited).
+	Memory int64
+	// Env is the environment as KEY=VALUE, including the image's.
+	Env        []string
+	Cmd        []string
+	WorkingDir string
+	// NetworkMode is "bridge", "host", "default" or a network name.
+	NetworkMode string
+	Privileged  bool
+	Runtime     string
+	CapAdd      []string
+	// SecurityOpt lists --security-opt values, e.g. "no-new-privileges:true".
+	SecurityOpt []string
+	// Tmpfs maps tmpfs mount points to their options.
+	Tmpfs       map[string]string
+	Healthcheck *Healthcheck
+}
+
+// Healthcheck is a container's HEALTHCHECK configuration.
+type Healthcheck struct {
+	Test     []string
+	Interval time.Duration
+	Timeout  time.Duration
+	Retries  int
+}
+
+// Mount is a bind mount or volume attached to a container.
+type Mount struct {
+	// Type is "bind", "volume" or "tmpfs"; Name is set for volumes.
+	Type        string
+	Name        string
+	Source      string
+	Destination string
+	RW          bool
+}
+
+// CLI implements Docker using the local docker CLI, or any binary that
+// accepts the same arguments (podman, nerdctl, engine plugins).
+type CLI struct {
+	// Binary is the executable to invoke; empty means "docker".
+	Binary string
+	// Env is added to the environment of every call, e.g. DOCKER_HOST.
+	Env []string
+	// Ctx cancels in-flight calls; nil means the context set by SetContext.
+	Ctx context.Context
+	// Timeouts overrides the SetTimeouts bounds where non-zero.
+	Timeouts Timeouts
+	// Retry overrides DefaultRetry for transient failures when it sets
+	// Attempts or Timeout.
+	Retry Backoff
 }
 
-// CLI implements Docker using the local docker CLI.
-type CLI struct{}
+func (c CLI) bin() string {
+	if c.Binary == "" {
+		return "docker"
+	}
+	return c.Binary
+}
 
-func dockerOutput(args ...string) ([]byte, error) {
-	cmd := exec.Command("docker", args...)
-	return cmd.CombinedOutput()
+func (c CLI) output(args ...string) ([]byte, error) {
+	return c.outputOf(opQuery, args...)
 }
 
-func (CLI) Run(args ...string) error {
-	cmd := exec.Command("docker", args...)
-	cmd.Stdout = bytes.NewBuffer(nil)
-	cmd.Stderr = bytes.NewBuffer(nil)
-	return cmd.Run()
+func (c CLI) outputOf(kind opKind, args ...string) ([]byte, error) {
+	var out []byte
+	err := c.call(kind, args, func(cmd *exec.Cmd) (err error) {
+		out, err = cmd.CombinedOutput()
+		return withOutput(err, out)
+	})
+	return out, withoutOutput(err)
 }
 
-func (CLI) Exec(args ...string) error { return (&CLI{}).Run(append([]string{"exec"}, args...)...) }
+func (c CLI) Run(args ...string) error {
+	return c.call(opChange, args, func(cmd *exec.Cmd) error {
+		var stderr bytes.Buffer
+		cmd.Stdout = bytes.NewBuffer(nil)
+		cmd.Stderr = &stderr
+		return withOutput(cmd.Run(), stderr.Bytes())
+	})
+}
+
+func (c CLI) Stream(args ...string) error {
+	return c.call(opUnbounded, args, func(cmd *exec.Cmd) error {
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		return cmd.Run()
+	})
+}
+
+func (c CLI) Exec(args ...string) error { return c.Run(append([]string{"exec"}, args...)...) }
+
+func (c CLI) CP(src, dst string) error { return c.Run("cp", src, dst) }
+
+func (c CLI) Start(name string) error { return c.Run("start", name) }
 
-func (CLI) CP(src, dst string) error { return (&CLI{}).Run("cp", src, dst) }
+func (c CLI) Restart(name string) error { return c.Run("restart", name) }
 
-func (CLI) Start(name string) error { return (&CLI{}).Run("start", name) }
+func (c CLI) Stop(name string) error { return c.Run("stop", name) }
 
-func (CLI) Remove(name string, force bool) error {
+func (c CLI) Remove(name string, force bool) error {
 	if force {
-		return (&CLI{}).Run("rm", "-f", name)
+		return c.Run("rm", "-f", name)
 	}
-	return (&CLI{}).Run("rm", name)
+	return c.Run("rm", name)
 }
 
-func (CLI) ImageExists(tag string) (bool, error) {
-	out, err := dockerOutput("images", "-q", tag)
+func (c CLI) ImageExists(tag string) (bool, error) {
+	out, err := c.output("images", "-q", tag)
 	if err != nil {
 		return false, fmt.Errorf("docker images check failed: %w", err)
 	}
 	return len(bytes.TrimSpace(out)) > 0, nil
 }
 
-func (CLI) Build(tag, contextDir string, opts BuildOptions) error {
-	args := []string{"build", "-t", tag}
+func (c CLI) Build(tag, contextDir string, opts BuildOptions) error {
+	args := []string{"build", "-t", tag, "--label", BuiltLabel + "=" + time.Now().UTC().Format(time.RFC3339)}
 	if opts.NoCache {
 		args = append(args, "--no-cache")
 	}
@@ -94,44 +321,404 @@ func (CLI) Build(tag, contextDir string, opts BuildOptions) error {
 			args = append(args, "--build-arg", fmt.Sprintf("%s=%s", k, opts.BuildArgs[k]))
 		}
 	}
+	keys := make([]string, 0, len(opts.Labels))
+	for k := range opts.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "--label", k+"="+opts.Labels[k])
+	}
 	args = append(args, contextDir)
-	cmd := exec.Command("docker", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	return c.call(opUnbounded, args, func(cmd *exec.Cmd) error {
+		if opts.Context != nil {
+			cmd.Stdin = opts.Context
+		}
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		return cmd.Run()
+	})
+}
+
+// ExecInteractive runs cmd in name with the caller's terminal, allocating a
+// TTY only when in and out are one (see ttyFlags). Pass the *os.File itself,
+// not a wrapper, so the engine CLI can follow resizes.
+func (c CLI) ExecInteractive(name string, cmdArgs []string, opts ExecOptions, in io.Reader, out, errOut io.Writer) error {
+	flags := ttyFlags(in, out)
+	args := append(append(append(append([]string{"exec"}, flags...), opts.args()...), name), cmdArgs...)
+	if len(flags) > 1 {
+		defer saveTerminal(in)()
+	}
+	return c.call(opUnbounded, args, func(cmd *exec.Cmd) error {
+		cmd.Stdin = in
+		cmd.Stdout = out
+		cmd.Stderr = errOut
+		terminateGently(cmd)
+		return cmd.Run()
+	})
 }
 
-func (CLI) ExecInteractive(name string, cmdArgs []string, in io.Reader, out, errOut io.Writer) error {
-	args := append([]string{"exec", "-it", name}, cmdArgs...)
-	cmd := exec.Command("docker", args...)
-	cmd.Stdin = in
-	cmd.Stdout = out
-	cmd.Stderr = errOut
-	return cmd.Run()
+func (c CLI) ExecStream(args []string, out, errOut io.Writer) error {
+	return c.call(opUnbounded, append([]string{"exec"}, args...), func(cmd *exec.Cmd) error {
+		cmd.Stdout = out
+		cmd.Stderr = errOut
+		return cmd.Run()
+	})
 }
 
-func (CLI) ExecOutput(name string, cmdArgs []string) ([]byte, error) {
+func (c CLI) ExecOutput(name string, cmdArgs []string) ([]byte, error) {
 	args := append([]string{"exec", name}, cmdArgs...)
-	return dockerOutput(args...)
+	return c.outputOf(opChange, args...)
 }
 
-func (CLI) Logs(name string, tail int) ([]byte, error) {
+func (c CLI) Logs(name string, tail int) ([]byte, error) {
 	args := []string{"logs"}
 	if tail > 0 {
 		args = append(args, "--tail", fmt.Sprintf("%d", tail))
 	}
 	args = append(args, name)
-	return dockerOutput(args...)
+	return c.output(args...)
+}
+
+func (c CLI) Events(opts EventOptions, fn func(Event) error) error {
+	args := []string{"events", "--format", "{{json .}}", "--filter", "type=container"}
+	for _, l := range opts.Labels {
+		args = append(args, "--filter", "label="+l)
+	}
+	if !opts.Since.IsZero() {
+		args = append(args, "--since", fmt.Sprintf("%d", opts.Since.Unix()))
+	}
+	if !opts.Until.IsZero() {
+		args = append(args, "--until", fmt.Sprintf("%d", opts.Until.Unix()))
+	}
+	var stderr bytes.Buffer
+	err := c.call(opUnbounded, args, func(cmd *exec.Cmd) error {
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		cmd.Stderr = &stderr
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		sc := bufio.NewScanner(stdout)
+		for sc.Scan() {
+			ev, ok := parseEvent(sc.Bytes())
+			if !ok {
+				continue
+			}
+			if err := fn(ev); err != nil {
+				_ = cmd.Process.Kill()
+				_ = cmd.Wait()
+				return errStopEvents{err}
+			}
+		}
+		return cmd.Wait()
+	})
+	var stop errStopEvents
+	switch {
+	case errors.As(err, &stop):
+		return stop.err
+	case err != nil && stderr.Len() > 0:
+		return fmt.Errorf("docker events failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	case err != nil:
+		return fmt.Errorf("docker events failed: %w", err)
+	}
+	return nil
+}
+
+// errStopEvents carries the callback's error out of Events unchanged.
+type errStopEvents struct{ err error }
+
+func (e errStopEvents) Error() string { return e.err.Error() }
+
+// parseEvent decodes one `docker events --format '{{json .}}'` line.
+func parseEvent(line []byte) (Event, bool) {
+	var raw struct {
+		Action   string
+		Status   string `json:"status"`
+		ID       string `json:"id"`
+		TimeNano int64  `json:"timeNano"`
+		Time     int64  `json:"time"`
+		Actor    struct {
+			ID         string
+			Attributes map[string]string
+		}
+	}
+	if err := json.Unmarshal(line, &raw); err != nil {
+		return Event{}, false
+	}
+	ev := Event{Action: raw.Action, ID: raw.Actor.ID, Labels: map[string]string{}}
+	if ev.Action == "" {
+		ev.Action = raw.Status
+	}
+	if ev.ID == "" {
+		ev.ID = raw.ID
+	}
+	switch {
+	case raw.TimeNano > 0:
+		ev.Time = time.Unix(0, raw.TimeNano)
+	case raw.Time > 0:
+		ev.Time = time.Unix(raw.Time, 0)
+	}
+	for k, v := range raw.Actor.Attributes {
+		if k == "name" {
+			ev.Name = v
+			continue
+		}
+		ev.Labels[k] = v
+	}
+	if ev.Action == "" {
+		return Event{}, false
+	}
+	return ev, true
+}
+
+func (c CLI) Stats(names ...string) ([]Stats, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	args := append([]string{"stats", "--no-stream", "--format", "{{.Name}}\t{{.CPUPerc}}\t{{.MemUsage}}"}, names...)
+	out, err := c.output(args...)
+	if err != nil {
+		return nil, fmt.Errorf("docker stats failed: %w: %s", err, string(out))
+	}
+	return parseStats(out), nil
+}
+
+// topFormat is passed to ps by docker top; args must stay last since it
+// contains spaces.
+const topFormat = "pid,ppid,stat,pcpu,rss,etime,args"
+
+func (c CLI) Top(name string) ([]Process, error) {
+	out, err := c.output("top", name, "-eo", topFormat)
+	if err != nil {
+		return nil, fmt.Errorf("docker top failed: %w: %s", err, string(out))
+	}
+	return parseTop(out), nil
+}
+
+// parseTop decodes docker top output for topFormat, skipping the header.
+func parseTop(out []byte) []Process {
+	var res []Process
+	for _, line := range strings.Split(string(out), "\n") {
+		f := strings.Fields(line)
+		if len(f) < 7 {
+			continue
+		}
+		pid, err := strconv.Atoi(f[0])
+		if err != nil {
+			continue // header
+		}
+		p := Process{PID: pid, Stat: f[2], Elapsed: f[5], Command: strings.Join(f[6:], " ")}
+		p.PPID, _ = strconv.Atoi(f[1])
+		p.CPU, _ = strconv.ParseFloat(f[3], 64)
+		p.RSSKiB, _ = strconv.ParseInt(f[4], 10, 64)
+		res = append(res, p)
+	}
+	return res
+}
+
+// parseStats decodes `docker stats` lines of NAME<TAB>CPU%<TAB>USED / LIMIT.
+func parseStats(out []byte) []Stats {
+	var res []Stats
+	for _, line := range strings.Split(string(out), "\n") {
+		parts := strings.Split(strings.TrimSpace(line), "\t")
+		if len(parts) != 3 {
+			continue
+		}
+		st := Stats{Name: parts[0]}
+		st.CPUPercent, _ = strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(parts[1]), "%"), 64)
+		used, _, _ := strings.Cut(parts[2], "/")
+		st.MemoryBytes = parseSize(strings.TrimSpace(used))
+		res = append(res, st)
+	}
+	return res
+}
+
+// parseSize converts docker's human sizes ("12.5MiB", "1.2GB") to bytes.
+func parseSize(s string) int64 {
+	units := []struct {
+		suffix string
+		mult   float64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+		{"kB", 1e3}, {"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12}, {"B", 1},
+	}
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			v, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), 64)
+			if err != nil {
+				return 0
+			}
+			return int64(v * u.mult)
+		}
+	}
+	v, _ := strconv.ParseFloat(s, 64)
+	return int64(v)
+}
+
+func (c CLI) DiskUsage() (DiskUsage, error) {
+	out, err := c.output("system", "df", "-v", "--format", "json")
+	if err != nil {
+		return DiskUsage{}, fmt.Errorf("docker system df failed: %w: %s", err, string(out))
+	}
+	return parseDiskUsage(out)
+}
+
+// parseDiskUsage decodes `system df -v --format json`. Docker reports sizes
+// as human strings, containers as "12kB (virtual 1.2GB)"; podman as numbers.
+func parseDiskUsage(out []byte) (DiskUsage, error) {
+	du := DiskUsage{Containers: map[string]int64{}, Volumes: map[string]int64{}}
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var doc struct {
+			Containers []struct {
+				Names string
+				Name  string
+				Size  any
+			}
+			Volumes []struct {
+				Name       string
+				VolumeName string
+				Size       any
+			}
+		}
+		if err := dec.Decode(&doc); err == io.EOF {
+			return du, nil
+		} else if err != nil {
+			return du, fmt.Errorf("unreadable docker system df output: %w", err)
+		}
+		for _, ct := range doc.Containers {
+			for _, n := range strings.Split(ct.Names+","+ct.Name, ",") {
+				if n = strings.TrimPrefix(strings.TrimSpace(n), "/"); n != "" {
+					du.Containers[n] = diskSize(ct.Size)
+				}
+			}
+		}
+		for _, v := range doc.Volumes {
+			name := v.Name
+			if name == "" {
+				name = v.VolumeName
+			}
+			du.Volumes[name] = diskSize(v.Size)
+		}
+	}
+}
+
+func diskSize(v any) int64 {
+	switch v := v.(type) {
+	case float64:
+		return int64(v)
+	case string:
+		s, _, _ := strings.Cut(v, " ")
+		return parseSize(s)
+	}
+	return 0
+}
+
+func (c CLI) Info() (EngineInfo, error) {
+	out, err := c.output("info", "--format", "{{json .}}")
+	if err != nil {
+		return EngineInfo{}, fmt.Errorf("docker info failed: %w: %s", err, string(out))
+	}
+	return parseInfo(out)
+}
+
+// parseInfo decodes `info --format '{{json .}}'`. Runtimes is an object
+// keyed by runtime name.
+func parseInfo(out []byte) (EngineInfo, error) {
+	var doc struct {
+		OperatingSystem string
+		DockerRootDir   string
+		Runtimes        map[string]json.RawMessage
+		SecurityOptions []string
+	}
+	if err := json.Unmarshal(out, &doc); err != nil {
+		return EngineInfo{}, fmt.Errorf("unreadable docker info output: %w", err)
+	}
+	info := EngineInfo{OperatingSystem: doc.OperatingSystem, DockerRootDir: doc.DockerRootDir, SecurityOptions: doc.SecurityOptions}
+	for name := range doc.Runtimes {
+		info.Runtimes = append(info.Runtimes, name)
+	}
+	sort.Strings(info.Runtimes)
+	return info, nil
+}
+
+func (c CLI) ImageCreated(ref string) (time.Time, error) {
+	out, err := c.output("image", "inspect", "--format", "{{.Created}}", ref)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("docker image inspect %s failed: %w: %s", ref, err, string(out))
+	}
+	return time.Parse(time.RFC3339Nano, strings.TrimSpace(string(out)))
 }
 
-func (CLI) PS(includeStopped bool) ([]string, error) {
+func (c CLI) History(ref string) ([]Layer, error) {
+	out, err := c.output("history", "--no-trunc", "--human=false", "--format", "{{.ID}}\t{{.Size}}\t{{.CreatedBy}}", ref)
+	if err != nil {
+		return nil, fmt.Errorf("docker history %s failed: %w: %s", ref, err, string(out))
+	}
+	return parseHistory(out), nil
+}
+
+// parseHistory decodes ID<TAB>SIZE<TAB>CREATED BY lines; the command may
+// itself contain tabs.
+func parseHistory(out []byte) []Layer {
+	var res []Layer
+	for _, line := range strings.Split(string(out), "\n") {
+		parts := strings.SplitN(line, "\t", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		size, _ := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+		res = append(res, Layer{ID: parts[0], Size: size, CreatedBy: strings.TrimSpace(parts[2])})
+	}
+	return res
+}
+
+func (c CLI) Images(label string) ([]Image, error) {
+	out, err := c.output("images", "--no-trunc", "--filter", "label="+label, "--format", "{{.ID}}\t{{.Repository}}\t{{.Tag}}\t{{.CreatedAt}}\t{{.Size}}")
+	if err != nil {
+		return nil, fmt.Errorf("docker images failed: %w: %s", err, string(out))
+	}
+	return parseImages(out), nil
+}
+
+// parseImages decodes ID<TAB>REPO<TAB>TAG<TAB>CREATED<TAB>SIZE lines.
+func parseImages(out []byte) []Image {
+	var res []Image
+	for _, line := range strings.Split(string(out), "\n") {
+		parts := strings.Split(strings.TrimSpace(line), "\t")
+		if len(parts) != 5 {
+			continue
+		}
+		img := Image{ID: parts[0], Repository: parts[1], Tag: parts[2], Size: parseSize(parts[4])}
+		img.CreatedAt, _ = time.Parse("2006-01-02 15:04:05 -0700 MST", parts[3])
+		res = append(res, img)
+	}
+	return res
+}
+
+func (c CLI) ImageLabels(ref string) (map[string]string, error) {
+	out, err := c.output("image", "inspect", "--format", "{{json .Config.Labels}}", ref)
+	if err != nil {
+		return nil, fmt.Errorf("docker image inspect %s failed: %w: %s", ref, err, string(out))
+	}
+	labels := map[string]string{}
+	if err := json.Unmarshal(bytes.TrimSpace(out), &labels); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+func (c CLI) PS(includeStopped bool) ([]string, error) {
 	args := []string{"ps", "--format", "{{.Names}}"}
 	if includeStopped {
 		args = append(args, "-a")
 	}
-	out, err := dockerOutput(args...)
+	out, err := c.output(args...)
 	if err != nil {
-		return nil, fmt.Errorf("docker ps failed: %v: %s", err, string(out))
+		return nil, fmt.Errorf("docker ps failed: %w: %s", err, string(out))
 	}
 	lines := strings.FieldsFunc(string(out), func(r rune) bool { return r == '\n' || r == '\r' })
 	var res []string
@@ -144,10 +731,10 @@ func (CLI) PS(includeStopped bool) ([]string, error) {
 	return res, nil
 }
 
-func (CLI) Inspect(name string) (Container, error) {
-	out, err := dockerOutput("inspect", name)
+func (c CLI) Inspect(name string) (Container, error) {
+	out, err := c.output("inspect", name)
 	if err != nil {
-		return Container{}, fmt.Errorf("docker inspect %s failed: %v: %s", name, err, string(out))
+		return Container{}, fmt.Errorf("docker inspect %s failed: %w: %s", name, err, string(out))
 	}
 	var arr []map[string]any
 	if err := json.Unmarshal(out, &arr); err != nil {
@@ -156,9 +743,18 @@ func (CLI) Inspect(name string) (Container, error) {
 	if len(arr) == 0 {
 		return Container{}, fmt.Errorf("no such container: %s", name)
 	}
-	raw := arr[0]
-	var state string
+	return parseInspect(name, arr[0]), nil
+}
+
+// parseInspect decodes one object of `docker inspect`, which is also what
+// the Engine API returns for GET /containers/NAME/json.
+func parseInspect(name string, raw map[string]any) Container {
+	var state, health string
+	var exitCode, restarts int
 	if st, ok := raw["State"].(map[string]any); ok {
+		if v, ok := st["ExitCode"].(float64); ok {
+			exitCode = int(v)
+		}
 		if run, ok := st["Running"].(bool); ok {
 			if run {
 				state = "running"
@@ -166,6 +762,12 @@ func (CLI) Inspect(name string) (Container, error) {
 				state = "exited"
 			}
 		}
+		if h, ok := st["Health"].(map[string]any); ok {
+			health, _ = h["Status"].(string)
+		}
+	}
+	if v, ok := raw["RestartCount"].(float64); ok {
+		restarts = int(v)
 	}
 	var createdAt time.Time
 	if s, ok := raw["Created"].(string); ok {
@@ -183,14 +785,79 @@ func (CLI) Inspect(name string) (Container, error) {
 		}
 	}
 	image := ""
+	var env, cmd []string
+	var workdir string
+	var check *Healthcheck
 	if c, ok := raw["Config"].(map[string]any); ok {
 		if s, ok := c["Image"].(string); ok {
 			image = s
 		}
+		env = stringList(c["Env"])
+		cmd = stringList(c["Cmd"])
+		workdir, _ = c["WorkingDir"].(string)
+		if h, ok := c["Healthcheck"].(map[string]any); ok {
+			check = &Healthcheck{Test: stringList(h["Test"])}
+			if v, ok := h["Interval"].(float64); ok {
+				check.Interval = time.Duration(v)
+			}
+			if v, ok := h["Timeout"].(float64); ok {
+				check.Timeout = time.Duration(v)
+			}
+			if v, ok := h["Retries"].(float64); ok {
+				check.Retries = int(v)
+			}
+		}
 	}
 	id := ""
 	if s, ok := raw["Id"].(string); ok {
 		id = s
 	}
-	return Container{ID: id, Name: name, Image: image, Status: state, CreatedAt: createdAt, Labels: labels}, nil
+	var mounts []Mount
+	if ms, ok := raw["Mounts"].([]any); ok {
+		for _, m := range ms {
+			if mm, ok := m.(map[string]any); ok {
+				var mt Mount
+				mt.Type, _ = mm["Type"].(string)
+				mt.Name, _ = mm["Name"].(string)
+				mt.Source, _ = mm["Source"].(string)
+				mt.Destination, _ = mm["Destination"].(string)
+				mt.RW, _ = mm["RW"].(bool)
+				mounts = append(mounts, mt)
+			}
+		}
+	}
+	var memory int64
+	var network, runtime string
+	var privileged bool
+	var caps, secopts []string
+	tmpfs := map[string]string{}
+	if hc, ok := raw["HostConfig"].(map[string]any); ok {
+		if m, ok := hc["Memory"].(float64); ok {
+			memory = int64(m)
+		}
+		network, _ = hc["NetworkMode"].(string)
+		runtime, _ = hc["Runtime"].(string)
+		privileged, _ = hc["Privileged"].(bool)
+		caps = stringList(hc["CapAdd"])
+		secopts = stringList(hc["SecurityOpt"])
+		if t, ok := hc["Tmpfs"].(map[string]any); ok {
+			for k, v := range t {
+				tmpfs[k], _ = v.(string)
+			}
+		}
+	}
+	return Container{ID: id, Name: name, Image: image, Status: state, CreatedAt: createdAt, Labels: labels, Health: health, ExitCode: exitCode, RestartCount: restarts, Mounts: mounts, Memory: memory,
+		Env: env, Cmd: cmd, WorkingDir: workdir, NetworkMode: network, Privileged: privileged, Runtime: runtime, CapAdd: caps, SecurityOpt: secopts, Tmpfs: tmpfs, Healthcheck: check}
+}
+
+// stringList converts a decoded JSON array of strings, ignoring other values.
+func stringList(v any) []string {
+	arr, _ := v.([]any)
+	var res []string
+	for _, x := range arr {
+		if s, ok := x.(string); ok {
+			res = append(res, s)
+		}
+	}
+	return res
 }
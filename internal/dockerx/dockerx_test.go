@@ -0,0 +1,88 @@
+package dockerx
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseEvent(t *testing.T) {
+	line := `{"status":"start","id":"abc","Type":"container","Action":"start","Actor":{"ID":"abc","Attributes":{"name":"claudex-x-1234","com.claudex.slug":"x"}},"time":1700000000,"timeNano":1700000000123456789}`
+	ev, ok := parseEvent([]byte(line))
+	if !ok || ev.Action != "start" || ev.Name != "claudex-x-1234" || ev.ID != "abc" || ev.Labels["com.claudex.slug"] != "x" {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+	if ev.Time.UnixNano() != 1700000000123456789 {
+		t.Fatalf("time = %v", ev.Time)
+	}
+	if _, ok := parseEvent([]byte("not json")); ok {
+		t.Fatalf("expected malformed line to be skipped")
+	}
+}
+
+func TestParseStats(t *testing.T) {
+	out := "claudex-a-1\t12.50%\t100MiB / 1.5GiB\nclaudex-b-2\t0.00%\t1.2GB / 2GB\nbogus\n"
+	got := parseStats([]byte(out))
+	if len(got) != 2 {
+		t.Fatalf("stats = %+v", got)
+	}
+	if got[0].Name != "claudex-a-1" || got[0].CPUPercent != 12.5 || got[0].MemoryBytes != 100<<20 {
+		t.Fatalf("first = %+v", got[0])
+	}
+	if got[1].MemoryBytes != 1200000000 {
+		t.Fatalf("second = %+v", got[1])
+	}
+}
+
+func TestParseTop(t *testing.T) {
+	out := []byte("PID  PPID STAT %CPU   RSS     ELAPSED COMMAND\n4242 4200 Sl   12.5  204800  01:02:03 node /usr/local/bin/claude --resume\n")
+	got := parseTop(out)
+	if len(got) != 1 {
+		t.Fatalf("got %d processes", len(got))
+	}
+	p := got[0]
+	if p.PID != 4242 || p.PPID != 4200 || p.Stat != "Sl" || p.CPU != 12.5 || p.RSSKiB != 204800 || p.Elapsed != "01:02:03" || p.Command != "node /usr/local/bin/claude --resume" {
+		t.Fatalf("unexpected process: %+v", p)
+	}
+}
+
+func TestParseHistory(t *testing.T) {
+	out := []byte("sha256:abc\t1048576\tRUN /bin/sh -c apt-get install -y\tgit\n<missing>\t0\tENV TZ=\n")
+	got := parseHistory(out)
+	if len(got) != 2 || got[0].ID != "sha256:abc" || got[0].Size != 1<<20 || got[0].CreatedBy != "RUN /bin/sh -c apt-get install -y\tgit" {
+		t.Fatalf("unexpected layers: %+v", got)
+	}
+}
+
+func TestParseImages(t *testing.T) {
+	out := []byte("sha256:new\tclaudex\tlatest\t2026-10-01 10:00:00 +0000 UTC\t3.2GB\nsha256:old\t<none>\t<none>\t2026-09-01 10:00:00 +0000 UTC\t2.9GB\n")
+	got := parseImages(out)
+	if len(got) != 2 || got[0].Repository != "claudex" || got[1].Tag != "<none>" || got[1].Size != 2900000000 || got[0].CreatedAt.Month() != 10 {
+		t.Fatalf("unexpected images: %+v", got)
+	}
+}
+
+func TestParseInfo(t *testing.T) {
+	out := `{"OperatingSystem":"Docker Desktop","DockerRootDir":"/var/lib/docker","Runtimes":{"runc":{"path":"runc"},"sysbox-runc":{"path":"/usr/bin/sysbox-runc"}},"SecurityOptions":["name=seccomp,profile=unconfined","name=rootless"]}`
+	info, err := parseInfo([]byte(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.DockerDesktop() || info.DockerRootDir != "/var/lib/docker" || strings.Join(info.Runtimes, ",") != "runc,sysbox-runc" {
+		t.Fatalf("info = %+v", info)
+	}
+	if !info.SecurityOption("rootless") || !info.SecurityOption("seccomp") || info.SecurityOption("userns") {
+		t.Fatalf("security options = %v", info.SecurityOptions)
+	}
+}
+
+func TestParseDiskUsage(t *testing.T) {
+	docker := []byte(`{"Images":[],"Containers":[{"Names":"claudex-api","Size":"12.5MB (virtual 3.2GB)"}],"Volumes":[{"Name":"claudex-ws-abc","Size":"1.2GB"},{"Name":"other","Size":"N/A"}]}`)
+	got, err := parseDiskUsage(docker)
+	if err != nil || got.Containers["claudex-api"] != 12500000 || got.Volumes["claudex-ws-abc"] != 1200000000 || got.Volumes["other"] != 0 {
+		t.Fatalf("docker df: %+v %v", got, err)
+	}
+	podman := []byte(`{"Containers":[{"Name":"claudex-web","Size":2048}],"Volumes":[{"VolumeName":"v","Size":4096}]}`)
+	if got, err := parseDiskUsage(podman); err != nil || got.Containers["claudex-web"] != 2048 || got.Volumes["v"] != 4096 {
+		t.Fatalf("podman df: %+v %v", got, err)
+	}
+}
@@ -0,0 +1,200 @@
+package dockerx
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PluginPrefix names executables on PATH that are picked up as engines. A
+// plugin must accept docker-compatible arguments; `claudex-engine-foo` becomes
+// the engine "foo".
+const PluginPrefix = "claudex-engine-"
+
+// Engine describes a container backend that can satisfy the Docker interface.
+// The built-in engines drive a docker-compatible CLI, except docker-api which
+// talks to the Docker Engine API (see API). More can be added with Register,
+// or shipped as a plugin.
+type Engine struct {
+	Name        string
+	Description string
+	// Available reports whether the backend can be used on this host.
+	Available func() bool
+	// New constructs the backend.
+	New func() Docker
+}
+
+var (
+	registry      = map[string]Engine{}
+	defaultEngine string
+)
+
+func init() {
+	for _, e := range []struct{ name, bin, desc string }{
+		{"docker", "docker", "Docker CLI"},
+		{"podman", "podman", "Podman CLI (docker-compatible)"},
+		{"nerdctl", "nerdctl", "containerd nerdctl CLI"},
+	} {
+		Register(cliEngine(e.name, e.bin, e.desc))
+	}
+	Register(Engine{
+		Name:        "docker-api",
+		Description: "Docker Engine API at DOCKER_HOST (run, exec and build via the docker CLI)",
+		Available:   apiAvailable,
+		New:         func() Docker { return NewAPI(apiHost()) },
+	})
+}
+
+func cliEngine(name, bin, desc string) Engine {
+	return Engine{
+		Name:        name,
+		Description: desc,
+		Available:   func() bool { return onPATH.has(bin) },
+		New:         func() Docker { return &CLI{Binary: bin} },
+	}
+}
+
+// Register adds or replaces an engine in the registry.
+func Register(e Engine) { registry[e.Name] = e }
+
+// pathCache remembers what was found on PATH, so New, Lookup and Engines do
+// not read every PATH dir each time. It is refreshed when PATH changes.
+type pathCache struct {
+	mu      sync.Mutex
+	path    string
+	done    bool
+	plugins []Engine
+	found   map[string]bool
+}
+
+var onPATH pathCache
+
+// refresh rescans when PATH changed since the last scan; c.mu must be held.
+func (c *pathCache) refresh() {
+	if p := os.Getenv("PATH"); !c.done || c.path != p {
+		c.path, c.done = p, true
+		c.plugins = discoverPlugins()
+		c.found = map[string]bool{}
+	}
+}
+
+func (c *pathCache) pluginEngines() []Engine {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refresh()
+	return c.plugins
+}
+
+// has reports whether bin is on PATH.
+func (c *pathCache) has(bin string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refresh()
+	ok, seen := c.found[bin]
+	if !seen {
+		_, err := exec.LookPath(bin)
+		ok = err == nil
+		c.found[bin] = ok
+	}
+	return ok
+}
+
+// Engines returns registered engines plus PATH plugins, sorted by name.
+func Engines() []Engine {
+	all := map[string]Engine{}
+	for _, e := range onPATH.pluginEngines() {
+		all[e.Name] = e
+	}
+	for n, e := range registry {
+		all[n] = e
+	}
+	res := make([]Engine, 0, len(all))
+	for _, e := range all {
+		res = append(res, e)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+// Lookup finds an engine by name.
+func Lookup(name string) (Engine, bool) {
+	for _, e := range Engines() {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	return Engine{}, false
+}
+
+// SetDefault selects the engine returned by New. An empty name restores auto-detection.
+func SetDefault(name string) error {
+	if name != "" {
+		if _, ok := Lookup(name); !ok {
+			return fmt.Errorf("unknown container engine %q (see `claudex engines`)", name)
+		}
+	}
+	defaultEngine = name
+	return nil
+}
+
+// DefaultName reports the engine New would use.
+func DefaultName() string {
+	if defaultEngine != "" {
+		return defaultEngine
+	}
+	if e, ok := registry["docker"]; ok && e.Available() {
+		return e.Name
+	}
+	for _, e := range Engines() {
+		if e.Available() {
+			return e.Name
+		}
+	}
+	return "docker"
+}
+
+// New returns the selected engine, auto-detecting the first available backend
+// (preferring docker) when none was configured. CLAUDEX_FAKE_DOCKER replaces
+// it with a fixture-driven Fake.
+func New() Docker {
+	if f, ok := fixtureFromEnv(); ok {
+		return f
+	}
+	if e, ok := Lookup(DefaultName()); ok {
+		return e.New()
+	}
+	return &CLI{}
+}
+
+func discoverPlugins() []Engine {
+	var res []Engine
+	seen := map[string]bool{}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, ent := range entries {
+			if ent.IsDir() || !strings.HasPrefix(ent.Name(), PluginPrefix) {
+				continue
+			}
+			name := strings.TrimSuffix(strings.TrimPrefix(ent.Name(), PluginPrefix), ".exe")
+			if name == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+			path := filepath.Join(dir, ent.Name())
+			res = append(res, Engine{
+				Name:        name,
+				Description: "plugin " + path,
+				Available:   func() bool { return true },
+				New:         func() Docker { return &CLI{Binary: path} },
+			})
+		}
+	}
+	return res
+}
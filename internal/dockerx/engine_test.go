@@ -0,0 +1,82 @@
+package dockerx
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestEnginesIncludesBuiltinsAndPlugins(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugin discovery test uses a shell script")
+	}
+	dir := t.TempDir()
+	plugin := filepath.Join(dir, PluginPrefix+"fake")
+	if err := os.WriteFile(plugin, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("write plugin: %v", err)
+	}
+	t.Setenv("PATH", dir)
+
+	names := map[string]bool{}
+	for _, e := range Engines() {
+		names[e.Name] = true
+	}
+	for _, want := range []string{"docker", "docker-api", "podman", "nerdctl", "fake"} {
+		if !names[want] {
+			t.Fatalf("expected engine %q in %v", want, names)
+		}
+	}
+	e, ok := Lookup("fake")
+	if !ok || !e.Available() {
+		t.Fatalf("expected plugin engine to be available")
+	}
+	if c, ok := e.New().(*CLI); !ok || c.Binary != plugin {
+		t.Fatalf("expected plugin CLI bound to %s, got %#v", plugin, e.New())
+	}
+}
+
+func TestPluginScanIsCachedPerPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugin discovery test uses a shell script")
+	}
+	dir := t.TempDir()
+	plugin := filepath.Join(dir, PluginPrefix+"cached")
+	if err := os.WriteFile(plugin, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("write plugin: %v", err)
+	}
+	t.Setenv("PATH", dir)
+	if _, ok := Lookup("cached"); !ok {
+		t.Fatalf("expected plugin engine")
+	}
+	os.Remove(plugin)
+	if _, ok := Lookup("cached"); !ok {
+		t.Fatalf("expected the PATH scan to be reused")
+	}
+	t.Setenv("PATH", t.TempDir())
+	if _, ok := Lookup("cached"); ok {
+		t.Fatalf("expected a rescan after PATH changed")
+	}
+}
+
+func TestSetDefault(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	defer SetDefault("")
+	if err := SetDefault("bogus"); err == nil {
+		t.Fatalf("expected unknown engine error")
+	}
+	if err := SetDefault("podman"); err != nil {
+		t.Fatalf("SetDefault: %v", err)
+	}
+	if got := DefaultName(); got != "podman" {
+		t.Fatalf("DefaultName = %q", got)
+	}
+	if c, ok := New().(*CLI); !ok || c.Binary != "podman" {
+		t.Fatalf("expected podman CLI, got %#v", New())
+	}
+	_ = SetDefault("")
+	// Nothing on PATH: falls back to docker.
+	if got := DefaultName(); got != "docker" {
+		t.Fatalf("fallback DefaultName = %q", got)
+	}
+}
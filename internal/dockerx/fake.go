@@ -1,36 +1,107 @@
 package dockerx
 
-import "io"
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
 
-// Fake is a simple in-memory Docker implementation for tests.
+var _ Docker = (*Fake)(nil)
+
+// Call is one recorded Fake method call.
+type Call struct {
+	Method string
+	Args   []string
+}
+
+// Fake is a simple in-memory Docker implementation for tests. It is safe for
+// concurrent use.
 type Fake struct {
+	// Calls records every method call in order.
+	Calls []Call
+	// ErrFunc, when set, sees each call before it runs; a non-nil result is
+	// returned instead of the scripted one. It must not call the Fake.
+	ErrFunc func(c Call) error
+	// Simulate makes run, create, rename, start, stop, restart and remove
+	// update Containers, so flows that create a container and then inspect it
+	// work end to end.
+	Simulate bool
+
+	mu                 sync.Mutex
 	Containers         map[string]Container
 	PSNames            []string
 	RunErr             error
+	RunCalls           [][]string
+	StreamErr          error
+	StreamCalls        [][]string
 	ExecErr            error
 	CPErr              error
+	CPCalls            [][2]string
 	StartErr           error
+	StartCalls         []string
+	RestartErr         error
+	RestartCalls       []string
+	StopErr            error
+	StopCalls          []string
 	RemoveErr          error
+	RemoveCalls        []string
 	BuildErr           error
 	BuildTag           string
 	BuildContext       string
 	BuildOpts          BuildOptions
+	BuildContextData   []byte
 	ImageExistsVal     bool
 	ImageExistsErr     error
 	ExecInteractiveErr error
-	ExecOutputOut      []byte
-	ExecOutputErr      error
-	LogsOut            []byte
-	LogsErr            error
-	ExecCalls          [][]string
-	ExecOutputCalls    [][]string
-	LogsCalls          []struct {
+	// ExecInteractiveFunc, when set, answers ExecInteractive instead of
+	// ExecInteractiveErr.
+	ExecInteractiveFunc func(name string, cmd []string, in io.Reader, out io.Writer) error
+	ExecOutputOut       []byte
+	ExecOutputErr       error
+	// ExecOutputFunc, when set, answers ExecOutput instead of ExecOutputOut/Err.
+	ExecOutputFunc  func(name string, cmd []string) ([]byte, error)
+	LogsOut         []byte
+	LogsErr         error
+	ExecCalls       [][]string
+	ExecOutputCalls [][]string
+	ExecStreamCalls [][]string
+	ExecStreamOut   string
+	ExecStreamErr   error
+	StatsOut        []Stats
+	StatsErr        error
+	TopOut          []Process
+	TopErr          error
+	// TopFunc, when set, answers Top instead of TopOut/TopErr.
+	TopFunc        func(name string) ([]Process, error)
+	ImageCreatedAt map[string]time.Time
+	// HistoryOut maps image refs to their layers.
+	HistoryOut map[string][]Layer
+	ImagesOut  []Image
+	ImagesErr  error
+	// ImageLabelsOut maps image refs to their labels.
+	ImageLabelsOut map[string]map[string]string
+	DiskUsageOut   DiskUsage
+	DiskUsageErr   error
+	InfoOut        EngineInfo
+	InfoErr        error
+	EventsOut      []Event
+	EventsErr      error
+	EventsOpts     []EventOptions
+	LogsCalls      []struct {
 		Name string
 		Tail int
 	}
 }
 
 func (f *Fake) Inspect(name string) (Container, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("Inspect", name); err != nil {
+		return Container{}, err
+	}
 	if c, ok := f.Containers[name]; ok {
 		return c, nil
 	}
@@ -38,42 +109,183 @@ func (f *Fake) Inspect(name string) (Container, error) {
 }
 
 func (f *Fake) PS(includeStopped bool) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("PS", fmt.Sprint(includeStopped)); err != nil {
+		return nil, err
+	}
 	if len(f.PSNames) > 0 {
 		return append([]string(nil), f.PSNames...), nil
 	}
 	names := make([]string, 0, len(f.Containers))
-	for n := range f.Containers {
-		names = append(names, n)
+	for n, c := range f.Containers {
+		if includeStopped || !f.Simulate || c.Status == "running" {
+			names = append(names, n)
+		}
 	}
 	return names, nil
 }
 
-func (f *Fake) Run(args ...string) error { return f.RunErr }
+func (f *Fake) Run(args ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.RunCalls = append(f.RunCalls, append([]string(nil), args...))
+	if err := f.record("Run", args...); err != nil {
+		return err
+	}
+	if f.RunErr == nil && f.Simulate {
+		f.simulateRun(args)
+	}
+	return f.RunErr
+}
+func (f *Fake) Stream(args ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("Stream", args...); err != nil {
+		return err
+	}
+	f.StreamCalls = append(f.StreamCalls, append([]string(nil), args...))
+	return f.StreamErr
+}
 func (f *Fake) Exec(args ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("Exec", args...); err != nil {
+		return err
+	}
 	call := append([]string(nil), args...)
 	f.ExecCalls = append(f.ExecCalls, call)
 	return f.ExecErr
 }
-func (f *Fake) CP(src, dst string) error             { return f.CPErr }
-func (f *Fake) Start(name string) error              { return f.StartErr }
-func (f *Fake) Remove(name string, force bool) error { return f.RemoveErr }
-func (f *Fake) ImageExists(tag string) (bool, error) { return f.ImageExistsVal, f.ImageExistsErr }
+func (f *Fake) CP(src, dst string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("CP", src, dst); err != nil {
+		return err
+	}
+	f.CPCalls = append(f.CPCalls, [2]string{src, dst})
+	return f.CPErr
+}
+func (f *Fake) Start(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("Start", name); err != nil {
+		return err
+	}
+	f.StartCalls = append(f.StartCalls, name)
+	if f.StartErr == nil {
+		f.setStatus(name, "running")
+	}
+	return f.StartErr
+}
+func (f *Fake) Stop(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("Stop", name); err != nil {
+		return err
+	}
+	f.StopCalls = append(f.StopCalls, name)
+	if f.StopErr == nil {
+		f.setStatus(name, "exited")
+	}
+	return f.StopErr
+}
+func (f *Fake) Restart(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("Restart", name); err != nil {
+		return err
+	}
+	f.RestartCalls = append(f.RestartCalls, name)
+	if f.RestartErr == nil {
+		f.setStatus(name, "running")
+	}
+	return f.RestartErr
+}
+func (f *Fake) Remove(name string, force bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("Remove", name, fmt.Sprint(force)); err != nil {
+		return err
+	}
+	f.RemoveCalls = append(f.RemoveCalls, name)
+	if f.RemoveErr == nil && f.Simulate {
+		if _, ok := f.Containers[name]; !ok {
+			return ErrNotFound(name)
+		}
+		delete(f.Containers, name)
+	}
+	return f.RemoveErr
+}
+func (f *Fake) ImageExists(tag string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("ImageExists", tag); err != nil {
+		return false, err
+	}
+	return f.ImageExistsVal, f.ImageExistsErr
+}
 func (f *Fake) Build(tag, contextDir string, opts BuildOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("Build", tag, contextDir); err != nil {
+		return err
+	}
 	f.BuildTag = tag
 	f.BuildContext = contextDir
 	f.BuildOpts = opts
+	if opts.Context != nil {
+		// Drain the stream like docker would so pipe writers don't block.
+		f.BuildContextData, _ = io.ReadAll(opts.Context)
+	}
 	return f.BuildErr
 }
-func (f *Fake) ExecInteractive(name string, cmd []string, in io.Reader, out, errOut io.Writer) error {
-	return f.ExecInteractiveErr
+func (f *Fake) ExecInteractive(name string, cmd []string, opts ExecOptions, in io.Reader, out, errOut io.Writer) error {
+	f.mu.Lock()
+	err := f.record("ExecInteractive", append(append(opts.args(), name), cmd...)...)
+	fn, ret := f.ExecInteractiveFunc, f.ExecInteractiveErr
+	f.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if fn != nil {
+		return fn(name, cmd, in, out)
+	}
+	return ret
+}
+func (f *Fake) ExecStream(args []string, out, errOut io.Writer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("ExecStream", args...); err != nil {
+		return err
+	}
+	f.ExecStreamCalls = append(f.ExecStreamCalls, append([]string(nil), args...))
+	io.WriteString(out, f.ExecStreamOut)
+	return f.ExecStreamErr
 }
+
 func (f *Fake) ExecOutput(name string, cmd []string) ([]byte, error) {
 	call := append([]string{name}, cmd...)
+	f.mu.Lock()
 	f.ExecOutputCalls = append(f.ExecOutputCalls, call)
-	return f.ExecOutputOut, f.ExecOutputErr
+	err := f.record("ExecOutput", call...)
+	fn, out, outErr := f.ExecOutputFunc, f.ExecOutputOut, f.ExecOutputErr
+	f.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if fn != nil {
+		return fn(name, cmd)
+	}
+	return out, outErr
 }
 
 func (f *Fake) Logs(name string, tail int) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("Logs", name, fmt.Sprint(tail)); err != nil {
+		return nil, err
+	}
 	f.LogsCalls = append(f.LogsCalls, struct {
 		Name string
 		Tail int
@@ -81,6 +293,201 @@ func (f *Fake) Logs(name string, tail int) ([]byte, error) {
 	return f.LogsOut, f.LogsErr
 }
 
+func (f *Fake) Events(opts EventOptions, fn func(Event) error) error {
+	f.mu.Lock()
+	f.EventsOpts = append(f.EventsOpts, opts)
+	err := f.record("Events", opts.Labels...)
+	events, eventsErr := append([]Event(nil), f.EventsOut...), f.EventsErr
+	f.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	for _, ev := range events {
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+	return eventsErr
+}
+
+func (f *Fake) Stats(names ...string) ([]Stats, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("Stats", names...); err != nil {
+		return nil, err
+	}
+	return f.StatsOut, f.StatsErr
+}
+
+func (f *Fake) Top(name string) ([]Process, error) {
+	f.mu.Lock()
+	err := f.record("Top", name)
+	fn, out, topErr := f.TopFunc, f.TopOut, f.TopErr
+	f.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if fn != nil {
+		return fn(name)
+	}
+	return out, topErr
+}
+
+func (f *Fake) ImageCreated(ref string) (time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("ImageCreated", ref); err != nil {
+		return time.Time{}, err
+	}
+	if t, ok := f.ImageCreatedAt[ref]; ok {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("no such image: %s", ref)
+}
+
+func (f *Fake) History(ref string) ([]Layer, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("History", ref); err != nil {
+		return nil, err
+	}
+	if l, ok := f.HistoryOut[ref]; ok {
+		return l, nil
+	}
+	return nil, fmt.Errorf("no such image: %s", ref)
+}
+
+func (f *Fake) Images(label string) ([]Image, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("Images", label); err != nil {
+		return nil, err
+	}
+	return f.ImagesOut, f.ImagesErr
+}
+
+func (f *Fake) ImageLabels(ref string) (map[string]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("ImageLabels", ref); err != nil {
+		return nil, err
+	}
+	if l, ok := f.ImageLabelsOut[ref]; ok {
+		return l, nil
+	}
+	return nil, fmt.Errorf("no such image: %s", ref)
+}
+
+func (f *Fake) DiskUsage() (DiskUsage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("DiskUsage"); err != nil {
+		return DiskUsage{}, err
+	}
+	return f.DiskUsageOut, f.DiskUsageErr
+}
+
+func (f *Fake) Info() (EngineInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("Info"); err != nil {
+		return EngineInfo{}, err
+	}
+	return f.InfoOut, f.InfoErr
+}
+
+// WithContext returns f itself: Fake calls never block, and sharing f keeps
+// every call recorded in one place.
+func (f *Fake) WithContext(ctx context.Context) Docker { return f }
+
+// CallsTo returns the recorded calls of method, in order.
+func (f *Fake) CallsTo(method string) []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var res []Call
+	for _, c := range f.Calls {
+		if c.Method == method {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// record logs a call and consults ErrFunc. Callers hold f.mu.
+func (f *Fake) record(method string, args ...string) error {
+	c := Call{Method: method, Args: append([]string(nil), args...)}
+	f.Calls = append(f.Calls, c)
+	if f.ErrFunc != nil {
+		return f.ErrFunc(c)
+	}
+	return nil
+}
+
+func (f *Fake) setStatus(name, status string) {
+	if c, ok := f.Containers[name]; ok && f.Simulate {
+		c.Status = status
+		f.Containers[name] = c
+	}
+}
+
+// simulateRun applies `docker run|create|rename` to Containers. Only --name
+// and --label are interpreted; the image is the first non-flag argument after
+// the options, assuming every other flag takes a value.
+func (f *Fake) simulateRun(args []string) {
+	if len(args) == 0 {
+		return
+	}
+	if f.Containers == nil {
+		f.Containers = map[string]Container{}
+	}
+	switch args[0] {
+	case "rename":
+		if len(args) == 3 {
+			if c, ok := f.Containers[args[1]]; ok {
+				delete(f.Containers, args[1])
+				c.Name = args[2]
+				f.Containers[args[2]] = c
+			}
+		}
+		return
+	case "run", "create":
+	default:
+		return
+	}
+	c := Container{Status: "created", Labels: map[string]string{}, CreatedAt: time.Now()}
+	if args[0] == "run" {
+		c.Status = "running"
+	}
+	for i := 1; i < len(args); i++ {
+		a := args[i]
+		if !strings.HasPrefix(a, "-") {
+			c.Image = a
+			break
+		}
+		switch a {
+		case "-d", "--rm", "-it", "-i", "-t", "--privileged", "--init":
+			continue
+		}
+		if i+1 >= len(args) || strings.Contains(a, "=") {
+			continue
+		}
+		v := args[i+1]
+		i++
+		switch a {
+		case "--name":
+			c.Name = v
+		case "--label":
+			k, val, _ := strings.Cut(v, "=")
+			c.Labels[k] = val
+		case "--security-opt":
+			c.SecurityOpt = append(c.SecurityOpt, v)
+		}
+	}
+	if c.Name != "" {
+		f.Containers[c.Name] = c
+	}
+}
+
 // ErrNotFound is a minimal error type to simulate missing container.
 type ErrNotFound string
 
@@ -0,0 +1,130 @@
+package dockerx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// FakeEnv names a fixture file; when set, New returns a Fake loaded from it
+// instead of talking to an engine, so CLI flows can be tested end to end.
+const FakeEnv = "CLAUDEX_FAKE_DOCKER"
+
+// Fixture describes a fake engine: its containers and scripted results.
+//
+//	{
+//	  "containers": [{"Name": "claudex-app-1a2b3c4d", "Status": "running",
+//	                  "Labels": {"com.claudex.signature": "1a2b3c4d"}}],
+//	  "imageExists": true,
+//	  "results": [{"method": "ExecOutput", "args": ["claudex-app-1a2b3c4d", "git"],
+//	               "output": "clean\n"}]
+//	}
+type Fixture struct {
+	Containers  []Container     `json:"containers"`
+	ImageExists bool            `json:"imageExists"`
+	Results     []FixtureResult `json:"results"`
+}
+
+// FixtureResult answers calls to Method whose arguments start with Args.
+// Error fails the call; Output is what ExecOutput returns. The first matching
+// result wins.
+type FixtureResult struct {
+	Method string   `json:"method"`
+	Args   []string `json:"args"`
+	Output string   `json:"output"`
+	Error  string   `json:"error"`
+}
+
+func (r FixtureResult) matches(method string, args []string) bool {
+	if r.Method != method || len(args) < len(r.Args) {
+		return false
+	}
+	for i, a := range r.Args {
+		if args[i] != a {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	fixtureMu    sync.Mutex
+	fixtureFakes = map[string]*Fake{}
+)
+
+// FixtureFake returns the Fake for the fixture at path, loading it on first
+// use; later calls share its state, as calls to one engine would.
+func FixtureFake(path string) (*Fake, error) {
+	fixtureMu.Lock()
+	defer fixtureMu.Unlock()
+	if f, ok := fixtureFakes[path]; ok {
+		return f, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", FakeEnv, err)
+	}
+	var fx Fixture
+	if err := json.Unmarshal(data, &fx); err != nil {
+		return nil, fmt.Errorf("%s: parse %s: %w", FakeEnv, path, err)
+	}
+	f := fx.Fake()
+	fixtureFakes[path] = f
+	return f, nil
+}
+
+// ResetFixtures drops loaded fixture Fakes so the next FixtureFake call
+// reads the file again.
+func ResetFixtures() {
+	fixtureMu.Lock()
+	defer fixtureMu.Unlock()
+	fixtureFakes = map[string]*Fake{}
+}
+
+// Fake builds a simulating Fake with fx's containers and results.
+func (fx Fixture) Fake() *Fake {
+	f := &Fake{Simulate: true, ImageExistsVal: fx.ImageExists, Containers: map[string]Container{}}
+	for _, c := range fx.Containers {
+		if c.Labels == nil {
+			c.Labels = map[string]string{}
+		}
+		f.Containers[c.Name] = c
+	}
+	lookup := func(method string, args []string) (FixtureResult, bool) {
+		for _, r := range fx.Results {
+			if r.matches(method, args) {
+				return r, true
+			}
+		}
+		return FixtureResult{}, false
+	}
+	f.ErrFunc = func(c Call) error {
+		if r, ok := lookup(c.Method, c.Args); ok && r.Error != "" {
+			return errors.New(r.Error)
+		}
+		return nil
+	}
+	f.ExecOutputFunc = func(name string, cmd []string) ([]byte, error) {
+		r, _ := lookup("ExecOutput", append([]string{name}, cmd...))
+		return []byte(r.Output), nil
+	}
+	return f
+}
+
+// fixtureFromEnv returns the fixture Fake named by FakeEnv, if any. A broken
+// fixture yields a Fake that fails every call rather than a real engine,
+// which the test must not touch.
+func fixtureFromEnv() (Docker, bool) {
+	path := strings.TrimSpace(os.Getenv(FakeEnv))
+	if path == "" {
+		return nil, false
+	}
+	f, err := FixtureFake(path)
+	if err != nil {
+		return &Fake{ErrFunc: func(Call) error { return err }}, true
+	}
+	return f, true
+}
@@ -0,0 +1,172 @@
+package dockerx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Backoff is an exponential retry schedule: Initial, then Initial*Factor,
+// and so on up to Max between tries.
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+	// Factor grows the delay after each try; below 1 means 2.
+	Factor float64
+	// Attempts caps the number of tries, counting the first; 0 means no cap.
+	Attempts int
+	// Timeout caps the total time spent; 0 means no cap. Attempts or
+	// Timeout must be set.
+	Timeout time.Duration
+}
+
+// DefaultRetry is how CLI engines retry transient failures unless their
+// Retry field is set.
+var DefaultRetry = Backoff{Initial: 250 * time.Millisecond, Max: 2 * time.Second, Attempts: 4}
+
+// Delay returns the pause after the n-th failed try (n from 1).
+func (b Backoff) Delay(n int) time.Duration {
+	f := b.Factor
+	if f < 1 {
+		f = 2
+	}
+	d := float64(b.Initial)
+	for i := 1; i < n; i++ {
+		d *= f
+		if b.Max > 0 && d >= float64(b.Max) {
+			return b.Max
+		}
+	}
+	if b.Max > 0 && time.Duration(d) > b.Max {
+		return b.Max
+	}
+	return time.Duration(d)
+}
+
+// Retry calls fn until it succeeds, fails with an error retryable rejects,
+// or the schedule or ctx runs out. It returns the number of tries and fn's
+// last error.
+func (b Backoff) Retry(ctx context.Context, fn func() error, retryable func(error) bool) (int, error) {
+	var deadline time.Time
+	if b.Timeout > 0 {
+		deadline = time.Now().Add(b.Timeout)
+	}
+	for n := 1; ; n++ {
+		err := fn()
+		if err == nil || !retryable(err) || (b.Attempts > 0 && n >= b.Attempts) {
+			return n, err
+		}
+		d := b.Delay(n)
+		if !deadline.IsZero() {
+			left := time.Until(deadline)
+			if left <= 0 {
+				return n, err
+			}
+			if d > left {
+				d = left
+			}
+		}
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return n, err
+		case <-t.C:
+		}
+	}
+}
+
+// transientMarkers are docker error texts for conditions that clear up on
+// their own, keyed by the subcommand they apply to ("" for any).
+var transientMarkers = map[string][]string{
+	// Only the engine's own wording: exec output can mention anything.
+	"": {
+		"Cannot connect to the Docker daemon",
+		"Cannot connect to Podman",
+		"error during connect",
+	},
+	// The name of a container removed a moment ago can linger.
+	"run":    {"is already in use by container", "removal of container", "is already in progress"},
+	"create": {"is already in use by container", "removal of container", "is already in progress"},
+	"rename": {"is already in use by container"},
+	"cp":     {"device or resource busy", "EBUSY"},
+}
+
+// Transient reports whether err from `docker ARGS...` is worth retrying.
+func Transient(args []string, err error) bool {
+	if err == nil || len(args) == 0 || errors.Is(err, ErrTimeout) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	msg := err.Error()
+	for _, key := range []string{"", args[0]} {
+		for _, m := range transientMarkers[key] {
+			if strings.Contains(msg, m) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// outputError keeps a failed command's output with its error so transient
+// failures can be recognized.
+type outputError struct {
+	err    error
+	output string
+}
+
+func (e *outputError) Error() string {
+	if e.output == "" {
+		return e.err.Error()
+	}
+	return e.err.Error() + ": " + e.output
+}
+
+func (e *outputError) Unwrap() error { return e.err }
+
+func withOutput(err error, out []byte) error {
+	if err == nil {
+		return nil
+	}
+	return &outputError{err: err, output: strings.TrimSpace(string(out))}
+}
+
+func (c CLI) retry() Backoff {
+	if c.Retry.Attempts > 0 || c.Retry.Timeout > 0 {
+		return c.Retry
+	}
+	return DefaultRetry
+}
+
+// retryError is the final error of a call that was tried more than once.
+type retryError struct {
+	err   error
+	tries int
+}
+
+func (e *retryError) Error() string {
+	return fmt.Sprintf("%v (gave up after %d tries)", e.err, e.tries)
+}
+
+func (e *retryError) Unwrap() error { return e.err }
+
+func gaveUp(err error, tries int) error {
+	if err == nil || tries <= 1 {
+		return err
+	}
+	return &retryError{err: err, tries: tries}
+}
+
+// withoutOutput drops the output withOutput attached, for callers that
+// print it themselves.
+func withoutOutput(err error) error {
+	switch e := err.(type) {
+	case *outputError:
+		return e.err
+	case *retryError:
+		return &retryError{err: withoutOutput(e.err), tries: e.tries}
+	}
+	return err
+}
@@ -0,0 +1,61 @@
+package dockerx
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	b := Backoff{Initial: 100 * time.Millisecond, Max: time.Second, Attempts: 10}
+	var got []time.Duration
+	for n := 1; n <= 5; n++ {
+		got = append(got, b.Delay(n))
+	}
+	want := []time.Duration{100, 200, 400, 800, 1000}
+	for i := range want {
+		if got[i] != want[i]*time.Millisecond {
+			t.Fatalf("delays = %v", got)
+		}
+	}
+}
+
+func TestCLIRetriesTransientFailures(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as the engine")
+	}
+	dir := t.TempDir()
+	count := filepath.Join(dir, "count")
+	engine := filepath.Join(dir, "docker")
+	// Fails twice as if the daemon were restarting, then succeeds; `rm`
+	// always fails for good.
+	script := `#!/bin/sh
+if [ "$1" = rm ]; then echo "Error: No such container: $3" >&2; exit 1; fi
+n=$(cat "` + count + `" 2>/dev/null || echo 0); n=$((n+1)); echo $n > "` + count + `"
+if [ $n -le 2 ]; then echo "Cannot connect to the Docker daemon at unix:///var/run/docker.sock" >&2; exit 1; fi
+`
+	if err := os.WriteFile(engine, []byte(script), 0755); err != nil {
+		t.Fatalf("write engine: %v", err)
+	}
+	c := CLI{Binary: engine, Retry: Backoff{Initial: time.Millisecond, Attempts: 4}}
+	if err := c.Start("x"); err != nil {
+		t.Fatalf("start should succeed on the third try: %v", err)
+	}
+	if b, _ := os.ReadFile(count); strings.TrimSpace(string(b)) != "3" {
+		t.Fatalf("tries = %s", b)
+	}
+
+	err := c.Remove("x", true)
+	if err == nil || !strings.Contains(err.Error(), "No such container: x") || strings.Contains(err.Error(), "gave up") {
+		t.Fatalf("permanent failure should fail once with docker's message: %v", err)
+	}
+
+	_ = os.WriteFile(count, []byte("-10"), 0644)
+	err = c.Start("x")
+	if err == nil || !strings.Contains(err.Error(), "gave up after 4 tries") {
+		t.Fatalf("final error = %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package dockerx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// ErrTimeout is wrapped by errors from engine calls that ran past their
+// timeout, which usually means the daemon is hung or unreachable.
+var ErrTimeout = errors.New("timed out")
+
+// Timeouts bound engine calls so a hung daemon cannot freeze claudex. Zero
+// disables a bound. Interactive sessions, streams, builds and event watches
+// are never timed out, only canceled.
+type Timeouts struct {
+	// Query bounds quick reads: inspect, ps, images, logs, stats and top.
+	Query time.Duration
+	// Change bounds calls that change or run things in containers: run,
+	// start, stop, rm, cp and exec.
+	Change time.Duration
+}
+
+// DefaultTimeouts are used until SetTimeouts is called.
+var DefaultTimeouts = Timeouts{Query: 30 * time.Second, Change: 10 * time.Minute}
+
+var (
+	limitsMu sync.Mutex
+	timeouts = DefaultTimeouts
+	baseCtx  = context.Background()
+)
+
+// SetTimeouts replaces the timeouts of engines that do not set their own.
+func SetTimeouts(t Timeouts) {
+	limitsMu.Lock()
+	defer limitsMu.Unlock()
+	timeouts = t
+}
+
+// SetContext sets the context New binds engines to; the CLI cancels it on
+// Ctrl-C so in-flight calls stop instead of outliving the command.
+func SetContext(ctx context.Context) {
+	limitsMu.Lock()
+	defer limitsMu.Unlock()
+	baseCtx = ctx
+}
+
+// Context returns the context set by SetContext, for waits that should end
+// with the command as well.
+func Context() context.Context {
+	ctx, _ := currentLimits()
+	return ctx
+}
+
+func currentLimits() (context.Context, Timeouts) {
+	limitsMu.Lock()
+	defer limitsMu.Unlock()
+	return baseCtx, timeouts
+}
+
+// ParseTimeout reads a duration such as "30s"; "0" and "off" disable the
+// bound.
+func ParseTimeout(s string) (time.Duration, error) {
+	switch s {
+	case "0", "off", "none":
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid timeout %q (want e.g. 30s or 2m, or off)", s)
+	}
+	return d, nil
+}
+
+// opKind picks which timeout bounds a CLI call.
+type opKind int
+
+const (
+	opQuery opKind = iota
+	opChange
+	opUnbounded
+)
+
+func (c CLI) context() context.Context {
+	if c.Ctx != nil {
+		return c.Ctx
+	}
+	ctx, _ := currentLimits()
+	return ctx
+}
+
+func (c CLI) timeout(kind opKind) time.Duration {
+	_, t := currentLimits()
+	if c.Timeouts.Query > 0 {
+		t.Query = c.Timeouts.Query
+	}
+	if c.Timeouts.Change > 0 {
+		t.Change = c.Timeouts.Change
+	}
+	switch kind {
+	case opQuery:
+		return t.Query
+	case opChange:
+		return t.Change
+	}
+	return 0
+}
+
+// call runs `docker ARGS...` through run, bounded by kind's timeout and
+// canceled with the engine's context. A deadline surfaces as ErrTimeout and a
+// cancellation as context.Canceled. Bounded calls that fail transiently are
+// retried on the engine's Backoff.
+func (c CLI) call(kind opKind, args []string, run func(cmd *exec.Cmd) error) error {
+	if kind == opUnbounded {
+		return c.try(kind, args, run)
+	}
+	tries, err := c.retry().Retry(c.context(), func() error {
+		return c.try(kind, args, run)
+	}, func(err error) bool { return Transient(args, err) })
+	return gaveUp(err, tries)
+}
+
+// try makes a single attempt of call.
+func (c CLI) try(kind opKind, args []string, run func(cmd *exec.Cmd) error) error {
+	ctx := c.context()
+	d := c.timeout(kind)
+	cancel := func() {}
+	if d > 0 {
+		ctx, cancel = context.WithTimeout(ctx, d)
+	}
+	defer cancel()
+	cmd := exec.CommandContext(ctx, c.bin(), args...)
+	if len(c.Env) > 0 {
+		cmd.Env = append(os.Environ(), c.Env...)
+	}
+	err := run(cmd)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		if d > 0 {
+			return fmt.Errorf("%s %s %w after %s; is the daemon responding? (raise dockerTimeouts in config)", c.bin(), args[0], ErrTimeout, d)
+		}
+		return fmt.Errorf("%s %s %w", c.bin(), args[0], ErrTimeout)
+	case errors.Is(ctx.Err(), context.Canceled):
+		return fmt.Errorf("%s %s: %w", c.bin(), args[0], context.Canceled)
+	}
+	return err
+}
+
+// WithContext returns a copy of c whose calls are canceled with ctx.
+func (c CLI) WithContext(ctx context.Context) Docker {
+	c.Ctx = ctx
+	return &c
+}
@@ -0,0 +1,51 @@
+package dockerx
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCLITimesOutAndCancels(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as the engine")
+	}
+	hung := filepath.Join(t.TempDir(), "docker")
+	if err := os.WriteFile(hung, []byte("#!/bin/sh\nexec sleep 30\n"), 0755); err != nil {
+		t.Fatalf("write engine: %v", err)
+	}
+	c := CLI{Binary: hung, Timeouts: Timeouts{Query: 100 * time.Millisecond}}
+	start := time.Now()
+	if _, err := c.Inspect("x"); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("inspect err = %v, want ErrTimeout", err)
+	}
+	if _, err := c.PS(false); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("ps err = %v, want ErrTimeout", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	dx := c.WithContext(ctx)
+	if err := dx.ExecInteractive("x", []string{"bash"}, ExecOptions{}, nil, nil, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("exec err = %v, want context.Canceled", err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Fatalf("calls took %s; hung engine was not killed", d)
+	}
+}
+
+func TestParseTimeout(t *testing.T) {
+	if d, err := ParseTimeout("45s"); err != nil || d != 45*time.Second {
+		t.Fatalf("45s = %v, %v", d, err)
+	}
+	if d, err := ParseTimeout("off"); err != nil || d != 0 {
+		t.Fatalf("off = %v, %v", d, err)
+	}
+	if _, err := ParseTimeout("-1s"); err == nil {
+		t.Fatalf("negative timeout accepted")
+	}
+}
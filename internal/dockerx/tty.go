@@ -0,0 +1,65 @@
+package dockerx
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// interactiveGrace is how long an interactive exec has to exit after being
+// sent SIGTERM before it is killed.
+const interactiveGrace = 5 * time.Second
+
+// isTerminal reports whether v is a file open on a terminal.
+func isTerminal(v any) bool {
+	f, ok := v.(*os.File)
+	if !ok || f == nil {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// ttyFlags asks for a pseudo-terminal only when both ends of the session are
+// one. The engine CLI then owns the terminal itself: it puts it in raw mode,
+// sends the initial size and follows SIGWINCH, so full-screen programs see
+// resizes. Piped input gets -i alone, which the engine would otherwise refuse
+// with "the input device is not a TTY".
+func ttyFlags(in io.Reader, out io.Writer) []string {
+	if isTerminal(in) && isTerminal(out) {
+		return []string{"-i", "-t"}
+	}
+	return []string{"-i"}
+}
+
+// saveTerminal records the terminal settings of in and returns a func that
+// puts them back, so an engine CLI that dies while the terminal is in raw
+// mode does not leave it unusable. It is a no-op where stty is unavailable.
+func saveTerminal(in io.Reader) func() {
+	f, ok := in.(*os.File)
+	if !ok {
+		return func() {}
+	}
+	cmd := exec.Command("stty", "-g")
+	cmd.Stdin = f
+	saved, err := cmd.Output()
+	if err != nil {
+		return func() {}
+	}
+	return func() {
+		cmd := exec.Command("stty", strings.TrimSpace(string(saved)))
+		cmd.Stdin = f
+		_ = cmd.Run()
+	}
+}
+
+// terminateGently makes a canceled interactive exec get SIGTERM rather than
+// SIGKILL, giving the engine CLI the chance to detach and restore the
+// terminal; it is killed if still running after interactiveGrace.
+func terminateGently(cmd *exec.Cmd) {
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	cmd.WaitDelay = interactiveGrace
+}
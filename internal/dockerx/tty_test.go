@@ -0,0 +1,43 @@
+package dockerx
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecInteractiveWithoutTerminal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as the engine")
+	}
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	engine := filepath.Join(dir, "docker")
+	script := "#!/bin/sh\necho \"$@\" > " + log + "\ntrap 'echo term >> " + log + "; exit 143' TERM\nwhile :; do sleep 0.05; done\n"
+	if err := os.WriteFile(engine, []byte(script), 0755); err != nil {
+		t.Fatalf("write engine: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(300*time.Millisecond, cancel)
+	dx := CLI{Binary: engine}.WithContext(ctx)
+	start := time.Now()
+	_ = dx.ExecInteractive("c", []string{"bash"}, ExecOptions{Workdir: "/workspace"}, strings.NewReader(""), nil, nil)
+	if d := time.Since(start); d >= interactiveGrace {
+		t.Fatalf("exec took %s; SIGTERM was not delivered", d)
+	}
+	got, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(got)), "\n")
+	if lines[0] != "exec -i -w /workspace c bash" {
+		t.Fatalf("args = %q, want no -t for piped input", lines[0])
+	}
+	if len(lines) < 2 || lines[1] != "term" {
+		t.Fatalf("engine log = %q, want SIGTERM on cancel", got)
+	}
+}
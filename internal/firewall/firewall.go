@@ -0,0 +1,154 @@
+package firewall
+
+import (
+	"bufio"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxDepth bounds how far below each mounted dir Scan looks for manifests.
+const maxDepth = 3
+
+// skipDirs are never descended into while scanning.
+var skipDirs = map[string]bool{".git": true, "node_modules": true, "vendor": true, "target": true, ".venv": true, "venv": true, "__pycache__": true}
+
+// defaultHosts maps manifest and lock file names to the public registries they need.
+var defaultHosts = map[string][]string{
+	"package.json":        {"registry.npmjs.org"},
+	"package-lock.json":   {"registry.npmjs.org"},
+	"npm-shrinkwrap.json": {"registry.npmjs.org"},
+	"yarn.lock":           {"registry.yarnpkg.com", "registry.npmjs.org"},
+	"pnpm-lock.yaml":      {"registry.npmjs.org"},
+	"go.mod":              {"proxy.golang.org", "sum.golang.org"},
+	"requirements.txt":    {"pypi.org", "files.pythonhosted.org"},
+	"pyproject.toml":      {"pypi.org", "files.pythonhosted.org"},
+	"Pipfile":             {"pypi.org", "files.pythonhosted.org"},
+	"poetry.lock":         {"pypi.org", "files.pythonhosted.org"},
+	"setup.py":            {"pypi.org", "files.pythonhosted.org"},
+	"Cargo.toml":          {"crates.io", "index.crates.io", "static.crates.io"},
+	"Gemfile":             {"rubygems.org"},
+}
+
+// Files whose URLs name registries (.npmrc, pip.conf, lockfiles).
+var urlFiles = map[string]bool{
+	".npmrc": true, ".yarnrc": true, ".yarnrc.yml": true, "pip.conf": true, "pip.ini": true,
+	"package-lock.json": true, "yarn.lock": true, "pnpm-lock.yaml": true, "poetry.lock": true, "Pipfile": true,
+	"requirements.txt": true,
+}
+
+var (
+	urlRe  = regexp.MustCompile(`https?://[^\s"'<>,;]+`)
+	hostRe = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?)+$`)
+)
+
+// known holds every registry in defaultHosts. Only these are allowed
+// automatically: the project files are writable by the agent, so a host named
+// in them must not open the firewall by itself.
+var known = func() map[string]bool {
+	m := map[string]bool{}
+	for _, hs := range defaultHosts {
+		for _, h := range hs {
+			m[h] = true
+		}
+	}
+	return m
+}()
+
+// Scan walks the mounted project dirs and returns the sorted public registry
+// hosts their package manifests, lockfiles and registry configs need, and,
+// separately, the other hosts their registry configs and lockfiles name.
+// Those are only reported; allow them with "claudex firewall allow".
+func Scan(dirs []string) (hosts, unlisted []string) {
+	found, other := map[string]bool{}, map[string]bool{}
+	for _, root := range dirs {
+		_ = filepath.WalkDir(root, func(p string, e fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if e.IsDir() {
+				if p != root && (skipDirs[e.Name()] || depth(root, p) > maxDepth) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			name := e.Name()
+			if strings.HasPrefix(name, "requirements") && strings.HasSuffix(name, ".txt") {
+				name = "requirements.txt"
+			}
+			for _, h := range defaultHosts[name] {
+				found[h] = true
+			}
+			if urlFiles[name] {
+				for _, h := range urlHosts(p) {
+					if known[h] {
+						found[h] = true
+					} else {
+						other[h] = true
+					}
+				}
+			}
+			return nil
+		})
+	}
+	return sorted(found), sorted(other)
+}
+
+func sorted(set map[string]bool) []string {
+	res := make([]string, 0, len(set))
+	for h := range set {
+		res = append(res, h)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func depth(root, p string) int {
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return 0
+	}
+	return len(strings.Split(rel, string(filepath.Separator)))
+}
+
+// urlHosts returns the hosts of every http(s) URL mentioned in file.
+func urlHosts(file string) []string {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	seen := map[string]bool{}
+	var res []string
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		for _, raw := range urlRe.FindAllString(sc.Text(), -1) {
+			u, err := url.Parse(raw)
+			if err != nil {
+				continue
+			}
+			h := strings.ToLower(u.Hostname())
+			if !ValidHost(h) || seen[h] {
+				continue
+			}
+			seen[h] = true
+			res = append(res, h)
+		}
+	}
+	return res
+}
+
+// ValidPattern reports whether p is a host or a "*.domain" wildcard rule.
+func ValidPattern(p string) bool {
+	return ValidHost(strings.TrimPrefix(p, "*."))
+}
+
+// ValidHost reports whether h is a plain DNS name safe to pass to init-firewall.sh.
+func ValidHost(h string) bool {
+	return hostRe.MatchString(h)
+}
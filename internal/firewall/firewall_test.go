@@ -0,0 +1,49 @@
+package firewall
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScanFindsRegistries(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"web/package.json":              "{}",
+		"web/.npmrc":                    "@corp:registry=https://npm.corp.example.com/repo/\n",
+		"api/go.mod":                    "module x\n",
+		"ml/requirements-dev.txt":       "--extra-index-url https://pypi.corp.example.com/simple\nnumpy\n",
+		"web/node_modules/x/Cargo.toml": "",
+		"a/b/c/d/Gemfile":               "",
+		"web/yarn.lock":                 "  resolved \"https://registry.yarnpkg.com/x/-/x-1.0.0.tgz\"\n  resolved \"https://evil.example.net/x.tgz\"\n",
+	}
+	for rel, body := range files {
+		p := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hosts, unlisted := Scan([]string{root})
+	got := strings.Join(hosts, ",")
+	want := "files.pythonhosted.org,proxy.golang.org,pypi.org,registry.npmjs.org,registry.yarnpkg.com,sum.golang.org"
+	if got != want {
+		t.Fatalf("Scan = %s\nwant  %s", got, want)
+	}
+	got = strings.Join(unlisted, ",")
+	want = "evil.example.net,npm.corp.example.com,pypi.corp.example.com"
+	if got != want {
+		t.Fatalf("Scan unlisted = %s\nwant           %s", got, want)
+	}
+}
+
+func TestValidHost(t *testing.T) {
+	for h, want := range map[string]bool{"pypi.org": true, "a-b.c.io": true, "localhost": false, "evil.com;rm": false, "-x.com": false} {
+		if ValidHost(h) != want {
+			t.Errorf("ValidHost(%q) = %v", h, !want)
+		}
+	}
+}
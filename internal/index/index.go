@@ -0,0 +1,67 @@
+// Package index holds the in-container script behind `claudex index` and
+// --index. The index is a list of the files under /workspace (rg --files,
+// so .gitignore is honored) and, when universal-ctags is installed, a tags
+// file, letting agents search a big monorepo without walking it. The
+// supervisor reports its freshness in `claudex status`.
+package index
+
+import "time"
+
+// Dir holds the index in the container, outside /workspace so it never
+// reaches the host.
+const Dir = "/home/node/.cache/claudex/index"
+
+// The index files: Files lists paths relative to /workspace, one per line;
+// Tags is a ctags file with absolute paths; Meta describes the last build.
+const (
+	Files = Dir + "/files"
+	Tags  = Dir + "/tags"
+	Meta  = Dir + "/meta.json"
+)
+
+// Info is Meta, plus Stale when the supervisor reports it: whether anything
+// under /workspace changed after the build started.
+type Info struct {
+	// Built is the Unix time the build started.
+	Built int64 `json:"built"`
+	// Seconds is how long the build took.
+	Seconds int64 `json:"seconds"`
+	Files   int   `json:"files"`
+	Tags    bool  `json:"tags"`
+	Stale   bool  `json:"stale"`
+}
+
+// Age is how long ago the index was built.
+func (i Info) Age(now time.Time) time.Duration {
+	return now.Sub(time.Unix(i.Built, 0))
+}
+
+// script rebuilds the index into a scratch dir and moves it into place, so
+// readers never see a partial one, then prints Meta. A build already in
+// progress makes it fail rather than queue.
+const script = `set -e
+mkdir -p ` + Dir + `
+exec 9>` + Dir + `/.lock
+flock -n 9 || { echo "an index build is already running" >&2; exit 1; }
+tmp=$(mktemp -d ` + Dir + `/.build.XXXXXX)
+trap 'rm -rf "$tmp"' EXIT
+start=$(date +%s)
+cd /workspace
+rg --files --hidden -g '!.git' 2>/dev/null | LC_ALL=C sort >"$tmp/files"
+tags=false
+if ctags --version 2>/dev/null | grep -q Universal; then
+  sed 's|^|/workspace/|' "$tmp/files" | ctags -f "$tmp/tags" -L - 2>/dev/null && tags=true
+fi
+jq -nc --argjson built "$start" --argjson seconds $(($(date +%s) - start)) \
+  --argjson files "$(wc -l <"$tmp/files")" --argjson tags $tags \
+  '{built: $built, seconds: $seconds, files: $files, tags: $tags}' >"$tmp/meta.json"
+touch -d "@$start" "$tmp/meta.json"
+if [ $tags = true ]; then mv -f "$tmp/tags" ` + Tags + `; else rm -f ` + Tags + `; fi
+mv -f "$tmp/files" ` + Files + `
+mv -f "$tmp/meta.json" ` + Meta + `
+cat ` + Meta
+
+// Command returns the command that rebuilds the index.
+func Command() []string {
+	return []string{"bash", "-c", script, "claudex-index"}
+}
@@ -0,0 +1,111 @@
+// Package jsonlog turns the CLI's human-readable output into line-delimited
+// JSON events for --log-json. Rather than threading a logger through every
+// command, it swaps os.Stdout and os.Stderr for pipes and wraps each line
+// written to them.
+package jsonlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types.
+const (
+	TypeProgress = "progress" // a stdout line
+	TypeWarning  = "warning"  // a stderr line starting with "Warning:"
+	TypeLog      = "log"      // any other stderr line
+	TypeError    = "error"    // the command failed
+	TypeResult   = "result"   // always last
+)
+
+// Event is one JSON line.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Stream  string    `json:"stream,omitempty"`
+	Message string    `json:"message,omitempty"`
+	OK      *bool     `json:"ok,omitempty"`
+}
+
+// Capture redirects os.Stdout and os.Stderr until Finish.
+type Capture struct {
+	mu      sync.Mutex
+	enc     *json.Encoder
+	stdout  *os.File
+	stderr  *os.File
+	writers []*os.File
+	wg      sync.WaitGroup
+	now     func() time.Time
+}
+
+// Start begins capturing; events are written to w (normally the real stdout).
+func Start(w io.Writer) (*Capture, error) {
+	c := &Capture{enc: json.NewEncoder(w), stdout: os.Stdout, stderr: os.Stderr, now: time.Now}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	errR, errW, err := os.Pipe()
+	if err != nil {
+		outR.Close()
+		outW.Close()
+		return nil, err
+	}
+	c.writers = []*os.File{outW, errW}
+	c.wg.Add(2)
+	go c.pump(outR, "stdout")
+	go c.pump(errR, "stderr")
+	os.Stdout, os.Stderr = outW, errW
+	return c, nil
+}
+
+func (c *Capture) pump(r *os.File, stream string) {
+	defer c.wg.Done()
+	defer r.Close()
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		typ := TypeProgress
+		if stream == "stderr" {
+			typ = TypeLog
+			if strings.HasPrefix(line, "Warning:") {
+				typ = TypeWarning
+			}
+		}
+		c.Emit(Event{Type: typ, Stream: stream, Message: line})
+	}
+}
+
+// Emit writes ev, stamping the time when unset.
+func (c *Capture) Emit(ev Event) {
+	if ev.Time.IsZero() {
+		ev.Time = c.now()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_ = c.enc.Encode(ev)
+}
+
+// Finish restores os.Stdout and os.Stderr, flushes buffered lines, and emits
+// an error event (when err != nil) followed by the result event.
+func (c *Capture) Finish(err error) {
+	os.Stdout, os.Stderr = c.stdout, c.stderr
+	for _, w := range c.writers {
+		w.Close()
+	}
+	c.wg.Wait()
+	if err != nil {
+		c.Emit(Event{Type: TypeError, Message: err.Error()})
+	}
+	ok := err == nil
+	c.Emit(Event{Type: TypeResult, OK: &ok})
+}
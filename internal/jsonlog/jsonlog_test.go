@@ -0,0 +1,49 @@
+package jsonlog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestCaptureWrapsOutput(t *testing.T) {
+	var buf bytes.Buffer
+	c, err := Start(&buf)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	fmt.Println("Creating container x...")
+	fmt.Fprintln(os.Stderr, "Warning: mounts differ")
+	fmt.Fprintln(os.Stderr, "docker said something")
+	c.Finish(errors.New("boom"))
+
+	var types, msgs []string
+	var last Event
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var ev Event
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			t.Fatalf("bad line %q: %v", sc.Text(), err)
+		}
+		if ev.Time.IsZero() {
+			t.Fatalf("missing time: %q", sc.Text())
+		}
+		types = append(types, ev.Type)
+		msgs = append(msgs, ev.Message)
+		last = ev
+	}
+	if len(types) != 5 || types[3] != TypeError || msgs[3] != "boom" || last.Type != TypeResult || last.OK == nil || *last.OK {
+		t.Fatalf("events = %v %v", types, msgs)
+	}
+	got := map[string]string{}
+	for i := 0; i < 3; i++ {
+		got[msgs[i]] = types[i]
+	}
+	if got["Creating container x..."] != TypeProgress || got["Warning: mounts differ"] != TypeWarning || got["docker said something"] != TypeLog {
+		t.Fatalf("classification = %v", got)
+	}
+}
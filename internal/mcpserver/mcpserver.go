@@ -0,0 +1,177 @@
+// Package mcpserver serves tools over the Model Context Protocol's stdio
+// transport: newline-delimited JSON-RPC 2.0 on stdin and stdout. It covers
+// what a tools-only server needs (initialize, ping, tools/list, tools/call);
+// the tools themselves are supplied by the caller.
+package mcpserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ProtocolVersion is the newest MCP revision this server speaks. Clients
+// asking for another revision it knows get that one back.
+const ProtocolVersion = "2025-06-18"
+
+var knownVersions = map[string]bool{"2024-11-05": true, "2025-03-26": true, ProtocolVersion: true}
+
+// JSON-RPC error codes.
+const (
+	codeParse          = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+// Tool is one operation offered to the client. InputSchema is the JSON
+// Schema of its arguments. Call returns text for the client; an error is
+// reported to it, after any text, as a failed tool call rather than a
+// protocol error, so the model sees it.
+type Tool struct {
+	Name        string
+	Description string
+	InputSchema map[string]any
+	Call        func(args json.RawMessage) (string, error)
+}
+
+// Server answers requests for a fixed set of tools.
+type Server struct {
+	Name    string
+	Version string
+	Tools   []Tool
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Serve handles requests from in until it is closed, writing responses to
+// out. Requests are answered one at a time, in order.
+func (s *Server) Serve(in io.Reader, out io.Writer) error {
+	r := bufio.NewReader(in)
+	enc := json.NewEncoder(out)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			if resp := s.handle(line); resp != nil {
+				if err := enc.Encode(resp); err != nil {
+					return err
+				}
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// handle returns the response to one message, or nil for notifications and
+// blank lines.
+func (s *Server) handle(line []byte) *response {
+	if len(bytes.TrimSpace(line)) == 0 {
+		return nil
+	}
+	var req request
+	if err := json.Unmarshal(line, &req); err != nil {
+		return &response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{codeParse, "parse error: " + err.Error()}}
+	}
+	if len(req.ID) == 0 {
+		// A notification, such as notifications/initialized: no reply.
+		return nil
+	}
+	resp := &response{JSONRPC: "2.0", ID: req.ID}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		resp.Error = &rpcError{codeInvalidRequest, "invalid request"}
+		return resp
+	}
+	result, rerr := s.dispatch(req)
+	if rerr != nil {
+		resp.Error = rerr
+	} else {
+		resp.Result = result
+	}
+	return resp
+}
+
+func (s *Server) dispatch(req request) (any, *rpcError) {
+	switch req.Method {
+	case "initialize":
+		var p struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(req.Params, &p)
+		version := ProtocolVersion
+		if knownVersions[p.ProtocolVersion] {
+			version = p.ProtocolVersion
+		}
+		return map[string]any{
+			"protocolVersion": version,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": s.Name, "version": s.Version},
+		}, nil
+	case "ping":
+		return map[string]any{}, nil
+	case "tools/list":
+		tools := make([]map[string]any, 0, len(s.Tools))
+		for _, t := range s.Tools {
+			schema := t.InputSchema
+			if schema == nil {
+				schema = map[string]any{"type": "object"}
+			}
+			tools = append(tools, map[string]any{"name": t.Name, "description": t.Description, "inputSchema": schema})
+		}
+		return map[string]any{"tools": tools}, nil
+	case "tools/call":
+		var p struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &p); err != nil {
+			return nil, &rpcError{codeInvalidParams, "invalid params: " + err.Error()}
+		}
+		for _, t := range s.Tools {
+			if t.Name != p.Name {
+				continue
+			}
+			args := p.Arguments
+			if len(args) == 0 || string(args) == "null" {
+				args = json.RawMessage("{}")
+			}
+			text, err := t.Call(args)
+			isError := err != nil
+			if isError && text != "" {
+				text += "\n" + err.Error()
+			} else if isError {
+				text = err.Error()
+			}
+			return map[string]any{
+				"content": []map[string]any{{"type": "text", "text": text}},
+				"isError": isError,
+			}, nil
+		}
+		return nil, &rpcError{codeInvalidParams, fmt.Sprintf("unknown tool: %s", p.Name)}
+	}
+	return nil, &rpcError{codeMethodNotFound, "method not found: " + req.Method}
+}
@@ -0,0 +1,50 @@
+package mcpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestServeAnswersRequestsInOrder(t *testing.T) {
+	s := &Server{Name: "claudex", Version: "1.0", Tools: []Tool{
+		{Name: "echo", Call: func(args json.RawMessage) (string, error) { return string(args), nil }},
+		{Name: "fail", Call: func(json.RawMessage) (string, error) { return "partial", errors.New("boom") }},
+	}}
+	in := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05"}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		``,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"echo","arguments":{"x":1}}}`,
+		`{"jsonrpc":"2.0","id":"4","method":"tools/call","params":{"name":"fail"}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"nope"}}`,
+		`{"jsonrpc":"2.0","id":6,"method":"resources/list"}`,
+		`not json`,
+		`{"jsonrpc":"2.0","id":7,"method":"ping"}`,
+	}, "\n")
+	var out strings.Builder
+	if err := s.Serve(strings.NewReader(in), &out); err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	want := []string{
+		`{"jsonrpc":"2.0","id":1,"result":{"capabilities":{"tools":{}},"protocolVersion":"2024-11-05","serverInfo":{"name":"claudex","version":"1.0"}}}`,
+		`{"jsonrpc":"2.0","id":2,"result":{"tools":[{"description":"","inputSchema":{"type":"object"},"name":"echo"},{"description":"","inputSchema":{"type":"object"},"name":"fail"}]}}`,
+		`{"jsonrpc":"2.0","id":3,"result":{"content":[{"text":"{\"x\":1}","type":"text"}],"isError":false}}`,
+		`{"jsonrpc":"2.0","id":"4","result":{"content":[{"text":"partial\nboom","type":"text"}],"isError":true}}`,
+		`{"jsonrpc":"2.0","id":5,"error":{"code":-32602,"message":"unknown tool: nope"}}`,
+		`{"jsonrpc":"2.0","id":6,"error":{"code":-32601,"message":"method not found: resources/list"}}`,
+		`{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"parse error: invalid character 'o' in literal null (expecting 'u')"}}`,
+		`{"jsonrpc":"2.0","id":7,"result":{}}`,
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d responses, want %d:\n%s", len(lines), len(want), out.String())
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("response %d:\n got %s\nwant %s", i, lines[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Package notify posts lifecycle messages (container create/destroy, batch
+// completion, gc) to a generic webhook and/or Slack, as configured under the
+// "notifications" config key. Delivery is best effort: callers warn on error
+// and carry on.
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/output"
+)
+
+// Event kinds.
+const (
+	Create  = "create"
+	Destroy = "destroy"
+	Batch   = "batch"
+	GC      = "gc"
+)
+
+// SlackAPI is Slack's chat.postMessage endpoint, used with Slack.Token.
+var SlackAPI = "https://slack.com/api/chat.postMessage"
+
+// Config is the "notifications" config key.
+type Config struct {
+	// Webhook receives every event as a JSON POST.
+	Webhook string `yaml:"webhook"`
+	Slack   Slack  `yaml:"slack"`
+	// Events limits which kinds are sent (create, destroy, batch, gc); empty
+	// sends all.
+	Events []string `yaml:"events"`
+}
+
+// Slack posts events as messages, either through an incoming webhook or a
+// bot token and channel. The token may reference an environment variable
+// ("${SLACK_BOT_TOKEN}") so it stays out of the file; other values are used
+// as written.
+type Slack struct {
+	Webhook string `yaml:"webhook"`
+	Token   string `yaml:"token"`
+	Channel string `yaml:"channel"`
+}
+
+// Enabled reports whether any destination is configured.
+func (c Config) Enabled() bool {
+	return c.Webhook != "" || c.Slack.Webhook != "" || (c.Slack.Token != "" && c.Slack.Channel != "")
+}
+
+// Wants reports whether events of kind should be sent.
+func (c Config) Wants(kind string) bool {
+	if !c.Enabled() {
+		return false
+	}
+	if len(c.Events) == 0 {
+		return true
+	}
+	for _, k := range c.Events {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is one notification; it is also the generic webhook's JSON body.
+type Event struct {
+	Kind      string            `json:"event"`
+	Container string            `json:"container,omitempty"`
+	Message   string            `json:"message"`
+	Time      time.Time         `json:"time"`
+	Fields    map[string]string `json:"fields,omitempty"`
+}
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// Send delivers ev to every configured destination, returning the first
+// error after trying all of them.
+func Send(c Config, ev Event) error {
+	if !c.Wants(ev.Kind) {
+		return nil
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	var first error
+	keep := func(err error) {
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	if c.Webhook != "" {
+		keep(post(c.Webhook, "", ev))
+	}
+	text := "claudex: " + ev.Message
+	if c.Slack.Webhook != "" {
+		keep(post(c.Slack.Webhook, "", map[string]string{"text": text}))
+	}
+	if c.Slack.Token != "" && c.Slack.Channel != "" {
+		keep(post(SlackAPI, os.ExpandEnv(c.Slack.Token), map[string]string{"channel": c.Slack.Channel, "text": text}))
+	}
+	return first
+}
+
+// Emit sends ev and prints a warning to errOut when delivery fails.
+func Emit(c Config, ev Event, errOut io.Writer) {
+	if err := Send(c, ev); err != nil {
+		output.Warnf(errOut, "notification failed: %v\n", err)
+	}
+}
+
+func post(url, token string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", req.URL.Host, resp.Status)
+	}
+	if token == "" {
+		return nil
+	}
+	// The Slack Web API reports failures in a 200 response.
+	var res struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err == nil && !res.OK {
+		return fmt.Errorf("slack: %s", res.Error)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSendWebhookAndSlack(t *testing.T) {
+	var hook Event
+	var slack map[string]string
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/hook":
+			json.NewDecoder(r.Body).Decode(&hook)
+		case "/slack":
+			auth = r.Header.Get("Authorization")
+			json.NewDecoder(r.Body).Decode(&slack)
+			w.Write([]byte(`{"ok":true}`))
+		}
+	}))
+	defer srv.Close()
+	old := SlackAPI
+	SlackAPI = srv.URL + "/slack"
+	defer func() { SlackAPI = old }()
+	t.Setenv("TEST_SLACK_TOKEN", "xoxb-1")
+	t.Setenv("TEST_SLACK_CHANNEL", "#leak")
+
+	c := Config{Webhook: srv.URL + "/hook", Slack: Slack{Token: "${TEST_SLACK_TOKEN}", Channel: "#dev"}, Events: []string{Create}}
+	if err := Send(c, Event{Kind: Destroy, Message: "skipped"}); err != nil || hook.Kind != "" {
+		t.Fatalf("filtered event was sent: %v %+v", err, hook)
+	}
+	if err := Send(c, Event{Kind: Create, Container: "c", Message: "created c"}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if hook.Kind != Create || hook.Container != "c" || hook.Time.IsZero() {
+		t.Fatalf("webhook body = %+v", hook)
+	}
+	if auth != "Bearer xoxb-1" || slack["channel"] != "#dev" || slack["text"] != "claudex: created c" {
+		t.Fatalf("slack auth=%q body=%v", auth, slack)
+	}
+	// Only the token is expanded.
+	c.Slack.Channel = "${TEST_SLACK_CHANNEL}"
+	if err := Send(c, Event{Kind: Create, Message: "m"}); err != nil || slack["channel"] != "${TEST_SLACK_CHANNEL}" {
+		t.Fatalf("channel expanded: %v %v", err, slack)
+	}
+}
+
+func TestSendReportsSlackAPIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":false,"error":"channel_not_found"}`))
+	}))
+	defer srv.Close()
+	old := SlackAPI
+	SlackAPI = srv.URL
+	defer func() { SlackAPI = old }()
+	err := Send(Config{Slack: Slack{Token: "t", Channel: "#x"}}, Event{Kind: GC, Message: "m"})
+	if err == nil || err.Error() != "slack: channel_not_found" {
+		t.Fatalf("err = %v", err)
+	}
+}
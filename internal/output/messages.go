@@ -0,0 +1,117 @@
+package output
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Msg keys the message catalog. The English text is the fallback for any
+// locale that lacks a key.
+type Msg string
+
+// Messages shared by prompts and the lines around them. Exit codes and
+// machine-readable output stay the same in every locale.
+const (
+	MsgWarning           Msg = "warning"
+	MsgError             Msg = "error"
+	MsgProceed           Msg = "proceed"
+	MsgAborted           Msg = "aborted"
+	MsgYes               Msg = "yes"
+	MsgRecreateUnhealthy Msg = "recreate-unhealthy"
+	MsgMigrateProceed    Msg = "migrate-proceed"
+	MsgAboutToRemove     Msg = "about-to-remove"
+	MsgSelectDestroy     Msg = "select-destroy"
+	MsgSelection         Msg = "selection"
+	MsgAttaching         Msg = "attaching"
+	MsgDetached          Msg = "detached"
+)
+
+// catalogs maps a language to its messages. MsgYes lists the answers that
+// confirm a prompt, comma-separated; "y" and "yes" work in every locale.
+var catalogs = map[string]map[Msg]string{
+	"en": {
+		MsgWarning:           "Warning:",
+		MsgError:             "error:",
+		MsgProceed:           "Proceed? [y/N] ",
+		MsgAborted:           "Aborted.",
+		MsgYes:               "y,yes",
+		MsgRecreateUnhealthy: "Container %s is still unhealthy. Recreate it? [y/N] ",
+		MsgMigrateProceed:    "Each container is committed and recreated. Proceed? [y/N] ",
+		MsgAboutToRemove:     "About to remove %d container(s):",
+		MsgSelectDestroy:     "Select containers to destroy (comma-separated numbers):",
+		MsgSelection:         "Enter selection (blank to abort): ",
+		MsgAttaching:         "Attaching shell. Type 'exit' to leave.",
+		MsgDetached:          "Detached from %s; the container is still running.",
+	},
+	"es": {
+		MsgWarning:           "Aviso:",
+		MsgError:             "error:",
+		MsgProceed:           "¿Continuar? [s/N] ",
+		MsgAborted:           "Cancelado.",
+		MsgYes:               "s,si,sí",
+		MsgRecreateUnhealthy: "El contenedor %s sigue sin estar sano. ¿Recrearlo? [s/N] ",
+		MsgMigrateProceed:    "Cada contenedor se guarda con commit y se vuelve a crear. ¿Continuar? [s/N] ",
+		MsgAboutToRemove:     "Se van a eliminar %d contenedor(es):",
+		MsgSelectDestroy:     "Elige los contenedores a eliminar (números separados por comas):",
+		MsgSelection:         "Selección (en blanco para cancelar): ",
+		MsgAttaching:         "Abriendo una shell. Escribe 'exit' para salir.",
+		MsgDetached:          "Desconectado de %s; el contenedor sigue en ejecución.",
+	},
+}
+
+var locale = detectLocale()
+
+// detectLocale reads CLAUDEX_LANG, then the usual LC_ALL, LC_MESSAGES and
+// LANG, falling back to English.
+func detectLocale() string {
+	for _, k := range []string{"CLAUDEX_LANG", "LC_ALL", "LC_MESSAGES", "LANG"} {
+		if v := os.Getenv(k); v != "" {
+			return language(v)
+		}
+	}
+	return "en"
+}
+
+// language turns "es_ES.UTF-8" into "es"; C, POSIX and unknown languages
+// are English.
+func language(v string) string {
+	lang := strings.ToLower(v)
+	if i := strings.IndexAny(lang, "_.@-"); i >= 0 {
+		lang = lang[:i]
+	}
+	if _, ok := catalogs[lang]; !ok {
+		return "en"
+	}
+	return lang
+}
+
+// SetLocale selects the catalog for the rest of the process; unknown
+// locales mean English.
+func SetLocale(v string) { locale = language(v) }
+
+// Locale is the language messages are printed in.
+func Locale() string { return locale }
+
+// T formats the message for key in the current locale.
+func T(key Msg, a ...any) string {
+	s, ok := catalogs[locale][key]
+	if !ok {
+		s = catalogs["en"][key]
+	}
+	if len(a) == 0 {
+		return s
+	}
+	return fmt.Sprintf(s, a...)
+}
+
+// Yes reports whether ans confirms a [y/N] prompt.
+func Yes(ans string) bool {
+	ans = strings.TrimSpace(ans)
+	for _, w := range strings.Split(catalogs["en"][MsgYes]+","+T(MsgYes), ",") {
+		if w != "" && strings.EqualFold(ans, w) {
+			return true
+		}
+	}
+	return false
+}
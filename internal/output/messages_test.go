@@ -0,0 +1,51 @@
+package output
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestLocaleSelection(t *testing.T) {
+	defer SetLocale(Locale())
+	for in, want := range map[string]string{"es_ES.UTF-8": "es", "ES": "es", "C": "en", "fr_FR": "en", "en_GB": "en"} {
+		if got := language(in); got != want {
+			t.Errorf("language(%q) = %q, want %q", in, got, want)
+		}
+	}
+	t.Setenv("CLAUDEX_LANG", "")
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LC_MESSAGES", "es_MX.UTF-8")
+	t.Setenv("LANG", "en_US.UTF-8")
+	if got := detectLocale(); got != "es" {
+		t.Fatalf("detectLocale = %q, want LC_MESSAGES to win over LANG", got)
+	}
+
+	SetLocale("es")
+	if got := T(MsgAboutToRemove, 2); got != "Se van a eliminar 2 contenedor(es):" {
+		t.Fatalf("T = %q", got)
+	}
+	if !Yes("sí\n") || !Yes("Y") || Yes("n") || Yes("") {
+		t.Fatalf("Yes does not accept the locale's answers and English ones only")
+	}
+	SetLocale("en")
+	if Yes("s") {
+		t.Fatalf("English prompts accepted a Spanish answer")
+	}
+}
+
+// Every translation must take the same arguments as the English text.
+func TestCatalogsMatchEnglish(t *testing.T) {
+	verbs := regexp.MustCompile(`%[a-z]`)
+	for lang, msgs := range catalogs {
+		for key, en := range catalogs["en"] {
+			s, ok := msgs[key]
+			if !ok {
+				t.Errorf("%s: missing %s", lang, key)
+				continue
+			}
+			if a, b := verbs.FindAllString(en, -1), verbs.FindAllString(s, -1); len(a) != len(b) {
+				t.Errorf("%s: %s takes %v, English %v", lang, key, b, a)
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Package output holds what claudex's human-facing output shares: whether to
+// use color (--color auto|always|never), the handful of styles it uses, the
+// message catalog for prompts (messages.go), and the warning and prompt
+// helpers built on them. Machine-readable output (--json, --format,
+// --log-json) never goes through here.
+package output
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Color modes accepted by --color and CLAUDEX_COLOR.
+const (
+	Auto   = "auto"
+	Always = "always"
+	Never  = "never"
+)
+
+var mode = Auto
+
+// SetColor sets the color mode for the rest of the process.
+func SetColor(m string) error {
+	switch m {
+	case Auto, Always, Never:
+		mode = m
+		return nil
+	}
+	return fmt.Errorf("invalid color mode %q (want auto, always or never)", m)
+}
+
+// Enabled reports whether text written to w should be colored. In auto mode
+// that means w is a terminal, NO_COLOR is unset and TERM is not "dumb".
+func Enabled(w io.Writer) bool {
+	switch mode {
+	case Always:
+		return true
+	case Never:
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	if !ok || f == nil {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Style is an ANSI SGR parameter.
+type Style string
+
+const (
+	Plain  Style = ""
+	Bold   Style = "1"
+	Dim    Style = "2"
+	Red    Style = "31"
+	Green  Style = "32"
+	Yellow Style = "33"
+)
+
+// Paint wraps text in style when w gets color. Pad table cells before
+// painting them; escape codes count toward fmt widths.
+func Paint(w io.Writer, style Style, text string) string {
+	if style == Plain || text == "" || !Enabled(w) {
+		return text
+	}
+	return "\x1b[" + string(style) + "m" + text + "\x1b[0m"
+}
+
+// StatusStyle is the color for a container, agent or server state: green
+// when it is up, red when it is down or broken, yellow in between.
+func StatusStyle(status string) Style {
+	s := strings.ToLower(strings.TrimSpace(status))
+	switch {
+	case s == "running" || s == "active" || s == "healthy" || strings.HasPrefix(s, "up"):
+		return Green
+	case s == "exited" || s == "dead" || s == "down" || s == "unhealthy" || s == "stalled" || s == "missing":
+		return Red
+	case s == "created" || s == "paused" || s == "restarting" || s == "starting" || s == "removing":
+		return Yellow
+	}
+	return Plain
+}
+
+// Status paints status, padded to width first, in its StatusStyle.
+func Status(w io.Writer, status string, width int) string {
+	return Paint(w, StatusStyle(status), fmt.Sprintf("%-*s", width, status))
+}
+
+// Warnf prints a "Warning: " line (in the current locale) to w; format
+// supplies its own newline.
+func Warnf(w io.Writer, format string, a ...any) {
+	fmt.Fprintf(w, "%s %s", Paint(w, Yellow, T(MsgWarning)), fmt.Sprintf(format, a...))
+}
+
+// Prompt prints a question awaiting an answer on stdin, such as
+// "Proceed? [y/N] ".
+func Prompt(w io.Writer, text string) {
+	fmt.Fprint(w, Paint(w, Bold, text))
+}
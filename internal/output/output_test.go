@@ -0,0 +1,48 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestColorModes(t *testing.T) {
+	defer SetColor(Auto)
+	if err := SetColor("sometimes"); err == nil {
+		t.Fatalf("expected an invalid mode to be rejected")
+	}
+	var buf bytes.Buffer
+	if got := Paint(&buf, Red, "x"); got != "x" {
+		t.Fatalf("auto mode colored a buffer: %q", got)
+	}
+	SetColor(Always)
+	if got := Paint(&buf, Red, "x"); got != "\x1b[31mx\x1b[0m" {
+		t.Fatalf("always = %q", got)
+	}
+	if got := Status(&buf, "exited", 8); got != "\x1b[31mexited  \x1b[0m" {
+		t.Fatalf("status = %q, want padding inside the color", got)
+	}
+	Warnf(&buf, "disk %s\n", "full")
+	if buf.String() != "\x1b[33mWarning:\x1b[0m disk full\n" {
+		t.Fatalf("warning = %q", buf.String())
+	}
+	SetColor(Never)
+	if got := Status(&buf, "running", 0); got != "running" {
+		t.Fatalf("never = %q", got)
+	}
+}
+
+func TestStatusStyle(t *testing.T) {
+	for status, want := range map[string]Style{
+		"running":       Green,
+		"Up 3 minutes":  Green,
+		"exited":        Red,
+		"down":          Red,
+		"created":       Yellow,
+		"paused":        Yellow,
+		"something-odd": Plain,
+	} {
+		if got := StatusStyle(status); got != want {
+			t.Errorf("StatusStyle(%q) = %q, want %q", status, got, want)
+		}
+	}
+}
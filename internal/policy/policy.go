@@ -0,0 +1,117 @@
+package policy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+)
+
+// DockerSocket is the host daemon socket a policy can forbid mounting.
+const DockerSocket = "/var/run/docker.sock"
+
+// NoNewPrivileges is the --security-opt that keeps sudo (and any other
+// setuid program) from gaining root in a container.
+const NoNewPrivileges = "no-new-privileges:true"
+
+// Policy restricts what claudex containers may do (config key "policy").
+// run.Run applies it when building docker run args; Check verifies an
+// existing container against it.
+type Policy struct {
+	// NoDockerSocket never mounts the host docker socket.
+	NoDockerSocket bool `yaml:"noDockerSocket"`
+	// ReadOnlyMounts mounts workspace dirs read-only.
+	ReadOnlyMounts bool `yaml:"readOnlyMounts"`
+	// RestrictEgress forces the firewall (no outbound except the allowlist)
+	// and forbids host networking.
+	RestrictEgress bool `yaml:"restrictEgress"`
+	// MaxMemory caps container memory, in docker syntax (e.g. "4g", "512m").
+	MaxMemory string `yaml:"maxMemory"`
+	// NoSudo runs containers with NoNewPrivileges, so nothing in them can
+	// become root through sudo.
+	NoSudo bool `yaml:"noSudo"`
+}
+
+// Enabled reports whether any restriction is set.
+func (p Policy) Enabled() bool {
+	return p.NoDockerSocket || p.ReadOnlyMounts || p.RestrictEgress || p.MaxMemory != "" || p.NoSudo
+}
+
+// MemoryBytes parses MaxMemory (0 when unset).
+func (p Policy) MemoryBytes() (int64, error) {
+	if p.MaxMemory == "" {
+		return 0, nil
+	}
+	return ParseMemory(p.MaxMemory)
+}
+
+// ParseMemory parses docker memory sizes: a number with an optional b, k, m or g suffix.
+func ParseMemory(s string) (int64, error) {
+	v := strings.ToLower(strings.TrimSpace(s))
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(v, "g"):
+		mult, v = 1<<30, strings.TrimSuffix(v, "g")
+	case strings.HasSuffix(v, "m"):
+		mult, v = 1<<20, strings.TrimSuffix(v, "m")
+	case strings.HasSuffix(v, "k"):
+		mult, v = 1<<10, strings.TrimSuffix(v, "k")
+	case strings.HasSuffix(v, "b"):
+		v = strings.TrimSuffix(v, "b")
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid memory size %q (want e.g. 512m or 4g)", s)
+	}
+	return n * mult, nil
+}
+
+// Check returns the static violations of p by c. Egress is verified at
+// runtime by the caller since it needs to probe from inside the container.
+func (p Policy) Check(c dockerx.Container) []string {
+	var v []string
+	for _, m := range c.Mounts {
+		if p.NoDockerSocket && m.Destination == DockerSocket {
+			v = append(v, "host docker socket is mounted")
+		}
+		if p.ReadOnlyMounts && m.RW && strings.HasPrefix(m.Destination, "/workspace/") {
+			v = append(v, fmt.Sprintf("workspace mount %s is writable", m.Destination))
+		}
+	}
+	if c.Privileged && (p.RestrictEgress || p.NoDockerSocket) {
+		// A privileged container can flush its firewall and reach the host.
+		v = append(v, "container is privileged (--nested-docker dind)")
+	}
+	if p.NoSudo && !SudoDisabled(c.SecurityOpt) {
+		v = append(v, "sudo is not disabled (no-new-privileges)")
+	}
+	if limit, err := p.MemoryBytes(); err == nil && limit > 0 && (c.Memory == 0 || c.Memory > limit) {
+		v = append(v, fmt.Sprintf("memory limit %s exceeds policy maxMemory %s", formatMemory(c.Memory), p.MaxMemory))
+	}
+	return v
+}
+
+// SudoDisabled reports whether a container's security options include
+// NoNewPrivileges.
+func SudoDisabled(securityOpt []string) bool {
+	return hasOption(securityOpt, NoNewPrivileges)
+}
+
+// hasOption reports whether opts has opt; "no-new-privileges" alone means
+// true as well.
+func hasOption(opts []string, opt string) bool {
+	for _, o := range opts {
+		if o == opt || o+":true" == opt {
+			return true
+		}
+	}
+	return false
+}
+
+func formatMemory(b int64) string {
+	if b == 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%dm", b>>20)
+}
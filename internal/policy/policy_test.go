@@ -0,0 +1,44 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+)
+
+func TestParseMemory(t *testing.T) {
+	cases := map[string]int64{"4g": 4 << 30, "512m": 512 << 20, "1024K": 1 << 20, "100": 100, "7b": 7}
+	for in, want := range cases {
+		if got, err := ParseMemory(in); err != nil || got != want {
+			t.Errorf("ParseMemory(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"", "g", "-1m", "lots"} {
+		if _, err := ParseMemory(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	p := Policy{NoDockerSocket: true, ReadOnlyMounts: true, MaxMemory: "1g", NoSudo: true}
+	c := dockerx.Container{
+		Privileged: true,
+		Mounts: []dockerx.Mount{
+			{Destination: DockerSocket, RW: true},
+			{Destination: "/workspace/app", RW: true},
+			{Destination: "/workspace/docs", RW: false},
+			{Destination: "/home/node/.claude", RW: true},
+		},
+	}
+	got := strings.Join(p.Check(c), "; ")
+	want := "host docker socket is mounted; workspace mount /workspace/app is writable; container is privileged (--nested-docker dind); sudo is not disabled (no-new-privileges); memory limit unlimited exceeds policy maxMemory 1g"
+	if got != want {
+		t.Fatalf("Check = %q\nwant %q", got, want)
+	}
+	c = dockerx.Container{Memory: 512 << 20, SecurityOpt: []string{"no-new-privileges"}}
+	if v := p.Check(c); len(v) != 0 {
+		t.Fatalf("compliant container reported %v", v)
+	}
+}
@@ -0,0 +1,203 @@
+// Package queue persists workspaces waiting for a headless agent run
+// (`claudex queue`).
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/state"
+)
+
+// Item statuses.
+const (
+	Pending = "pending"
+	Running = "running"
+	Done    = "done"
+	Failed  = "failed"
+)
+
+// Item is one queued agent run.
+type Item struct {
+	ID         int       `json:"id"`
+	Dirs       []string  `json:"dirs"`
+	Prompt     string    `json:"prompt"`
+	Agent      string    `json:"agent"`
+	Status     string    `json:"status"`
+	AddedAt    time.Time `json:"added_at"`
+	StartedAt  time.Time `json:"started_at,omitempty"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+	Container  string    `json:"container,omitempty"`
+	ExitCode   int       `json:"exit_code"`
+	Error      string    `json:"error,omitempty"`
+	// OutDir holds the run's prompt, output log, diff, and transcripts.
+	OutDir string `json:"out_dir,omitempty"`
+}
+
+// Store is the on-disk queue file.
+type Store struct {
+	Items  []*Item `json:"items"`
+	NextID int     `json:"next_id"`
+
+	path string
+}
+
+// Path returns the location of queue.json in the claudex data directory.
+func Path() (string, error) {
+	dir, err := state.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "queue.json"), nil
+}
+
+// LoadFrom reads the queue at path; a missing file yields an empty queue.
+func LoadFrom(path string) (*Store, error) {
+	s := &Store{NextID: 1, path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("cannot read queue %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("invalid queue %s: %w", path, err)
+	}
+	if s.NextID < 1 {
+		s.NextID = 1
+	}
+	return s, nil
+}
+
+// Save writes the queue atomically (temp file + rename).
+func (s *Store) Save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("cannot create queue dir: %w", err)
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), "queue-*.json")
+	if err != nil {
+		return fmt.Errorf("cannot write queue: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("cannot write queue: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("cannot write queue: %w", err)
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// Add appends a pending item and returns it with its ID assigned.
+func (s *Store) Add(it Item) *Item {
+	it.ID = s.NextID
+	s.NextID++
+	it.Status = Pending
+	s.Items = append(s.Items, &it)
+	return &it
+}
+
+// Get returns the item with id.
+func (s *Store) Get(id int) (*Item, bool) {
+	for _, it := range s.Items {
+		if it.ID == id {
+			return it, true
+		}
+	}
+	return nil, false
+}
+
+// Pending returns pending items in the order they were added.
+func (s *Store) Pending() []Item {
+	var res []Item
+	for _, it := range s.Items {
+		if it.Status == Pending {
+			res = append(res, *it)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res
+}
+
+// Requeue sets running items back to pending and returns them. Only the
+// runner holding LockRunner may call it: any item still running then was
+// left behind by a runner that exited.
+func (s *Store) Requeue() []Item {
+	var res []Item
+	for _, it := range s.Items {
+		if it.Status == Running {
+			it.Status = Pending
+			it.StartedAt = time.Time{}
+			res = append(res, *it)
+		}
+	}
+	return res
+}
+
+// LockRunner makes the caller the only `queue run` for the queue at path
+// until release is called or the process exits.
+func LockRunner(path string) (release func(), err error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("cannot create queue dir: %w", err)
+	}
+	f, err := os.OpenFile(path+".run.lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := state.TryLock(f)
+	if err != nil || !ok {
+		f.Close()
+		if err == nil {
+			err = fmt.Errorf("another claudex queue run is working through %s", path)
+		}
+		return nil, err
+	}
+	return func() { f.Close() }, nil
+}
+
+// Prune drops finished items (done or failed) and returns how many were removed.
+func (s *Store) Prune() int {
+	kept := s.Items[:0]
+	n := 0
+	for _, it := range s.Items {
+		if it.Status == Done || it.Status == Failed {
+			n++
+			continue
+		}
+		kept = append(kept, it)
+	}
+	s.Items = kept
+	return n
+}
+
+// Update loads the queue at path, applies fn, and saves it, holding a lock
+// file next to it so that changes from other claudex processes (a `queue
+// add` while `queue run` works) are not lost. Callers that run for a long
+// time use it for every change rather than holding a Store.
+func Update(path string, fn func(*Store) error) error {
+	l, err := state.LockFile(path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	s, err := LoadFrom(path)
+	if err != nil {
+		return err
+	}
+	if err := fn(s); err != nil {
+		return err
+	}
+	return s.Save()
+}
@@ -0,0 +1,68 @@
+package queue
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestAddUpdateAndPrune(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.json")
+	err := Update(path, func(s *Store) error {
+		s.Add(Item{Dirs: []string{"/a"}, Prompt: "p1"})
+		s.Add(Item{Dirs: []string{"/b"}, Prompt: "p2"})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	err = Update(path, func(s *Store) error {
+		it, ok := s.Get(1)
+		if !ok {
+			t.Fatalf("item 1 missing")
+		}
+		it.Status = Done
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	s, err := LoadFrom(path)
+	if err != nil {
+		t.Fatalf("LoadFrom: %v", err)
+	}
+	if p := s.Pending(); len(p) != 1 || p[0].ID != 2 || p[0].Prompt != "p2" {
+		t.Fatalf("Pending = %+v", p)
+	}
+	if n := s.Prune(); n != 1 || len(s.Items) != 1 {
+		t.Fatalf("Prune removed %d, left %+v", n, s.Items)
+	}
+	if it := s.Add(Item{}); it.ID != 3 {
+		t.Fatalf("IDs must not be reused, got %d", it.ID)
+	}
+}
+
+func TestLockRunnerAndRequeue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.json")
+	release, err := LockRunner(path)
+	if err != nil {
+		t.Fatalf("LockRunner: %v", err)
+	}
+	if _, err := LockRunner(path); err == nil {
+		t.Fatalf("a second runner took the lock")
+	}
+	release()
+	release, err = LockRunner(path)
+	if err != nil {
+		t.Fatalf("lock not released: %v", err)
+	}
+	defer release()
+
+	s := &Store{NextID: 1}
+	s.Add(Item{Prompt: "p1"})
+	s.Add(Item{Prompt: "p2"})
+	s.Items[1].Status = Running
+	got := s.Requeue()
+	if len(got) != 1 || got[0].ID != 2 || len(s.Pending()) != 2 {
+		t.Fatalf("Requeue = %+v, pending %+v", got, s.Pending())
+	}
+}
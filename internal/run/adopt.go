@@ -0,0 +1,70 @@
+package run
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/containers"
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/output"
+	"github.com/photodialectic/claudex/internal/state"
+	"github.com/photodialectic/claudex/internal/version"
+)
+
+// AdoptedLabel records the container an adopted one was recreated from.
+const AdoptedLabel = "com.claudex.adopted-from"
+
+// Adopt brings the container src under claudex management with dirs as its
+// workspace by recreating it with claudex labels. When as is empty the new
+// container takes src's name and replaces src; otherwise src is left alone.
+func Adopt(src string, dirs []string, as string, out, errOut io.Writer, dx dockerx.Docker) error {
+	info, err := dx.Inspect(src)
+	if err != nil {
+		return fmt.Errorf("container %s does not exist", src)
+	}
+	if containers.IsClaudex(&info) {
+		return fmt.Errorf("%s is already a claudex container", src)
+	}
+	o := Options{Workdirs: dirs}
+	if err := o.Derive(); err != nil {
+		return err
+	}
+	o.Name = src
+	if as != "" {
+		if _, err := dx.Inspect(as); err == nil {
+			return fmt.Errorf("container %s already exists; pick another name with --as", as)
+		}
+		o.Name = as
+	}
+	mounted := map[string]bool{}
+	for _, m := range info.Mounts {
+		mounted[m.Source] = true
+	}
+	for _, d := range o.Normalized {
+		if !mounted[d] {
+			output.Warnf(errOut, "%s is not mounted in %s\n", d, src)
+		}
+	}
+
+	b, _ := json.Marshal(o.Normalized)
+	labels := map[string]string{
+		"com.claudex.signature": o.Signature,
+		"com.claudex.version":   version.Version,
+		"com.claudex.slug":      o.Slug,
+		"com.claudex.mounts":    string(b),
+		containers.SchemaLabel:  strconv.Itoa(containers.Schema),
+		AdoptedLabel:            src,
+	}
+	if o.Owner != "" {
+		labels[OwnerLabel] = o.Owner
+	}
+	if err := recreate(info, o.Name, "claudex-adopted:"+o.Name, labels, out, errOut, dx); err != nil {
+		return fmt.Errorf("adopt failed: %w", err)
+	}
+	recordSession(state.Session{Name: o.Name, Signature: o.Signature, Slug: o.Slug, Mounts: o.Normalized, CreatedAt: time.Now()}, errOut)
+	fmt.Fprintf(out, "Adopted %s as %s (signature %s). Attach with: claudex attach %s\n", src, o.Name, o.Signature, o.Name)
+	return nil
+}
@@ -0,0 +1,144 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/index"
+	"github.com/photodialectic/claudex/internal/output"
+)
+
+// agentDocsScript replaces the sandbox section ($1) at the top of each
+// instruction file, keeping the rest (the image's CLAUDEX.md) intact.
+const agentDocsScript = `for f in CLAUDE.md AGENTS.md GEMINI.md; do
+  p=/workspace/$f; body=
+  [ -f "$p" ] && body=$(sed '/^<!-- claudex:sandbox -->$/,/^<!-- \/claudex:sandbox -->$/d' "$p" | sed '/./,$!d')
+  printf '%s\n\n%s\n' "$1" "$body" > "$p" && chown ` + homeOwner + ` "$p"
+done`
+
+var agentDocsTmpl = template.Must(template.New("sandbox").Parse(`<!-- claudex:sandbox -->
+## This Sandbox
+Written by claudex when container {{.Name}} was created, from the settings it was created with.
+
+- **Workspace**: {{.Workspace}}
+{{- range .Mounts}}
+  - ` + "`{{.Target}}`" + ` from ` + "`{{.Source}}`" + `{{if .ReadOnly}} (read-only){{end}}{{if .Git}}; {{.Git}}{{end}}
+{{- end}}
+- **Git**: {{.Git}}
+- **Network**: {{.Network}}
+- **Docker**: {{.Docker}}
+- **MCP servers**: {{.MCP}}
+{{- range .Extra}}
+- {{.}}
+{{- end}}
+<!-- /claudex:sandbox -->`))
+
+type agentDocsMount struct {
+	Source, Target, Git string
+	ReadOnly            bool
+}
+
+type agentDocsData struct {
+	Name, Workspace, Git, Network, Docker, MCP string
+	Mounts                                     []agentDocsMount
+	Extra                                      []string
+}
+
+// renderAgentDocs describes the sandbox o creates. slim reports a slim image,
+// which lacks the Google Docs MCP server; sudo whether the user has sudo.
+func (o Options) renderAgentDocs(slim, sudo bool) string {
+	d := agentDocsData{Name: o.Name}
+	switch {
+	case o.Cow:
+		d.Workspace = "private copies of the host directories; the host files are never modified."
+	case o.WorkspaceVolume:
+		d.Workspace = "a docker volume seeded from the host directories; changes reach the host only when the user runs `claudex sync --pull`."
+	default:
+		d.Workspace = "host directories mounted live; every change is immediately visible on the host."
+	}
+	for _, abs := range o.Normalized {
+		m := agentDocsMount{Source: abs, Target: "/workspace/" + filepath.Base(abs), ReadOnly: o.Policy.ReadOnlyMounts && !o.Cow && !o.WorkspaceVolume}
+		switch o.HostGitMounts[abs] {
+		case HostGitEmpty:
+			m.Git = "its .git is hidden"
+		case HostGitCopy:
+			m.Git = "its .git is a private copy taken at creation"
+		}
+		d.Mounts = append(d.Mounts, m)
+	}
+	d.Git = "`/workspace` is a local repository for tracking changes only. It has no remotes; do not commit, push or pull."
+	if o.SkipGit {
+		d.Git = "no repository is initialized in `/workspace`."
+	}
+	switch {
+	case o.UseHostNetwork:
+		d.Network = "host network; services listening on the host's localhost are reachable."
+	case len(o.PublishPorts) > 0:
+		d.Network = fmt.Sprintf("bridge network; port(s) %s are published on the host's localhost for OAuth callbacks, and host services are at host.docker.internal.", portsLabel(o.PublishPorts))
+	case o.Firewall && o.FirewallDeps:
+		d.Network = "outbound traffic is limited by a firewall to the agents' APIs and the package registries these projects use."
+	case o.Firewall:
+		d.Network = "outbound traffic is limited by a firewall to the agents' APIs; package installs from other hosts will fail."
+	default:
+		d.Network = "unrestricted outbound access."
+	}
+	docker := "`sudo docker`"
+	if !sudo {
+		docker = "`docker` (there is no sudo)"
+	}
+	switch o.NestedDocker {
+	case NestedSocket:
+		d.Docker = "the host's Docker socket is mounted; `sudo docker` controls the host daemon, so treat it as root on the host."
+	case NestedDind:
+		d.Docker = "a private Docker daemon runs in this (privileged) container; use " + docker + "."
+	case NestedSysbox:
+		d.Docker = "a private Docker daemon runs in this container under sysbox; use " + docker + "."
+	default:
+		d.Docker = "not available."
+	}
+	var mcp []string
+	if !slim {
+		mcp = append(mcp, "`google-docs-mcp` (start it with `google-docs-mcp`)")
+	}
+	if os.Getenv("GITHUB_MCP_PAT") != "" {
+		mcp = append(mcp, "a GitHub token for MCP servers in `$GITHUB_MCP_PAT`")
+	}
+	d.MCP = "none installed."
+	if len(mcp) > 0 {
+		d.MCP = strings.Join(mcp, "; ") + "."
+	}
+	if o.Audit {
+		d.Extra = append(d.Extra, "**Audit**: every command run through bash is logged.")
+	}
+	if o.AutoCommit > 0 {
+		d.Extra = append(d.Extra, fmt.Sprintf("**Checkpoints**: changed files are checkpointed every %s.", o.AutoCommit))
+	}
+	if o.Index {
+		d.Extra = append(d.Extra, "**File index**: `"+index.Files+"` lists the workspace files (relative to `/workspace`, .gitignore honored) and `"+index.Tags+"` holds ctags symbols; search them before walking large trees. `claudex status` on the host tells whether they are stale.")
+	}
+	if !o.Expires.IsZero() {
+		d.Extra = append(d.Extra, fmt.Sprintf("**Time limit**: this container stops at %s; save your work before then.", o.Expires.UTC().Format(time.RFC3339)))
+	}
+	if o.Policy.MaxMemory != "" {
+		d.Extra = append(d.Extra, fmt.Sprintf("**Memory**: limited to %s.", o.Policy.MaxMemory))
+	}
+	var b strings.Builder
+	_ = agentDocsTmpl.Execute(&b, d)
+	return b.String()
+}
+
+// writeAgentDocs puts the sandbox description at the top of the instruction
+// files in /workspace.
+func (o Options) writeAgentDocs(dx dockerx.Docker, errOut io.Writer) {
+	labels, _ := dx.ImageLabels(o.image())
+	doc := o.renderAgentDocs(labels["com.claudex.slim"] == "1", ImageUserOf(labels).Sudo && !o.noSudo())
+	if err := dx.Exec("-u", "root", o.Name, "sh", "-c", agentDocsScript, "sh", doc); err != nil {
+		output.Warnf(errOut, "unable to write the agent instruction files: %v\n", err)
+	}
+}
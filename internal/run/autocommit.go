@@ -0,0 +1,44 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/checkpoint"
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/output"
+)
+
+// AutoCommitLabel records the --auto-commit interval so a reused container
+// gets its loop restarted.
+const AutoCommitLabel = "com.claudex.auto-commit"
+
+// MinAutoCommit keeps --auto-commit from hammering git.
+const MinAutoCommit = time.Minute
+
+// maybeStartAutoCommit starts the periodic checkpoint loop in the background.
+// The loop exits with the container, so it is restarted on reuse; a second
+// start while one is running is a no-op.
+func maybeStartAutoCommit(every time.Duration, dx dockerx.Docker, name string, out, errOut io.Writer) {
+	if every <= 0 {
+		return
+	}
+	fmt.Fprintf(out, "Auto-committing /workspace every %s (see: claudex checkpoint --list)\n", every)
+	args := append([]string{"-d", name}, checkpoint.AutoCommand(every)...)
+	if err := dx.Exec(args...); err != nil {
+		output.Warnf(errOut, "cannot start auto-commit: %v\n", err)
+	}
+}
+
+// parseAutoCommit validates an --auto-commit interval.
+func parseAutoCommit(v string) (time.Duration, error) {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid --auto-commit %q (want a duration like 10m)", v)
+	}
+	if d < MinAutoCommit {
+		return 0, fmt.Errorf("--auto-commit must be at least %s", MinAutoCommit)
+	}
+	return d, nil
+}
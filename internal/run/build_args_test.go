@@ -2,10 +2,17 @@ package run
 
 import (
 	"encoding/json"
+	"io"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
-	"claudex/internal/version"
+	"github.com/photodialectic/claudex/internal/config"
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/policy"
+	"github.com/photodialectic/claudex/internal/version"
 )
 
 func TestBuildRunArgsLabelsAndMounts(t *testing.T) {
@@ -32,9 +39,15 @@ func TestBuildRunArgsLabelsAndMounts(t *testing.T) {
 	if !contains(args, "com.claudex.mounts="+string(b)) {
 		t.Fatalf("missing mounts label in args: %v", args)
 	}
-	// Final command should be tail -f /dev/null to keep container running
-	if !(len(args) >= 4 && args[len(args)-4] == "claudex" && args[len(args)-3] == "tail" && args[len(args)-2] == "-f" && args[len(args)-1] == "/dev/null") {
-		t.Fatalf("expected trailing [claudex tail -f /dev/null], got %v", args[max(0, len(args)-4):])
+	if !contains(args, "--health-cmd") {
+		t.Fatalf("missing health check in args: %v", args)
+	}
+	// Final command should mark readiness and idle to keep the container running
+	if !(len(args) >= 4 && args[len(args)-4] == "claudex" && args[len(args)-3] == "sh" && args[len(args)-2] == "-c" && strings.HasSuffix(args[len(args)-1], "exec tail -f /dev/null")) {
+		t.Fatalf("expected trailing [claudex sh -c ...tail -f /dev/null], got %v", args[max(0, len(args)-4):])
+	}
+	if !contains(args, ReadyLabel+"="+ReadyMarker) {
+		t.Fatalf("missing ready label in args: %v", args)
 	}
 }
 
@@ -53,3 +66,278 @@ func contains(a []string, s string) bool {
 	}
 	return false
 }
+
+func TestBuildRunArgsDevMounts(t *testing.T) {
+	bin := filepath.Join(t.TempDir(), "claudex")
+	ctx := t.TempDir()
+	o := Options{Normalized: []string{t.TempDir()}, Signature: "abcd1234", Slug: "slug", Name: "n", Dev: true, DevBinary: bin, BuildContextDir: ctx}
+	args, err := o.BuildRunArgs()
+	if err != nil {
+		t.Fatalf("BuildRunArgs: %v", err)
+	}
+	if !contains(args, bin+":/usr/local/bin/claudex:ro") || !contains(args, ctx+":/opt/claudex/buildctx:ro") {
+		t.Fatalf("missing dev mounts in args: %v", args)
+	}
+	if !contains(args, "com.claudex.dev=true") {
+		t.Fatalf("missing dev label in args: %v", args)
+	}
+}
+
+func TestBuildRunArgsPolicy(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	o := Options{Name: "n", Normalized: []string{"/src/app"}, Policy: policy.Policy{ReadOnlyMounts: true, NoDockerSocket: true, MaxMemory: "2g"}}
+	args, err := o.BuildRunArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	joined := strings.Join(args, " ")
+	if !strings.Contains(joined, "-v /src/app:/workspace/app:ro") || !strings.Contains(joined, "--memory 2g") || strings.Contains(joined, "docker.sock") {
+		t.Fatalf("policy not applied: %s", joined)
+	}
+}
+
+func TestBuildRunArgsDockerSocketOptIn(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	args, _ := Options{Name: "n"}.BuildRunArgs()
+	if strings.Contains(strings.Join(args, " "), "docker.sock") {
+		t.Fatalf("docker socket mounted without --docker-socket: %v", args)
+	}
+	args, _ = Options{Name: "n", NestedDocker: NestedSocket}.BuildRunArgs()
+	joined := strings.Join(args, " ")
+	if !strings.Contains(joined, "-v /var/run/docker.sock:/var/run/docker.sock") || !strings.Contains(joined, "com.claudex.docker-socket=true") {
+		t.Fatalf("expected socket mount and label: %s", joined)
+	}
+	args, _ = Options{Name: "n", NestedDocker: NestedSysbox}.BuildRunArgs()
+	joined = strings.Join(args, " ")
+	if !strings.Contains(joined, "--runtime sysbox-runc") || !strings.Contains(joined, "com.claudex.nested-docker=sysbox") || strings.Contains(joined, "docker.sock") {
+		t.Fatalf("expected sysbox runtime without socket: %s", joined)
+	}
+	args, _ = Options{Name: "n", NestedDocker: NestedDind}.BuildRunArgs()
+	if !strings.Contains(strings.Join(args, " "), "--privileged") {
+		t.Fatalf("expected --privileged for dind: %v", args)
+	}
+}
+
+func TestHostGitShadowing(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	root := t.TempDir()
+	repo := filepath.Join(root, "app")
+	plain := filepath.Join(root, "docs")
+	for _, d := range []string{filepath.Join(repo, ".git", "refs"), plain} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(repo, ".git", "HEAD"), []byte("ref: refs/heads/main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modes, err := resolveHostGit([]string{repo, plain}, "copy", config.HostGit{Mounts: map[string]string{"docs": "empty"}})
+	if err != nil || len(modes) != 1 || modes[repo] != HostGitCopy {
+		t.Fatalf("modes = %v, %v", modes, err)
+	}
+	if _, err := resolveHostGit([]string{repo}, "bogus", config.HostGit{}); err == nil {
+		t.Fatalf("expected invalid mode error")
+	}
+
+	o := Options{Name: "n", Normalized: []string{repo}, HostGitMounts: map[string]string{repo: HostGitEmpty}}
+	args, _ := o.BuildRunArgs()
+	if !strings.Contains(strings.Join(args, " "), "--tmpfs /workspace/app/.git") {
+		t.Fatalf("expected tmpfs shadow: %v", args)
+	}
+
+	o.HostGitMounts[repo] = HostGitCopy
+	if err := o.prepareHostGit(io.Discard); err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	copyDir, _ := hostGitCopyDir("n", repo)
+	if data, err := os.ReadFile(filepath.Join(copyDir, "HEAD")); err != nil || !strings.HasPrefix(string(data), "ref:") {
+		t.Fatalf("copy missing HEAD: %q %v", data, err)
+	}
+	args, _ = o.BuildRunArgs()
+	if !strings.Contains(strings.Join(args, " "), "-v "+copyDir+":/workspace/app/.git") {
+		t.Fatalf("expected copy mount: %v", args)
+	}
+	if err := RemoveHostGitCopies("n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(copyDir); !os.IsNotExist(err) {
+		t.Fatalf("copy not removed: %v", err)
+	}
+}
+
+func TestExcludeArgs(t *testing.T) {
+	root := t.TempDir()
+	app := filepath.Join(root, "app")
+	for _, d := range []string{"data/raw", "secrets", "src"} {
+		if err := os.MkdirAll(filepath.Join(app, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(app, ".env"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	globs, err := validateExcludes([]string{"data", "data/*", ".env", "secrets/", "missing"})
+	if err != nil {
+		t.Fatalf("validateExcludes: %v", err)
+	}
+	o := Options{Name: "n", Normalized: []string{app}, Excludes: globs}
+	args, err := o.BuildRunArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	joined := strings.Join(args, " ")
+	for _, want := range []string{
+		"-v " + app + ":/workspace/app -v /dev/null:/workspace/app/.env:ro",
+		"--tmpfs /workspace/app/data",
+		"--tmpfs /workspace/app/secrets",
+		ExcludesLabel + `=["data","data/*",".env","secrets","missing"]`,
+	} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("missing %q in %s", want, joined)
+		}
+	}
+	if strings.Contains(joined, "data/raw") || strings.Contains(joined, "src") {
+		t.Fatalf("unexpected shadow: %s", joined)
+	}
+	for _, bad := range []string{"", "/etc", "../x", "a/../..", "[x"} {
+		if _, err := validateExcludes([]string{bad}); err == nil {
+			t.Errorf("validateExcludes(%q) accepted", bad)
+		}
+	}
+}
+
+func TestHomeMountArgs(t *testing.T) {
+	home := t.TempDir()
+	for _, d := range []string{".aws", ".config/gh", ".config/ghx"} {
+		if err := os.MkdirAll(filepath.Join(home, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(home, ".netrc"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	args, err := homeMountArgs(home, []config.HomeMount{
+		{Path: "~/.aws"},
+		{Path: "~/.config/gh*", Mode: "rw"},
+		{Path: ".netrc"},
+		{Path: "~/.missing"},
+	})
+	if err != nil {
+		t.Fatalf("homeMountArgs: %v", err)
+	}
+	want := []string{
+		"-v", home + "/.aws:/home/node/.aws:ro",
+		"-v", home + "/.config/gh:/home/node/.config/gh",
+		"-v", home + "/.config/ghx:/home/node/.config/ghx",
+		"-v", home + "/.netrc:/home/node/.netrc:ro",
+	}
+	if strings.Join(args, " ") != strings.Join(want, " ") {
+		t.Fatalf("args = %v\nwant %v", args, want)
+	}
+	if _, err := homeMountArgs(home, []config.HomeMount{{Path: "/etc"}}); err == nil {
+		t.Fatalf("expected paths outside home to be rejected")
+	}
+	if err := validateHomeMounts([]config.HomeMount{{Path: "~/.aws", Mode: "rx"}}); err == nil {
+		t.Fatalf("expected invalid mode error")
+	}
+}
+
+func TestMountConsistency(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	root := t.TempDir()
+	app, web := filepath.Join(root, "app"), filepath.Join(root, "web")
+	modes, err := resolveConsistency([]string{app, web}, "cached", config.MountConsistency{Mounts: map[string]string{"web": "delegated"}})
+	if err != nil || modes[app] != ConsistencyCached || modes[web] != ConsistencyDelegated {
+		t.Fatalf("modes = %v, %v", modes, err)
+	}
+	if _, err := resolveConsistency([]string{app}, "fast", config.MountConsistency{}); err == nil {
+		t.Fatalf("expected invalid mode error")
+	}
+	o := Options{Name: "n", Normalized: []string{app, web}, MountConsistency: modes}
+	o.Policy.ReadOnlyMounts = true
+	args, _ := o.BuildRunArgs()
+	joined := strings.Join(args, " ")
+	if !strings.Contains(joined, app+":/workspace/app:ro,cached") || !strings.Contains(joined, web+":/workspace/web:ro,delegated") {
+		t.Fatalf("expected consistency options: %v", args)
+	}
+}
+
+func TestTTLArgsAndExpiry(t *testing.T) {
+	if _, err := ParseArgs([]string{"--ttl", "5m"}); err == nil {
+		t.Fatal("--ttl below MinTTL should be refused")
+	}
+	o, err := ParseArgs([]string{"--ttl", "4h", "--ttl-destroy"})
+	if err != nil || o.TTL != 4*time.Hour || !o.TTLDestroy {
+		t.Fatalf("ParseArgs: %v %+v", err, o)
+	}
+	at := time.Unix(1_800_000_000, 0)
+	o = Options{Name: "n", Expires: at, TTLDestroy: true}
+	args, err := o.BuildRunArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	joined := strings.Join(args, " ")
+	for _, want := range []string{"-e CLAUDEX_EXPIRES=1800000000", "-e CLAUDEX_EXPIRES_WARN=600", ExpiresLabel + "=1800000000", TTLActionLabel + "=" + TTLDestroy} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("missing %q in %s", want, joined)
+		}
+	}
+	c := &dockerx.Container{Labels: map[string]string{ExpiresLabel: "1800000000"}}
+	if Expired(c, at.Add(-time.Second)) || !Expired(c, at) || Expired(&dockerx.Container{}, at) {
+		t.Fatal("Expired disagrees with the label")
+	}
+}
+
+func TestSigningArgs(t *testing.T) {
+	o, err := ParseArgs([]string{"--sign"})
+	if err != nil || !o.Sign {
+		t.Fatalf("ParseArgs: %v %+v", err, o)
+	}
+	o = Options{Name: "n", SigningDir: "/state/signing/sig"}
+	args, err := o.BuildRunArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	joined := strings.Join(args, " ")
+	for _, want := range []string{"-v /state/signing/sig:" + SigningMount, SigningLabel + "=ssh", "-e GIT_CONFIG_COUNT=5", "-e GIT_CONFIG_KEY_0=gpg.format -e GIT_CONFIG_VALUE_0=ssh", "-e GIT_CONFIG_VALUE_3=true"} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("missing %q in %s", want, joined)
+		}
+	}
+	args, _ = Options{Name: "n"}.BuildRunArgs()
+	if strings.Contains(strings.Join(args, " "), "GIT_CONFIG") {
+		t.Fatalf("unsigned container configures git: %v", args)
+	}
+}
+
+func TestNoSudoArgsAndDocs(t *testing.T) {
+	o, err := ParseArgs([]string{"--no-sudo"})
+	if err != nil || !o.NoSudo {
+		t.Fatalf("ParseArgs: %v %+v", err, o)
+	}
+	for _, o := range []Options{{Name: "n", NoSudo: true}, {Name: "n", Policy: policy.Policy{NoSudo: true}}} {
+		args, err := o.BuildRunArgs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(strings.Join(args, " "), "--security-opt "+policy.NoNewPrivileges) {
+			t.Fatalf("sudo not disabled: %v", args)
+		}
+	}
+	args, _ := Options{Name: "n"}.BuildRunArgs()
+	if strings.Contains(strings.Join(args, " "), "no-new-privileges") {
+		t.Fatalf("sudo disabled by default: %v", args)
+	}
+	o = Options{Name: "n", NestedDocker: NestedDind}
+	if doc := o.renderAgentDocs(false, false); !strings.Contains(doc, "use `docker` (there is no sudo)") {
+		t.Fatalf("docs without sudo:\n%s", doc)
+	}
+	f := &dockerx.Fake{ImageLabelsOut: map[string]map[string]string{"claudex": {SudoLabel: "0"}}}
+	o.writeAgentDocs(f, io.Discard)
+	if doc := f.ExecCalls[0][len(f.ExecCalls[0])-1]; !strings.Contains(doc, "there is no sudo") {
+		t.Fatalf("image without sudo documented as having it:\n%s", doc)
+	}
+	if u := ImageUserOf(map[string]string{UserLabel: "dev", UIDLabel: "501"}); u != (ImageUser{Name: "dev", UID: 501, Sudo: true}) {
+		t.Fatalf("ImageUserOf = %+v", u)
+	}
+}
@@ -0,0 +1,186 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/config"
+	"github.com/photodialectic/claudex/internal/containers"
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/policy"
+	"github.com/photodialectic/claudex/internal/state"
+)
+
+// cloneArchive is the scratch tarball used to carry state between containers.
+const cloneArchive = "/tmp/claudex-clone.tar"
+
+// Clone creates a new container with src's mounts and labels, then copies the
+// parts of /workspace and /home/node that are not bind mounts (the workspace
+// git repo, scratch files, tool state) so an experiment can branch off.
+// nested is the clone's --nested-docker mode; src's is not carried over.
+func Clone(src, as, nested string, out, errOut io.Writer, dx dockerx.Docker) error {
+	info, err := dx.Inspect(src)
+	if err != nil {
+		return fmt.Errorf("container %s does not exist", src)
+	}
+	if !containers.IsClaudex(&info) {
+		return fmt.Errorf("%s is not a claudex container", src)
+	}
+	mounts, err := containers.MountsFromLabel(&info)
+	if err != nil {
+		return fmt.Errorf("container %s missing mount label: %v", src, err)
+	}
+	name := as
+	if name == "" {
+		name = fmt.Sprintf("%s-clone-%d", src, time.Now().Unix())
+	}
+	if _, err := dx.Inspect(name); err == nil {
+		return fmt.Errorf("container %s already exists; pick another name with --as", name)
+	}
+	if info.Status != "running" {
+		fmt.Fprintf(out, "Starting container %s...\n", src)
+		if err := dx.Start(src); err != nil {
+			return fmt.Errorf("failed to start container: %w", err)
+		}
+		if err := waitReady(dockerx.Context(), dx, src); err != nil {
+			return err
+		}
+	}
+
+	o := Options{
+		Name:       name,
+		Normalized: mounts,
+		Signature:  info.Labels["com.claudex.signature"],
+		Slug:       info.Labels["com.claudex.slug"],
+		// Carry over opt-ins recorded in labels
+		Audit:  info.Labels["com.claudex.audit"] == "true",
+		Cow:    info.Labels[CowLabel] == "true",
+		NoSudo: policy.SudoDisabled(info.SecurityOpt),
+		// The clone shares the signature's workspace volume.
+		WorkspaceVolume: info.Labels[VolumeLabel] != "",
+		// --host-git shows in how .git is shadowed; copies continue
+		// from src's.
+		HostGitMounts: hostGitOf(info, mounts),
+		hostGitFrom:   src,
+	}
+	if o.NestedDocker, err = carryNestedDocker(info.Labels, nested, errOut); err != nil {
+		return err
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	warnIgnoredConfig(cfg.Ignored, errOut)
+	if err := o.applyPolicy(cfg.Policy); err != nil {
+		return err
+	}
+	o.Owner = ownerFrom(cfg)
+	fmt.Fprintf(out, "Creating container %s from %s...\n", name, src)
+	warnDockerSocket(o, errOut)
+	if o.HistoryDir, err = HistoryDir(o.Signature); err != nil {
+		return err
+	}
+	if err := o.prepareHost(out); err != nil {
+		return err
+	}
+	runArgs, err := o.BuildRunArgs()
+	if err != nil {
+		return err
+	}
+	if err := o.runContainer(dx, runArgs, errOut); err != nil {
+		return fmt.Errorf("docker run failed: %w", err)
+	}
+	if err := waitReady(dockerx.Context(), dx, name); err != nil {
+		o.abandon(dx, errOut)
+		return err
+	}
+	maybeInitFirewall(o.Firewall, dx, name, out, errOut)
+	maybeStartDockerd(o.NestedDocker, dx, name, out, errOut)
+	fmt.Fprintln(out, "Copying workspace and home state...")
+	var dests []string
+	for _, m := range info.Mounts {
+		dests = append(dests, m.Destination)
+	}
+	shared := mounts
+	if o.Cow {
+		// The workspace copies are container state; clone them too.
+		shared = nil
+	}
+	if err := copyState(dx, src, name, cloneExcludes(shared, dests)); err != nil {
+		o.abandon(dx, errOut)
+		return err
+	}
+	now := time.Now()
+	recordSession(state.Session{Name: name, Signature: o.Signature, Slug: o.Slug, Mounts: mounts, CreatedAt: now}, errOut)
+	notifyCreated(o, errOut)
+	fmt.Fprintf(out, "Cloned %s -> %s. Attach with: claudex attach %s\n", src, name, name)
+	return nil
+}
+
+// cloneExcludes returns tar exclude patterns (relative to /) for mounts that
+// live under /workspace or /home/node; their content is shared, not copied.
+func cloneExcludes(hostMounts, destinations []string) []string {
+	seen := map[string]bool{}
+	for _, m := range hostMounts {
+		seen["workspace/"+filepath.Base(m)] = true
+	}
+	for _, d := range destinations {
+		d = path.Clean(d)
+		if strings.HasPrefix(d, "/workspace/") || strings.HasPrefix(d, "/home/node/") {
+			seen[strings.TrimPrefix(d, "/")] = true
+		}
+	}
+	res := make([]string, 0, len(seen))
+	for k := range seen {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// copyState archives /workspace and /home/node in src (minus excludes) and
+// unpacks them in dst via a host temp file.
+func copyState(dx dockerx.Docker, src, dst string, excludes []string) error {
+	create := []string{"tar", "-C", "/", "-cpf", cloneArchive, "--ignore-failed-read"}
+	for _, e := range excludes {
+		create = append(create, "--exclude="+e)
+	}
+	create = append(create, "workspace", "home/node")
+	// tar exits 1 when files change while being read; that is fine here.
+	script := strings.Join(quoteAll(create), " ") + "; [ $? -le 1 ]"
+	if err := dx.Exec("-u", "root", src, "sh", "-c", script); err != nil {
+		return fmt.Errorf("archive state in %s: %w", src, err)
+	}
+	defer dx.Exec("-u", "root", src, "rm", "-f", cloneArchive)
+
+	tmp, err := os.MkdirTemp("", "claudex-clone-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	local := filepath.Join(tmp, path.Base(cloneArchive))
+	if err := dx.CP(src+":"+cloneArchive, local); err != nil {
+		return fmt.Errorf("copy state out of %s: %w", src, err)
+	}
+	if err := dx.CP(local, dst+":"+cloneArchive); err != nil {
+		return fmt.Errorf("copy state into %s: %w", dst, err)
+	}
+	if err := dx.Exec("-u", "root", dst, "tar", "-C", "/", "-xpf", cloneArchive); err != nil {
+		return fmt.Errorf("unpack state in %s: %w", dst, err)
+	}
+	return dx.Exec("-u", "root", dst, "rm", "-f", cloneArchive)
+}
+
+func quoteAll(args []string) []string {
+	res := make([]string, len(args))
+	for i, a := range args {
+		res[i] = "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+	}
+	return res
+}
@@ -0,0 +1,47 @@
+package run
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/photodialectic/claudex/internal/config"
+)
+
+// Bind-mount consistency modes understood by Docker Desktop's osxfs and
+// gRPC FUSE file sharing. Linux engines accept and ignore them, and
+// Docker Desktop's virtiofs backend caches on its own, so they only pay
+// off on the older backends.
+const (
+	ConsistencyConsistent = "consistent"
+	ConsistencyCached     = "cached"
+	ConsistencyDelegated  = "delegated"
+)
+
+// resolveConsistency returns the consistency mode for each workspace mount
+// that sets one. Per-mount entries (by basename or absolute path) override
+// the flag, which overrides mountConsistency.default.
+func resolveConsistency(norm []string, flag string, cfg config.MountConsistency) (map[string]string, error) {
+	def := cfg.Default
+	if flag != "" {
+		def = flag
+	}
+	res := map[string]string{}
+	for _, abs := range norm {
+		mode := def
+		if m, ok := cfg.Mounts[filepath.Base(abs)]; ok {
+			mode = m
+		}
+		if m, ok := cfg.Mounts[abs]; ok {
+			mode = m
+		}
+		switch mode {
+		case "":
+			continue
+		case ConsistencyConsistent, ConsistencyCached, ConsistencyDelegated:
+		default:
+			return nil, fmt.Errorf("invalid mount consistency %q for %s (want consistent, cached or delegated)", mode, abs)
+		}
+		res[abs] = mode
+	}
+	return res, nil
+}
@@ -0,0 +1,30 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+)
+
+// CowLabel marks containers whose workspace dirs were copied in (--cow)
+// rather than bind-mounted.
+const CowLabel = "com.claudex.cow"
+
+// copyWorkspaceIn copies each host dir to /workspace/<basename> and hands it
+// to the container user. The copies are the container's own: nothing the agent does
+// reaches the host until `claudex export`.
+func (o Options) copyWorkspaceIn(dx dockerx.Docker, out io.Writer) error {
+	for _, abs := range o.Normalized {
+		dest := "/workspace/" + filepath.Base(abs)
+		fmt.Fprintf(out, "Copying %s -> %s (copy-on-write)...\n", abs, dest)
+		if err := dx.CP(abs, o.Name+":"+dest); err != nil {
+			return fmt.Errorf("copy %s into container: %w", abs, err)
+		}
+		if err := dx.Exec("-u", "root", o.Name, "chown", "-R", homeOwner, dest); err != nil {
+			return fmt.Errorf("chown %s: %w", dest, err)
+		}
+	}
+	return nil
+}
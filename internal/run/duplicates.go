@@ -0,0 +1,120 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/output"
+	"github.com/photodialectic/claudex/internal/state"
+	"github.com/photodialectic/claudex/internal/ui"
+)
+
+// sameSignature returns the claudex containers for o's workspace, oldest
+// first. Only o.Name and its --parallel variants (o.Name-<timestamp>) are
+// inspected, so the common case costs one ps; with --pick every container
+// is.
+func (o Options) sameSignature(dx dockerx.Docker) ([]dockerx.Container, error) {
+	names, err := dx.PS(true)
+	if err != nil {
+		return nil, err
+	}
+	var res []dockerx.Container
+	for _, n := range names {
+		if !o.Pick && n != o.Name && !strings.HasPrefix(n, o.Name+"-") {
+			continue
+		}
+		c, err := dx.Inspect(n)
+		if err != nil || c.Labels["com.claudex.signature"] != o.Signature {
+			continue
+		}
+		res = append(res, c)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].CreatedAt.Before(res[j].CreatedAt) })
+	return res, nil
+}
+
+// reconcileDuplicates runs before o.Name is used. When several containers
+// share o's signature (left by --parallel runs), or with --pick, it lists
+// them, sets o.Name to the one picked and offers to remove the other
+// stopped ones. With nobody to ask it only warns and keeps o.Name.
+func (o *Options) reconcileDuplicates(dx dockerx.Docker, p ui.Prompter, out, errOut io.Writer) error {
+	dups, err := o.sameSignature(dx)
+	if err != nil {
+		return err
+	}
+	if len(dups) < 2 && !(o.Pick && len(dups) > 0) {
+		return nil
+	}
+	if !o.Pick && !p.Interactive() {
+		var names []string
+		for _, c := range dups {
+			names = append(names, c.Name)
+		}
+		output.Warnf(errOut, "%d containers share signature %s (%s); using %s. Choose with --pick, or remove the stopped ones with claudex destroy --signature %s --stopped\n",
+			len(dups), o.Signature, strings.Join(names, ", "), o.Name, o.Signature)
+		return nil
+	}
+
+	menu := ui.Menu{
+		Title:    fmt.Sprintf("Containers for this workspace (signature %s):", o.Signature),
+		Question: "Use which? (blank for the default) ",
+	}
+	for i, c := range dups {
+		menu.Options = append(menu.Options, fmt.Sprintf("%-40s %-10s %s", c.Name, c.Status, c.CreatedAt.Format("2006-01-02 15:04")))
+		if c.Name == o.Name {
+			menu.Default = []int{i}
+		}
+	}
+	if menu.Default == nil {
+		menu.Options = append(menu.Options, "a new container, "+o.Name)
+		menu.Default = []int{len(dups)}
+	}
+	idx, err := p.SelectOne(menu)
+	if err != nil {
+		return err
+	}
+	if idx < 0 {
+		idx = menu.Default[0]
+	}
+	if idx < len(dups) {
+		o.Name = dups[idx].Name
+	}
+
+	var stale []string
+	for _, c := range dups {
+		if c.Name != o.Name && c.Status != "running" && !Protected(&c) {
+			stale = append(stale, c.Name)
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	ok, err := p.Confirm(fmt.Sprintf("Remove the other stopped container(s) %s? [y/N] ", strings.Join(stale, ", ")))
+	if err != nil || !ok {
+		return err
+	}
+	var removed []string
+	for _, n := range stale {
+		if err := dx.Remove(n, true); err != nil {
+			output.Warnf(errOut, "cannot remove %s: %v\n", n, err)
+			continue
+		}
+		fmt.Fprintf(out, "Removed %s\n", n)
+		removed = append(removed, n)
+	}
+	now := time.Now()
+	err = state.Update(func(s *state.Store) error {
+		for _, n := range removed {
+			s.MarkRemoved(n, now)
+		}
+		return nil
+	})
+	if err != nil {
+		output.Warnf(errOut, "unable to update session state: %v\n", err)
+	}
+	return nil
+}
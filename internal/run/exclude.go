@@ -0,0 +1,90 @@
+package run
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ExcludesLabel records the --exclude globs (a JSON list) a container was
+// created with.
+const ExcludesLabel = "com.claudex.excludes"
+
+// validateExcludes checks each --exclude glob is a valid pattern relative
+// to a mounted dir and returns them cleaned.
+func validateExcludes(globs []string) ([]string, error) {
+	var res []string
+	for _, g := range globs {
+		c := path.Clean(filepath.ToSlash(g))
+		if g == "" || path.IsAbs(c) || c == "." || c == ".." || strings.HasPrefix(c, "../") {
+			return nil, fmt.Errorf("invalid --exclude %q: want a glob relative to a mounted dir, e.g. data or secrets/*", g)
+		}
+		if _, err := path.Match(c, ""); err != nil {
+			return nil, fmt.Errorf("invalid --exclude %q: %v", g, err)
+		}
+		res = append(res, c)
+	}
+	return res, nil
+}
+
+// excludeArgs returns the docker run args hiding the paths matched by
+// o.Excludes in each mount: directories behind an empty tmpfs, files
+// behind /dev/null. Like hostGitArgs they must follow the mounts they
+// shadow. Globs are matched when the container is created; paths added
+// later are visible.
+func (o Options) excludeArgs() ([]string, error) {
+	var args []string
+	seen := map[string]bool{}
+	var hidden []string
+	for _, abs := range o.Normalized {
+		var matches []string
+		for _, g := range o.Excludes {
+			m, err := filepath.Glob(filepath.Join(abs, filepath.FromSlash(g)))
+			if err != nil {
+				return nil, err
+			}
+			matches = append(matches, m...)
+		}
+		sort.Strings(matches)
+		for _, m := range matches {
+			rel, err := filepath.Rel(abs, m)
+			if err != nil || rel == "." {
+				continue
+			}
+			target := "/workspace/" + filepath.Base(abs) + "/" + filepath.ToSlash(rel)
+			if seen[target] || under(hidden, target) {
+				continue
+			}
+			seen[target] = true
+			fi, err := os.Stat(m)
+			if err != nil {
+				continue
+			}
+			if fi.IsDir() {
+				hidden = append(hidden, target)
+				args = append(args, "--tmpfs", target)
+			} else {
+				args = append(args, "-v", "/dev/null:"+target+":ro")
+			}
+		}
+	}
+	if len(o.Excludes) > 0 {
+		b, _ := json.Marshal(o.Excludes)
+		args = append(args, "--label", ExcludesLabel+"="+string(b))
+	}
+	return args, nil
+}
+
+// under reports whether target is inside one of dirs.
+func under(dirs []string, target string) bool {
+	for _, d := range dirs {
+		if strings.HasPrefix(target, d+"/") {
+			return true
+		}
+	}
+	return false
+}
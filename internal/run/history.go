@@ -0,0 +1,56 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/photodialectic/claudex/internal/state"
+)
+
+// HistoryMount is where the per-signature history dir appears in the container.
+const HistoryMount = Home + "/.claudex-history"
+
+// HistoryFiles are the shell history files kept in the history dir, relative
+// to it. Fish writes under XDG_DATA_HOME, which attach points here.
+var HistoryFiles = []string{"bash_history", "zsh_history", "fish/fish_history"}
+
+// HistoryDir returns the host dir holding shell history for a workspace
+// signature, so history survives container recreation.
+func HistoryDir(signature string) (string, error) {
+	dir, err := state.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history", signature), nil
+}
+
+// historyArgs mounts the history dir and points bash at it. PROMPT_COMMAND
+// appends after every command so history survives a killed session.
+func (o Options) historyArgs() []string {
+	if o.HistoryDir == "" {
+		return nil
+	}
+	return []string{
+		"-v", o.HistoryDir + ":" + HistoryMount,
+		"-e", "HISTFILE=" + HistoryMount + "/bash_history",
+		"-e", "PROMPT_COMMAND=history -a",
+	}
+}
+
+// prepareHost creates host-side state the container mounts: the history and
+// signing dirs and private .git copies.
+func (o Options) prepareHost(out io.Writer) error {
+	if o.HistoryDir != "" {
+		if err := os.MkdirAll(o.HistoryDir, 0700); err != nil {
+			return fmt.Errorf("cannot create history dir: %w", err)
+		}
+	}
+	if o.SigningDir != "" {
+		if err := os.MkdirAll(o.SigningDir, 0700); err != nil {
+			return fmt.Errorf("cannot create signing dir: %w", err)
+		}
+	}
+	return o.prepareHostGit(out)
+}
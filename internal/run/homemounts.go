@@ -0,0 +1,63 @@
+package run
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/photodialectic/claudex/internal/config"
+)
+
+// validateHomeMounts checks homeMounts modes; paths are resolved at run time.
+func validateHomeMounts(mounts []config.HomeMount) error {
+	for _, m := range mounts {
+		if m.Path == "" {
+			return fmt.Errorf("homeMounts: entry without a path")
+		}
+		switch m.Mode {
+		case "", "ro", "rw":
+		default:
+			return fmt.Errorf("homeMounts: invalid mode %q for %s (want ro or rw)", m.Mode, m.Path)
+		}
+	}
+	return nil
+}
+
+// homeMountArgs expands homeMounts against home and returns -v args mounting
+// each match at the same path under /home/node. Missing paths are skipped;
+// paths outside home are rejected so config can't expose arbitrary host dirs
+// at surprising places.
+func homeMountArgs(home string, mounts []config.HomeMount) ([]string, error) {
+	var args []string
+	seen := map[string]bool{}
+	for _, m := range mounts {
+		p := m.Path
+		if p == "~" || strings.HasPrefix(p, "~/") {
+			p = filepath.Join(home, strings.TrimPrefix(p, "~"))
+		} else if !filepath.IsAbs(p) {
+			p = filepath.Join(home, p)
+		}
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, fmt.Errorf("homeMounts: bad pattern %s: %w", m.Path, err)
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			rel, err := filepath.Rel(home, match)
+			if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return nil, fmt.Errorf("homeMounts: %s is not inside %s", match, home)
+			}
+			if seen[match] {
+				continue
+			}
+			seen[match] = true
+			spec := fmt.Sprintf("%s:/home/node/%s", match, filepath.ToSlash(rel))
+			if m.Mode != "rw" {
+				spec += ":ro"
+			}
+			args = append(args, "-v", spec)
+		}
+	}
+	return args, nil
+}
@@ -0,0 +1,169 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/photodialectic/claudex/internal/config"
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/state"
+)
+
+// Host .git handling for mounted repositories (--host-git and hostGit in config).
+const (
+	// HostGitKeep mounts the repository as is; the agent shares host history.
+	HostGitKeep = "keep"
+	// HostGitEmpty hides .git behind an empty tmpfs.
+	HostGitEmpty = "empty"
+	// HostGitCopy mounts a private copy of .git taken at creation time.
+	HostGitCopy = "copy"
+)
+
+// resolveHostGit returns the non-keep mode for each mount whose .git is a
+// directory. Per-mount entries (by basename or absolute path) override the
+// flag, which overrides hostGit.default.
+func resolveHostGit(norm []string, flag string, cfg config.HostGit) (map[string]string, error) {
+	def := cfg.Default
+	if flag != "" {
+		def = flag
+	}
+	res := map[string]string{}
+	for _, abs := range norm {
+		mode := def
+		if m, ok := cfg.Mounts[filepath.Base(abs)]; ok {
+			mode = m
+		}
+		if m, ok := cfg.Mounts[abs]; ok {
+			mode = m
+		}
+		switch mode {
+		case "", HostGitKeep:
+			continue
+		case HostGitEmpty, HostGitCopy:
+		default:
+			return nil, fmt.Errorf("invalid host git mode %q for %s (want keep, empty or copy)", mode, abs)
+		}
+		if fi, err := os.Stat(filepath.Join(abs, ".git")); err != nil || !fi.IsDir() {
+			continue
+		}
+		res[abs] = mode
+	}
+	return res, nil
+}
+
+// hostGitOf recovers the non-keep mode of each of mounts from how info
+// shadows its .git: a tmpfs is empty, a bind mount is copy.
+func hostGitOf(info dockerx.Container, mounts []string) map[string]string {
+	res := map[string]string{}
+	for _, abs := range mounts {
+		target := "/workspace/" + filepath.Base(abs) + "/.git"
+		if _, ok := info.Tmpfs[target]; ok {
+			res[abs] = HostGitEmpty
+		}
+		for _, m := range info.Mounts {
+			if m.Destination == target && m.Type == "bind" {
+				res[abs] = HostGitCopy
+			}
+		}
+	}
+	return res
+}
+
+// hostGitCopyDir is where the private .git copy for a mount lives.
+func hostGitCopyDir(name, abs string) (string, error) {
+	dir, err := state.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "git", name, filepath.Base(abs)), nil
+}
+
+// hostGitArgs returns the docker run args shadowing each mount's .git.
+func (o Options) hostGitArgs() ([]string, error) {
+	var args []string
+	for _, abs := range o.Normalized {
+		target := "/workspace/" + filepath.Base(abs) + "/.git"
+		switch o.HostGitMounts[abs] {
+		case HostGitEmpty:
+			args = append(args, "--tmpfs", target)
+		case HostGitCopy:
+			dir, err := hostGitCopyDir(o.Name, abs)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, "-v", dir+":"+target)
+		}
+	}
+	return args, nil
+}
+
+// prepareHostGit snapshots .git for copy-mode mounts before the container is
+// created, replacing any copy left by an earlier container of the same name.
+// A clone starts from its source's private copy instead of the host's.
+func (o Options) prepareHostGit(out io.Writer) error {
+	for _, abs := range o.Normalized {
+		if o.HostGitMounts[abs] != HostGitCopy {
+			continue
+		}
+		dir, err := hostGitCopyDir(o.Name, abs)
+		if err != nil {
+			return err
+		}
+		src := filepath.Join(abs, ".git")
+		if o.hostGitFrom != "" {
+			if src, err = hostGitCopyDir(o.hostGitFrom, abs); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(out, "Copying %s so the container gets private history...\n", src)
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		if err := copyTree(src, dir); err != nil {
+			return fmt.Errorf("cannot copy %s: %w", src, err)
+		}
+	}
+	return nil
+}
+
+// RemoveHostGitCopies deletes the private .git copies made for container name.
+func RemoveHostGitCopies(name string) error {
+	dir, err := state.Dir()
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(dir, "git", name))
+}
+
+// copyTree copies src to dst, preserving modes and symlinks.
+func copyTree(src, dst string) error {
+	return filepath.Walk(src, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case fi.IsDir():
+			return os.MkdirAll(target, fi.Mode().Perm()|0700)
+		case fi.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case fi.Mode().IsRegular():
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(target, data, fi.Mode().Perm())
+		}
+		return nil
+	})
+}
@@ -0,0 +1,109 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/output"
+)
+
+// PublishedPortsLabel lists the ports published in place of --host-network,
+// e.g. "1455,8810", so reuse and recreate can restore them.
+const PublishedPortsLabel = "com.claudex.published-ports"
+
+// DefaultFallbackPorts are the OAuth callback ports --host-network exists
+// for: `codex login` (1455) and the bundled google-docs-mcp (8810). Set
+// hostNetworkPorts in config to change them.
+var DefaultFallbackPorts = []int{1455, 8810}
+
+// hostNetworkFallback swaps --host-network for published ports when the
+// engine runs in a VM (Docker Desktop, or any engine off Linux), where host
+// networking means the VM's network and callbacks to the host's localhost
+// never arrive.
+func (o *Options) hostNetworkFallback(dx dockerx.Docker, errOut io.Writer) {
+	if !o.UseHostNetwork || !hostNetworkUnsupported(dx) {
+		return
+	}
+	o.UseHostNetwork = false
+	o.PublishPorts = o.FallbackPorts
+	if o.PublishPorts == nil {
+		o.PublishPorts = DefaultFallbackPorts
+	}
+	output.Warnf(errOut, "--host-network does not reach the host when the engine runs in a VM; publishing port(s) %s on the host's localhost instead. Host services are at host.docker.internal.\n", portsLabel(o.PublishPorts))
+}
+
+func hostNetworkUnsupported(dx dockerx.Docker) bool {
+	if runtime.GOOS != "linux" {
+		return true
+	}
+	info, err := dx.Info()
+	return err == nil && info.DockerDesktop()
+}
+
+// publishArgs publishes each port on the host's loopback only.
+func publishArgs(ports []int) []string {
+	if len(ports) == 0 {
+		return nil
+	}
+	var args []string
+	for _, p := range ports {
+		args = append(args, "-p", fmt.Sprintf("127.0.0.1:%d:%d", p, p))
+	}
+	return append(args, "--label", PublishedPortsLabel+"="+portsLabel(ports))
+}
+
+func portsLabel(ports []int) string {
+	s := make([]string, len(ports))
+	for i, p := range ports {
+		s[i] = strconv.Itoa(p)
+	}
+	return strings.Join(s, ",")
+}
+
+// HostReachable reports whether port in container c already answers on the
+// host's localhost: it was published in place of --host-network, or c shares
+// the network of a host that runs the engine natively.
+func HostReachable(dx dockerx.Docker, c dockerx.Container, port int) bool {
+	for _, p := range parsePorts(c.Labels[PublishedPortsLabel]) {
+		if p == port {
+			return true
+		}
+	}
+	return c.NetworkMode == "host" && !hostNetworkUnsupported(dx)
+}
+
+// parsePorts reads a PublishedPortsLabel value, skipping anything that is
+// not a port.
+func parsePorts(label string) []int {
+	var ports []int
+	for _, f := range strings.Split(label, ",") {
+		if p, err := strconv.Atoi(strings.TrimSpace(f)); err == nil && p > 0 && p < 65536 {
+			ports = append(ports, p)
+		}
+	}
+	return ports
+}
+
+// forwardScript relays each published port from the container's own address
+// to its loopback: callback servers listen on 127.0.0.1, which a published
+// port cannot reach. Forwarders already running are left alone.
+func forwardScript(ports []int) string {
+	return fmt.Sprintf(`ip=$(hostname -i | awk '{print $1}'); for p in %s; do pgrep -f "TCP-LISTEN:$p,bind=" >/dev/null || nohup socat TCP-LISTEN:$p,bind=$ip,fork,reuseaddr TCP:127.0.0.1:$p >/dev/null 2>&1 & done`,
+		strings.ReplaceAll(portsLabel(ports), ",", " "))
+}
+
+// maybeForwardPorts starts the forwarders for a container created with
+// published ports. They do not survive a restart, so this also runs when a
+// stopped container is reused.
+func maybeForwardPorts(ports []int, dx dockerx.Docker, name string, errOut io.Writer) {
+	if len(ports) == 0 {
+		return
+	}
+	if err := dx.Exec(name, "sh", "-c", forwardScript(ports)); err != nil {
+		output.Warnf(errOut, "cannot forward published ports: %v\n", err)
+	}
+}
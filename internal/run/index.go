@@ -0,0 +1,22 @@
+package run
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/index"
+	"github.com/photodialectic/claudex/internal/output"
+)
+
+// maybeStartIndex builds the file index in the background once the
+// container is set up; `claudex status` shows when it is done.
+func maybeStartIndex(enabled bool, dx dockerx.Docker, name string, out, errOut io.Writer) {
+	if !enabled {
+		return
+	}
+	fmt.Fprintf(out, "Indexing /workspace in the background (see: claudex status, claudex index)\n")
+	if err := dx.Exec(append([]string{"-d", name}, index.Command()...)...); err != nil {
+		output.Warnf(errOut, "cannot start indexing: %v\n", err)
+	}
+}
@@ -0,0 +1,68 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/state"
+)
+
+// lockPoll is how often a waiting claudex retries the name lock.
+var lockPoll = 200 * time.Millisecond
+
+// nameLock is held by the claudex invocation deciding whether to create,
+// start or reuse a container name.
+type nameLock struct {
+	f *os.File
+}
+
+// lockName takes the lock for container name, waiting while another claudex
+// holds it. Two invocations for the same workspace then take turns: the
+// second finds and reuses the container the first created instead of racing
+// it for the name. The lock file lives under the claudex data dir and the
+// lock goes away with the process, so a crash never leaves it held.
+func lockName(name string, errOut io.Writer, sig *interrupts) (*nameLock, error) {
+	dir, err := state.Dir()
+	if err != nil {
+		return nil, err
+	}
+	dir = filepath.Join(dir, "locks")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, name+".lock"), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	for waited := false; ; waited = true {
+		ok, err := state.TryLock(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if ok {
+			return &nameLock{f: f}, nil
+		}
+		if !waited {
+			fmt.Fprintf(errOut, "Waiting for another claudex to finish starting %s...\n", name)
+		}
+		if sig.Interrupted() {
+			f.Close()
+			return nil, errInterrupted
+		}
+		time.Sleep(lockPoll)
+	}
+}
+
+// Release lets the next invocation in. It is safe to call more than once,
+// and on a nil lock.
+func (l *nameLock) Release() {
+	if l == nil || l.f == nil {
+		return
+	}
+	l.f.Close()
+	l.f = nil
+}
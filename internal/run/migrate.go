@@ -0,0 +1,59 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/containers"
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/output"
+)
+
+// migrate replaces the container named o.Name, whose mounts differ from
+// o.Normalized, with a new one that has the requested mounts. The old
+// container is renamed out of the way, its /workspace git state and home
+// caches are copied into the new one (as clone does), and it is removed once
+// the new container is up. On failure the old container gets its name back.
+func (o Options) migrate(info *dockerx.Container, running bool, in io.Reader, out, errOut io.Writer, dx dockerx.Docker, sig *interrupts) error {
+	oldMounts, err := containers.MountsFromLabel(info)
+	if err != nil {
+		return fmt.Errorf("container %s missing mount label: %v", o.Name, err)
+	}
+	fmt.Fprintf(out, "Migrating %s from %v to %v...\n", o.Name, oldMounts, o.Normalized)
+	if !running {
+		fmt.Fprintf(out, "Starting container %s...\n", o.Name)
+		if err := dx.Start(o.Name); err != nil {
+			return fmt.Errorf("failed to start container: %w", err)
+		}
+		if err := waitReady(dockerx.Context(), dx, o.Name); err != nil {
+			return fmt.Errorf("%w; recreate it with --replace instead", err)
+		}
+	}
+	retired := fmt.Sprintf("%s-migrating-%d", o.Name, time.Now().Unix())
+	if err := dx.Run("rename", o.Name, retired); err != nil {
+		return fmt.Errorf("cannot rename %s: %w", o.Name, err)
+	}
+	var dests []string
+	for _, m := range info.Mounts {
+		dests = append(dests, m.Destination)
+	}
+	// Exclude the old and the new bind mounts: their content lives on the host.
+	excludes := cloneExcludes(append(append([]string(nil), oldMounts...), o.Normalized...), dests)
+	seed := func() error {
+		fmt.Fprintf(out, "Copying workspace and home state from %s...\n", retired)
+		return copyState(dx, retired, o.Name, excludes)
+	}
+	if err := o.create(out, errOut, dx, sig, seed); err != nil {
+		if rerr := dx.Run("rename", retired, o.Name); rerr != nil {
+			output.Warnf(errOut, "the old container is still named %s: %v\n", retired, rerr)
+		}
+		return fmt.Errorf("migration failed: %w", err)
+	}
+	if err := dx.Remove(retired, true); err != nil {
+		output.Warnf(errOut, "unable to remove old container %s: %v\n", retired, err)
+	} else {
+		fmt.Fprintf(out, "Retired the old container for %s\n", o.Name)
+	}
+	return o.attach(in, out, errOut, dx, sig)
+}
@@ -0,0 +1,135 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/output"
+)
+
+// A mount past either limit is large enough that an agent's file search
+// (grep, glob, indexing) crawls. Scanning stops at sizeBudget; whatever
+// was counted by then is reported as a lower bound.
+var (
+	largeMountFiles       = 100_000
+	largeMountBytes int64 = 10 << 30
+	sizeBudget            = 3 * time.Second
+)
+
+// mountSize is what a walk of one mount found.
+type mountSize struct {
+	files int
+	bytes int64
+	// partial is set when the walk stopped early; the counts are minimums.
+	partial bool
+	// top counts files per top-level entry, to suggest what to exclude.
+	top map[string]int
+}
+
+func (s mountSize) large() bool {
+	return s.files > largeMountFiles || s.bytes > largeMountBytes
+}
+
+// measureMount walks dir, skipping .git and what excludes match, until it
+// is done, the mount is known to be large, or the deadline passes.
+func measureMount(dir string, excludes []string, deadline time.Time) mountSize {
+	s := mountSize{top: map[string]int{}}
+	filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == dir {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, p)
+		rel = filepath.ToSlash(rel)
+		if d.Name() == ".git" || excluded(excludes, rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		s.files++
+		first, _, _ := strings.Cut(rel, "/")
+		s.top[first]++
+		if fi, err := d.Info(); err == nil && d.Type().IsRegular() {
+			s.bytes += fi.Size()
+		}
+		if s.files%1000 == 0 && (s.large() || time.Now().After(deadline)) {
+			s.partial = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return s
+}
+
+// excluded reports whether rel matches one of the --exclude globs.
+func excluded(globs []string, rel string) bool {
+	for _, g := range globs {
+		if ok, _ := path.Match(g, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// warnLargeMounts warns about mounts big enough to cripple the agent's file
+// search, naming the subdirs that hold most of the files. It only applies
+// to mounts read in place (bind mounts and --cow copies) and is skipped
+// with --no-preflight.
+func (o Options) warnLargeMounts(errOut io.Writer) {
+	if o.SkipPreflight || o.WorkspaceVolume {
+		return
+	}
+	deadline := time.Now().Add(sizeBudget)
+	for _, abs := range o.Normalized {
+		s := measureMount(abs, o.Excludes, deadline)
+		if !s.large() {
+			continue
+		}
+		count, size := fmt.Sprintf("%d files", s.files), humanBytes(uint64(s.bytes))
+		if s.partial {
+			count, size = "over "+count, "at least "+size
+		}
+		hint := "use --exclude <glob> for what the agent does not need"
+		if big := biggestEntries(s.top, 3); len(big) > 0 {
+			hint = "try --exclude " + strings.Join(big, " --exclude ")
+		}
+		if !o.Cow {
+			hint += ", or --workspace-volume to avoid slow bind-mount I/O"
+		}
+		output.Warnf(errOut, "%s is large (%s, %s); agent file search will be slow. To shrink it, %s\n", abs, count, size, hint)
+	}
+}
+
+// biggestEntries returns up to n top-level entries holding at least a tenth
+// of the files, biggest first.
+func biggestEntries(top map[string]int, n int) []string {
+	total := 0
+	var names []string
+	for k, v := range top {
+		total += v
+		names = append(names, k)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if top[names[i]] != top[names[j]] {
+			return top[names[i]] > top[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	var res []string
+	for _, k := range names {
+		if len(res) == n || top[k]*10 < total {
+			break
+		}
+		res = append(res, k)
+	}
+	return res
+}
@@ -0,0 +1,31 @@
+package run
+
+import (
+	"fmt"
+
+	"github.com/photodialectic/claudex/internal/state"
+)
+
+// WorkspaceLabel records the named workspace a container was started from.
+const WorkspaceLabel = "com.claudex.workspace"
+
+// resolveWorkspace replaces Workdirs with the dirs of the named workspace
+// given by --workspace.
+func (o *Options) resolveWorkspace() error {
+	if o.Workspace == "" {
+		return nil
+	}
+	if len(o.Workdirs) > 0 {
+		return fmt.Errorf("--workspace %s already names its dirs; drop %v", o.Workspace, o.Workdirs)
+	}
+	st, err := state.Load()
+	if err != nil {
+		return err
+	}
+	w, ok := st.Workspace(o.Workspace)
+	if !ok {
+		return fmt.Errorf("no workspace named %s; create it with: claudex workspace create %s DIR...", o.Workspace, o.Workspace)
+	}
+	o.Workdirs = append([]string(nil), w.Dirs...)
+	return nil
+}
@@ -0,0 +1,59 @@
+package run
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/output"
+)
+
+// Nested docker modes for --nested-docker.
+const (
+	NestedNone   = "none"
+	NestedSocket = "socket"
+	NestedDind   = "dind"
+	NestedSysbox = "sysbox"
+)
+
+// NestedLabel records the nested docker mode of a container.
+const NestedLabel = "com.claudex.nested-docker"
+
+// checkNestedDocker validates a --nested-docker mode.
+func checkNestedDocker(mode string) error {
+	switch mode {
+	case "", NestedNone, NestedSocket, NestedDind, NestedSysbox:
+		return nil
+	}
+	return fmt.Errorf("invalid --nested-docker %q (want dind, sysbox, socket or none)", mode)
+}
+
+// carryNestedDocker picks the nested docker mode of a clone or import: the
+// one asked for, else none. The source's mode (from its label) is not kept
+// implicitly, since an archive or container may come from anyone; a warning
+// names the flag that keeps it.
+func carryNestedDocker(labels map[string]string, asked string, errOut io.Writer) (string, error) {
+	if err := checkNestedDocker(asked); err != nil {
+		return "", err
+	}
+	if src := labels[NestedLabel]; asked == "" && src != "" && src != NestedNone {
+		output.Warnf(errOut, "the source used --nested-docker %s; the new container has no nested docker unless you pass --nested-docker %s\n", src, src)
+	}
+	return asked, nil
+}
+
+// startDockerdScript starts the in-container daemon unless it is already up.
+const startDockerdScript = "pgrep -x dockerd >/dev/null || { nohup dockerd >/var/log/dockerd.log 2>&1 & }"
+
+// maybeStartDockerd launches dockerd inside containers created with
+// --nested-docker dind or sysbox. The daemon does not survive a container
+// restart, so this also runs when a stopped container is reused.
+func maybeStartDockerd(mode string, dx dockerx.Docker, name string, out, errOut io.Writer) {
+	if mode != NestedDind && mode != NestedSysbox {
+		return
+	}
+	fmt.Fprintln(out, "Starting in-container Docker daemon...")
+	if err := dx.Exec("-u", "root", name, "sh", "-c", startDockerdScript); err != nil {
+		output.Warnf(errOut, "cannot start dockerd (%s mode): %v\n", mode, err)
+	}
+}
@@ -0,0 +1,25 @@
+package run
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/photodialectic/claudex/internal/config"
+	"github.com/photodialectic/claudex/internal/notify"
+)
+
+// notifyCreated sends the create notification for a new container. Config
+// errors are ignored here: the container already exists and Derive (or the
+// caller) has reported them.
+func notifyCreated(o Options, errOut io.Writer) {
+	cfg, err := config.Load()
+	if err != nil {
+		return
+	}
+	notify.Emit(cfg.Notifications, notify.Event{
+		Kind:      notify.Create,
+		Container: o.Name,
+		Message:   fmt.Sprintf("created %s", o.Name),
+		Fields:    map[string]string{"signature": o.Signature, "slug": o.Slug},
+	}, errOut)
+}
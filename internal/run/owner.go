@@ -0,0 +1,49 @@
+package run
+
+import (
+	"os"
+	"os/user"
+	"strings"
+
+	"github.com/photodialectic/claudex/internal/config"
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/workspace"
+)
+
+// OwnerLabel records who created a container, so that on a shared host
+// list and destroy show each user their own containers only.
+const OwnerLabel = "com.claudex.owner"
+
+// ownerFrom names the current user: config "owner", else $USER, else the
+// OS account, in kebab case so it fits container names. It is "" when
+// none is known.
+func ownerFrom(cfg config.Config) string {
+	name := strings.TrimSpace(cfg.Owner)
+	if name == "" {
+		name = os.Getenv("USER")
+	}
+	if name == "" {
+		if u, err := user.Current(); err == nil {
+			name = u.Username
+		}
+	}
+	if name == "" {
+		return ""
+	}
+	return workspace.ToKebab(name)
+}
+
+// CurrentOwner is the OwnerLabel value of containers the current user
+// creates.
+func CurrentOwner() string {
+	cfg, _ := config.Load()
+	return ownerFrom(cfg)
+}
+
+// OwnedBy reports whether c belongs to owner. Containers from before the
+// label existed, and any container when the owner is unknown, belong to
+// everyone.
+func OwnedBy(c *dockerx.Container, owner string) bool {
+	v := c.Labels[OwnerLabel]
+	return v == "" || owner == "" || v == owner
+}
@@ -0,0 +1,48 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/photodialectic/claudex/internal/config"
+	"github.com/photodialectic/claudex/internal/output"
+	"github.com/photodialectic/claudex/internal/policy"
+)
+
+// applyPolicy sets o.Policy to p and adjusts or refuses o to comply. Every
+// way of creating a container (Derive, Clone, ImportSession) goes through
+// it.
+func (o *Options) applyPolicy(p policy.Policy) error {
+	o.Policy = p
+	if o.NestedDocker == NestedSocket && p.NoDockerSocket {
+		return fmt.Errorf("policy.noDockerSocket forbids --docker-socket")
+	}
+	if o.NestedDocker == NestedDind && (p.RestrictEgress || p.NoDockerSocket) {
+		// --privileged lets the agent flush the firewall and reach the host.
+		return fmt.Errorf("policy.restrictEgress and policy.noDockerSocket forbid --nested-docker dind; use sysbox")
+	}
+	if o.NestedDocker == NestedSocket && o.noSudo() {
+		return fmt.Errorf("--docker-socket is used through sudo, which --no-sudo (or policy.noSudo) disables")
+	}
+	if _, err := p.MemoryBytes(); err != nil {
+		return fmt.Errorf("policy.maxMemory: %w", err)
+	}
+	if p.RestrictEgress {
+		if o.UseHostNetwork {
+			return fmt.Errorf("policy.restrictEgress forbids --host-network")
+		}
+		o.Firewall = true
+	}
+	return nil
+}
+
+// warnIgnoredConfig names the keys of the project file that were dropped
+// (config.Config.Ignored) because only the global config may set them.
+func warnIgnoredConfig(ignored []string, errOut io.Writer) {
+	if len(ignored) == 0 {
+		return
+	}
+	global, _ := config.GlobalPath()
+	output.Warnf(errOut, "ignoring %s in %s; only the global config (%s) may set it\n", strings.Join(ignored, ", "), config.ProjectFile, global)
+}
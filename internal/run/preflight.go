@@ -0,0 +1,181 @@
+package run
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+)
+
+// Free space the engine's data dir needs before create: room to build the
+// image on first run, else for the container's writable layer.
+const (
+	buildHeadroom = 4 << 30
+	runHeadroom   = 1 << 30
+)
+
+// defaultDesktopShares are Docker Desktop's file sharing defaults on macOS,
+// used when its settings file cannot be read.
+var defaultDesktopShares = []string{"/Users", "/Volumes", "/private", "/tmp", "/var/folders"}
+
+// preflight checks what would otherwise surface as an opaque docker run
+// failure: mounts outside Docker Desktop's file sharing, a runtime or
+// privilege the engine refuses, and too little disk. Engines that cannot
+// describe themselves skip it.
+func (o Options) preflight(dx dockerx.Docker, runArgs []string) error {
+	if o.SkipPreflight {
+		return nil
+	}
+	info, err := dx.Info()
+	if err != nil {
+		return nil
+	}
+	var problems []string
+	if runtime.GOOS == "darwin" && info.DockerDesktop() {
+		if home, err := os.UserHomeDir(); err == nil {
+			for _, src := range unsharedMounts(bindSources(runArgs), desktopShares(home)) {
+				problems = append(problems, fmt.Sprintf("%s is not shared with Docker Desktop; add it or a parent under Settings > Resources > File sharing", src))
+			}
+		}
+	}
+	problems = append(problems, o.capabilityProblems(info)...)
+	if free, ok := localFreeSpace(info); ok {
+		need, what := uint64(runHeadroom), "the container"
+		if present, err := dx.ImageExists("claudex"); err == nil && !present {
+			need, what = buildHeadroom, "building the image"
+		}
+		if free < need {
+			problems = append(problems, fmt.Sprintf("only %s free in %s; %s needs about %s (try docker system prune)",
+				humanBytes(free), info.DockerRootDir, what, humanBytes(need)))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("pre-flight checks failed:\n  - %s\n(skip them with --no-preflight)", strings.Join(problems, "\n  - "))
+}
+
+// capabilityProblems reports nested-docker modes the engine will refuse.
+func (o Options) capabilityProblems(info dockerx.EngineInfo) []string {
+	var problems []string
+	switch o.NestedDocker {
+	case NestedSysbox:
+		if len(info.Runtimes) > 0 && !hasRuntime(info.Runtimes, "sysbox-runc") {
+			problems = append(problems, fmt.Sprintf("--nested-docker sysbox needs the sysbox-runc runtime, but the engine only has %s; install sysbox or use --nested-docker dind", strings.Join(info.Runtimes, ", ")))
+		}
+	case NestedDind:
+		if info.SecurityOption("userns") {
+			problems = append(problems, "--nested-docker dind needs --privileged, which an engine with userns-remap refuses; use --nested-docker sysbox or socket")
+		}
+	}
+	return problems
+}
+
+// bindSources returns the absolute host paths in -v and --mount args.
+func bindSources(args []string) []string {
+	var srcs []string
+	for i := 0; i+1 < len(args); i++ {
+		switch args[i] {
+		case "-v", "--volume":
+			if src, _, _ := strings.Cut(args[i+1], ":"); filepath.IsAbs(src) {
+				srcs = append(srcs, src)
+			}
+		case "--mount":
+			for _, f := range strings.Split(args[i+1], ",") {
+				k, v, _ := strings.Cut(f, "=")
+				if (k == "source" || k == "src") && filepath.IsAbs(v) {
+					srcs = append(srcs, v)
+				}
+			}
+		}
+	}
+	return srcs
+}
+
+// desktopShares reads Docker Desktop's file sharing list from its settings
+// (settings-store.json in current releases, settings.json before).
+func desktopShares(home string) []string {
+	dir := filepath.Join(home, "Library", "Group Containers", "group.com.docker")
+	for _, f := range []struct{ file, key string }{
+		{"settings-store.json", "FilesharingDirectories"},
+		{"settings.json", "filesharingDirectories"},
+	} {
+		b, err := os.ReadFile(filepath.Join(dir, f.file))
+		if err != nil {
+			continue
+		}
+		var doc map[string]json.RawMessage
+		var dirs []string
+		if json.Unmarshal(b, &doc) == nil && json.Unmarshal(doc[f.key], &dirs) == nil && len(dirs) > 0 {
+			return dirs
+		}
+	}
+	return defaultDesktopShares
+}
+
+// unsharedMounts returns the sources not under any shared dir. Both sides
+// are compared with symlinks resolved, so /tmp matches /private/tmp.
+func unsharedMounts(sources, shared []string) []string {
+	var roots []string
+	for _, s := range shared {
+		roots = append(roots, s)
+		if real, err := filepath.EvalSymlinks(s); err == nil && real != s {
+			roots = append(roots, real)
+		}
+	}
+	var res []string
+	seen := map[string]bool{}
+	for _, src := range sources {
+		path := src
+		if real, err := filepath.EvalSymlinks(src); err == nil {
+			path = real
+		}
+		ok := false
+		for _, r := range roots {
+			if path == r || strings.HasPrefix(path, strings.TrimSuffix(r, "/")+"/") {
+				ok = true
+				break
+			}
+		}
+		if !ok && !seen[src] {
+			seen[src] = true
+			res = append(res, src)
+		}
+	}
+	return res
+}
+
+// localFreeSpace is the free space in the engine's data dir when that dir
+// is on this machine: a native Linux engine reached over its unix socket.
+func localFreeSpace(info dockerx.EngineInfo) (uint64, bool) {
+	if runtime.GOOS != "linux" || info.DockerDesktop() || info.DockerRootDir == "" {
+		return 0, false
+	}
+	if host := os.Getenv("DOCKER_HOST"); host != "" && !strings.HasPrefix(host, "unix://") {
+		return 0, false
+	}
+	return freeSpace(info.DockerRootDir)
+}
+
+func hasRuntime(runtimes []string, name string) bool {
+	for _, v := range runtimes {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+func humanBytes(n uint64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1fGB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.0fMB", float64(n)/(1<<20))
+	}
+	return fmt.Sprintf("%dkB", n>>10)
+}
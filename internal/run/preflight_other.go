@@ -0,0 +1,5 @@
+//go:build !linux && !darwin
+
+package run
+
+func freeSpace(dir string) (uint64, bool) { return 0, false }
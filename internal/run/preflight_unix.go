@@ -0,0 +1,15 @@
+//go:build linux || darwin
+
+package run
+
+import "syscall"
+
+// freeSpace is the space available to unprivileged users on dir's
+// filesystem.
+func freeSpace(dir string) (uint64, bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, false
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), true
+}
@@ -0,0 +1,44 @@
+package run
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/photodialectic/claudex/internal/containers"
+	"github.com/photodialectic/claudex/internal/dockerx"
+)
+
+// ProtectedLabel marks containers that destroy and --replace leave alone
+// unless told otherwise, for sessions holding work nobody exported yet.
+const ProtectedLabel = "com.claudex.protected"
+
+// Protected reports whether c carries ProtectedLabel.
+func Protected(c *dockerx.Container) bool {
+	return c != nil && c.Labels[ProtectedLabel] == "true"
+}
+
+// SetProtected recreates the claudex container name with ProtectedLabel set
+// (or removed when on is false). Labels are fixed at creation, so this
+// commits and recreates like migrate. It reports whether anything changed.
+func SetProtected(name string, on bool, out, errOut io.Writer, dx dockerx.Docker) (bool, error) {
+	info, err := dx.Inspect(name)
+	if err != nil {
+		return false, fmt.Errorf("container %s does not exist", name)
+	}
+	if !containers.IsClaudex(&info) {
+		return false, fmt.Errorf("%s is not a claudex container", name)
+	}
+	if Protected(&info) == on {
+		return false, nil
+	}
+	labels := make(map[string]string, len(info.Labels)+1)
+	for k, v := range info.Labels {
+		labels[k] = v
+	}
+	if on {
+		labels[ProtectedLabel] = "true"
+	} else {
+		delete(labels, ProtectedLabel)
+	}
+	return true, recreate(info, name, "claudex-relabeled:"+name, labels, out, errOut, dx)
+}
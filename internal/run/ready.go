@@ -0,0 +1,87 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+)
+
+// ReadyLabel marks containers whose command writes ReadyMarker once the
+// image's entrypoint hands over to it. Containers without it count as ready
+// as soon as they run.
+const ReadyLabel = "com.claudex.ready"
+
+// ReadyMarker holds PID 1's start time, so a marker left over from an
+// earlier start of the same container never counts.
+const ReadyMarker = "/tmp/claudex-ready"
+
+// keepaliveCmd is the container command: the image's claudex-agent
+// supervisor, which marks readiness itself, or in images that predate it a
+// marker followed by idling.
+var keepaliveCmd = []string{"sh", "-c", "command -v claudex-agent >/dev/null 2>&1 && exec claudex-agent; cut -d' ' -f22 /proc/1/stat > " + ReadyMarker + "; exec tail -f /dev/null"}
+
+const readyProbe = `[ "$(cat ` + ReadyMarker + ` 2>/dev/null)" = "$(cut -d' ' -f22 /proc/1/stat)" ]`
+
+// StartWait is how waitReady polls a container that was just started.
+// CLAUDEX_START_TIMEOUT (e.g. 30s) stretches its Timeout on slow hosts.
+var StartWait = dockerx.Backoff{Initial: 100 * time.Millisecond, Max: time.Second, Timeout: 5 * time.Second}
+
+var (
+	errExited    = errors.New("exited during startup")
+	errCrashLoop = errors.New("is crash-looping")
+	errSlowStart = errors.New("was not ready")
+	errNotReady  = errors.New("not ready")
+)
+
+// waitReady waits until name runs, its healthcheck (if any) has left
+// "starting" and its ready marker is current. A container that exits or keeps
+// restarting fails with errExited or errCrashLoop; one that runs but never
+// becomes ready fails with errSlowStart. Canceling ctx ends the wait.
+func waitReady(ctx context.Context, dx dockerx.Docker, name string) error {
+	b := StartWait
+	if d, err := time.ParseDuration(os.Getenv("CLAUDEX_START_TIMEOUT")); err == nil && d > 0 {
+		b.Timeout = d
+	}
+	start := time.Now()
+	var info dockerx.Container
+	restarts := -1
+	_, err := b.Retry(ctx, func() error {
+		c, err := dx.Inspect(name)
+		if err != nil {
+			return err
+		}
+		info = c
+		if restarts < 0 {
+			restarts = c.RestartCount
+		}
+		switch {
+		case c.Status != "running" && c.ExitCode != 0 && c.RestartCount == restarts:
+			return errExited
+		case c.Status != "running", c.Health == "starting":
+			return errNotReady
+		case c.Labels[ReadyLabel] != "":
+			if _, err := dx.ExecOutput(name, []string{"sh", "-c", readyProbe}); err != nil {
+				return errNotReady
+			}
+		}
+		return nil
+	}, func(err error) bool { return err != errExited })
+	waited := time.Since(start).Round(100 * time.Millisecond)
+	switch {
+	case err == nil:
+		return nil
+	case ctx.Err() != nil:
+		return fmt.Errorf("waiting for container %s: %w", name, ctx.Err())
+	case restarts >= 0 && info.RestartCount > restarts:
+		return fmt.Errorf("container %s %w: restarted %d times, last exit code %d", name, errCrashLoop, info.RestartCount-restarts, info.ExitCode)
+	case err == errExited || (err == errNotReady && info.Status != "" && info.Status != "running"):
+		return fmt.Errorf("container %s %w with code %d", name, errExited, info.ExitCode)
+	case err == errNotReady:
+		return fmt.Errorf("container %s %w after %s; its entrypoint may still be setting up (set CLAUDEX_START_TIMEOUT to wait longer)", name, errSlowStart, waited)
+	}
+	return fmt.Errorf("container %s did not start: %w", name, err)
+}
@@ -0,0 +1,164 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/containers"
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/output"
+)
+
+// recreate replaces the container described by info with one named name
+// that carries labels. Labels cannot be changed on an existing container, so
+// it is committed to image and recreated from it with the same mounts,
+// network, capabilities and tmpfs. When name is info's own name the original
+// is renamed out of the way and removed once the new container exists; on
+// failure it gets its name back.
+func recreate(info dockerx.Container, name, image string, labels map[string]string, out, errOut io.Writer, dx dockerx.Docker) error {
+	src := info.Name
+	fmt.Fprintf(out, "Committing %s to %s...\n", src, image)
+	if err := dx.Run("commit", src, image); err != nil {
+		return fmt.Errorf("docker commit failed: %w", err)
+	}
+	retired := ""
+	if name == src {
+		retired = fmt.Sprintf("%s-recreating-%d", src, time.Now().Unix())
+		if err := dx.Run("rename", src, retired); err != nil {
+			return fmt.Errorf("cannot rename %s: %w", src, err)
+		}
+	}
+	fmt.Fprintf(out, "Recreating %s with claudex labels...\n", name)
+	if err := dx.Run(recreateArgs(info, name, image, labels)...); err != nil {
+		// Roll back even when Ctrl-C is what stopped the run.
+		cleanup := dx.WithContext(context.Background())
+		_ = cleanup.Remove(name, true)
+		if retired != "" {
+			if rerr := cleanup.Run("rename", retired, src); rerr != nil {
+				output.Warnf(errOut, "the original container is still named %s: %v\n", retired, rerr)
+			}
+		}
+		return fmt.Errorf("recreating %s failed: %w", name, err)
+	}
+	if retired != "" {
+		if err := dx.Remove(retired, true); err != nil {
+			output.Warnf(errOut, "unable to remove original container %s: %v\n", retired, err)
+		}
+	}
+	if info.Status == "running" {
+		maybeForwardPorts(parsePorts(labels[PublishedPortsLabel]), dx, name, errOut)
+	}
+	return nil
+}
+
+// recreateArgs rebuilds info's host configuration around image. Env,
+// command, user and working directory travel with the committed image.
+func recreateArgs(info dockerx.Container, name, image string, labels map[string]string) []string {
+	args := []string{"create"}
+	if info.Status == "running" {
+		args = []string{"run", "-d"}
+	}
+	args = append(args, "--name", name)
+	for _, m := range info.Mounts {
+		var spec string
+		switch m.Type {
+		case "tmpfs":
+			continue
+		case "volume":
+			spec = m.Name + ":" + m.Destination
+		default:
+			spec = m.Source + ":" + m.Destination
+		}
+		if !m.RW {
+			spec += ":ro"
+		}
+		args = append(args, "-v", spec)
+	}
+	for _, p := range sortedKeys(info.Tmpfs) {
+		if opts := info.Tmpfs[p]; opts != "" {
+			p += ":" + opts
+		}
+		args = append(args, "--tmpfs", p)
+	}
+	if info.NetworkMode != "" && info.NetworkMode != "default" {
+		args = append(args, "--network", info.NetworkMode)
+	}
+	for _, p := range parsePorts(labels[PublishedPortsLabel]) {
+		args = append(args, "-p", fmt.Sprintf("127.0.0.1:%d:%d", p, p))
+	}
+	for _, c := range info.CapAdd {
+		args = append(args, "--cap-add", c)
+	}
+	// no-new-privileges is what --no-sudo sets; dropping it would hand
+	// sudo back.
+	for _, o := range info.SecurityOpt {
+		args = append(args, "--security-opt", o)
+	}
+	if info.Privileged {
+		args = append(args, "--privileged")
+	}
+	if info.Runtime != "" && info.Runtime != "runc" {
+		args = append(args, "--runtime", info.Runtime)
+	}
+	if info.Memory > 0 {
+		args = append(args, "--memory", fmt.Sprint(info.Memory))
+	}
+	for _, k := range sortedKeys(labels) {
+		args = append(args, "--label", k+"="+labels[k])
+	}
+	return append(args, image)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// UpgradeLabels recreates the claudex container name with its labels
+// rewritten to the current schema. It does nothing for current containers.
+func UpgradeLabels(name string, out, errOut io.Writer, dx dockerx.Docker) error {
+	info, err := dx.Inspect(name)
+	if err != nil {
+		return fmt.Errorf("container %s does not exist", name)
+	}
+	if !containers.IsClaudex(&info) {
+		return fmt.Errorf("%s is not a claudex container", name)
+	}
+	if containers.LabelSchema(&info) == containers.Schema {
+		return nil
+	}
+	labels, err := containers.UpgradeLabels(&info)
+	if err != nil {
+		return err
+	}
+	return recreate(info, name, "claudex-migrated:"+name, labels, out, errOut, dx)
+}
+
+// SnapshotImages lists the images claudex may have committed for the
+// container named name that runs image: its adopt, migrate and protect
+// commits, and image itself when it is one of those or an imported
+// session's image.
+func SnapshotImages(name, image string) []string {
+	prefixes := []string{"claudex-adopted:", "claudex-migrated:", "claudex-relabeled:"}
+	var refs []string
+	own := false
+	for _, p := range prefixes {
+		refs = append(refs, p+name)
+		own = own || image == p+name
+	}
+	for _, p := range append(prefixes, "claudex-session-") {
+		if !own && strings.HasPrefix(image, p) {
+			refs = append(refs, image)
+			break
+		}
+	}
+	return refs
+}
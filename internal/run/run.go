@@ -1,29 +1,145 @@
 package run
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/photodialectic/claudex/internal/buildctx"
+	"github.com/photodialectic/claudex/internal/config"
 	"github.com/photodialectic/claudex/internal/containers"
 	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/firewall"
+	"github.com/photodialectic/claudex/internal/output"
+	"github.com/photodialectic/claudex/internal/policy"
+	"github.com/photodialectic/claudex/internal/state"
+	"github.com/photodialectic/claudex/internal/ui"
 	"github.com/photodialectic/claudex/internal/version"
 	"github.com/photodialectic/claudex/internal/workspace"
 )
 
 type Options struct {
 	UseHostNetwork bool
+	// FallbackPorts replace --host-network where it does not work (see
+	// hostNetworkFallback); PublishPorts are the ports actually published.
+	FallbackPorts  []int
+	PublishPorts   []int
 	NameOverride   string
+	SlugOverride   string
 	ForceReplace   bool
 	AlwaysParallel bool
 	StrictMounts   bool
 	SkipGit        bool
 	Firewall       bool
-	Workdirs       []string
+	FirewallDeps   bool
+	Audit          bool
+	// Cow copies the workspace dirs into the container instead of
+	// bind-mounting them, so the host copy is never modified.
+	Cow bool
+	// WorkspaceVolume keeps /workspace in a named volume seeded (and later
+	// synced) from the dirs with rsync, avoiding slow bind-mount I/O.
+	WorkspaceVolume bool
+	// AutoCommit checkpoints /workspace on this interval (0 disables).
+	AutoCommit time.Duration
+	// Index builds the workspace file index after creation (see
+	// package index).
+	Index bool
+	// TTL stops a new container this long after creation; with TTLDestroy
+	// it is also removed (see ttl.go). Expires is the deadline (set by
+	// create).
+	TTL        time.Duration
+	TTLDestroy bool
+	Expires    time.Time
+	// Owner is the user new containers are labeled with (see owner.go).
+	Owner string
+	// NoSudo runs the container with no-new-privileges, so sudo cannot
+	// gain root in it (policy.noSudo forces it).
+	NoSudo bool
+	// NestedDocker selects how the agent gets Docker: "" or "none", "socket"
+	// (host daemon), "dind" (privileged, own daemon) or "sysbox" (own daemon
+	// under the sysbox runtime).
+	NestedDocker string
+	// HostGit is --host-git (keep, empty or copy) for mounted repositories.
+	HostGit string
+	// HostGitMounts is the resolved non-keep mode per mount (set by Derive).
+	HostGitMounts map[string]string
+	// hostGitFrom names the container whose private .git copies a clone
+	// starts from.
+	hostGitFrom string
+	// Excludes are --exclude globs, relative to each mounted dir, whose
+	// matches are hidden from the container. They are part of the
+	// signature.
+	Excludes []string
+	// Consistency is --mount-consistency for workspace bind mounts.
+	Consistency string
+	// MountConsistency is the resolved mode per mount (set by Derive).
+	MountConsistency map[string]string
+	// Detach creates or reuses the container without attaching a shell.
+	Detach bool
+	// Verbose prints how long each step takes.
+	Verbose       bool
+	timings       *timings
+	lock          *nameLock
+	KeepOnFailure bool
+	// SkipPreflight skips the host checks made before creating a container.
+	SkipPreflight bool
+	// Pick lists every container with the workspace's signature and asks
+	// which to use, even when there is only one.
+	Pick bool
+	// Migrate, on a --strict-mounts mismatch, moves the container's state
+	// into a new one with the requested mounts instead of failing.
+	Migrate       bool
+	SignatureMode string
+	// RootMode is how a dir-less invocation picks its mount (workspace.RootCwd
+	// or workspace.RootGit).
+	RootMode string
+	Workdirs []string
+	// Workspace names a saved set of dirs (`claudex workspace create`) used
+	// instead of Workdirs; it also becomes the default slug.
+	Workspace string
+
+	// Dev mounts a host claudex binary and build context for dogfooding.
+	Dev             bool
+	DevBinary       string
+	BuildContextDir string
+	// devBinaryIsSelf is set by deriveDev when DevBinary defaulted to the
+	// running claudex, which is only usable in the container on linux.
+	devBinaryIsSelf bool
+
+	// HistoryDir is the host dir mounted for shell history (set by Derive).
+	HistoryDir string
+	// ignoredConfig are project config keys dropped by config.Load (set by
+	// Derive); run warns about them.
+	ignoredConfig []string
+	// Sign has git sign commits with a per-workspace SSH key kept in
+	// SigningDir (set by Derive); see signing.go.
+	Sign       bool
+	SigningDir string
+
+	// Shell is the interactive shell (bash, zsh or fish); empty means the
+	// config default, then the container's label, then bash.
+	Shell string
+	// AttachEnv is added to the attached shell only, never the container.
+	AttachEnv []string
+	// DotfilesDir is the host dir copied into /home/node on creation.
+	DotfilesDir string
+
+	// HomeMounts are extra home-dir mounts from config.
+	HomeMounts []config.HomeMount
+
+	// Policy restrictions from config, applied by BuildRunArgs.
+	Policy policy.Policy
+
+	// Image overrides the image to run (default "claudex"), e.g. an imported session.
+	Image string
 
 	// Derived
 	Normalized []string
@@ -43,18 +159,147 @@ func ParseArgs(args []string) (Options, error) {
 			o.SkipGit = true
 		case "--firewall":
 			o.Firewall = true
+		case "--audit":
+			o.Audit = true
+		case "--index":
+			o.Index = true
+		case "--ttl":
+			if i+1 >= len(args) {
+				return o, fmt.Errorf("--ttl requires a duration")
+			}
+			d, err := parseTTL(args[i+1])
+			if err != nil {
+				return o, err
+			}
+			o.TTL = d
+			i++
+		case "--ttl-destroy":
+			o.TTLDestroy = true
+		case "--sign":
+			o.Sign = true
+		case "--no-sudo":
+			o.NoSudo = true
+		case "--cow":
+			o.Cow = true
+		case "--workspace-volume":
+			o.WorkspaceVolume = true
+		case "--host-git":
+			if i+1 >= len(args) {
+				return o, fmt.Errorf("--host-git requires keep, empty or copy")
+			}
+			o.HostGit = args[i+1]
+			i++
+		case "--exclude":
+			if i+1 >= len(args) {
+				return o, fmt.Errorf("--exclude requires a glob")
+			}
+			o.Excludes = append(o.Excludes, args[i+1])
+			i++
+		case "--mount-consistency":
+			if i+1 >= len(args) {
+				return o, fmt.Errorf("--mount-consistency requires consistent, cached or delegated")
+			}
+			o.Consistency = args[i+1]
+			i++
+		case "--shell":
+			if i+1 >= len(args) {
+				return o, fmt.Errorf("--shell requires bash, zsh or fish")
+			}
+			o.Shell = args[i+1]
+			i++
+		case "--attach-env":
+			if i+1 >= len(args) {
+				return o, fmt.Errorf("--attach-env requires KEY=VALUE or KEY")
+			}
+			if err := ValidateEnv(args[i+1 : i+2]); err != nil {
+				return o, err
+			}
+			o.AttachEnv = append(o.AttachEnv, args[i+1])
+			i++
+		case "--auto-commit":
+			if i+1 >= len(args) {
+				return o, fmt.Errorf("--auto-commit requires an interval like 10m")
+			}
+			d, err := parseAutoCommit(args[i+1])
+			if err != nil {
+				return o, err
+			}
+			o.AutoCommit = d
+			i++
+		case "--docker-socket":
+			o.NestedDocker = NestedSocket
+		case "--nested-docker":
+			if i+1 >= len(args) {
+				return o, fmt.Errorf("--nested-docker requires dind, sysbox, socket or none")
+			}
+			o.NestedDocker = args[i+1]
+			i++
+		case "--firewall-deps":
+			o.Firewall = true
+			o.FirewallDeps = true
 		case "--name":
 			if i+1 >= len(args) {
 				return o, fmt.Errorf("--name requires a value")
 			}
 			o.NameOverride = args[i+1]
 			i++
+		case "--workspace":
+			if i+1 >= len(args) {
+				return o, fmt.Errorf("--workspace requires a name")
+			}
+			o.Workspace = args[i+1]
+			i++
+		case "--slug":
+			if i+1 >= len(args) {
+				return o, fmt.Errorf("--slug requires a value")
+			}
+			o.SlugOverride = args[i+1]
+			i++
 		case "--replace":
 			o.ForceReplace = true
+		case "--detach", "-d":
+			o.Detach = true
+		case "--verbose":
+			o.Verbose = true
 		case "--parallel":
 			o.AlwaysParallel = true
+		case "--pick":
+			o.Pick = true
 		case "--strict-mounts":
 			o.StrictMounts = true
+		case "--migrate":
+			o.StrictMounts = true
+			o.Migrate = true
+		case "--keep-on-failure":
+			o.KeepOnFailure = true
+		case "--no-preflight":
+			o.SkipPreflight = true
+		case "--signature-mode":
+			if i+1 >= len(args) {
+				return o, fmt.Errorf("--signature-mode requires a value")
+			}
+			o.SignatureMode = args[i+1]
+			i++
+		case "--root-mode":
+			if i+1 >= len(args) {
+				return o, fmt.Errorf("--root-mode requires git or cwd")
+			}
+			o.RootMode = args[i+1]
+			i++
+		case "--dev":
+			o.Dev = true
+		case "--dev-binary":
+			if i+1 >= len(args) {
+				return o, fmt.Errorf("--dev-binary requires a value")
+			}
+			o.DevBinary = args[i+1]
+			i++
+		case "--build-context-dir":
+			if i+1 >= len(args) {
+				return o, fmt.Errorf("--build-context-dir requires a value")
+			}
+			o.BuildContextDir = args[i+1]
+			i++
 		default:
 			o.Workdirs = append(o.Workdirs, a)
 		}
@@ -64,14 +309,122 @@ func ParseArgs(args []string) (Options, error) {
 
 // Derive fills in normalized dirs and name components.
 func (o *Options) Derive() error {
-	norm, err := workspace.NormalizeDirs(workspace.DefaultDirs(o.Workdirs))
+	if err := o.resolveWorkspace(); err != nil {
+		return err
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if o.RootMode == "" {
+		o.RootMode = os.Getenv("CLAUDEX_ROOT_MODE")
+	}
+	if o.RootMode == "" {
+		o.RootMode = cfg.RootMode
+	}
+	dirs, err := workspace.DefaultDirsMode(o.Workdirs, o.RootMode)
+	if err != nil {
+		return err
+	}
+	norm, err := workspace.NormalizeDirs(dirs)
 	if err != nil {
 		return err
 	}
 	o.Normalized = norm
-	o.Signature = workspace.DeriveSignature(norm)
-	o.Slug = workspace.DeriveSlug(norm)
-	name := workspace.DeriveName(o.Slug, o.Signature)
+	if o.SignatureMode == "" {
+		o.SignatureMode = signatureMode(cfg)
+	}
+	// pathAliases give teammates' differently located checkouts one
+	// logical path, and so one v1 signature and slug.
+	if err := workspace.ValidateAliases(cfg.PathAliases); err != nil {
+		return err
+	}
+	logical := workspace.Logical(norm, cfg.PathAliases)
+	sig, err := signatureOf(norm, logical, o.SignatureMode)
+	if err != nil {
+		return err
+	}
+	if o.Excludes, err = validateExcludes(o.Excludes); err != nil {
+		return err
+	}
+	sig = workspace.WithExcludes(sig, o.Excludes)
+	o.Signature = sig
+	if cfg.Audit {
+		o.Audit = true
+	}
+	if cfg.Index {
+		o.Index = true
+	}
+	if o.HistoryDir, err = HistoryDir(sig); err != nil {
+		return err
+	}
+	if o.Sign || cfg.Sign {
+		if o.SigningDir, err = SigningDir(sig); err != nil {
+			return err
+		}
+	}
+	if o.Shell == "" {
+		o.Shell = cfg.Shell
+	}
+	if err := validateShell(o.Shell); err != nil {
+		return err
+	}
+	if o.DotfilesDir, err = resolveDotfiles(cfg.Dotfiles); err != nil {
+		return err
+	}
+	if err := validateHomeMounts(cfg.HomeMounts); err != nil {
+		return err
+	}
+	o.HomeMounts = cfg.HomeMounts
+	o.FallbackPorts = cfg.HostNetworkPorts
+	if o.HostGitMounts, err = resolveHostGit(norm, o.HostGit, cfg.HostGit); err != nil {
+		return err
+	}
+	if o.MountConsistency, err = resolveConsistency(norm, o.Consistency, cfg.MountConsistency); err != nil {
+		return err
+	}
+	if o.TTLDestroy && o.TTL == 0 {
+		return fmt.Errorf("--ttl-destroy needs --ttl")
+	}
+	if o.Cow && o.WorkspaceVolume {
+		return fmt.Errorf("--cow and --workspace-volume are alternatives; pick one")
+	}
+	if len(o.Excludes) > 0 && (o.Cow || o.WorkspaceVolume) {
+		return fmt.Errorf("--exclude hides paths of mounted dirs; it cannot be combined with --cow or --workspace-volume")
+	}
+	if o.Cow || o.WorkspaceVolume {
+		// Copied workspaces carry their own .git; nothing to shadow.
+		o.HostGitMounts = nil
+	}
+	if o.AutoCommit == 0 && cfg.AutoCommit != "" {
+		d, err := parseAutoCommit(cfg.AutoCommit)
+		if err != nil {
+			return fmt.Errorf("autoCommit: %w", err)
+		}
+		o.AutoCommit = d
+	}
+	if err := checkNestedDocker(o.NestedDocker); err != nil {
+		return err
+	}
+	if err := o.applyPolicy(cfg.Policy); err != nil {
+		return err
+	}
+	o.ignoredConfig = cfg.Ignored
+	if cfg.Firewall.AllowDeps && o.Firewall {
+		o.FirewallDeps = true
+	}
+	o.Owner = ownerFrom(cfg)
+	if o.SlugOverride != "" {
+		o.Slug = workspace.ToKebab(o.SlugOverride)
+	} else if o.Workspace != "" {
+		o.Slug = workspace.ToKebab(o.Workspace)
+	} else {
+		o.Slug = workspace.DeriveSlugMax(logical, cfg.Naming.MaxSlugLen)
+	}
+	name, err := workspace.DeriveName(o.Slug, o.Signature, o.Owner, cfg.Naming)
+	if err != nil {
+		return err
+	}
 	if o.NameOverride != "" {
 		name = o.NameOverride
 	}
@@ -79,17 +432,80 @@ func (o *Options) Derive() error {
 		name = fmt.Sprintf("%s-%d", name, time.Now().Unix())
 	}
 	o.Name = name
+	if o.Dev {
+		if err := o.deriveDev(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// signatureMode is the signature mode used unless --signature-mode is given.
+func signatureMode(cfg config.Config) string {
+	if m := os.Getenv("CLAUDEX_SIGNATURE_MODE"); m != "" {
+		return m
+	}
+	return cfg.SignatureMode
+}
+
+// signatureOf derives the signature of the dirs norm, whose logical form
+// (under pathAliases) is logical: v1 hashes the logical paths, v2 the
+// repositories' identities.
+func signatureOf(norm, logical []string, mode string) (string, error) {
+	if mode == workspace.SignatureV2 {
+		return workspace.DeriveSignatureMode(norm, mode)
+	}
+	return workspace.DeriveSignatureMode(logical, mode)
+}
+
+// DevLabel marks containers created by `claudex dev`, which mount the host
+// binary and build context.
+const DevLabel = "com.claudex.dev"
+
+// deriveDev resolves the binary and build context mounted by `claudex dev`.
+func (o *Options) deriveDev() error {
+	if o.DevBinary == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("cannot locate claudex binary: %w", err)
+		}
+		o.DevBinary = exe
+		o.devBinaryIsSelf = true
+	}
+	abs, err := filepath.Abs(o.DevBinary)
+	if err != nil {
+		return fmt.Errorf("invalid --dev-binary %s: %w", o.DevBinary, err)
+	}
+	if fi, err := os.Stat(abs); err != nil || fi.IsDir() {
+		return fmt.Errorf("dev binary %s does not exist", abs)
+	}
+	o.DevBinary = abs
+	if o.BuildContextDir == "" {
+		// Default to the checkout's build context when run from the repo root.
+		if fi, err := os.Stat(filepath.Join("internal", "buildctx", "Dockerfile")); err == nil && !fi.IsDir() {
+			o.BuildContextDir = filepath.Join("internal", "buildctx")
+		}
+	}
+	if o.BuildContextDir != "" {
+		abs, err := filepath.Abs(o.BuildContextDir)
+		if err != nil {
+			return fmt.Errorf("invalid --build-context-dir %s: %w", o.BuildContextDir, err)
+		}
+		o.BuildContextDir = abs
+	}
+	return nil
+}
+
+// PassthroughEnv are host variables (API keys) passed to new containers by
+// name when set.
+var PassthroughEnv = []string{"OPENAI_API_KEY", "AI_API_MK", "GEMINI_API_KEY", "GITHUB_MCP_PAT", "DO_MODEL_ACCESS_KEY"}
+
 // BuildRunArgs builds docker run args array based on options and env.
 func (o Options) BuildRunArgs() ([]string, error) {
 	var args []string
 	args = append(args, "run", "--name", o.Name, "-d")
 
-	var envs []string
-	envs = append(envs, "OPENAI_API_KEY", "AI_API_MK", "GEMINI_API_KEY", "GITHUB_MCP_PAT", "DO_MODEL_ACCESS_KEY")
-	for _, e := range envs {
+	for _, e := range PassthroughEnv {
 		if os.Getenv(e) != "" {
 			args = append(args, "-e", e)
 		}
@@ -97,13 +513,44 @@ func (o Options) BuildRunArgs() ([]string, error) {
 
 	args = append(args, "--cap-add", "NET_ADMIN", "--cap-add", "NET_RAW")
 
+	// Command audit: bash sources the hook for non-interactive shells via BASH_ENV
+	if o.Audit {
+		args = append(args, "-e", "CLAUDEX_AUDIT=1", "-e", "BASH_ENV="+AuditHook, "--label", "com.claudex.audit=true")
+	}
+
+	if o.AutoCommit > 0 {
+		args = append(args, "--label", AutoCommitLabel+"="+o.AutoCommit.String())
+	}
+
+	// Health check so reuse can detect a broken environment before attaching
+	args = append(args, "--health-cmd", healthCmd, "--health-interval", "30s", "--health-timeout", "5s", "--health-retries", "3")
+
 	if o.UseHostNetwork {
 		args = append(args, "--network", "host")
 	}
+	args = append(args, publishArgs(o.PublishPorts)...)
+
+	if o.Policy.MaxMemory != "" {
+		args = append(args, "--memory", o.Policy.MaxMemory)
+	}
+	if o.noSudo() {
+		args = append(args, "--security-opt", policy.NoNewPrivileges)
+	}
 
-	// docker sock mount if present
-	if _, err := os.Stat("/var/run/docker.sock"); err == nil {
-		args = append(args, "-v", "/var/run/docker.sock:/var/run/docker.sock")
+	// In-container Docker only on request. The host socket is root-equivalent
+	// host access; dind and sysbox run an isolated daemon inside the container.
+	switch o.NestedDocker {
+	case NestedSocket:
+		if !o.Policy.NoDockerSocket {
+			args = append(args, "-v", policy.DockerSocket+":"+policy.DockerSocket, "--label", "com.claudex.docker-socket=true")
+		}
+	case NestedDind:
+		args = append(args, "--privileged")
+	case NestedSysbox:
+		args = append(args, "--runtime", "sysbox-runc")
+	}
+	if o.NestedDocker != "" && o.NestedDocker != NestedNone {
+		args = append(args, "--label", NestedLabel+"="+o.NestedDocker)
 	}
 	// config dirs
 	home, err := os.UserHomeDir()
@@ -137,21 +584,92 @@ func (o Options) BuildRunArgs() ([]string, error) {
 		args = append(args, "-v", fmt.Sprintf("%s:/home/node/.local/share/opencode", opencodeStorage))
 	}
 
-	// workspace mounts
-	for _, abs := range o.Normalized {
-		base := filepath.Base(abs)
-		args = append(args, "-v", fmt.Sprintf("%s:/workspace/%s", abs, base))
+	args = append(args, o.historyArgs()...)
+	args = append(args, o.signingArgs()...)
+	if o.DotfilesDir != "" {
+		args = append(args, "-v", o.DotfilesDir+":"+DotfilesMount+":ro")
+	}
+	if o.Shell != "" {
+		args = append(args, "--label", ShellLabel+"="+o.Shell)
+	}
+
+	// Extra home-dir mounts from config (homeMounts)
+	homeArgs, err := homeMountArgs(home, o.HomeMounts)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, homeArgs...)
+
+	// workspace mounts; --cow copies the dirs in after creation instead
+	switch {
+	case o.Cow:
+		args = append(args, "--label", CowLabel+"=true")
+	case o.WorkspaceVolume:
+		vol := VolumeName(o.Signature)
+		args = append(args, "-v", vol+":/workspace", "--label", VolumeLabel+"="+vol)
+	default:
+		for _, abs := range o.Normalized {
+			base := filepath.Base(abs)
+			mount := fmt.Sprintf("%s:/workspace/%s", abs, base)
+			var opts []string
+			if o.Policy.ReadOnlyMounts {
+				opts = append(opts, "ro")
+			}
+			if c := o.MountConsistency[abs]; c != "" {
+				opts = append(opts, c)
+			}
+			if len(opts) > 0 {
+				mount += ":" + strings.Join(opts, ",")
+			}
+			args = append(args, "-v", mount)
+		}
+		// Shadow host .git dirs after their mounts so the nested mounts win
+		gitArgs, err := o.hostGitArgs()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, gitArgs...)
+		exArgs, err := o.excludeArgs()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, exArgs...)
+	}
+	// dev mode: host binary and build context (read-only)
+	if o.Dev {
+		args = append(args, "-v", fmt.Sprintf("%s:/usr/local/bin/claudex:ro", o.DevBinary))
+		if o.BuildContextDir != "" {
+			args = append(args, "-v", fmt.Sprintf("%s:/opt/claudex/buildctx:ro", o.BuildContextDir))
+		}
 	}
 	// labels
 	b, _ := json.Marshal(o.Normalized)
 	mountsLabel := string(b)
-	args = append(args, "--label", "com.claudex.signature="+o.Signature, "--label", "com.claudex.version="+version.Version, "--label", "com.claudex.slug="+o.Slug, "--label", "com.claudex.mounts="+mountsLabel)
-	// Image and a keepalive command to prevent immediate exit
-	// Use a very portable command
-	args = append(args, "claudex", "tail", "-f", "/dev/null")
+	args = append(args, "--label", "com.claudex.signature="+o.Signature, "--label", "com.claudex.version="+version.Version, "--label", "com.claudex.slug="+o.Slug, "--label", "com.claudex.mounts="+mountsLabel, "--label", containers.SchemaLabel+"="+strconv.Itoa(containers.Schema))
+	if o.Dev {
+		args = append(args, "--label", DevLabel+"=true")
+	}
+	if o.Workspace != "" {
+		args = append(args, "--label", WorkspaceLabel+"="+o.Workspace)
+	}
+	if o.Owner != "" {
+		args = append(args, "--label", OwnerLabel+"="+o.Owner)
+	}
+	args = append(args, o.ttlArgs()...)
+	// Image and a keepalive command that marks readiness (see waitReady)
+	args = append(args, "--label", ReadyLabel+"="+ReadyMarker, o.image())
+	args = append(args, keepaliveCmd...)
 	return args, nil
 }
 
+// image is the image to run (default "claudex").
+func (o Options) image() string {
+	if o.Image == "" {
+		return "claudex"
+	}
+	return o.Image
+}
+
 // Run orchestrates the container lifecycle (ensure image, reuse or create, attach shell).
 func Run(args []string, in io.Reader, out, errOut io.Writer, dx dockerx.Docker) error {
 	o, err := ParseArgs(args)
@@ -161,53 +679,176 @@ func Run(args []string, in io.Reader, out, errOut io.Writer, dx dockerx.Docker)
 	if err := o.Derive(); err != nil {
 		return err
 	}
-	// Ensure image exists, build if missing using embedded context
-	fmt.Fprintln(out, "Ensuring image 'claudex' exists...")
-	present, err := dx.ImageExists("claudex")
+	if o.Detach {
+		// Progress goes to stderr so stdout is just the container name,
+		// e.g. name=$(claudex --detach app/).
+		if err := o.run(in, errOut, errOut, dx); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, o.Name)
+		return nil
+	}
+	return o.run(in, out, errOut, dx)
+}
+
+// Up is Run with --detach: it ensures the container is running and returns
+// its name without attaching.
+func Up(args []string, out, errOut io.Writer, dx dockerx.Docker) (string, error) {
+	o, err := ParseArgs(args)
 	if err != nil {
-		return err
+		return "", err
 	}
-	if !present {
-		fmt.Fprintln(out, "Building image 'claudex' (first run)...")
-		ctxDir, cleanup, err := buildctx.PrepareBuildContext()
-		if err != nil {
+	return o.Up(out, errOut, dx)
+}
+
+// Up derives o and brings its container up detached, returning its name.
+func (o Options) Up(out, errOut io.Writer, dx dockerx.Docker) (string, error) {
+	if err := o.Derive(); err != nil {
+		return "", err
+	}
+	o.Detach = true
+	err := o.run(nil, out, errOut, dx)
+	return o.Name, err
+}
+
+// run brings o's container up and attaches. It may settle on another
+// container than the derived one (see reconcileDuplicates), so o.Name is
+// only final afterwards.
+func (o *Options) run(in io.Reader, out, errOut io.Writer, dx dockerx.Docker) error {
+	sig := trapInterrupts()
+	defer sig.Stop()
+	if o.Dev && o.devBinaryIsSelf && runtime.GOOS != "linux" {
+		output.Warnf(errOut, "%s is a %s binary; pass --dev-binary with a linux build (GOOS=linux go build ./cmd/claudex)\n", o.DevBinary, runtime.GOOS)
+	}
+	o.timings = newTimings(o.Verbose, errOut)
+	warnIgnoredConfig(o.ignoredConfig, errOut)
+	p := prompter(in, out)
+	if o.Pick && (o.NameOverride != "" || o.AlwaysParallel) {
+		return fmt.Errorf("--pick chooses among existing containers; drop --name and --parallel")
+	}
+	if o.NameOverride == "" && !o.AlwaysParallel {
+		if err := o.reconcileDuplicates(dx, p, out, errOut); err != nil {
 			return err
 		}
-		defer cleanup()
-		if err := dx.Build("claudex", ctxDir, dockerx.BuildOptions{}); err != nil {
-			return fmt.Errorf("docker build failed: %w", err)
-		}
 	}
+	lock, err := lockName(o.Name, errOut, sig)
+	if errors.Is(err, errInterrupted) {
+		return err
+	}
+	if err != nil {
+		output.Warnf(errOut, "cannot lock %s against concurrent claudex runs: %v\n", o.Name, err)
+	}
+	o.lock = lock
+	defer lock.Release()
 
-	// Check existing container
+	// Check existing container. Reusing one needs no image check, so
+	// attaching to a running container is a handful of docker calls.
 	exists, running, info, _ := containers.Exists(dx, o.Name)
+	o.timings.mark("inspect")
+	if exists && !containers.IsClaudex(info) {
+		// Never reuse or --replace a container claudex did not create.
+		return fmt.Errorf("a non-claudex container named %s already exists; pick another name, e.g. --name %s", o.Name, containers.SuggestName(dx, o.Name))
+	}
+	if exists && !OwnedBy(info, o.Owner) {
+		// Another user's session on a shared host: never reuse or replace it.
+		return fmt.Errorf("container %s belongs to %s; pick another name, e.g. --name %s, or add {{owner}} to naming.template", o.Name, info.Labels[OwnerLabel], containers.SuggestName(dx, o.Name))
+	}
+	if exists && o.ForceReplace && Protected(info) {
+		return fmt.Errorf("container %s is protected; lift it with claudex protect --off --name %s before --replace", o.Name, o.Name)
+	}
+	if exists && !o.ForceReplace && Expired(info, time.Now()) {
+		at, _ := Expires(info)
+		if info.Labels[TTLActionLabel] != TTLDestroy || Protected(info) {
+			return fmt.Errorf("container %s expired at %s (--ttl); recreate it with --replace", o.Name, at.Format(time.RFC3339))
+		}
+		fmt.Fprintf(out, "Container %s expired at %s; replacing it...\n", o.Name, at.Format(time.RFC3339))
+		_ = dx.Remove(o.Name, true)
+		exists = false
+	}
 	if exists && !o.ForceReplace {
+		if v := o.Policy.Check(*info); len(v) > 0 {
+			return fmt.Errorf("container %s violates policy (%s); recreate it with --replace", o.Name, strings.Join(v, "; "))
+		}
+		if d := o.modeMismatch(info); len(d) > 0 {
+			return fmt.Errorf("container %s was created %s; attach to it with claudex attach %s, or recreate it with --replace", o.Name, strings.Join(d, " and "), o.Name)
+		}
 		fmt.Fprintf(out, "Reusing container %s\n", o.Name)
+		if n := containers.LabelSchema(info); n < containers.Schema {
+			output.Warnf(errOut, "%s uses label schema %d (current %d); upgrade it with claudex migrate\n", o.Name, n, containers.Schema)
+		} else if n > containers.Schema {
+			output.Warnf(errOut, "%s was created by a newer claudex (label schema %d); upgrade claudex\n", o.Name, n)
+		}
 		if o.StrictMounts {
 			if err := containers.WarnOrErrorOnMountMismatch(info, o.Normalized, true, o.Name); err != nil {
+				if o.Migrate && info.Labels["com.claudex.mounts"] != "" {
+					return o.migrate(info, running, in, out, errOut, dx, sig)
+				}
+				if info.Labels["com.claudex.mounts"] != "" {
+					return fmt.Errorf("%w; use --migrate to move its state into a container with the new mounts", err)
+				}
+				return err
+			}
+		}
+		if running && info != nil && info.Health == "unhealthy" {
+			ok, err := heal(dx, o.Name, p, out, errOut)
+			if err != nil {
 				return err
 			}
+			if !ok {
+				fmt.Fprintf(out, "Recreating container %s...\n", o.Name)
+				_ = dx.Remove(o.Name, true)
+				exists = false
+			}
 		}
-		if !running {
+		if exists && !running {
 			fmt.Fprintf(out, "Starting container %s...\n", o.Name)
 			if err := dx.Start(o.Name); err != nil {
 				return fmt.Errorf("failed to start container: %w", err)
 			}
-			if ok := waitRunning(dx, o.Name, 5*time.Second); !ok {
+			switch err := waitReady(dockerx.Context(), dx, o.Name); {
+			case err == nil:
+			case errors.Is(err, errSlowStart):
+				// It runs; only its entrypoint is late. Attaching keeps
+				// the session instead of throwing it away.
+				output.Warnf(errOut, "%v\n", err)
+			case errors.Is(err, errExited), errors.Is(err, errCrashLoop):
+				output.Warnf(errOut, "%v\n", err)
 				if logs, lerr := dx.Logs(o.Name, 50); lerr == nil && len(logs) > 0 {
 					fmt.Fprintln(errOut, "Recent container logs:")
 					fmt.Fprintln(errOut, string(logs))
 				}
+				if Protected(info) {
+					return fmt.Errorf("%w; it is protected, so it is not recreated (lift it with claudex protect --off --name %s)", err, o.Name)
+				}
 				fmt.Fprintln(errOut, "Container failed to stay running; recreating...")
 				_ = dx.Remove(o.Name, true)
 				exists = false
+			default:
+				return err
 			}
 		}
 		if exists {
+			o.timings.mark("start")
 			maybeInitGit(o.SkipGit, dx, o.Name, out, errOut)
-			maybeInitFirewall(o.Firewall, dx, o.Name, out, errOut)
-			fmt.Fprintln(out, "Attaching shell. Type 'exit' to leave.")
-			return dx.ExecInteractive(o.Name, []string{"bash"}, in, out, errOut)
+			o.timings.mark("git")
+			maybeInitFirewall(o.Firewall, dx, o.Name, out, errOut, o.firewallAllow(errOut)...)
+			o.timings.mark("firewall")
+			maybeStartDockerd(info.Labels[NestedLabel], dx, o.Name, out, errOut)
+			maybeForwardPorts(parsePorts(info.Labels[PublishedPortsLabel]), dx, o.Name, errOut)
+			if d, err := time.ParseDuration(info.Labels[AutoCommitLabel]); err == nil {
+				maybeStartAutoCommit(d, dx, o.Name, out, errOut)
+			}
+			o.timings.mark("services")
+			if o.Shell == "" {
+				o.Shell = info.Labels[ShellLabel]
+			}
+			sess := sessionFromContainer(info, *o)
+			if o.Detach {
+				sess.LastAttached = time.Time{}
+			}
+			recordSession(sess, errOut)
+			o.timings.mark("session")
+			return o.attach(in, out, errOut, dx, sig)
 		}
 	}
 	if exists && o.ForceReplace {
@@ -217,32 +858,314 @@ func Run(args []string, in io.Reader, out, errOut io.Writer, dx dockerx.Docker)
 	}
 
 	if !exists {
-		return createAndAttach(o, in, out, errOut, dx)
+		return createAndAttach(*o, in, out, errOut, dx, sig)
 	}
 	// Should not reach here; safeguard
 	return fmt.Errorf("unexpected state; please retry with --replace")
 }
 
-func createAndAttach(o Options, in io.Reader, out, errOut io.Writer, dx dockerx.Docker) error {
-	fmt.Fprintf(out, "Creating container %s...\n", o.Name)
+// ensureImage builds the claudex image from the embedded (or contextDir)
+// build context when it is missing.
+func ensureImage(contextDir string, out io.Writer, dx dockerx.Docker, sig *interrupts) error {
+	fmt.Fprintln(out, "Ensuring image 'claudex' exists...")
+	present, err := dx.ImageExists("claudex")
+	if err != nil {
+		return err
+	}
+	if present {
+		return nil
+	}
+	fmt.Fprintln(out, "Building image 'claudex' (first run)...")
+	ctxArg, stream, err := buildctx.Context(contextDir)
+	if err != nil {
+		return err
+	}
+	var opts dockerx.BuildOptions
+	if stream != nil {
+		defer stream.Close()
+		opts.Context = stream
+	}
+	if err := dx.Build("claudex", ctxArg, opts); err != nil {
+		if sig.Interrupted() {
+			return errInterrupted
+		}
+		return fmt.Errorf("docker build failed: %w", err)
+	}
+	return nil
+}
+
+// AuditHook and AuditLog are the in-container paths used by --audit.
+const (
+	AuditHook = "/usr/local/lib/claudex/audit.sh"
+	AuditLog  = "/var/log/claudex/commands.log"
+)
+
+var errInterrupted = fmt.Errorf("interrupted")
+
+func createAndAttach(o Options, in io.Reader, out, errOut io.Writer, dx dockerx.Docker, sig *interrupts) error {
+	if err := o.create(out, errOut, dx, sig, nil); err != nil {
+		return err
+	}
+	return o.attach(in, out, errOut, dx, sig)
+}
+
+// create runs a new container for o and records it. seed, when set, runs
+// once the container is up and before in-container setup, to carry state
+// over from another container (see migrate).
+func (o Options) create(out, errOut io.Writer, dx dockerx.Docker, sig *interrupts, seed func() error) error {
+	o.hostNetworkFallback(dx, errOut)
+	if o.TTL > 0 {
+		o.Expires = time.Now().Add(o.TTL)
+	}
 	runArgs, err := o.BuildRunArgs()
 	if err != nil {
 		return err
 	}
-	if err := dx.Run(runArgs...); err != nil {
+	if err := o.preflight(dx, runArgs); err != nil {
+		return err
+	}
+	o.warnLargeMounts(errOut)
+	if err := ensureImage(o.BuildContextDir, out, dx, sig); err != nil {
+		return err
+	}
+	o.timings.mark("image")
+	fmt.Fprintf(out, "Creating container %s...\n", o.Name)
+	warnDockerSocket(o, errOut)
+	if err := o.prepareHost(out); err != nil {
+		return err
+	}
+	if o.WorkspaceVolume {
+		if err := SyncVolume(dx, o.image(), VolumeName(o.Signature), o.Normalized, SyncOptions{}, out); err != nil {
+			return err
+		}
+	}
+	if err := o.runContainer(dx, runArgs, errOut); err != nil {
+		if sig.Interrupted() {
+			return errInterrupted
+		}
 		return fmt.Errorf("docker run failed: %w", err)
 	}
-	if ok := waitRunning(dx, o.Name, 5*time.Second); !ok {
+	if err := waitReady(dockerx.Context(), dx, o.Name); err != nil {
 		if logs, lerr := dx.Logs(o.Name, 50); lerr == nil && len(logs) > 0 {
 			fmt.Fprintln(errOut, "Recent container logs:")
 			fmt.Fprintln(errOut, string(logs))
 		}
-		return fmt.Errorf("container %s did not stay running after creation; inspect logs and retry with --replace", o.Name)
+		o.abandon(dx, errOut)
+		return fmt.Errorf("%w; inspect logs and retry", err)
 	}
+	o.timings.mark("docker run")
+	if o.Cow {
+		if err := o.copyWorkspaceIn(dx, out); err != nil {
+			o.abandon(dx, errOut)
+			return err
+		}
+	}
+	if seed != nil {
+		if err := seed(); err != nil {
+			o.abandon(dx, errOut)
+			return err
+		}
+	}
+	o.writeAgentDocs(dx, errOut)
+	maybeSetupSigning(o, dx, out, errOut)
 	maybeInitGit(o.SkipGit, dx, o.Name, out, errOut)
-	maybeInitFirewall(o.Firewall, dx, o.Name, out, errOut)
-	fmt.Fprintln(out, "Attaching shell. Type 'exit' to leave.")
-	return dx.ExecInteractive(o.Name, []string{"bash"}, in, out, errOut)
+	maybeInitFirewall(o.Firewall, dx, o.Name, out, errOut, o.firewallAllow(errOut)...)
+	maybeStartDockerd(o.NestedDocker, dx, o.Name, out, errOut)
+	maybeForwardPorts(o.PublishPorts, dx, o.Name, errOut)
+	maybeStartAutoCommit(o.AutoCommit, dx, o.Name, out, errOut)
+	maybeStartIndex(o.Index, dx, o.Name, out, errOut)
+	if seed == nil {
+		// A seeded home already has the dotfiles, possibly edited.
+		maybeInjectDotfiles(o.DotfilesDir, dx, o.Name, out, errOut)
+	}
+	if sig.Interrupted() {
+		o.abandon(dx, errOut)
+		return errInterrupted
+	}
+	now := time.Now()
+	sess := state.Session{Name: o.Name, Signature: o.Signature, Slug: o.Slug, Mounts: o.Normalized, CreatedAt: now, Workspace: o.Workspace}
+	if !o.Detach {
+		sess.LastAttached = now
+	}
+	recordSession(sess, errOut)
+	notifyCreated(o, errOut)
+	o.timings.mark("setup")
+	return nil
+}
+
+// warnDockerSocket prints a prominent warning when --docker-socket is used.
+func warnDockerSocket(o Options, errOut io.Writer) {
+	if o.NestedDocker != NestedSocket {
+		return
+	}
+	if _, err := os.Stat(policy.DockerSocket); err != nil {
+		output.Warnf(errOut, "--docker-socket given but %s does not exist on this host\n", policy.DockerSocket)
+		return
+	}
+	fmt.Fprintln(errOut, "WARNING: mounting the host docker socket gives the agent root-equivalent access to this machine.")
+	fmt.Fprintln(errOut, "WARNING: anything in the container can start privileged containers and read or modify host files.")
+}
+
+// sessionFromContainer describes a reused container for the state store,
+// preferring its labels over the current invocation's derived values.
+func sessionFromContainer(info *dockerx.Container, o Options) state.Session {
+	sess := state.Session{Name: o.Name, Signature: o.Signature, Slug: o.Slug, Mounts: o.Normalized, LastAttached: time.Now(), Workspace: o.Workspace}
+	if info == nil {
+		return sess
+	}
+	if v := info.Labels[WorkspaceLabel]; v != "" {
+		sess.Workspace = v
+	}
+	sess.CreatedAt = info.CreatedAt
+	if v := info.Labels["com.claudex.signature"]; v != "" {
+		sess.Signature = v
+	}
+	if v := info.Labels["com.claudex.slug"]; v != "" {
+		sess.Slug = v
+	}
+	if m, err := containers.MountsFromLabel(info); err == nil {
+		sess.Mounts = m
+	}
+	return sess
+}
+
+// recordSession upserts sess into the state store; failures only warn.
+func recordSession(sess state.Session, errOut io.Writer) {
+	err := state.Update(func(s *state.Store) error {
+		s.Upsert(sess)
+		return nil
+	})
+	if err != nil {
+		output.Warnf(errOut, "unable to record session state: %v\n", err)
+	}
+}
+
+// Attach starts (if needed) and attaches to an existing claudex container by
+// name from any directory; when the current directory is one the container
+// mounts, the shell starts in its /workspace dir. An empty ao.Shell falls
+// back to the config default, then the shell the container was created with.
+func Attach(name string, ao AttachOptions, in io.Reader, out, errOut io.Writer, dx dockerx.Docker) error {
+	if err := ValidateEnv(ao.Env); err != nil {
+		return err
+	}
+	exists, running, info, _ := containers.Exists(dx, name)
+	if !exists {
+		return fmt.Errorf("container %s does not exist", name)
+	}
+	if !running {
+		fmt.Fprintf(out, "Starting container %s...\n", name)
+		if err := dx.Start(name); err != nil {
+			return fmt.Errorf("failed to start container: %w", err)
+		}
+		if err := waitReady(dockerx.Context(), dx, name); err != nil {
+			return fmt.Errorf("%w; recreate it from its workspace with --replace", err)
+		}
+		if info != nil {
+			maybeForwardPorts(parsePorts(info.Labels[PublishedPortsLabel]), dx, name, errOut)
+		}
+	}
+	sig := trapInterrupts()
+	defer sig.Stop()
+	if ao.Shell == "" {
+		if cfg, err := config.Load(); err == nil {
+			ao.Shell = cfg.Shell
+		}
+	}
+	if ao.Shell == "" && info != nil {
+		ao.Shell = info.Labels[ShellLabel]
+	}
+	if err := validateShell(ao.Shell); err != nil {
+		return err
+	}
+	recordSession(sessionFromContainer(info, Options{Name: name}), errOut)
+	var mounts []string
+	if info != nil {
+		mounts, _ = containers.MountsFromLabel(info)
+	}
+	ao.Workdir = ao.shellWorkdir(mounts)
+	return attach(name, ao, in, out, errOut, dx, sig)
+}
+
+// modeMismatch describes how info was created differently from what o asks
+// for in ways reuse cannot change: where the workspace lives and whether it
+// runs the host's claudex (`claudex dev`).
+func (o Options) modeMismatch(info *dockerx.Container) []string {
+	modes := []struct {
+		flag      string
+		want, has bool
+	}{
+		{"--cow", o.Cow, info.Labels[CowLabel] == "true"},
+		{"--workspace-volume", o.WorkspaceVolume, info.Labels[VolumeLabel] != ""},
+		{"claudex dev", o.Dev, info.Labels[DevLabel] == "true"},
+	}
+	var d []string
+	for _, m := range modes {
+		switch {
+		case m.want && !m.has:
+			d = append(d, "without "+m.flag)
+		case !m.want && m.has:
+			d = append(d, "with "+m.flag)
+		}
+	}
+	return d
+}
+
+// runContainer runs `docker run args` for o.Name and abandons the container
+// when that fails, unless it is not this call's: a container that already
+// had the name (a conflict) and still has its ID is left alone.
+func (o Options) runContainer(dx dockerx.Docker, args []string, errOut io.Writer) error {
+	before, beforeErr := dx.Inspect(o.Name)
+	err := dx.Run(args...)
+	if err == nil {
+		return nil
+	}
+	if beforeErr == nil {
+		if after, afterErr := dx.Inspect(o.Name); afterErr != nil || after.ID == before.ID {
+			return err
+		}
+	}
+	o.abandon(dx, errOut)
+	return err
+}
+
+// abandon removes a half-created container unless --keep-on-failure was given.
+func (o Options) abandon(dx dockerx.Docker, errOut io.Writer) {
+	if o.KeepOnFailure {
+		fmt.Fprintf(errOut, "Keeping container %s for inspection (--keep-on-failure)\n", o.Name)
+		return
+	}
+	fmt.Fprintf(errOut, "Removing half-created container %s...\n", o.Name)
+	// Ctrl-C cancels dx's context; the cleanup must still run.
+	_ = dx.WithContext(context.Background()).Remove(o.Name, true)
+}
+
+// attach attaches the shell unless --detach was given.
+func (o Options) attach(in io.Reader, out, errOut io.Writer, dx dockerx.Docker, sig *interrupts) error {
+	// The container is up; others waiting for it can reuse it now.
+	o.lock.Release()
+	if o.Detach {
+		fmt.Fprintf(out, "Container %s is running (detached). Attach with: claudex attach %s\n", o.Name, o.Name)
+		return nil
+	}
+	ao := AttachOptions{Shell: o.Shell, Env: o.AttachEnv}
+	ao.Workdir = ao.shellWorkdir(o.Normalized)
+	return attach(o.Name, ao, in, out, errOut, dx, sig)
+}
+
+// attach runs the interactive shell, then records the session's usage. A
+// signal that ends the session detaches cleanly; the container keeps
+// running.
+func attach(name string, ao AttachOptions, in io.Reader, out, errOut io.Writer, dx dockerx.Docker, sig *interrupts) error {
+	fmt.Fprintln(out, output.T(output.MsgAttaching))
+	start := time.Now()
+	err := dx.ExecInteractive(name, shellCommand(ao.Shell), dockerx.ExecOptions{Env: ao.Env, Workdir: ao.Workdir}, in, out, errOut)
+	// Ctrl-C cancels dx's context; the sample must still be taken.
+	RecordUsage(dx.WithContext(context.Background()), name, time.Since(start), errOut)
+	if sig.Interrupted() {
+		fmt.Fprintf(out, "\n%s\n", output.T(output.MsgDetached, name))
+		return nil
+	}
+	return err
 }
 
 func maybeInitGit(skip bool, dx dockerx.Docker, name string, out, errOut io.Writer) {
@@ -254,37 +1177,98 @@ func maybeInitGit(skip bool, dx dockerx.Docker, name string, out, errOut io.Writ
 	}
 	fmt.Fprintln(out, "Initializing Git repository in /workspace...")
 	if err := dx.Exec(name, "bash", "-c", "cd /workspace && git init --quiet"); err != nil {
-		fmt.Fprintf(errOut, "Warning: git init failed: %v\n", err)
+		output.Warnf(errOut, "git init failed: %v\n", err)
 		return
 	}
 	if err := dx.Exec(name, "bash", "-c", "cd /workspace && { [ -f .gitignore ] || printf '/*.md\n' > .gitignore; }"); err != nil {
-		fmt.Fprintf(errOut, "Warning: unable to write .gitignore: %v\n", err)
+		output.Warnf(errOut, "unable to write .gitignore: %v\n", err)
 	}
 	if err := dx.Exec(name, "bash", "-c", "cd /workspace && git add -A"); err != nil {
-		fmt.Fprintf(errOut, "Warning: git add failed: %v\n", err)
+		output.Warnf(errOut, "git add failed: %v\n", err)
 		return
 	}
 	fmt.Fprintln(out, "Initialized Git repository in /workspace and staged current contents")
 }
 
-func maybeInitFirewall(enable bool, dx dockerx.Docker, name string, out, errOut io.Writer) {
+// firewallAllow returns the registry hosts the mounted projects need when
+// --firewall-deps (or firewall.allowDeps) is set. Other registries their
+// configs and lockfiles name are reported on errOut but not allowed.
+func (o Options) firewallAllow(errOut io.Writer) []string {
+	if !o.FirewallDeps {
+		return nil
+	}
+	hosts, unlisted := firewall.Scan(o.Normalized)
+	if len(unlisted) > 0 {
+		output.Warnf(errOut, "not allowing registries named in project files: %s; allow them with claudex firewall allow --name %s HOST\n", strings.Join(unlisted, ", "), o.Name)
+	}
+	return hosts
+}
+
+// firewallCurrentScript prints "current" when init-firewall.sh ran with
+// the same arguments ($@) and script since the container last started.
+const firewallCurrentScript = `fp=$({ printf '%s ' "$@"; cat /usr/local/bin/init-firewall.sh; } | sha256sum | cut -c1-16)
+[ "$(cat /run/claudex-firewall 2>/dev/null)" = "$(cut -d' ' -f22 /proc/1/stat) $fp" ] && echo current`
+
+func maybeInitFirewall(enable bool, dx dockerx.Docker, name string, out, errOut io.Writer, allow ...string) {
 	if !enable {
 		return
 	}
+	var args, hosts []string
+	for _, h := range allow {
+		if firewall.ValidHost(h) {
+			args = append(args, "--allow", h)
+			hosts = append(hosts, h)
+		}
+	}
+	// The rules survive until the container restarts; only re-run when
+	// they would differ.
+	check := append([]string{"sh", "-c", firewallCurrentScript, "sh"}, args...)
+	if cur, err := dx.ExecOutput(name, check); err == nil && strings.TrimSpace(string(cur)) == "current" {
+		return
+	}
 	fmt.Fprintln(out, "Initializing firewall...")
-	if err := dx.Exec(name, "bash", "-c", "sudo /usr/local/bin/init-firewall.sh"); err != nil {
-		fmt.Fprintf(errOut, "Warning: init-firewall failed: %v\n", err)
+	cmd := strings.Join(append([]string{"/usr/local/bin/init-firewall.sh"}, args...), " ")
+	if len(hosts) > 0 {
+		fmt.Fprintf(out, "Allowing project registries: %s\n", strings.Join(hosts, ", "))
+	}
+	if err := dx.Exec("-u", "root", name, "bash", "-c", cmd); err != nil {
+		output.Warnf(errOut, "init-firewall failed: %v\n", err)
+	}
+}
+
+// healthCmd is the container HEALTHCHECK; it also serves as the post-restart probe.
+const healthCmd = "test -d /workspace && test -w /tmp"
+
+// prompter asks questions on out, reading the answers from in. Without in
+// (Up, and the Go API) nothing can be asked.
+func prompter(in io.Reader, out io.Writer) ui.Prompter {
+	if in == nil {
+		return ui.AutoPrompter(false)
 	}
+	return ui.Auto(ui.NewPrompter(in, out, in == os.Stdin && ui.StdinIsTTY()))
 }
 
-func waitRunning(dx dockerx.Docker, name string, timeout time.Duration) bool {
-	deadline := time.Now().Add(timeout)
-	for time.Now().Before(deadline) {
-		_, running, _, _ := containers.Exists(dx, name)
-		if running {
-			return true
+// heal restarts an unhealthy container and probes it again. It returns true when
+// the container is usable, false when the user agreed to recreate it, and an
+// error when it stays broken and recreation was declined or cannot be asked.
+func heal(dx dockerx.Docker, name string, p ui.Prompter, out, errOut io.Writer) (bool, error) {
+	fmt.Fprintf(errOut, "Container %s is unhealthy; restarting...\n", name)
+	if err := dx.Restart(name); err == nil && waitReady(dockerx.Context(), dx, name) == nil {
+		if _, err := dx.ExecOutput(name, []string{"sh", "-c", healthCmd}); err == nil {
+			fmt.Fprintln(out, "Container recovered after restart.")
+			return true, nil
 		}
-		time.Sleep(200 * time.Millisecond)
 	}
-	return false
+	if logs, lerr := dx.Logs(name, 50); lerr == nil && len(logs) > 0 {
+		fmt.Fprintln(errOut, "Recent container logs:")
+		fmt.Fprintln(errOut, string(logs))
+	}
+	ok, err := p.Confirm(output.T(output.MsgRecreateUnhealthy, name))
+	if err != nil {
+		return false, fmt.Errorf("container %s is still unhealthy after restart; retry with --replace", name)
+	}
+	if ok {
+		return false, nil
+	}
+	return false, fmt.Errorf("container %s is unhealthy; not attaching (retry with --replace)", name)
 }
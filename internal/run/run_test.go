@@ -2,10 +2,21 @@ package run
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
-	"claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/policy"
+	"github.com/photodialectic/claudex/internal/state"
+	"github.com/photodialectic/claudex/internal/ui"
 )
 
 func TestParseArgsAndDerive(t *testing.T) {
@@ -94,10 +105,1063 @@ func TestMaybeInitFirewallRunsWhenEnabled(t *testing.T) {
 		t.Fatalf("expected firewall exec, got %v", f.ExecCalls)
 	}
 	call := f.ExecCalls[0]
-	if len(call) < 4 || call[0] != "c" || call[1] != "bash" || call[2] != "-c" || call[3] != "sudo /usr/local/bin/init-firewall.sh" {
+	if len(call) < 6 || call[0] != "-u" || call[1] != "root" || call[2] != "c" || call[3] != "bash" || call[4] != "-c" || call[5] != "/usr/local/bin/init-firewall.sh" {
 		t.Fatalf("unexpected firewall call: %v", call)
 	}
 	if !bytes.Contains(out.Bytes(), []byte("Initializing firewall")) {
 		t.Fatalf("expected firewall message, got %q", out.String())
 	}
 }
+
+func TestHealRecoversAfterRestart(t *testing.T) {
+	f := &dockerx.Fake{Containers: map[string]dockerx.Container{"c": {Name: "c", Status: "running"}}}
+	var out, errOut bytes.Buffer
+	ok, err := heal(f, "c", prompter(strings.NewReader(""), &out), &out, &errOut)
+	if err != nil || !ok {
+		t.Fatalf("expected recovery, ok=%v err=%v", ok, err)
+	}
+	if len(f.RestartCalls) != 1 || f.RestartCalls[0] != "c" {
+		t.Fatalf("expected restart of c, got %v", f.RestartCalls)
+	}
+}
+
+func TestHealPromptsToRecreate(t *testing.T) {
+	f := &dockerx.Fake{Containers: map[string]dockerx.Container{"c": {Name: "c", Status: "running"}}, ExecOutputErr: errors.New("probe failed")}
+	var out, errOut bytes.Buffer
+	ok, err := heal(f, "c", prompter(strings.NewReader("y\n"), &out), &out, &errOut)
+	if err != nil || ok {
+		t.Fatalf("expected recreate decision, ok=%v err=%v", ok, err)
+	}
+	if _, err := heal(f, "c", prompter(strings.NewReader("n\n"), &out), &out, &errOut); err == nil || !strings.Contains(err.Error(), "unhealthy") {
+		t.Fatalf("expected unhealthy error when recreation declined, got %v", err)
+	}
+}
+
+func TestCreateAndAttachRemovesContainerOnFailure(t *testing.T) {
+	f := &dockerx.Fake{Containers: map[string]dockerx.Container{}, RunErr: errors.New("boom")}
+	o := Options{Normalized: []string{t.TempDir()}, Name: "half"}
+	var out, errOut bytes.Buffer
+	if err := createAndAttach(o, nil, &out, &errOut, f, nil); err == nil {
+		t.Fatalf("expected docker run error")
+	}
+	if len(f.RemoveCalls) != 1 || f.RemoveCalls[0] != "half" {
+		t.Fatalf("expected half-created container removal, got %v", f.RemoveCalls)
+	}
+
+	f.RemoveCalls = nil
+	o.KeepOnFailure = true
+	if err := createAndAttach(o, nil, &out, &errOut, f, nil); err == nil {
+		t.Fatalf("expected docker run error")
+	}
+	if len(f.RemoveCalls) != 0 {
+		t.Fatalf("expected --keep-on-failure to skip removal, got %v", f.RemoveCalls)
+	}
+
+	// A failed run that hit an existing container must not remove it.
+	f.Containers["half"] = dockerx.Container{ID: "other", Name: "half", Status: "running"}
+	o.KeepOnFailure = false
+	if err := createAndAttach(o, nil, &out, &errOut, f, nil); err == nil {
+		t.Fatalf("expected docker run error")
+	}
+	if len(f.RemoveCalls) != 0 {
+		t.Fatalf("removed a container this run did not create: %v", f.RemoveCalls)
+	}
+}
+
+func TestDeriveRejectsUnknownSignatureMode(t *testing.T) {
+	o := Options{Workdirs: []string{t.TempDir()}, SignatureMode: "v9"}
+	if err := o.Derive(); err == nil {
+		t.Fatalf("expected error for unknown signature mode")
+	}
+}
+
+func TestDeriveSlugOverrideAndNamingConfig(t *testing.T) {
+	cfgHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", cfgHome)
+	t.Setenv("CLAUDEX_NAME_PREFIX", "")
+	if err := os.MkdirAll(filepath.Join(cfgHome, "claudex"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := "naming:\n  template: \"{{slug}}-{{hash}}\"\n  hashLen: 4\n"
+	if err := os.WriteFile(filepath.Join(cfgHome, "claudex", "config.yaml"), []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+	o := Options{Workdirs: []string{t.TempDir()}, SlugOverride: "My App"}
+	if err := o.Derive(); err != nil {
+		t.Fatalf("Derive: %v", err)
+	}
+	if want := "my-app-" + o.Signature[:4]; o.Name != want {
+		t.Fatalf("Name = %q, want %q", o.Name, want)
+	}
+	o = Options{Workdirs: []string{t.TempDir()}, SlugOverride: "-"}
+	if err := o.Derive(); err != nil || !strings.HasPrefix(o.Name, "ws-") {
+		t.Fatalf("empty slug should fall back to ws: %q, %v", o.Name, err)
+	}
+}
+
+func TestProjectConfigCannotLoosenPolicy(t *testing.T) {
+	cfgHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", cfgHome)
+	t.Setenv("HOME", t.TempDir())
+	if err := os.MkdirAll(filepath.Join(cfgHome, "claudex"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(cfgHome, "claudex", "config.yaml"), []byte("policy:\n  restrictEgress: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".claudex.yaml"), []byte("policy:\n  restrictEgress: false\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	o := Options{Workdirs: []string{dir}}
+	if err := o.Derive(); err != nil {
+		t.Fatalf("Derive: %v", err)
+	}
+	if !o.Policy.RestrictEgress || !o.Firewall {
+		t.Fatalf("the project file loosened the global policy: %+v, firewall %v", o.Policy, o.Firewall)
+	}
+	if strings.Join(o.ignoredConfig, ",") != "policy" {
+		t.Fatalf("ignoredConfig = %v", o.ignoredConfig)
+	}
+}
+
+func TestCloneNeedsExplicitNestedDocker(t *testing.T) {
+	cfgHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", cfgHome)
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	src := dockerx.Container{Name: "src", Status: "running", Labels: map[string]string{
+		"com.claudex.signature": "s", "com.claudex.mounts": `["` + t.TempDir() + `"]`, NestedLabel: NestedDind,
+	}}
+	f := &dockerx.Fake{Simulate: true, Containers: map[string]dockerx.Container{"src": src}}
+	var out, errOut bytes.Buffer
+	if err := Clone("src", "c1", "", &out, &errOut, f); err != nil {
+		t.Fatalf("clone: %v\n%s", err, errOut.String())
+	}
+	if run := strings.Join(f.RunCalls[0], " "); strings.Contains(run, "--privileged") || !strings.Contains(errOut.String(), "--nested-docker dind") {
+		t.Fatalf("nested docker carried over implicitly: %s\n%s", run, errOut.String())
+	}
+
+	if err := os.MkdirAll(filepath.Join(cfgHome, "claudex"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(cfgHome, "claudex", "config.yaml"), []byte("policy:\n  restrictEgress: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Clone("src", "c2", NestedDind, &out, &errOut, f); err == nil || !strings.Contains(err.Error(), "forbid --nested-docker dind") {
+		t.Fatalf("expected the policy to refuse dind, got %v", err)
+	}
+}
+
+func TestRunRefusesReuseAcrossWorkspaceModes(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	f := &dockerx.Fake{ImageExistsVal: true, Containers: map[string]dockerx.Container{
+		"c": {Name: "c", Status: "running", Labels: map[string]string{"com.claudex.signature": "s", CowLabel: "true"}},
+	}}
+	var out, errOut bytes.Buffer
+	err := Run([]string{t.TempDir(), "--name", "c", "--no-git"}, nil, &out, &errOut, f)
+	if err == nil || !strings.Contains(err.Error(), "created with --cow") {
+		t.Fatalf("expected a --cow mismatch error, got %v", err)
+	}
+	err = Run([]string{t.TempDir(), "--name", "c", "--no-git", "--workspace-volume"}, nil, &out, &errOut, f)
+	if err == nil || !strings.Contains(err.Error(), "created with --cow and without --workspace-volume") {
+		t.Fatalf("expected a --workspace-volume mismatch error, got %v", err)
+	}
+	bin := filepath.Join(t.TempDir(), "claudex")
+	if err := os.WriteFile(bin, nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+	f.Containers["c"] = dockerx.Container{Name: "c", Status: "running", Labels: map[string]string{"com.claudex.signature": "s"}}
+	err = Run([]string{t.TempDir(), "--name", "c", "--no-git", "--dev", "--dev-binary", bin}, nil, &out, &errOut, f)
+	if err == nil || !strings.Contains(err.Error(), "created without claudex dev") {
+		t.Fatalf("expected dev to refuse a non-dev container, got %v", err)
+	}
+	if len(f.RunCalls) != 0 || len(f.RemoveCalls) != 0 {
+		t.Fatalf("mismatch must neither create nor remove: %v %v", f.RunCalls, f.RemoveCalls)
+	}
+}
+
+func TestDeriveDevOnlyFlagsTheRunningBinary(t *testing.T) {
+	bin := filepath.Join(t.TempDir(), "claudex")
+	if err := os.WriteFile(bin, nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+	o := Options{Dev: true, DevBinary: bin}
+	if err := o.deriveDev(); err != nil || o.devBinaryIsSelf {
+		t.Fatalf("--dev-binary %s: err=%v self=%v", bin, err, o.devBinaryIsSelf)
+	}
+	o = Options{Dev: true}
+	if err := o.deriveDev(); err != nil || !o.devBinaryIsSelf {
+		t.Fatalf("default dev binary: err=%v self=%v", err, o.devBinaryIsSelf)
+	}
+	if exe, _ := os.Executable(); o.DevBinary != exe {
+		t.Fatalf("DevBinary = %s, want %s", o.DevBinary, exe)
+	}
+}
+
+func TestCloneKeepsHostGit(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	app, api := filepath.Join(t.TempDir(), "app"), filepath.Join(t.TempDir(), "api")
+	srcCopy, err := hostGitCopyDir("src", api)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(srcCopy, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(srcCopy, "HEAD"), []byte("ref: refs/heads/agent\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	src := dockerx.Container{Name: "src", Status: "running",
+		Labels: map[string]string{"com.claudex.signature": "s", "com.claudex.mounts": `["` + app + `","` + api + `"]`},
+		Tmpfs:  map[string]string{"/workspace/app/.git": ""},
+		Mounts: []dockerx.Mount{{Type: "bind", Source: srcCopy, Destination: "/workspace/api/.git", RW: true}},
+	}
+	f := &dockerx.Fake{Simulate: true, Containers: map[string]dockerx.Container{"src": src}}
+	var out, errOut bytes.Buffer
+	if err := Clone("src", "c1", "", &out, &errOut, f); err != nil {
+		t.Fatalf("clone: %v\n%s", err, errOut.String())
+	}
+	dstCopy, _ := hostGitCopyDir("c1", api)
+	run := strings.Join(f.RunCalls[0], " ")
+	if !strings.Contains(run, "--tmpfs /workspace/app/.git") || !strings.Contains(run, dstCopy+":/workspace/api/.git") {
+		t.Fatalf("host git modes not carried over: %s", run)
+	}
+	if b, err := os.ReadFile(filepath.Join(dstCopy, "HEAD")); err != nil || string(b) != "ref: refs/heads/agent\n" {
+		t.Fatalf("clone's .git copy should start from the source's: %q, %v", b, err)
+	}
+}
+
+func TestCloneKeepsNoSudo(t *testing.T) {
+	cfgHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", cfgHome)
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	labels := map[string]string{"com.claudex.signature": "s", "com.claudex.mounts": `["` + t.TempDir() + `"]`}
+	f := &dockerx.Fake{Simulate: true, Containers: map[string]dockerx.Container{
+		"nosudo": {Name: "nosudo", Status: "running", Labels: labels, SecurityOpt: []string{"no-new-privileges"}},
+		"sudo":   {Name: "sudo", Status: "running", Labels: labels},
+	}}
+	var out, errOut bytes.Buffer
+	if err := Clone("nosudo", "c1", "", &out, &errOut, f); err != nil {
+		t.Fatalf("clone: %v", err)
+	}
+	if run := strings.Join(f.RunCalls[0], " "); !strings.Contains(run, "--security-opt "+policy.NoNewPrivileges) {
+		t.Fatalf("--no-sudo not carried over: %s", run)
+	}
+	if err := os.MkdirAll(filepath.Join(cfgHome, "claudex"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(cfgHome, "claudex", "config.yaml"), []byte("policy:\n  noSudo: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Clone("sudo", "c2", "", &out, &errOut, f); err != nil {
+		t.Fatalf("clone: %v", err)
+	}
+	if run := strings.Join(f.RunCalls[1], " "); !strings.Contains(run, "--security-opt "+policy.NoNewPrivileges) {
+		t.Fatalf("policy.noSudo not applied to the clone: %s", run)
+	}
+}
+
+func TestRunRefusesNonClaudexNameCollision(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	f := &dockerx.Fake{ImageExistsVal: true, Containers: map[string]dockerx.Container{
+		"web":   {Name: "web", Status: "running"},
+		"web-2": {Name: "web-2", Status: "exited"},
+	}}
+	var out, errOut bytes.Buffer
+	err := Run([]string{"--name", "web", "--replace", t.TempDir()}, nil, &out, &errOut, f)
+	if err == nil || !strings.Contains(err.Error(), "non-claudex") || !strings.Contains(err.Error(), "--name web-3") {
+		t.Fatalf("expected collision error suggesting web-3, got %v", err)
+	}
+	if len(f.RemoveCalls) != 0 {
+		t.Fatalf("must not remove a foreign container, got %v", f.RemoveCalls)
+	}
+}
+
+func TestRunRefusesAnotherOwnersContainer(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("USER", "alice")
+	f := &dockerx.Fake{ImageExistsVal: true, Containers: map[string]dockerx.Container{
+		"web": {Name: "web", Status: "running", Labels: map[string]string{"com.claudex.signature": "s", OwnerLabel: "bob"}},
+	}}
+	var out, errOut bytes.Buffer
+	err := Run([]string{"--name", "web", "--replace", t.TempDir()}, nil, &out, &errOut, f)
+	if err == nil || !strings.Contains(err.Error(), "belongs to bob") || !strings.Contains(err.Error(), "--name web-2") {
+		t.Fatalf("expected ownership error suggesting web-2, got %v", err)
+	}
+	if len(f.RemoveCalls) != 0 {
+		t.Fatalf("must not remove another user's container, got %v", f.RemoveCalls)
+	}
+}
+
+func TestCloneRecordsOwner(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("USER", "alice")
+	f := &dockerx.Fake{Simulate: true, Containers: map[string]dockerx.Container{
+		"src": {Name: "src", Status: "running", Labels: map[string]string{"com.claudex.signature": "s", "com.claudex.mounts": `["` + t.TempDir() + `"]`, OwnerLabel: "bob"}},
+	}}
+	var out, errOut bytes.Buffer
+	if err := Clone("src", "c", "", &out, &errOut, f); err != nil {
+		t.Fatalf("clone: %v", err)
+	}
+	if got := f.Containers["c"].Labels[OwnerLabel]; got != "alice" {
+		t.Fatalf("clone owner = %q, want alice", got)
+	}
+}
+
+func TestCloneExcludesAndCopyState(t *testing.T) {
+	ex := cloneExcludes([]string{"/home/me/app", "/home/me/api"}, []string{"/workspace/app", "/home/node/.claude", "/var/run/docker.sock"})
+	want := "home/node/.claude,workspace/api,workspace/app"
+	if strings.Join(ex, ",") != want {
+		t.Fatalf("cloneExcludes = %v, want %s", ex, want)
+	}
+	f := &dockerx.Fake{}
+	if err := copyState(f, "src", "dst", ex); err != nil {
+		t.Fatalf("copyState: %v", err)
+	}
+	if len(f.ExecCalls) != 4 || !strings.Contains(strings.Join(f.ExecCalls[0], " "), "'--exclude=workspace/app'") {
+		t.Fatalf("ExecCalls = %v", f.ExecCalls)
+	}
+	if len(f.CPCalls) != 2 || f.CPCalls[0][0] != "src:"+cloneArchive || f.CPCalls[1][1] != "dst:"+cloneArchive {
+		t.Fatalf("CPCalls = %v", f.CPCalls)
+	}
+}
+
+func TestSessionArchiveRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	img := filepath.Join(dir, "image.tar")
+	if err := os.WriteFile(img, []byte("layers"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := SessionManifest{Name: "claudex-app-1234", Signature: "1234", Mounts: []string{"/src/app"}, Image: "claudex-session-x:latest"}
+	for _, ext := range []string{".tar", ".tar.gz"} {
+		file := filepath.Join(dir, "session"+ext)
+		if err := writeSessionArchive(file, m, map[string]string{imageFile: img, transcripts + "/t.jsonl": img}); err != nil {
+			t.Fatalf("write %s: %v", ext, err)
+		}
+		out := t.TempDir()
+		got, err := readSessionArchive(file, out)
+		if err != nil {
+			t.Fatalf("read %s: %v", ext, err)
+		}
+		if got.Name != m.Name || got.Image != m.Image || len(got.Mounts) != 1 {
+			t.Fatalf("manifest = %+v", got)
+		}
+		if b, _ := os.ReadFile(filepath.Join(out, transcripts, "t.jsonl")); string(b) != "layers" {
+			t.Fatalf("transcript not extracted (%s): %q", ext, b)
+		}
+	}
+	if _, err := readSessionArchive(img, t.TempDir()); err == nil {
+		t.Fatalf("expected error for a non-archive")
+	}
+}
+
+func TestRestoreWorkspaceBundle(t *testing.T) {
+	f := &dockerx.Fake{ExecOutputOut: []byte("")}
+	var out, errOut bytes.Buffer
+	restoreWorkspaceBundle(f, "c", "/tmp/x/workspace.bundle", &out, &errOut)
+	if len(f.CPCalls) != 1 || f.CPCalls[0][1] != "c:"+bundleRemote {
+		t.Fatalf("cp = %v", f.CPCalls)
+	}
+	if call := f.ExecOutputCalls[0]; call[len(call)-1] != bundleRemote || !strings.Contains(out.String(), "Restored") {
+		t.Fatalf("exec = %v, out %q", call, out.String())
+	}
+	out.Reset()
+	f.ExecOutputOut = []byte("present\n")
+	restoreWorkspaceBundle(f, "c", "/tmp/x/workspace.bundle", &out, &errOut)
+	if out.Len() != 0 || errOut.Len() != 0 {
+		t.Fatalf("history in the image should be kept quietly: %q %q", out.String(), errOut.String())
+	}
+}
+
+func TestBuildRunArgsImage(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	args, err := Options{Name: "n", Image: "claudex-session-n:latest"}.BuildRunArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(args[len(args)-4:len(args)-1], " "); got != "claudex-session-n:latest sh -c" {
+		t.Fatalf("tail args = %q", got)
+	}
+}
+
+func TestMaybeInitFirewallPassesAllowedHosts(t *testing.T) {
+	f := &dockerx.Fake{}
+	var out, errOut bytes.Buffer
+	maybeInitFirewall(true, f, "c", &out, &errOut, "pypi.org", "bad;host")
+	if got := f.ExecCalls[0][5]; got != "/usr/local/bin/init-firewall.sh --allow pypi.org" {
+		t.Fatalf("firewall command = %q", got)
+	}
+}
+
+func TestMaybeInitFirewallFingerprintsAllowlist(t *testing.T) {
+	f := &dockerx.Fake{}
+	var out, errOut bytes.Buffer
+	maybeInitFirewall(true, f, "c", &out, &errOut, "pypi.org")
+	check := f.ExecOutputCalls[0]
+	if check[1] != "sh" || check[3] != firewallCurrentScript || strings.Join(check[4:], " ") != "sh --allow pypi.org" {
+		t.Fatalf("fingerprint check = %v", check)
+	}
+	if len(f.ExecCalls) != 1 {
+		t.Fatalf("expected init without a current marker, got %v", f.ExecCalls)
+	}
+}
+
+func TestAutoCommitFlagLabelAndLoop(t *testing.T) {
+	if _, err := ParseArgs([]string{"--auto-commit", "10s"}); err == nil {
+		t.Fatalf("expected intervals under a minute to be rejected")
+	}
+	o, err := ParseArgs([]string{"--auto-commit", "10m", "--name", "n"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	args, _ := o.BuildRunArgs()
+	if !strings.Contains(strings.Join(args, " "), "--label "+AutoCommitLabel+"=10m0s") {
+		t.Fatalf("missing auto-commit label: %v", args)
+	}
+	f := &dockerx.Fake{}
+	var out, errOut bytes.Buffer
+	maybeStartAutoCommit(o.AutoCommit, f, "n", &out, &errOut)
+	if len(f.ExecCalls) != 1 || f.ExecCalls[0][0] != "-d" || f.ExecCalls[0][1] != "n" || f.ExecCalls[0][len(f.ExecCalls[0])-1] != "600" {
+		t.Fatalf("unexpected exec: %v", f.ExecCalls)
+	}
+}
+
+func TestHistoryMountPerSignature(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	o, err := ParseArgs([]string{"--name", "n"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if err := o.Derive(); err != nil {
+		t.Fatalf("derive: %v", err)
+	}
+	want, _ := HistoryDir(o.Signature)
+	if o.HistoryDir != want {
+		t.Fatalf("HistoryDir = %q, want %q", o.HistoryDir, want)
+	}
+	args, _ := o.BuildRunArgs()
+	joined := strings.Join(args, " ")
+	if !strings.Contains(joined, "-v "+want+":"+HistoryMount) || !strings.Contains(joined, "HISTFILE="+HistoryMount+"/bash_history") {
+		t.Fatalf("missing history mount: %v", args)
+	}
+}
+
+func TestShellSelection(t *testing.T) {
+	if _, err := ParseArgs([]string{"--shell"}); err == nil {
+		t.Fatalf("expected --shell without a value to fail")
+	}
+	if err := validateShell("tcsh"); err == nil {
+		t.Fatalf("expected tcsh to be rejected")
+	}
+	t.Setenv("HOME", t.TempDir())
+	dots := t.TempDir()
+	o := Options{Name: "n", Shell: ShellFish, DotfilesDir: dots}
+	args, _ := o.BuildRunArgs()
+	joined := strings.Join(args, " ")
+	if !strings.Contains(joined, "--label "+ShellLabel+"=fish") || !strings.Contains(joined, "-v "+dots+":"+DotfilesMount+":ro") {
+		t.Fatalf("missing shell label or dotfiles mount: %v", args)
+	}
+	if got := strings.Join(shellCommand(ShellFish), " "); got != "env XDG_DATA_HOME="+HistoryMount+" fish -l" {
+		t.Fatalf("fish command = %q", got)
+	}
+	if got := shellCommand(""); len(got) != 1 || got[0] != "bash" {
+		t.Fatalf("default command = %v", got)
+	}
+	f := &dockerx.Fake{}
+	var out, errOut bytes.Buffer
+	maybeInjectDotfiles(dots, f, "n", &out, &errOut)
+	if len(f.ExecCalls) != 1 || !strings.Contains(strings.Join(f.ExecCalls[0], " "), "cp -rT "+DotfilesMount+" /home/node") {
+		t.Fatalf("unexpected exec: %v", f.ExecCalls)
+	}
+}
+
+func TestAttachEnvReachesExecOnly(t *testing.T) {
+	if _, err := ParseArgs([]string{"--attach-env", "1X=y"}); err == nil {
+		t.Fatalf("expected a key starting with a digit to be rejected")
+	}
+	o, err := ParseArgs([]string{"--attach-env", "TOKEN=abc", "--attach-env", "DEBUG", "."})
+	if err != nil || strings.Join(o.AttachEnv, ",") != "TOKEN=abc,DEBUG" {
+		t.Fatalf("attach env = %v, %v", o.AttachEnv, err)
+	}
+	args, _ := o.BuildRunArgs()
+	if strings.Contains(strings.Join(args, " "), "TOKEN") {
+		t.Fatalf("attach env leaked into docker run: %v", args)
+	}
+
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	f := &dockerx.Fake{Containers: map[string]dockerx.Container{
+		"c": {Name: "c", Status: "running", Labels: map[string]string{"com.claudex.signature": "s"}},
+	}}
+	var out, errOut bytes.Buffer
+	if err := Attach("c", AttachOptions{Env: []string{"A=1 2", "B"}}, nil, &out, &errOut, f); err != nil {
+		t.Fatalf("attach: %v", err)
+	}
+	var got []string
+	for _, c := range f.Calls {
+		if c.Method == "ExecInteractive" {
+			got = c.Args
+		}
+	}
+	if strings.Join(got, "|") != "-e|A=1 2|-e|B|c|bash" {
+		t.Fatalf("exec args = %q", got)
+	}
+	if err := Attach("c", AttachOptions{Env: []string{"=x"}}, nil, &out, &errOut, f); err == nil {
+		t.Fatalf("expected an empty key to be rejected")
+	}
+}
+
+func TestAttachStartsInHostWorkdir(t *testing.T) {
+	mounts := []string{"/src/app", "/src/app/vendor/lib", "/src/api"}
+	for cwd, want := range map[string]string{
+		"/src/app":              "/workspace/app",
+		"/src/app/cmd":          "/workspace/app",
+		"/src/app/vendor/lib/x": "/workspace/lib",
+		"/src/apix":             "",
+		"/home/me":              "",
+	} {
+		if got := workdirFor(mounts, cwd); got != want {
+			t.Errorf("workdirFor(%s) = %q, want %q", cwd, got, want)
+		}
+	}
+	if got := (AttachOptions{Workdir: "api/cmd"}).shellWorkdir(nil); got != "/workspace/api/cmd" {
+		t.Fatalf("relative --workdir = %q", got)
+	}
+
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	f := &dockerx.Fake{Containers: map[string]dockerx.Container{
+		"c": {Name: "c", Status: "running", Labels: map[string]string{"com.claudex.signature": "s", "com.claudex.mounts": `["` + dir + `"]`}},
+	}}
+	var out, errOut bytes.Buffer
+	if err := Attach("c", AttachOptions{}, nil, &out, &errOut, f); err != nil {
+		t.Fatalf("attach: %v", err)
+	}
+	if err := Attach("c", AttachOptions{Workdir: "/tmp"}, nil, &out, &errOut, f); err != nil {
+		t.Fatalf("attach: %v", err)
+	}
+	var got []string
+	for _, c := range f.Calls {
+		if c.Method == "ExecInteractive" {
+			got = append(got, strings.Join(c.Args, " "))
+		}
+	}
+	want := []string{"-w /workspace/" + filepath.Base(dir) + " c bash", "-w /tmp c bash"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("exec args = %q, want %q", got, want)
+	}
+}
+
+func TestPreflightReportsRefusedModesAndUnsharedMounts(t *testing.T) {
+	f := &dockerx.Fake{InfoOut: dockerx.EngineInfo{Runtimes: []string{"io.containerd.runc.v2", "runc"}, SecurityOptions: []string{"name=seccomp,profile=builtin", "name=userns"}}}
+	o := Options{NestedDocker: NestedSysbox}
+	if err := o.preflight(f, nil); err == nil || !strings.Contains(err.Error(), "sysbox-runc") || !strings.Contains(err.Error(), "--no-preflight") {
+		t.Fatalf("sysbox without the runtime: %v", err)
+	}
+	o.NestedDocker = NestedDind
+	if err := o.preflight(f, nil); err == nil || !strings.Contains(err.Error(), "userns-remap") {
+		t.Fatalf("dind under userns-remap: %v", err)
+	}
+	o.SkipPreflight = true
+	if err := o.preflight(f, nil); err != nil {
+		t.Fatalf("--no-preflight still checked: %v", err)
+	}
+	f = &dockerx.Fake{InfoErr: errors.New("no info")}
+	if err := (Options{NestedDocker: NestedSysbox}).preflight(f, nil); err != nil {
+		t.Fatalf("an engine without info should skip the checks: %v", err)
+	}
+
+	shared, other := t.TempDir(), t.TempDir()
+	args := []string{"run", "-v", shared + "/app:/workspace/app", "-v", "claudex-vol:/data", "--mount", "type=bind,source=" + other + ",target=/x"}
+	srcs := bindSources(args)
+	if strings.Join(srcs, ",") != shared+"/app,"+other {
+		t.Fatalf("bindSources = %v", srcs)
+	}
+	if got := unsharedMounts(srcs, []string{shared}); len(got) != 1 || got[0] != other {
+		t.Fatalf("unshared = %v, want only %s", got, other)
+	}
+}
+
+func TestWarnLargeMountsNamesBigDirs(t *testing.T) {
+	defer func(n int) { largeMountFiles = n }(largeMountFiles)
+	largeMountFiles = 10
+	app := t.TempDir()
+	for dir, n := range map[string]int{"node_modules/x": 8, "data": 4, "src": 1, ".git/objects": 20} {
+		if err := os.MkdirAll(filepath.Join(app, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < n; i++ {
+			if err := os.WriteFile(filepath.Join(app, dir, fmt.Sprintf("f%d", i)), []byte("x"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	var errOut strings.Builder
+	o := Options{Normalized: []string{app}}
+	o.warnLargeMounts(&errOut)
+	if !strings.Contains(errOut.String(), "13 files") || !strings.Contains(errOut.String(), "--exclude node_modules --exclude data, or --workspace-volume") {
+		t.Fatalf("warning: %q", errOut.String())
+	}
+	errOut.Reset()
+	o.Excludes = []string{"node_modules"}
+	o.warnLargeMounts(&errOut)
+	if errOut.Len() != 0 {
+		t.Fatalf("excluded files still counted: %q", errOut.String())
+	}
+}
+
+func TestHostNetworkFallsBackToPublishedPorts(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	f := &dockerx.Fake{InfoOut: dockerx.EngineInfo{OperatingSystem: "Docker Desktop"}}
+	var errOut bytes.Buffer
+	o := Options{Name: "n", UseHostNetwork: true}
+	o.hostNetworkFallback(f, &errOut)
+	if o.UseHostNetwork || len(o.PublishPorts) != 2 || !strings.Contains(errOut.String(), "host.docker.internal") {
+		t.Fatalf("fallback not applied: %+v, %q", o, errOut.String())
+	}
+	args, _ := o.BuildRunArgs()
+	joined := strings.Join(args, " ")
+	if strings.Contains(joined, "--network host") || !strings.Contains(joined, "-p 127.0.0.1:1455:1455 -p 127.0.0.1:8810:8810 --label "+PublishedPortsLabel+"=1455,8810") {
+		t.Fatalf("run args = %v", args)
+	}
+	if !strings.Contains(forwardScript(o.PublishPorts), "for p in 1455 8810;") {
+		t.Fatalf("forward script = %q", forwardScript(o.PublishPorts))
+	}
+	rec := strings.Join(recreateArgs(dockerx.Container{}, "n", "img", map[string]string{PublishedPortsLabel: "1455,x"}), " ")
+	if !strings.Contains(rec, "-p 127.0.0.1:1455:1455") || strings.Contains(rec, "x:") {
+		t.Fatalf("recreate args = %s", rec)
+	}
+
+	if runtime.GOOS == "linux" {
+		native := Options{Name: "n", UseHostNetwork: true, FallbackPorts: []int{9000}}
+		native.hostNetworkFallback(&dockerx.Fake{InfoOut: dockerx.EngineInfo{OperatingSystem: "Ubuntu 24.04 LTS"}}, &errOut)
+		if !native.UseHostNetwork || native.PublishPorts != nil {
+			t.Fatalf("native engine lost host networking: %+v", native)
+		}
+	}
+}
+
+func TestWorkspaceFlagUsesSavedDirs(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	a, b := t.TempDir(), t.TempDir()
+	err := state.Update(func(s *state.Store) error {
+		s.SetWorkspace(state.Workspace{Name: "acme", Dirs: []string{a, b}})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, _ := ParseArgs([]string{"--workspace", "acme"})
+	if err := o.Derive(); err != nil {
+		t.Fatalf("derive: %v", err)
+	}
+	if len(o.Normalized) != 2 || o.Slug != "acme" {
+		t.Fatalf("normalized=%v slug=%q", o.Normalized, o.Slug)
+	}
+	args, _ := o.BuildRunArgs()
+	if !strings.Contains(strings.Join(args, " "), "--label "+WorkspaceLabel+"=acme") {
+		t.Fatalf("missing workspace label: %v", args)
+	}
+	bad, _ := ParseArgs([]string{"--workspace", "nope"})
+	if err := bad.Derive(); err == nil {
+		t.Fatalf("expected unknown workspace to fail")
+	}
+}
+
+func TestPathAliasesShareSignature(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	cfgDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", cfgDir)
+	if err := os.MkdirAll(filepath.Join(cfgDir, "claudex"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	derive := func(checkout string) Options {
+		t.Helper()
+		home := t.TempDir()
+		t.Setenv("HOME", home)
+		dir := filepath.Join(home, checkout, "acme")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		cfg := "pathAliases:\n  ~/" + checkout + "/acme: /workspace/acme\n"
+		if err := os.WriteFile(filepath.Join(cfgDir, "claudex", "config.yaml"), []byte(cfg), 0644); err != nil {
+			t.Fatal(err)
+		}
+		o := Options{Workdirs: []string{dir}}
+		if err := o.Derive(); err != nil {
+			t.Fatalf("derive: %v", err)
+		}
+		return o
+	}
+	a, b := derive("src"), derive("code")
+	if a.Signature != b.Signature || a.Name != b.Name {
+		t.Fatalf("aliased checkouts differ: %s/%s vs %s/%s", a.Name, a.Signature, b.Name, b.Signature)
+	}
+}
+
+func TestMigrateMovesStateAndRetiresOld(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	oldDir, newDir := t.TempDir(), t.TempDir()
+	info := dockerx.Container{Name: "c", Status: "running", Labels: map[string]string{
+		"com.claudex.signature": "s", "com.claudex.mounts": `["` + oldDir + `"]`,
+	}}
+	f := &dockerx.Fake{Containers: map[string]dockerx.Container{"c": info}}
+	o := Options{Name: "c", Normalized: []string{newDir}, Detach: true, SkipGit: true}
+	var out, errOut bytes.Buffer
+	if err := o.migrate(&info, true, nil, &out, &errOut, f, nil); err != nil {
+		t.Fatalf("migrate: %v\n%s", err, errOut.String())
+	}
+	if len(f.RunCalls) < 2 || f.RunCalls[0][0] != "rename" || f.RunCalls[0][1] != "c" {
+		t.Fatalf("expected rename before create, got %v", f.RunCalls)
+	}
+	retired := f.RunCalls[0][2]
+	if len(f.RemoveCalls) != 1 || f.RemoveCalls[0] != retired {
+		t.Fatalf("expected %s to be removed, got %v", retired, f.RemoveCalls)
+	}
+	if len(f.CPCalls) != 2 || !strings.HasPrefix(f.CPCalls[0][0], retired+":") || !strings.HasPrefix(f.CPCalls[1][1], "c:") {
+		t.Fatalf("expected state copied from %s to c, got %v", retired, f.CPCalls)
+	}
+	archive := strings.Join(f.ExecCalls[0], " ")
+	if !strings.Contains(archive, "--exclude=workspace/"+filepath.Base(oldDir)) || !strings.Contains(archive, "--exclude=workspace/"+filepath.Base(newDir)) {
+		t.Fatalf("bind mounts should be excluded: %s", archive)
+	}
+
+	// A failed copy removes the new container and renames the old one back.
+	f = &dockerx.Fake{Containers: map[string]dockerx.Container{"c": info}, CPErr: errors.New("boom")}
+	if err := o.migrate(&info, true, nil, &out, &errOut, f, nil); err == nil {
+		t.Fatalf("expected failure")
+	}
+	last := f.RunCalls[len(f.RunCalls)-1]
+	if last[0] != "rename" || last[2] != "c" || len(f.RemoveCalls) != 1 || f.RemoveCalls[0] != "c" {
+		t.Fatalf("expected rollback, got runs %v removes %v", f.RunCalls, f.RemoveCalls)
+	}
+}
+
+func TestCowCopiesInsteadOfMounting(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	o := Options{Name: "c", Normalized: []string{dir}, Cow: true}
+	args, _ := o.BuildRunArgs()
+	joined := strings.Join(args, " ")
+	if strings.Contains(joined, dir+":/workspace/") || !strings.Contains(joined, "--label "+CowLabel+"=true") {
+		t.Fatalf("cow should not bind-mount: %v", args)
+	}
+	f := &dockerx.Fake{}
+	var out bytes.Buffer
+	if err := o.copyWorkspaceIn(f, &out); err != nil {
+		t.Fatal(err)
+	}
+	dest := "/workspace/" + filepath.Base(dir)
+	if len(f.CPCalls) != 1 || f.CPCalls[0] != [2]string{dir, "c:" + dest} {
+		t.Fatalf("cp calls = %v", f.CPCalls)
+	}
+	if got := strings.Join(f.ExecCalls[0], " "); got != "-u root c chown -R --reference=/home/node "+dest {
+		t.Fatalf("chown = %q", got)
+	}
+}
+
+func TestWorkspaceVolumeMountsVolume(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	o := Options{Name: "c", Signature: "abc", Normalized: []string{dir}, WorkspaceVolume: true}
+	args, _ := o.BuildRunArgs()
+	joined := strings.Join(args, " ")
+	if strings.Contains(joined, dir+":/workspace/") || !strings.Contains(joined, "-v claudex-ws-abc:/workspace") {
+		t.Fatalf("workspace volume should replace bind mounts: %v", args)
+	}
+	f := &dockerx.Fake{}
+	var out bytes.Buffer
+	if err := SyncVolume(f, "claudex", "claudex-ws-abc", []string{dir}, SyncOptions{Delete: true}, &out); err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(f.RunCalls[0], " ")
+	base := filepath.Base(dir)
+	if !strings.Contains(got, "-v "+dir+":/host:ro") || !strings.HasSuffix(got, "rsync -rlpt --delete /host/ /workspace/"+base+"/ && chown -R --reference=/home/node /workspace/"+base) {
+		t.Fatalf("sync run = %q", got)
+	}
+}
+
+func TestRunDetachPrintsOnlyName(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := t.TempDir()
+	f := &dockerx.Fake{ImageExistsVal: true, Containers: map[string]dockerx.Container{"c": {Name: "c", Status: "running", Labels: map[string]string{"com.claudex.signature": "s"}}}}
+	var out, errOut bytes.Buffer
+	if err := Run([]string{dir, "--detach", "--name", "c", "--no-git"}, nil, &out, &errOut, f); err != nil {
+		t.Fatalf("run: %v\n%s", err, errOut.String())
+	}
+	if out.String() != "c\n" || !strings.Contains(errOut.String(), "Reusing container c") {
+		t.Fatalf("stdout %q, stderr %q", out.String(), errOut.String())
+	}
+}
+
+func TestReuseSkipsImageCheckAndCurrentFirewall(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	f := &dockerx.Fake{
+		ImageExistsErr: errors.New("image check should be skipped"),
+		Containers:     map[string]dockerx.Container{"c": {Name: "c", Status: "running", Labels: map[string]string{"com.claudex.signature": "s"}}},
+		ExecOutputFunc: func(name string, cmd []string) ([]byte, error) {
+			if strings.Contains(strings.Join(cmd, " "), "/run/claudex-firewall") {
+				return []byte("current\n"), nil
+			}
+			return nil, nil
+		},
+	}
+	var out, errOut bytes.Buffer
+	if err := Run([]string{t.TempDir(), "--detach", "--name", "c", "--firewall", "--verbose"}, nil, &out, &errOut, f); err != nil {
+		t.Fatalf("run: %v\n%s", err, errOut.String())
+	}
+	if len(f.ExecCalls) != 0 || strings.Contains(errOut.String(), "Initializing firewall") {
+		t.Fatalf("firewall should not re-run: %v\n%s", f.ExecCalls, errOut.String())
+	}
+	if !strings.Contains(errOut.String(), "[timing] firewall") {
+		t.Fatalf("expected timings with --verbose:\n%s", errOut.String())
+	}
+}
+
+func TestReuseKeepsSlowOrProtectedContainers(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	saved := StartWait
+	StartWait = dockerx.Backoff{Initial: time.Millisecond, Timeout: 20 * time.Millisecond}
+	defer func() { StartWait = saved }()
+	labels := map[string]string{"com.claudex.signature": "s", ReadyLabel: ReadyMarker}
+	// Started, but its ready marker never appears.
+	f := &dockerx.Fake{Simulate: true, ExecOutputErr: errors.New("exit status 1"),
+		Containers: map[string]dockerx.Container{"c": {Name: "c", Status: "exited", Labels: labels}}}
+	var out, errOut bytes.Buffer
+	if err := Run([]string{t.TempDir(), "--detach", "--name", "c", "--no-git"}, nil, &out, &errOut, f); err != nil {
+		t.Fatalf("run: %v\n%s", err, errOut.String())
+	}
+	if len(f.RemoveCalls) != 0 || len(f.RunCalls) != 0 || !strings.Contains(errOut.String(), "was not ready") {
+		t.Fatalf("a slow start must not recreate the container: removed %v, ran %d\n%s", f.RemoveCalls, len(f.RunCalls), errOut.String())
+	}
+
+	protected := map[string]string{"com.claudex.signature": "s", ProtectedLabel: "true"}
+	f = &dockerx.Fake{Containers: map[string]dockerx.Container{"c": {Name: "c", Status: "exited", ExitCode: 1, Labels: protected}}}
+	err := Run([]string{t.TempDir(), "--detach", "--name", "c", "--no-git"}, nil, &out, &errOut, f)
+	if err == nil || !strings.Contains(err.Error(), "protected") || len(f.RemoveCalls) != 0 {
+		t.Fatalf("a protected container must not be recreated: %v, removed %v", err, f.RemoveCalls)
+	}
+}
+
+func TestProtectKeepsNoSudo(t *testing.T) {
+	f := &dockerx.Fake{Simulate: true, Containers: map[string]dockerx.Container{
+		"c": {Name: "c", Status: "running", SecurityOpt: []string{"no-new-privileges"}, Labels: map[string]string{"com.claudex.signature": "s"}},
+	}}
+	if _, err := SetProtected("c", true, io.Discard, io.Discard, f); err != nil {
+		t.Fatalf("protect: %v", err)
+	}
+	var created []string
+	for _, c := range f.RunCalls {
+		if c[0] == "run" || c[0] == "create" {
+			created = c
+		}
+	}
+	if !strings.Contains(strings.Join(created, " "), "--security-opt no-new-privileges") {
+		t.Fatalf("recreated without no-new-privileges: %v", created)
+	}
+}
+
+func TestAgentDocsDescribeSandbox(t *testing.T) {
+	t.Setenv("GITHUB_MCP_PAT", "")
+	o := Options{Name: "c", Normalized: []string{"/src/api"}, Firewall: true, NestedDocker: NestedSocket,
+		HostGitMounts: map[string]string{"/src/api": HostGitEmpty}}
+	doc := o.renderAgentDocs(true, true)
+	for _, want := range []string{"<!-- claudex:sandbox -->\n", "`/workspace/api` from `/src/api`; its .git is hidden", "limited by a firewall", "host's Docker socket", "**MCP servers**: none installed.", "<!-- /claudex:sandbox -->"} {
+		if !strings.Contains(doc, want) {
+			t.Fatalf("docs missing %q:\n%s", want, doc)
+		}
+	}
+	o = Options{Name: "c", Normalized: []string{"/src/api"}, Cow: true, SkipGit: true}
+	doc = o.renderAgentDocs(false, true)
+	for _, want := range []string{"private copies", "unrestricted outbound", "**Docker**: not available.", "google-docs-mcp", "no repository is initialized"} {
+		if !strings.Contains(doc, want) {
+			t.Fatalf("docs missing %q:\n%s", want, doc)
+		}
+	}
+	f := &dockerx.Fake{}
+	o.writeAgentDocs(f, &bytes.Buffer{})
+	if len(f.ExecCalls) != 1 || f.ExecCalls[0][len(f.ExecCalls[0])-1] != doc {
+		t.Fatalf("exec calls = %v", f.ExecCalls)
+	}
+}
+
+func TestWaitReadyDistinguishesCrashFromSlowStart(t *testing.T) {
+	saved := StartWait
+	StartWait = dockerx.Backoff{Initial: time.Millisecond, Timeout: 50 * time.Millisecond}
+	defer func() { StartWait = saved }()
+	marked := map[string]string{ReadyLabel: ReadyMarker}
+	f := &dockerx.Fake{Containers: map[string]dockerx.Container{
+		"crashed": {Name: "crashed", Status: "exited", ExitCode: 2, Labels: marked},
+		"slow":    {Name: "slow", Status: "running", Labels: marked},
+		"legacy":  {Name: "legacy", Status: "running", Labels: map[string]string{}},
+	}, ExecOutputErr: errors.New("exit status 1")}
+
+	if err := waitReady(context.Background(), f, "crashed"); !errors.Is(err, errExited) || !strings.Contains(err.Error(), "code 2") {
+		t.Fatalf("crashed: %v", err)
+	}
+	if n := len(f.CallsTo("Inspect")); n != 1 {
+		t.Fatalf("an exited container should fail at once, inspected %d times", n)
+	}
+	if err := waitReady(context.Background(), f, "slow"); !errors.Is(err, errSlowStart) {
+		t.Fatalf("slow: %v", err)
+	}
+	if err := waitReady(context.Background(), f, "legacy"); err != nil {
+		t.Fatalf("containers without the ready label are ready once running: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := waitReady(ctx, f, "slow"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("canceled wait: %v", err)
+	}
+	f.ExecOutputErr = nil
+	if err := waitReady(context.Background(), f, "slow"); err != nil {
+		t.Fatalf("marked container: %v", err)
+	}
+}
+
+func TestConcurrentUpCreatesContainerOnce(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("name locks need flock")
+	}
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := t.TempDir()
+	// A slow inspect lets the other caller catch up and look too.
+	f := &slowInspect{Fake: &dockerx.Fake{ImageExistsVal: true, Simulate: true}}
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := Up([]string{"--no-git", "--name", "race", dir}, io.Discard, io.Discard, f)
+			errs <- err
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("up: %v", err)
+		}
+	}
+	var created int
+	for _, c := range f.RunCalls {
+		if c[0] == "run" || c[0] == "create" {
+			created++
+		}
+	}
+	if created != 1 {
+		t.Fatalf("container created %d times: %v", created, f.RunCalls)
+	}
+}
+
+type slowInspect struct{ *dockerx.Fake }
+
+func (s slowInspect) Inspect(name string) (dockerx.Container, error) {
+	time.Sleep(50 * time.Millisecond)
+	return s.Fake.Inspect(name)
+}
+
+func TestNameLockWaitsForHolder(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("name locks need flock")
+	}
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	first, err := lockName("c", io.Discard, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(chan *nameLock)
+	go func() {
+		second, _ := lockName("c", io.Discard, nil)
+		got <- second
+	}()
+	select {
+	case <-got:
+		t.Fatal("second lock taken while the first was held")
+	case <-time.After(3 * lockPoll):
+	}
+	first.Release()
+	first.Release()
+	select {
+	case second := <-got:
+		second.Release()
+	case <-time.After(5 * time.Second):
+		t.Fatal("second lock not taken after release")
+	}
+}
+
+func TestReconcileDuplicatesPicksAndCleans(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	sig := map[string]string{"com.claudex.signature": "s"}
+	newFake := func() *dockerx.Fake {
+		return &dockerx.Fake{Containers: map[string]dockerx.Container{
+			"app":     {Name: "app", Status: "exited", CreatedAt: time.Unix(100, 0), Labels: sig},
+			"app-200": {Name: "app-200", Status: "running", CreatedAt: time.Unix(200, 0), Labels: sig},
+			"app-300": {Name: "app-300", Status: "exited", CreatedAt: time.Unix(300, 0), Labels: map[string]string{"com.claudex.signature": "other"}},
+		}}
+	}
+
+	f := newFake()
+	o := Options{Name: "app", Signature: "s"}
+	var out, errOut bytes.Buffer
+	if err := o.reconcileDuplicates(f, ui.AutoPrompter(false), &out, &errOut); err != nil || o.Name != "app" {
+		t.Fatalf("non-interactive: %v, name %s", err, o.Name)
+	}
+	if !strings.Contains(errOut.String(), "2 containers share signature s (app, app-200)") || len(f.RemoveCalls) != 0 {
+		t.Fatalf("warning: %q, removed %v", errOut.String(), f.RemoveCalls)
+	}
+
+	out.Reset()
+	if err := o.reconcileDuplicates(f, ui.NewPrompter(strings.NewReader("2\ny\n"), &out, true), &out, &errOut); err != nil || o.Name != "app-200" {
+		t.Fatalf("pick: %v, name %s\n%s", err, o.Name, out.String())
+	}
+	if strings.Join(f.RemoveCalls, ",") != "app" || !strings.Contains(out.String(), "[1] app ") || strings.Contains(out.String(), "app-300") {
+		t.Fatalf("removed %v\n%s", f.RemoveCalls, out.String())
+	}
+
+	// --pick asks even about a single container; a blank answer keeps the
+	// derived name, here a new container.
+	f = newFake()
+	delete(f.Containers, "app")
+	o = Options{Name: "app", Signature: "s", Pick: true}
+	out.Reset()
+	if err := o.reconcileDuplicates(f, ui.NewPrompter(strings.NewReader("\n"), &out, false), &out, &errOut); err != nil || o.Name != "app" {
+		t.Fatalf("--pick default: %v, name %s", err, o.Name)
+	}
+	if !strings.Contains(out.String(), "[2] a new container, app") {
+		t.Fatalf("menu:\n%s", out.String())
+	}
+}
@@ -0,0 +1,529 @@
+package run
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/config"
+	"github.com/photodialectic/claudex/internal/containers"
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/output"
+	"github.com/photodialectic/claudex/internal/policy"
+	"github.com/photodialectic/claudex/internal/state"
+	"github.com/photodialectic/claudex/internal/version"
+	"github.com/photodialectic/claudex/internal/workspace"
+)
+
+// Files inside a session archive.
+const (
+	manifestFile = "manifest.json"
+	imageFile    = "image.tar"
+	bundleFile   = "workspace.bundle"
+	transcripts  = "transcripts"
+	// bundleRemote is where the bundle is written and read in the container.
+	bundleRemote = "/tmp/claudex-workspace.bundle"
+)
+
+// SessionManifest describes an exported session.
+type SessionManifest struct {
+	Name      string   `json:"name"`
+	Signature string   `json:"signature"`
+	Slug      string   `json:"slug"`
+	Mounts    []string `json:"mounts"`
+	// LogicalMounts are Mounts under the exporter's pathAliases; import
+	// maps them back through the importer's aliases.
+	LogicalMounts  []string          `json:"logical_mounts,omitempty"`
+	Labels         map[string]string `json:"labels"`
+	Image          string            `json:"image"`
+	ClaudexVersion string            `json:"claudex_version"`
+	ExportedAt     time.Time         `json:"exported_at"`
+	// NoSudo records --no-sudo (or policy.noSudo), which is a security
+	// option rather than a label.
+	NoSudo bool `json:"no_sudo,omitempty"`
+}
+
+// ExportSession commits the container, and bundles the image, the
+// /workspace git history, its labels and recorded transcripts into file.
+// The compression follows the extension: .zst (needs zstd), .gz/.tgz, or none.
+func ExportSession(name, file string, out, errOut io.Writer, dx dockerx.Docker) error {
+	info, err := dx.Inspect(name)
+	if err != nil {
+		return fmt.Errorf("container %s does not exist", name)
+	}
+	if !containers.IsClaudex(&info) {
+		return fmt.Errorf("%s is not a claudex container", name)
+	}
+	mounts, _ := containers.MountsFromLabel(&info)
+	m := SessionManifest{
+		Name:           name,
+		Signature:      info.Labels["com.claudex.signature"],
+		Slug:           info.Labels["com.claudex.slug"],
+		Mounts:         mounts,
+		Labels:         info.Labels,
+		NoSudo:         policy.SudoDisabled(info.SecurityOpt),
+		Image:          "claudex-session-" + strings.ToLower(name) + ":latest",
+		ClaudexVersion: version.Version,
+		ExportedAt:     time.Now().UTC(),
+	}
+	if cfg, err := config.Load(); err == nil && len(cfg.PathAliases) > 0 {
+		m.LogicalMounts = workspace.Logical(mounts, cfg.PathAliases)
+	}
+
+	tmp, err := os.MkdirTemp("", "claudex-export-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	fmt.Fprintf(out, "Committing %s as %s...\n", name, m.Image)
+	if err := dx.Run("commit", name, m.Image); err != nil {
+		return fmt.Errorf("docker commit failed: %w", err)
+	}
+	defer dx.Run("rmi", m.Image)
+	fmt.Fprintln(out, "Saving image...")
+	if err := dx.Run("save", "-o", filepath.Join(tmp, imageFile), m.Image); err != nil {
+		return fmt.Errorf("docker save failed: %w", err)
+	}
+	if info.Status == "running" {
+		if err := dx.Exec(name, "git", "-C", "/workspace", "bundle", "create", bundleRemote, "--all"); err != nil {
+			output.Warnf(errOut, "no /workspace git history exported: %v\n", err)
+		} else {
+			if err := dx.CP(name+":"+bundleRemote, filepath.Join(tmp, bundleFile)); err != nil {
+				output.Warnf(errOut, "cannot copy workspace bundle: %v\n", err)
+			}
+			_ = dx.Exec(name, "rm", "-f", bundleRemote)
+		}
+	} else {
+		output.Warnf(errOut, "%s is stopped; git history is only included in the image\n", name)
+	}
+	files := map[string]string{}
+	if st, err := state.Load(); err == nil {
+		if sess, ok := st.Get(name); ok {
+			for _, t := range sess.Transcripts {
+				if fi, err := os.Stat(t); err == nil && !fi.IsDir() {
+					files[transcripts+"/"+filepath.Base(t)] = t
+				}
+			}
+		}
+	}
+	for _, f := range []string{imageFile, bundleFile} {
+		if _, err := os.Stat(filepath.Join(tmp, f)); err == nil {
+			files[f] = filepath.Join(tmp, f)
+		}
+	}
+	fmt.Fprintf(out, "Writing %s...\n", file)
+	return writeSessionArchive(file, m, files)
+}
+
+// ImportSession loads a session archive and creates a container from it.
+// dirs replace the original mounts (required when they do not exist here).
+// nested is the container's --nested-docker mode; the archive's is not
+// carried over.
+func ImportSession(file, as, nested string, dirs []string, out, errOut io.Writer, dx dockerx.Docker) error {
+	tmp, err := os.MkdirTemp("", "claudex-import-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	m, err := readSessionArchive(file, tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(tmp, imageFile)); err != nil {
+		return fmt.Errorf("%s has no %s", file, imageFile)
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	o := Options{Name: m.Name, Signature: m.Signature, Slug: m.Slug, Image: m.Image,
+		Audit:  m.Labels["com.claudex.audit"] == "true",
+		NoSudo: m.NoSudo,
+		// Copy-on-write workspaces are part of the committed image.
+		Cow:             m.Labels[CowLabel] == "true",
+		WorkspaceVolume: m.Labels[VolumeLabel] != "",
+	}
+	if as != "" {
+		o.Name = as
+	}
+	if o.NestedDocker, err = carryNestedDocker(m.Labels, nested, errOut); err != nil {
+		return err
+	}
+	if len(dirs) > 0 {
+		norm, err := workspace.NormalizeDirs(dirs)
+		if err != nil {
+			return err
+		}
+		o.Normalized = norm
+		logical := workspace.Logical(norm, cfg.PathAliases)
+		if o.Signature, err = signatureOf(norm, logical, signatureMode(cfg)); err != nil {
+			return err
+		}
+		o.Slug = workspace.DeriveSlug(logical)
+	} else {
+		mounts := m.Mounts
+		if !allDirs(mounts) && len(m.LogicalMounts) > 0 {
+			mounts = workspace.Local(m.LogicalMounts, cfg.PathAliases)
+		}
+		for _, d := range mounts {
+			if o.Cow {
+				break // nothing is bind-mounted
+			}
+			if fi, err := os.Stat(d); err != nil || !fi.IsDir() {
+				return fmt.Errorf("original mount %s does not exist here; pass the project dirs to mount or map it with pathAliases", d)
+			}
+		}
+		o.Normalized = mounts
+	}
+	if _, err := dx.Inspect(o.Name); err == nil {
+		return fmt.Errorf("container %s already exists; pick another name with --as", o.Name)
+	}
+
+	warnIgnoredConfig(cfg.Ignored, errOut)
+	if err := o.applyPolicy(cfg.Policy); err != nil {
+		return err
+	}
+	o.Owner = ownerFrom(cfg)
+
+	fmt.Fprintf(out, "Loading image %s...\n", m.Image)
+	if err := dx.Run("load", "-i", filepath.Join(tmp, imageFile)); err != nil {
+		return fmt.Errorf("docker load failed: %w", err)
+	}
+	fmt.Fprintf(out, "Creating container %s...\n", o.Name)
+	warnDockerSocket(o, errOut)
+	if o.HistoryDir, err = HistoryDir(o.Signature); err != nil {
+		return err
+	}
+	if err := o.prepareHost(out); err != nil {
+		return err
+	}
+	runArgs, err := o.BuildRunArgs()
+	if err != nil {
+		return err
+	}
+	if o.WorkspaceVolume {
+		// The volume does not travel with the archive; fill it from the dirs.
+		if err := SyncVolume(dx, o.image(), VolumeName(o.Signature), o.Normalized, SyncOptions{}, out); err != nil {
+			return err
+		}
+	}
+	if err := o.runContainer(dx, runArgs, errOut); err != nil {
+		return fmt.Errorf("docker run failed: %w", err)
+	}
+	if err := waitReady(dockerx.Context(), dx, o.Name); err != nil {
+		o.abandon(dx, errOut)
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(tmp, bundleFile)); err == nil {
+		restoreWorkspaceBundle(dx, o.Name, filepath.Join(tmp, bundleFile), out, errOut)
+	}
+	maybeInitFirewall(o.Firewall, dx, o.Name, out, errOut)
+	maybeStartDockerd(o.NestedDocker, dx, o.Name, out, errOut)
+
+	sess := state.Session{Name: o.Name, Signature: o.Signature, Slug: o.Slug, Mounts: o.Normalized, CreatedAt: time.Now()}
+	if paths, err := keepTranscripts(tmp, o.Name); err != nil {
+		output.Warnf(errOut, "cannot keep transcripts: %v\n", err)
+	} else {
+		sess.Transcripts = paths
+	}
+	recordSession(sess, errOut)
+	notifyCreated(o, errOut)
+	fmt.Fprintf(out, "Imported %s as %s. Attach with: claudex attach %s\n", m.Name, o.Name, o.Name)
+	return nil
+}
+
+// restoreBundleScript recreates /workspace/.git from the bundle at $1 when
+// the container has none, as when /workspace is a volume that hides what the
+// committed image holds there. Files in /workspace are kept; only the index
+// is reset to the restored HEAD.
+const restoreBundleScript = `cd /workspace || exit 1
+[ -e .git ] && { echo present; exit 0; }
+rm -rf /tmp/claudex-restore
+git clone -q --no-checkout "$1" /tmp/claudex-restore || exit 1
+mv /tmp/claudex-restore/.git .git && rm -rf /tmp/claudex-restore
+git remote remove origin && git reset -q`
+
+// restoreWorkspaceBundle restores the exported /workspace git history into
+// the imported container name unless its image already carries it.
+func restoreWorkspaceBundle(dx dockerx.Docker, name, bundle string, out, errOut io.Writer) {
+	if err := dx.CP(bundle, name+":"+bundleRemote); err != nil {
+		output.Warnf(errOut, "cannot copy workspace bundle: %v\n", err)
+		return
+	}
+	defer dx.Exec(name, "rm", "-f", bundleRemote)
+	res, err := dx.ExecOutput(name, []string{"bash", "-c", restoreBundleScript, "claudex-restore", bundleRemote})
+	if err != nil {
+		output.Warnf(errOut, "cannot restore /workspace git history: %v\n", err)
+		return
+	}
+	if strings.TrimSpace(string(res)) != "present" {
+		fmt.Fprintln(out, "Restored /workspace git history from the archive")
+	}
+}
+
+// keepTranscripts moves extracted transcripts into the data dir.
+func keepTranscripts(tmp, name string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(tmp, transcripts))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	dir, err := state.Dir()
+	if err != nil {
+		return nil, err
+	}
+	dest := filepath.Join(dir, transcripts, name)
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(tmp, transcripts, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		p := filepath.Join(dest, e.Name())
+		if err := os.WriteFile(p, data, 0644); err != nil {
+			return nil, err
+		}
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
+
+// writeSessionArchive writes the manifest followed by files (archive name -> host path).
+func writeSessionArchive(file string, m SessionManifest, files map[string]string) (err error) {
+	w, err := compressWriter(file)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	tw := tar.NewWriter(w)
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: manifestFile, Mode: 0644, Size: int64(len(data)), ModTime: m.ExportedAt}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(files))
+	for n := range files {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		if err := addFile(tw, n, files[n]); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func addFile(tw *tar.Writer, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: fi.Size(), ModTime: fi.ModTime()}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// readSessionArchive extracts file into dir and returns its manifest.
+func readSessionArchive(file, dir string) (SessionManifest, error) {
+	var m SessionManifest
+	r, err := decompressReader(file)
+	if err != nil {
+		return m, err
+	}
+	defer r.Close()
+	tr := tar.NewReader(r)
+	found := false
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return m, fmt.Errorf("read %s: %w", file, err)
+		}
+		clean := filepath.Clean(filepath.FromSlash(h.Name))
+		if h.Typeflag != tar.TypeReg || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if clean == manifestFile {
+			if err := json.NewDecoder(tr).Decode(&m); err != nil {
+				return m, fmt.Errorf("invalid manifest in %s: %w", file, err)
+			}
+			found = true
+			continue
+		}
+		dest := filepath.Join(dir, clean)
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return m, err
+		}
+		f, err := os.Create(dest)
+		if err != nil {
+			return m, err
+		}
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			return m, err
+		}
+		if err := f.Close(); err != nil {
+			return m, err
+		}
+	}
+	if !found {
+		return m, fmt.Errorf("%s is not a claudex session archive (no %s)", file, manifestFile)
+	}
+	return m, nil
+}
+
+// compressWriter creates file, compressing by extension.
+func compressWriter(file string) (io.WriteCloser, error) {
+	f, err := os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.HasSuffix(file, ".zst"):
+		cmd := exec.Command("zstd", "-q", "-c")
+		cmd.Stdout = f
+		in, err := cmd.StdinPipe()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("zstd is required for .zst archives (or use .tar.gz): %w", err)
+		}
+		return &cmdWriter{WriteCloser: in, cmd: cmd, f: f}, nil
+	case strings.HasSuffix(file, ".gz"), strings.HasSuffix(file, ".tgz"):
+		return &gzipWriter{Writer: gzip.NewWriter(f), f: f}, nil
+	default:
+		return f, nil
+	}
+}
+
+// decompressReader opens file, decompressing by extension.
+func decompressReader(file string) (io.ReadCloser, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.HasSuffix(file, ".zst"):
+		cmd := exec.Command("zstd", "-q", "-d", "-c")
+		cmd.Stdin = f
+		out, err := cmd.StdoutPipe()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("zstd is required for .zst archives: %w", err)
+		}
+		return &cmdReader{ReadCloser: out, cmd: cmd, f: f}, nil
+	case strings.HasSuffix(file, ".gz"), strings.HasSuffix(file, ".tgz"):
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &gzipReader{Reader: zr, f: f}, nil
+	default:
+		return f, nil
+	}
+}
+
+type cmdWriter struct {
+	io.WriteCloser
+	cmd *exec.Cmd
+	f   *os.File
+}
+
+func (w *cmdWriter) Close() error {
+	err := w.WriteCloser.Close()
+	if werr := w.cmd.Wait(); err == nil {
+		err = werr
+	}
+	if ferr := w.f.Close(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+type cmdReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+	f   *os.File
+}
+
+func (r *cmdReader) Close() error {
+	_ = r.ReadCloser.Close()
+	_ = r.cmd.Wait()
+	return r.f.Close()
+}
+
+type gzipWriter struct {
+	*gzip.Writer
+	f *os.File
+}
+
+func (w *gzipWriter) Close() error {
+	err := w.Writer.Close()
+	if ferr := w.f.Close(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+type gzipReader struct {
+	*gzip.Reader
+	f *os.File
+}
+
+func (r *gzipReader) Close() error {
+	_ = r.Reader.Close()
+	return r.f.Close()
+}
+
+// allDirs reports whether every path is an existing directory.
+func allDirs(paths []string) bool {
+	for _, p := range paths {
+		if fi, err := os.Stat(p); err != nil || !fi.IsDir() {
+			return false
+		}
+	}
+	return true
+}
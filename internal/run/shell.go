@@ -0,0 +1,149 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/output"
+)
+
+// Shells accepted by --shell and the shell config key.
+const (
+	ShellBash = "bash"
+	ShellZsh  = "zsh"
+	ShellFish = "fish"
+)
+
+// ShellLabel records the shell a container was created with so attaching
+// later without --shell uses the same one.
+const ShellLabel = "com.claudex.shell"
+
+// DotfilesMount is where the configured dotfiles dir is mounted read-only
+// before being copied into /home/node.
+const DotfilesMount = Home + "/.claudex-dotfiles"
+
+// AttachOptions adjusts the shell an attach runs.
+type AttachOptions struct {
+	// Shell is bash, zsh or fish; empty means the config default, then the
+	// container's label.
+	Shell string
+	// Env is added to the shell's environment only (docker exec -e), as
+	// KEY=VALUE or KEY to pass the host's value, so a late secret or flag
+	// needs no new container.
+	Env []string
+	// Workdir is where the shell starts, absolute or relative to
+	// /workspace; empty means the mounted dir holding the host's current
+	// directory, else the image's WORKDIR.
+	Workdir string
+}
+
+// shellWorkdir is the container directory for ao.Workdir, or for the host's
+// current directory when that lies in one of mounts.
+func (ao AttachOptions) shellWorkdir(mounts []string) string {
+	if ao.Workdir != "" {
+		if path.IsAbs(ao.Workdir) {
+			return ao.Workdir
+		}
+		return path.Join("/workspace", ao.Workdir)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	if real, err := filepath.EvalSymlinks(cwd); err == nil {
+		cwd = real
+	}
+	return workdirFor(mounts, cwd)
+}
+
+// workdirFor returns /workspace/<basename> of the mounted dir that is cwd or
+// contains it (the deepest one when mounts nest), or "" if none does.
+func workdirFor(mounts []string, cwd string) string {
+	best := ""
+	for _, m := range mounts {
+		if cwd != m && !strings.HasPrefix(cwd, strings.TrimSuffix(m, string(filepath.Separator))+string(filepath.Separator)) {
+			continue
+		}
+		if len(m) > len(best) {
+			best = m
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return "/workspace/" + filepath.Base(best)
+}
+
+// ValidateEnv checks KEY=VALUE or KEY entries for --env and --attach-env.
+func ValidateEnv(env []string) error {
+	for _, e := range env {
+		key, _, _ := strings.Cut(e, "=")
+		if key == "" || strings.TrimLeft(key, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789_") != "" || (key[0] >= '0' && key[0] <= '9') {
+			return fmt.Errorf("invalid environment entry %q (want KEY=VALUE or KEY)", e)
+		}
+	}
+	return nil
+}
+
+func validateShell(shell string) error {
+	switch shell {
+	case "", ShellBash, ShellZsh, ShellFish:
+		return nil
+	}
+	return fmt.Errorf("invalid shell %q (want bash, zsh or fish)", shell)
+}
+
+// shellCommand is the command ExecInteractive runs for shell. The image
+// points zsh at the history mount itself; fish only takes its history
+// location from XDG_DATA_HOME.
+func shellCommand(shell string) []string {
+	switch shell {
+	case ShellZsh:
+		return []string{"zsh", "-l"}
+	case ShellFish:
+		return []string{"env", "XDG_DATA_HOME=" + HistoryMount, "fish", "-l"}
+	}
+	return []string{"bash"}
+}
+
+// resolveDotfiles expands a leading ~ in the dotfiles setting and checks the
+// dir exists.
+func resolveDotfiles(dir string) (string, error) {
+	if dir == "" {
+		return "", nil
+	}
+	if dir == "~" || strings.HasPrefix(dir, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, strings.TrimPrefix(dir, "~"))
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if fi, err := os.Stat(abs); err != nil || !fi.IsDir() {
+		return "", fmt.Errorf("dotfiles: %s is not a directory", abs)
+	}
+	return abs, nil
+}
+
+// maybeInjectDotfiles copies the mounted dotfiles into /home/node, owned by
+// node, overwriting the image defaults. It runs once, on creation, so edits
+// made inside the container survive reattaching.
+func maybeInjectDotfiles(dir string, dx dockerx.Docker, name string, out, errOut io.Writer) {
+	if dir == "" {
+		return
+	}
+	if err := dx.Exec(name, "bash", "-c", "cp -rT "+DotfilesMount+" "+Home); err != nil {
+		output.Warnf(errOut, "unable to copy dotfiles: %v\n", err)
+		return
+	}
+	fmt.Fprintf(out, "Copied dotfiles from %s\n", dir)
+}
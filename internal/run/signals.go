@@ -0,0 +1,45 @@
+package run
+
+import (
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+// interrupts traps SIGINT/SIGTERM while Run is active so the CLI can clean up a
+// half-created container, or simply detach, instead of dying mid-operation.
+// Child docker processes still receive the signal from the terminal.
+type interrupts struct {
+	ch   chan os.Signal
+	done chan struct{}
+	hit  atomic.Bool
+}
+
+func trapInterrupts() *interrupts {
+	i := &interrupts{ch: make(chan os.Signal, 1), done: make(chan struct{})}
+	signal.Notify(i.ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for {
+			select {
+			case <-i.ch:
+				i.hit.Store(true)
+			case <-i.done:
+				return
+			}
+		}
+	}()
+	return i
+}
+
+// Interrupted reports whether a signal arrived since the trap was installed.
+func (i *interrupts) Interrupted() bool { return i != nil && i.hit.Load() }
+
+// Stop restores default signal handling.
+func (i *interrupts) Stop() {
+	if i == nil {
+		return
+	}
+	signal.Stop(i.ch)
+	close(i.done)
+}
@@ -0,0 +1,106 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/output"
+	"github.com/photodialectic/claudex/internal/state"
+)
+
+// --sign gives a workspace its own SSH signing key, kept on the host per
+// signature like shell history, and has git in the container sign every
+// commit and tag with it. Registering the public key once (e.g. as a GitHub
+// signing key) lets commits fetched from the sandbox satisfy repositories
+// that require signed commits, without the host's keys entering it.
+const (
+	SigningLabel = "com.claudex.signing"
+	SigningMount = Home + "/.claudex-signing"
+	// SigningKey is the private key in the signing dir; the public key is
+	// SigningKey + ".pub".
+	SigningKey = SigningMount + "/key"
+)
+
+// SigningDir returns the host dir holding the signing key for a workspace
+// signature, so the key survives container recreation.
+func SigningDir(signature string) (string, error) {
+	dir, err := state.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "signing", signature), nil
+}
+
+// signingConfig is the git configuration --sign sets. It is passed in the
+// environment, which takes precedence over any .gitconfig (dotfiles
+// included).
+var signingConfig = [][2]string{
+	{"gpg.format", "ssh"},
+	{"user.signingkey", SigningKey + ".pub"},
+	{"gpg.ssh.allowedSignersFile", SigningMount + "/allowed_signers"},
+	{"commit.gpgsign", "true"},
+	{"tag.gpgsign", "true"},
+}
+
+// signingArgs mounts the signing dir and configures git to sign with its key.
+func (o Options) signingArgs() []string {
+	if o.SigningDir == "" {
+		return nil
+	}
+	args := []string{"-v", o.SigningDir + ":" + SigningMount, "--label", SigningLabel + "=ssh"}
+	args = append(args, "-e", "GIT_CONFIG_COUNT="+strconv.Itoa(len(signingConfig)))
+	for i, kv := range signingConfig {
+		args = append(args, "-e", fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", i, kv[0]), "-e", fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", i, kv[1]))
+	}
+	return args
+}
+
+// signingSetup creates the key on first use ($1 is its comment), trusts it
+// for `git verify-commit`, and prints the public key after "new" when it was
+// just created. The key is made in the container so that the container user
+// owns it.
+const signingSetup = `set -e
+new=
+if [ ! -f ` + SigningKey + ` ]; then
+  ssh-keygen -q -t ed25519 -N '' -C "$1" -f ` + SigningKey + `
+  new=1
+fi
+printf '* namespaces="git" %s\n' "$(cat ` + SigningKey + `.pub)" >` + SigningMount + `/allowed_signers
+[ -z "$new" ] || { echo new; cat ` + SigningKey + `.pub; }`
+
+// maybeSetupSigning prepares the signing key of a --sign container and, when
+// it is new, shows the public key to register.
+func maybeSetupSigning(o Options, dx dockerx.Docker, out, errOut io.Writer) {
+	if o.SigningDir == "" {
+		return
+	}
+	res, err := dx.ExecOutput(o.Name, []string{"bash", "-c", signingSetup, "claudex-signing", "claudex-" + o.Slug})
+	if err != nil {
+		output.Warnf(errOut, "unable to set up commit signing; commits in %s will fail until `ssh-keygen` works there: %v\n", o.Name, err)
+		return
+	}
+	if pub, ok := strings.CutPrefix(strings.TrimSpace(string(res)), "new\n"); ok {
+		fmt.Fprintf(out, "Created a signing key for this workspace. Register it as an SSH signing key where signed commits are required:\n%s\n", pub)
+	}
+}
+
+// SigningPublicKey returns the public signing key of the running container
+// name, which must have been created with --sign.
+func SigningPublicKey(dx dockerx.Docker, name string) (string, error) {
+	info, err := dx.Inspect(name)
+	if err != nil {
+		return "", err
+	}
+	if info.Labels[SigningLabel] == "" {
+		return "", fmt.Errorf("%s was not created with --sign", name)
+	}
+	pub, err := dx.ExecOutput(name, []string{"cat", SigningKey + ".pub"})
+	if err != nil {
+		return "", fmt.Errorf("cannot read the signing key of %s: %w", name, err)
+	}
+	return strings.TrimSpace(string(pub)), nil
+}
@@ -0,0 +1,32 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// timings prints how long each step of a run took (--verbose). A nil
+// *timings records nothing, so call sites need no checks.
+type timings struct {
+	out         io.Writer
+	start, last time.Time
+}
+
+func newTimings(enabled bool, out io.Writer) *timings {
+	if !enabled {
+		return nil
+	}
+	now := time.Now()
+	return &timings{out: out, start: now, last: now}
+}
+
+// mark reports the time since the previous mark under step.
+func (t *timings) mark(step string) {
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	fmt.Fprintf(t.out, "[timing] %-16s %8s  (total %s)\n", step, now.Sub(t.last).Round(time.Millisecond), now.Sub(t.start).Round(time.Millisecond))
+	t.last = now
+}
@@ -0,0 +1,67 @@
+package run
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+)
+
+// --ttl labels: ExpiresLabel is the Unix time the container stops;
+// TTLActionLabel is TTLDestroy when it should also be removed (by
+// `claudex destroy --expired`, or the next run that would reuse it).
+const (
+	ExpiresLabel   = "com.claudex.expires"
+	TTLActionLabel = "com.claudex.ttl-action"
+	TTLDestroy     = "destroy"
+)
+
+// MinTTL leaves room for the warning the shell gets ttlWarning before the
+// container stops.
+const (
+	MinTTL     = 15 * time.Minute
+	ttlWarning = 10 * time.Minute
+)
+
+// parseTTL validates a --ttl duration.
+func parseTTL(v string) (time.Duration, error) {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid --ttl %q (want a duration like 4h)", v)
+	}
+	if d < MinTTL {
+		return 0, fmt.Errorf("--ttl must be at least %s", MinTTL)
+	}
+	return d, nil
+}
+
+// ttlArgs returns the docker run args for a container expiring at o.Expires:
+// the labels, and CLAUDEX_EXPIRES for the supervisor, which warns the
+// shells ttlWarning ahead and then exits, stopping the container.
+func (o Options) ttlArgs() []string {
+	if o.Expires.IsZero() {
+		return nil
+	}
+	at := strconv.FormatInt(o.Expires.Unix(), 10)
+	args := []string{"-e", "CLAUDEX_EXPIRES=" + at, "-e", "CLAUDEX_EXPIRES_WARN=" + strconv.Itoa(int(ttlWarning.Seconds())), "--label", ExpiresLabel + "=" + at}
+	if o.TTLDestroy {
+		args = append(args, "--label", TTLActionLabel+"="+TTLDestroy)
+	}
+	return args
+}
+
+// Expires returns when c stops under --ttl; ok is false without one.
+func Expires(c *dockerx.Container) (at time.Time, ok bool) {
+	n, err := strconv.ParseInt(c.Labels[ExpiresLabel], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(n, 0), true
+}
+
+// Expired reports whether c's --ttl has run out at now.
+func Expired(c *dockerx.Container, now time.Time) bool {
+	at, ok := Expires(c)
+	return ok && !now.Before(at)
+}
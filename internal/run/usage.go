@@ -0,0 +1,82 @@
+package run
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/output"
+	"github.com/photodialectic/claudex/internal/state"
+)
+
+// usageScript prints a container's usage counters as JSON: CPU time from
+// its cgroup (v2, else v1), and the tokens in the Claude Code and Codex
+// transcripts. Claude logs a message's usage on each of its content blocks,
+// so usage is keyed by message id; Codex logs running totals per session
+// file, so the last one of each file counts. (The reductions start from
+// null: find rejects a second {} in -exec ... +.)
+const usageScript = `cpu=0
+if [ -r /sys/fs/cgroup/cpu.stat ]; then
+  cpu=$(awk '$1 == "usage_usec" {printf "%.3f", $2 / 1e6}' /sys/fs/cgroup/cpu.stat)
+elif [ -r /sys/fs/cgroup/cpuacct/cpuacct.usage ]; then
+  cpu=$(awk '{printf "%.3f", $1 / 1e9}' /sys/fs/cgroup/cpuacct/cpuacct.usage)
+fi
+{
+  find /home/node/.claude/projects -name '*.jsonl' -exec jq -nRc '
+    reduce (inputs | fromjson? | .message? | select(.id? and .usage?)) as $m (null; .[$m.id] = $m.usage)
+    | [.[]?] | {in: (map((.input_tokens // 0) + (.cache_creation_input_tokens // 0) + (.cache_read_input_tokens // 0)) | add // 0),
+              out: (map(.output_tokens // 0) | add // 0)}' {} + 2>/dev/null
+  find /home/node/.codex/sessions -name '*.jsonl' -exec jq -nRc '
+    reduce (inputs | fromjson? | select(.payload.type? == "token_count") | {f: input_filename, u: .payload.info.total_token_usage?}) as $e
+      (null; if $e.u then .[$e.f] = $e.u else . end)
+    | [.[]?] | {in: (map(.input_tokens // 0) | add // 0), out: (map(.output_tokens // 0) | add // 0)}' {} + 2>/dev/null
+} | jq -sc --argjson cpu "${cpu:-0}" '{cpu_seconds: $cpu, input_tokens: (map(.in) | add // 0), output_tokens: (map(.out) | add // 0)}'`
+
+// SampleUsage reads the usage counters of the running container name.
+func SampleUsage(dx dockerx.Docker, name string) (state.UsageCounters, error) {
+	var c state.UsageCounters
+	info, err := dx.Inspect(name)
+	if err != nil {
+		return c, err
+	}
+	out, err := dx.ExecOutput(name, []string{"bash", "-c", usageScript})
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(out, &c); err != nil {
+		return c, fmt.Errorf("unreadable usage sample: %v", err)
+	}
+	c.Container, c.At = info.ID, time.Now()
+	return c, nil
+}
+
+// RecordUsage adds what name used since its last sample to the state store,
+// attached being how long a shell was attached meanwhile. When the sample
+// fails only the attach time is recorded; failures only warn.
+func RecordUsage(dx dockerx.Docker, name string, attached time.Duration, errOut io.Writer) {
+	c, serr := SampleUsage(dx, name)
+	if serr != nil {
+		output.Warnf(errOut, "unable to sample the usage of %s: %v\n", name, serr)
+	}
+	err := state.Update(func(s *state.Store) error {
+		sess, ok := s.Get(name)
+		if !ok {
+			return nil
+		}
+		if serr != nil {
+			// Measure against the last mark, so nothing is counted twice.
+			c = state.UsageCounters{}
+			if sess.UsageMark != nil {
+				c = *sess.UsageMark
+			}
+			c.At = time.Now()
+		}
+		s.AddUsage(name, attached, c)
+		return nil
+	})
+	if err != nil {
+		output.Warnf(errOut, "unable to record usage: %v\n", err)
+	}
+}
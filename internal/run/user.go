@@ -0,0 +1,105 @@
+package run
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+// Image labels recording the container user an image was built for
+// (`claudex build --user NAME --uid UID --no-sudo`). Images without them
+// run node, UID 1000, with sudo.
+const (
+	UserLabel = "com.claudex.user"
+	UIDLabel  = "com.claudex.uid"
+	SudoLabel = "com.claudex.sudo"
+)
+
+// Home is the container user's home dir, whatever the user's name.
+const Home = "/home/node"
+
+// ImageUser is the account the agent runs as in the image. Its home stays
+// Home whatever its name, since claudex mounts state there.
+type ImageUser struct {
+	Name string
+	UID  int
+	// Sudo reports whether the image lets the user run docker and the
+	// firewall script through sudo; without it the package is removed.
+	Sudo bool
+}
+
+// DefaultImageUser is the node user of the base image.
+var DefaultImageUser = ImageUser{Name: "node", UID: 1000, Sudo: true}
+
+var userNameRe = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
+
+// ParseImageUser validates build flags: name may be empty for node, uid
+// empty for 1000 or "host" for the caller's UID, which keeps files written
+// to bind mounts owned by the host user.
+func ParseImageUser(name, uid string, noSudo bool) (ImageUser, error) {
+	u := DefaultImageUser
+	if name != "" {
+		if !userNameRe.MatchString(name) || name == "root" {
+			return u, fmt.Errorf("invalid --user %q (want a lowercase login name other than root)", name)
+		}
+		u.Name = name
+	}
+	switch uid {
+	case "":
+	case "host":
+		if u.UID = os.Getuid(); u.UID <= 0 {
+			return u, fmt.Errorf("--uid host needs a non-root host user")
+		}
+	default:
+		n, err := strconv.Atoi(uid)
+		if err != nil || n < 1 || n > 65533 {
+			return u, fmt.Errorf("invalid --uid %q (want 1-65533 or host)", uid)
+		}
+		u.UID = n
+	}
+	u.Sudo = !noSudo
+	return u, nil
+}
+
+// ImageUserOf reads the user an image was built for from its labels.
+func ImageUserOf(labels map[string]string) ImageUser {
+	u := DefaultImageUser
+	if v := labels[UserLabel]; v != "" {
+		u.Name = v
+	}
+	if n, err := strconv.Atoi(labels[UIDLabel]); err == nil {
+		u.UID = n
+	}
+	if labels[SudoLabel] == "0" {
+		u.Sudo = false
+	}
+	return u
+}
+
+// BuildArgs returns the build args the embedded Dockerfile reads.
+func (u ImageUser) BuildArgs() map[string]string {
+	sudo := "1"
+	if !u.Sudo {
+		sudo = "0"
+	}
+	return map[string]string{"CLAUDEX_USER": u.Name, "CLAUDEX_UID": strconv.Itoa(u.UID), "CLAUDEX_SUDO": sudo}
+}
+
+func (u ImageUser) String() string {
+	s := fmt.Sprintf("user %s (UID %d)", u.Name, u.UID)
+	if !u.Sudo {
+		s += " without sudo"
+	}
+	return s
+}
+
+// homeOwner is a chown argument handing files to the container user: the
+// owner of /home/node, whatever its name and UID.
+const homeOwner = "--reference=" + Home
+
+// noSudo reports whether the container runs with sudo disabled by --no-sudo
+// or policy.noSudo.
+func (o Options) noSudo() bool {
+	return o.NoSudo || o.Policy.NoSudo
+}
@@ -0,0 +1,56 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+)
+
+// VolumeLabel records the named volume holding /workspace for containers
+// created with --workspace-volume.
+const VolumeLabel = "com.claudex.workspace-volume"
+
+// VolumeName is the workspace volume for a signature; it outlives the
+// container so recreating it keeps build caches and agent changes.
+func VolumeName(signature string) string { return "claudex-ws-" + signature }
+
+// SyncOptions selects the direction and behaviour of SyncVolume.
+type SyncOptions struct {
+	// Pull copies volume -> host instead of host -> volume.
+	Pull bool
+	// Delete removes files missing from the source side.
+	Delete bool
+}
+
+// SyncVolume rsyncs each host dir to /workspace/<basename> in volume (or back
+// with Pull) through a short-lived helper container from image, so the slow
+// bind mount is only read once instead of on every build.
+func SyncVolume(dx dockerx.Docker, image, volume string, dirs []string, opts SyncOptions, out io.Writer) error {
+	flags := "-rlpt"
+	if opts.Delete {
+		flags += " --delete"
+	}
+	for _, host := range dirs {
+		base := filepath.Base(host)
+		args := []string{"run", "--rm", "--entrypoint", "sh", "-v", volume + ":/workspace"}
+		var script string
+		if opts.Pull {
+			fmt.Fprintf(out, "Syncing %s:/workspace/%s -> %s...\n", volume, base, host)
+			// Write host files as the invoking user.
+			args = append(args, "-u", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()), "-v", host+":/host")
+			script = fmt.Sprintf("rsync %s /workspace/%s/ /host/", flags, base)
+		} else {
+			fmt.Fprintf(out, "Syncing %s -> %s:/workspace/%s...\n", host, volume, base)
+			args = append(args, "-u", "root", "-v", host+":/host:ro")
+			script = fmt.Sprintf("rsync %s /host/ /workspace/%s/ && chown -R %s /workspace/%s", flags, base, homeOwner, base)
+		}
+		args = append(args, image, "-c", script)
+		if err := dx.Run(args...); err != nil {
+			return fmt.Errorf("sync %s: %w", host, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package state
+
+import "os"
+
+// TryLock always succeeds: without flock, callers fall back to their other
+// guards (the engine's name check, updateMu within the process).
+func TryLock(f *os.File) (bool, error) { return true, nil }
+
+func lock(f *os.File) error { return nil }
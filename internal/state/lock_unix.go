@@ -0,0 +1,23 @@
+//go:build linux || darwin
+
+package state
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// TryLock takes an exclusive flock on f without waiting; closing f drops it.
+func TryLock(f *os.File) (bool, error) {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// lock takes an exclusive flock on f, waiting for other holders.
+func lock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
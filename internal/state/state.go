@@ -0,0 +1,309 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Session is the durable record of a claudex container. It outlives the
+// container itself so history survives `destroy`.
+type Session struct {
+	Name         string    `json:"name"`
+	Signature    string    `json:"signature"`
+	Slug         string    `json:"slug"`
+	Mounts       []string  `json:"mounts"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastAttached time.Time `json:"last_attached"`
+	RemovedAt    time.Time `json:"removed_at"`
+	Transcripts  []string  `json:"transcripts,omitempty"`
+	Snapshots    []string  `json:"snapshots,omitempty"`
+	// Workspace is the named workspace the session was started from, if any.
+	Workspace string `json:"workspace,omitempty"`
+	// Usage accumulates what the session used (see AddUsage); UsageMark is
+	// the last sample it was measured against.
+	Usage     []Usage        `json:"usage,omitempty"`
+	UsageMark *UsageCounters `json:"usage_mark,omitempty"`
+}
+
+// UsageCounters are running totals sampled from a container: CPU time since
+// it started, and the tokens recorded in its agents' transcripts.
+type UsageCounters struct {
+	// Container is the ID of the container sampled.
+	Container    string    `json:"container"`
+	At           time.Time `json:"at"`
+	CPUSeconds   float64   `json:"cpu_seconds"`
+	InputTokens  int64     `json:"input_tokens"`
+	OutputTokens int64     `json:"output_tokens"`
+}
+
+// Usage is what a session used From..To, AttachSeconds of it with a shell
+// attached.
+type Usage struct {
+	From          time.Time `json:"from"`
+	To            time.Time `json:"to"`
+	AttachSeconds float64   `json:"attach_seconds,omitempty"`
+	CPUSeconds    float64   `json:"cpu_seconds,omitempty"`
+	InputTokens   int64     `json:"input_tokens,omitempty"`
+	OutputTokens  int64     `json:"output_tokens,omitempty"`
+}
+
+// Workspace is a named set of directories (`claudex workspace create`).
+type Workspace struct {
+	Name      string    `json:"name"`
+	Dirs      []string  `json:"dirs"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Removed reports whether the session's container has been destroyed.
+func (s Session) Removed() bool { return !s.RemovedAt.IsZero() }
+
+// Store is the on-disk state file.
+type Store struct {
+	Sessions   map[string]*Session   `json:"sessions"`
+	Workspaces map[string]*Workspace `json:"workspaces,omitempty"`
+
+	path string
+}
+
+// Dir returns the claudex data directory ($XDG_DATA_HOME/claudex or ~/.local/share/claudex).
+func Dir() (string, error) {
+	if x := os.Getenv("XDG_DATA_HOME"); x != "" {
+		return filepath.Join(x, "claudex"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "claudex"), nil
+}
+
+// Path returns the location of state.json.
+func Path() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "state.json"), nil
+}
+
+// Load reads the default store; a missing file yields an empty store.
+func Load() (*Store, error) {
+	p, err := Path()
+	if err != nil {
+		return nil, err
+	}
+	return LoadFrom(p)
+}
+
+// LoadFrom reads the store at path.
+func LoadFrom(path string) (*Store, error) {
+	s := &Store{Sessions: map[string]*Session{}, path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("cannot read state %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("invalid state %s: %w", path, err)
+	}
+	if s.Sessions == nil {
+		s.Sessions = map[string]*Session{}
+	}
+	return s, nil
+}
+
+// Save writes the store atomically (temp file + rename).
+func (s *Store) Save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("cannot create state dir: %w", err)
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), "state-*.json")
+	if err != nil {
+		return fmt.Errorf("cannot write state: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("cannot write state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("cannot write state: %w", err)
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// Get returns the session for name, if recorded.
+func (s *Store) Get(name string) (*Session, bool) {
+	sess, ok := s.Sessions[name]
+	return sess, ok
+}
+
+// Upsert records sess, keeping the original CreatedAt and any transcripts or
+// snapshots already attached to a session of the same name. A re-created
+// container clears RemovedAt.
+func (s *Store) Upsert(sess Session) *Session {
+	if prev, ok := s.Sessions[sess.Name]; ok {
+		if !prev.CreatedAt.IsZero() && !prev.Removed() {
+			sess.CreatedAt = prev.CreatedAt
+		}
+		if sess.LastAttached.IsZero() {
+			sess.LastAttached = prev.LastAttached
+		}
+		if len(sess.Transcripts) == 0 {
+			sess.Transcripts = prev.Transcripts
+		}
+		if len(sess.Snapshots) == 0 {
+			sess.Snapshots = prev.Snapshots
+		}
+		if sess.Workspace == "" {
+			sess.Workspace = prev.Workspace
+		}
+		sess.Usage = prev.Usage
+		sess.UsageMark = prev.UsageMark
+	}
+	sess.RemovedAt = time.Time{}
+	s.Sessions[sess.Name] = &sess
+	return &sess
+}
+
+// MarkRemoved records that the container for name was destroyed.
+func (s *Store) MarkRemoved(name string, at time.Time) {
+	if sess, ok := s.Sessions[name]; ok {
+		sess.RemovedAt = at
+	}
+}
+
+// AddUsage records what the session name used since its last sample: the
+// difference between c and UsageMark, plus attached, the time a shell was
+// attached meanwhile. CPU time counts from zero again in a different
+// container; a total lower than the mark (a restart, deleted transcripts)
+// is taken whole. Sessions not in the store are ignored.
+func (s *Store) AddUsage(name string, attached time.Duration, c UsageCounters) {
+	sess, ok := s.Sessions[name]
+	if !ok {
+		return
+	}
+	u := Usage{From: sess.CreatedAt, To: c.At, AttachSeconds: attached.Seconds(), CPUSeconds: c.CPUSeconds, InputTokens: c.InputTokens, OutputTokens: c.OutputTokens}
+	if m := sess.UsageMark; m != nil {
+		u.From = m.At
+		if m.Container == c.Container && c.CPUSeconds >= m.CPUSeconds {
+			u.CPUSeconds -= m.CPUSeconds
+		}
+		// Transcripts travel with the home dir (migrate, clone), so tokens
+		// are compared across containers.
+		if c.InputTokens >= m.InputTokens && c.OutputTokens >= m.OutputTokens {
+			u.InputTokens -= m.InputTokens
+			u.OutputTokens -= m.OutputTokens
+		}
+	}
+	if u.From.IsZero() || u.From.After(u.To) {
+		u.From = u.To.Add(-attached)
+	}
+	sess.UsageMark = &c
+	if u.AttachSeconds > 0 || u.CPUSeconds > 0 || u.InputTokens > 0 || u.OutputTokens > 0 {
+		sess.Usage = append(sess.Usage, u)
+	}
+}
+
+// All returns sessions sorted by creation time.
+func (s *Store) All() []Session {
+	res := make([]Session, 0, len(s.Sessions))
+	for _, sess := range s.Sessions {
+		res = append(res, *sess)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].CreatedAt.Equal(res[j].CreatedAt) {
+			return res[i].Name < res[j].Name
+		}
+		return res[i].CreatedAt.Before(res[j].CreatedAt)
+	})
+	return res
+}
+
+// updateMu serializes Update within the process, e.g. when several
+// containers are created concurrently.
+var updateMu sync.Mutex
+
+// Update loads the default store, applies fn, and saves it. A lock file
+// next to the store serializes it with other claudex processes, so
+// concurrent updates do not lose each other's changes.
+func Update(fn func(*Store) error) error {
+	updateMu.Lock()
+	defer updateMu.Unlock()
+	p, err := Path()
+	if err != nil {
+		return err
+	}
+	l, err := LockFile(p + ".lock")
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	s, err := LoadFrom(p)
+	if err != nil {
+		return err
+	}
+	if err := fn(s); err != nil {
+		return err
+	}
+	return s.Save()
+}
+
+// SetWorkspace records w, replacing any workspace of the same name.
+func (s *Store) SetWorkspace(w Workspace) {
+	if s.Workspaces == nil {
+		s.Workspaces = map[string]*Workspace{}
+	}
+	s.Workspaces[w.Name] = &w
+}
+
+// Workspace returns the named workspace, if recorded.
+func (s *Store) Workspace(name string) (*Workspace, bool) {
+	w, ok := s.Workspaces[name]
+	return w, ok
+}
+
+// RemoveWorkspace deletes the named workspace and reports whether it existed.
+func (s *Store) RemoveWorkspace(name string) bool {
+	if _, ok := s.Workspaces[name]; !ok {
+		return false
+	}
+	delete(s.Workspaces, name)
+	return true
+}
+
+// AllWorkspaces returns workspaces sorted by name.
+func (s *Store) AllWorkspaces() []Workspace {
+	res := make([]Workspace, 0, len(s.Workspaces))
+	for _, w := range s.Workspaces {
+		res = append(res, *w)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+// Recent returns live sessions that have been attached, most recent first.
+func (s *Store) Recent() []Session {
+	var res []Session
+	for _, sess := range s.All() {
+		if sess.Removed() || sess.LastAttached.IsZero() {
+			continue
+		}
+		res = append(res, sess)
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].LastAttached.After(res[j].LastAttached) })
+	return res
+}
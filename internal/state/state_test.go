@@ -0,0 +1,151 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStoreRoundTripAndUpsert(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "state.json")
+	s, err := LoadFrom(path)
+	if err != nil {
+		t.Fatalf("LoadFrom missing file: %v", err)
+	}
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	s.Upsert(Session{Name: "a", Signature: "sig", Mounts: []string{"/x"}, CreatedAt: created, Snapshots: []string{"snap1"}})
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	s2, err := LoadFrom(path)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	got, ok := s2.Get("a")
+	if !ok || got.Signature != "sig" || !got.CreatedAt.Equal(created) {
+		t.Fatalf("unexpected session after reload: %+v", got)
+	}
+
+	attached := created.Add(time.Hour)
+	s2.Upsert(Session{Name: "a", Signature: "sig", CreatedAt: attached, LastAttached: attached})
+	got, _ = s2.Get("a")
+	if !got.CreatedAt.Equal(created) || !got.LastAttached.Equal(attached) || len(got.Snapshots) != 1 {
+		t.Fatalf("upsert should keep created time and snapshots: %+v", got)
+	}
+}
+
+func TestMarkRemovedAndRecreate(t *testing.T) {
+	s, _ := LoadFrom(filepath.Join(t.TempDir(), "state.json"))
+	first := time.Now().Add(-time.Hour)
+	s.Upsert(Session{Name: "a", CreatedAt: first})
+	s.MarkRemoved("a", time.Now())
+	if got, _ := s.Get("a"); !got.Removed() {
+		t.Fatalf("expected removed session")
+	}
+	again := time.Now()
+	s.Upsert(Session{Name: "a", CreatedAt: again})
+	got, _ := s.Get("a")
+	if got.Removed() || !got.CreatedAt.Equal(again) {
+		t.Fatalf("recreated session should reset removal and created time: %+v", got)
+	}
+	if all := s.All(); len(all) != 1 {
+		t.Fatalf("All = %v", all)
+	}
+}
+
+func TestRecentOrdersByLastAttached(t *testing.T) {
+	s, _ := LoadFrom(filepath.Join(t.TempDir(), "state.json"))
+	now := time.Now()
+	s.Upsert(Session{Name: "old", LastAttached: now.Add(-time.Hour)})
+	s.Upsert(Session{Name: "new", LastAttached: now})
+	s.Upsert(Session{Name: "never"})
+	s.Upsert(Session{Name: "gone", LastAttached: now.Add(time.Hour)})
+	s.MarkRemoved("gone", now)
+	got := s.Recent()
+	if len(got) != 2 || got[0].Name != "new" || got[1].Name != "old" {
+		t.Fatalf("Recent = %+v", got)
+	}
+}
+
+func TestWorkspaces(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, _ := LoadFrom(path)
+	s.SetWorkspace(Workspace{Name: "web", Dirs: []string{"/a", "/b"}})
+	s.SetWorkspace(Workspace{Name: "api", Dirs: []string{"/c"}})
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	s2, _ := LoadFrom(path)
+	all := s2.AllWorkspaces()
+	if len(all) != 2 || all[0].Name != "api" || len(all[1].Dirs) != 2 {
+		t.Fatalf("AllWorkspaces = %+v", all)
+	}
+	if !s2.RemoveWorkspace("api") || s2.RemoveWorkspace("api") {
+		t.Fatalf("RemoveWorkspace should succeed once")
+	}
+	if _, ok := s2.Workspace("web"); !ok {
+		t.Fatalf("web workspace missing")
+	}
+}
+
+func TestAddUsageTakesDeltas(t *testing.T) {
+	s, _ := LoadFrom(filepath.Join(t.TempDir(), "state.json"))
+	t0 := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	s.Upsert(Session{Name: "a", CreatedAt: t0})
+	s.AddUsage("a", 30*time.Minute, UsageCounters{Container: "c1", At: t0.Add(time.Hour), CPUSeconds: 100, InputTokens: 1000, OutputTokens: 50})
+	s.AddUsage("a", 10*time.Minute, UsageCounters{Container: "c1", At: t0.Add(2 * time.Hour), CPUSeconds: 160, InputTokens: 1500, OutputTokens: 80})
+	// Recreated container: CPU starts over, the transcripts came along.
+	s.Upsert(Session{Name: "a", CreatedAt: t0.Add(3 * time.Hour)})
+	s.AddUsage("a", 0, UsageCounters{Container: "c2", At: t0.Add(4 * time.Hour), CPUSeconds: 20, InputTokens: 1600, OutputTokens: 90})
+	s.AddUsage("a", 0, UsageCounters{Container: "c2", At: t0.Add(5 * time.Hour), CPUSeconds: 20, InputTokens: 1600, OutputTokens: 90})
+	s.AddUsage("missing", time.Hour, UsageCounters{At: t0})
+
+	got, _ := s.Get("a")
+	if len(got.Usage) != 3 {
+		t.Fatalf("usage = %+v", got.Usage)
+	}
+	u := got.Usage[1]
+	if !u.From.Equal(t0.Add(time.Hour)) || u.AttachSeconds != 600 || u.CPUSeconds != 60 || u.InputTokens != 500 || u.OutputTokens != 30 {
+		t.Fatalf("second sample = %+v", u)
+	}
+	if u := got.Usage[2]; u.CPUSeconds != 20 || u.InputTokens != 100 || u.OutputTokens != 10 {
+		t.Fatalf("sample after recreate = %+v", u)
+	}
+	if got.Usage[0].CPUSeconds != 100 || !got.Usage[0].From.Equal(t0) || got.UsageMark.Container != "c2" {
+		t.Fatalf("first sample %+v, mark %+v", got.Usage[0], got.UsageMark)
+	}
+}
+
+func TestUpdateHoldsTheStateLock(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	p, err := Path()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Update(func(s *Store) error {
+		// Another process opening the lock file cannot take it meanwhile.
+		f, err := os.OpenFile(p+".lock", os.O_RDWR, 0)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if ok, err := TryLock(f); ok || err != nil {
+			t.Errorf("lock taken during Update: %v, %v", ok, err)
+		}
+		s.Upsert(Session{Name: "c"})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	f, err := LockFile(p + ".lock")
+	if err != nil {
+		t.Fatalf("lock not released after Update: %v", err)
+	}
+	f.Close()
+	if s, _ := Load(); len(s.Sessions) != 1 {
+		t.Fatalf("sessions = %v", s.Sessions)
+	}
+}
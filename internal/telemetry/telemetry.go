@@ -0,0 +1,191 @@
+// Package telemetry records anonymous command usage locally. Nothing is
+// recorded unless `telemetry.enabled: true` is set in config, and nothing
+// leaves the machine until `claudex telemetry export` sends it to the
+// configured endpoint.
+package telemetry
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/state"
+)
+
+// Record is one CLI invocation. Only the subcommand name is kept; arguments,
+// paths, and container names never are.
+type Record struct {
+	Time       time.Time `json:"time"`
+	Command    string    `json:"command"`
+	DurationMS int64     `json:"duration_ms"`
+	OK         bool      `json:"ok"`
+	Version    string    `json:"version"`
+	OS         string    `json:"os"`
+}
+
+// Path returns the local record file ($XDG_DATA_HOME/claudex/telemetry.jsonl).
+func Path() (string, error) {
+	dir, err := state.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "telemetry.jsonl"), nil
+}
+
+// offPath is the marker written by `claudex telemetry off`; it wins over config.
+func offPath() (string, error) {
+	dir, err := state.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "telemetry-off"), nil
+}
+
+// Enabled reports whether recording is on: configured, not switched off with
+// `claudex telemetry off`, and not suppressed by CLAUDEX_NO_TELEMETRY.
+func Enabled(configured bool) bool {
+	if !configured || os.Getenv("CLAUDEX_NO_TELEMETRY") != "" {
+		return false
+	}
+	p, err := offPath()
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(p)
+	return errors.Is(err, os.ErrNotExist)
+}
+
+// SetOff writes or removes the off marker. Turning telemetry off also deletes
+// the local records.
+func SetOff(off bool) error {
+	p, err := offPath()
+	if err != nil {
+		return err
+	}
+	if !off {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(p, nil, 0644); err != nil {
+		return err
+	}
+	return Clear()
+}
+
+// Append adds r to the record file at path.
+func Append(path string, r Record) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Load reads the records at path, skipping malformed lines. A missing file
+// yields no records.
+func Load(path string) ([]Record, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var res []Record
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		var r Record
+		if json.Unmarshal(sc.Bytes(), &r) == nil && r.Command != "" {
+			res = append(res, r)
+		}
+	}
+	return res, nil
+}
+
+// Clear deletes the local records.
+func Clear() error {
+	p, err := Path()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Summary aggregates records for one command.
+type Summary struct {
+	Command  string
+	Count    int
+	Failures int
+	Total    time.Duration
+}
+
+// Summarize groups records by command, most used first.
+func Summarize(recs []Record) []Summary {
+	by := map[string]*Summary{}
+	for _, r := range recs {
+		s, ok := by[r.Command]
+		if !ok {
+			s = &Summary{Command: r.Command}
+			by[r.Command] = s
+		}
+		s.Count++
+		if !r.OK {
+			s.Failures++
+		}
+		s.Total += time.Duration(r.DurationMS) * time.Millisecond
+	}
+	res := make([]Summary, 0, len(by))
+	for _, s := range by {
+		res = append(res, *s)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Count != res[j].Count {
+			return res[i].Count > res[j].Count
+		}
+		return res[i].Command < res[j].Command
+	})
+	return res
+}
+
+// Export POSTs recs as {"records": [...]} to endpoint.
+func Export(client *http.Client, endpoint string, recs []Record) error {
+	body, err := json.Marshal(map[string][]Record{"records": recs})
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("telemetry export failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("telemetry export failed: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAppendLoadSummarize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "telemetry.jsonl")
+	now := time.Now()
+	for _, r := range []Record{
+		{Time: now, Command: "run", DurationMS: 1000, OK: true},
+		{Time: now, Command: "list", DurationMS: 10, OK: true},
+		{Time: now, Command: "run", DurationMS: 3000, OK: false},
+	} {
+		if err := Append(path, r); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	recs, err := Load(path)
+	if err != nil || len(recs) != 3 {
+		t.Fatalf("Load = %v, %v", recs, err)
+	}
+	sum := Summarize(recs)
+	if len(sum) != 2 || sum[0].Command != "run" || sum[0].Count != 2 || sum[0].Failures != 1 || sum[0].Total != 4*time.Second {
+		t.Fatalf("Summarize = %+v", sum)
+	}
+}
+
+func TestEnabledHonorsOffMarker(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("CLAUDEX_NO_TELEMETRY", "")
+	if Enabled(false) {
+		t.Fatalf("telemetry must be opt-in")
+	}
+	if !Enabled(true) {
+		t.Fatalf("expected enabled when configured")
+	}
+	if err := SetOff(true); err != nil {
+		t.Fatalf("SetOff: %v", err)
+	}
+	if Enabled(true) {
+		t.Fatalf("off marker should override config")
+	}
+	if err := SetOff(false); err != nil || !Enabled(true) {
+		t.Fatalf("expected re-enabled, err=%v", err)
+	}
+}
+
+func TestExport(t *testing.T) {
+	var got struct{ Records []Record }
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+	if err := Export(srv.Client(), srv.URL, []Record{{Command: "run"}}); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if len(got.Records) != 1 || got.Records[0].Command != "run" {
+		t.Fatalf("server got %+v", got)
+	}
+}
@@ -0,0 +1,167 @@
+package ui
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+)
+
+// WorkspaceRoot is where the picker starts and the highest it can navigate to.
+const WorkspaceRoot = "/workspace"
+
+// ListDir lists dir inside the container. Directory entries end in "/".
+// At the workspace root the PullIgnoreSet files are hidden.
+func ListDir(dx dockerx.Docker, container, dir string) ([]string, error) {
+	out, err := dx.ExecOutput(container, []string{"ls", "-1Ap", "--", dir})
+	if err != nil {
+		return nil, fmt.Errorf("list %s: %w", dir, err)
+	}
+	trimmed := bytes.TrimSpace(out)
+	if len(trimmed) == 0 {
+		return nil, nil
+	}
+	ignores := map[string]bool{}
+	if dir == WorkspaceRoot {
+		ignores = PullIgnoreSet()
+	}
+	var entries []string
+	for _, line := range strings.Split(string(trimmed), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || ignores[line] {
+			continue
+		}
+		entries = append(entries, line)
+	}
+	sortStrings(entries)
+	return entries, nil
+}
+
+// BrowseWorkspace is a line-driven picker over the container's /workspace tree.
+// It returns the absolute container paths selected, or nil if cancelled.
+//
+//	N        enter directory N, or toggle file N
+//	+ N ...  toggle selection of entries (files or directories)
+//	..       go up one directory
+//	/ GLOB   filter the current listing (blank clears)
+//	done     finish (also an empty line once something is selected)
+//	q        cancel
+func BrowseWorkspace(p Prompter, out io.Writer, dx dockerx.Docker, container string) ([]string, error) {
+	cwd := WorkspaceRoot
+	filter := ""
+	selected := map[string]bool{}
+	for {
+		all, err := ListDir(dx, container, cwd)
+		if err != nil {
+			return nil, err
+		}
+		entries := all
+		if filter != "" {
+			entries = nil
+			for _, e := range all {
+				if ok, _ := path.Match(filter, strings.TrimSuffix(e, "/")); ok {
+					entries = append(entries, e)
+				}
+			}
+		}
+		printListing(out, cwd, filter, entries, selected)
+
+		input, err := p.Input("> ")
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case input == "q":
+			return nil, nil
+		case input == "done", input == "" && len(selected) > 0:
+			return sortedKeys(selected), nil
+		case input == "":
+			continue
+		case input == "..":
+			if cwd != WorkspaceRoot {
+				cwd = path.Dir(cwd)
+				filter = ""
+			}
+		case strings.HasPrefix(input, "/"):
+			f := strings.TrimSpace(strings.TrimPrefix(input, "/"))
+			if _, err := path.Match(f, ""); err != nil {
+				fmt.Fprintf(out, "Invalid glob %q: %v\n", f, err)
+				continue
+			}
+			filter = f
+		case strings.HasPrefix(input, "+"):
+			for _, field := range strings.Fields(strings.ReplaceAll(strings.TrimPrefix(input, "+"), ",", " ")) {
+				e, err := pick(entries, field)
+				if err != nil {
+					fmt.Fprintln(out, err)
+					break
+				}
+				toggle(selected, path.Join(cwd, strings.TrimSuffix(e, "/")))
+			}
+		default:
+			e, err := pick(entries, input)
+			if err != nil {
+				fmt.Fprintln(out, err)
+				continue
+			}
+			full := path.Join(cwd, strings.TrimSuffix(e, "/"))
+			if strings.HasSuffix(e, "/") {
+				cwd = full
+				filter = ""
+			} else {
+				toggle(selected, full)
+			}
+		}
+	}
+}
+
+func printListing(out io.Writer, cwd, filter string, entries []string, selected map[string]bool) {
+	header := cwd
+	if filter != "" {
+		header += " (filter: " + filter + ")"
+	}
+	fmt.Fprintf(out, "\n%s  [%d selected]\n", header, len(selected))
+	for i, e := range entries {
+		mark := " "
+		if selected[path.Join(cwd, strings.TrimSuffix(e, "/"))] {
+			mark = "x"
+		}
+		fmt.Fprintf(out, "  [%s] %d) %s\n", mark, i+1, e)
+	}
+	fmt.Fprintln(out, "N: open dir/toggle file, + N...: select, ..: up, / GLOB: filter, done, q: cancel")
+}
+
+func pick(entries []string, field string) (string, error) {
+	n, err := strconv.Atoi(field)
+	if err != nil {
+		return "", fmt.Errorf("invalid selection '%s'", field)
+	}
+	if n < 1 || n > len(entries) {
+		return "", fmt.Errorf("selection %d out of range", n)
+	}
+	return entries[n-1], nil
+}
+
+func toggle(selected map[string]bool, p string) {
+	if selected[p] {
+		delete(selected, p)
+		return
+	}
+	selected[p] = true
+}
+
+func sortedKeys(m map[string]bool) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sortStrings(res)
+	return res
+}
@@ -0,0 +1,38 @@
+package ui
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+)
+
+func TestBrowseWorkspaceNavigatesFiltersAndSelects(t *testing.T) {
+	tree := map[string]string{
+		"/workspace":           "CLAUDE.md\napp/\nREADME.md\n",
+		"/workspace/app":       "build/\nmain.go\n",
+		"/workspace/app/build": "app.bin\napp.map\nnotes.txt\n",
+	}
+	f := &dockerx.Fake{ExecOutputFunc: func(name string, cmd []string) ([]byte, error) {
+		return []byte(tree[cmd[len(cmd)-1]]), nil
+	}}
+	// enter app/, enter build/, filter app.*, select both, go up, select main.go
+	in := "2\n1\n/ app.*\n+ 1,2\n..\n2\ndone\n"
+	got, err := BrowseWorkspace(NewPrompter(strings.NewReader(in), io.Discard, false), io.Discard, f, "c")
+	if err != nil {
+		t.Fatalf("BrowseWorkspace: %v", err)
+	}
+	want := []string{"/workspace/app/build/app.bin", "/workspace/app/build/app.map", "/workspace/app/main.go"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("got %v want %v", got, want)
+	}
+}
+
+func TestBrowseWorkspaceCancel(t *testing.T) {
+	f := &dockerx.Fake{ExecOutputOut: []byte("a.txt\n")}
+	got, err := BrowseWorkspace(NewPrompter(strings.NewReader("1\nq\n"), io.Discard, false), io.Discard, f, "c")
+	if err != nil || got != nil {
+		t.Fatalf("expected cancel, got %v, %v", got, err)
+	}
+}
@@ -0,0 +1,244 @@
+package ui
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/photodialectic/claudex/internal/output"
+)
+
+// ErrNoInput is returned for a question that --no-input forbids asking.
+var ErrNoInput = errors.New("input required but --no-input is set")
+
+// Prompter asks the user questions. Commands take one instead of reading
+// os.Stdin, so tests can script the answers and --yes or --no-input can
+// answer for the user.
+type Prompter interface {
+	// Interactive reports whether someone at a terminal can answer. Optional
+	// questions, such as picking one of several containers, are only asked
+	// when they can.
+	Interactive() bool
+	// Input prints question and returns the answer line with surrounding
+	// space trimmed. It returns io.EOF once the input is exhausted.
+	Input(question string) (string, error)
+	// Confirm asks a [y/N] question. Anything but a yes in the current
+	// locale, including no input at all, is a no.
+	Confirm(question string) (bool, error)
+	// SelectOne returns the index of the option picked, or -1 for a blank
+	// answer when m has no default. In both Select methods no input at all
+	// counts as a blank answer.
+	SelectOne(m Menu) (int, error)
+	// SelectMany returns the indexes picked, in the order given; a blank
+	// answer picks m.Default.
+	SelectMany(m Menu) ([]int, error)
+}
+
+// Menu is a numbered list of options to pick from.
+type Menu struct {
+	// Title is printed above the options.
+	Title   string
+	Options []string
+	// Question is asked below them; SelectOne and SelectMany supply a
+	// generic one when it is empty.
+	Question string
+	// Default are the indexes a blank answer picks, and what --yes takes.
+	Default []int
+}
+
+func (m Menu) print(w io.Writer) {
+	if m.Title != "" {
+		fmt.Fprintln(w, m.Title)
+	}
+	for i, o := range m.Options {
+		fmt.Fprintf(w, "  [%d] %s\n", i+1, o)
+	}
+}
+
+// parse reads answer as numbers separated by commas or spaces, dropping
+// repeats.
+func (m Menu) parse(answer string, many bool) ([]int, error) {
+	fields := strings.Fields(strings.ReplaceAll(answer, ",", " "))
+	if len(fields) == 0 {
+		return append([]int(nil), m.Default...), nil
+	}
+	if !many && len(fields) > 1 {
+		return nil, fmt.Errorf("pick one number, not %q", answer)
+	}
+	var picks []int
+	seen := map[int]bool{}
+	for _, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 1 || n > len(m.Options) {
+			return nil, fmt.Errorf("invalid selection '%s'", f)
+		}
+		if !seen[n] {
+			seen[n] = true
+			picks = append(picks, n-1)
+		}
+	}
+	return picks, nil
+}
+
+type linePrompter struct {
+	r   *bufio.Reader
+	w   io.Writer
+	tty bool
+}
+
+// NewPrompter asks on out and reads answers a line at a time from in (none
+// when in is nil). With interactive set it behaves as at a terminal: an
+// invalid selection is reported and asked again instead of failing. It
+// buffers in, so share one Prompter per input: a second reader could
+// swallow piped answers meant for the first.
+func NewPrompter(in io.Reader, out io.Writer, interactive bool) Prompter {
+	if in == nil {
+		in = strings.NewReader("")
+	}
+	return &linePrompter{r: bufio.NewReader(in), w: out, tty: interactive}
+}
+
+// StdPrompter asks on stdout and reads stdin, as --yes and --no-input
+// allow.
+func StdPrompter() Prompter {
+	return Auto(NewPrompter(os.Stdin, os.Stdout, StdinIsTTY()))
+}
+
+func (p *linePrompter) Interactive() bool { return p.tty }
+
+func (p *linePrompter) Input(question string) (string, error) {
+	if question != "" {
+		output.Prompt(p.w, question)
+	}
+	line, err := p.r.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+func (p *linePrompter) Confirm(question string) (bool, error) {
+	ans, err := p.Input(question)
+	if err == io.EOF {
+		return false, nil
+	}
+	return err == nil && output.Yes(ans), err
+}
+
+func (p *linePrompter) SelectOne(m Menu) (int, error) {
+	if m.Question == "" {
+		m.Question = "Enter number: "
+	}
+	picks, err := p.choose(m, false)
+	if err != nil || len(picks) == 0 {
+		return -1, err
+	}
+	return picks[0], nil
+}
+
+func (p *linePrompter) SelectMany(m Menu) ([]int, error) {
+	if m.Question == "" {
+		m.Question = "Enter numbers (comma-separated): "
+	}
+	return p.choose(m, true)
+}
+
+func (p *linePrompter) choose(m Menu, many bool) ([]int, error) {
+	m.print(p.w)
+	for {
+		ans, err := p.Input(m.Question)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		picks, err := m.parse(ans, many)
+		if err == nil || !p.tty {
+			return picks, err
+		}
+		fmt.Fprintln(p.w, err)
+	}
+}
+
+// answers are the process-wide --yes and --no-input modes.
+var answers struct{ yes, noInput bool }
+
+// SetAnswers sets the modes Auto applies: yes answers confirmations and
+// takes menu defaults; noInput fails every other question with ErrNoInput
+// instead of reading input.
+func SetAnswers(yes, noInput bool) {
+	answers.yes, answers.noInput = yes, noInput
+}
+
+// Auto applies the modes set by SetAnswers to p.
+func Auto(p Prompter) Prompter {
+	if !answers.yes && !answers.noInput {
+		return p
+	}
+	a := &autoPrompter{yes: answers.yes}
+	if !answers.noInput {
+		a.next = p
+	}
+	return a
+}
+
+// AutoPrompter never reads input. With yes it answers confirmations and
+// takes menu defaults; every other question fails with ErrNoInput.
+func AutoPrompter(yes bool) Prompter {
+	return &autoPrompter{yes: yes}
+}
+
+// autoPrompter answers what it can and hands the rest to next, or fails
+// them when next is nil.
+type autoPrompter struct {
+	yes  bool
+	next Prompter
+}
+
+func (a *autoPrompter) Interactive() bool { return a.next != nil && a.next.Interactive() }
+
+func (a *autoPrompter) Input(question string) (string, error) {
+	if a.next == nil {
+		return "", noInput(question)
+	}
+	return a.next.Input(question)
+}
+
+func (a *autoPrompter) Confirm(question string) (bool, error) {
+	if a.yes {
+		return true, nil
+	}
+	if a.next == nil {
+		return false, noInput(question)
+	}
+	return a.next.Confirm(question)
+}
+
+func (a *autoPrompter) SelectOne(m Menu) (int, error) {
+	if a.yes && len(m.Default) == 1 {
+		return m.Default[0], nil
+	}
+	if a.next == nil {
+		return -1, noInput(m.Title)
+	}
+	return a.next.SelectOne(m)
+}
+
+func (a *autoPrompter) SelectMany(m Menu) ([]int, error) {
+	if a.yes && len(m.Default) > 0 {
+		return append([]int(nil), m.Default...), nil
+	}
+	if a.next == nil {
+		return nil, noInput(m.Title)
+	}
+	return a.next.SelectMany(m)
+}
+
+func noInput(question string) error {
+	if q := strings.TrimSpace(question); q != "" {
+		return fmt.Errorf("%w: %s", ErrNoInput, q)
+	}
+	return ErrNoInput
+}
@@ -0,0 +1,61 @@
+package ui
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSelectRetriesOnlyAtATerminal(t *testing.T) {
+	m := Menu{Title: "Pick:", Options: []string{"a", "b", "c"}}
+	var out strings.Builder
+	got, err := NewPrompter(strings.NewReader("4\n3, 1 3\n"), &out, true).SelectMany(m)
+	if err != nil || len(got) != 2 || got[0] != 2 || got[1] != 0 {
+		t.Fatalf("SelectMany = %v, %v", got, err)
+	}
+	if !strings.Contains(out.String(), "  [2] b\n") || !strings.Contains(out.String(), "invalid selection '4'") {
+		t.Fatalf("menu output:\n%s", out.String())
+	}
+	if _, err := NewPrompter(strings.NewReader("4\n3\n"), io.Discard, false).SelectMany(m); err == nil {
+		t.Fatal("piped input should fail on an invalid selection")
+	}
+	if i, err := NewPrompter(strings.NewReader("1 2\n"), io.Discard, false).SelectOne(m); err == nil {
+		t.Fatalf("SelectOne accepted two numbers: %d", i)
+	}
+	m.Default = []int{1}
+	if i, err := NewPrompter(nil, io.Discard, false).SelectOne(m); err != nil || i != 1 {
+		t.Fatalf("SelectOne default = %d, %v", i, err)
+	}
+}
+
+func TestAutoAnswers(t *testing.T) {
+	m := Menu{Title: "Pick:", Options: []string{"a", "b"}, Default: []int{1}}
+	defer SetAnswers(false, false)
+
+	SetAnswers(true, true)
+	p := Auto(NewPrompter(strings.NewReader("n\n"), io.Discard, true))
+	if ok, err := p.Confirm("Proceed? "); !ok || err != nil {
+		t.Fatalf("--yes Confirm = %v, %v", ok, err)
+	}
+	if got, err := p.SelectMany(m); err != nil || len(got) != 1 || got[0] != 1 {
+		t.Fatalf("--yes SelectMany = %v, %v", got, err)
+	}
+	if _, err := p.Input("Name: "); !errors.Is(err, ErrNoInput) || !strings.Contains(err.Error(), "Name:") {
+		t.Fatalf("--no-input Input error = %v", err)
+	}
+	if p.Interactive() {
+		t.Fatal("--no-input prompter claims to be interactive")
+	}
+
+	SetAnswers(true, false)
+	p = Auto(NewPrompter(strings.NewReader("x\n"), io.Discard, false))
+	if got, err := p.Input("Name: "); err != nil || got != "x" {
+		t.Fatalf("--yes should still ask other questions: %q, %v", got, err)
+	}
+
+	SetAnswers(false, true)
+	if ok, err := Auto(NewPrompter(strings.NewReader("y\n"), io.Discard, false)).Confirm("Proceed? "); ok || !errors.Is(err, ErrNoInput) {
+		t.Fatalf("--no-input Confirm = %v, %v", ok, err)
+	}
+}
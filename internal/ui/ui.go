@@ -1,11 +1,9 @@
 package ui
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
 	"os"
-	"strconv"
 	"strings"
 
 	"github.com/photodialectic/claudex/internal/dockerx"
@@ -19,38 +17,17 @@ func StdinIsTTY() bool {
 	return info.Mode()&os.ModeCharDevice != 0
 }
 
-func PromptForWorkspaceSelection(reader *bufio.Reader, entries []string) ([]string, error) {
-	fmt.Println("Select files or directories to pull:")
-	for i, entry := range entries {
-		fmt.Printf("  %d) %s\n", i+1, entry)
-	}
-	fmt.Println("Enter numbers separated by commas or spaces (blank to cancel):")
-	input, err := reader.ReadString('\n')
+func PromptForWorkspaceSelection(p Prompter, entries []string) ([]string, error) {
+	picks, err := p.SelectMany(Menu{
+		Title:    "Select files or directories to pull:",
+		Options:  entries,
+		Question: "Enter numbers separated by commas or spaces (blank to cancel):\n",
+	})
 	if err != nil {
 		return nil, err
 	}
-	input = strings.TrimSpace(input)
-	if input == "" {
-		return nil, nil
-	}
-	replaced := strings.ReplaceAll(input, ",", " ")
-	fields := strings.Fields(replaced)
-	if len(fields) == 0 {
-		return nil, nil
-	}
-	indexSet := make(map[int]struct{})
-	for _, field := range fields {
-		num, err := strconv.Atoi(field)
-		if err != nil {
-			return nil, fmt.Errorf("invalid selection '%s'", field)
-		}
-		if num < 1 || num > len(entries) {
-			return nil, fmt.Errorf("selection %d out of range", num)
-		}
-		indexSet[num-1] = struct{}{}
-	}
 	var selections []string
-	for idx := range indexSet {
+	for _, idx := range picks {
 		selections = append(selections, entries[idx])
 	}
 	// stable order by entry value
@@ -58,14 +35,12 @@ func PromptForWorkspaceSelection(reader *bufio.Reader, entries []string) ([]stri
 	return selections, nil
 }
 
-func PromptForDestination(reader *bufio.Reader) (string, error) {
+func PromptForDestination(p Prompter) (string, error) {
 	const defaultDest = "/tmp"
-	fmt.Printf("Destination directory (default %s): ", defaultDest)
-	input, err := reader.ReadString('\n')
+	input, err := p.Input(fmt.Sprintf("Destination directory (default %s): ", defaultDest))
 	if err != nil {
 		return "", err
 	}
-	input = strings.TrimSpace(input)
 	if input == "" {
 		return defaultDest, nil
 	}
@@ -1,7 +1,7 @@
 package ui
 
 import (
-	"bufio"
+	"io"
 	"strings"
 	"testing"
 )
@@ -10,8 +10,7 @@ func TestPromptForWorkspaceSelection(t *testing.T) {
 	entries := []string{"a", "b", "c"}
 	// Input: duplicates, spaces and commas
 	in := "1, 2 2 3\n"
-	reader := bufio.NewReader(strings.NewReader(in))
-	got, err := PromptForWorkspaceSelection(reader, entries)
+	got, err := PromptForWorkspaceSelection(NewPrompter(strings.NewReader(in), io.Discard, false), entries)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -27,13 +26,11 @@ func TestPromptForWorkspaceSelection(t *testing.T) {
 }
 
 func TestPromptForDestination(t *testing.T) {
-	reader := bufio.NewReader(strings.NewReader("\n"))
-	got, err := PromptForDestination(reader)
+	got, err := PromptForDestination(NewPrompter(strings.NewReader("\n"), io.Discard, false))
 	if err != nil || got != "/tmp" {
 		t.Fatalf("default dest failed: %v %q", err, got)
 	}
-	reader = bufio.NewReader(strings.NewReader("/x\n"))
-	got, err = PromptForDestination(reader)
+	got, err = PromptForDestination(NewPrompter(strings.NewReader("/x\n"), io.Discard, false))
 	if err != nil || got != "/x" {
 		t.Fatalf("explicit dest failed: %v %q", err, got)
 	}
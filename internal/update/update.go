@@ -0,0 +1,184 @@
+package update
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReleaseURL is the GitHub API endpoint describing the latest published release.
+var ReleaseURL = "https://api.github.com/repos/photodialectic/claudex/releases/latest"
+
+// CheckInterval rate-limits the startup nag.
+const CheckInterval = 24 * time.Hour
+
+type cacheEntry struct {
+	CheckedAt time.Time `json:"checked_at"`
+	Latest    string    `json:"latest"`
+	// HintedAt is when the upgrade hint was last printed.
+	HintedAt time.Time `json:"hinted_at,omitempty"`
+}
+
+// Latest fetches the tag of the most recent release, without a leading "v".
+func Latest(client *http.Client) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, ReleaseURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("release check failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("release check failed: %s", resp.Status)
+	}
+	var body struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("unable to parse release response: %w", err)
+	}
+	if body.TagName == "" {
+		return "", fmt.Errorf("release response did not include a tag")
+	}
+	return strings.TrimPrefix(body.TagName, "v"), nil
+}
+
+// Newer reports whether latest is a higher dotted version than current.
+func Newer(current, latest string) bool {
+	cur := parts(current)
+	lat := parts(latest)
+	for i := 0; i < len(cur) || i < len(lat); i++ {
+		var c, l int
+		if i < len(cur) {
+			c = cur[i]
+		}
+		if i < len(lat) {
+			l = lat[i]
+		}
+		if l != c {
+			return l > c
+		}
+	}
+	return false
+}
+
+func parts(v string) []int {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	var res []int
+	for _, p := range strings.Split(v, ".") {
+		n, _ := strconv.Atoi(p)
+		res = append(res, n)
+	}
+	return res
+}
+
+// UpgradeCommand suggests how to upgrade based on where the running binary lives.
+func UpgradeCommand(exe string) string {
+	p := strings.ReplaceAll(strings.ToLower(exe), `\`, "/")
+	switch {
+	case strings.Contains(p, "/cellar/") || strings.Contains(p, "/homebrew/") || strings.Contains(p, "/linuxbrew/"):
+		return "brew upgrade claudex"
+	case strings.Contains(p, "/scoop/"):
+		return "scoop update claudex"
+	default:
+		return "go install github.com/photodialectic/claudex/cmd/claudex@latest"
+	}
+}
+
+// Hint returns the one-line upgrade message, or "" when current is up to date.
+func Hint(current, latest, exe string) string {
+	if latest == "" || !Newer(current, latest) {
+		return ""
+	}
+	return fmt.Sprintf("A new claudex release is available: %s (you have %s). Upgrade with: %s", latest, current, UpgradeCommand(exe))
+}
+
+func cachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "claudex", "latest-release.json"), nil
+}
+
+func readCache(path string) (cacheEntry, bool) {
+	var e cacheEntry
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return e, false
+	}
+	if err := json.Unmarshal(data, &e); err != nil {
+		return e, false
+	}
+	return e, true
+}
+
+func writeCache(path string, e cacheEntry) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	// The background refresh may be cut short when claudex exits; a rename
+	// never leaves a torn file behind.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// MaybeNag prints a one-line hint to w, at most once per CheckInterval, when
+// the cached latest release is newer than current. A stale cache is refreshed
+// in the background, so startup never waits on the network; the result is
+// read back on a later run. All failures are silent.
+func MaybeNag(w io.Writer, current string) {
+	path, err := cachePath()
+	if err != nil {
+		return
+	}
+	if refresh := nagFrom(w, current, path, time.Now()); refresh != nil {
+		go refresh(&http.Client{Timeout: 2 * time.Second})
+	}
+}
+
+// nagFrom prints the hint for the release cached at path and returns the
+// check to run when the cache is older than CheckInterval.
+func nagFrom(w io.Writer, current, path string, now time.Time) func(*http.Client) {
+	e, _ := readCache(path)
+	exe, _ := os.Executable()
+	if h := Hint(current, e.Latest, exe); h != "" && now.Sub(e.HintedAt) >= CheckInterval {
+		fmt.Fprintln(w, h)
+		e.HintedAt = now
+		_ = writeCache(path, e)
+	}
+	if now.Sub(e.CheckedAt) < CheckInterval {
+		return nil
+	}
+	// Record the attempt up front so offline machines, and runs that exit
+	// before the check finishes, do not retry on every start.
+	e.CheckedAt = now
+	_ = writeCache(path, e)
+	return func(client *http.Client) {
+		latest, err := Latest(client)
+		if err != nil {
+			return
+		}
+		e.Latest = latest
+		_ = writeCache(path, e)
+	}
+}
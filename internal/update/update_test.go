@@ -0,0 +1,77 @@
+package update
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewer(t *testing.T) {
+	cases := []struct {
+		cur, lat string
+		want     bool
+	}{
+		{"0.2.0", "0.3.0", true},
+		{"0.2.0", "v0.2.1", true},
+		{"0.2.0", "0.2.0", false},
+		{"0.10.0", "0.9.9", false},
+		{"1.0", "1.0.1", true},
+		{"0.2.0", "0.2.0-rc1", false},
+	}
+	for _, c := range cases {
+		if got := Newer(c.cur, c.lat); got != c.want {
+			t.Errorf("Newer(%q, %q) = %v, want %v", c.cur, c.lat, got, c.want)
+		}
+	}
+}
+
+func TestUpgradeCommand(t *testing.T) {
+	if got := UpgradeCommand("/opt/homebrew/Cellar/claudex/0.2.0/bin/claudex"); got != "brew upgrade claudex" {
+		t.Fatalf("homebrew: got %q", got)
+	}
+	if got := UpgradeCommand(`C:\Users\me\scoop\apps\claudex\current\claudex.exe`); got != "scoop update claudex" {
+		t.Fatalf("scoop: got %q", got)
+	}
+	if got := UpgradeCommand("/home/me/go/bin/claudex"); !strings.HasPrefix(got, "go install") {
+		t.Fatalf("default: got %q", got)
+	}
+}
+
+func TestNagFromRateLimited(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		fmt.Fprint(w, `{"tag_name":"v9.9.9"}`)
+	}))
+	defer srv.Close()
+	old := ReleaseURL
+	ReleaseURL = srv.URL
+	defer func() { ReleaseURL = old }()
+
+	path := filepath.Join(t.TempDir(), "latest.json")
+	now := time.Now()
+	var out bytes.Buffer
+	refresh := nagFrom(&out, "0.2.0", path, now)
+	if refresh == nil || calls != 0 || out.Len() != 0 {
+		t.Fatalf("expected a deferred check and no hint yet, calls=%d out=%q", calls, out.String())
+	}
+	refresh(srv.Client())
+	if calls != 1 {
+		t.Fatalf("expected one check, calls=%d", calls)
+	}
+	if refresh := nagFrom(&out, "0.2.0", path, now.Add(time.Hour)); refresh != nil || !strings.Contains(out.String(), "9.9.9") {
+		t.Fatalf("expected the cached release in a hint and no check, out=%q", out.String())
+	}
+	out.Reset()
+	if refresh := nagFrom(&out, "0.2.0", path, now.Add(2*time.Hour)); refresh != nil || out.Len() != 0 {
+		t.Fatalf("expected the hint at most once per interval, out=%q", out.String())
+	}
+	if refresh := nagFrom(&out, "0.2.0", path, now.Add(25*time.Hour)); refresh == nil {
+		t.Fatalf("expected re-check after interval")
+	}
+}
@@ -0,0 +1,86 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ValidateAliases checks a pathAliases map: host paths may start with ~,
+// logical paths must be absolute (e.g. /workspace/acme).
+func ValidateAliases(aliases map[string]string) error {
+	for host, logical := range aliases {
+		if host == "" {
+			return fmt.Errorf("pathAliases: empty host path")
+		}
+		if !strings.HasPrefix(logical, "/") {
+			return fmt.Errorf("pathAliases: logical path %q for %s must be absolute", logical, host)
+		}
+	}
+	return nil
+}
+
+// Logical maps host paths to their logical names using the longest matching
+// host prefix in aliases, so teammates with different checkout locations get
+// the same paths (and so the same v1 signature). Unmatched paths are kept.
+// The result is sorted like NormalizeDirs output.
+func Logical(paths []string, aliases map[string]string) []string {
+	pairs := aliasPairs(aliases, true)
+	res := make([]string, 0, len(paths))
+	for _, p := range paths {
+		res = append(res, replacePrefix(p, pairs))
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Local is the inverse of Logical: it maps logical paths back to this
+// machine's checkouts. Unmatched paths are kept.
+func Local(paths []string, aliases map[string]string) []string {
+	pairs := aliasPairs(aliases, false)
+	res := make([]string, 0, len(paths))
+	for _, p := range paths {
+		res = append(res, replacePrefix(p, pairs))
+	}
+	return res
+}
+
+type aliasPair struct{ from, to string }
+
+// aliasPairs expands ~ and symlinks in host paths and orders pairs longest
+// "from" first. forward maps host->logical, otherwise logical->host.
+func aliasPairs(aliases map[string]string, forward bool) []aliasPair {
+	home, _ := os.UserHomeDir()
+	var pairs []aliasPair
+	for host, logical := range aliases {
+		if host == "~" || strings.HasPrefix(host, "~/") {
+			host = filepath.Join(home, strings.TrimPrefix(host, "~"))
+		}
+		if real, err := filepath.EvalSymlinks(host); err == nil {
+			host = real
+		}
+		host = filepath.Clean(host)
+		logical = filepath.Clean(logical)
+		if forward {
+			pairs = append(pairs, aliasPair{host, logical})
+		} else {
+			pairs = append(pairs, aliasPair{logical, host})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool { return len(pairs[i].from) > len(pairs[j].from) })
+	return pairs
+}
+
+func replacePrefix(p string, pairs []aliasPair) string {
+	for _, a := range pairs {
+		if p == a.from {
+			return a.to
+		}
+		if strings.HasPrefix(p, a.from+string(filepath.Separator)) {
+			return a.to + p[len(a.from):]
+		}
+	}
+	return p
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"regexp"
 	"sort"
@@ -18,6 +19,32 @@ func DefaultDirs(dirs []string) []string {
 	return dirs
 }
 
+// Root modes pick the directory mounted when no dirs are given: RootCwd
+// mounts the current directory, RootGit the top of the git checkout that
+// contains it (falling back to the current directory outside a checkout).
+const (
+	RootCwd = "cwd"
+	RootGit = "git"
+)
+
+// DefaultDirsMode is DefaultDirs with a root mode ("" means RootCwd).
+func DefaultDirsMode(dirs []string, mode string) ([]string, error) {
+	switch mode {
+	case "", RootCwd:
+		return DefaultDirs(dirs), nil
+	case RootGit:
+	default:
+		return nil, fmt.Errorf("invalid root mode %q (want git or cwd)", mode)
+	}
+	if len(dirs) > 0 {
+		return dirs, nil
+	}
+	if root, err := gitOutput(".", "rev-parse", "--show-toplevel"); err == nil && root != "" {
+		return []string{root}, nil
+	}
+	return []string{"."}, nil
+}
+
 // NormalizeDirs validates, resolves symlinks, and sorts directories.
 func NormalizeDirs(dirs []string) ([]string, error) {
 	var res []string
@@ -62,6 +89,94 @@ func DeriveSignature(norm []string) string {
 	return sum
 }
 
+// Signature modes. SignatureV1 hashes mount paths; SignatureV2 hashes each
+// dir's repository identity (git remote + path within the repo) so the same
+// repo cloned at different paths or on different machines maps to one session.
+const (
+	SignatureV1 = "v1"
+	SignatureV2 = "v2"
+)
+
+// DeriveSignatureMode derives the signature for norm using mode ("" means v1).
+func DeriveSignatureMode(norm []string, mode string) (string, error) {
+	switch mode {
+	case "", SignatureV1:
+		return DeriveSignature(norm), nil
+	case SignatureV2:
+		ids := make([]string, 0, len(norm))
+		for _, p := range norm {
+			ids = append(ids, RepoIdentity(p))
+		}
+		sort.Strings(ids)
+		return DeriveSignature(ids), nil
+	default:
+		return "", fmt.Errorf("unknown signature mode %q (want v1 or v2)", mode)
+	}
+}
+
+// WithExcludes folds the --exclude globs into sig, so the same dirs with
+// different exclusions get a different session. Without globs sig is
+// returned unchanged.
+func WithExcludes(sig string, globs []string) string {
+	if len(globs) == 0 {
+		return sig
+	}
+	g := append([]string(nil), globs...)
+	sort.Strings(g)
+	parts := []string{sig}
+	for _, e := range g {
+		parts = append(parts, "exclude:"+e)
+	}
+	return DeriveSignature(parts)
+}
+
+// RepoIdentity returns "<remote>//<path in repo>" for a dir inside a git
+// checkout with an origin remote, otherwise the dir itself.
+func RepoIdentity(dir string) string {
+	root, err := gitOutput(dir, "rev-parse", "--show-toplevel")
+	if err != nil || root == "" {
+		return dir
+	}
+	remote, err := gitOutput(dir, "remote", "get-url", "origin")
+	if err != nil || remote == "" {
+		return dir
+	}
+	if r, err := filepath.EvalSymlinks(root); err == nil {
+		root = r
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return dir
+	}
+	return NormalizeRemote(remote) + "//" + filepath.ToSlash(rel)
+}
+
+// NormalizeRemote reduces equivalent git remote spellings to host/path, e.g.
+// git@github.com:org/repo.git and https://github.com/org/repo both become
+// github.com/org/repo.
+func NormalizeRemote(remote string) string {
+	r := strings.TrimSpace(remote)
+	if i := strings.Index(r, "://"); i >= 0 {
+		r = r[i+3:]
+	} else if i := strings.Index(r, ":"); i >= 0 && !strings.Contains(r[:i], "/") {
+		// scp-like syntax: [user@]host:path
+		r = r[:i] + "/" + r[i+1:]
+	}
+	if i := strings.Index(r, "@"); i >= 0 && i < strings.Index(r+"/", "/") {
+		r = r[i+1:]
+	}
+	r = strings.TrimSuffix(strings.TrimSuffix(r, "/"), ".git")
+	if i := strings.Index(r, "/"); i >= 0 {
+		return strings.ToLower(r[:i]) + r[i:]
+	}
+	return strings.ToLower(r)
+}
+
+func gitOutput(dir string, args ...string) (string, error) {
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).Output()
+	return strings.TrimSpace(string(out)), err
+}
+
 // ToKebab lowercases and replaces non-alphanumerics with single dashes.
 func ToKebab(s string) string {
 	s = strings.TrimSpace(s)
@@ -89,8 +204,30 @@ func ToKebab(s string) string {
 	return out
 }
 
+// DefaultMaxSlugLen bounds the slug derived from directory names.
+const DefaultMaxSlugLen = 24
+
+// DefaultNameTemplate is the container name layout used when none is configured.
+const DefaultNameTemplate = "{{prefix}}-{{slug}}-{{hash}}"
+
+// Naming customizes container name derivation (config key "naming").
+type Naming struct {
+	Prefix     string `yaml:"prefix"`
+	Template   string `yaml:"template"`
+	MaxSlugLen int    `yaml:"maxSlugLen"`
+	HashLen    int    `yaml:"hashLen"`
+}
+
 // DeriveSlug joins up to two base names of normalized dirs into a slug.
 func DeriveSlug(norm []string) string {
+	return DeriveSlugMax(norm, DefaultMaxSlugLen)
+}
+
+// DeriveSlugMax is DeriveSlug with a custom length bound (<=0 means the default).
+func DeriveSlugMax(norm []string, max int) string {
+	if max <= 0 {
+		max = DefaultMaxSlugLen
+	}
 	parts := []string{}
 	for _, p := range norm {
 		parts = append(parts, ToKebab(filepath.Base(p)))
@@ -99,8 +236,8 @@ func DeriveSlug(norm []string) string {
 		}
 	}
 	slug := strings.Join(parts, "-")
-	if len(slug) > 24 {
-		slug = strings.Trim(slug[:24], "-")
+	if len(slug) > max {
+		slug = strings.Trim(slug[:max], "-")
 	}
 	if slug == "" {
 		slug = "ws"
@@ -108,11 +245,71 @@ func DeriveSlug(norm []string) string {
 	return slug
 }
 
-// DeriveName composes the final container name from env prefix, slug and signature.
-func DeriveName(slug, sig string) string {
+var (
+	placeholder = regexp.MustCompile(`{{\s*(\w+)\s*}}`)
+	// dockerName mirrors the engine's container name constraint.
+	dockerName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]+$`)
+)
+
+// DeriveName composes the final container name from prefix, slug,
+// signature and owner. The prefix comes from CLAUDEX_NAME_PREFIX, then
+// n.Prefix, then "claudex"; n.Template (default DefaultNameTemplate) may
+// reference {{prefix}}, {{slug}}, {{hash}} and {{owner}}. n.HashLen (1-8)
+// shortens the hash.
+func DeriveName(slug, sig, owner string, n Naming) (string, error) {
 	prefix := os.Getenv("CLAUDEX_NAME_PREFIX")
+	if prefix == "" {
+		prefix = n.Prefix
+	}
 	if prefix == "" {
 		prefix = "claudex"
 	}
-	return fmt.Sprintf("%s-%s-%s", prefix, slug, sig)
+	if n.HashLen < 0 || n.HashLen > 8 {
+		return "", fmt.Errorf("naming.hashLen must be between 1 and 8, got %d", n.HashLen)
+	}
+	if n.HashLen > 0 && len(sig) > n.HashLen {
+		sig = sig[:n.HashLen]
+	}
+	tmpl := n.Template
+	if tmpl == "" {
+		tmpl = DefaultNameTemplate
+	}
+	vals := map[string]string{"prefix": prefix, "slug": slug, "hash": sig, "owner": owner}
+	if owner == "" && placeholderUsed(tmpl, "owner") {
+		return "", fmt.Errorf("naming template %q uses {{owner}}, but no user name is known; set owner in config", tmpl)
+	}
+	var bad string
+	name := placeholder.ReplaceAllStringFunc(tmpl, func(m string) string {
+		key := placeholder.FindStringSubmatch(m)[1]
+		v, ok := vals[key]
+		if !ok && bad == "" {
+			bad = key
+		}
+		return v
+	})
+	if bad != "" {
+		return "", fmt.Errorf("unknown placeholder {{%s}} in naming template %q", bad, tmpl)
+	}
+	if err := ValidateName(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// placeholderUsed reports whether tmpl references {{key}}.
+func placeholderUsed(tmpl, key string) bool {
+	for _, m := range placeholder.FindAllStringSubmatch(tmpl, -1) {
+		if m[1] == key {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateName checks name against docker's container name rules.
+func ValidateName(name string) error {
+	if !dockerName.MatchString(name) {
+		return fmt.Errorf("invalid container name %q: must match [a-zA-Z0-9][a-zA-Z0-9_.-]+", name)
+	}
+	return nil
 }
@@ -0,0 +1,318 @@
+// Package claudex is the Go API for managing claudex sessions from other
+// tools. It does what the CLI does for create, attach, push, pull and
+// destroy, but never prompts or reads stdin, and writes progress only to the
+// Client's Log. Sessions are the same containers the CLI manages, so both
+// can be used side by side.
+//
+// The API is kept stable across claudex releases; everything under
+// internal/ may change.
+package claudex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/containers"
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/run"
+	"github.com/photodialectic/claudex/internal/state"
+)
+
+// Errors returned by Client methods; test for them with errors.Is.
+var (
+	// ErrNotFound means no claudex session has the name.
+	ErrNotFound = errors.New("no such claudex session")
+	// ErrNotRunning means the session exists but is stopped.
+	ErrNotRunning = errors.New("claudex session is not running")
+	// ErrProtected means the session is protected (claudex protect) and
+	// Destroy was not forced.
+	ErrProtected = errors.New("claudex session is protected")
+)
+
+// Session is a claudex container.
+type Session struct {
+	Name string
+	// Signature identifies the workspace: the same dirs give the same one.
+	Signature string
+	Slug      string
+	// Status is the engine's state: running, exited, created, paused...
+	Status  string
+	Image   string
+	Created time.Time
+	// Mounts are the host dirs mounted at /workspace/<basename>.
+	Mounts    []string
+	Protected bool
+}
+
+// Running reports whether the session's container is running.
+func (s Session) Running() bool { return s.Status == "running" }
+
+// Client manages sessions through the container engine claudex is
+// configured for (docker by default, or CLAUDEX_ENGINE).
+type Client struct {
+	docker dockerx.Docker
+	// Log receives the progress and warnings the CLI would print. Nil
+	// discards them.
+	Log io.Writer
+}
+
+// NewClient returns a Client for the default engine.
+func NewClient() *Client {
+	return &Client{docker: dockerx.New()}
+}
+
+func (c *Client) dx(ctx context.Context) dockerx.Docker {
+	return c.docker.WithContext(ctx)
+}
+
+func (c *Client) log() io.Writer {
+	if c.Log == nil {
+		return io.Discard
+	}
+	return c.Log
+}
+
+// Sessions lists claudex sessions, oldest first. Stopped ones are included
+// when all is set.
+func (c *Client) Sessions(ctx context.Context, all bool) ([]Session, error) {
+	cons, err := containers.List(c.dx(ctx), all)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Session, 0, len(cons))
+	for i := range cons {
+		res = append(res, sessionOf(&cons[i]))
+	}
+	return res, nil
+}
+
+// Session returns the session called name.
+func (c *Client) Session(ctx context.Context, name string) (Session, error) {
+	info, err := c.inspect(c.dx(ctx), name)
+	if err != nil {
+		return Session{}, err
+	}
+	return sessionOf(info), nil
+}
+
+func (c *Client) inspect(dx dockerx.Docker, name string) (*dockerx.Container, error) {
+	ok, _, info, err := containers.Exists(dx, name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || !containers.IsClaudex(info) {
+		return nil, fmt.Errorf("%s: %w", name, ErrNotFound)
+	}
+	return info, nil
+}
+
+func (c *Client) running(dx dockerx.Docker, name string) error {
+	info, err := c.inspect(dx, name)
+	if err != nil {
+		return err
+	}
+	if info.Status != "running" {
+		return fmt.Errorf("%s: %w", name, ErrNotRunning)
+	}
+	return nil
+}
+
+func sessionOf(info *dockerx.Container) Session {
+	mounts, _ := containers.MountsFromLabel(info)
+	return Session{
+		Name:      info.Name,
+		Signature: info.Labels["com.claudex.signature"],
+		Slug:      info.Labels["com.claudex.slug"],
+		Status:    info.Status,
+		Image:     info.Image,
+		Created:   info.CreatedAt,
+		Mounts:    mounts,
+		Protected: run.Protected(info),
+	}
+}
+
+// CreateOptions configures Create. The zero value mounts the current
+// directory under the name the CLI would derive.
+type CreateOptions struct {
+	// Dirs are the host dirs to mount; default the current directory.
+	Dirs []string
+	// Name overrides the derived container name.
+	Name string
+	// Replace removes an existing container of the same name first;
+	// otherwise an existing one is reused, and started if stopped.
+	Replace bool
+	// Firewall restricts egress to the allowlist.
+	Firewall bool
+	// HostNetwork shares the host's network (published ports where the
+	// engine runs in a VM).
+	HostNetwork bool
+	// Args are further `claudex` run flags, e.g. "--nested-docker", "sysbox".
+	Args []string
+}
+
+func (o CreateOptions) args() []string {
+	args := append([]string(nil), o.Dirs...)
+	if o.Name != "" {
+		args = append(args, "--name", o.Name)
+	}
+	if o.Replace {
+		args = append(args, "--replace")
+	}
+	if o.Firewall {
+		args = append(args, "--firewall")
+	}
+	if o.HostNetwork {
+		args = append(args, "--host-network")
+	}
+	return append(args, o.Args...)
+}
+
+// Create brings a session up detached, building the image first if needed,
+// and returns it. Where the CLI would ask (an unhealthy container that a
+// restart did not fix) it returns an error instead.
+func (c *Client) Create(ctx context.Context, opts CreateOptions) (Session, error) {
+	dx := c.dx(ctx)
+	name, err := run.Up(opts.args(), c.log(), c.log(), dx)
+	if err != nil {
+		return Session{}, err
+	}
+	info, err := c.inspect(dx, name)
+	if err != nil {
+		return Session{}, err
+	}
+	return sessionOf(info), nil
+}
+
+// AttachOptions configures Attach. Nil streams are empty input and
+// discarded output.
+type AttachOptions struct {
+	// Shell is bash (default), zsh or fish.
+	Shell string
+	// Env adds KEY=VALUE pairs to the shell's environment.
+	Env []string
+	// Workdir is where the shell starts; relative paths are under
+	// /workspace. Default /workspace.
+	Workdir string
+	Stdin   io.Reader
+	Stdout  io.Writer
+	Stderr  io.Writer
+}
+
+// Attach runs an interactive shell in the running session name and returns
+// when it exits. A pseudo-terminal is used only when Stdin and Stdout are
+// both terminals.
+func (c *Client) Attach(ctx context.Context, name string, opts AttachOptions) error {
+	dx := c.dx(ctx)
+	if err := c.running(dx, name); err != nil {
+		return err
+	}
+	in, out, errOut := opts.Stdin, opts.Stdout, opts.Stderr
+	if in == nil {
+		in = strings.NewReader("")
+	}
+	if out == nil {
+		out = io.Discard
+	}
+	if errOut == nil {
+		errOut = io.Discard
+	}
+	workdir := opts.Workdir
+	if workdir == "" {
+		workdir = "/workspace"
+	}
+	return run.Attach(name, run.AttachOptions{Shell: opts.Shell, Env: opts.Env, Workdir: workdir}, in, out, errOut, dx)
+}
+
+// Push copies host files or dirs into the running session name, under to
+// (relative paths are under /workspace; default /workspace). A src ending
+// in "/." copies a directory's contents rather than the directory.
+func (c *Client) Push(ctx context.Context, name string, srcs []string, to string) error {
+	dx := c.dx(ctx)
+	if err := c.running(dx, name); err != nil {
+		return err
+	}
+	dest := "/workspace/"
+	if to != "" {
+		if !path.IsAbs(to) {
+			to = path.Join("/workspace", to)
+		}
+		dest = strings.TrimSuffix(path.Clean(to), "/") + "/"
+		if err := dx.Exec(name, "mkdir", "-p", dest); err != nil {
+			return fmt.Errorf("cannot create %s in %s: %w", dest, name, err)
+		}
+	}
+	for _, src := range srcs {
+		contents := strings.HasSuffix(filepath.ToSlash(src), "/.")
+		abs, err := filepath.Abs(src)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(abs); err != nil {
+			return err
+		}
+		if contents {
+			abs += string(filepath.Separator) + "."
+		}
+		fmt.Fprintf(c.log(), "Pushing %s -> %s:%s\n", abs, name, dest)
+		if err := dx.CP(abs, name+":"+dest); err != nil {
+			return fmt.Errorf("copy %s into %s: %w", src, name, err)
+		}
+	}
+	return nil
+}
+
+// Pull copies src (a path in the running session name; relative paths are
+// under /workspace) into the host dir dest, creating it. Unlike `claudex
+// pull` it overwrites existing files without comparing them.
+func (c *Client) Pull(ctx context.Context, name, src, dest string) error {
+	dx := c.dx(ctx)
+	if err := c.running(dx, name); err != nil {
+		return err
+	}
+	if !path.IsAbs(src) {
+		src = path.Join("/workspace", src)
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.log(), "Pulling %s:%s -> %s\n", name, src, dest)
+	if err := dx.CP(name+":"+src, dest); err != nil {
+		return fmt.Errorf("copy %s out of %s: %w", src, name, err)
+	}
+	return nil
+}
+
+// DestroyOptions configures Destroy.
+type DestroyOptions struct {
+	// Force destroys protected sessions too.
+	Force bool
+}
+
+// Destroy removes the session name and its container, keeping its history
+// in the claudex state store as the CLI does.
+func (c *Client) Destroy(ctx context.Context, name string, opts DestroyOptions) error {
+	dx := c.dx(ctx)
+	info, err := c.inspect(dx, name)
+	if err != nil {
+		return err
+	}
+	if run.Protected(info) && !opts.Force {
+		return fmt.Errorf("%s: %w (lift it with claudex protect --off)", name, ErrProtected)
+	}
+	if err := dx.Remove(name, true); err != nil {
+		return err
+	}
+	now := time.Now()
+	return state.Update(func(s *state.Store) error {
+		s.MarkRemoved(name, now)
+		_ = run.RemoveHostGitCopies(name)
+		return nil
+	})
+}
@@ -0,0 +1,115 @@
+package claudex
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/photodialectic/claudex/internal/dockerx"
+	"github.com/photodialectic/claudex/internal/policy"
+	"github.com/photodialectic/claudex/internal/run"
+	"github.com/photodialectic/claudex/internal/state"
+)
+
+func TestClientManagesSessionsWithoutPrompting(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	if err := state.Update(func(s *state.Store) error {
+		s.Upsert(state.Session{Name: "claudex-old-2", Signature: "s2"})
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	fx := &dockerx.Fake{Containers: map[string]dockerx.Container{
+		"claudex-app-1": {Name: "claudex-app-1", Status: "running", CreatedAt: time.Unix(100, 0), Labels: map[string]string{
+			"com.claudex.signature": "s1", "com.claudex.slug": "app", "com.claudex.mounts": `["/src/app"]`,
+		}},
+		"claudex-old-2": {Name: "claudex-old-2", Status: "exited", CreatedAt: time.Unix(50, 0), Labels: map[string]string{
+			"com.claudex.signature": "s2", run.ProtectedLabel: "true",
+		}},
+		"postgres": {Name: "postgres", Status: "running"},
+	}}
+	c := &Client{docker: fx}
+	ctx := context.Background()
+
+	sessions, err := c.Sessions(ctx, true)
+	if err != nil || len(sessions) != 2 || sessions[0].Name != "claudex-old-2" || !sessions[0].Protected {
+		t.Fatalf("sessions = %+v, %v", sessions, err)
+	}
+	if s := sessions[1]; !s.Running() || s.Slug != "app" || len(s.Mounts) != 1 || s.Mounts[0] != "/src/app" {
+		t.Fatalf("session = %+v", s)
+	}
+	if _, err := c.Session(ctx, "postgres"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("non-claudex container: %v", err)
+	}
+
+	dir := t.TempDir()
+	if err := c.Push(ctx, "claudex-app-1", []string{dir + "/."}, "notes"); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if len(fx.ExecCalls) != 1 || fx.ExecCalls[0][3] != "/workspace/notes/" {
+		t.Fatalf("exec = %v", fx.ExecCalls)
+	}
+	if got := fx.CPCalls[0]; got != [2]string{dir + string(filepath.Separator) + ".", "claudex-app-1:/workspace/notes/"} {
+		t.Fatalf("push cp = %v", got)
+	}
+	dest := filepath.Join(t.TempDir(), "out")
+	if err := c.Pull(ctx, "claudex-app-1", "app/dist", dest); err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+	if got := fx.CPCalls[1]; got != [2]string{"claudex-app-1:/workspace/app/dist", dest} {
+		t.Fatalf("pull cp = %v", got)
+	}
+	if _, err := os.Stat(dest); err != nil {
+		t.Fatalf("pull did not create dest: %v", err)
+	}
+	if err := c.Pull(ctx, "claudex-old-2", "x", dest); !errors.Is(err, ErrNotRunning) {
+		t.Fatalf("pull from a stopped session: %v", err)
+	}
+	if err := c.Attach(ctx, "claudex-old-2", AttachOptions{}); !errors.Is(err, ErrNotRunning) {
+		t.Fatalf("attach to a stopped session: %v", err)
+	}
+
+	if err := c.Destroy(ctx, "claudex-old-2", DestroyOptions{}); !errors.Is(err, ErrProtected) || len(fx.RemoveCalls) != 0 {
+		t.Fatalf("destroy protected: %v (removed %v)", err, fx.RemoveCalls)
+	}
+	if err := c.Destroy(ctx, "claudex-old-2", DestroyOptions{Force: true}); err != nil || len(fx.RemoveCalls) != 1 {
+		t.Fatalf("destroy forced: %v (removed %v)", err, fx.RemoveCalls)
+	}
+	st, err := state.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, ok := st.Get("claudex-old-2"); !ok || !s.Removed() {
+		t.Fatalf("state after destroy = %+v", s)
+	}
+}
+
+func TestCreateLabelsAndSecuresTheSession(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("USER", "alice")
+	fx := &dockerx.Fake{ImageExistsVal: true, Simulate: true}
+	c := &Client{docker: fx}
+	dir := t.TempDir()
+	s, err := c.Create(context.Background(), CreateOptions{Dirs: []string{dir}, Name: "sdk", Args: []string{"--no-git", "--no-sudo", "--audit"}})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if !s.Running() || s.Name != "sdk" || len(s.Mounts) != 1 || s.Mounts[0] != dir {
+		t.Fatalf("session = %+v", s)
+	}
+	info := fx.Containers["sdk"]
+	for k, want := range map[string]string{run.OwnerLabel: "alice", "com.claudex.audit": "true", "com.claudex.signature": s.Signature} {
+		if info.Labels[k] != want {
+			t.Errorf("label %s = %q, want %q", k, info.Labels[k], want)
+		}
+	}
+	if !reflect.DeepEqual(info.SecurityOpt, []string{policy.NoNewPrivileges}) {
+		t.Errorf("security options = %v, want no-sudo", info.SecurityOpt)
+	}
+}